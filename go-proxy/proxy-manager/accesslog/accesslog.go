@@ -2,10 +2,14 @@ package accesslog
 
 import (
 	"container/ring"
+	"fmt"
+	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chilla55/proxy-manager/database"
+	"github.com/chilla55/proxy-manager/events"
 	"github.com/rs/zerolog/log"
 )
 
@@ -16,6 +20,46 @@ type Logger struct {
 	ringMutex  sync.RWMutex
 	bufferSize int
 	enabled    bool
+
+	// Batched database writer
+	batch     BatchConfig
+	queue     chan AccessLogEntry
+	done      chan struct{}
+	closeOnce sync.Once
+	dropped   uint64
+	batches   uint64
+	failed    uint64
+
+	events *events.Bus // Receives 5xx responses (optional)
+
+	// Formatted lines for stdout or a file (optional)
+	output   io.Writer
+	format   *Format
+	outputMu sync.Mutex
+}
+
+// BatchConfig controls how entries are written to the database. Entries are
+// queued and written in one transaction once BatchSize entries are pending
+// or FlushInterval has passed since the first one.
+type BatchConfig struct {
+	QueueSize     int           // Entries beyond this are dropped (kept in the ring buffer only)
+	BatchSize     int           // Max entries per transaction
+	FlushInterval time.Duration // Max time an entry waits in the queue
+}
+
+// DefaultBatchConfig returns the batching used by NewLogger
+func DefaultBatchConfig() BatchConfig {
+	return BatchConfig{
+		QueueSize:     10000,
+		BatchSize:     200,
+		FlushInterval: 10 * time.Millisecond,
+	}
+}
+
+// batchWriter is implemented by databases that can insert many entries in a
+// single transaction
+type batchWriter interface {
+	LogAccessRequests(entries []database.AccessLogEntry) error
 }
 
 // Database interface for access log persistence
@@ -29,20 +73,110 @@ type Database interface {
 // AccessLogEntry is an alias for database.AccessLogEntry
 type AccessLogEntry = database.AccessLogEntry
 
-// NewLogger creates a new access logger
+// NewLogger creates a new access logger with the default batching
 func NewLogger(db Database, bufferSize int) *Logger {
+	return NewLoggerWithBatch(db, bufferSize, DefaultBatchConfig())
+}
+
+// NewLoggerWithBatch creates a new access logger and starts its background
+// database writer. Call Close to flush pending entries on shutdown.
+func NewLoggerWithBatch(db Database, bufferSize int, batch BatchConfig) *Logger {
 	if bufferSize <= 0 {
 		bufferSize = 1000 // Default: last 1000 requests
 	}
+	defaults := DefaultBatchConfig()
+	if batch.QueueSize <= 0 {
+		batch.QueueSize = defaults.QueueSize
+	}
+	if batch.BatchSize <= 0 {
+		batch.BatchSize = defaults.BatchSize
+	}
+	if batch.FlushInterval <= 0 {
+		batch.FlushInterval = defaults.FlushInterval
+	}
 
-	return &Logger{
+	l := &Logger{
 		db:         db,
 		ringBuffer: ring.New(bufferSize),
 		bufferSize: bufferSize,
 		enabled:    true,
+		batch:      batch,
+		queue:      make(chan AccessLogEntry, batch.QueueSize),
+		done:       make(chan struct{}),
+	}
+	go l.writeLoop(l.queue)
+
+	return l
+}
+
+// writeLoop drains the queue into the database in batches until Close
+func (l *Logger) writeLoop(queue <-chan AccessLogEntry) {
+	defer close(l.done)
+
+	pending := make([]AccessLogEntry, 0, l.batch.BatchSize)
+	for {
+		entry, ok := <-queue
+		if !ok {
+			return
+		}
+		pending = append(pending[:0], entry)
+
+		timer := time.NewTimer(l.batch.FlushInterval)
+	collect:
+		for len(pending) < l.batch.BatchSize {
+			select {
+			case entry, ok := <-queue:
+				if !ok {
+					break collect
+				}
+				pending = append(pending, entry)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		l.writeBatch(pending)
 	}
 }
 
+func (l *Logger) writeBatch(entries []AccessLogEntry) {
+	if l.db == nil {
+		return
+	}
+	atomic.AddUint64(&l.batches, 1)
+
+	if bw, ok := l.db.(batchWriter); ok {
+		if err := bw.LogAccessRequests(entries); err != nil {
+			atomic.AddUint64(&l.failed, uint64(len(entries)))
+			log.Error().Err(err).Int("entries", len(entries)).Msg("Failed to write access log batch to database")
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		if err := l.db.LogAccessRequest(entry); err != nil {
+			atomic.AddUint64(&l.failed, 1)
+			log.Error().
+				Err(err).
+				Str("domain", entry.Domain).
+				Str("path", entry.Path).
+				Msg("Failed to log access request to database")
+		}
+	}
+}
+
+// Close stops accepting database writes and flushes queued entries
+func (l *Logger) Close() {
+	l.closeOnce.Do(func() {
+		l.ringMutex.Lock()
+		close(l.queue)
+		l.queue = nil
+		l.ringMutex.Unlock()
+		<-l.done
+	})
+}
+
 // LogRequest logs an HTTP request to both ring buffer and database
 func (l *Logger) LogRequest(entry AccessLogEntry) {
 	if !l.enabled {
@@ -51,25 +185,32 @@ func (l *Logger) LogRequest(entry AccessLogEntry) {
 
 	// Set timestamp if not set
 	if entry.Timestamp == 0 {
-		entry.Timestamp = time.Now().Unix()
+		entry.Timestamp = time.Now().UnixMilli()
 	}
 
-	// Store in ring buffer (in-memory)
+	// Store in ring buffer (in-memory) and queue for the database writer.
+	// Never block the request: when the queue is full the entry only lives
+	// in the ring buffer.
 	l.ringMutex.Lock()
 	l.ringBuffer.Value = entry
 	l.ringBuffer = l.ringBuffer.Next()
+	if l.queue != nil {
+		select {
+		case l.queue <- entry:
+		default:
+			if atomic.AddUint64(&l.dropped, 1)%1000 == 1 {
+				log.Warn().Uint64("dropped", atomic.LoadUint64(&l.dropped)).Msg("Access log queue full, dropping database writes")
+			}
+		}
+	}
 	l.ringMutex.Unlock()
 
-	// Store in database (async, non-blocking)
-	go func() {
-		if err := l.db.LogAccessRequest(entry); err != nil {
-			log.Error().
-				Err(err).
-				Str("domain", entry.Domain).
-				Str("path", entry.Path).
-				Msg("Failed to log access request to database")
-		}
-	}()
+	if l.output != nil {
+		line := l.format.Render(entry)
+		l.outputMu.Lock()
+		l.output.Write(line)
+		l.outputMu.Unlock()
+	}
 
 	// Log errors to stderr for immediate visibility
 	if entry.Status >= 400 {
@@ -88,6 +229,35 @@ func (l *Logger) LogRequest(entry AccessLogEntry) {
 			Str("error", entry.Error).
 			Msg("Request error")
 	}
+
+	if entry.Status >= 500 {
+		l.events.Publish(events.Event{
+			Type:     events.TypeError,
+			Severity: "error",
+			Message:  fmt.Sprintf("%d %s %s%s", entry.Status, entry.Method, entry.Domain, entry.Path),
+			Data: map[string]interface{}{
+				"domain":      entry.Domain,
+				"method":      entry.Method,
+				"path":        entry.Path,
+				"status":      entry.Status,
+				"response_ms": entry.ResponseTimeMs,
+				"client_ip":   entry.ClientIP,
+				"error":       entry.Error,
+			},
+		})
+	}
+}
+
+// SetOutput also writes every entry to w, rendered with format. Call it
+// before the first request.
+func (l *Logger) SetOutput(w io.Writer, format *Format) {
+	l.output = w
+	l.format = format
+}
+
+// SetEventBus publishes server errors (5xx) to bus
+func (l *Logger) SetEventBus(bus *events.Bus) {
+	l.events = bus
 }
 
 // GetRecentRequests returns the last N requests from ring buffer
@@ -151,6 +321,64 @@ func (l *Logger) GetRecentErrors(limit int) []AccessLogEntry {
 	return errors
 }
 
+// TakeErrors returns every error (status >= 400) in the ring buffer, newest
+// first, and removes them from it in the same step. Other entries are kept,
+// packed into a new ring so that empty slots stay at the oldest end.
+func (l *Logger) TakeErrors() []AccessLogEntry {
+	l.ringMutex.Lock()
+	defer l.ringMutex.Unlock()
+
+	errors := []AccessLogEntry{}
+	kept := ring.New(l.bufferSize)
+	l.ringBuffer.Do(func(value interface{}) {
+		entry, ok := value.(AccessLogEntry)
+		if !ok {
+			return
+		}
+		if entry.Status >= 400 {
+			errors = append(errors, entry)
+			return
+		}
+		kept.Value = entry
+		kept = kept.Next()
+	})
+	l.ringBuffer = kept
+
+	// Reverse to get newest first
+	for i, j := 0, len(errors)-1; i < j; i, j = i+1, j-1 {
+		errors[i], errors[j] = errors[j], errors[i]
+	}
+	return errors
+}
+
+// Query returns ring buffer entries matching f, newest first, paged by
+// f.Offset and f.Limit, and the total number of matches. Used when the
+// database is unavailable; cursors are not supported.
+func (l *Logger) Query(f database.AccessLogFilter) ([]AccessLogEntry, int) {
+	l.ringMutex.RLock()
+	defer l.ringMutex.RUnlock()
+
+	entries := []AccessLogEntry{}
+	total := 0
+	// l.ringBuffer points at the next slot to write, so walk backwards from
+	// the one before it to go newest to oldest
+	r := l.ringBuffer.Prev()
+	for i := 0; i < l.bufferSize; i, r = i+1, r.Prev() {
+		entry, ok := r.Value.(AccessLogEntry)
+		if !ok {
+			break
+		}
+		if !f.Matches(entry) {
+			continue
+		}
+		if total >= f.Offset && len(entries) < f.Limit {
+			entries = append(entries, entry)
+		}
+		total++
+	}
+	return entries, total
+}
+
 // GetStats returns access log statistics
 func (l *Logger) GetStats() LogStats {
 	l.ringMutex.RLock()
@@ -188,9 +416,28 @@ func (l *Logger) GetStats() LogStats {
 	stats.StatusCounts = statusCounts
 	stats.MethodCounts = methodCounts
 
+	stats.QueueDepth = len(l.queue)
+	stats.QueueCapacity = l.batch.QueueSize
+	stats.DroppedEntries = atomic.LoadUint64(&l.dropped)
+	stats.BatchesWritten = atomic.LoadUint64(&l.batches)
+	stats.FailedEntries = atomic.LoadUint64(&l.failed)
+
 	return stats
 }
 
+// QueueDepth returns the number of entries waiting for the database writer
+func (l *Logger) QueueDepth() int {
+	l.ringMutex.RLock()
+	defer l.ringMutex.RUnlock()
+	return len(l.queue)
+}
+
+// DroppedEntries returns how many entries were not persisted because the
+// queue was full
+func (l *Logger) DroppedEntries() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
 // LogStats represents access log buffer statistics
 type LogStats struct {
 	BufferSize            int            `json:"buffer_size"`
@@ -200,6 +447,11 @@ type LogStats struct {
 	AverageResponseTimeMs float64        `json:"average_response_time_ms"`
 	StatusCounts          map[int]int    `json:"status_counts"`
 	MethodCounts          map[string]int `json:"method_counts"`
+	QueueDepth            int            `json:"queue_depth"`
+	QueueCapacity         int            `json:"queue_capacity"`
+	DroppedEntries        uint64         `json:"dropped_entries"`
+	BatchesWritten        uint64         `json:"batches_written"`
+	FailedEntries         uint64         `json:"failed_entries"`
 }
 
 // Enable enables access logging
@@ -1,9 +1,16 @@
 package accesslog
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/chilla55/proxy-manager/database"
 )
 
 type mockDB struct{ calls int64 }
@@ -66,3 +73,220 @@ func TestLoggerBasic(t *testing.T) {
 	l.Enable()
 	l.Clear()
 }
+
+type batchDB struct {
+	mockDB
+	gate    chan struct{}
+	batches int64
+	entries int64
+}
+
+func (m *batchDB) LogAccessRequests(entries []AccessLogEntry) error {
+	if m.gate != nil {
+		<-m.gate
+	}
+	atomic.AddInt64(&m.batches, 1)
+	atomic.AddInt64(&m.entries, int64(len(entries)))
+	return nil
+}
+
+func TestLoggerBatchesWrites(t *testing.T) {
+	db := &batchDB{}
+	l := NewLoggerWithBatch(db, 100, BatchConfig{QueueSize: 100, BatchSize: 10, FlushInterval: time.Hour})
+
+	for i := 0; i < 25; i++ {
+		l.LogRequest(AccessLogEntry{Domain: "example.com", Path: "/", Status: 200})
+	}
+	l.Close()
+
+	if got := atomic.LoadInt64(&db.entries); got != 25 {
+		t.Fatalf("expected 25 entries written, got %d", got)
+	}
+	if got := atomic.LoadInt64(&db.batches); got != 3 {
+		t.Fatalf("expected 3 batches (10+10+5), got %d", got)
+	}
+	if atomic.LoadInt64(&db.calls) != 0 {
+		t.Fatalf("expected no single-row inserts, got %d", db.calls)
+	}
+}
+
+func TestLoggerDropsWhenQueueFull(t *testing.T) {
+	db := &batchDB{gate: make(chan struct{})}
+	l := NewLoggerWithBatch(db, 100, BatchConfig{QueueSize: 5, BatchSize: 1, FlushInterval: time.Millisecond})
+
+	// The writer takes one entry and blocks on the gate, the queue then
+	// holds five more and the rest are dropped without blocking
+	for i := 0; i < 20; i++ {
+		l.LogRequest(AccessLogEntry{Domain: "example.com", Path: "/", Status: 200})
+	}
+
+	stats := l.GetStats()
+	if stats.TotalEntries != 20 {
+		t.Fatalf("expected all entries in ring buffer, got %d", stats.TotalEntries)
+	}
+	if stats.DroppedEntries == 0 || stats.DroppedEntries > 15 {
+		t.Fatalf("unexpected dropped count %d", stats.DroppedEntries)
+	}
+	if stats.QueueDepth > stats.QueueCapacity {
+		t.Fatalf("queue depth %d exceeds capacity %d", stats.QueueDepth, stats.QueueCapacity)
+	}
+
+	close(db.gate)
+	l.Close()
+	if written := uint64(atomic.LoadInt64(&db.entries)); written+stats.DroppedEntries != 20 {
+		t.Fatalf("written %d + dropped %d != 20", written, stats.DroppedEntries)
+	}
+}
+
+func benchEntry() AccessLogEntry {
+	return AccessLogEntry{
+		Timestamp: time.Now().UnixMilli(), Domain: "example.com", Method: "GET", Path: "/",
+		Status: 200, ClientIP: "1.2.3.4", UserAgent: "bench", Protocol: "HTTP/1.1",
+	}
+}
+
+// BenchmarkDirectInsert is the per-request cost of writing synchronously
+func BenchmarkDirectInsert(b *testing.B) {
+	db, err := database.Open(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := db.LogAccessRequest(benchEntry()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLoggerLogRequest is the per-request cost with the batched writer
+func BenchmarkLoggerLogRequest(b *testing.B) {
+	db, err := database.Open(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	l := NewLoggerWithBatch(db, 1000, BatchConfig{QueueSize: b.N + 1})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.LogRequest(benchEntry())
+	}
+	b.StopTimer()
+	l.Close()
+}
+
+func TestLoggerQueryNewestFirst(t *testing.T) {
+	l := NewLogger(&mockDB{}, 5)
+	defer l.Close()
+
+	// Seven entries into a five-slot buffer: /2 ... /6 remain
+	for i := 0; i < 7; i++ {
+		status := 200
+		if i%2 == 0 {
+			status = 502
+		}
+		l.LogRequest(AccessLogEntry{Timestamp: int64(i + 1), Domain: "example.com", Path: fmt.Sprintf("/%d", i), Status: status})
+	}
+
+	entries, total := l.Query(database.AccessLogFilter{Limit: 2})
+	if total != 5 || len(entries) != 2 || entries[0].Path != "/6" || entries[1].Path != "/5" {
+		t.Fatalf("unexpected first page: total %d, %v", total, entries)
+	}
+
+	entries, total = l.Query(database.AccessLogFilter{StatusMin: 500, Limit: 10, Offset: 1})
+	if total != 3 || len(entries) != 2 || entries[0].Path != "/4" || entries[1].Path != "/2" {
+		t.Fatalf("unexpected filtered page: total %d, %v", total, entries)
+	}
+}
+
+func TestLoggerTakeErrors(t *testing.T) {
+	l := NewLogger(&mockDB{}, 5)
+	defer l.Close()
+
+	for i, status := range []int{200, 502, 404, 200} {
+		l.LogRequest(AccessLogEntry{Timestamp: int64(i + 1), Path: fmt.Sprintf("/%d", i), Status: status})
+	}
+
+	errors := l.TakeErrors()
+	if len(errors) != 2 || errors[0].Path != "/2" || errors[1].Path != "/1" {
+		t.Fatalf("expected the errors newest first, got %v", errors)
+	}
+	if again := l.TakeErrors(); len(again) != 0 {
+		t.Fatalf("expected no errors after taking them, got %v", again)
+	}
+
+	// Other entries are kept in order and new ones follow them
+	l.LogRequest(AccessLogEntry{Timestamp: 5, Path: "/4", Status: 500})
+	entries, total := l.Query(database.AccessLogFilter{Limit: 10})
+	if total != 3 || entries[0].Path != "/4" || entries[1].Path != "/3" || entries[2].Path != "/0" {
+		t.Fatalf("unexpected entries after TakeErrors: total %d, %v", total, entries)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 12, 30, 45, 0, time.FixedZone("", 3600)).UnixMilli()
+	entry := AccessLogEntry{
+		Timestamp: ts, Domain: "example.com", Method: "GET", Path: "/search", Query: "q=1",
+		Status: 200, ResponseTimeMs: 1234, ClientIP: "203.0.113.7", UserAgent: `curl/8 "evil"` + "\n1.2.3.4 fake",
+		BytesSent: 512, Protocol: "HTTP/1.1", RequestID: "abc",
+	}
+
+	f, err := ParseFormat("")
+	if err != nil || f.Name() != FormatCombined {
+		t.Fatalf("expected the combined default, got %v %v", f, err)
+	}
+	want := `203.0.113.7 - - [` + time.UnixMilli(ts).Format("02/Jan/2006:15:04:05 -0700") +
+		`] "GET /search?q=1 HTTP/1.1" 200 512 "-" "curl/8 \x22evil\x22\x0A1.2.3.4 fake"` + "\n"
+	if got := string(f.Render(entry)); got != want {
+		t.Fatalf("combined:\n got %q\nwant %q", got, want)
+	}
+
+	f, err = ParseFormat(`$remote_ip ${host}:$status $request_time ${duration_ms}ms $request_id $upstream_ttfb_ms`)
+	if err != nil || f.Name() != "custom" {
+		t.Fatalf("template: %v %v", f, err)
+	}
+	if got := string(f.Render(entry)); got != "203.0.113.7 example.com:200 1.234 1234ms abc -\n" {
+		t.Fatalf("template rendered %q", got)
+	}
+
+	f, err = ParseFormat(FormatJSON)
+	if err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	var decoded AccessLogEntry
+	line := f.Render(entry)
+	if !bytes.HasSuffix(line, []byte("\n")) || json.Unmarshal(line, &decoded) != nil || decoded != entry {
+		t.Fatalf("json rendered %q", line)
+	}
+
+	if _, err := ParseFormat(FormatMinimal); err != nil {
+		t.Fatalf("minimal: %v", err)
+	}
+	for _, spec := range []string{"$remote_ip $remote_user", "${host", "$ $status", "${}"} {
+		if _, err := ParseFormat(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+	if _, err := ParseFormat("$nope"); err == nil || !strings.Contains(err.Error(), "$nope") {
+		t.Errorf("expected the unknown field in the error, got %v", err)
+	}
+}
+
+func TestLoggerOutput(t *testing.T) {
+	l := NewLogger(nil, 10)
+	defer l.Close()
+	format, err := ParseFormat(FormatMinimal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	l.SetOutput(&out, format)
+
+	l.LogRequest(AccessLogEntry{Domain: "example.com", Method: "GET", Path: "/", Status: 204, ClientIP: "1.2.3.4", ResponseTimeMs: 7})
+	if got := out.String(); got != "1.2.3.4 GET example.com/ 204 7\n" {
+		t.Fatalf("unexpected output %q", got)
+	}
+}
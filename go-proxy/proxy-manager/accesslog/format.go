@@ -0,0 +1,220 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format presets
+const (
+	FormatCombined = "combined" // nginx/Apache combined log format
+	FormatJSON     = "json"     // One JSON object per line
+	FormatMinimal  = "minimal"
+)
+
+// presets are the templates behind the named formats, except json
+var presets = map[string]string{
+	FormatCombined: `$remote_addr - - [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`,
+	FormatMinimal:  `$remote_ip $method $host$uri $status $duration_ms`,
+}
+
+// formatFields renders the named fields of a template. Empty values are
+// written as "-", like nginx.
+var formatFields = map[string]func(e AccessLogEntry) string{
+	"remote_ip":           func(e AccessLogEntry) string { return e.ClientIP },
+	"host":                func(e AccessLogEntry) string { return e.Domain },
+	"method":              func(e AccessLogEntry) string { return e.Method },
+	"path":                func(e AccessLogEntry) string { return e.Path },
+	"query":               func(e AccessLogEntry) string { return e.Query },
+	"uri":                 requestURI,
+	"protocol":            func(e AccessLogEntry) string { return e.Protocol },
+	"request":             func(e AccessLogEntry) string { return e.Method + " " + requestURI(e) + " " + e.Protocol },
+	"status":              func(e AccessLogEntry) string { return strconv.Itoa(e.Status) },
+	"bytes_sent":          func(e AccessLogEntry) string { return strconv.FormatUint(e.BytesSent, 10) },
+	"bytes_received":      func(e AccessLogEntry) string { return strconv.FormatUint(e.BytesReceived, 10) },
+	"duration":            func(e AccessLogEntry) string { return strconv.FormatFloat(float64(e.ResponseTimeMs)/1000, 'f', 3, 64) },
+	"duration_ms":         func(e AccessLogEntry) string { return strconv.FormatInt(e.ResponseTimeMs, 10) },
+	"user_agent":          func(e AccessLogEntry) string { return e.UserAgent },
+	"referer":             func(e AccessLogEntry) string { return e.Referer },
+	"backend":             func(e AccessLogEntry) string { return e.Backend },
+	"request_id":          func(e AccessLogEntry) string { return e.RequestID },
+	"error":               func(e AccessLogEntry) string { return e.Error },
+	"time_local":          func(e AccessLogEntry) string { return entryTime(e).Format("02/Jan/2006:15:04:05 -0700") },
+	"time_iso8601":        func(e AccessLogEntry) string { return entryTime(e).Format(time.RFC3339) },
+	"upstream_connect_ms": func(e AccessLogEntry) string { return formatMs(e.UpstreamConnectMs) },
+	"upstream_tls_ms":     func(e AccessLogEntry) string { return formatMs(e.UpstreamTLSMs) },
+	"upstream_ttfb_ms":    func(e AccessLogEntry) string { return formatMs(e.UpstreamTTFBMs) },
+}
+
+// nginxAliases are nginx variable names accepted for drop-in formats
+var nginxAliases = map[string]string{
+	"remote_addr":     "remote_ip",
+	"request_method":  "method",
+	"request_uri":     "uri",
+	"server_protocol": "protocol",
+	"body_bytes_sent": "bytes_sent",
+	"request_length":  "bytes_received",
+	"request_time":    "duration",
+	"http_user_agent": "user_agent",
+	"http_referer":    "referer",
+}
+
+// Format renders access log entries as lines for stdout or a file. A
+// template is parsed once; rendering only concatenates.
+type Format struct {
+	name  string
+	json  bool
+	parts []formatPart
+}
+
+// formatPart is literal text or, with field set, a named field
+type formatPart struct {
+	literal string
+	field   func(e AccessLogEntry) string
+}
+
+// ParseFormat parses a preset name (combined, json, minimal) or a template
+// of $name or ${name} fields and literal text. Unknown fields are an error.
+// An empty spec is the combined format.
+func ParseFormat(spec string) (*Format, error) {
+	if spec == "" {
+		spec = FormatCombined
+	}
+	if spec == FormatJSON {
+		return &Format{name: FormatJSON, json: true}, nil
+	}
+	name := "custom"
+	if preset, ok := presets[spec]; ok {
+		name, spec = spec, preset
+	}
+
+	f := &Format{name: name}
+	var literal strings.Builder
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '$' {
+			literal.WriteByte(spec[i])
+			continue
+		}
+
+		var field string
+		end := i + 1
+		if end < len(spec) && spec[end] == '{' {
+			closing := strings.IndexByte(spec[end:], '}')
+			if closing < 0 {
+				return nil, fmt.Errorf("unterminated ${ at offset %d", i)
+			}
+			field = spec[end+1 : end+closing]
+			end += closing + 1
+		} else {
+			for end < len(spec) && isFieldByte(spec[end]) {
+				end++
+			}
+			field = spec[i+1 : end]
+		}
+		if field == "" {
+			return nil, fmt.Errorf("empty field name at offset %d", i)
+		}
+		if alias, ok := nginxAliases[field]; ok {
+			field = alias
+		}
+		render, ok := formatFields[field]
+		if !ok {
+			return nil, fmt.Errorf("unknown field $%s (known: %s)", field, strings.Join(FieldNames(), ", "))
+		}
+
+		if literal.Len() > 0 {
+			f.parts = append(f.parts, formatPart{literal: literal.String()})
+			literal.Reset()
+		}
+		f.parts = append(f.parts, formatPart{field: render})
+		i = end - 1
+	}
+	if literal.Len() > 0 {
+		f.parts = append(f.parts, formatPart{literal: literal.String()})
+	}
+	return f, nil
+}
+
+// FieldNames returns the template fields, sorted, without nginx aliases
+func FieldNames() []string {
+	names := make([]string, 0, len(formatFields))
+	for name := range formatFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Name returns the preset name, or custom for a template
+func (f *Format) Name() string {
+	return f.name
+}
+
+// Render returns entry as one newline-terminated line
+func (f *Format) Render(entry AccessLogEntry) []byte {
+	if f.json {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return nil
+		}
+		return append(line, '\n')
+	}
+
+	var b strings.Builder
+	for _, part := range f.parts {
+		if part.field == nil {
+			b.WriteString(part.literal)
+			continue
+		}
+		value := part.field(entry)
+		if value == "" {
+			value = "-"
+		}
+		writeEscaped(&b, value)
+	}
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+// writeEscaped writes value with quotes, backslashes and control characters
+// escaped as \xHH, as nginx does, so client-supplied values such as the
+// user agent cannot forge fields or lines
+func writeEscaped(b *strings.Builder, value string) {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '"' || c == '\\' || c < 0x20 || c == 0x7f {
+			fmt.Fprintf(b, `\x%02X`, c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+}
+
+func isFieldByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// requestURI is the path with the query string
+func requestURI(e AccessLogEntry) string {
+	if e.Query == "" {
+		return e.Path
+	}
+	return e.Path + "?" + e.Query
+}
+
+// entryTime converts the entry's millisecond timestamp
+func entryTime(e AccessLogEntry) time.Time {
+	return time.UnixMilli(e.Timestamp)
+}
+
+// formatMs formats a millisecond timing, empty when not recorded
+func formatMs(ms float64) string {
+	if ms == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(ms, 'f', 3, 64)
+}
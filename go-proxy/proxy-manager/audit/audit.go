@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/rs/zerolog/log"
+
+	"github.com/chilla55/proxy-manager/database"
+	"github.com/chilla55/proxy-manager/middleware"
 )
 
 // Action types for audit logging
@@ -24,8 +28,20 @@ const (
 	ActionWAFRuleChange   = "waf_rule_change"
 	ActionStartup         = "startup"
 	ActionShutdown        = "shutdown"
+	ActionSiteReload      = "site_reload"
+	ActionCircuitForce    = "circuit_breaker_force"
+	ActionWebhookTest     = "webhook_test"
+	ActionSamplesClear    = "samples_clear"
+	ActionProxyPause      = "proxy_pause"
+	ActionProxyResume     = "proxy_resume"
+	ActionMaintenanceBulk = "maintenance_bulk"
+	ActionMetricsReset    = "metrics_reset"
 )
 
+// ResultOK is the result of an action that succeeded; anything else
+// describes the failure
+const ResultOK = "ok"
+
 // Logger handles audit logging
 type Logger struct {
 	db      Database
@@ -34,23 +50,12 @@ type Logger struct {
 
 // Database interface for audit logging
 type Database interface {
-	LogAudit(user, action, resourceType, resourceID, oldValue, newValue, ipAddress, metadata string) error
-	GetAuditLogs(limit int, action, resourceType string, since time.Time) ([]AuditEntry, error)
+	LogAudit(entry database.AuditEntry) error
+	GetAuditLogs(filter database.AuditFilter) ([]database.AuditEntry, error)
 }
 
 // AuditEntry represents an audit log entry
-type AuditEntry struct {
-	ID           int64
-	Timestamp    int64
-	User         string
-	Action       string
-	ResourceType string
-	ResourceID   string
-	OldValue     string
-	NewValue     string
-	IPAddress    string
-	Metadata     string
-}
+type AuditEntry = database.AuditEntry
 
 // NewLogger creates a new audit logger
 func NewLogger(db Database, enabled bool) *Logger {
@@ -60,33 +65,106 @@ func NewLogger(db Database, enabled bool) *Logger {
 	}
 }
 
-// Log logs an audit event
+// Log logs an audit event done by the proxy itself
 func (l *Logger) Log(action, resourceType, resourceID, oldValue, newValue, ipAddress, metadata string) error {
-	if !l.enabled {
+	return l.Record(AuditEntry{
+		User:         "system",
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		OldValue:     oldValue,
+		NewValue:     newValue,
+		IPAddress:    ipAddress,
+		Metadata:     metadata,
+	})
+}
+
+// Record logs an audit entry. An empty Result means the action succeeded.
+// A nil Logger records nothing, so components work without one.
+func (l *Logger) Record(entry AuditEntry) error {
+	if l == nil || !l.enabled {
 		return nil
 	}
+	if entry.Timestamp == 0 {
+		entry.Timestamp = time.Now().Unix()
+	}
+	if entry.Result == "" {
+		entry.Result = ResultOK
+	}
 
-	user := "system" // Default user, could be extended to support actual users
-
-	if err := l.db.LogAudit(user, action, resourceType, resourceID, oldValue, newValue, ipAddress, metadata); err != nil {
+	if err := l.db.LogAudit(entry); err != nil {
 		log.Error().
 			Err(err).
-			Str("action", action).
-			Str("resource_type", resourceType).
-			Str("resource_id", resourceID).
+			Str("action", entry.Action).
+			Str("resource_type", entry.ResourceType).
+			Str("resource_id", entry.ResourceID).
 			Msg("Failed to log audit entry")
 		return err
 	}
 
 	log.Info().
-		Str("action", action).
-		Str("resource_type", resourceType).
-		Str("resource_id", resourceID).
+		Str("user", entry.User).
+		Str("action", entry.Action).
+		Str("resource_type", entry.ResourceType).
+		Str("resource_id", entry.ResourceID).
+		Str("result", entry.Result).
 		Msg("Audit log recorded")
 
 	return nil
 }
 
+// Params encodes action parameters for AuditEntry.Metadata
+func Params(params map[string]string) string {
+	if len(params) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(params)
+	return string(data)
+}
+
+// Handler wraps an admin endpoint so every call is recorded with the
+// authenticated principal, its query parameters and the outcome: a status
+// of 400 or above is a failure. resource names what the call acts on.
+func (l *Logger) Handler(action, resourceType string, resource func(r *http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		params := make(map[string]string)
+		for key, values := range r.URL.Query() {
+			params[key] = values[0]
+		}
+		result := ResultOK
+		if rec.status >= http.StatusBadRequest {
+			result = fmt.Sprintf("error: %d %s", rec.status, http.StatusText(rec.status))
+		}
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		l.Record(AuditEntry{
+			User:         middleware.Principal(r),
+			Action:       action,
+			ResourceType: resourceType,
+			ResourceID:   resource(r),
+			IPAddress:    ip,
+			Metadata:     Params(params),
+			Result:       result,
+		})
+	}
+}
+
+// statusRecorder remembers the status code a handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
 // LogConfigReload logs a configuration reload event
 func (l *Logger) LogConfigReload(configPath, reason string) error {
 	metadata := map[string]string{
@@ -198,9 +276,13 @@ func (l *Logger) APIHandler() http.HandlerFunc {
 		// Parse query parameters
 		query := r.URL.Query()
 		limitStr := query.Get("limit")
-		action := query.Get("action")
-		resourceType := query.Get("resource_type")
-		sinceStr := query.Get("since")
+		filter := database.AuditFilter{
+			User:         query.Get("user"),
+			Action:       query.Get("action"),
+			ResourceType: query.Get("resource_type"),
+			ResourceID:   query.Get("resource_id"),
+			Result:       query.Get("result"),
+		}
 
 		// Default limit
 		limit := 100
@@ -213,16 +295,29 @@ func (l *Logger) APIHandler() http.HandlerFunc {
 			}
 		}
 
-		// Parse since timestamp
-		var since time.Time
-		if sinceStr != "" {
-			if ts, err := strconv.ParseInt(sinceStr, 10, 64); err == nil {
-				since = time.Unix(ts, 0)
+		filter.Limit = limit
+
+		// Parse since and until, Unix seconds or RFC 3339
+		for _, bound := range []struct {
+			name string
+			dst  *time.Time
+		}{{"since", &filter.Since}, {"until", &filter.Until}} {
+			v := query.Get(bound.name)
+			if v == "" {
+				continue
+			}
+			if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+				*bound.dst = time.Unix(ts, 0)
+			} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+				*bound.dst = t
+			} else {
+				http.Error(w, fmt.Sprintf("invalid %s: expected Unix seconds or an RFC 3339 time", bound.name), http.StatusBadRequest)
+				return
 			}
 		}
 
 		// Get audit logs
-		entries, err := l.db.GetAuditLogs(limit, action, resourceType, since)
+		entries, err := l.db.GetAuditLogs(filter)
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to get audit logs")
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
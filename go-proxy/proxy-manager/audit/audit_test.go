@@ -5,19 +5,25 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"time"
+
+	"github.com/chilla55/proxy-manager/database"
+	"github.com/chilla55/proxy-manager/middleware"
 )
 
 type mockDB struct {
 	entries []AuditEntry
 	logged  int
+	last    AuditEntry
+	filter  database.AuditFilter
 }
 
-func (m *mockDB) LogAudit(user, action, resourceType, resourceID, oldValue, newValue, ipAddress, metadata string) error {
+func (m *mockDB) LogAudit(entry database.AuditEntry) error {
 	m.logged++
+	m.last = entry
 	return nil
 }
-func (m *mockDB) GetAuditLogs(limit int, action, resourceType string, since time.Time) ([]AuditEntry, error) {
+func (m *mockDB) GetAuditLogs(filter database.AuditFilter) ([]AuditEntry, error) {
+	m.filter = filter
 	return m.entries, nil
 }
 
@@ -73,3 +79,63 @@ func TestAuditLoggerBasic(t *testing.T) {
 		t.Fatalf("expected count=1")
 	}
 }
+
+func TestHandlerRecordsPrincipalParamsAndResult(t *testing.T) {
+	db := &mockDB{}
+	l := NewLogger(db, true)
+	status := http.StatusOK
+	h := l.Handler(ActionCircuitForce, "route", func(r *http.Request) string { return r.URL.Query().Get("route") },
+		func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(status) })
+	auth := middleware.NewAuthenticator(middleware.AuthConfig{Username: "ops", Password: "pw"}).Wrap(h)
+
+	do := func() {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/circuit-breaker?route=ex.com/api&mode=open", nil)
+		req.RemoteAddr = "10.0.0.5:4711"
+		req.SetBasicAuth("ops", "pw")
+		auth.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	do()
+	e := db.last
+	if e.User != "ops" || e.Action != ActionCircuitForce || e.ResourceID != "ex.com/api" || e.IPAddress != "10.0.0.5" ||
+		e.Result != ResultOK || e.Metadata != `{"mode":"open","route":"ex.com/api"}` || e.Timestamp == 0 {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	status = http.StatusNotFound
+	do()
+	if db.last.Result != "error: 404 Not Found" {
+		t.Fatalf("expected failure result, got %q", db.last.Result)
+	}
+
+	// Rejected requests never reach the handler and are not recorded
+	auth.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/admin/circuit-breaker", nil))
+	if db.logged != 2 {
+		t.Fatalf("expected 2 entries, got %d", db.logged)
+	}
+
+	var none *Logger
+	if err := none.Record(AuditEntry{Action: "noop"}); err != nil {
+		t.Fatalf("nil logger: %v", err)
+	}
+}
+
+func TestAPIHandlerFilters(t *testing.T) {
+	db := &mockDB{}
+	h := NewLogger(db, true).APIHandler()
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/audit?user=ops&result=error&resource_id=ex.com/api&since=2024-01-01T00:00:00Z&until=1704153600", nil))
+	if rr.Code != 200 {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	f := db.filter
+	if f.User != "ops" || f.Result != "error" || f.ResourceID != "ex.com/api" || f.Limit != 100 ||
+		f.Since.Unix() != 1704067200 || f.Until.Unix() != 1704153600 {
+		t.Fatalf("unexpected filter %+v", f)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/audit?since=yesterday", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad since, got %d", rr.Code)
+	}
+}
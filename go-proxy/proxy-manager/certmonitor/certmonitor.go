@@ -1,9 +1,11 @@
 package certmonitor
 
 import (
+	"bytes"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -23,7 +25,7 @@ type CertInfo struct {
 	Issuer        string    `json:"issuer"`
 	Subject       string    `json:"subject"`
 	NotBefore     time.Time `json:"not_before"`
-	NotAfter      time.Time `json:"not_after"`
+	NotAfter      time.Time `json:"not_after"` // Earliest expiry of the leaf and its intermediates
 	DaysRemaining int       `json:"days_remaining"`
 	WarningLevel  string    `json:"warning_level"` // ok, warning, urgent, critical
 	SerialNumber  string    `json:"serial_number"`
@@ -31,8 +33,32 @@ type CertInfo struct {
 	PublicKeyAlgo string    `json:"public_key_algorithm"`
 	DNSNames      []string  `json:"dns_names"`
 	LastChecked   time.Time `json:"last_checked"`
+
+	Source      string `json:"source"`                 // local (served by the proxy) or remote
+	VerifyError string `json:"verify_error,omitempty"` // remote: why the presented chain does not verify
+	LastError   string `json:"last_error,omitempty"`   // remote: why the last check failed; the fields above are from the last success
+
+	LeafNotAfter     time.Time   `json:"leaf_not_after"`
+	LimitedBy        string      `json:"limited_by"`         // The chain element expiring first: leaf or intermediate
+	LimitedBySubject string      `json:"limited_by_subject"` // Its subject
+	Chain            []ChainCert `json:"chain"`
 }
 
+// ChainCert is one certificate of a served chain
+type ChainCert struct {
+	Role     string    `json:"role"` // leaf, intermediate or root
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+// Chain roles
+const (
+	RoleLeaf         = "leaf"
+	RoleIntermediate = "intermediate"
+	RoleRoot         = "root" // Self-signed; clients use their own copy, so its expiry is not tracked
+)
+
 // WarningLevel constants
 const (
 	LevelOK       = "ok"
@@ -51,11 +77,17 @@ func NewMonitor() *Monitor {
 
 // AddCertificate adds or updates a certificate for monitoring
 func (m *Monitor) AddCertificate(domain string, cert *x509.Certificate) {
-	if !m.enabled || cert == nil {
+	m.AddCertificateChain(domain, []*x509.Certificate{cert})
+}
+
+// AddCertificateChain adds or updates a served chain, leaf first. The chain
+// expires with whichever of the leaf and its intermediates expires first.
+func (m *Monitor) AddCertificateChain(domain string, chain []*x509.Certificate) {
+	if !m.enabled || len(chain) == 0 || chain[0] == nil {
 		return
 	}
 
-	info := m.parseCertificate(domain, cert)
+	info := m.parseCertificate(domain, chain)
 
 	m.certsMutex.Lock()
 	m.certs[domain] = info
@@ -68,6 +100,7 @@ func (m *Monitor) AddCertificate(domain string, cert *x509.Certificate) {
 			Str("warning_level", info.WarningLevel).
 			Int("days_remaining", info.DaysRemaining).
 			Time("expires", info.NotAfter).
+			Str("limited_by", info.LimitedBy).
 			Msg("Certificate expiring soon")
 	}
 }
@@ -78,48 +111,78 @@ func (m *Monitor) AddCertificateFromTLS(domain string, tlsCert *tls.Certificate)
 		return fmt.Errorf("invalid TLS certificate")
 	}
 
-	// Parse the first certificate in the chain (leaf certificate)
-	cert, err := x509.ParseCertificate(tlsCert.Certificate[0])
-	if err != nil {
-		return fmt.Errorf("failed to parse certificate: %w", err)
+	// Parse the whole chain: the leaf first, then the intermediates
+	chain := make([]*x509.Certificate, 0, len(tlsCert.Certificate))
+	for i, der := range tlsCert.Certificate {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("failed to parse certificate %d of the chain: %w", i, err)
+		}
+		chain = append(chain, cert)
 	}
 
-	m.AddCertificate(domain, cert)
+	m.AddCertificateChain(domain, chain)
 	return nil
 }
 
-// parseCertificate extracts information from an x509 certificate
-func (m *Monitor) parseCertificate(domain string, cert *x509.Certificate) *CertInfo {
+// parseCertificate extracts information from a chain, leaf first
+func (m *Monitor) parseCertificate(domain string, chain []*x509.Certificate) *CertInfo {
 	now := time.Now()
-	daysRemaining := int(time.Until(cert.NotAfter).Hours() / 24)
+	cert := chain[0]
+
+	notAfter, limitedBy, limitedBySubject := cert.NotAfter, RoleLeaf, cert.Subject.String()
+	links := make([]ChainCert, 0, len(chain))
+	for i, c := range chain {
+		role := RoleIntermediate
+		switch {
+		case i == 0:
+			role = RoleLeaf
+		case bytes.Equal(c.RawSubject, c.RawIssuer):
+			role = RoleRoot
+		}
+		links = append(links, ChainCert{Role: role, Subject: c.Subject.String(), Issuer: c.Issuer.String(), NotAfter: c.NotAfter})
+		if role == RoleIntermediate && c.NotAfter.Before(notAfter) {
+			notAfter, limitedBy, limitedBySubject = c.NotAfter, role, c.Subject.String()
+		}
+	}
+	daysRemaining := int(notAfter.Sub(now).Hours() / 24)
 
 	info := &CertInfo{
 		Domain:        domain,
 		Issuer:        cert.Issuer.String(),
 		Subject:       cert.Subject.String(),
 		NotBefore:     cert.NotBefore,
-		NotAfter:      cert.NotAfter,
+		NotAfter:      notAfter,
 		DaysRemaining: daysRemaining,
 		SerialNumber:  cert.SerialNumber.String(),
 		SignatureAlgo: cert.SignatureAlgorithm.String(),
 		PublicKeyAlgo: cert.PublicKeyAlgorithm.String(),
 		DNSNames:      cert.DNSNames,
+		WarningLevel:  warningLevel(daysRemaining),
 		LastChecked:   now,
+
+		LeafNotAfter:     cert.NotAfter,
+		LimitedBy:        limitedBy,
+		LimitedBySubject: limitedBySubject,
+		Chain:            links,
+		Source:           SourceLocal,
 	}
 
-	// Calculate warning level
+	return info
+}
+
+// warningLevel returns the level for a certificate expiring in daysRemaining
+func warningLevel(daysRemaining int) string {
 	switch {
 	case daysRemaining <= 7:
-		info.WarningLevel = LevelCritical
+		return LevelCritical
 	case daysRemaining <= 14:
-		info.WarningLevel = LevelUrgent
+		return LevelUrgent
 	case daysRemaining <= 30:
-		info.WarningLevel = LevelWarning
+		return LevelWarning
 	default:
-		info.WarningLevel = LevelOK
+		return LevelOK
 	}
-
-	return info
 }
 
 // GetCertificate returns certificate info for a domain
@@ -236,6 +299,69 @@ type CertStats struct {
 	ExpiredCount      int `json:"expired_count"`
 }
 
+// ReportEntry is one certificate in the expiry report, with every monitored
+// domain it is served for
+type ReportEntry struct {
+	Domains          []string  `json:"domains"`   // Monitored domains serving this certificate
+	DNSNames         []string  `json:"dns_names"` // Names the certificate covers
+	Subject          string    `json:"subject"`
+	Issuer           string    `json:"issuer"`
+	SerialNumber     string    `json:"serial_number"`
+	NotBefore        time.Time `json:"not_before"`
+	NotAfter         time.Time `json:"not_after"`
+	DaysRemaining    int       `json:"days_remaining"`
+	WarningLevel     string    `json:"warning_level"`
+	Expired          bool      `json:"expired"`
+	LimitedBy        string    `json:"limited_by"` // leaf or intermediate
+	LimitedBySubject string    `json:"limited_by_subject"`
+}
+
+// Report returns every monitored certificate once, sorted soonest expiry
+// first. Days remaining and levels are computed at now rather than taken
+// from the last check.
+func (m *Monitor) Report(now time.Time) []ReportEntry {
+	m.certsMutex.RLock()
+	defer m.certsMutex.RUnlock()
+
+	// The same certificate is often monitored under several domains
+	byCert := make(map[string]*ReportEntry)
+	for domain, info := range m.certs {
+		key := info.Issuer + "|" + info.SerialNumber
+		entry, ok := byCert[key]
+		if !ok {
+			days := int(info.NotAfter.Sub(now).Hours() / 24)
+			entry = &ReportEntry{
+				DNSNames:         info.DNSNames,
+				Subject:          info.Subject,
+				Issuer:           info.Issuer,
+				SerialNumber:     info.SerialNumber,
+				NotBefore:        info.NotBefore,
+				NotAfter:         info.NotAfter,
+				DaysRemaining:    days,
+				WarningLevel:     warningLevel(days),
+				Expired:          info.NotAfter.Before(now),
+				LimitedBy:        info.LimitedBy,
+				LimitedBySubject: info.LimitedBySubject,
+			}
+			byCert[key] = entry
+		}
+		entry.Domains = append(entry.Domains, domain)
+	}
+
+	report := make([]ReportEntry, 0, len(byCert))
+	for _, entry := range byCert {
+		sort.Strings(entry.Domains)
+		report = append(report, *entry)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if !report[i].NotAfter.Equal(report[j].NotAfter) {
+			return report[i].NotAfter.Before(report[j].NotAfter)
+		}
+		return report[i].Domains[0] < report[j].Domains[0]
+	})
+	return report
+}
+
 // RemoveCertificate removes a certificate from monitoring
 func (m *Monitor) RemoveCertificate(domain string) {
 	m.certsMutex.Lock()
@@ -276,16 +402,7 @@ func (m *Monitor) CheckAll() {
 		info.LastChecked = now
 
 		// Recalculate warning level
-		switch {
-		case daysRemaining <= 7:
-			info.WarningLevel = LevelCritical
-		case daysRemaining <= 14:
-			info.WarningLevel = LevelUrgent
-		case daysRemaining <= 30:
-			info.WarningLevel = LevelWarning
-		default:
-			info.WarningLevel = LevelOK
-		}
+		info.WarningLevel = warningLevel(daysRemaining)
 
 		// Log if status changed to warning/critical
 		if info.WarningLevel != LevelOK {
@@ -1,9 +1,17 @@
 package certmonitor
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -144,3 +152,133 @@ func TestCheckAll(t *testing.T) {
 		t.Errorf("Expected 2 total certificates, got %d", stats.TotalCertificates)
 	}
 }
+
+func TestReport(t *testing.T) {
+	m := NewMonitor()
+	now := time.Now()
+	cert := func(serial int64, days int, names ...string) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			NotBefore:    now.Add(-90 * 24 * time.Hour),
+			NotAfter:     now.Add(time.Duration(days)*24*time.Hour + time.Hour),
+			Issuer:       pkix.Name{CommonName: "Test CA"},
+			Subject:      pkix.Name{CommonName: names[0]},
+			DNSNames:     names,
+		}
+	}
+	shared := cert(1, 40, "example.com", "www.example.com")
+	m.AddCertificate("www.example.com", shared)
+	m.AddCertificate("example.com", shared)
+	m.AddCertificate("api.example.org", cert(2, 5, "api.example.org"))
+	m.AddCertificate("old.example.net", cert(3, -3, "old.example.net"))
+
+	// Thirty days on, the shared certificate is in its warning window
+	report := m.Report(now.Add(30 * 24 * time.Hour))
+	if len(report) != 3 {
+		t.Fatalf("expected 3 certificates, got %d", len(report))
+	}
+	if report[0].Domains[0] != "old.example.net" || !report[0].Expired ||
+		report[1].Domains[0] != "api.example.org" || report[1].WarningLevel != LevelCritical {
+		t.Fatalf("unexpected order %+v", report)
+	}
+	last := report[2]
+	if len(last.Domains) != 2 || last.Domains[0] != "example.com" || last.Domains[1] != "www.example.com" {
+		t.Fatalf("expected the shared certificate once with both domains, got %v", last.Domains)
+	}
+	if last.DaysRemaining != 10 || last.WarningLevel != LevelUrgent || last.Expired {
+		t.Fatalf("unexpected entry %+v", last)
+	}
+}
+
+func TestAddCertificateFromTLS_IntermediateExpiresFirst(t *testing.T) {
+	now := time.Now()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	create := func(tmpl, parent *x509.Certificate) []byte {
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, key)
+		if err != nil {
+			t.Fatalf("create %s: %v", tmpl.Subject.CommonName, err)
+		}
+		return der
+	}
+	root := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Root"},
+		NotBefore: now.Add(-time.Hour), NotAfter: now.Add(3 * 365 * 24 * time.Hour), IsCA: true, BasicConstraintsValid: true}
+	inter := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "Intermediate R1"},
+		NotBefore: now.Add(-time.Hour), NotAfter: now.Add(10*24*time.Hour + time.Hour), IsCA: true, BasicConstraintsValid: true}
+	leaf := &x509.Certificate{SerialNumber: big.NewInt(3), Subject: pkix.Name{CommonName: "example.com"},
+		NotBefore: now.Add(-time.Hour), NotAfter: now.Add(60 * 24 * time.Hour), DNSNames: []string{"example.com"}}
+
+	m := NewMonitor()
+	chain := &tls.Certificate{Certificate: [][]byte{create(leaf, inter), create(inter, root), create(root, root)}}
+	if err := m.AddCertificateFromTLS("example.com", chain); err != nil {
+		t.Fatalf("AddCertificateFromTLS: %v", err)
+	}
+
+	info, _ := m.GetCertificate("example.com")
+	if info.LimitedBy != RoleIntermediate || info.LimitedBySubject != "CN=Intermediate R1" {
+		t.Fatalf("expected the intermediate to limit the chain, got %q %q", info.LimitedBy, info.LimitedBySubject)
+	}
+	if info.DaysRemaining != 10 || info.WarningLevel != LevelUrgent || !info.LeafNotAfter.Equal(leaf.NotAfter.Truncate(time.Second)) {
+		t.Fatalf("unexpected expiry %+v", info)
+	}
+	if len(info.Chain) != 3 || info.Chain[0].Role != RoleLeaf || info.Chain[1].Role != RoleIntermediate || info.Chain[2].Role != RoleRoot {
+		t.Fatalf("unexpected chain %+v", info.Chain)
+	}
+
+	// A leaf-only chain is limited by the leaf
+	m.AddCertificateFromTLS("leaf.example.com", &tls.Certificate{Certificate: [][]byte{create(leaf, inter)}})
+	if info, _ := m.GetCertificate("leaf.example.com"); info.LimitedBy != RoleLeaf || info.WarningLevel != LevelOK {
+		t.Fatalf("unexpected leaf-only info %+v", info)
+	}
+}
+
+func TestCheckRemote(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	addr := server.Listener.Addr().String()
+
+	// A closed port stands in for an unreachable target
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	unreachable := ln.Addr().String()
+	ln.Close()
+
+	m := NewMonitor()
+	m.AddCertificate("example.com", &x509.Certificate{NotAfter: time.Now().Add(90 * 24 * time.Hour)})
+	failures := m.CheckRemote(context.Background(), []RemoteTarget{{Address: addr, ServerName: "example.com"}, {Address: unreachable}}, 2*time.Second)
+	if len(failures) != 1 || failures[unreachable] == nil {
+		t.Fatalf("expected only %s to fail, got %v", unreachable, failures)
+	}
+
+	info, ok := m.GetCertificate(addr)
+	if !ok || info.Source != SourceRemote || !info.NotAfter.Equal(server.Certificate().NotAfter) {
+		t.Fatalf("expected the presented certificate to be monitored, got %+v", info)
+	}
+	// The test server's certificate is self-issued by an unknown CA
+	if info.VerifyError == "" {
+		t.Fatal("expected a verification error for an untrusted certificate")
+	}
+	if _, ok := m.GetCertificate(unreachable); ok {
+		t.Fatal("an unreachable target without a previous check should not be monitored")
+	}
+	if local, _ := m.GetCertificate("example.com"); local.Source != SourceLocal {
+		t.Fatalf("expected local source, got %q", local.Source)
+	}
+
+	// A failing check keeps the last known certificate; unlisted targets are dropped
+	server.Close()
+	if failures := m.CheckRemote(context.Background(), []RemoteTarget{{Address: addr}}, time.Second); failures[addr] == nil {
+		t.Fatal("expected the closed server to fail")
+	}
+	if info, _ := m.GetCertificate(addr); info.LastError == "" || info.NotAfter.IsZero() {
+		t.Fatalf("expected last known certificate with an error, got %+v", info)
+	}
+	m.CheckRemote(context.Background(), nil, time.Second)
+	if _, ok := m.GetCertificate(addr); ok {
+		t.Fatal("expected an unlisted remote target to be dropped")
+	}
+	if _, ok := m.GetCertificate("example.com"); !ok {
+		t.Fatal("local certificates must not be dropped")
+	}
+}
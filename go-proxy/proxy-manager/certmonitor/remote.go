@@ -0,0 +1,128 @@
+package certmonitor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Certificate sources
+const (
+	SourceLocal  = "local"  // Served by the proxy
+	SourceRemote = "remote" // Presented by a remote target
+)
+
+// RemoteTarget is an endpoint whose certificate is monitored
+type RemoteTarget struct {
+	Address    string // host:port, also the key the certificate is monitored under
+	ServerName string // SNI and name verified, default the host
+}
+
+// CheckRemote connects to every target, reads the chain it presents and
+// monitors it like a local certificate. Remote certificates of targets no
+// longer listed are dropped. A target that cannot be reached keeps its last
+// known certificate with LastError set and is returned among the failures.
+func (m *Monitor) CheckRemote(ctx context.Context, targets []RemoteTarget, timeout time.Duration) map[string]error {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		failures = make(map[string]error)
+		listed   = make(map[string]bool, len(targets))
+	)
+	for _, target := range targets {
+		listed[target.Address] = true
+		wg.Add(1)
+		go func(target RemoteTarget) {
+			defer wg.Done()
+			if err := m.checkRemote(ctx, target, timeout); err != nil {
+				mu.Lock()
+				failures[target.Address] = err
+				mu.Unlock()
+			}
+		}(target)
+	}
+	wg.Wait()
+
+	m.certsMutex.Lock()
+	for key, info := range m.certs {
+		if info.Source == SourceRemote && !listed[key] {
+			delete(m.certs, key)
+		}
+	}
+	m.certsMutex.Unlock()
+
+	return failures
+}
+
+// checkRemote fetches and records the chain of one target
+func (m *Monitor) checkRemote(ctx context.Context, target RemoteTarget, timeout time.Duration) error {
+	chain, verifyErr, err := fetchChain(ctx, target, timeout)
+	if err != nil {
+		log.Warn().Err(err).Str("target", target.Address).Msg("Remote certificate check failed")
+		m.certsMutex.Lock()
+		if info, ok := m.certs[target.Address]; ok {
+			info.LastError = err.Error()
+			info.LastChecked = time.Now()
+		}
+		m.certsMutex.Unlock()
+		return err
+	}
+
+	info := m.parseCertificate(target.Address, chain)
+	info.Source = SourceRemote
+	if verifyErr != nil {
+		info.VerifyError = verifyErr.Error()
+	}
+
+	m.certsMutex.Lock()
+	m.certs[target.Address] = info
+	m.certsMutex.Unlock()
+
+	if info.WarningLevel != LevelOK || verifyErr != nil {
+		log.Warn().
+			Str("target", target.Address).
+			Str("warning_level", info.WarningLevel).
+			Int("days_remaining", info.DaysRemaining).
+			Str("verify_error", info.VerifyError).
+			Msg("Remote certificate needs attention")
+	}
+	return nil
+}
+
+// fetchChain completes a TLS handshake with target and returns the presented
+// chain. The chain is verified separately so an invalid certificate is still
+// monitored; verifyErr says why it does not verify.
+func fetchChain(ctx context.Context, target RemoteTarget, timeout time.Duration) (chain []*x509.Certificate, verifyErr, err error) {
+	serverName := target.ServerName
+	if serverName == "" {
+		if serverName, _, err = net.SplitHostPort(target.Address); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	dialer := &tls.Dialer{Config: &tls.Config{ServerName: serverName, InsecureSkipVerify: true}}
+	conn, err := dialer.DialContext(ctx, "tcp", target.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	chain = conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		return nil, nil, errors.New("no certificate presented")
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	_, verifyErr = chain[0].Verify(x509.VerifyOptions{DNSName: serverName, Intermediates: intermediates})
+	return chain, verifyErr, nil
+}
@@ -2,27 +2,660 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/chilla55/proxy-manager/scheduler"
 	"gopkg.in/yaml.v3"
 )
 
 // GlobalConfig holds proxy-wide configuration
 type GlobalConfig struct {
 	Defaults struct {
-		Headers map[string]string `yaml:"headers"`
-		Options OptionConfig      `yaml:"options"`
+		Headers         map[string]string     `yaml:"headers"`
+		ResponseHeaders ResponseHeadersConfig `yaml:"response_headers,omitempty"`
+		Options         OptionConfig          `yaml:"options"`
 	} `yaml:"defaults"`
 
+	Server struct {
+		HTTP2 *bool `yaml:"http2,omitempty"` // Offer HTTP/2 over TLS, default true
+		HTTP3 *bool `yaml:"http3,omitempty"` // Start the HTTP/3 (UDP) listener, default true
+		// HTTP3Addr is the UDP listen address, default the HTTPS address
+		HTTP3Addr    string `yaml:"http3_addr,omitempty"`
+		AltSvc       *bool  `yaml:"alt_svc,omitempty"`         // Advertise HTTP/3 via Alt-Svc, default true
+		AltSvcMaxAge string `yaml:"alt_svc_max_age,omitempty"` // e.g. 24h (default)
+		// HTTPRedirectExempt lists path prefixes served over plain HTTP
+		// instead of redirected to HTTPS. Unset means the ACME challenge
+		// path; an empty list redirects everything.
+		HTTPRedirectExempt []string `yaml:"http_redirect_exempt,omitempty"`
+		// HTTP3MaxConnections caps concurrent QUIC connections; further
+		// attempts are refused before the handshake. 0 is unlimited.
+		HTTP3MaxConnections int `yaml:"http3_max_connections,omitempty"`
+		// MaxConnections caps concurrent TCP connections across the HTTP
+		// and HTTPS listeners; further ones are closed on accept. 0 is
+		// unlimited. The registry and health ports are not counted.
+		MaxConnections int `yaml:"max_connections,omitempty"`
+		// HTTPSListeners replaces HTTPS_ADDR with several addresses serving
+		// the same routes and certificates, e.g. [":443", ":8443"]
+		HTTPSListeners []string `yaml:"https_listeners,omitempty"`
+		// ProxyProtocol reads the PROXY protocol header an L4 load balancer
+		// prepends, from the balancers in Trusted only
+		ProxyProtocol struct {
+			Enabled bool     `yaml:"enabled"`
+			Trusted []string `yaml:"trusted,omitempty"` // CIDRs or addresses of the balancers
+		} `yaml:"proxy_protocol,omitempty"`
+		// Client connection timeouts of the HTTP and HTTPS listeners, as
+		// durations; "0" disables one. See GetServerTimeouts for defaults.
+		ReadHeaderTimeout string `yaml:"read_header_timeout,omitempty"`
+		ReadTimeout       string `yaml:"read_timeout,omitempty"`
+		WriteTimeout      string `yaml:"write_timeout,omitempty"`
+		IdleTimeout       string `yaml:"idle_timeout,omitempty"`
+	} `yaml:"server,omitempty"`
+
+	// TrustedProxies lists CIDRs or addresses of proxies in front of this
+	// one (e.g. Cloudflare). Only their forwarding headers are believed.
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
+
 	Blackhole struct {
 		UnknownDomains bool `yaml:"unknown_domains"`
 		MetricsOnly    bool `yaml:"metrics_only"`
 	} `yaml:"blackhole"`
 
+	// Pause configures the global pause switch of the admin API, which
+	// answers every route with 503
+	Pause struct {
+		// ExemptPaths lists path prefixes still proxied while paused, e.g.
+		// a load balancer's health check
+		ExemptPaths []string `yaml:"exempt_paths,omitempty"`
+		RetryAfter  string   `yaml:"retry_after,omitempty"` // Retry-After of the 503, default 60s
+	} `yaml:"pause,omitempty"`
+
 	TLS struct {
 		Certificates []CertConfig `yaml:"certificates"`
 	} `yaml:"tls"`
+
+	Alerts struct {
+		ErrorRateThreshold float64 `yaml:"error_rate_threshold,omitempty"` // Percent, default 5
+	} `yaml:"alerts,omitempty"`
+
+	Cleanup struct {
+		RetentionDays int `yaml:"retention_days,omitempty"` // Database cleanup cutoff, default 30
+	} `yaml:"cleanup,omitempty"`
+
+	Retention struct {
+		Vacuum            bool `yaml:"vacuum,omitempty"`              // Compact the database after cleanup
+		VacuumThresholdMB int  `yaml:"vacuum_threshold_mb,omitempty"` // Reclaimable space needed to VACUUM, default 64
+	} `yaml:"retention,omitempty"`
+
+	Compression struct {
+		Adaptive AdaptiveCompressionConfig `yaml:"adaptive,omitempty"`
+	} `yaml:"compression,omitempty"`
+
+	Metrics struct {
+		// RouteLabels are routes ("domain/path") labeled individually in
+		// /metrics; all others share route="other"
+		RouteLabels []string `yaml:"route_labels,omitempty"`
+		// LabelKeys are route label keys (e.g. team) counted per value in
+		// /metrics, up to metrics.MaxLabelValues values per key
+		LabelKeys []string `yaml:"label_keys,omitempty"`
+	} `yaml:"metrics,omitempty"`
+
+	Dashboard struct {
+		Auth DashboardAuth `yaml:"auth,omitempty"`
+		CORS CORSConfig    `yaml:"cors,omitempty"`
+	} `yaml:"dashboard,omitempty"`
+
+	// Jobs schedules maintenance tasks; unset runs the default jobs
+	Jobs []JobConfig `yaml:"jobs,omitempty"`
+
+	CertMonitor CertMonitorConfig `yaml:"cert_monitor,omitempty"`
+
+	AccessLog AccessLogConfig `yaml:"access_log,omitempty"`
+}
+
+// AccessLogConfig writes every request as a line to stdout or a file, in
+// addition to the database. Read at startup only.
+type AccessLogConfig struct {
+	Output string `yaml:"output,omitempty"` // stdout, stderr or a file path; unset writes no lines
+	Format string `yaml:"format,omitempty"` // combined (default), json, minimal or a $field template
+}
+
+// CertMonitorConfig adds certificates served elsewhere, such as HTTPS
+// backends and external dependencies, to certificate monitoring
+type CertMonitorConfig struct {
+	RemoteTargets []RemoteCertTarget `yaml:"remote_targets,omitempty"`
+	Timeout       string             `yaml:"timeout,omitempty"` // Connect and handshake per target, default 10s
+}
+
+// RemoteCertTarget is an endpoint whose presented certificate is monitored
+type RemoteCertTarget struct {
+	Address    string `yaml:"address"`               // host:port
+	ServerName string `yaml:"server_name,omitempty"` // SNI and name verified, default the host
+}
+
+// UnmarshalYAML allows a plain "host:port" string or a map for a remote target
+func (t *RemoteCertTarget) UnmarshalYAML(value *yaml.Node) error {
+	var address string
+	if err := value.Decode(&address); err == nil {
+		t.Address = address
+		return nil
+	}
+
+	type raw RemoteCertTarget
+	var r raw
+	if err := value.Decode(&r); err != nil {
+		return err
+	}
+	*t = RemoteCertTarget(r)
+	return nil
+}
+
+// GetCertMonitorTimeout returns the per-target timeout of remote certificate checks
+func (c *GlobalConfig) GetCertMonitorTimeout() (time.Duration, error) {
+	if c.CertMonitor.Timeout == "" {
+		return 10 * time.Second, nil
+	}
+	d, err := time.ParseDuration(c.CertMonitor.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
+
+// JobConfig runs a named task on a cron schedule
+type JobConfig struct {
+	Schedule string `yaml:"schedule"` // Five-field cron expression or @daily style alias
+	Task     string `yaml:"task"`     // cleanup, vacuum, cert_check or error_rate_check
+}
+
+// DefaultJobs are the jobs run when global.yaml configures none
+var DefaultJobs = []JobConfig{
+	{Schedule: "0 3 * * *", Task: "cleanup"},
+	{Schedule: "0 */6 * * *", Task: "cert_check"},
+	{Schedule: "* * * * *", Task: "error_rate_check"},
+}
+
+// GetJobs returns the configured jobs or the defaults
+func (c *GlobalConfig) GetJobs() []JobConfig {
+	if len(c.Jobs) == 0 {
+		return DefaultJobs
+	}
+	return c.Jobs
+}
+
+// ResponseHeadersConfig controls which upstream response headers reach
+// clients. Hop-by-hop headers are always removed.
+type ResponseHeadersConfig struct {
+	Strip      []string `yaml:"strip,omitempty"`       // Removed from every upstream response
+	HideServer bool     `yaml:"hide_server,omitempty"` // Also remove Server and X-Powered-By
+}
+
+// Validate checks the strip list for unusable header names
+func (c ResponseHeadersConfig) Validate() error {
+	return validateHeaderNames("defaults.response_headers.strip", c.Strip)
+}
+
+// validateHeaderNames rejects empty names and names with separators
+func validateHeaderNames(field string, names []string) error {
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("%s: invalid header name %q", field, name)
+		}
+	}
+	return nil
+}
+
+// validIPOrCIDR reports whether s is an IP address or a CIDR
+func validIPOrCIDR(s string) bool {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		_, _, err := net.ParseCIDR(s)
+		return err == nil
+	}
+	return net.ParseIP(s) != nil
+}
+
+// AdaptiveCompressionConfig lowers the compression level while the proxy
+// is under load and turns compression off above a critical CPU use. Off
+// unless enabled.
+type AdaptiveCompressionConfig struct {
+	Enabled            bool    `yaml:"enabled,omitempty"`
+	CPUPercent         float64 `yaml:"cpu_percent,omitempty"`          // Reduce above this share of the usable cores, default 80
+	CriticalCPUPercent float64 `yaml:"critical_cpu_percent,omitempty"` // Disable above this, 0 never
+	Goroutines         int     `yaml:"goroutines,omitempty"`           // Also reduce above this many goroutines, 0 ignores
+	ReducedLevel       *int    `yaml:"reduced_level,omitempty"`        // Level while reduced, default 1
+	Interval           string  `yaml:"interval,omitempty"`             // Sampling interval, default 2s
+}
+
+// GetCPUPercent returns the reduce threshold, default 80
+func (c AdaptiveCompressionConfig) GetCPUPercent() float64 {
+	if c.CPUPercent <= 0 {
+		return 80
+	}
+	return c.CPUPercent
+}
+
+// GetReducedLevel returns the level used under load, default 1
+func (c AdaptiveCompressionConfig) GetReducedLevel() int {
+	if c.ReducedLevel == nil {
+		return 1
+	}
+	return *c.ReducedLevel
+}
+
+// GetInterval returns the sampling interval, default 2s
+func (c AdaptiveCompressionConfig) GetInterval() (time.Duration, error) {
+	if c.Interval == "" {
+		return 2 * time.Second, nil
+	}
+	return time.ParseDuration(c.Interval)
+}
+
+// Validate checks thresholds, level and interval
+func (c AdaptiveCompressionConfig) Validate() error {
+	if c.CPUPercent < 0 || c.CPUPercent > 100 {
+		return fmt.Errorf("compression.adaptive.cpu_percent must be between 0 and 100")
+	}
+	if c.CriticalCPUPercent < 0 || c.CriticalCPUPercent > 100 {
+		return fmt.Errorf("compression.adaptive.critical_cpu_percent must be between 0 and 100")
+	}
+	if c.CriticalCPUPercent > 0 && c.CriticalCPUPercent < c.GetCPUPercent() {
+		return fmt.Errorf("compression.adaptive.critical_cpu_percent must not be below cpu_percent")
+	}
+	if c.Goroutines < 0 {
+		return fmt.Errorf("compression.adaptive.goroutines must not be negative")
+	}
+	if level := c.GetReducedLevel(); level < 0 || level > 11 {
+		return fmt.Errorf("compression.adaptive.reduced_level must be between 0 and 11")
+	}
+	interval, err := c.GetInterval()
+	if err != nil {
+		return fmt.Errorf("compression.adaptive.interval: %w", err)
+	}
+	if interval < 100*time.Millisecond {
+		return fmt.Errorf("compression.adaptive.interval must be at least 100ms")
+	}
+	return nil
+}
+
+// CORSConfig lists the origins allowed to call the /api/* endpoints from a
+// browser. Empty means same-origin only.
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowed_origins,omitempty"`
+	AllowedMethods   []string `yaml:"allowed_methods,omitempty"`
+	AllowedHeaders   []string `yaml:"allowed_headers,omitempty"`
+	AllowCredentials bool     `yaml:"allow_credentials,omitempty"`
+	MaxAge           string   `yaml:"max_age,omitempty"` // Preflight cache, e.g. 10m
+}
+
+// GetMaxAge returns the parsed preflight cache duration, 0 when unset
+func (c CORSConfig) GetMaxAge() (time.Duration, error) {
+	if c.MaxAge == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(c.MaxAge)
+}
+
+// Validate checks origins and max_age
+func (c CORSConfig) Validate() error {
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			if c.AllowCredentials {
+				return fmt.Errorf("dashboard.cors: allowed_origins \"*\" cannot be combined with allow_credentials")
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("dashboard.cors: invalid origin %q (want scheme://host[:port])", origin)
+		}
+	}
+	if _, err := c.GetMaxAge(); err != nil {
+		return fmt.Errorf("dashboard.cors.max_age: %w", err)
+	}
+	return nil
+}
+
+// DashboardAuth holds credentials for the dashboard and admin API. Secrets
+// can be given inline or read from a file (e.g. a Docker secret). Insecure
+// serves the dashboard without credentials, for local development only.
+type DashboardAuth struct {
+	Username     string `yaml:"username,omitempty"`
+	Password     string `yaml:"password,omitempty"`
+	PasswordFile string `yaml:"password_file,omitempty"`
+	Token        string `yaml:"token,omitempty"`
+	TokenFile    string `yaml:"token_file,omitempty"`
+	Insecure     bool   `yaml:"insecure,omitempty"`
+}
+
+// Resolve returns the username, password and token with secret files read
+func (a DashboardAuth) Resolve() (username, password, token string, err error) {
+	password, err = secretValue("dashboard.auth.password", a.Password, a.PasswordFile)
+	if err != nil {
+		return "", "", "", err
+	}
+	token, err = secretValue("dashboard.auth.token", a.Token, a.TokenFile)
+	if err != nil {
+		return "", "", "", err
+	}
+	if (a.Username == "") != (password == "") {
+		return "", "", "", fmt.Errorf("dashboard.auth: username and password must be set together")
+	}
+	return a.Username, password, token, nil
+}
+
+func secretValue(field, value, file string) (string, error) {
+	if value != "" && file != "" {
+		return "", fmt.Errorf("%s and %s_file are mutually exclusive", field, field)
+	}
+	if file == "" {
+		return value, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("%s_file: %w", field, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// GetErrorRateThreshold returns the high error rate alert threshold in percent
+func (c *GlobalConfig) GetErrorRateThreshold() float64 {
+	if c.Alerts.ErrorRateThreshold > 0 {
+		return c.Alerts.ErrorRateThreshold
+	}
+	return 5.0
+}
+
+// HTTP2Enabled reports whether h2 is offered on the HTTPS listener
+func (c *GlobalConfig) HTTP2Enabled() bool {
+	return c.Server.HTTP2 == nil || *c.Server.HTTP2
+}
+
+// HTTP3Enabled reports whether the HTTP/3 listener is started
+func (c *GlobalConfig) HTTP3Enabled() bool {
+	return c.Server.HTTP3 == nil || *c.Server.HTTP3
+}
+
+// AltSvcEnabled reports whether HTTP/3 is advertised with Alt-Svc
+func (c *GlobalConfig) AltSvcEnabled() bool {
+	return c.Server.AltSvc == nil || *c.Server.AltSvc
+}
+
+// DefaultHTTPRedirectExempt is served over HTTP when server.http_redirect_exempt is unset
+var DefaultHTTPRedirectExempt = []string{"/.well-known/acme-challenge/"}
+
+// GetHTTPRedirectExempt returns the path prefixes not redirected to HTTPS
+func (c *GlobalConfig) GetHTTPRedirectExempt() []string {
+	if c.Server.HTTPRedirectExempt == nil {
+		return DefaultHTTPRedirectExempt
+	}
+	return c.Server.HTTPRedirectExempt
+}
+
+// GetHTTPSListeners returns the HTTPS listen addresses, defaultAddr when
+// server.https_listeners is unset
+func (c *GlobalConfig) GetHTTPSListeners(defaultAddr string) []string {
+	if len(c.Server.HTTPSListeners) == 0 {
+		return []string{defaultAddr}
+	}
+	return c.Server.HTTPSListeners
+}
+
+// CheckListeners reports an HTTPS listen address that would bind the same
+// port as another HTTPS listener, the HTTP listener or the registry
+func CheckListeners(httpsAddrs []string, httpAddr string, registryPort int) error {
+	type listener struct{ name, addr string }
+	taken := []listener{
+		{"HTTP address", httpAddr},
+		{"registry port", net.JoinHostPort("", strconv.Itoa(registryPort))},
+	}
+	for _, addr := range httpsAddrs {
+		for _, other := range taken {
+			if listenersCollide(addr, other.addr) {
+				return fmt.Errorf("HTTPS address %q collides with %s %q", addr, other.name, other.addr)
+			}
+		}
+		taken = append(taken, listener{"HTTPS address", addr})
+	}
+	return nil
+}
+
+// listenersCollide reports whether two TCP listen addresses bind the same
+// port on an overlapping host; port 0 picks a free port and never collides
+func listenersCollide(a, b string) bool {
+	hostA, portA, errA := net.SplitHostPort(a)
+	hostB, portB, errB := net.SplitHostPort(b)
+	if errA != nil || errB != nil || portA != portB || portA == "0" {
+		return false
+	}
+	return hostA == "" || hostB == "" || hostA == hostB
+}
+
+// GetAltSvcMaxAge returns the Alt-Svc max age, 0 when unset
+func (c *GlobalConfig) GetAltSvcMaxAge() (time.Duration, error) {
+	if c.Server.AltSvcMaxAge == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(c.Server.AltSvcMaxAge)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
+
+// ServerTimeouts are the client connection timeouts of the listeners; zero
+// disables one
+type ServerTimeouts struct {
+	ReadHeader time.Duration
+	Read       time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+}
+
+// GetServerTimeouts returns the listener timeouts. Unset, read_header_timeout
+// is 10s and idle_timeout 120s, which drops slowloris clients; read_timeout
+// and write_timeout are off so long uploads and downloads are not cut.
+func (c *GlobalConfig) GetServerTimeouts() (ServerTimeouts, error) {
+	t := ServerTimeouts{ReadHeader: 10 * time.Second, Idle: 120 * time.Second}
+	for _, field := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"read_header_timeout", c.Server.ReadHeaderTimeout, &t.ReadHeader},
+		{"read_timeout", c.Server.ReadTimeout, &t.Read},
+		{"write_timeout", c.Server.WriteTimeout, &t.Write},
+		{"idle_timeout", c.Server.IdleTimeout, &t.Idle},
+	} {
+		if field.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field.value)
+		if err != nil {
+			return ServerTimeouts{}, fmt.Errorf("server.%s: %w", field.name, err)
+		}
+		if d < 0 {
+			return ServerTimeouts{}, fmt.Errorf("server.%s: must not be negative", field.name)
+		}
+		*field.dst = d
+	}
+	return t, nil
+}
+
+// GetPauseRetryAfter returns the Retry-After sent while paused, 0 when unset
+func (c *GlobalConfig) GetPauseRetryAfter() (time.Duration, error) {
+	if c.Pause.RetryAfter == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(c.Pause.RetryAfter)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
+
+// GetRetentionDays returns how many days of data the daily cleanup keeps
+func (c *GlobalConfig) GetRetentionDays() int {
+	if c.Cleanup.RetentionDays > 0 {
+		return c.Cleanup.RetentionDays
+	}
+	return 30
+}
+
+// GetAuditLogDays returns how many days of audit log the cleanup keeps,
+// from defaults.options.retention; 0 keeps it forever
+func (c *GlobalConfig) GetAuditLogDays() int {
+	defaults := SiteConfig{Options: c.Defaults.Options}
+	retention := defaults.GetRetention()
+	if retention.Enabled != nil && !*retention.Enabled {
+		return 0
+	}
+	return retention.AuditLogDays
+}
+
+// GetVacuumThreshold returns the reclaimable space in bytes that triggers a
+// VACUUM after cleanup
+func (c *GlobalConfig) GetVacuumThreshold() int64 {
+	mb := c.Retention.VacuumThresholdMB
+	if mb <= 0 {
+		mb = 64
+	}
+	return int64(mb) << 20
+}
+
+// Validate validates the global configuration
+func (c *GlobalConfig) Validate() error {
+	for i, cert := range c.TLS.Certificates {
+		if len(cert.Domains) == 0 {
+			return fmt.Errorf("tls.certificates[%d]: domains is required", i)
+		}
+		if cert.CertFile == "" {
+			return fmt.Errorf("tls.certificates[%d]: cert_file is required", i)
+		}
+		if cert.KeyFile == "" {
+			return fmt.Errorf("tls.certificates[%d]: key_file is required", i)
+		}
+	}
+
+	if c.Alerts.ErrorRateThreshold < 0 || c.Alerts.ErrorRateThreshold > 100 {
+		return fmt.Errorf("alerts.error_rate_threshold must be between 0 and 100")
+	}
+	if c.Cleanup.RetentionDays < 0 {
+		return fmt.Errorf("cleanup.retention_days must not be negative")
+	}
+	if c.Retention.VacuumThresholdMB < 0 {
+		return fmt.Errorf("retention.vacuum_threshold_mb must not be negative")
+	}
+	for _, key := range c.Metrics.LabelKeys {
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("metrics.label_keys: invalid key %q", key)
+		}
+	}
+	if _, _, _, err := c.Dashboard.Auth.Resolve(); err != nil {
+		return err
+	}
+	if err := c.Dashboard.CORS.Validate(); err != nil {
+		return err
+	}
+	if err := c.Defaults.ResponseHeaders.Validate(); err != nil {
+		return err
+	}
+	if _, err := c.GetAltSvcMaxAge(); err != nil {
+		return fmt.Errorf("server.alt_svc_max_age: %w", err)
+	}
+	if _, err := c.GetServerTimeouts(); err != nil {
+		return err
+	}
+	if c.Server.HTTP3Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Server.HTTP3Addr); err != nil {
+			return fmt.Errorf("server.http3_addr: %w", err)
+		}
+	}
+	for _, addr := range c.Server.HTTPSListeners {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("server.https_listeners: %w", err)
+		}
+	}
+	if err := CheckListeners(c.Server.HTTPSListeners, "", 0); err != nil {
+		return fmt.Errorf("server.https_listeners: %w", err)
+	}
+	if c.Server.HTTP3MaxConnections < 0 {
+		return fmt.Errorf("server.http3_max_connections must not be negative")
+	}
+	if c.Server.MaxConnections < 0 {
+		return fmt.Errorf("server.max_connections must not be negative")
+	}
+	if c.Server.ProxyProtocol.Enabled && len(c.Server.ProxyProtocol.Trusted) == 0 {
+		return fmt.Errorf("server.proxy_protocol: trusted must list the load balancers")
+	}
+	for _, entry := range c.Server.ProxyProtocol.Trusted {
+		if !validIPOrCIDR(entry) {
+			return fmt.Errorf("server.proxy_protocol.trusted: invalid address or CIDR %q", entry)
+		}
+	}
+	for _, prefix := range c.Server.HTTPRedirectExempt {
+		if !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("server.http_redirect_exempt: path %q must start with /", prefix)
+		}
+	}
+	for _, prefix := range c.Pause.ExemptPaths {
+		if !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("pause.exempt_paths: path %q must start with /", prefix)
+		}
+	}
+	if _, err := c.GetPauseRetryAfter(); err != nil {
+		return fmt.Errorf("pause.retry_after: %w", err)
+	}
+	for _, entry := range c.TrustedProxies {
+		if !validIPOrCIDR(entry) {
+			return fmt.Errorf("trusted_proxies: invalid address or CIDR %q", entry)
+		}
+	}
+	if err := c.Compression.Adaptive.Validate(); err != nil {
+		return err
+	}
+	for i, target := range c.CertMonitor.RemoteTargets {
+		host, port, err := net.SplitHostPort(target.Address)
+		if err != nil || host == "" || port == "" {
+			return fmt.Errorf("cert_monitor.remote_targets[%d]: address %q must be host:port", i, target.Address)
+		}
+	}
+	if _, err := c.GetCertMonitorTimeout(); err != nil {
+		return fmt.Errorf("cert_monitor.timeout: %w", err)
+	}
+	for i, job := range c.Jobs {
+		if job.Task == "" {
+			return fmt.Errorf("jobs[%d]: task is required", i)
+		}
+		if _, err := scheduler.Parse(job.Schedule); err != nil {
+			return fmt.Errorf("jobs[%d]: %w", i, err)
+		}
+	}
+
+	if _, err := checkHeaders(c.Defaults.Headers); err != nil {
+		return fmt.Errorf("defaults.headers: %w", err)
+	}
+
+	defaults := SiteConfig{Options: c.Defaults.Options}
+	if _, err := defaults.GetOptions(); err != nil {
+		return fmt.Errorf("defaults.options: %w", err)
+	}
+
+	return nil
 }
 
 // CertConfig represents a TLS certificate configuration
@@ -55,6 +688,71 @@ type RouteConfig struct {
 	Backend   string            `yaml:"backend"`
 	WebSocket bool              `yaml:"websocket,omitempty"`
 	Headers   map[string]string `yaml:"headers,omitempty"`
+	// HeaderMatch, CookieMatch and QueryMatch limit the route to requests
+	// whose headers, cookies and query parameters match. Such a route wins
+	// over a plain route for the same domain and path.
+	HeaderMatch []MatchConfig `yaml:"header_match,omitempty"`
+	CookieMatch []MatchConfig `yaml:"cookie_match,omitempty"`
+	QueryMatch  []MatchConfig `yaml:"query_match,omitempty"`
+	// Labels tag the route for filtering, e.g. team: payments. Keys listed
+	// in metrics.label_keys are also counted in /metrics.
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// MatchConfig is one request predicate of a route
+type MatchConfig struct {
+	Name  string `yaml:"name"`
+	Type  string `yaml:"type,omitempty"` // exact (default) or regex
+	Value string `yaml:"value"`
+}
+
+// validateMatches checks the predicates of one match list, e.g. header_match
+func validateMatches(field string, matches []MatchConfig) error {
+	for _, m := range matches {
+		if strings.TrimSpace(m.Name) == "" {
+			return fmt.Errorf("%s: name is required", field)
+		}
+		switch strings.ToLower(m.Type) {
+		case "", "exact":
+		case "regex":
+			if _, err := regexp.Compile(m.Value); err != nil {
+				return fmt.Errorf("%s %s: %w", field, m.Name, err)
+			}
+		default:
+			return fmt.Errorf("%s %s: unknown type %q", field, m.Name, m.Type)
+		}
+	}
+	return nil
+}
+
+// MaxRouteLabels caps the labels on one route
+const MaxRouteLabels = 16
+
+// labelKeyPattern matches route label keys
+var labelKeyPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.-]{0,62}$`)
+
+// ValidateRouteLabels checks a route's labels: at most MaxRouteLabels, keys
+// of letters, digits, '_', '.' and '-' starting with a letter or '_', and
+// values of at most 128 printable characters without ',', '=', '|', '"' or
+// '\', which would break ROUTE_ADD and /metrics
+func ValidateRouteLabels(labels map[string]string) error {
+	if len(labels) > MaxRouteLabels {
+		return fmt.Errorf("labels: at most %d labels per route", MaxRouteLabels)
+	}
+	for key, value := range labels {
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("labels: invalid key %q", key)
+		}
+		if len(value) > 128 {
+			return fmt.Errorf("labels: value of %s is longer than 128 characters", key)
+		}
+		for _, c := range value {
+			if c < 0x20 || c == 0x7f || strings.ContainsRune(",=|\"\\", c) {
+				return fmt.Errorf("labels: value of %s contains %q", key, c)
+			}
+		}
+	}
+	return nil
 }
 
 // OptionConfig represents service options
@@ -63,6 +761,8 @@ type OptionConfig struct {
 	HealthCheckInterval string               `yaml:"health_check_interval,omitempty"`
 	HealthCheckTimeout  string               `yaml:"health_check_timeout,omitempty"`
 	Timeout             string               `yaml:"timeout,omitempty"`
+	RequestTimeout      string               `yaml:"request_timeout,omitempty"` // Whole upstream exchange including the body, unset is no limit
+	Streaming           bool                 `yaml:"streaming,omitempty"`       // Long-lived responses (SSE, downloads), exempt from request_timeout
 	MaxBodySize         string               `yaml:"max_body_size,omitempty"`
 	Compression         CompressionConfig    `yaml:"compression,omitempty"`
 	WebSocket           WebSocketConfig      `yaml:"websocket,omitempty"`
@@ -79,6 +779,79 @@ type OptionConfig struct {
 	SlowRequest         SlowRequestConfig    `yaml:"slow_request,omitempty"`
 	Retry               RetryConfig          `yaml:"retry,omitempty"`
 	CircuitBreaker      CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
+	Maintenance         MaintenanceConfig    `yaml:"maintenance,omitempty"`
+	Drain               DrainConfig          `yaml:"drain,omitempty"`
+	// StripResponseHeaders are removed from this site's upstream responses,
+	// in addition to defaults.response_headers.strip
+	StripResponseHeaders []string `yaml:"strip_response_headers,omitempty"`
+	// AllowDynamicOverride lets registry routes take over this site's
+	// domain+path routes while registered. Default: true
+	AllowDynamicOverride *bool `yaml:"allow_dynamic_override,omitempty"`
+	// MirrorBackend receives a copy of each request; its responses are
+	// discarded. Empty disables mirroring.
+	MirrorBackend string       `yaml:"mirror_backend,omitempty"`
+	Mirror        MirrorConfig `yaml:"mirror,omitempty"`
+	// Redirect answers the site's requests with a redirect instead of
+	// proxying them. A route backend of redirect://<url> does the same for
+	// one route and uses the other settings here.
+	Redirect RedirectConfig `yaml:"redirect,omitempty"`
+	// CanonicalHost redirects the other form of each domain with a 301:
+	// "apex" sends www.example.com to example.com, "www" the reverse. "off"
+	// disables the defaults.options value for a site.
+	CanonicalHost string `yaml:"canonical_host,omitempty"`
+	// HTTPSRedirect false serves the site over plain HTTP as well instead of
+	// redirecting it to HTTPS. Default: true
+	HTTPSRedirect *bool `yaml:"https_redirect,omitempty"`
+	// ResponseValidation treats 2xx responses that are not what the site
+	// serves, e.g. an HTML error page from a JSON API, as backend failures
+	ResponseValidation ResponseValidationConfig `yaml:"response_validation,omitempty"`
+	// BackendRateLimit caps the requests forwarded to the backend from all
+	// clients together, e.g. "100/1s" or "600/1m"; more get a 503. Routes
+	// sharing the backend URL share the limit.
+	BackendRateLimit string `yaml:"backend_rate_limit,omitempty"`
+}
+
+// ResponseValidationConfig checks successful upstream responses
+type ResponseValidationConfig struct {
+	ContentType   string  `yaml:"content_type,omitempty"`   // Required Content-Type prefix, e.g. application/json
+	ValidJSON     bool    `yaml:"valid_json,omitempty"`     // The body must parse as JSON
+	SamplePercent float64 `yaml:"sample_percent,omitempty"` // Share of responses whose JSON is checked, default 10
+	MaxBodySize   string  `yaml:"max_body_size,omitempty"`  // Larger bodies are not checked, default 1M
+}
+
+// RedirectConfig configures redirect routes
+type RedirectConfig struct {
+	To           string `yaml:"to,omitempty"`            // Target URL, e.g. https://new.example.com
+	Status       int    `yaml:"status,omitempty"`        // 301 (default), 302, 307 or 308
+	PreservePath *bool  `yaml:"preserve_path,omitempty"` // Append the request path and query, default true
+	StripPrefix  bool   `yaml:"strip_prefix,omitempty"`  // Drop the route path before appending
+}
+
+// MirrorConfig tunes request mirroring to mirror_backend
+type MirrorConfig struct {
+	Percent      float64 `yaml:"percent,omitempty"`        // Share of requests copied, default 100
+	MaxPerSecond int     `yaml:"max_per_second,omitempty"` // Rate limit on copies, 0 unlimited
+	MaxBodySize  string  `yaml:"max_body_size,omitempty"`  // Larger requests are not copied, default 1M
+	Timeout      string  `yaml:"timeout,omitempty"`        // Per copy, default 10s
+}
+
+// MaintenanceConfig controls the page the proxy serves while a route is in
+// maintenance without a maintenance server URL
+type MaintenanceConfig struct {
+	// Template is an HTML template file; variables: .Service, .Domain, .Path,
+	// .Reason, .ETA, .RequestID. Empty uses the built-in page.
+	Template string `yaml:"template,omitempty"`
+	// Status of maintenance responses, default 503. Also applied to HTML
+	// pages from a maintenance server URL.
+	Status     int    `yaml:"status,omitempty"`
+	RetryAfter string `yaml:"retry_after,omitempty"` // Retry-After, default 5m
+}
+
+// DrainConfig controls the response to requests rejected while a route drains
+type DrainConfig struct {
+	Status     int    `yaml:"status,omitempty"`      // Default 503; a 3xx needs redirect
+	RetryAfter string `yaml:"retry_after,omitempty"` // Retry-After, default 1m
+	Redirect   string `yaml:"redirect,omitempty"`    // Location for a 3xx status
 }
 
 // GeoIPConfig represents GeoIP tracking settings
@@ -147,7 +920,7 @@ type TimeoutConfig struct {
 // LimitConfig represents size limits for requests/responses
 type LimitConfig struct {
 	MaxRequestBody  int64 `yaml:"max_request_body,omitempty"`  // Bytes, default: 10MB
-	MaxResponseBody int64 `yaml:"max_response_body,omitempty"` // Bytes, default: 10MB
+	MaxResponseBody int64 `yaml:"max_response_body,omitempty"` // Bytes, default: unlimited
 }
 
 // CompressionConfig represents response compression settings
@@ -208,6 +981,9 @@ type ConnectionPoolConfig struct {
 	MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host,omitempty"`
 	MaxConnsPerHost     int           `yaml:"max_conns_per_host,omitempty"`
 	IdleTimeout         time.Duration `yaml:"idle_timeout,omitempty"`
+	KeepAlive           time.Duration `yaml:"keep_alive,omitempty"`   // TCP keep-alive interval, negative disables
+	MaxConnAge          time.Duration `yaml:"max_conn_age,omitempty"` // Recycle connections older than this, 0 never
+	TCPNoDelay          *bool         `yaml:"tcp_no_delay,omitempty"`
 }
 
 // SlowRequestConfig represents slow request detection thresholds
@@ -217,6 +993,8 @@ type SlowRequestConfig struct {
 	Critical     time.Duration `yaml:"critical,omitempty"`
 	Timeout      time.Duration `yaml:"timeout,omitempty"`
 	AlertWebhook *bool         `yaml:"alert_webhook,omitempty"`
+	Mode         string        `yaml:"mode,omitempty"`       // fixed (default) or adaptive
+	Multiplier   float64       `yaml:"multiplier,omitempty"` // Adaptive: times p95 (warning) and p99 (critical), default 2
 }
 
 // RetryConfig represents request retry behavior
@@ -266,8 +1044,7 @@ func (t *TimeoutConfig) GetTimeouts() TimeoutConfig {
 // GetLimits returns limit configuration with defaults
 func (l *LimitConfig) GetLimits() LimitConfig {
 	defaults := LimitConfig{
-		MaxRequestBody:  10 * 1024 * 1024, // 10 MB
-		MaxResponseBody: 10 * 1024 * 1024, // 10 MB
+		MaxRequestBody: 10 * 1024 * 1024, // 10 MB
 	}
 
 	if l.MaxRequestBody > 0 {
@@ -342,11 +1119,14 @@ func (w *WebSocketConfig) GetWebSocket() WebSocketConfig {
 
 // GetConnectionPool returns connection pool configuration with defaults
 func (p *ConnectionPoolConfig) GetConnectionPool() ConnectionPoolConfig {
+	trueVal := true
 	defaults := ConnectionPoolConfig{
 		MaxIdleConns:        100,
 		MaxIdleConnsPerHost: 10,
 		MaxConnsPerHost:     50,
 		IdleTimeout:         90 * time.Second,
+		KeepAlive:           30 * time.Second,
+		TCPNoDelay:          &trueVal,
 	}
 	if p.MaxIdleConns > 0 {
 		defaults.MaxIdleConns = p.MaxIdleConns
@@ -360,6 +1140,15 @@ func (p *ConnectionPoolConfig) GetConnectionPool() ConnectionPoolConfig {
 	if p.IdleTimeout > 0 {
 		defaults.IdleTimeout = p.IdleTimeout
 	}
+	if p.KeepAlive != 0 {
+		defaults.KeepAlive = p.KeepAlive
+	}
+	if p.MaxConnAge > 0 {
+		defaults.MaxConnAge = p.MaxConnAge
+	}
+	if p.TCPNoDelay != nil {
+		defaults.TCPNoDelay = p.TCPNoDelay
+	}
 	return defaults
 }
 
@@ -372,6 +1161,8 @@ func (s *SlowRequestConfig) GetSlowRequest() SlowRequestConfig {
 		Critical:     10 * time.Second,
 		Timeout:      30 * time.Second,
 		AlertWebhook: &trueVal,
+		Mode:         "fixed",
+		Multiplier:   2,
 	}
 	if s.Enabled != nil {
 		defaults.Enabled = s.Enabled
@@ -388,6 +1179,12 @@ func (s *SlowRequestConfig) GetSlowRequest() SlowRequestConfig {
 	if s.AlertWebhook != nil {
 		defaults.AlertWebhook = s.AlertWebhook
 	}
+	if s.Mode != "" {
+		defaults.Mode = s.Mode
+	}
+	if s.Multiplier > 0 {
+		defaults.Multiplier = s.Multiplier
+	}
 	return defaults
 }
 
@@ -606,11 +1403,13 @@ func (g *GeoIPConfig) GetGeoIP() GeoIPConfig {
 	return defaults
 }
 
-// LoadGlobalConfig loads global configuration from YAML file
+// LoadGlobalConfig loads global configuration from YAML file, merged with
+// the files it includes and with ${VAR} references expanded (see
+// ReadGlobalYAML)
 func LoadGlobalConfig(path string) (*GlobalConfig, error) {
-	data, err := os.ReadFile(path)
+	data, err := ReadGlobalYAML(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
 
 	var cfg GlobalConfig
@@ -621,9 +1420,10 @@ func LoadGlobalConfig(path string) (*GlobalConfig, error) {
 	return &cfg, nil
 }
 
-// LoadSiteConfig loads a site configuration from YAML file
+// LoadSiteConfig loads a site configuration from YAML file, with ${VAR}
+// references expanded from the environment
 func LoadSiteConfig(path string) (*SiteConfig, error) {
-	data, err := os.ReadFile(path)
+	data, err := readConfigFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
@@ -645,6 +1445,9 @@ func (c *SiteConfig) Validate() error {
 	if len(c.Routes) == 0 {
 		return fmt.Errorf("at least one route is required")
 	}
+	if _, err := checkHeaders(c.Headers); err != nil {
+		return fmt.Errorf("headers: %w", err)
+	}
 
 	for i, route := range c.Routes {
 		if len(route.Domains) == 0 {
@@ -653,9 +1456,24 @@ func (c *SiteConfig) Validate() error {
 		if route.Path == "" {
 			return fmt.Errorf("route %d: path is required", i)
 		}
-		if route.Backend == "" {
+		if route.Backend == "" && c.Options.Redirect.To == "" {
 			return fmt.Errorf("route %d: backend is required", i)
 		}
+		if _, err := checkHeaders(route.Headers); err != nil {
+			return fmt.Errorf("route %d: headers: %w", i, err)
+		}
+		if err := validateMatches("header_match", route.HeaderMatch); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+		if err := validateMatches("cookie_match", route.CookieMatch); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+		if err := validateMatches("query_match", route.QueryMatch); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+		if err := ValidateRouteLabels(route.Labels); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
 	}
 
 	return nil
@@ -696,6 +1514,20 @@ func (c *SiteConfig) GetOptions() (map[string]interface{}, error) {
 		opts["timeout"] = dur
 	}
 
+	if c.Options.RequestTimeout != "" {
+		dur, err := time.ParseDuration(c.Options.RequestTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request_timeout: %w", err)
+		}
+		if dur <= 0 {
+			return nil, fmt.Errorf("invalid request_timeout: must be positive")
+		}
+		opts["request_timeout"] = dur
+	}
+	if c.Options.Streaming {
+		opts["streaming"] = true
+	}
+
 	if c.Options.MaxBodySize != "" {
 		size, err := parseSize(c.Options.MaxBodySize)
 		if err != nil {
@@ -732,6 +1564,161 @@ func (c *SiteConfig) GetOptions() (map[string]interface{}, error) {
 		opts["http3"] = *c.Options.HTTP3
 	}
 
+	opts["allow_dynamic_override"] = c.Options.AllowDynamicOverride == nil || *c.Options.AllowDynamicOverride
+
+	if len(c.Options.StripResponseHeaders) > 0 {
+		if err := validateHeaderNames("strip_response_headers", c.Options.StripResponseHeaders); err != nil {
+			return nil, err
+		}
+		opts["strip_response_headers"] = c.Options.StripResponseHeaders
+	}
+
+	if c.Service.Name != "" {
+		opts["service_name"] = c.Service.Name
+	}
+	if c.Options.Maintenance.Template != "" {
+		if _, err := os.Stat(c.Options.Maintenance.Template); err != nil {
+			return nil, fmt.Errorf("maintenance.template: %w", err)
+		}
+		opts["maintenance_template"] = c.Options.Maintenance.Template
+	}
+	if m := c.Options.Maintenance; m.Status != 0 {
+		if m.Status < 200 || m.Status > 599 {
+			return nil, fmt.Errorf("maintenance.status: invalid status %d", m.Status)
+		}
+		opts["maintenance_status"] = m.Status
+	}
+	if m := c.Options.Maintenance; m.RetryAfter != "" {
+		dur, err := time.ParseDuration(m.RetryAfter)
+		if err != nil || dur <= 0 {
+			return nil, fmt.Errorf("maintenance.retry_after: invalid duration %q", m.RetryAfter)
+		}
+		opts["maintenance_retry_after"] = dur
+	}
+	if d := c.Options.Drain; d.Status != 0 || d.Redirect != "" {
+		redirect := d.Status >= 300 && d.Status < 400
+		switch {
+		case d.Status != 0 && (d.Status < 300 || d.Status > 599):
+			return nil, fmt.Errorf("drain.status: invalid status %d", d.Status)
+		case redirect && d.Redirect == "":
+			return nil, fmt.Errorf("drain.status: %d requires drain.redirect", d.Status)
+		case d.Redirect != "" && !redirect:
+			return nil, fmt.Errorf("drain.redirect requires a 3xx drain.status")
+		}
+		opts["drain_status"] = d.Status
+		opts["drain_redirect"] = d.Redirect
+	}
+	if d := c.Options.Drain; d.RetryAfter != "" {
+		dur, err := time.ParseDuration(d.RetryAfter)
+		if err != nil || dur <= 0 {
+			return nil, fmt.Errorf("drain.retry_after: invalid duration %q", d.RetryAfter)
+		}
+		opts["drain_retry_after"] = dur
+	}
+
+	if c.Options.MirrorBackend != "" {
+		u, err := url.Parse(c.Options.MirrorBackend)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("mirror_backend: invalid URL %q", c.Options.MirrorBackend)
+		}
+		opts["mirror_backend"] = c.Options.MirrorBackend
+
+		m := c.Options.Mirror
+		if m.Percent != 0 {
+			if m.Percent < 0 || m.Percent > 100 {
+				return nil, fmt.Errorf("mirror.percent: must be between 0 and 100, got %v", m.Percent)
+			}
+			opts["mirror_percent"] = m.Percent
+		}
+		if m.MaxPerSecond < 0 {
+			return nil, fmt.Errorf("mirror.max_per_second: must not be negative")
+		}
+		opts["mirror_rate"] = m.MaxPerSecond
+		if m.MaxBodySize != "" {
+			size, err := parseSize(m.MaxBodySize)
+			if err != nil {
+				return nil, fmt.Errorf("mirror.max_body_size: %w", err)
+			}
+			opts["mirror_max_body"] = size
+		}
+		if m.Timeout != "" {
+			dur, err := time.ParseDuration(m.Timeout)
+			if err != nil || dur <= 0 {
+				return nil, fmt.Errorf("mirror.timeout: invalid duration %q", m.Timeout)
+			}
+			opts["mirror_timeout"] = dur
+		}
+	}
+
+	if rv := c.Options.ResponseValidation; rv.ContentType != "" || rv.ValidJSON {
+		if rv.SamplePercent < 0 || rv.SamplePercent > 100 {
+			return nil, fmt.Errorf("response_validation.sample_percent: must be between 0 and 100, got %v", rv.SamplePercent)
+		}
+		validation := map[string]interface{}{
+			"content_type": rv.ContentType,
+			"valid_json":   rv.ValidJSON,
+		}
+		if rv.SamplePercent > 0 {
+			validation["sample_percent"] = rv.SamplePercent
+		}
+		if rv.MaxBodySize != "" {
+			size, err := parseSize(rv.MaxBodySize)
+			if err != nil {
+				return nil, fmt.Errorf("response_validation.max_body_size: %w", err)
+			}
+			validation["max_body"] = size
+		}
+		opts["response_validation"] = validation
+	}
+
+	if rd := c.Options.Redirect; rd.To != "" || rd.Status != 0 || rd.PreservePath != nil || rd.StripPrefix {
+		if rd.To != "" {
+			u, err := url.Parse(rd.To)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("redirect.to: invalid URL %q", rd.To)
+			}
+			opts["redirect"] = rd.To
+		}
+		switch rd.Status {
+		case 0:
+		case 301, 302, 307, 308:
+			opts["redirect_status"] = rd.Status
+		default:
+			return nil, fmt.Errorf("redirect.status: must be 301, 302, 307 or 308, got %d", rd.Status)
+		}
+		if rd.PreservePath != nil {
+			opts["redirect_preserve_path"] = *rd.PreservePath
+		}
+		opts["redirect_strip_prefix"] = rd.StripPrefix
+	}
+
+	if c.Options.HTTPSRedirect != nil {
+		opts["https_redirect"] = *c.Options.HTTPSRedirect
+	}
+
+	if c.Options.BackendRateLimit != "" {
+		requests, window, err := ParseBackendRateLimit(c.Options.BackendRateLimit)
+		if err != nil {
+			return nil, fmt.Errorf("backend_rate_limit: %w", err)
+		}
+		opts["backend_rate_limit"] = requests
+		opts["backend_rate_window"] = window
+	}
+
+	if c.Options.CanonicalHost != "" {
+		switch c.Options.CanonicalHost {
+		case "apex", "www", "off":
+			opts["canonical_host"] = c.Options.CanonicalHost
+		default:
+			return nil, fmt.Errorf("canonical_host: must be apex, www or off, got %q", c.Options.CanonicalHost)
+		}
+	}
+
+	// Upstream response size limit, opt-in so large downloads keep streaming
+	if limits := c.Options.Limits.GetLimits(); limits.MaxResponseBody > 0 {
+		opts["max_response_body"] = limits.MaxResponseBody
+	}
+
 	// Connection pool settings
 	pool := c.Options.ConnectionPool.GetConnectionPool()
 	opts["pool"] = map[string]interface{}{
@@ -739,16 +1726,27 @@ func (c *SiteConfig) GetOptions() (map[string]interface{}, error) {
 		"max_idle_conns_per_host": pool.MaxIdleConnsPerHost,
 		"max_conns_per_host":      pool.MaxConnsPerHost,
 		"idle_timeout":            pool.IdleTimeout,
+		"keep_alive":              pool.KeepAlive,
+		"max_conn_age":            pool.MaxConnAge,
+		"tcp_no_delay":            boolValue(pool.TCPNoDelay),
 	}
 
 	// Slow request detection
 	slow := c.Options.SlowRequest.GetSlowRequest()
+	if slow.Mode != "fixed" && slow.Mode != "adaptive" {
+		return nil, fmt.Errorf("slow_request.mode: must be fixed or adaptive, got %q", slow.Mode)
+	}
+	if c.Options.SlowRequest.Multiplier < 0 {
+		return nil, fmt.Errorf("slow_request.multiplier: must be positive")
+	}
 	opts["slow_request"] = map[string]interface{}{
 		"enabled":       boolValue(slow.Enabled),
 		"warning":       slow.Warning,
 		"critical":      slow.Critical,
 		"timeout":       slow.Timeout,
 		"alert_webhook": boolValue(slow.AlertWebhook),
+		"mode":          slow.Mode,
+		"multiplier":    slow.Multiplier,
 	}
 
 	// Retry logic
@@ -873,6 +1871,29 @@ func (c *SiteConfig) GetRetention() RetentionConfig {
 	}
 }
 
+// ParseBackendRateLimit parses a backend rate limit like "100/1s": requests
+// per window. The window defaults to a second and may be given as a unit
+// alone, as in "600/m".
+func ParseBackendRateLimit(s string) (requests int, window time.Duration, err error) {
+	count, per, found := strings.Cut(strings.TrimSpace(s), "/")
+	requests, err = strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || requests <= 0 {
+		return 0, 0, fmt.Errorf("invalid request count in %q", s)
+	}
+	window = time.Second
+	if found {
+		per = strings.TrimSpace(per)
+		if per == "s" || per == "m" || per == "h" {
+			per = "1" + per
+		}
+		window, err = time.ParseDuration(per)
+		if err != nil || window <= 0 {
+			return 0, 0, fmt.Errorf("invalid window in %q", s)
+		}
+	}
+	return requests, window, nil
+}
+
 // parseSize parses size strings like "10M", "1G", "512K"
 func parseSize(s string) (int64, error) {
 	if len(s) == 0 {
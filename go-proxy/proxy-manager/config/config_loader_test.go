@@ -2,7 +2,10 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadGlobalConfig(t *testing.T) {
@@ -42,6 +45,147 @@ tls:
 	}
 }
 
+func TestLoadGlobalConfigIncludes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	global := write("global.yaml", `
+include:
+  - tls.yaml
+  - conf.d/*.yaml
+defaults:
+  headers:
+    X-Frame-Options: DENY
+    X-Content-Type-Options: nosniff
+trusted_proxies: ["10.0.0.0/8"]
+`)
+	write("tls.yaml", `
+tls:
+  certificates:
+    - domains: ["example.com"]
+      cert_file: /path/cert.pem
+      key_file: /path/key.pem
+`)
+	write("conf.d/10-headers.yaml", `
+defaults:
+  headers:
+    X-Frame-Options: SAMEORIGIN
+trusted_proxies: ["172.16.0.0/12"]
+`)
+	write("conf.d/20-headers.yaml", `
+include: ../extra.yaml
+defaults:
+  headers:
+    X-Frame-Options: ALLOW-FROM example.com
+`)
+	write("extra.yaml", `
+trusted_proxies: ["192.168.0.0/16"]
+`)
+
+	cfg, err := LoadGlobalConfig(global)
+	if err != nil {
+		t.Fatalf("LoadGlobalConfig error: %v", err)
+	}
+	if len(cfg.TLS.Certificates) != 1 || cfg.TLS.Certificates[0].CertFile != "/path/cert.pem" {
+		t.Fatalf("expected the included certificate, got %+v", cfg.TLS.Certificates)
+	}
+	if got := cfg.Defaults.Headers["X-Frame-Options"]; got != "ALLOW-FROM example.com" {
+		t.Fatalf("expected the last file to win, got %q", got)
+	}
+	if got := cfg.Defaults.Headers["X-Content-Type-Options"]; got != "nosniff" {
+		t.Fatalf("expected keys missing from later files to be kept, got %q", got)
+	}
+	if len(cfg.TrustedProxies) != 1 || cfg.TrustedProxies[0] != "192.168.0.0/16" {
+		t.Fatalf("expected lists to be replaced by the nested include, got %v", cfg.TrustedProxies)
+	}
+
+	// An unmatched glob is skipped, a missing file is not
+	write("global.yaml", "include: [none.d/*.yaml]\ntrusted_proxies: [\"10.0.0.0/8\"]\n")
+	if _, err := LoadGlobalConfig(global); err != nil {
+		t.Fatalf("expected an unmatched glob to be skipped: %v", err)
+	}
+	write("global.yaml", "include: missing.yaml\n")
+	if _, err := LoadGlobalConfig(global); err == nil || !strings.Contains(err.Error(), "missing.yaml") {
+		t.Fatalf("expected an error naming the missing include, got %v", err)
+	}
+
+	write("global.yaml", "include: tls-list.yaml\ntls:\n  certificates: []\n")
+	write("tls-list.yaml", "tls: [\"example.com\"]\n")
+	if _, err := LoadGlobalConfig(global); err == nil || !strings.Contains(err.Error(), "conflicting tls") {
+		t.Fatalf("expected a conflict between a mapping and a list, got %v", err)
+	}
+
+	write("global.yaml", "include: loop.yaml\n")
+	write("loop.yaml", "include: global.yaml\n")
+	if _, err := LoadGlobalConfig(global); err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("expected an include cycle error, got %v", err)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	env := map[string]string{"BACKEND_HOST": "app", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	for _, tc := range []struct{ in, want string }{
+		{"backend: http://${BACKEND_HOST}:8080", "backend: http://app:8080"},
+		{"port: ${BACKEND_PORT:-8080}", "port: 8080"},
+		{"host: ${EMPTY:-localhost}", "host: localhost"},
+		{"host: '${EMPTY}'", "host: ''"},
+		{"host: ${BACKEND_HOST:-localhost}", "host: app"},
+		{"price: $$5 and $${BACKEND_HOST}", "price: $5 and ${BACKEND_HOST}"},
+		{"path: ^/api$\nhash: $2a$10$abc", "path: ^/api$\nhash: $2a$10$abc"},
+	} {
+		got, err := expandEnv([]byte(tc.in), lookup)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.in, err)
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("%q: expected %q, got %q", tc.in, tc.want, got)
+		}
+	}
+
+	for _, in := range []string{
+		"a: 1\nkey: ${MISSING}",
+		"key: ${BACKEND_HOST",
+		"key: ${1BAD}",
+	} {
+		if _, err := expandEnv([]byte(in), lookup); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+	if _, err := expandEnv([]byte("a: 1\nkey: ${MISSING}"), lookup); err == nil ||
+		!strings.Contains(err.Error(), "line 2") || !strings.Contains(err.Error(), "MISSING") {
+		t.Errorf("expected the error to name the variable and line, got %v", err)
+	}
+
+	t.Setenv("PROXY_TEST_BACKEND", "http://api:9000")
+	path := filepath.Join(t.TempDir(), "site.yaml")
+	site := "service:\n  name: api\nroutes:\n  - domains: [\"example.com\"]\n    path: /\n    backend: ${PROXY_TEST_BACKEND}\n"
+	if err := os.WriteFile(path, []byte(site), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadSiteConfig(path)
+	if err != nil {
+		t.Fatalf("LoadSiteConfig error: %v", err)
+	}
+	if cfg.Routes[0].Backend != "http://api:9000" {
+		t.Fatalf("expected the backend from the environment, got %q", cfg.Routes[0].Backend)
+	}
+}
+
 func TestLoadSiteConfigValidateAndOptions(t *testing.T) {
 	yaml := `
 enabled: true
@@ -56,6 +200,7 @@ options:
   health_check_timeout: 5s
   timeout: 15s
   max_body_size: 10M
+  request_timeout: 2m
   http2: true
   http3: true
 `
@@ -84,4 +229,394 @@ options:
 	if opts["max_body_size"].(int64) <= 0 {
 		t.Error("expected parsed max_body_size > 0")
 	}
+	if opts["request_timeout"] != 2*time.Minute {
+		t.Errorf("expected request_timeout 2m, got %v", opts["request_timeout"])
+	}
+	if _, ok := opts["streaming"]; ok {
+		t.Error("expected streaming unset by default")
+	}
+
+	cfg.Options.RequestTimeout = "0s"
+	if _, err := cfg.GetOptions(); err == nil {
+		t.Error("expected error for a zero request_timeout")
+	}
+}
+
+func TestParseBackendRateLimit(t *testing.T) {
+	for _, tc := range []struct {
+		in       string
+		requests int
+		window   time.Duration
+	}{
+		{"100", 100, time.Second},
+		{"100/1s", 100, time.Second},
+		{"600/m", 600, time.Minute},
+		{" 50 / 10s ", 50, 10 * time.Second},
+	} {
+		requests, window, err := ParseBackendRateLimit(tc.in)
+		if err != nil || requests != tc.requests || window != tc.window {
+			t.Errorf("%q: got %d/%v, %v", tc.in, requests, window, err)
+		}
+	}
+	for _, bad := range []string{"", "0/1s", "-5", "ten/1s", "100/", "100/0s", "100/fortnight"} {
+		if _, _, err := ParseBackendRateLimit(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+
+	cfg := &SiteConfig{Options: OptionConfig{BackendRateLimit: "20/1m"}}
+	opts, err := cfg.GetOptions()
+	if err != nil {
+		t.Fatalf("GetOptions error: %v", err)
+	}
+	if opts["backend_rate_limit"] != 20 || opts["backend_rate_window"] != time.Minute {
+		t.Errorf("expected 20 per minute, got %v per %v", opts["backend_rate_limit"], opts["backend_rate_window"])
+	}
+}
+
+func TestRouteLabelsValidate(t *testing.T) {
+	cfg := SiteConfig{
+		Routes: []RouteConfig{{
+			Domains: []string{"example.com"},
+			Path:    "/",
+			Backend: "http://localhost:8080",
+			Labels:  map[string]string{"team": "payments", "cost-center": "42", "owner.email": "ops@example.com"},
+		}},
+	}
+	cfg.Service.Name = "api"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, labels := range []map[string]string{
+		{"9team": "x"},
+		{"team name": "x"},
+		{"team": "a,b"},
+		{"team": "a\nb"},
+		{"team": `say "hi"`},
+		{"team": strings.Repeat("x", 129)},
+	} {
+		cfg.Routes[0].Labels = labels
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected %v to be rejected", labels)
+		}
+	}
+
+	var global GlobalConfig
+	global.Metrics.LabelKeys = []string{"team", "bad key"}
+	if err := global.Validate(); err == nil {
+		t.Fatalf("expected an invalid metrics.label_keys entry to be rejected")
+	}
+}
+
+func TestGlobalConfigValidateAndDefaults(t *testing.T) {
+	var cfg GlobalConfig
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("empty config should validate: %v", err)
+	}
+	if cfg.GetErrorRateThreshold() != 5.0 {
+		t.Fatalf("expected default threshold 5, got %v", cfg.GetErrorRateThreshold())
+	}
+	if cfg.GetRetentionDays() != 30 {
+		t.Fatalf("expected default retention 30, got %d", cfg.GetRetentionDays())
+	}
+	if cfg.Retention.Vacuum || cfg.GetVacuumThreshold() != 64<<20 {
+		t.Fatalf("expected vacuum off with 64MB threshold, got %t %d", cfg.Retention.Vacuum, cfg.GetVacuumThreshold())
+	}
+
+	if cfg.GetAuditLogDays() != 365 {
+		t.Fatalf("expected audit log kept 365 days by default, got %d", cfg.GetAuditLogDays())
+	}
+	if jobs := cfg.GetJobs(); len(jobs) != len(DefaultJobs) || jobs[0].Task != "cleanup" {
+		t.Fatalf("expected default jobs, got %v", jobs)
+	}
+	cfg.Jobs = []JobConfig{{Schedule: "0 25 * * *", Task: "cleanup"}}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for invalid job schedule")
+	}
+	cfg.Jobs = []JobConfig{{Schedule: "@daily"}}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for job without task")
+	}
+	cfg.Jobs = []JobConfig{{Schedule: "30 4 * * 0", Task: "vacuum"}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid job: %v", err)
+	}
+	if jobs := cfg.GetJobs(); len(jobs) != 1 || jobs[0].Task != "vacuum" {
+		t.Fatalf("expected configured jobs to replace defaults, got %v", jobs)
+	}
+	cfg.Jobs = nil
+
+	cfg.Retention.VacuumThresholdMB = -1
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for negative vacuum threshold")
+	}
+	cfg.Retention.VacuumThresholdMB = 0
+
+	cfg.Alerts.ErrorRateThreshold = 150
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for threshold > 100")
+	}
+	cfg.Alerts.ErrorRateThreshold = 10
+
+	cfg.TLS.Certificates = []CertConfig{{Domains: []string{"example.com"}, CertFile: "/c.pem"}}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for missing key_file")
+	}
+	cfg.TLS.Certificates[0].KeyFile = "/k.pem"
+
+	cfg.Defaults.Options.Timeout = "soon"
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for invalid defaults.options.timeout")
+	}
+	cfg.Defaults.Options.Timeout = "30s"
+
+	if got := cfg.GetHTTPRedirectExempt(); len(got) != 1 || got[0] != "/.well-known/acme-challenge/" {
+		t.Fatalf("expected ACME challenge path exempt by default, got %v", got)
+	}
+	cfg.Server.HTTPRedirectExempt = []string{}
+	if got := cfg.GetHTTPRedirectExempt(); len(got) != 0 {
+		t.Fatalf("expected empty list to exempt nothing, got %v", got)
+	}
+	cfg.Server.HTTPRedirectExempt = []string{"callback/"}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for exempt path without leading slash")
+	}
+	cfg.Server.HTTPRedirectExempt = nil
+
+	cfg.Pause.ExemptPaths = []string{"healthz"}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for pause exempt path without leading slash")
+	}
+	cfg.Pause.ExemptPaths = []string{"/healthz"}
+	cfg.Pause.RetryAfter = "0s"
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for non-positive pause.retry_after")
+	}
+	cfg.Pause.RetryAfter = "2m"
+	if d, err := cfg.GetPauseRetryAfter(); err != nil || d != 2*time.Minute {
+		t.Fatalf("expected pause.retry_after 2m, got %v %v", d, err)
+	}
+
+	cfg.Server.ProxyProtocol.Enabled = true
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for proxy_protocol without trusted balancers")
+	}
+	cfg.Server.ProxyProtocol.Trusted = []string{"10.0.0.0/33"}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for invalid proxy_protocol.trusted entry")
+	}
+	cfg.Server.ProxyProtocol.Trusted = []string{"10.0.0.0/24"}
+
+	if timeouts, _ := cfg.GetServerTimeouts(); timeouts != (ServerTimeouts{ReadHeader: 10 * time.Second, Idle: 120 * time.Second}) {
+		t.Fatalf("unexpected default server timeouts: %+v", timeouts)
+	}
+	cfg.Server.IdleTimeout = "-1s"
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for negative idle_timeout")
+	}
+	cfg.Server.IdleTimeout = "0"
+	cfg.Server.MaxConnections = -1
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for negative max_connections")
+	}
+	cfg.Server.MaxConnections = 0
+	cfg.Server.WriteTimeout = "5m"
+	if timeouts, err := cfg.GetServerTimeouts(); err != nil || timeouts.Idle != 0 || timeouts.Write != 5*time.Minute {
+		t.Fatalf("expected idle disabled and write 5m, got %+v %v", timeouts, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.GetErrorRateThreshold() != 10 {
+		t.Fatalf("expected threshold 10, got %v", cfg.GetErrorRateThreshold())
+	}
+}
+
+func TestHTTPSListeners(t *testing.T) {
+	var cfg GlobalConfig
+	if got := cfg.GetHTTPSListeners(":443"); len(got) != 1 || got[0] != ":443" {
+		t.Fatalf("expected HTTPS_ADDR by default, got %v", got)
+	}
+	cfg.Server.HTTPSListeners = []string{":443", "10.0.0.5:8443"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := CheckListeners(cfg.GetHTTPSListeners(":443"), ":80", 81); err != nil {
+		t.Fatalf("unexpected collision: %v", err)
+	}
+
+	for name, listeners := range map[string][]string{
+		"no port":   {"443"},
+		"duplicate": {":8443", "127.0.0.1:8443"},
+	} {
+		cfg.Server.HTTPSListeners = listeners
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+
+	if err := CheckListeners([]string{":443", ":80"}, ":80", 81); err == nil {
+		t.Fatalf("expected collision with the HTTP address")
+	}
+	if err := CheckListeners([]string{"127.0.0.1:81"}, ":80", 81); err == nil {
+		t.Fatalf("expected collision with the registry port")
+	}
+	if err := CheckListeners([]string{"10.0.0.1:8443", "10.0.0.2:8443"}, ":80", 81); err != nil {
+		t.Fatalf("expected the same port on different hosts to be allowed: %v", err)
+	}
+}
+
+func TestDashboardAuthResolve(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	auth := DashboardAuth{Username: "admin", PasswordFile: secret, Token: "tok"}
+	user, pass, token, err := auth.Resolve()
+	if err != nil {
+		t.Fatalf("Resolve error: %v", err)
+	}
+	if user != "admin" || pass != "s3cret" || token != "tok" {
+		t.Fatalf("unexpected credentials %q %q %q", user, pass, token)
+	}
+
+	for name, bad := range map[string]DashboardAuth{
+		"username without password": {Username: "admin"},
+		"inline and file":           {Username: "admin", Password: "x", PasswordFile: secret},
+		"missing file":              {TokenFile: filepath.Join(t.TempDir(), "nope")},
+	} {
+		var cfg GlobalConfig
+		cfg.Dashboard.Auth = bad
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestCORSConfigValidate(t *testing.T) {
+	ok := CORSConfig{AllowedOrigins: []string{"https://admin.example.com", "http://localhost:3000"}, AllowCredentials: true, MaxAge: "10m"}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, bad := range map[string]CORSConfig{
+		"wildcard with credentials": {AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		"origin with path":          {AllowedOrigins: []string{"https://admin.example.com/app"}},
+		"bare host":                 {AllowedOrigins: []string{"admin.example.com"}},
+		"bad max_age":               {MaxAge: "soon"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestStripResponseHeadersConfig(t *testing.T) {
+	if err := (ResponseHeadersConfig{Strip: []string{"X-Debug-Token"}, HideServer: true}).Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := (ResponseHeadersConfig{Strip: []string{"X-Debug Token"}}).Validate(); err == nil {
+		t.Fatalf("expected error for header name with space")
+	}
+
+	site := SiteConfig{}
+	site.Options.StripResponseHeaders = []string{"X-Internal"}
+	opts, err := site.GetOptions()
+	if err != nil {
+		t.Fatalf("GetOptions error: %v", err)
+	}
+	if got, ok := opts["strip_response_headers"].([]string); !ok || len(got) != 1 || got[0] != "X-Internal" {
+		t.Fatalf("unexpected strip_response_headers option: %#v", opts["strip_response_headers"])
+	}
+	site.Options.StripResponseHeaders = []string{""}
+	if _, err := site.GetOptions(); err == nil {
+		t.Fatalf("expected error for empty header name")
+	}
+}
+
+func TestCheckHSTS(t *testing.T) {
+	cases := []struct {
+		value    string
+		wantErr  bool
+		warnings int
+	}{
+		{"", false, 0},
+		{"max-age=31536000; includeSubDomains", false, 0},
+		{"max-age=63072000; includeSubDomains; preload", false, 0},
+		{"max-age=300", false, 0},
+		{"max-age=300; includeSubDomains", false, 1},
+		{"max-age=31536000; preload", false, 1},
+		{"max-age=300; preload", false, 2},
+		{`max-age="31536000"`, false, 0},
+		{"includeSubDomains", true, 0},
+		{"max-age=soon", true, 0},
+		{"max-age=300; includeSubdomain", true, 0},
+	}
+	for _, tc := range cases {
+		warnings, err := CheckHSTS(tc.value)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: expected error %t, got %v", tc.value, tc.wantErr, err)
+		}
+		if len(warnings) != tc.warnings {
+			t.Errorf("%q: expected %d warnings, got %v", tc.value, tc.warnings, warnings)
+		}
+	}
+
+	site := SiteConfig{
+		Routes: []RouteConfig{{
+			Domains: []string{"example.com"}, Path: "/", Backend: "http://app:8080",
+			Headers: map[string]string{"Strict-Transport-Security": "max-age=60; preload"},
+		}},
+	}
+	site.Service.Name = "app"
+	if err := site.Validate(); err != nil {
+		t.Fatalf("expected warnings only, got %v", err)
+	}
+	if got := site.HeaderWarnings(); len(got) != 2 {
+		t.Fatalf("expected 2 route warnings, got %v", got)
+	}
+	site.Routes[0].Headers["Strict-Transport-Security"] = "forever"
+	if err := site.Validate(); err == nil {
+		t.Fatal("expected invalid route HSTS to fail validation")
+	}
+}
+
+func TestCertMonitorRemoteTargets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "global.yaml")
+	os.WriteFile(path, []byte(`
+cert_monitor:
+  timeout: 5s
+  remote_targets:
+    - backend.internal:8443
+    - address: 10.0.0.7:443
+      server_name: api.example.com
+`), 0o600)
+	cfg, err := LoadGlobalConfig(path)
+	if err != nil {
+		t.Fatalf("LoadGlobalConfig: %v", err)
+	}
+	targets := cfg.CertMonitor.RemoteTargets
+	if len(targets) != 2 || targets[0].Address != "backend.internal:8443" || targets[0].ServerName != "" ||
+		targets[1].Address != "10.0.0.7:443" || targets[1].ServerName != "api.example.com" {
+		t.Fatalf("unexpected targets %+v", targets)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if d, _ := cfg.GetCertMonitorTimeout(); d != 5*time.Second {
+		t.Fatalf("expected 5s timeout, got %v", d)
+	}
+
+	cfg.CertMonitor.RemoteTargets = []RemoteCertTarget{{Address: "backend.internal"}}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected an address without a port to be rejected")
+	}
+	cfg.CertMonitor.RemoteTargets = nil
+	cfg.CertMonitor.Timeout = "0s"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected a zero timeout to be rejected")
+	}
 }
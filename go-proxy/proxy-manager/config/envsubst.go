@@ -0,0 +1,85 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envNamePattern matches the environment variable names ${...} may reference
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// readConfigFile reads a YAML config file and expands environment variables
+// in it
+func readConfigFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	expanded, err := expandEnv(data, os.LookupEnv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return expanded, nil
+}
+
+// expandEnv replaces ${NAME} with the value of the environment variable NAME
+// and ${NAME:-default} with its value, or default when it is unset or empty.
+// $$ is a literal $, and a $ not followed by { or $ is kept as is, so regexes
+// and password hashes need no escaping. A variable without a default that is
+// not set is an error, since an empty secret or host is rarely intended.
+func expandEnv(data []byte, lookup func(string) (string, bool)) ([]byte, error) {
+	if !bytes.ContainsRune(data, '$') {
+		return data, nil
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	line := 1
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c == '\n' {
+			line++
+		}
+		if c != '$' || i+1 == len(data) {
+			out.WriteByte(c)
+			continue
+		}
+		switch data[i+1] {
+		case '$':
+			out.WriteByte('$')
+			i++
+			continue
+		case '{':
+		default:
+			out.WriteByte(c)
+			continue
+		}
+
+		end := bytes.IndexByte(data[i+2:], '}')
+		if end < 0 || bytes.IndexByte(data[i+2:i+2+end], '\n') >= 0 {
+			return nil, fmt.Errorf("line %d: unterminated ${", line)
+		}
+		ref := string(data[i+2 : i+2+end])
+		name, def, hasDefault := ref, "", false
+		if sep := strings.Index(ref, ":-"); sep >= 0 {
+			name, def, hasDefault = ref[:sep], ref[sep+2:], true
+		}
+		if !envNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("line %d: invalid environment variable name %q", line, name)
+		}
+
+		value, set := lookup(name)
+		switch {
+		case hasDefault && value == "":
+			value = def
+		case !set:
+			return nil, fmt.Errorf("line %d: environment variable %s is not set and has no default", line, name)
+		}
+		out.WriteString(value)
+		i += 2 + end
+	}
+	return out.Bytes(), nil
+}
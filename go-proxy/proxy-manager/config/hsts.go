@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HSTSPreloadMinAge is the max-age the HSTS preload list requires (1 year)
+const HSTSPreloadMinAge = 31536000
+
+// CheckHSTS parses a Strict-Transport-Security value. Values browsers would
+// ignore are errors. includeSubDomains or preload with a max-age below a
+// year, and preload without includeSubDomains, only produce warnings. An
+// empty value disables the header and is valid.
+func CheckHSTS(value string) (warnings []string, err error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	maxAge := -1
+	var subDomains, preload bool
+	for _, directive := range strings.Split(value, ";") {
+		directive = strings.TrimSpace(directive)
+		name, arg, _ := strings.Cut(directive, "=")
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+		case "max-age":
+			n, err := strconv.Atoi(strings.Trim(strings.TrimSpace(arg), `"`))
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("Strict-Transport-Security: invalid max-age %q", arg)
+			}
+			maxAge = n
+		case "includesubdomains":
+			subDomains = true
+		case "preload":
+			preload = true
+		default:
+			return nil, fmt.Errorf("Strict-Transport-Security: unknown directive %q", directive)
+		}
+	}
+	if maxAge < 0 {
+		return nil, fmt.Errorf("Strict-Transport-Security: max-age is required")
+	}
+
+	if (subDomains || preload) && maxAge < HSTSPreloadMinAge {
+		warnings = append(warnings, fmt.Sprintf("Strict-Transport-Security: includeSubDomains/preload with max-age=%d, at least %d (1 year) is needed for preloading", maxAge, HSTSPreloadMinAge))
+	}
+	if preload && !subDomains {
+		warnings = append(warnings, "Strict-Transport-Security: preload requires includeSubDomains")
+	}
+	return warnings, nil
+}
+
+// checkHeaders checks the security header values in a headers map
+func checkHeaders(headers map[string]string) (warnings []string, err error) {
+	for name, value := range headers {
+		if strings.EqualFold(name, "Strict-Transport-Security") {
+			return CheckHSTS(value)
+		}
+	}
+	return nil, nil
+}
+
+// HeaderWarnings returns the warnings for defaults.headers
+func (c *GlobalConfig) HeaderWarnings() []string {
+	warnings, _ := checkHeaders(c.Defaults.Headers)
+	return warnings
+}
+
+// HeaderWarnings returns the warnings for the site and route headers
+func (c *SiteConfig) HeaderWarnings() []string {
+	warnings, _ := checkHeaders(c.Headers)
+	for i, route := range c.Routes {
+		w, _ := checkHeaders(route.Headers)
+		for _, warning := range w {
+			warnings = append(warnings, fmt.Sprintf("route %d: %s", i, warning))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// includeKey is the top-level key listing further files to merge into the
+// global config
+const includeKey = "include"
+
+// ReadGlobalYAML reads the global config at path and returns it as a single
+// YAML document, with ${VAR} references in every file expanded from the
+// environment first. A file without an include key is returned as is.
+// Otherwise the files it includes are merged over it in order, each after its
+// own includes, so later files override earlier ones: mappings are merged key
+// by key, while scalars and lists are replaced whole. A key that is a mapping
+// in one file and a scalar or list in another is a conflict.
+//
+// Include paths are relative to the including file and may be globs such as
+// conf.d/*.yaml, whose matches are merged in name order. A glob matching
+// nothing is skipped, but a plain path that does not exist is an error.
+func ReadGlobalYAML(path string) ([]byte, error) {
+	data, err := readConfigFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	if _, ok := doc[includeKey]; !ok {
+		return data, nil
+	}
+
+	m := &includeMerger{merged: map[string]interface{}{}, origin: map[string]string{}}
+	if err := m.mergeFile(path, doc, nil); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(m.merged)
+}
+
+// includeMerger merges the global config and its includes into one mapping
+type includeMerger struct {
+	merged map[string]interface{}
+	origin map[string]string // Key path -> file that last set it
+}
+
+// mergeFile merges doc, read from path, and then its includes. stack holds
+// the files currently being merged to catch include cycles.
+func (m *includeMerger) mergeFile(path string, doc map[string]interface{}, stack []string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	for _, parent := range stack {
+		if parent == abs {
+			return fmt.Errorf("include cycle: %s", strings.Join(append(stack, abs), " -> "))
+		}
+	}
+	stack = append(stack, abs)
+
+	includes, err := includePaths(path, doc[includeKey])
+	if err != nil {
+		return err
+	}
+	delete(doc, includeKey)
+	if err := m.merge(m.merged, doc, "", path); err != nil {
+		return err
+	}
+
+	for _, include := range includes {
+		data, err := readConfigFile(include)
+		if err != nil {
+			return fmt.Errorf("failed to read %s included from %s: %w", include, path, err)
+		}
+		var included map[string]interface{}
+		if err := yaml.Unmarshal(data, &included); err != nil {
+			return fmt.Errorf("failed to parse YAML in %s: %w", include, err)
+		}
+		if err := m.mergeFile(include, included, stack); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge copies src over dst, recursing into mappings present in both
+func (m *includeMerger) merge(dst, src map[string]interface{}, prefix, file string) error {
+	for key, value := range src {
+		keyPath := key
+		if prefix != "" {
+			keyPath = prefix + "." + key
+		}
+		srcMap, srcIsMap := value.(map[string]interface{})
+		existing, exists := dst[key]
+		if exists && existing != nil && value != nil {
+			dstMap, dstIsMap := existing.(map[string]interface{})
+			if srcIsMap != dstIsMap {
+				return fmt.Errorf("conflicting %s: %s in %s but %s in %s",
+					keyPath, yamlKind(existing), m.origin[keyPath], yamlKind(value), file)
+			}
+			if srcIsMap {
+				m.origin[keyPath] = file
+				if err := m.merge(dstMap, srcMap, keyPath, file); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		dst[key] = value
+		m.recordOrigin(keyPath, value, file)
+	}
+	return nil
+}
+
+// recordOrigin notes file as the source of keyPath and everything below it
+func (m *includeMerger) recordOrigin(keyPath string, value interface{}, file string) {
+	m.origin[keyPath] = file
+	if nested, ok := value.(map[string]interface{}); ok {
+		for key, child := range nested {
+			m.recordOrigin(keyPath+"."+key, child, file)
+		}
+	}
+}
+
+// includePaths returns the files named by an include value, a path or a list
+// of paths relative to the including file
+func includePaths(from string, value interface{}) ([]string, error) {
+	var patterns []string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		patterns = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			pattern, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: include entries must be file paths", from)
+			}
+			patterns = append(patterns, pattern)
+		}
+	default:
+		return nil, fmt.Errorf("%s: include must be a file path or a list of file paths", from)
+	}
+
+	var paths []string
+	dir := filepath.Dir(from)
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return nil, fmt.Errorf("%s: include entries must not be empty", from)
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		if !strings.ContainsAny(pattern, "*?[") {
+			paths = append(paths, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid include pattern %q: %w", from, pattern, err)
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// yamlKind names the YAML type of a decoded value for conflict errors
+func yamlKind(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "a mapping"
+	case []interface{}:
+		return "a list"
+	default:
+		return "a scalar"
+	}
+}
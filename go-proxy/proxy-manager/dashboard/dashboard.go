@@ -29,14 +29,16 @@ type SystemStats struct {
 
 // RouteStatus holds per-route monitoring data
 type RouteStatus struct {
-	Domain        string  `json:"domain"`
-	Path          string  `json:"path"`
-	Backend       string  `json:"backend"`
-	Status        string  `json:"status"` // healthy, degraded, down, maintenance, draining
-	Requests24h   int64   `json:"requests_24h"`
-	AvgResponseMs float64 `json:"avg_response_time"` // Changed to milliseconds as float
-	ErrorRate     float64 `json:"error_rate"`
-	LastError     string  `json:"last_error,omitempty"`
+	Domain        string            `json:"domain"`
+	Path          string            `json:"path"`
+	Backend       string            `json:"backend"`
+	Source        string            `json:"source"` // static (site YAML) or registry
+	Labels        map[string]string `json:"labels,omitempty"`
+	Status        string            `json:"status"` // healthy, degraded, down, maintenance, draining, shadowed
+	Requests24h   int64             `json:"requests_24h"`
+	AvgResponseMs float64           `json:"avg_response_time"` // Changed to milliseconds as float
+	ErrorRate     float64           `json:"error_rate"`
+	LastError     string            `json:"last_error,omitempty"`
 	// Maintenance mode
 	InMaintenance      bool   `json:"in_maintenance"`
 	MaintenancePageURL string `json:"maintenance_page_url,omitempty"`
@@ -168,16 +170,40 @@ func (d *Dashboard) handleStats(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stats)
 }
 
-// handleRoutes returns route status information
+// handleRoutes returns route status information. Each ?label=key=value
+// keeps only routes with that label, ?label=key routes with the key at all.
 func (d *Dashboard) handleRoutes(w http.ResponseWriter, r *http.Request) {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
-	routes := d.getRouteStatuses()
+	routes := filterRoutesByLabel(d.getRouteStatuses(), r.URL.Query()["label"])
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(routes)
 }
 
+// filterRoutesByLabel returns the routes matching every selector
+func filterRoutesByLabel(routes []RouteStatus, selectors []string) []RouteStatus {
+	if len(selectors) == 0 {
+		return routes
+	}
+	filtered := make([]RouteStatus, 0, len(routes))
+	for _, route := range routes {
+		matches := true
+		for _, selector := range selectors {
+			key, value, hasValue := strings.Cut(selector, "=")
+			got, ok := route.Labels[key]
+			if !ok || (hasValue && got != value) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			filtered = append(filtered, route)
+		}
+	}
+	return filtered
+}
+
 // handleCertificates returns certificate status
 func (d *Dashboard) handleCertificates(w http.ResponseWriter, r *http.Request) {
 	d.mu.RLock()
@@ -297,7 +323,9 @@ func (d *Dashboard) getRouteStatuses() []RouteStatus {
 	for _, s := range summaries {
 		for _, domain := range s.Domains {
 			status := "healthy"
-			if !s.Enabled {
+			if s.Shadowed {
+				status = "shadowed"
+			} else if !s.Enabled {
 				status = "disabled"
 			} else if s.InMaintenance {
 				status = "maintenance"
@@ -311,6 +339,8 @@ func (d *Dashboard) getRouteStatuses() []RouteStatus {
 				Domain:             domain,
 				Path:               s.Path,
 				Backend:            s.BackendURL,
+				Source:             string(s.Source),
+				Labels:             s.Labels,
 				Status:             status,
 				Requests24h:        int64(s.Requests),
 				AvgResponseMs:      float64(s.AvgDuration.Nanoseconds()) / 1e6, // Convert nanoseconds to milliseconds
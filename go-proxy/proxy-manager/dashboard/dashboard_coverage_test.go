@@ -96,6 +96,34 @@ func TestHandleRoutes(t *testing.T) {
 	}
 }
 
+func TestFilterRoutesByLabel(t *testing.T) {
+	routes := []RouteStatus{
+		{Domain: "a.example.com", Labels: map[string]string{"team": "payments", "env": "prod"}},
+		{Domain: "b.example.com", Labels: map[string]string{"team": "search"}},
+		{Domain: "c.example.com"},
+	}
+	domains := func(selectors ...string) []string {
+		var out []string
+		for _, route := range filterRoutesByLabel(routes, selectors) {
+			out = append(out, route.Domain)
+		}
+		return out
+	}
+
+	if got := domains(); len(got) != 3 {
+		t.Errorf("Expected all routes without a filter, got %v", got)
+	}
+	if got := domains("team=payments"); len(got) != 1 || got[0] != "a.example.com" {
+		t.Errorf("Expected a.example.com for team=payments, got %v", got)
+	}
+	if got := domains("team"); len(got) != 2 {
+		t.Errorf("Expected routes with a team label, got %v", got)
+	}
+	if got := domains("team=payments", "env=staging"); len(got) != 0 {
+		t.Errorf("Expected every selector to apply, got %v", got)
+	}
+}
+
 func TestHandleCertificates(t *testing.T) {
 	d := New(nil, nil, nil, nil, true)
 
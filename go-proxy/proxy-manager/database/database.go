@@ -3,6 +3,8 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"net/url"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -12,6 +14,12 @@ import (
 // DB wraps the SQLite database connection
 type DB struct {
 	*sql.DB
+	path string
+
+	// Cached row counts for Stats
+	statsMu     sync.Mutex
+	tableCounts map[string]int64
+	countedAt   time.Time
 }
 
 // AccessLogEntry represents an HTTP access log entry
@@ -32,6 +40,13 @@ type AccessLogEntry struct {
 	BytesReceived  uint64 `json:"bytes_received"`
 	Protocol       string `json:"protocol"`
 	Error          string `json:"error,omitempty"`
+	RequestID      string `json:"request_id,omitempty"`
+
+	// Upstream breakdown of ResponseTimeMs; zero when the request was not
+	// proxied. Connect and TLS are zero on a reused connection.
+	UpstreamConnectMs float64 `json:"upstream_connect_ms,omitempty"`
+	UpstreamTLSMs     float64 `json:"upstream_tls_ms,omitempty"`
+	UpstreamTTFBMs    float64 `json:"upstream_ttfb_ms,omitempty"`
 }
 
 // WebSocketConnection represents a WebSocket session entry
@@ -60,251 +75,85 @@ type HealthCheckResult struct {
 	Error      string `json:"error,omitempty"`
 }
 
+// Options tunes the SQLite connection pool
+type Options struct {
+	BusyTimeout  time.Duration // How long a writer waits for a lock before "database is locked"
+	MaxOpenConns int           // WAL allows concurrent readers alongside one writer
+	MaxIdleConns int
+}
+
+// DefaultOptions returns the settings used by Open
+func DefaultOptions() Options {
+	return Options{
+		BusyTimeout:  5 * time.Second,
+		MaxOpenConns: 4,
+		MaxIdleConns: 4,
+	}
+}
+
 // Open opens a SQLite database connection and initializes schema
 func Open(path string) (*DB, error) {
+	return OpenWithOptions(path, DefaultOptions())
+}
+
+// OpenWithOptions opens a SQLite database with the given pool settings.
+// Every pooled connection gets WAL mode, busy_timeout and foreign keys via
+// DSN pragmas, and transactions take the write lock up front so concurrent
+// writers wait on busy_timeout instead of failing.
+func OpenWithOptions(path string, opts Options) (*DB, error) {
 	log.Info().Str("path", path).Msg("Opening database")
 
-	db, err := sql.Open("sqlite", path)
+	if opts.MaxOpenConns <= 0 {
+		opts.MaxOpenConns = 1
+	}
+	if opts.MaxIdleConns <= 0 || opts.MaxIdleConns > opts.MaxOpenConns {
+		opts.MaxIdleConns = opts.MaxOpenConns
+	}
+	// Each connection to :memory: is a separate database
+	if path == ":memory:" {
+		opts.MaxOpenConns, opts.MaxIdleConns = 1, 1
+	}
+
+	db, err := sql.Open("sqlite", path+"?"+dsnParams(opts).Encode())
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Configure connection pool
-	db.SetMaxOpenConns(1) // SQLite only supports 1 writer
-	db.SetMaxIdleConns(1)
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
 	db.SetConnMaxLifetime(0)
 
 	// Test connection
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	wrapper := &DB{DB: db}
+	wrapper := &DB{DB: db, path: path}
 
-	// Initialize schema
-	if err := wrapper.initSchema(); err != nil {
+	// Bring the schema up to date
+	if err := wrapper.migrate(schemaMigrations); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
 	}
 
-	log.Info().Msg("Database initialized successfully")
+	log.Info().
+		Int("max_open_conns", opts.MaxOpenConns).
+		Dur("busy_timeout", opts.BusyTimeout).
+		Msg("Database initialized successfully")
 	return wrapper, nil
 }
 
-// initSchema creates all required tables
-func (db *DB) initSchema() error {
-	schema := `
-	-- Enable foreign keys
-	PRAGMA foreign_keys = ON;
-	PRAGMA journal_mode = WAL;
-
-	-- Service Registry
-	CREATE TABLE IF NOT EXISTS services (
-		service_id INTEGER PRIMARY KEY AUTOINCREMENT,
-		service_name TEXT NOT NULL,
-		container_id TEXT,
-		ip_address TEXT,
-		port INTEGER NOT NULL,
-		protocol TEXT DEFAULT 'http',
-		status TEXT DEFAULT 'unknown',
-		last_check INTEGER,
-		metadata TEXT,
-		UNIQUE(service_name, port)
-	);
-
-	-- Route Configurations
-	CREATE TABLE IF NOT EXISTS routes (
-		route_id INTEGER PRIMARY KEY AUTOINCREMENT,
-		domain TEXT NOT NULL,
-		path TEXT DEFAULT '/',
-		service_id INTEGER,
-		backend_url TEXT NOT NULL,
-		enabled INTEGER DEFAULT 1,
-		config_hash TEXT,
-		created_at INTEGER DEFAULT (strftime('%s', 'now')),
-		updated_at INTEGER DEFAULT (strftime('%s', 'now')),
-		FOREIGN KEY(service_id) REFERENCES services(service_id)
-	);
-	CREATE INDEX IF NOT EXISTS idx_routes_domain ON routes(domain);
-	CREATE INDEX IF NOT EXISTS idx_routes_enabled ON routes(enabled);
-
-	-- Time-Series Metrics
-	CREATE TABLE IF NOT EXISTS metrics (
-		metric_id INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp INTEGER NOT NULL,
-		route_id INTEGER,
-		service_id INTEGER,
-		metric_type TEXT NOT NULL,
-		value REAL NOT NULL,
-		labels TEXT,
-		FOREIGN KEY(route_id) REFERENCES routes(route_id),
-		FOREIGN KEY(service_id) REFERENCES services(service_id)
-	);
-	CREATE INDEX IF NOT EXISTS idx_metrics_timestamp ON metrics(timestamp);
-	CREATE INDEX IF NOT EXISTS idx_metrics_service ON metrics(service_id);
-	CREATE INDEX IF NOT EXISTS idx_metrics_type ON metrics(metric_type);
-
-	-- Access log (HTTP requests)
-	CREATE TABLE IF NOT EXISTS access_log (
-		timestamp INTEGER,
-		domain TEXT,
-		method TEXT,
-		path TEXT,
-		query TEXT,
-		status INTEGER,
-		response_time_ms INTEGER,
-		backend TEXT,
-		backend_ip TEXT,
-		client_ip TEXT,
-		user_agent TEXT,
-		referer TEXT,
-		bytes_sent INTEGER,
-		bytes_received INTEGER,
-		protocol TEXT,
-		error TEXT
-	);
-	CREATE INDEX IF NOT EXISTS idx_access_log_ts ON access_log(timestamp);
-	CREATE INDEX IF NOT EXISTS idx_access_log_status ON access_log(status);
-
-	-- Request Logs
-	CREATE TABLE IF NOT EXISTS request_logs (
-		log_id INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp INTEGER NOT NULL,
-		route_id INTEGER,
-		service_id INTEGER,
-		request_id TEXT NOT NULL,
-		client_ip TEXT NOT NULL,
-		method TEXT NOT NULL,
-		path TEXT NOT NULL,
-		status_code INTEGER,
-		response_time_ms INTEGER,
-		bytes_sent INTEGER,
-		bytes_received INTEGER,
-		user_agent TEXT,
-		referer TEXT,
-		error_message TEXT,
-		FOREIGN KEY(route_id) REFERENCES routes(route_id),
-		FOREIGN KEY(service_id) REFERENCES services(service_id)
-	);
-	CREATE INDEX IF NOT EXISTS idx_logs_timestamp ON request_logs(timestamp);
-	CREATE INDEX IF NOT EXISTS idx_logs_status ON request_logs(status_code);
-	CREATE INDEX IF NOT EXISTS idx_logs_request_id ON request_logs(request_id);
-	CREATE INDEX IF NOT EXISTS idx_logs_client_ip ON request_logs(client_ip);
-
-	-- Health Checks
-	CREATE TABLE IF NOT EXISTS health_checks (
-		check_id INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp INTEGER NOT NULL,
-		service_id INTEGER NOT NULL,
-		success INTEGER NOT NULL,
-		response_time_ms INTEGER,
-		error_message TEXT,
-		FOREIGN KEY(service_id) REFERENCES services(service_id)
-	);
-	CREATE INDEX IF NOT EXISTS idx_health_timestamp ON health_checks(timestamp);
-	CREATE INDEX IF NOT EXISTS idx_health_service ON health_checks(service_id);
-
-	-- Certificates
-	CREATE TABLE IF NOT EXISTS certificates (
-		cert_id INTEGER PRIMARY KEY AUTOINCREMENT,
-		domain TEXT NOT NULL UNIQUE,
-		cert_path TEXT NOT NULL,
-		key_path TEXT NOT NULL,
-		issuer TEXT,
-		subject TEXT,
-		not_before INTEGER,
-		not_after INTEGER,
-		san_domains TEXT,
-		auto_renew INTEGER DEFAULT 1,
-		last_check INTEGER,
-		created_at INTEGER DEFAULT (strftime('%s', 'now')),
-		updated_at INTEGER DEFAULT (strftime('%s', 'now'))
-	);
-	CREATE INDEX IF NOT EXISTS idx_certs_domain ON certificates(domain);
-	CREATE INDEX IF NOT EXISTS idx_certs_expiry ON certificates(not_after);
-
-	-- Rate Limits
-	CREATE TABLE IF NOT EXISTS rate_limits (
-		ip_address TEXT NOT NULL,
-		route_id INTEGER NOT NULL,
-		window_start INTEGER NOT NULL,
-		request_count INTEGER DEFAULT 1,
-		last_request INTEGER NOT NULL,
-		PRIMARY KEY (ip_address, route_id, window_start),
-		FOREIGN KEY(route_id) REFERENCES routes(route_id)
-	);
-	CREATE INDEX IF NOT EXISTS idx_ratelimit_window ON rate_limits(window_start);
-
-	-- Rate Limit Violations
-	CREATE TABLE IF NOT EXISTS rate_limit_violations (
-		violation_id INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp INTEGER NOT NULL,
-		ip_address TEXT NOT NULL,
-		route_id INTEGER,
-		request_count INTEGER,
-		limit_value INTEGER,
-		action TEXT
-	);
-	CREATE INDEX IF NOT EXISTS idx_violations_timestamp ON rate_limit_violations(timestamp);
-	CREATE INDEX IF NOT EXISTS idx_violations_ip ON rate_limit_violations(ip_address);
-
-	-- WAF Blocks
-	CREATE TABLE IF NOT EXISTS waf_blocks (
-		block_id INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp INTEGER NOT NULL,
-		ip_address TEXT NOT NULL,
-		route_id INTEGER,
-		attack_type TEXT NOT NULL,
-		pattern_matched TEXT,
-		request_path TEXT,
-		request_method TEXT,
-		action TEXT
-	);
-	CREATE INDEX IF NOT EXISTS idx_waf_timestamp ON waf_blocks(timestamp);
-	CREATE INDEX IF NOT EXISTS idx_waf_ip ON waf_blocks(ip_address);
-	CREATE INDEX IF NOT EXISTS idx_waf_type ON waf_blocks(attack_type);
-
-	-- Audit Log
-	CREATE TABLE IF NOT EXISTS audit_log (
-		audit_id INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp INTEGER NOT NULL,
-		user TEXT,
-		action TEXT NOT NULL,
-		resource_type TEXT,
-		resource_id TEXT,
-		old_value TEXT,
-		new_value TEXT,
-		ip_address TEXT,
-		notes TEXT
-	);
-	CREATE INDEX IF NOT EXISTS idx_audit_timestamp ON audit_log(timestamp);
-	CREATE INDEX IF NOT EXISTS idx_audit_action ON audit_log(action);
-
-	-- WebSocket Connections
-	CREATE TABLE IF NOT EXISTS websocket_connections (
-		conn_id INTEGER PRIMARY KEY AUTOINCREMENT,
-		request_id TEXT NOT NULL,
-		route_id INTEGER,
-		client_ip TEXT NOT NULL,
-		connected_at INTEGER NOT NULL,
-		disconnected_at INTEGER,
-		bytes_sent INTEGER DEFAULT 0,
-		bytes_received INTEGER DEFAULT 0,
-		messages_sent INTEGER DEFAULT 0,
-		messages_received INTEGER DEFAULT 0,
-		close_reason TEXT,
-		FOREIGN KEY(route_id) REFERENCES routes(route_id)
-	);
-	CREATE INDEX IF NOT EXISTS idx_ws_connected ON websocket_connections(connected_at);
-	CREATE INDEX IF NOT EXISTS idx_ws_active ON websocket_connections(disconnected_at) WHERE disconnected_at IS NULL;
-	`
-
-	_, err := db.Exec(schema)
-	if err != nil {
-		return fmt.Errorf("failed to execute schema: %w", err)
-	}
-
-	return nil
+// dsnParams builds the modernc.org/sqlite query parameters for opts
+func dsnParams(opts Options) url.Values {
+	q := url.Values{}
+	q.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", opts.BusyTimeout.Milliseconds()))
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Add("_pragma", "synchronous(NORMAL)")
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Set("_txlock", "immediate")
+	return q
 }
 
 // LogRequest logs an HTTP request
@@ -427,11 +276,8 @@ func (db *DB) CleanupOldData(retentionDays int) error {
 		}
 	}
 
-	// Vacuum to reclaim space
-	if _, err := db.Exec("VACUUM"); err != nil {
-		log.Warn().Err(err).Msg("Failed to vacuum database")
-	}
-
+	// Space is reclaimed separately by Compact, which is opt-in since a full
+	// VACUUM rewrites the whole file and blocks writers while it runs
 	return nil
 }
 
@@ -529,33 +375,38 @@ func (db *DB) LogWAFBlock(ip, route, attackType, payload, userAgent string) erro
 	return nil
 }
 
-// LogAudit logs an audit event to the database
-func (db *DB) LogAudit(user, action, resourceType, resourceID, oldValue, newValue, ipAddress, metadata string) error {
+// LogAudit records an admin or control action. A zero Timestamp is set to
+// now.
+func (db *DB) LogAudit(entry AuditEntry) error {
+	if entry.Timestamp == 0 {
+		entry.Timestamp = time.Now().Unix()
+	}
 	query := `
 		INSERT INTO audit_log (
-			timestamp, user, action, resource_type,
-			resource_id, old_value, new_value, ip_address, metadata
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			timestamp, user, action, resource_type, resource_id,
+			old_value, new_value, ip_address, metadata, result
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err := db.Exec(
 		query,
-		time.Now().Unix(),
-		user,
-		action,
-		resourceType,
-		resourceID,
-		oldValue,
-		newValue,
-		ipAddress,
-		metadata,
+		entry.Timestamp,
+		entry.User,
+		entry.Action,
+		entry.ResourceType,
+		entry.ResourceID,
+		entry.OldValue,
+		entry.NewValue,
+		entry.IPAddress,
+		entry.Metadata,
+		entry.Result,
 	)
 
 	if err != nil {
 		log.Error().
 			Err(err).
-			Str("action", action).
-			Str("resource_type", resourceType).
+			Str("action", entry.Action).
+			Str("resource_type", entry.ResourceType).
 			Msg("Failed to log audit entry")
 		return err
 	}
@@ -566,43 +417,75 @@ func (db *DB) LogAudit(user, action, resourceType, resourceID, oldValue, newValu
 // AuditEntry represents an audit log entry
 type AuditEntry struct {
 	ID           int64  `json:"id"`
-	Timestamp    int64  `json:"timestamp"`
-	User         string `json:"user"`
+	Timestamp    int64  `json:"timestamp"` // Unix seconds
+	User         string `json:"user"`      // Authenticated principal
 	Action       string `json:"action"`
 	ResourceType string `json:"resource_type"`
 	ResourceID   string `json:"resource_id"`
 	OldValue     string `json:"old_value,omitempty"`
 	NewValue     string `json:"new_value,omitempty"`
 	IPAddress    string `json:"ip_address,omitempty"`
-	Metadata     string `json:"metadata,omitempty"`
+	Metadata     string `json:"metadata,omitempty"` // Parameters as JSON
+	Result       string `json:"result"`             // "ok" or the error
+}
+
+// AuditFilter selects audit entries; zero fields match everything
+type AuditFilter struct {
+	User         string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Result       string // "ok", or "error" for every failure
+	Since        time.Time
+	Until        time.Time
+	Limit        int // Default 100
 }
 
-// GetAuditLogs retrieves audit logs with optional filters
-func (db *DB) GetAuditLogs(limit int, action, resourceType string, since time.Time) ([]AuditEntry, error) {
+// GetAuditLogs returns the audit entries matching filter, newest first
+func (db *DB) GetAuditLogs(filter AuditFilter) ([]AuditEntry, error) {
 	query := `
-		SELECT id, timestamp, user, action, resource_type,
-		       resource_id, old_value, new_value, ip_address, metadata
+		SELECT id, timestamp, user, action, resource_type, resource_id,
+		       old_value, new_value, ip_address, metadata, result
 		FROM audit_log
 		WHERE 1=1
 	`
 	args := []interface{}{}
 
-	if action != "" {
-		query += " AND action = ?"
-		args = append(args, action)
+	for _, f := range []struct{ column, value string }{
+		{"user", filter.User},
+		{"action", filter.Action},
+		{"resource_type", filter.ResourceType},
+		{"resource_id", filter.ResourceID},
+	} {
+		if f.value != "" {
+			query += " AND " + f.column + " = ?"
+			args = append(args, f.value)
+		}
 	}
 
-	if resourceType != "" {
-		query += " AND resource_type = ?"
-		args = append(args, resourceType)
+	switch filter.Result {
+	case "":
+	case "error":
+		query += " AND result != 'ok'"
+	default:
+		query += " AND result = ?"
+		args = append(args, filter.Result)
 	}
 
-	if !since.IsZero() {
+	if !filter.Since.IsZero() {
 		query += " AND timestamp >= ?"
-		args = append(args, since.Unix())
+		args = append(args, filter.Since.Unix())
+	}
+	if !filter.Until.IsZero() {
+		query += " AND timestamp < ?"
+		args = append(args, filter.Until.Unix())
 	}
 
-	query += " ORDER BY timestamp DESC LIMIT ?"
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	query += " ORDER BY timestamp DESC, id DESC LIMIT ?"
 	args = append(args, limit)
 
 	rows, err := db.Query(query, args...)
@@ -611,7 +494,7 @@ func (db *DB) GetAuditLogs(limit int, action, resourceType string, since time.Ti
 	}
 	defer rows.Close()
 
-	var entries []AuditEntry
+	entries := []AuditEntry{}
 	for rows.Next() {
 		var entry AuditEntry
 		err := rows.Scan(
@@ -625,6 +508,7 @@ func (db *DB) GetAuditLogs(limit int, action, resourceType string, since time.Ti
 			&entry.NewValue,
 			&entry.IPAddress,
 			&entry.Metadata,
+			&entry.Result,
 		)
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to scan audit entry")
@@ -633,7 +517,7 @@ func (db *DB) GetAuditLogs(limit int, action, resourceType string, since time.Ti
 		entries = append(entries, entry)
 	}
 
-	return entries, nil
+	return entries, rows.Err()
 }
 
 // CleanupAccessLogs removes old access logs based on retention policy
@@ -909,8 +793,9 @@ func (db *DB) LogAccessRequest(entry AccessLogEntry) error {
 		timestamp, domain, method, path, query, status, 
 		response_time_ms, backend, backend_ip, client_ip, 
 		user_agent, referer, bytes_sent, bytes_received, 
-		protocol, error
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		protocol, error, request_id,
+		upstream_connect_ms, upstream_tls_ms, upstream_ttfb_ms
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err := db.Exec(query,
@@ -930,11 +815,71 @@ func (db *DB) LogAccessRequest(entry AccessLogEntry) error {
 		entry.BytesReceived,
 		entry.Protocol,
 		entry.Error,
+		entry.RequestID,
+		entry.UpstreamConnectMs,
+		entry.UpstreamTLSMs,
+		entry.UpstreamTTFBMs,
 	)
 
 	return err
 }
 
+// LogAccessRequests inserts a batch of access log entries in one transaction
+func (db *DB) LogAccessRequests(entries []AccessLogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+	INSERT INTO access_log (
+		timestamp, domain, method, path, query, status,
+		response_time_ms, backend, backend_ip, client_ip,
+		user_agent, referer, bytes_sent, bytes_received,
+		protocol, error, request_id,
+		upstream_connect_ms, upstream_tls_ms, upstream_ttfb_ms
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, entry := range entries {
+		if _, err := stmt.Exec(
+			entry.Timestamp,
+			entry.Domain,
+			entry.Method,
+			entry.Path,
+			entry.Query,
+			entry.Status,
+			entry.ResponseTimeMs,
+			entry.Backend,
+			entry.BackendIP,
+			entry.ClientIP,
+			entry.UserAgent,
+			entry.Referer,
+			entry.BytesSent,
+			entry.BytesReceived,
+			entry.Protocol,
+			entry.Error,
+			entry.RequestID,
+			entry.UpstreamConnectMs,
+			entry.UpstreamTLSMs,
+			entry.UpstreamTTFBMs,
+		); err != nil {
+			return fmt.Errorf("failed to insert access log entry: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
 // GetRecentRequests returns the most recent N access log entries
 func (db *DB) GetRecentRequests(limit int) ([]AccessLogEntry, error) {
 	query := `
@@ -942,7 +887,7 @@ func (db *DB) GetRecentRequests(limit int) ([]AccessLogEntry, error) {
 		timestamp, domain, method, path, query, status, 
 		response_time_ms, backend, backend_ip, client_ip, 
 		user_agent, referer, bytes_sent, bytes_received, 
-		protocol, error
+		protocol, error, request_id
 	FROM access_log
 	ORDER BY timestamp DESC
 	LIMIT ?
@@ -957,7 +902,7 @@ func (db *DB) GetRecentRequests(limit int) ([]AccessLogEntry, error) {
 	var entries []AccessLogEntry
 	for rows.Next() {
 		var entry AccessLogEntry
-		var query, backendIP, userAgent, referer, protocol, errMsg sql.NullString
+		var query, backendIP, userAgent, referer, protocol, errMsg, requestID sql.NullString
 
 		err := rows.Scan(
 			&entry.Timestamp,
@@ -976,6 +921,7 @@ func (db *DB) GetRecentRequests(limit int) ([]AccessLogEntry, error) {
 			&entry.BytesReceived,
 			&protocol,
 			&errMsg,
+			&requestID,
 		)
 		if err != nil {
 			return nil, err
@@ -999,6 +945,9 @@ func (db *DB) GetRecentRequests(limit int) ([]AccessLogEntry, error) {
 		if errMsg.Valid {
 			entry.Error = errMsg.String
 		}
+		if requestID.Valid {
+			entry.RequestID = requestID.String
+		}
 
 		entries = append(entries, entry)
 	}
@@ -1013,7 +962,7 @@ func (db *DB) GetRequestsByRoute(route string, limit int) ([]AccessLogEntry, err
 		timestamp, domain, method, path, query, status, 
 		response_time_ms, backend, backend_ip, client_ip, 
 		user_agent, referer, bytes_sent, bytes_received, 
-		protocol, error
+		protocol, error, request_id
 	FROM access_log
 	WHERE path = ? OR domain = ?
 	ORDER BY timestamp DESC
@@ -1029,7 +978,7 @@ func (db *DB) GetRequestsByRoute(route string, limit int) ([]AccessLogEntry, err
 	var entries []AccessLogEntry
 	for rows.Next() {
 		var entry AccessLogEntry
-		var query, backendIP, userAgent, referer, protocol, errMsg sql.NullString
+		var query, backendIP, userAgent, referer, protocol, errMsg, requestID sql.NullString
 
 		err := rows.Scan(
 			&entry.Timestamp,
@@ -1048,6 +997,7 @@ func (db *DB) GetRequestsByRoute(route string, limit int) ([]AccessLogEntry, err
 			&entry.BytesReceived,
 			&protocol,
 			&errMsg,
+			&requestID,
 		)
 		if err != nil {
 			return nil, err
@@ -1071,6 +1021,9 @@ func (db *DB) GetRequestsByRoute(route string, limit int) ([]AccessLogEntry, err
 		if errMsg.Valid {
 			entry.Error = errMsg.String
 		}
+		if requestID.Valid {
+			entry.RequestID = requestID.String
+		}
 
 		entries = append(entries, entry)
 	}
@@ -1085,7 +1038,7 @@ func (db *DB) GetErrorRequests(limit int) ([]AccessLogEntry, error) {
 		timestamp, domain, method, path, query, status, 
 		response_time_ms, backend, backend_ip, client_ip, 
 		user_agent, referer, bytes_sent, bytes_received, 
-		protocol, error
+		protocol, error, request_id
 	FROM access_log
 	WHERE status >= 400
 	ORDER BY timestamp DESC
@@ -1101,7 +1054,7 @@ func (db *DB) GetErrorRequests(limit int) ([]AccessLogEntry, error) {
 	var entries []AccessLogEntry
 	for rows.Next() {
 		var entry AccessLogEntry
-		var query, backendIP, userAgent, referer, protocol, errMsg sql.NullString
+		var query, backendIP, userAgent, referer, protocol, errMsg, requestID sql.NullString
 
 		err := rows.Scan(
 			&entry.Timestamp,
@@ -1120,6 +1073,7 @@ func (db *DB) GetErrorRequests(limit int) ([]AccessLogEntry, error) {
 			&entry.BytesReceived,
 			&protocol,
 			&errMsg,
+			&requestID,
 		)
 		if err != nil {
 			return nil, err
@@ -1143,6 +1097,9 @@ func (db *DB) GetErrorRequests(limit int) ([]AccessLogEntry, error) {
 		if errMsg.Valid {
 			entry.Error = errMsg.String
 		}
+		if requestID.Valid {
+			entry.RequestID = requestID.String
+		}
 
 		entries = append(entries, entry)
 	}
@@ -1,8 +1,14 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -70,11 +76,9 @@ func TestOpenAndBasicOps(t *testing.T) {
 		t.Fatalf("CleanupOldData failed: %v", err)
 	}
 
-	// Exercise cleanup helpers with test tables (drop and recreate audit_log to ensure ID column)
-	_, _ = db.Exec(`DROP TABLE IF EXISTS audit_log`)
+	// Exercise cleanup helpers with test tables
 	_, _ = db.Exec(`CREATE TABLE IF NOT EXISTS waf_blocks (timestamp INTEGER, ip_address TEXT, route TEXT, attack_type TEXT, pattern_matched TEXT, request_path TEXT, request_method TEXT, action TEXT)`)
 	_, _ = db.Exec(`CREATE TABLE IF NOT EXISTS rate_limit_violations (timestamp INTEGER, ip_address TEXT, route TEXT, request_count INTEGER, limit_value INTEGER, action TEXT)`)
-	_, _ = db.Exec(`CREATE TABLE audit_log (id INTEGER PRIMARY KEY AUTOINCREMENT, timestamp INTEGER, user TEXT, action TEXT, resource_type TEXT, resource_id TEXT, old_value TEXT, new_value TEXT, ip_address TEXT, metadata TEXT)`)
 	_, _ = db.Exec(`INSERT INTO waf_blocks (timestamp, ip_address, route, attack_type, action) VALUES (?, '1.1.1.1', '/', 'xss', 'block')`, time.Now().AddDate(0, 0, -100).Unix())
 	_, _ = db.Exec(`INSERT INTO rate_limit_violations (timestamp, ip_address, route, request_count, limit_value, action) VALUES (?, '1.1.1.1', '/', 10, 5, 'block')`, time.Now().AddDate(0, 0, -100).Unix())
 	_, _ = db.Exec(`INSERT INTO audit_log (timestamp, user, action, resource_type, resource_id, metadata) VALUES (?, 'u', 'act', 'type', 'id', '{}')`, time.Now().AddDate(0, 0, -100).Unix())
@@ -89,20 +93,482 @@ func TestOpenAndBasicOps(t *testing.T) {
 		t.Fatalf("CleanupMetrics failed: %v", err)
 	}
 
-	// GetAuditLogs with test table
-	if _, err := db.GetAuditLogs(10, "", "", time.Time{}); err != nil {
-		t.Fatalf("GetAuditLogs failed: %v", err)
+	// The old audit row is gone; new entries are recorded and filtered
+	if err := db.LogAudit(AuditEntry{User: "admin", Action: "circuit_breaker.force", ResourceType: "route", ResourceID: "ex/api", Metadata: `{"mode":"open"}`, Result: "ok"}); err != nil {
+		t.Fatalf("LogAudit failed: %v", err)
 	}
-
-	// Functions with known schema mismatches should return errors; exercise paths for coverage
-	// LogRateLimitViolation and LogWAFBlock errors already covered; drop expectations
-	// LogAudit should succeed now that we have proper schema
-	if err := db.LogAudit("user", "action", "type", "id", "old", "new", "ip", "meta"); err != nil {
+	if err := db.LogAudit(AuditEntry{User: "svc", Action: "MAINT_ENTER", Result: "error: ROUTE_NOT_FOUND"}); err != nil {
 		t.Fatalf("LogAudit failed: %v", err)
 	}
+	all, err := db.GetAuditLogs(AuditFilter{Limit: 10})
+	if err != nil || len(all) != 2 || all[0].Action != "MAINT_ENTER" {
+		t.Fatalf("GetAuditLogs = %+v, %v; want both entries newest first", all, err)
+	}
+	failed, err := db.GetAuditLogs(AuditFilter{Result: "error"})
+	if err != nil || len(failed) != 1 || failed[0].User != "svc" {
+		t.Fatalf("expected only the failed entry, got %+v, %v", failed, err)
+	}
+	byUser, err := db.GetAuditLogs(AuditFilter{User: "admin", Since: time.Now().Add(-time.Hour)})
+	if err != nil || len(byUser) != 1 || byUser[0].ResourceID != "ex/api" || byUser[0].Result != "ok" {
+		t.Fatalf("expected the admin entry, got %+v, %v", byUser, err)
+	}
 
 	// Ensure db file exists
 	if _, err := os.Stat(dbPath); err != nil {
 		t.Fatalf("db file should exist: %v", err)
 	}
 }
+
+func TestOpenAppliesConnectionPragmas(t *testing.T) {
+	db, err := OpenWithOptions(filepath.Join(t.TempDir(), "pragmas.db"), Options{BusyTimeout: 2 * time.Second, MaxOpenConns: 3})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+
+	if got := db.DB.Stats().MaxOpenConnections; got != 3 {
+		t.Fatalf("expected 3 max open conns, got %d", got)
+	}
+
+	// Check several pooled connections, not just the one used for the schema
+	for i := 0; i < 3; i++ {
+		var mode string
+		var timeout int
+		if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+			t.Fatalf("journal_mode: %v", err)
+		}
+		if err := db.QueryRow("PRAGMA busy_timeout").Scan(&timeout); err != nil {
+			t.Fatalf("busy_timeout: %v", err)
+		}
+		if mode != "wal" || timeout != 2000 {
+			t.Fatalf("expected wal/2000, got %s/%d", mode, timeout)
+		}
+	}
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "concurrent.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+
+	const writers, perWriter = 8, 50
+	errs := make(chan error, writers*perWriter*2)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if err := db.RecordMetric(&Metric{Timestamp: int64(i), Type: "requests", Value: float64(w)}); err != nil {
+					errs <- err
+				}
+				// Mix in transactions and reads like the access logger and API do
+				tx, err := db.Begin()
+				if err != nil {
+					errs <- err
+					continue
+				}
+				if _, err := tx.Exec(`INSERT INTO metrics (timestamp, metric_type, value) VALUES (?, 'tx', 1)`, i); err != nil {
+					errs <- err
+				}
+				if err := tx.Commit(); err != nil {
+					errs <- err
+				}
+				var n int
+				if err := db.QueryRow(`SELECT COUNT(*) FROM metrics`).Scan(&n); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("concurrent write failed: %v", err)
+	}
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM metrics`).Scan(&n); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if n != writers*perWriter*2 {
+		t.Fatalf("expected %d rows, got %d", writers*perWriter*2, n)
+	}
+}
+
+func TestMigrationsRecordVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	latest := schemaMigrations[len(schemaMigrations)-1].version
+
+	for i := 0; i < 2; i++ {
+		db, err := Open(path)
+		if err != nil {
+			t.Fatalf("open #%d failed: %v", i+1, err)
+		}
+		version, err := db.SchemaVersion()
+		if err != nil {
+			t.Fatalf("schema version: %v", err)
+		}
+		if version != latest {
+			t.Fatalf("expected schema version %d, got %d", latest, version)
+		}
+		var applied int
+		if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied); err != nil {
+			t.Fatalf("count migrations: %v", err)
+		}
+		if applied != len(schemaMigrations) {
+			t.Fatalf("expected %d recorded migrations, got %d", len(schemaMigrations), applied)
+		}
+		db.Close()
+	}
+
+	for i := 1; i < len(schemaMigrations); i++ {
+		if schemaMigrations[i].version <= schemaMigrations[i-1].version {
+			t.Fatalf("migration versions not increasing at %d", schemaMigrations[i].version)
+		}
+	}
+}
+
+func TestMigrateRefusesDowngrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (9999, 'future', 0)"); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	db.Close()
+
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "refusing to downgrade") {
+		t.Fatalf("expected downgrade error, got %v", err)
+	}
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer db.Close()
+
+	latest := schemaMigrations[len(schemaMigrations)-1].version
+	broken := append(append([]migration{}, schemaMigrations...), migration{
+		version: latest + 1,
+		name:    "broken",
+		up: func(tx *sql.Tx) error {
+			if _, err := tx.Exec("CREATE TABLE half_done (id INTEGER)"); err != nil {
+				return err
+			}
+			return errors.New("boom")
+		},
+	})
+
+	err = db.migrate(broken)
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("expected migration error naming the migration, got %v", err)
+	}
+	if version, _ := db.SchemaVersion(); version != latest {
+		t.Fatalf("expected version to stay at %d, got %d", latest, version)
+	}
+	var n int
+	db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_done'").Scan(&n)
+	if n != 0 {
+		t.Fatalf("expected failed migration to be rolled back")
+	}
+}
+
+func TestStatsCountsTables(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LogAccessRequests([]AccessLogEntry{{Domain: "a.com"}, {Domain: "b.com"}}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Tables["access_log"] != 2 {
+		t.Fatalf("expected 2 access_log rows, got %d", stats.Tables["access_log"])
+	}
+	if _, ok := stats.Tables["websocket_connections"]; !ok {
+		t.Fatalf("expected websocket_connections in %v", stats.Tables)
+	}
+	if stats.SizeBytes == 0 || stats.SchemaVersion == 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// Counts are cached, a new row is not visible until the cache expires
+	if err := db.LogAccessRequest(AccessLogEntry{Domain: "c.com"}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	cached, _ := db.Stats()
+	if cached.Tables["access_log"] != 2 {
+		t.Fatalf("expected cached count 2, got %d", cached.Tables["access_log"])
+	}
+	db.countedAt = time.Now().Add(-statsCacheTTL)
+	fresh, _ := db.Stats()
+	if fresh.Tables["access_log"] != 3 {
+		t.Fatalf("expected refreshed count 3, got %d", fresh.Tables["access_log"])
+	}
+}
+
+func TestCompactVacuumsAboveThreshold(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer db.Close()
+
+	entries := make([]AccessLogEntry, 5000)
+	for i := range entries {
+		entries[i] = AccessLogEntry{Domain: "example.com", Path: strings.Repeat("x", 200)}
+	}
+	if err := db.LogAccessRequests(entries); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if _, err := db.Exec("DELETE FROM access_log"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	// Threshold above the free space: only the WAL is truncated
+	res, err := db.Compact(1 << 40)
+	if err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if res.Vacuumed {
+		t.Fatalf("did not expect a vacuum below threshold")
+	}
+	if res.FreeBefore == 0 {
+		t.Fatalf("expected free pages after delete")
+	}
+	if info, err := os.Stat(db.path + "-wal"); err == nil && info.Size() != 0 {
+		t.Fatalf("expected truncated WAL, got %d bytes", info.Size())
+	}
+
+	res, err = db.Compact(1)
+	if err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if !res.Vacuumed || res.ReclaimedBytes <= 0 {
+		t.Fatalf("expected vacuum to reclaim space: %+v", res)
+	}
+}
+
+func TestRunNamedQuery(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now().UnixMilli()
+	var entries []AccessLogEntry
+	for i := 0; i < 3; i++ {
+		entries = append(entries, AccessLogEntry{Timestamp: now, Domain: "a.com", Path: "/broken", Status: 502})
+	}
+	entries = append(entries,
+		AccessLogEntry{Timestamp: now, Domain: "a.com", Path: "/other", Status: 500},
+		AccessLogEntry{Timestamp: now, Domain: "b.com", Path: "/ok", Status: 200},
+		AccessLogEntry{Timestamp: now - (48 * time.Hour).Milliseconds(), Domain: "a.com", Path: "/old", Status: 500},
+	)
+	if err := db.LogAccessRequests(entries); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	res, err := db.RunNamedQuery(context.Background(), "top_error_paths", map[string]string{"since": "1d"}, 1)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(res.Rows) != 1 || !res.Truncated {
+		t.Fatalf("expected 1 truncated row, got %d (truncated=%t)", len(res.Rows), res.Truncated)
+	}
+	if res.Rows[0]["path"] != "/broken" || res.Rows[0]["errors"] != int64(3) {
+		t.Fatalf("unexpected top row: %v", res.Rows[0])
+	}
+
+	res, err = db.RunNamedQuery(context.Background(), "status_over_time", map[string]string{"domain": "b.com"}, 0)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(res.Rows) != 1 || res.Rows[0]["status"] != int64(200) || res.Truncated {
+		t.Fatalf("unexpected rows: %v", res.Rows)
+	}
+
+	if _, err := db.RunNamedQuery(context.Background(), "drop_tables", nil, 0); !errors.Is(err, ErrUnknownQuery) {
+		t.Fatalf("expected ErrUnknownQuery, got %v", err)
+	}
+	if _, err := db.RunNamedQuery(context.Background(), "slowest_routes", map[string]string{"since": "yesterday"}, 0); !errors.Is(err, ErrInvalidParam) {
+		t.Fatalf("expected ErrInvalidParam for bad duration, got %v", err)
+	}
+	if _, err := db.RunNamedQuery(context.Background(), "slowest_routes", map[string]string{"table": "x"}, 0); !errors.Is(err, ErrInvalidParam) {
+		t.Fatalf("expected ErrInvalidParam for unknown param, got %v", err)
+	}
+}
+
+func TestQueryAccessLogFiltersAndPages(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now().UnixMilli()
+	var entries []AccessLogEntry
+	for i := 0; i < 10; i++ {
+		entries = append(entries, AccessLogEntry{Timestamp: now + int64(i), Domain: "a.com", Method: "GET", Path: fmt.Sprintf("/%d", i), Status: 500})
+	}
+	entries = append(entries,
+		AccessLogEntry{Timestamp: now, Domain: "b.com", Method: "POST", Path: "/b", Status: 404, UpstreamConnectMs: 1.25, UpstreamTTFBMs: 12.5},
+		AccessLogEntry{Timestamp: now - (48 * time.Hour).Milliseconds(), Domain: "a.com", Method: "GET", Path: "/old", Status: 500},
+	)
+	if err := db.LogAccessRequests(entries); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	min, max, err := ParseStatusFilter("5xx")
+	if err != nil || min != 500 || max != 599 {
+		t.Fatalf("ParseStatusFilter(5xx) = %d, %d, %v", min, max, err)
+	}
+	filter := AccessLogFilter{Domain: "A.com", StatusMin: min, StatusMax: max, Since: now - time.Hour.Milliseconds(), Limit: 4}
+
+	var paths []string
+	pages := 0
+	for {
+		page, total, next, err := db.QueryAccessLog(filter)
+		if err != nil {
+			t.Fatalf("query: %v", err)
+		}
+		if total != 10 {
+			t.Fatalf("expected total 10, got %d", total)
+		}
+		for _, e := range page {
+			paths = append(paths, e.Path)
+		}
+		pages++
+		if next == 0 {
+			break
+		}
+		filter.Cursor = next
+	}
+	if pages != 3 || len(paths) != 10 || paths[0] != "/9" || paths[9] != "/0" {
+		t.Fatalf("unexpected paging: %d pages, %v", pages, paths)
+	}
+
+	page, total, _, err := db.QueryAccessLog(AccessLogFilter{Method: "post", Limit: 10})
+	if err != nil || total != 1 || len(page) != 1 || page[0].Domain != "b.com" {
+		t.Fatalf("unexpected method filter result: %v %d %v", page, total, err)
+	}
+	if page[0].UpstreamConnectMs != 1.25 || page[0].UpstreamTLSMs != 0 || page[0].UpstreamTTFBMs != 12.5 {
+		t.Fatalf("expected upstream timings to round-trip, got %+v", page[0])
+	}
+
+	page, _, next, err := db.QueryAccessLog(AccessLogFilter{Limit: 5, Offset: 10})
+	if err != nil || len(page) != 2 || next != 0 {
+		t.Fatalf("unexpected offset page: %d entries, next %d, %v", len(page), next, err)
+	}
+}
+
+func TestExportAccessLogStreamsRangeInBatches(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Now().Add(-time.Hour).UnixMilli()
+	var entries []AccessLogEntry
+	for i := 0; i < exportBatchSize+500; i++ {
+		entries = append(entries, AccessLogEntry{Timestamp: start + int64(i), Domain: "a.com", Method: "GET", Path: fmt.Sprintf("/%d", i), Status: 200})
+	}
+	entries = append(entries,
+		AccessLogEntry{Timestamp: start + 10, Domain: "b.com", Method: "GET", Path: "/b", Status: 200},
+		AccessLogEntry{Timestamp: start - 1, Domain: "a.com", Method: "GET", Path: "/before", Status: 200},
+		AccessLogEntry{Timestamp: start + 5000, Domain: "a.com", Method: "GET", Path: "/after", Status: 200},
+	)
+	if err := db.LogAccessRequests(entries); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	filter := AccessLogFilter{Domain: "a.com", Since: start, Until: start + 5000}
+	var paths []string
+	err = db.ExportAccessLog(context.Background(), filter, func(e AccessLogEntry) error {
+		paths = append(paths, e.Path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(paths) != exportBatchSize+500 || paths[0] != "/0" || paths[len(paths)-1] != fmt.Sprintf("/%d", exportBatchSize+499) {
+		t.Fatalf("unexpected export: %d entries, first %v", len(paths), paths[:1])
+	}
+
+	// An error from the callback stops the export
+	stop := errors.New("stop")
+	n := 0
+	err = db.ExportAccessLog(context.Background(), filter, func(AccessLogEntry) error {
+		n++
+		return stop
+	})
+	if !errors.Is(err, stop) || n != 1 {
+		t.Fatalf("expected export to stop after the first error, got %v after %d", err, n)
+	}
+}
+
+func TestMaintenanceSchedules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+
+	start := time.Unix(1800000000, 0)
+	later := MaintenanceSchedule{ID: "b", Service: "svc", Instance: "i1", Target: "ALL", Start: start.Add(time.Hour), End: start.Add(2 * time.Hour), Created: start}
+	sooner := MaintenanceSchedule{
+		ID: "a", Service: "svc", Instance: "i1", Target: "r1",
+		Routes: []ScheduledRoute{{Domains: []string{"example.com", "www.example.com"}, Path: "/app"}},
+		Start:  start, End: start.Add(time.Hour), PageURL: "https://status.example.com/", Created: start,
+	}
+	for _, s := range []MaintenanceSchedule{later, sooner} {
+		if err := db.SaveMaintenanceSchedule(s); err != nil {
+			t.Fatalf("save %s: %v", s.ID, err)
+		}
+	}
+	db.Close()
+
+	// Schedules outlive the process
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+	got, err := db.GetMaintenanceSchedules()
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(got) != 2 || got[0].ID != "a" || got[1].ID != "b" {
+		t.Fatalf("expected schedules a, b, got %+v", got)
+	}
+	if !got[0].Start.Equal(sooner.Start) || !got[0].End.Equal(sooner.End) || got[0].PageURL != sooner.PageURL ||
+		len(got[0].Routes) != 1 || got[0].Routes[0].Path != "/app" || len(got[0].Routes[0].Domains) != 2 {
+		t.Fatalf("schedule a did not round-trip: %+v", got[0])
+	}
+
+	if err := db.DeleteMaintenanceSchedule("a"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := db.DeleteMaintenanceSchedule("missing"); err != nil {
+		t.Fatalf("delete of unknown schedule: %v", err)
+	}
+	if got, _ = db.GetMaintenanceSchedules(); len(got) != 1 || got[0].ID != "b" {
+		t.Fatalf("expected only b left, got %+v", got)
+	}
+}
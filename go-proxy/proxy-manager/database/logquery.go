@@ -0,0 +1,272 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AccessLogFilter selects and pages access log entries. Zero values mean
+// "no filter".
+type AccessLogFilter struct {
+	Domain    string
+	Method    string
+	StatusMin int   // Inclusive
+	StatusMax int   // Inclusive
+	Since     int64 // Timestamp lower bound, same unit as AccessLogEntry.Timestamp
+	Until     int64 // Timestamp upper bound, exclusive
+	RequestID string
+	Limit     int
+	Offset    int
+	Cursor    int64 // Return entries older than this cursor (from a previous NextCursor)
+}
+
+// ParseStatusFilter parses "404", "5xx" or "400-499" into an inclusive range
+func ParseStatusFilter(s string) (min, max int, err error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case s == "":
+		return 0, 0, nil
+	case len(s) == 3 && strings.HasSuffix(s, "xx"):
+		class, err := strconv.Atoi(s[:1])
+		if err != nil || class < 1 || class > 5 {
+			return 0, 0, fmt.Errorf("invalid status class %q", s)
+		}
+		return class * 100, class*100 + 99, nil
+	case strings.Contains(s, "-"):
+		lo, hi, _ := strings.Cut(s, "-")
+		min, err1 := strconv.Atoi(lo)
+		max, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || min > max {
+			return 0, 0, fmt.Errorf("invalid status range %q", s)
+		}
+		return min, max, nil
+	default:
+		code, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid status %q", s)
+		}
+		return code, code, nil
+	}
+}
+
+// Matches reports whether entry passes the filter (paging fields ignored)
+func (f AccessLogFilter) Matches(entry AccessLogEntry) bool {
+	if f.Domain != "" && !strings.EqualFold(entry.Domain, f.Domain) {
+		return false
+	}
+	if f.Method != "" && !strings.EqualFold(entry.Method, f.Method) {
+		return false
+	}
+	if f.StatusMin > 0 && entry.Status < f.StatusMin {
+		return false
+	}
+	if f.StatusMax > 0 && entry.Status > f.StatusMax {
+		return false
+	}
+	if f.Since > 0 && entry.Timestamp < f.Since {
+		return false
+	}
+	if f.Until > 0 && entry.Timestamp >= f.Until {
+		return false
+	}
+	if f.RequestID != "" && entry.RequestID != f.RequestID {
+		return false
+	}
+	return true
+}
+
+// where builds the SQL conditions for the filter (paging fields ignored)
+func (f AccessLogFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if f.Domain != "" {
+		conds = append(conds, "domain = ? COLLATE NOCASE")
+		args = append(args, f.Domain)
+	}
+	if f.Method != "" {
+		conds = append(conds, "method = ? COLLATE NOCASE")
+		args = append(args, f.Method)
+	}
+	if f.StatusMin > 0 {
+		conds = append(conds, "status >= ?")
+		args = append(args, f.StatusMin)
+	}
+	if f.StatusMax > 0 {
+		conds = append(conds, "status <= ?")
+		args = append(args, f.StatusMax)
+	}
+	if f.Since > 0 {
+		conds = append(conds, "timestamp >= ?")
+		args = append(args, f.Since)
+	}
+	if f.Until > 0 {
+		conds = append(conds, "timestamp < ?")
+		args = append(args, f.Until)
+	}
+	if f.RequestID != "" {
+		conds = append(conds, "request_id = ?")
+		args = append(args, f.RequestID)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// QueryAccessLog returns matching entries newest first, the total number of
+// matches, and a cursor for the next page (0 when there is none). Paging
+// uses the cursor when set, otherwise the offset.
+func (db *DB) QueryAccessLog(f AccessLogFilter) ([]AccessLogEntry, int, int64, error) {
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	where, args := f.where()
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM access_log"+where, args...).Scan(&total); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to count access log: %w", err)
+	}
+
+	pageWhere, pageArgs := where, append([]interface{}{}, args...)
+	if f.Cursor > 0 {
+		if pageWhere == "" {
+			pageWhere = " WHERE rowid < ?"
+		} else {
+			pageWhere += " AND rowid < ?"
+		}
+		pageArgs = append(pageArgs, f.Cursor)
+	}
+
+	query := accessLogColumns + pageWhere + `
+	ORDER BY rowid DESC
+	LIMIT ? OFFSET ?`
+	offset := f.Offset
+	if f.Cursor > 0 {
+		offset = 0
+	}
+	// One extra row tells whether another page exists
+	pageArgs = append(pageArgs, f.Limit+1, offset)
+
+	rows, err := db.Query(query, pageArgs...)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to query access log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AccessLogEntry{}
+	var lastRowID, nextCursor int64
+	for rows.Next() {
+		if len(entries) == f.Limit {
+			nextCursor = lastRowID
+			break
+		}
+		var entry AccessLogEntry
+		if lastRowID, err = scanAccessLogRow(rows, &entry); err != nil {
+			return nil, 0, 0, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, total, nextCursor, rows.Err()
+}
+
+// exportBatchSize is how many rows ExportAccessLog reads per query, so no
+// read transaction stays open while a slow client downloads
+const exportBatchSize = 1000
+
+// ExportAccessLog calls fn for every matching entry, oldest first, reading
+// in batches. Limit, Offset and Cursor are ignored. It stops at the first
+// error from fn or when ctx is done.
+func (db *DB) ExportAccessLog(ctx context.Context, f AccessLogFilter, fn func(AccessLogEntry) error) error {
+	where, args := f.where()
+	if where == "" {
+		where = " WHERE rowid > ?"
+	} else {
+		where += " AND rowid > ?"
+	}
+	query := accessLogColumns + where + `
+	ORDER BY rowid
+	LIMIT ?`
+
+	var after int64
+	for {
+		rows, err := db.QueryContext(ctx, query, append(args, after, exportBatchSize)...)
+		if err != nil {
+			return fmt.Errorf("failed to export access log: %w", err)
+		}
+		batch := make([]AccessLogEntry, 0, exportBatchSize)
+		for rows.Next() {
+			var entry AccessLogEntry
+			if after, err = scanAccessLogRow(rows, &entry); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, entry)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("failed to export access log: %w", err)
+		}
+
+		for _, entry := range batch {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		if len(batch) < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// accessLogColumns selects the rowid and every AccessLogEntry column, in
+// the order scanAccessLogRow expects
+const accessLogColumns = `
+	SELECT rowid, timestamp, domain, method, path, query, status,
+		response_time_ms, backend, backend_ip, client_ip,
+		user_agent, referer, bytes_sent, bytes_received,
+		protocol, error, request_id,
+		upstream_connect_ms, upstream_tls_ms, upstream_ttfb_ms
+	FROM access_log`
+
+// scanAccessLogRow reads one accessLogColumns row into entry and returns its rowid
+func scanAccessLogRow(rows *sql.Rows, entry *AccessLogEntry) (int64, error) {
+	var rowID int64
+	var domain, method, path, query, backend, backendIP, clientIP, userAgent, referer, protocol, errMsg, requestID sql.NullString
+	var timestamp, status, responseTime, bytesSent, bytesReceived sql.NullInt64
+	var upstreamConnect, upstreamTLS, upstreamTTFB sql.NullFloat64
+	if err := rows.Scan(
+		&rowID, &timestamp, &domain, &method, &path, &query, &status,
+		&responseTime, &backend, &backendIP, &clientIP,
+		&userAgent, &referer, &bytesSent, &bytesReceived,
+		&protocol, &errMsg, &requestID,
+		&upstreamConnect, &upstreamTLS, &upstreamTTFB,
+	); err != nil {
+		return 0, err
+	}
+	entry.Timestamp = timestamp.Int64
+	entry.Domain = domain.String
+	entry.Method = method.String
+	entry.Path = path.String
+	entry.Query = query.String
+	entry.Status = int(status.Int64)
+	entry.ResponseTimeMs = responseTime.Int64
+	entry.Backend = backend.String
+	entry.BackendIP = backendIP.String
+	entry.ClientIP = clientIP.String
+	entry.UserAgent = userAgent.String
+	entry.Referer = referer.String
+	entry.BytesSent = uint64(bytesSent.Int64)
+	entry.BytesReceived = uint64(bytesReceived.Int64)
+	entry.Protocol = protocol.String
+	entry.Error = errMsg.String
+	entry.RequestID = requestID.String
+	entry.UpstreamConnectMs = upstreamConnect.Float64
+	entry.UpstreamTLSMs = upstreamTLS.Float64
+	entry.UpstreamTTFBMs = upstreamTTFB.Float64
+	return rowID, nil
+}
@@ -0,0 +1,353 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// migration is one schema change. Versions must be strictly increasing and
+// a released migration must never be edited; add a new one instead.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+// schemaMigrations is the ordered list of migrations applied by Open
+var schemaMigrations = []migration{
+	{version: 1, name: "initial schema", up: execSQL(initialSchema)},
+	{version: 2, name: "access_log request_id", up: execSQL(`
+	ALTER TABLE access_log ADD COLUMN request_id TEXT;
+	CREATE INDEX IF NOT EXISTS idx_access_log_request_id ON access_log(request_id);
+	`)},
+	// The original audit_log columns never matched LogAudit, so nothing was
+	// recorded; rebuild it keeping any rows written by hand
+	{version: 3, name: "audit_log rebuild", up: execSQL(`
+	CREATE TABLE audit_log_v3 (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		user TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		resource_type TEXT NOT NULL DEFAULT '',
+		resource_id TEXT NOT NULL DEFAULT '',
+		old_value TEXT NOT NULL DEFAULT '',
+		new_value TEXT NOT NULL DEFAULT '',
+		ip_address TEXT NOT NULL DEFAULT '',
+		metadata TEXT NOT NULL DEFAULT '',
+		result TEXT NOT NULL DEFAULT ''
+	);
+	INSERT INTO audit_log_v3 (id, timestamp, user, action, resource_type, resource_id, old_value, new_value, ip_address, metadata)
+		SELECT audit_id, timestamp, COALESCE(user, ''), action, COALESCE(resource_type, ''), COALESCE(resource_id, ''),
+		       COALESCE(old_value, ''), COALESCE(new_value, ''), COALESCE(ip_address, ''), COALESCE(notes, '')
+		FROM audit_log;
+	DROP TABLE audit_log;
+	ALTER TABLE audit_log_v3 RENAME TO audit_log;
+	CREATE INDEX idx_audit_timestamp ON audit_log(timestamp);
+	CREATE INDEX idx_audit_action ON audit_log(action);
+	CREATE INDEX idx_audit_user ON audit_log(user);
+	`)},
+	{version: 4, name: "access_log upstream timing", up: execSQL(`
+	ALTER TABLE access_log ADD COLUMN upstream_connect_ms REAL;
+	ALTER TABLE access_log ADD COLUMN upstream_tls_ms REAL;
+	ALTER TABLE access_log ADD COLUMN upstream_ttfb_ms REAL;
+	`)},
+	{version: 5, name: "maintenance_schedules", up: execSQL(`
+	CREATE TABLE maintenance_schedules (
+		schedule_id TEXT PRIMARY KEY,
+		service_name TEXT NOT NULL,
+		instance_name TEXT NOT NULL,
+		target TEXT NOT NULL,
+		routes TEXT NOT NULL DEFAULT '[]',
+		start_at INTEGER NOT NULL,
+		end_at INTEGER NOT NULL,
+		page_url TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX idx_maintenance_schedules_end ON maintenance_schedules(end_at);
+	`)},
+}
+
+// execSQL returns a migration step that runs a fixed SQL script
+func execSQL(script string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(script)
+		return err
+	}
+}
+
+// migrate applies every pending migration, each in its own transaction, and
+// records it in schema_migrations. A database written by a newer binary is
+// refused rather than used with a schema this code does not know.
+func (db *DB) migrate(migrations []migration) error {
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at INTEGER NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].version
+	}
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d); refusing to downgrade", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := db.applyMigration(m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+		log.Info().Int("version", m.version).Str("name", m.name).Msg("Applied database migration")
+	}
+
+	return nil
+}
+
+func (db *DB) applyMigration(m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.version, m.name, time.Now().Unix(),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SchemaVersion returns the highest applied migration version, 0 for a
+// database that has never been migrated
+func (db *DB) SchemaVersion() (int, error) {
+	var version int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// initialSchema is the schema as it existed before versioning. It uses IF
+// NOT EXISTS so databases created by older binaries adopt version 1 as is.
+const initialSchema = `
+
+	-- Service Registry
+	CREATE TABLE IF NOT EXISTS services (
+		service_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		service_name TEXT NOT NULL,
+		container_id TEXT,
+		ip_address TEXT,
+		port INTEGER NOT NULL,
+		protocol TEXT DEFAULT 'http',
+		status TEXT DEFAULT 'unknown',
+		last_check INTEGER,
+		metadata TEXT,
+		UNIQUE(service_name, port)
+	);
+
+	-- Route Configurations
+	CREATE TABLE IF NOT EXISTS routes (
+		route_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		domain TEXT NOT NULL,
+		path TEXT DEFAULT '/',
+		service_id INTEGER,
+		backend_url TEXT NOT NULL,
+		enabled INTEGER DEFAULT 1,
+		config_hash TEXT,
+		created_at INTEGER DEFAULT (strftime('%s', 'now')),
+		updated_at INTEGER DEFAULT (strftime('%s', 'now')),
+		FOREIGN KEY(service_id) REFERENCES services(service_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_routes_domain ON routes(domain);
+	CREATE INDEX IF NOT EXISTS idx_routes_enabled ON routes(enabled);
+
+	-- Time-Series Metrics
+	CREATE TABLE IF NOT EXISTS metrics (
+		metric_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		route_id INTEGER,
+		service_id INTEGER,
+		metric_type TEXT NOT NULL,
+		value REAL NOT NULL,
+		labels TEXT,
+		FOREIGN KEY(route_id) REFERENCES routes(route_id),
+		FOREIGN KEY(service_id) REFERENCES services(service_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_metrics_timestamp ON metrics(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_metrics_service ON metrics(service_id);
+	CREATE INDEX IF NOT EXISTS idx_metrics_type ON metrics(metric_type);
+
+	-- Access log (HTTP requests)
+	CREATE TABLE IF NOT EXISTS access_log (
+		timestamp INTEGER,
+		domain TEXT,
+		method TEXT,
+		path TEXT,
+		query TEXT,
+		status INTEGER,
+		response_time_ms INTEGER,
+		backend TEXT,
+		backend_ip TEXT,
+		client_ip TEXT,
+		user_agent TEXT,
+		referer TEXT,
+		bytes_sent INTEGER,
+		bytes_received INTEGER,
+		protocol TEXT,
+		error TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_access_log_ts ON access_log(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_access_log_status ON access_log(status);
+
+	-- Request Logs
+	CREATE TABLE IF NOT EXISTS request_logs (
+		log_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		route_id INTEGER,
+		service_id INTEGER,
+		request_id TEXT NOT NULL,
+		client_ip TEXT NOT NULL,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL,
+		status_code INTEGER,
+		response_time_ms INTEGER,
+		bytes_sent INTEGER,
+		bytes_received INTEGER,
+		user_agent TEXT,
+		referer TEXT,
+		error_message TEXT,
+		FOREIGN KEY(route_id) REFERENCES routes(route_id),
+		FOREIGN KEY(service_id) REFERENCES services(service_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_logs_timestamp ON request_logs(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_logs_status ON request_logs(status_code);
+	CREATE INDEX IF NOT EXISTS idx_logs_request_id ON request_logs(request_id);
+	CREATE INDEX IF NOT EXISTS idx_logs_client_ip ON request_logs(client_ip);
+
+	-- Health Checks
+	CREATE TABLE IF NOT EXISTS health_checks (
+		check_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		service_id INTEGER NOT NULL,
+		success INTEGER NOT NULL,
+		response_time_ms INTEGER,
+		error_message TEXT,
+		FOREIGN KEY(service_id) REFERENCES services(service_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_health_timestamp ON health_checks(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_health_service ON health_checks(service_id);
+
+	-- Certificates
+	CREATE TABLE IF NOT EXISTS certificates (
+		cert_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		domain TEXT NOT NULL UNIQUE,
+		cert_path TEXT NOT NULL,
+		key_path TEXT NOT NULL,
+		issuer TEXT,
+		subject TEXT,
+		not_before INTEGER,
+		not_after INTEGER,
+		san_domains TEXT,
+		auto_renew INTEGER DEFAULT 1,
+		last_check INTEGER,
+		created_at INTEGER DEFAULT (strftime('%s', 'now')),
+		updated_at INTEGER DEFAULT (strftime('%s', 'now'))
+	);
+	CREATE INDEX IF NOT EXISTS idx_certs_domain ON certificates(domain);
+	CREATE INDEX IF NOT EXISTS idx_certs_expiry ON certificates(not_after);
+
+	-- Rate Limits
+	CREATE TABLE IF NOT EXISTS rate_limits (
+		ip_address TEXT NOT NULL,
+		route_id INTEGER NOT NULL,
+		window_start INTEGER NOT NULL,
+		request_count INTEGER DEFAULT 1,
+		last_request INTEGER NOT NULL,
+		PRIMARY KEY (ip_address, route_id, window_start),
+		FOREIGN KEY(route_id) REFERENCES routes(route_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_ratelimit_window ON rate_limits(window_start);
+
+	-- Rate Limit Violations
+	CREATE TABLE IF NOT EXISTS rate_limit_violations (
+		violation_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		ip_address TEXT NOT NULL,
+		route_id INTEGER,
+		request_count INTEGER,
+		limit_value INTEGER,
+		action TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_violations_timestamp ON rate_limit_violations(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_violations_ip ON rate_limit_violations(ip_address);
+
+	-- WAF Blocks
+	CREATE TABLE IF NOT EXISTS waf_blocks (
+		block_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		ip_address TEXT NOT NULL,
+		route_id INTEGER,
+		attack_type TEXT NOT NULL,
+		pattern_matched TEXT,
+		request_path TEXT,
+		request_method TEXT,
+		action TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_waf_timestamp ON waf_blocks(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_waf_ip ON waf_blocks(ip_address);
+	CREATE INDEX IF NOT EXISTS idx_waf_type ON waf_blocks(attack_type);
+
+	-- Audit Log
+	CREATE TABLE IF NOT EXISTS audit_log (
+		audit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		user TEXT,
+		action TEXT NOT NULL,
+		resource_type TEXT,
+		resource_id TEXT,
+		old_value TEXT,
+		new_value TEXT,
+		ip_address TEXT,
+		notes TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_timestamp ON audit_log(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_audit_action ON audit_log(action);
+
+	-- WebSocket Connections
+	CREATE TABLE IF NOT EXISTS websocket_connections (
+		conn_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		request_id TEXT NOT NULL,
+		route_id INTEGER,
+		client_ip TEXT NOT NULL,
+		connected_at INTEGER NOT NULL,
+		disconnected_at INTEGER,
+		bytes_sent INTEGER DEFAULT 0,
+		bytes_received INTEGER DEFAULT 0,
+		messages_sent INTEGER DEFAULT 0,
+		messages_received INTEGER DEFAULT 0,
+		close_reason TEXT,
+		FOREIGN KEY(route_id) REFERENCES routes(route_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_ws_connected ON websocket_connections(connected_at);
+	CREATE INDEX IF NOT EXISTS idx_ws_active ON websocket_connections(disconnected_at) WHERE disconnected_at IS NULL;
+	`
@@ -0,0 +1,262 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultQueryLimit   = 100
+	maxQueryLimit       = 1000
+	namedQueryTimeout   = 5 * time.Second
+	maxStringParamBytes = 256
+)
+
+// ErrUnknownQuery is returned by RunNamedQuery for names not in the allowlist
+var ErrUnknownQuery = errors.New("unknown query")
+
+// ErrInvalidParam is wrapped by RunNamedQuery for missing or malformed parameters
+var ErrInvalidParam = errors.New("invalid parameter")
+
+// QueryParam describes one bound parameter of a named query
+type QueryParam struct {
+	Name        string `json:"name"`
+	Kind        string `json:"kind"` // "since" (duration ago, e.g. 24h or 7d), "duration", "int" or "string"
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description"`
+}
+
+// NamedQuery is a pre-registered read-only query. Parameters are bound by
+// name (@name) and the row limit is appended as @limit.
+type NamedQuery struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Params      []QueryParam `json:"params"`
+	sql         string
+}
+
+// QueryResult holds the rows returned by a named query
+type QueryResult struct {
+	Query     string                   `json:"query"`
+	Columns   []string                 `json:"columns"`
+	Rows      []map[string]interface{} `json:"rows"`
+	Truncated bool                     `json:"truncated"` // More rows matched than the limit
+}
+
+// namedQueries is the allowlist served by RunNamedQuery. access_log
+// timestamps are Unix milliseconds.
+var namedQueries = map[string]NamedQuery{
+	"status_over_time": {
+		Name:        "status_over_time",
+		Description: "Requests per status code per time bucket",
+		Params: []QueryParam{
+			{Name: "since", Kind: "since", Default: "24h", Description: "How far back to look"},
+			{Name: "bucket", Kind: "duration", Default: "1h", Description: "Bucket width"},
+			{Name: "domain", Kind: "string", Description: "Only this domain (default all)"},
+		},
+		sql: `
+		SELECT (timestamp / @bucket) * @bucket AS bucket, status, COUNT(*) AS requests
+		FROM access_log
+		WHERE timestamp >= @since AND (@domain = '' OR domain = @domain)
+		GROUP BY bucket, status
+		ORDER BY bucket, status
+		LIMIT @limit`,
+	},
+	"top_error_paths": {
+		Name:        "top_error_paths",
+		Description: "Paths with the most error responses",
+		Params: []QueryParam{
+			{Name: "since", Kind: "since", Default: "24h", Description: "How far back to look"},
+			{Name: "min_status", Kind: "int", Default: "500", Description: "Lowest status counted as an error"},
+			{Name: "domain", Kind: "string", Description: "Only this domain (default all)"},
+		},
+		sql: `
+		SELECT domain, path, COUNT(*) AS errors, MAX(timestamp) AS last_seen
+		FROM access_log
+		WHERE timestamp >= @since AND status >= @min_status AND (@domain = '' OR domain = @domain)
+		GROUP BY domain, path
+		ORDER BY errors DESC
+		LIMIT @limit`,
+	},
+	"slowest_routes": {
+		Name:        "slowest_routes",
+		Description: "Domain and path pairs by average response time",
+		Params: []QueryParam{
+			{Name: "since", Kind: "since", Default: "24h", Description: "How far back to look"},
+			{Name: "min_requests", Kind: "int", Default: "10", Description: "Ignore paths with fewer requests"},
+			{Name: "domain", Kind: "string", Description: "Only this domain (default all)"},
+		},
+		sql: `
+		SELECT domain, path, COUNT(*) AS requests,
+			ROUND(AVG(response_time_ms), 1) AS avg_ms, MAX(response_time_ms) AS max_ms
+		FROM access_log
+		WHERE timestamp >= @since AND (@domain = '' OR domain = @domain)
+		GROUP BY domain, path
+		HAVING COUNT(*) >= @min_requests
+		ORDER BY avg_ms DESC
+		LIMIT @limit`,
+	},
+}
+
+// NamedQueries returns the allowlisted queries sorted by name
+func NamedQueries() []NamedQuery {
+	queries := make([]NamedQuery, 0, len(namedQueries))
+	for _, q := range namedQueries {
+		queries = append(queries, q)
+	}
+	sort.Slice(queries, func(i, j int) bool { return queries[i].Name < queries[j].Name })
+	return queries
+}
+
+// RunNamedQuery runs an allowlisted query with params bound from values.
+// Missing params use their default, unknown params are rejected. At most
+// limit rows (default 100, max 1000) are returned and the statement is
+// cancelled after a few seconds.
+func (db *DB) RunNamedQuery(ctx context.Context, name string, values map[string]string, limit int) (*QueryResult, error) {
+	q, ok := namedQueries[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownQuery, name)
+	}
+
+	args, err := q.bind(values, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = defaultQueryLimit
+	}
+	if limit > maxQueryLimit {
+		limit = maxQueryLimit
+	}
+	// Fetch one extra row to tell whether the result was cut off
+	args = append(args, sql.Named("limit", limit+1))
+
+	ctx, cancel := context.WithTimeout(ctx, namedQueryTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, q.sql, args...)
+	if err != nil {
+		return nil, queryError(ctx, name, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &QueryResult{Query: name, Columns: columns, Rows: []map[string]interface{}{}}
+
+	for rows.Next() {
+		if len(result.Rows) == limit {
+			result.Truncated = true
+			break
+		}
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[col] = values[i]
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, name, err)
+	}
+
+	return result, nil
+}
+
+// queryError reports a timeout as context.DeadlineExceeded, since the driver
+// surfaces an interrupted statement as a generic error
+func queryError(ctx context.Context, name string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("query %s cancelled: %w", name, ctxErr)
+	}
+	return fmt.Errorf("query %s failed: %w", name, err)
+}
+
+// bind converts string values to typed named args, applying defaults
+func (q NamedQuery) bind(values map[string]string, now time.Time) ([]interface{}, error) {
+	known := make(map[string]bool, len(q.Params))
+	args := make([]interface{}, 0, len(q.Params)+1)
+
+	for _, p := range q.Params {
+		known[p.Name] = true
+		raw, ok := values[p.Name]
+		if !ok || raw == "" {
+			raw = p.Default
+		}
+
+		var v interface{}
+		switch p.Kind {
+		case "since", "duration":
+			d, err := ParseQueryDuration(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%w %s: %v", ErrInvalidParam, p.Name, err)
+			}
+			if p.Kind == "since" {
+				v = now.Add(-d).UnixMilli()
+			} else {
+				v = d.Milliseconds()
+			}
+		case "int":
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%w %s: %q is not an integer", ErrInvalidParam, p.Name, raw)
+			}
+			v = n
+		default:
+			if len(raw) > maxStringParamBytes {
+				return nil, fmt.Errorf("%w %s: longer than %d bytes", ErrInvalidParam, p.Name, maxStringParamBytes)
+			}
+			v = raw
+		}
+		args = append(args, sql.Named(p.Name, v))
+	}
+
+	for name := range values {
+		if !known[name] {
+			return nil, fmt.Errorf("%w: %s is not a parameter of %s", ErrInvalidParam, name, q.Name)
+		}
+	}
+
+	return args, nil
+}
+
+// ParseQueryDuration accepts time.ParseDuration values plus a "d" suffix for
+// days. Durations must be positive.
+func ParseQueryDuration(s string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration %q must be positive", s)
+	}
+	return d, nil
+}
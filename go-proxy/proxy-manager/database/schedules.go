@@ -0,0 +1,87 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// MaintenanceSchedule is a maintenance window set by a registry service.
+// Sessions and route IDs do not survive a restart, so the schedule names the
+// service instance and, unless Target is ALL, the routes by domains and path.
+type MaintenanceSchedule struct {
+	ID       string           `json:"id"`
+	Service  string           `json:"service"`
+	Instance string           `json:"instance"`
+	Target   string           `json:"target"` // ALL or the route IDs as given
+	Routes   []ScheduledRoute `json:"routes,omitempty"`
+	Start    time.Time        `json:"start"`
+	End      time.Time        `json:"end"`
+	PageURL  string           `json:"page_url,omitempty"`
+	Created  time.Time        `json:"created"`
+}
+
+// ScheduledRoute identifies a route of a maintenance schedule
+type ScheduledRoute struct {
+	Domains []string `json:"domains"`
+	Path    string   `json:"path"`
+}
+
+// SaveMaintenanceSchedule inserts or replaces a maintenance schedule
+func (db *DB) SaveMaintenanceSchedule(s MaintenanceSchedule) error {
+	routes, err := json.Marshal(s.Routes)
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule routes: %w", err)
+	}
+	_, err = db.Exec(`
+		INSERT OR REPLACE INTO maintenance_schedules (
+			schedule_id, service_name, instance_name, target, routes,
+			start_at, end_at, page_url, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.ID, s.Service, s.Instance, s.Target, string(routes),
+		s.Start.Unix(), s.End.Unix(), s.PageURL, s.Created.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save maintenance schedule: %w", err)
+	}
+	return nil
+}
+
+// DeleteMaintenanceSchedule removes a maintenance schedule; an unknown ID is
+// not an error
+func (db *DB) DeleteMaintenanceSchedule(id string) error {
+	if _, err := db.Exec("DELETE FROM maintenance_schedules WHERE schedule_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete maintenance schedule: %w", err)
+	}
+	return nil
+}
+
+// GetMaintenanceSchedules returns every stored maintenance schedule, the
+// earliest start first
+func (db *DB) GetMaintenanceSchedules() ([]MaintenanceSchedule, error) {
+	rows, err := db.Query(`
+		SELECT schedule_id, service_name, instance_name, target, routes,
+		       start_at, end_at, page_url, created_at
+		FROM maintenance_schedules
+		ORDER BY start_at, schedule_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query maintenance schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []MaintenanceSchedule
+	for rows.Next() {
+		var s MaintenanceSchedule
+		var routes string
+		var start, end, created int64
+		if err := rows.Scan(&s.ID, &s.Service, &s.Instance, &s.Target, &routes, &start, &end, &s.PageURL, &created); err != nil {
+			return nil, fmt.Errorf("failed to scan maintenance schedule: %w", err)
+		}
+		if err := json.Unmarshal([]byte(routes), &s.Routes); err != nil {
+			return nil, fmt.Errorf("maintenance schedule %s: invalid routes: %w", s.ID, err)
+		}
+		s.Start, s.End, s.Created = time.Unix(start, 0), time.Unix(end, 0), time.Unix(created, 0)
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// statsCacheTTL is how long table row counts are reused. COUNT(*) scans the
+// whole table, so polling dashboards must not trigger one per request.
+const statsCacheTTL = 30 * time.Second
+
+// Stats describes database size and per-table row counts
+type Stats struct {
+	Path          string           `json:"path"`
+	SizeBytes     int64            `json:"size_bytes"` // Main database file
+	WALBytes      int64            `json:"wal_bytes"`  // Write-ahead log not yet checkpointed
+	FreeBytes     int64            `json:"free_bytes"` // Unused pages reclaimable by VACUUM
+	SchemaVersion int              `json:"schema_version"`
+	Tables        map[string]int64 `json:"tables"`
+	CountedAt     int64            `json:"counted_at"` // Unix time the row counts were taken
+}
+
+// Stats returns the on-disk size and row count of every table. Sizes are
+// read on each call, row counts are cached for statsCacheTTL.
+func (db *DB) Stats() (*Stats, error) {
+	counts, countedAt, err := db.cachedTableCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	var pageSize, freePages int64
+	if err := db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return nil, fmt.Errorf("failed to read page size: %w", err)
+	}
+	if err := db.QueryRow("PRAGMA freelist_count").Scan(&freePages); err != nil {
+		return nil, fmt.Errorf("failed to read freelist: %w", err)
+	}
+
+	stats := &Stats{
+		Path:      db.path,
+		FreeBytes: pageSize * freePages,
+		Tables:    counts,
+		CountedAt: countedAt.Unix(),
+	}
+	if info, err := os.Stat(db.path); err == nil {
+		stats.SizeBytes = info.Size()
+	} else {
+		// In-memory database
+		var pageCount int64
+		if err := db.QueryRow("PRAGMA page_count").Scan(&pageCount); err == nil {
+			stats.SizeBytes = pageSize * pageCount
+		}
+	}
+	if info, err := os.Stat(db.path + "-wal"); err == nil {
+		stats.WALBytes = info.Size()
+	}
+	if stats.SchemaVersion, err = db.SchemaVersion(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func (db *DB) cachedTableCounts() (map[string]int64, time.Time, error) {
+	db.statsMu.Lock()
+	defer db.statsMu.Unlock()
+
+	if db.tableCounts != nil && time.Since(db.countedAt) < statsCacheTTL {
+		return copyCounts(db.tableCounts), db.countedAt, nil
+	}
+
+	counts, err := db.countTables()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	db.tableCounts = counts
+	db.countedAt = time.Now()
+	return copyCounts(counts), db.countedAt, nil
+}
+
+// countTables counts the rows of every user table in the schema
+func (db *DB) countTables() (map[string]int64, error) {
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		var n int64
+		// Table names come from sqlite_master, not user input
+		if err := db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM "%s"`, table)).Scan(&n); err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", table, err)
+		}
+		counts[table] = n
+	}
+	return counts, nil
+}
+
+func copyCounts(counts map[string]int64) map[string]int64 {
+	out := make(map[string]int64, len(counts))
+	for k, v := range counts {
+		out[k] = v
+	}
+	return out
+}
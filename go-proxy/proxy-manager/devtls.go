@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chilla55/proxy-manager/config"
+	"github.com/chilla55/proxy-manager/proxy"
+)
+
+// devCertValidity is how long a generated development certificate is valid,
+// long enough to stay out of the expiry alert levels; a new one is generated
+// on every start and reload
+const devCertValidity = 90 * 24 * time.Hour
+
+// loadServingCertificates loads the certificates from global.yaml. With
+// --dev-tls and none configured it generates a self-signed certificate for
+// the domains of the site configs instead.
+func loadServingCertificates(cfg *config.GlobalConfig) ([]proxy.CertMapping, error) {
+	if !*devTLS || len(cfg.TLS.Certificates) > 0 {
+		return loadCertificates(cfg)
+	}
+
+	domains := siteDomains(*sitesPath)
+	mapping, err := generateDevCertificate(domains, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("generate development certificate: %w", err)
+	}
+	log.Warn().
+		Strs("domains", mapping.Domains).
+		Msg("INSECURE: no TLS certificates configured, serving a generated self-signed certificate (--dev-tls). Do not use in production")
+	return []proxy.CertMapping{mapping}, nil
+}
+
+// siteDomains returns the route domains of the enabled site configs under
+// sitesPath. Files that fail to load are skipped; the watcher reports them.
+func siteDomains(sitesPath string) []string {
+	files, _ := filepath.Glob(filepath.Join(sitesPath, "*.yaml"))
+	ymlFiles, _ := filepath.Glob(filepath.Join(sitesPath, "*.yml"))
+	files = append(files, ymlFiles...)
+
+	var domains []string
+	for _, file := range files {
+		site, err := config.LoadSiteConfig(file)
+		if err != nil || !site.Enabled {
+			continue
+		}
+		for _, route := range site.Routes {
+			domains = append(domains, route.Domains...)
+		}
+	}
+	return domains
+}
+
+// generateDevCertificate returns an in-memory self-signed certificate for
+// domains and localhost
+func generateDevCertificate(domains []string, now time.Time) (proxy.CertMapping, error) {
+	names := map[string]bool{"localhost": true}
+	for _, domain := range domains {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			names[domain] = true
+		}
+	}
+	dnsNames := make([]string, 0, len(names))
+	for name := range names {
+		dnsNames = append(dnsNames, name)
+	}
+	sort.Strings(dnsNames)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return proxy.CertMapping{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return proxy.CertMapping{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "proxy-manager development certificate", Organization: []string{"proxy-manager (INSECURE)"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(devCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     dnsNames,
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return proxy.CertMapping{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return proxy.CertMapping{}, err
+	}
+
+	return proxy.CertMapping{
+		Domains: dnsNames,
+		Cert:    tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf},
+	}, nil
+}
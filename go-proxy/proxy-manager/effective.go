@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/chilla55/proxy-manager/config"
+	"github.com/chilla55/proxy-manager/proxy"
+	"github.com/chilla55/proxy-manager/webhook"
+)
+
+// redacted replaces secrets in /api/config/effective
+const redacted = "[redacted]"
+
+// effectiveGlobals are the global settings in use, with defaults resolved
+type effectiveGlobals struct {
+	SecurityHeaders map[string]string `json:"security_headers"`
+	ResponseHeaders struct {
+		Strip      []string `json:"strip"`
+		HideServer bool     `json:"hide_server"`
+	} `json:"response_headers"`
+	Blackhole struct {
+		UnknownDomains bool `json:"unknown_domains"`
+		MetricsOnly    bool `json:"metrics_only"`
+	} `json:"blackhole"`
+	Alerts struct {
+		ErrorRateThreshold float64 `json:"error_rate_threshold"`
+	} `json:"alerts"`
+	Retention struct {
+		RetentionDays     int   `json:"retention_days"`
+		Vacuum            bool  `json:"vacuum"`
+		VacuumThresholdMB int64 `json:"vacuum_threshold_mb"`
+	} `json:"retention"`
+	Server struct {
+		HTTP2              bool     `json:"http2"`
+		HTTP3              bool     `json:"http3"`
+		AltSvc             bool     `json:"alt_svc"`
+		HTTPRedirectExempt []string `json:"http_redirect_exempt"`
+		HTTPSListeners     []string `json:"https_listeners"`
+		CanonicalHost      string   `json:"canonical_host"`
+		ReadHeaderTimeout  string   `json:"read_header_timeout"`
+		ReadTimeout        string   `json:"read_timeout"`
+		WriteTimeout       string   `json:"write_timeout"`
+		IdleTimeout        string   `json:"idle_timeout"`
+		MaxConnections     int      `json:"max_connections"`
+	} `json:"server"`
+	TrustedProxies []string `json:"trusted_proxies"`
+	RouteLabels    []string `json:"metrics_route_labels"`
+	LabelKeys      []string `json:"metrics_label_keys"`
+	Dashboard      struct {
+		Username       string   `json:"username,omitempty"`
+		Password       string   `json:"password,omitempty"`
+		Token          string   `json:"token,omitempty"`
+		Insecure       bool     `json:"insecure,omitempty"`
+		AllowedOrigins []string `json:"cors_allowed_origins"`
+	} `json:"dashboard"`
+	Webhooks struct {
+		Enabled bool              `json:"enabled"`
+		Targets []effectiveTarget `json:"targets"`
+	} `json:"webhooks"`
+}
+
+// effectiveTarget is a webhook without the secret part of its URL
+type effectiveTarget struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Signed bool     `json:"signed"` // A secret is set; the secret itself is never shown
+
+	Recipients []string `json:"recipients,omitempty"` // smtp type
+}
+
+// buildEffectiveGlobals resolves cfg the way the running components read it
+func buildEffectiveGlobals(cfg *config.GlobalConfig, hooks webhook.Config, proxyServer *proxy.Server) effectiveGlobals {
+	var e effectiveGlobals
+	e.SecurityHeaders = proxyServer.EffectiveGlobalHeaders()
+	e.ResponseHeaders.Strip = cfg.Defaults.ResponseHeaders.Strip
+	e.ResponseHeaders.HideServer = cfg.Defaults.ResponseHeaders.HideServer
+	e.Blackhole.UnknownDomains = cfg.Blackhole.UnknownDomains
+	e.Blackhole.MetricsOnly = cfg.Blackhole.MetricsOnly
+	e.Alerts.ErrorRateThreshold = cfg.GetErrorRateThreshold()
+	e.Retention.RetentionDays = cfg.GetRetentionDays()
+	e.Retention.Vacuum = cfg.Retention.Vacuum
+	e.Retention.VacuumThresholdMB = cfg.GetVacuumThreshold() >> 20
+	e.Server.HTTP2 = cfg.HTTP2Enabled()
+	e.Server.HTTP3 = cfg.HTTP3Enabled()
+	e.Server.AltSvc = cfg.AltSvcEnabled()
+	e.Server.HTTPRedirectExempt = cfg.GetHTTPRedirectExempt()
+	e.Server.HTTPSListeners = proxyServer.HTTPSAddrs()
+	e.Server.CanonicalHost = cfg.Defaults.Options.CanonicalHost
+	if e.Server.CanonicalHost == "" {
+		e.Server.CanonicalHost = proxy.CanonicalOff
+	}
+	if timeouts, err := cfg.GetServerTimeouts(); err == nil {
+		e.Server.ReadHeaderTimeout = timeouts.ReadHeader.String()
+		e.Server.ReadTimeout = timeouts.Read.String()
+		e.Server.WriteTimeout = timeouts.Write.String()
+		e.Server.IdleTimeout = timeouts.Idle.String()
+	}
+	e.Server.MaxConnections = cfg.Server.MaxConnections
+	e.TrustedProxies = cfg.TrustedProxies
+	e.RouteLabels = cfg.Metrics.RouteLabels
+	e.LabelKeys = cfg.Metrics.LabelKeys
+
+	auth := cfg.Dashboard.Auth
+	e.Dashboard.Username = auth.Username
+	if auth.Password != "" || auth.PasswordFile != "" {
+		e.Dashboard.Password = redacted
+	}
+	if auth.Token != "" || auth.TokenFile != "" {
+		e.Dashboard.Token = redacted
+	}
+	e.Dashboard.Insecure = auth.Insecure
+	e.Dashboard.AllowedOrigins = cfg.Dashboard.CORS.AllowedOrigins
+
+	e.Webhooks.Enabled = hooks.Enabled
+	e.Webhooks.Targets = make([]effectiveTarget, 0, len(hooks.Webhooks))
+	for _, hook := range hooks.Webhooks {
+		e.Webhooks.Targets = append(e.Webhooks.Targets, newEffectiveTarget(hook))
+	}
+	return e
+}
+
+func newEffectiveTarget(hook webhook.Webhook) effectiveTarget {
+	target := effectiveTarget{
+		Name:   hook.Name,
+		Type:   hook.Type,
+		URL:    redactWebhookURL(hook.URL),
+		Events: hook.Events,
+		Signed: hook.Secret != "",
+	}
+	if hook.Type == webhook.TypeSMTP && hook.SMTP != nil {
+		// The relay and recipients carry no credentials
+		target.URL = "smtp://" + hook.SMTP.Host
+		target.Recipients = hook.SMTP.To
+	}
+	return target
+}
+
+// redactWebhookURL keeps scheme and host; Discord and Slack put the token in
+// the path
+func redactWebhookURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+	return u.Scheme + "://" + u.Host + "/" + redacted
+}
+
+// registerEffectiveConfig adds /api/config/effective. With ?route=domain/path
+// it also returns the resolved configuration of that route.
+func registerEffectiveConfig(mux *http.ServeMux, reloader *globalReloader, proxyServer *proxy.Server) {
+	mux.HandleFunc("GET /api/config/effective", func(w http.ResponseWriter, r *http.Request) {
+		cfg, hooks := reloader.Snapshot()
+		result := map[string]interface{}{
+			"global": buildEffectiveGlobals(cfg, hooks, proxyServer),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if route := r.URL.Query().Get("route"); route != "" {
+			domain, path, _ := strings.Cut(route, "/")
+			path = "/" + path
+			routes := proxyServer.EffectiveRoutes(domain, path)
+			if len(routes) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]string{"route": route, "error": "route not found"})
+				return
+			}
+			result["routes"] = routes
+		}
+		json.NewEncoder(w).Encode(result)
+	})
+}
@@ -0,0 +1,118 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types published on the bus
+const (
+	TypeError          = "error"           // Request answered with a 5xx
+	TypeHealth         = "health"          // Service health transition
+	TypeCert           = "cert"            // Certificate expiry alert
+	TypeCircuitBreaker = "circuit_breaker" // Backend circuit breaker state change
+	TypeAlert          = "alert"           // Other alerts, e.g. high error rate
+)
+
+// Types lists every event type, in the order shown by the API
+var Types = []string{TypeError, TypeHealth, TypeCert, TypeCircuitBreaker, TypeAlert}
+
+// Event is a single real-time event
+type Event struct {
+	ID       uint64                 `json:"id"`
+	Type     string                 `json:"type"`
+	Time     time.Time              `json:"time"`
+	Severity string                 `json:"severity,omitempty"` // info, warning, error, critical
+	Message  string                 `json:"message"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// Bus fans events out to subscribers. Publish never blocks: a subscriber
+// that falls behind loses events and its dropped count goes up.
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	nextID uint64
+}
+
+// Subscription receives events of the requested types on C
+type Subscription struct {
+	C       <-chan Event
+	ch      chan Event
+	types   map[string]bool // nil means all types
+	dropped uint64
+}
+
+// NewBus creates an event bus
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe registers a subscriber for types (all types when empty) with a
+// buffer of the given size. Call Unsubscribe when done.
+func (b *Bus) Subscribe(types []string, buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	ch := make(chan Event, buffer)
+	sub := &Subscription{C: ch, ch: ch}
+	if len(types) > 0 {
+		sub.types = make(map[string]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe removes sub and closes its channel
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Publish sends e to every matching subscriber. ID and Time are filled in.
+// Safe to call on a nil Bus.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	e.ID = atomic.AddUint64(&b.nextID, 1)
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if sub.types != nil && !sub.types[e.Type] {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+}
+
+// Subscribers returns the number of active subscriptions
+func (b *Bus) Subscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
+
+// Dropped returns and resets the number of events lost since the last call
+func (s *Subscription) Dropped() uint64 {
+	return atomic.SwapUint64(&s.dropped, 0)
+}
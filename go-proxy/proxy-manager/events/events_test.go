@@ -0,0 +1,113 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBusFiltersAndDrops(t *testing.T) {
+	bus := NewBus()
+	all := bus.Subscribe(nil, 10)
+	health := bus.Subscribe([]string{TypeHealth}, 1)
+
+	bus.Publish(Event{Type: TypeError, Message: "boom"})
+	bus.Publish(Event{Type: TypeHealth, Message: "down"})
+	bus.Publish(Event{Type: TypeHealth, Message: "up"})
+
+	if len(all.C) != 3 {
+		t.Fatalf("expected 3 events for unfiltered subscriber, got %d", len(all.C))
+	}
+	e := <-health.C
+	if e.Type != TypeHealth || e.Message != "down" || e.ID == 0 || e.Time.IsZero() {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	if n := health.Dropped(); n != 1 {
+		t.Fatalf("expected 1 dropped event for full subscriber, got %d", n)
+	}
+	if n := health.Dropped(); n != 0 {
+		t.Fatalf("expected dropped count reset, got %d", n)
+	}
+
+	bus.Unsubscribe(health)
+	if _, ok := <-health.C; ok {
+		t.Fatalf("expected closed channel after unsubscribe")
+	}
+	if bus.Subscribers() != 1 {
+		t.Fatalf("expected 1 subscriber, got %d", bus.Subscribers())
+	}
+
+	var nilBus *Bus
+	nilBus.Publish(Event{Type: TypeAlert}) // must not panic
+}
+
+func TestServeSSE(t *testing.T) {
+	bus := NewBus()
+	srv := httptest.NewServer(bus)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?types=cert,circuit_breaker", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	// Wait for the handler to subscribe before publishing
+	deadline := time.Now().Add(2 * time.Second)
+	for bus.Subscribers() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	bus.Publish(Event{Type: TypeError, Message: "filtered out"})
+	bus.Publish(Event{Type: TypeCircuitBreaker, Message: "open", Data: map[string]interface{}{"to": "open"}})
+
+	reader := bufio.NewReader(resp.Body)
+	var eventName, data string
+	for data == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			eventName = v
+		}
+		if v, ok := strings.CutPrefix(line, "data: "); ok {
+			data = v
+		}
+	}
+	if eventName != TypeCircuitBreaker {
+		t.Fatalf("expected circuit_breaker event, got %q", eventName)
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(data), &e); err != nil || e.Message != "open" {
+		t.Fatalf("unexpected data %q: %v", data, err)
+	}
+
+	// Client disconnect releases the subscription
+	cancel()
+	deadline = time.Now().Add(2 * time.Second)
+	for bus.Subscribers() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if bus.Subscribers() != 0 {
+		t.Fatalf("expected subscription removed after disconnect")
+	}
+}
+
+func TestServeSSERejectsUnknownType(t *testing.T) {
+	rr := httptest.NewRecorder()
+	NewBus().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/?types=error,bogus", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown type, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,114 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	sseHeartbeat    = 15 * time.Second
+	sseWriteTimeout = 10 * time.Second
+	sseBuffer       = 256
+)
+
+// ServeHTTP streams events as Server-Sent Events. The optional types query
+// parameter is a comma separated filter (types=error,health). A client that
+// cannot keep up loses events and is told how many via a "dropped" event; a
+// client whose writes stall for sseWriteTimeout is disconnected.
+func (b *Bus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	types, err := parseTypes(r.URL.Query().Get("types"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Warn().Err(err).Msg("Event stream not supported by response writer")
+		return
+	}
+
+	sub := b.Subscribe(types, sseBuffer)
+	defer b.Unsubscribe(sub)
+	log.Debug().Str("remote_addr", r.RemoteAddr).Strs("types", types).Msg("Event stream client connected")
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	// Initial comment so clients see the stream is open
+	if err := writeSSE(rc, w, ": connected\n\n"); err != nil {
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Debug().Str("remote_addr", r.RemoteAddr).Msg("Event stream client disconnected")
+			return
+		case <-heartbeat.C:
+			if err := writeSSE(rc, w, ": ping\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if n := sub.Dropped(); n > 0 {
+				msg := fmt.Sprintf("event: dropped\ndata: {\"count\":%d}\n\n", n)
+				if err := writeSSE(rc, w, msg); err != nil {
+					return
+				}
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			msg := fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+			if err := writeSSE(rc, w, msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeSSE(rc *http.ResponseController, w http.ResponseWriter, msg string) error {
+	// Not every writer supports deadlines; the write still goes through
+	_ = rc.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+	if _, err := fmt.Fprint(w, msg); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
+
+// parseTypes validates a comma separated types filter
+func parseTypes(raw string) ([]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	known := make(map[string]bool, len(Types))
+	for _, t := range Types {
+		known[t] = true
+	}
+	var types []string
+	for _, t := range strings.Split(raw, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if !known[t] {
+			return nil, fmt.Errorf("unknown event type %q (valid: %s)", t, strings.Join(Types, ", "))
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
@@ -1,7 +1,9 @@
 package geoip
 
 import (
+	"fmt"
 	"net"
+	"os"
 	"sync"
 	"time"
 
@@ -12,6 +14,8 @@ import (
 // Tracker handles GeoIP lookups for client IP addresses
 type Tracker struct {
 	db                    *geoip2.Reader
+	dbMutex               sync.RWMutex // guards db, swapped by Reload
+	path                  string
 	enabled               bool
 	alertOnUnusualCountry bool
 	expectedCountries     map[string]bool // Expected countries for this service
@@ -73,7 +77,7 @@ func New(config Config) (*Tracker, error) {
 	}
 
 	// Open GeoIP database
-	db, err := geoip2.Open(config.DatabasePath)
+	db, err := openDatabase(config.DatabasePath)
 	if err != nil {
 		log.Error().Err(err).Str("path", config.DatabasePath).Msg("Failed to open GeoIP database")
 		return nil, err
@@ -87,6 +91,7 @@ func New(config Config) (*Tracker, error) {
 
 	tracker := &Tracker{
 		db:                    db,
+		path:                  config.DatabasePath,
 		enabled:               true,
 		alertOnUnusualCountry: config.AlertOnUnusualCountry,
 		expectedCountries:     expectedCountries,
@@ -101,11 +106,75 @@ func New(config Config) (*Tracker, error) {
 		Str("database", config.DatabasePath).
 		Bool("alert_unusual", config.AlertOnUnusualCountry).
 		Int("expected_countries", len(expectedCountries)).
+		Time("build_date", buildDate(db)).
 		Msg("GeoIP tracker initialized")
 
 	return tracker, nil
 }
 
+// openDatabase reads the database into memory rather than mapping the file,
+// so an updater rewriting the file in place cannot break lookups in flight.
+// A probe lookup rejects files that parse but are truncated or corrupt.
+func openDatabase(path string) (*geoip2.Reader, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := geoip2.FromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.City(net.IPv4(1, 1, 1, 1)); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("database lookup failed: %w", err)
+	}
+	return db, nil
+}
+
+// buildDate returns when the database was built
+func buildDate(db *geoip2.Reader) time.Time {
+	return time.Unix(int64(db.Metadata().BuildEpoch), 0).UTC()
+}
+
+// Path returns the database file the tracker reads
+func (t *Tracker) Path() string {
+	return t.path
+}
+
+// Reload reopens the database file and swaps it in. A file that cannot be
+// opened, such as one an updater is still writing, leaves the current
+// database in use and returns the error.
+func (t *Tracker) Reload() error {
+	if !t.enabled {
+		return nil
+	}
+
+	db, err := openDatabase(t.path)
+	if err != nil {
+		log.Warn().Err(err).Str("path", t.path).Msg("GeoIP database reload failed, keeping the current database")
+		return err
+	}
+
+	t.dbMutex.Lock()
+	old := t.db
+	t.db = db
+	t.dbMutex.Unlock()
+	if old != nil {
+		old.Close()
+	}
+
+	// Cached locations came from the old database
+	t.cacheMutex.Lock()
+	t.locationCache = make(map[string]*Location)
+	t.cacheMutex.Unlock()
+
+	log.Info().
+		Str("path", t.path).
+		Time("build_date", buildDate(db)).
+		Msg("GeoIP database reloaded")
+	return nil
+}
+
 // Lookup performs a GeoIP lookup for the given IP address
 func (t *Tracker) Lookup(ipStr string) (*Location, error) {
 	if !t.enabled {
@@ -145,7 +214,9 @@ func (t *Tracker) Lookup(ipStr string) (*Location, error) {
 	}
 
 	// Perform GeoIP lookup
+	t.dbMutex.RLock()
 	record, err := t.db.City(ip)
+	t.dbMutex.RUnlock()
 	if err != nil {
 		t.statsMutex.Lock()
 		t.stats.LookupsFailed++
@@ -293,7 +364,12 @@ func (t *Tracker) IsEnabled() bool {
 
 // Close closes the GeoIP database
 func (t *Tracker) Close() error {
-	if !t.enabled || t.db == nil {
+	if !t.enabled {
+		return nil
+	}
+	t.dbMutex.Lock()
+	defer t.dbMutex.Unlock()
+	if t.db == nil {
 		return nil
 	}
 	return t.db.Close()
@@ -2,6 +2,7 @@ package geoip
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -341,3 +342,85 @@ func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
 }
+
+// writeCityDB writes a minimal GeoLite2-City database mapping every IPv4
+// address to country
+func writeCityDB(t *testing.T, path, country string, buildEpoch uint64) {
+	t.Helper()
+	str := func(s string) []byte { return append([]byte{2<<5 | byte(len(s))}, s...) }
+	uint16v := func(v uint16) []byte { return []byte{5<<5 | 2, byte(v >> 8), byte(v)} }
+
+	var db []byte
+	// One search tree node whose records both point at the first data record:
+	// node_count + 16 + offset 0
+	db = append(db, 0, 0, 17, 0, 0, 17)
+	db = append(db, make([]byte, 16)...)
+
+	// {"country": {"iso_code": country}}
+	db = append(db, 7<<5|1)
+	db = append(db, str("country")...)
+	db = append(db, 7<<5|1)
+	db = append(db, str("iso_code")...)
+	db = append(db, str(country)...)
+
+	db = append(db, "\xab\xcd\xefMaxMind.com"...)
+	db = append(db, 7<<5|7)
+	db = append(db, str("node_count")...)
+	db = append(db, 6<<5|1, 1)
+	db = append(db, str("record_size")...)
+	db = append(db, uint16v(24)...)
+	db = append(db, str("ip_version")...)
+	db = append(db, uint16v(4)...)
+	db = append(db, str("database_type")...)
+	db = append(db, str("GeoLite2-City")...)
+	db = append(db, str("binary_format_major_version")...)
+	db = append(db, uint16v(2)...)
+	db = append(db, str("binary_format_minor_version")...)
+	db = append(db, uint16v(0)...)
+	db = append(db, str("build_epoch")...)
+	db = append(db, 0<<5|4, 9-7, byte(buildEpoch>>24), byte(buildEpoch>>16), byte(buildEpoch>>8), byte(buildEpoch))
+
+	// Replace the file the way updaters do
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, db, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTracker_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	writeCityDB(t, path, "DE", 1700000000)
+
+	tracker, err := New(Config{Enabled: true, DatabasePath: path})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer tracker.Close()
+	if loc, err := tracker.Lookup("203.0.113.7"); err != nil || loc.CountryCode != "DE" {
+		t.Fatalf("expected DE, got %+v, %v", loc, err)
+	}
+
+	// A half-written file is rejected and the old database stays in use
+	if err := os.WriteFile(path, []byte("truncated"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Reload(); err == nil {
+		t.Fatal("expected reload of a corrupt file to fail")
+	}
+	tracker.ClearCache()
+	if loc, err := tracker.Lookup("203.0.113.7"); err != nil || loc.CountryCode != "DE" {
+		t.Fatalf("expected the old database to keep answering, got %+v, %v", loc, err)
+	}
+
+	writeCityDB(t, path, "US", 1710000000)
+	if err := tracker.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	// Reload drops cached locations from the old database
+	if loc, err := tracker.Lookup("203.0.113.7"); err != nil || loc.CountryCode != "US" {
+		t.Fatalf("expected US after the swap, got %+v, %v", loc, err)
+	}
+}
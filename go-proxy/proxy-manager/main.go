@@ -4,14 +4,21 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -20,14 +27,20 @@ import (
 
 	"github.com/chilla55/proxy-manager/accesslog"
 	"github.com/chilla55/proxy-manager/analytics"
+	"github.com/chilla55/proxy-manager/audit"
 	"github.com/chilla55/proxy-manager/certmonitor"
 	"github.com/chilla55/proxy-manager/config"
 	"github.com/chilla55/proxy-manager/dashboard"
 	"github.com/chilla55/proxy-manager/database"
+	"github.com/chilla55/proxy-manager/events"
 	"github.com/chilla55/proxy-manager/health"
 	"github.com/chilla55/proxy-manager/metrics"
+	"github.com/chilla55/proxy-manager/middleware"
+	"github.com/chilla55/proxy-manager/pii"
 	"github.com/chilla55/proxy-manager/proxy"
+	"github.com/chilla55/proxy-manager/readiness"
 	"github.com/chilla55/proxy-manager/registry"
+	"github.com/chilla55/proxy-manager/scheduler"
 	"github.com/chilla55/proxy-manager/traffic"
 	"github.com/chilla55/proxy-manager/watcher"
 	"github.com/chilla55/proxy-manager/webhook"
@@ -40,17 +53,35 @@ var (
 	httpAddr         = flag.String("http-addr", getEnv("HTTP_ADDR", ":80"), "HTTP listen address")
 	httpsAddr        = flag.String("https-addr", getEnv("HTTPS_ADDR", ":443"), "HTTPS listen address")
 	registryPort     = flag.Int("registry-port", getIntEnv("REGISTRY_PORT", 81), "Service registry port")
+	registryMaxLine  = flag.Int("registry-max-line", getIntEnv("REGISTRY_MAX_LINE_BYTES", registry.DefaultMaxLineSize), "Longest registry protocol line in bytes")
+	registryIdle     = flag.Duration("registry-idle-timeout", getDurationEnv("REGISTRY_IDLE_TIMEOUT", registry.DefaultIdleTimeout), "Close registry connections silent for this long (0 disables)")
+	registryApplyHz  = flag.Float64("registry-apply-rate", getFloatEnv("REGISTRY_APPLY_RATE", registry.DefaultApplyRate), "CONFIG_APPLYs per second each registry session may sustain")
+	registryApplyMax = flag.Int("registry-apply-burst", getIntEnv("REGISTRY_APPLY_BURST", registry.DefaultApplyBurst), "CONFIG_APPLYs a registry session may send back to back")
+	registryApplyQ   = flag.Int("registry-apply-queue", getIntEnv("REGISTRY_APPLY_QUEUE", registry.DefaultApplyQueue), "CONFIG_APPLYs that may wait across registry sessions before more are refused")
 	healthPort       = flag.Int("health-port", getIntEnv("HEALTH_PORT", 8080), "Health check HTTP port")
 	upstreamTimeout  = flag.Duration("upstream-timeout", getDurationEnv("UPSTREAM_CHECK_TIMEOUT", 5*time.Second), "Timeout for upstream/backend checks")
 	shutdownTimeout  = flag.Duration("shutdown-timeout", getDurationEnv("SHUTDOWN_TIMEOUT", 30*time.Second), "Graceful shutdown timeout")
 	debug            = flag.Bool("debug", getEnv("DEBUG", "0") == "1", "Enable debug logging")
 	dashboardEnabled = flag.Bool("dashboard-enabled", getEnv("DASHBOARD_ENABLED", "1") == "1", "Enable admin dashboard endpoints")
 	dbPath           = flag.String("db-path", getEnv("DB_PATH", "/data/proxy.db"), "Path to SQLite database")
+	requestIDHeader  = flag.String("request-id-header", getEnv("REQUEST_ID_HEADER", "X-Request-ID"), "Header used to read and propagate request IDs")
+	readyAllowEmpty  = flag.Bool("ready-allow-empty", getEnv("READY_ALLOW_EMPTY", "0") == "1", "Report ready even when no routes are configured")
+	exportMaxRange   = flag.Duration("log-export-max-range", getDurationEnv("LOG_EXPORT_MAX_RANGE", 7*24*time.Hour), "Longest time range a single access log export may cover")
+	validateOnly     = flag.Bool("validate", false, "Validate global and site configs, print a report and exit")
+	checkBackends    = flag.String("check-backends", getEnv("CHECK_BACKENDS", "off"), "Probe site backends when loading: off, warn (log unreachable ones) or fail (reject the site)")
+	devTLS           = flag.Bool("dev-tls", getEnv("DEV_TLS", "0") == "1", "Serve a generated self-signed certificate when none are configured (development only)")
 )
 
 func main() {
 	flag.Parse()
 
+	if *validateOnly {
+		if validateConfigs(*globalConfig, *sitesPath, os.Stdout) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Setup structured logging
 	setupLogging()
 
@@ -81,8 +112,13 @@ func main() {
 		globalCfg = getDefaultGlobalConfig()
 	}
 
+	httpsAddrs := globalCfg.GetHTTPSListeners(*httpsAddr)
+	if err := config.CheckListeners(httpsAddrs, *httpAddr, *registryPort); err != nil {
+		log.Fatal().Err(err).Msg("Invalid HTTPS listen addresses")
+	}
+
 	// Load TLS certificates
-	certificates, err := loadCertificates(globalCfg)
+	certificates, err := loadServingCertificates(globalCfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to load TLS certificates")
 	}
@@ -94,22 +130,54 @@ func main() {
 	log.Info().Int("count", len(certificates)).Msg("Loaded TLS certificates")
 
 	// Initialize database
-	db, err := database.Open(*dbPath)
+	dbOpts := database.DefaultOptions()
+	dbOpts.BusyTimeout = getDurationEnv("DB_BUSY_TIMEOUT", dbOpts.BusyTimeout)
+	dbOpts.MaxOpenConns = getIntEnv("DB_MAX_OPEN_CONNS", dbOpts.MaxOpenConns)
+	dbOpts.MaxIdleConns = getIntEnv("DB_MAX_IDLE_CONNS", dbOpts.MaxIdleConns)
+	db, err := database.OpenWithOptions(*dbPath, dbOpts)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to open database")
 	}
 	defer db.Close()
 
+	// Admin and registry control actions are recorded in the audit log
+	auditLogger := audit.NewLogger(db, true)
+
 	// Initialize Phase 2 monitoring systems
 	metricsCollector := metrics.NewCollector()
-	accessLogger := accesslog.NewLogger(db, 1000) // 1000-entry ring buffer
+	metricsCollector.SetRouteLabels(globalCfg.Metrics.RouteLabels)
+	metricsCollector.SetLabelKeys(globalCfg.Metrics.LabelKeys)
+	logBatch := accesslog.DefaultBatchConfig()
+	logBatch.QueueSize = getIntEnv("ACCESS_LOG_QUEUE_SIZE", logBatch.QueueSize)
+	logBatch.BatchSize = getIntEnv("ACCESS_LOG_BATCH_SIZE", logBatch.BatchSize)
+	logBatch.FlushInterval = getDurationEnv("ACCESS_LOG_FLUSH_INTERVAL", logBatch.FlushInterval)
+	accessLogger := accesslog.NewLoggerWithBatch(db, 1000, logBatch) // 1000-entry ring buffer
+	defer accessLogger.Close()
+	logOutput, err := setupAccessLogOutput(accessLogger, globalCfg.AccessLog)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid access log config")
+	}
+	if logOutput != nil {
+		defer logOutput.Close()
+	}
 	certMonitor := certmonitor.NewMonitor()
 	healthChecker := health.NewChecker(db)
 	analyticsAggregator := analytics.NewAggregator(1000, 10*time.Second) // 1000 samples, 10s period
 	trafficAnalyzer := traffic.NewAnalyzer(1 * time.Hour)                // 1 hour window
 
 	// Initialize webhook notifier from global config (if present)
-	notifier := initWebhookNotifier(*globalConfig)
+	webhookCfg := loadWebhookConfig(*globalConfig)
+	if err := webhookCfg.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid webhook config")
+	}
+	notifier := webhook.New(webhookCfg)
+
+	// Live event stream for the dashboard, fed by the same signals as webhooks
+	eventBus := events.NewBus()
+	accessLogger.SetEventBus(eventBus)
+
+	// Settings that can change on SIGHUP
+	settings := newRuntimeSettings(globalCfg)
 
 	// Add certificates to certificate monitor
 	for i, certMapping := range certificates {
@@ -122,108 +190,227 @@ func main() {
 		}
 	}
 
-	// Start periodic certificate expiry checks (every 6 hours)
-	certMonitor.StartPeriodicCheck(6 * time.Hour)
+	// Goroutines that stop on ctx; shutdown waits for them before closing the DB
+	var background sync.WaitGroup
+	goBackground := func(fn func()) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			fn()
+		}()
+	}
 
 	// Start alert monitors (Phase 3 Task #19)
-	go monitorHealthAlerts(ctx, healthChecker, notifier)
-	go monitorCertAlerts(ctx, certMonitor, notifier)
-	go monitorErrorRateAlerts(ctx, metricsCollector, notifier)
+	goBackground(func() { monitorHealthAlerts(ctx, healthChecker, notifier, eventBus) })
 
-	// Start daily cleanup job
-	go func() {
-		ticker := time.NewTicker(24 * time.Hour)
-		defer ticker.Stop()
+	// Remote certificates are read once now instead of at the first cert_check
+	goBackground(func() { checkRemoteCerts(ctx, certMonitor, settings, notifier, eventBus) })
 
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				log.Info().Msg("Running daily database cleanup")
-				if err := db.CleanupOldData(30); err != nil {
-					log.Error().Err(err).Msg("Database cleanup failed")
-				}
-			}
+	// Cleanup, certificate and error rate checks run as scheduled jobs
+	jobs := newJobScheduler(db, settings, certMonitor, metricsCollector, notifier, eventBus)
+	for _, job := range globalCfg.GetJobs() {
+		if err := jobs.Add(job.Schedule, job.Task); err != nil {
+			log.Fatal().Err(err).Strs("tasks", jobs.Tasks()).Msg("Invalid job in global config")
 		}
-	}()
+	}
+	goBackground(func() { jobs.Run(ctx) })
+
+	if *requestIDHeader == "" || strings.ContainsAny(*requestIDHeader, " \t\r\n:") {
+		log.Fatal().Str("header", *requestIDHeader).Msg("Invalid request ID header name")
+	}
+
+	altSvcMaxAge, err := globalCfg.GetAltSvcMaxAge()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid server.alt_svc_max_age")
+	}
+
+	trusted, err := proxy.ParseTrustedProxies(globalCfg.TrustedProxies)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid trusted_proxies")
+	}
+	proxy.SetTrustedProxies(trusted)
+	if trusted.Len() == 0 {
+		log.Info().Msg("No trusted proxies configured, forwarding headers are ignored")
+	}
+
+	adaptive, err := buildAdaptiveCompression(globalCfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid compression.adaptive")
+	}
+	proxy.SetAdaptiveCompression(adaptive)
+
+	proxyProtocol, err := buildProxyProtocol(globalCfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid server.proxy_protocol")
+	}
+
+	serverTimeouts, err := globalCfg.GetServerTimeouts()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid server timeouts")
+	}
+	pauseRetryAfter, err := globalCfg.GetPauseRetryAfter()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid pause.retry_after")
+	}
 
 	// Initialize proxy server
 	proxyServer := proxy.NewServer(proxy.Config{
-		HTTPAddr:         *httpAddr,
-		HTTPSAddr:        *httpsAddr,
-		Certificates:     certificates,
-		GlobalHeaders:    buildSecurityHeaders(globalCfg),
-		BlackholeUnknown: globalCfg.Blackhole.UnknownDomains,
-		Debug:            *debug,
-		DB:               db,
-		MetricsCollector: metricsCollector,
-		AccessLogger:     accessLogger,
-		CertMonitor:      certMonitor,
-		HealthChecker:    healthChecker,
-		Notifier:         notifier,
+		HTTPAddr:            *httpAddr,
+		HTTPSAddr:           httpsAddrs[0],
+		Certificates:        certificates,
+		GlobalHeaders:       buildSecurityHeaders(globalCfg),
+		BlackholeUnknown:    globalCfg.Blackhole.UnknownDomains,
+		Debug:               *debug,
+		DB:                  db,
+		MetricsCollector:    metricsCollector,
+		AccessLogger:        accessLogger,
+		CertMonitor:         certMonitor,
+		HealthChecker:       healthChecker,
+		Notifier:            notifier,
+		Events:              eventBus,
+		RequestIDHeader:     *requestIDHeader,
+		DisableHTTP2:        !globalCfg.HTTP2Enabled(),
+		DisableHTTP3:        !globalCfg.HTTP3Enabled(),
+		HTTP3Addr:           globalCfg.Server.HTTP3Addr,
+		DisableAltSvc:       !globalCfg.AltSvcEnabled(),
+		AltSvcMaxAge:        altSvcMaxAge,
+		CanonicalHost:       globalCfg.Defaults.Options.CanonicalHost,
+		HTTPRedirectExempt:  globalCfg.GetHTTPRedirectExempt(),
+		ProxyProtocol:       proxyProtocol,
+		HTTP3MaxConnections: globalCfg.Server.HTTP3MaxConnections,
+		Timeouts:            proxy.ServerTimeouts(serverTimeouts),
+		MaxConnections:      globalCfg.Server.MaxConnections,
+		PauseExemptPaths:    globalCfg.Pause.ExemptPaths,
+		PauseRetryAfter:     pauseRetryAfter,
 	})
 
 	// Initialize service registry (v2)
 	regV2 := registry.NewRegistryV2(*registryPort, proxyServer, *debug, *upstreamTimeout, healthChecker)
+	regV2.SetMaxLineSize(*registryMaxLine)
+	regV2.SetIdleTimeout(*registryIdle)
+	regV2.SetApplyLimit(*registryApplyHz, *registryApplyMax, *registryApplyQ)
+	regV2.SetAuditLogger(auditLogger)
+	if err := regV2.SetScheduleStore(db); err != nil {
+		log.Error().Err(err).Msg("Failed to load maintenance schedules")
+	}
+	metricsCollector.AddSource(regV2)
 
-	// Initialize site watcher
-	siteWatcher := watcher.NewSiteWatcher(*sitesPath, proxyServer, *debug)
+	// Initialize site watcher and apply static site configs before serving
+	siteWatcher := watcher.NewSiteWatcher(*sitesPath, proxyServer.Static(), *debug)
+	backendCheck, err := watcher.ParseBackendCheck(*checkBackends)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid -check-backends")
+	}
+	siteWatcher.SetBackendCheck(backendCheck, *upstreamTimeout)
+	siteWatcher.InitialLoad()
 
 	// Initialize certificate watcher
 	certWatcher := watcher.NewCertWatcher(*globalConfig, proxyServer, *debug)
 
+	// Protect the dashboard and admin API; probes stay open
+	authCfg, err := buildAuthConfig(globalCfg, *dashboardEnabled)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load dashboard credentials")
+	}
+	auth := middleware.NewAuthenticator(authCfg, "/health", "/ready")
+	if *dashboardEnabled && !authCfg.Enabled() {
+		log.Warn().Msg("Dashboard and admin API are served WITHOUT authentication (dashboard.auth.insecure)")
+	}
+	corsCfg, err := buildCORSConfig(globalCfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid dashboard.cors config")
+	}
+	cors := middleware.NewCORS(corsCfg, "/api/")
+
+	reloader := &globalReloader{
+		path:        *globalConfig,
+		proxy:       proxyServer,
+		notifier:    notifier,
+		certMonitor: certMonitor,
+		metrics:     metricsCollector,
+		settings:    settings,
+		auth:        auth,
+		cors:        cors,
+		dashboard:   *dashboardEnabled,
+		current:     globalCfg,
+		webhooks:    webhookCfg,
+		monitored:   monitoredCerts(globalCfg, certificates),
+	}
+
+	ready := buildReadiness(proxyServer, regV2, db, *readyAllowEmpty)
+
 	// Start health check server (includes dashboard when enabled)
-	go startHealthServer(ctx, *healthPort, proxyServer, metricsCollector, accessLogger, certMonitor, healthChecker, analyticsAggregator, trafficAnalyzer, db, *dashboardEnabled)
+	goBackground(func() {
+		startHealthServer(ctx, *healthPort, cors, auth, eventBus, ready, proxyServer, regV2, siteWatcher, metricsCollector, accessLogger, certMonitor, healthChecker, analyticsAggregator, trafficAnalyzer, db, buildPIIMasker(globalCfg), reloader, auditLogger, *dashboardEnabled)
+	})
 
 	// Start site watcher
-	go siteWatcher.Start(ctx)
+	goBackground(func() { siteWatcher.Start(ctx) })
 
 	// Start certificate watcher (monitors for cert renewals)
-	go func() {
+	goBackground(func() {
 		if err := certWatcher.Start(ctx); err != nil {
 			log.Printf("[proxy-manager] Certificate watcher error: %s", err)
 		}
-	}()
+	})
 
 	// Start service registry v2
-	go regV2.StartV2(ctx)
+	goBackground(func() { regV2.StartV2(ctx) })
 
 	// Start proxy servers (HTTP, HTTPS, HTTP/3)
-	go func() {
-		if err := proxyServer.Start(ctx, *httpAddr, *httpsAddr); err != nil {
+	goBackground(func() {
+		if err := proxyServer.Start(ctx, *httpAddr, httpsAddrs...); err != nil {
 			log.Error().Err(err).Msg("Proxy server error")
 		}
-	}()
+	})
 
 	log.Info().Msg("All services started successfully")
 
-	// Wait for shutdown signal
+	// Wait for shutdown signal, reloading global config on SIGHUP
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	sig := <-sigChan
+	for sig == syscall.SIGHUP {
+		log.Info().Str("path", *globalConfig).Msg("SIGHUP received, reloading global config")
+		changes, err := reloader.Reload()
+		result := audit.ResultOK
+		if err != nil {
+			log.Error().Err(err).Msg("Global config reload rejected, keeping current configuration")
+			result = "error: " + err.Error()
+		}
+		auditLogger.Record(audit.AuditEntry{
+			User:         "signal:SIGHUP",
+			Action:       audit.ActionConfigReload,
+			ResourceType: "config",
+			ResourceID:   *globalConfig,
+			NewValue:     strings.Join(changes, "; "),
+			Result:       result,
+		})
+		sig = <-sigChan
+	}
 
 	log.Info().Str("signal", sig.String()).Msg("Shutdown signal received")
 
-	// Create shutdown context with timeout
+	// The whole shutdown, drain included, is bounded by shutdownTimeout
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), *shutdownTimeout)
 	defer shutdownCancel()
 
-	// Notify all connected services
-	log.Info().Msg("Notifying connected services...")
-	// regV2 handles shutdown notifications internally via connection close
+	// 1. Stop accepting registry connections; connected services keep their
+	// routes so in-flight requests can still reach them
+	regV2.StopAccepting()
 
-	// Give services time to receive shutdown notification
-	time.Sleep(2 * time.Second)
+	// 2. Stop accepting HTTP connections and wait for in-flight requests and
+	// WebSockets; /ready reports not ready from here on
+	log.Info().Dur("timeout", *shutdownTimeout).Msg("Draining in-flight requests")
+	if err := proxyServer.Shutdown(shutdownCtx); err != nil {
+		log.Warn().Err(err).Msg("Drain did not complete, remaining connections were closed")
+	}
 
-	// Cancel main context to stop all goroutines
+	// 3. Stop background work: registry sessions, watchers, monitors, health server
 	cancel()
-
-	// Wait for graceful shutdown or timeout
 	done := make(chan struct{})
 	go func() {
-		// Wait for all background goroutines
-		time.Sleep(1 * time.Second)
+		background.Wait()
 		close(done)
 	}()
 
@@ -233,9 +420,44 @@ func main() {
 	case <-shutdownCtx.Done():
 		log.Warn().Msg("Shutdown timeout exceeded, forcing exit")
 	}
+	// 4. Deferred: flush the access log queue, then close the DB
 }
 
-func startHealthServer(ctx context.Context, port int, proxyServer *proxy.Server, metricsCollector *metrics.Collector, accessLogger *accesslog.Logger, certMonitor *certmonitor.Monitor, healthChecker *health.Checker, analyticsAggregator *analytics.Aggregator, trafficAnalyzer *traffic.Analyzer, dbConn *database.DB, dashboardEnabled bool) {
+// buildReadiness registers the subsystems that must be up before /ready
+// lets traffic in
+func buildReadiness(proxyServer *proxy.Server, regV2 *registry.RegistryV2, db *database.DB, allowEmpty bool) *readiness.Checker {
+	ready := readiness.New()
+	ready.Add("certificates", func(ctx context.Context) error {
+		if proxyServer.CertificateCount() == 0 {
+			return fmt.Errorf("no TLS certificates loaded")
+		}
+		return nil
+	})
+	ready.Add("database", func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+	ready.Add("registry", func(ctx context.Context) error {
+		if !regV2.Listening() {
+			return fmt.Errorf("registry listener not bound")
+		}
+		return nil
+	})
+	ready.Add("shutdown", func(ctx context.Context) error {
+		if proxyServer.Draining() {
+			return fmt.Errorf("draining connections")
+		}
+		return nil
+	})
+	ready.Add("routes", func(ctx context.Context) error {
+		if !allowEmpty && proxyServer.RouteCount() == 0 {
+			return fmt.Errorf("no routes configured (set READY_ALLOW_EMPTY=1 to allow)")
+		}
+		return nil
+	})
+	return ready
+}
+
+func startHealthServer(ctx context.Context, port int, cors *middleware.CORS, auth *middleware.Authenticator, eventBus *events.Bus, ready *readiness.Checker, proxyServer *proxy.Server, regV2 *registry.RegistryV2, siteWatcher *watcher.SiteWatcher, metricsCollector *metrics.Collector, accessLogger *accesslog.Logger, certMonitor *certmonitor.Monitor, healthChecker *health.Checker, analyticsAggregator *analytics.Aggregator, trafficAnalyzer *traffic.Analyzer, dbConn *database.DB, piiMasker *pii.Masker, reloader *globalReloader, auditLogger *audit.Logger, dashboardEnabled bool) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -246,28 +468,39 @@ func startHealthServer(ctx context.Context, port int, proxyServer *proxy.Server,
 		http.Redirect(w, r, "/dashboard", http.StatusTemporaryRedirect)
 	})
 
-	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("ready"))
-	})
+	mux.Handle("/ready", ready)
 
 	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
 		w.Write([]byte(metricsCollector.PrometheusMetrics()))
 	})
 
-	mux.HandleFunc("/api/logs/recent", func(w http.ResponseWriter, r *http.Request) {
+	// Numbered stats for computing deltas between two readings, e.g. in a
+	// load test after POST /api/admin/metrics/reset
+	mux.HandleFunc("GET /api/metrics/snapshot", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		entries := accessLogger.GetRecentRequests(100)
-		fmt.Fprintf(w, "%v", entries)
+		json.NewEncoder(w).Encode(metricsCollector.Snapshot())
 	})
 
-	mux.HandleFunc("/api/logs/errors", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		entries := accessLogger.GetRecentErrors(50)
-		fmt.Fprintf(w, "%v", entries)
+	mux.HandleFunc("/api/logs/recent", func(w http.ResponseWriter, r *http.Request) {
+		serveAccessLog(w, r, accessLogger, dbConn, 100, false)
 	})
 
+	// With ?clear=true, returns the in-memory errors and removes them
+	mux.HandleFunc("/api/logs/errors", clearableSample(dashboardEnabled, auditLogger, "errors", func(w http.ResponseWriter, r *http.Request) {
+		serveAccessLog(w, r, accessLogger, dbConn, 50, true)
+	}, func(w http.ResponseWriter, r *http.Request) {
+		entries := accessLogger.TakeErrors()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(accessLogPage{
+			Entries: entries,
+			Total:   len(entries),
+			Limit:   len(entries),
+			Source:  "memory",
+			Cleared: true,
+		})
+	}))
+
 	mux.HandleFunc("/api/logs/stats", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		stats := accessLogger.GetStats()
@@ -277,7 +510,7 @@ func startHealthServer(ctx context.Context, port int, proxyServer *proxy.Server,
 	mux.HandleFunc("/api/certs", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		certs := certMonitor.GetAllCertificates()
-		fmt.Fprintf(w, "%v", certs)
+		json.NewEncoder(w).Encode(certs)
 	})
 
 	mux.HandleFunc("/api/certs/expiring", func(w http.ResponseWriter, r *http.Request) {
@@ -287,15 +520,17 @@ func startHealthServer(ctx context.Context, port int, proxyServer *proxy.Server,
 			level = certmonitor.LevelWarning
 		}
 		certs := certMonitor.GetExpiringCertificates(level)
-		fmt.Fprintf(w, "%v", certs)
+		json.NewEncoder(w).Encode(certs)
 	})
 
 	mux.HandleFunc("/api/certs/stats", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		stats := certMonitor.GetStats()
-		fmt.Fprintf(w, "%v", stats)
+		json.NewEncoder(w).Encode(stats)
 	})
 
+	registerCertReport(mux, certMonitor)
+
 	mux.HandleFunc("/api/health/services", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		statuses := healthChecker.GetAllStatuses()
@@ -310,8 +545,10 @@ func startHealthServer(ctx context.Context, port int, proxyServer *proxy.Server,
 
 	mux.HandleFunc("/api/analytics/metrics", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		aggregated := analyticsAggregator.GetAggregatedMetrics()
-		fmt.Fprintf(w, "%v", aggregated)
+		json.NewEncoder(w).Encode(struct {
+			analytics.AggregatedMetrics
+			Upstream metrics.UpstreamBreakdown `json:"upstream"`
+		}{analyticsAggregator.GetAggregatedMetrics(), metricsCollector.UpstreamBreakdown()})
 	})
 
 	mux.HandleFunc("/api/traffic/analysis", func(w http.ResponseWriter, r *http.Request) {
@@ -393,6 +630,34 @@ func startHealthServer(ctx context.Context, port int, proxyServer *proxy.Server,
 		})
 	})
 
+	// Slowest proxied requests of the last hour: /api/analytics/slowest?limit=20.
+	// With ?clear=true, returns all samples and starts a new sample.
+	mux.HandleFunc("GET /api/analytics/slowest", clearableSample(dashboardEnabled, auditLogger, "slowest", func(w http.ResponseWriter, r *http.Request) {
+		limit := 20
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "limit must be a positive integer"})
+				return
+			}
+			limit = n
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"requests":       metricsCollector.SlowestRequests(limit),
+			"window_seconds": int(metricsCollector.SlowestWindow().Seconds()),
+		})
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"requests":       metricsCollector.TakeSlowestRequests(),
+			"window_seconds": int(metricsCollector.SlowestWindow().Seconds()),
+			"cleared":        true,
+		})
+	}))
+
 	mux.HandleFunc("/api/analytics/heatmap", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		period := r.URL.Query().Get("period")
@@ -496,14 +761,56 @@ func startHealthServer(ctx context.Context, port int, proxyServer *proxy.Server,
 	if err := dash.Start(ctx, mux); err != nil {
 		log.Error().Err(err).Msg("Failed to start dashboard")
 	}
+	if dashboardEnabled {
+		registerSiteAdmin(mux, siteWatcher, auditLogger)
+		registerCircuitBreakerAdmin(mux, proxyServer, auditLogger)
+		registerPauseAdmin(mux, proxyServer, auditLogger)
+		registerMaintenanceAdmin(mux, regV2, auditLogger)
+
+		// Zeroes the cumulative counters for a load test baseline; returns the
+		// snapshot taken just before
+		metricsResource := func(*http.Request) string { return "collector" }
+		mux.HandleFunc("POST /api/admin/metrics/reset", auditLogger.Handler(audit.ActionMetricsReset, "metrics", metricsResource, func(w http.ResponseWriter, r *http.Request) {
+			before := metricsCollector.Reset()
+			log.Warn().Uint64("snapshot_id", before.ID).Uint64("requests", before.Stats.TotalRequests).Msg("Metrics counters reset via admin API")
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"reset": true, "before": before})
+		}))
+		registerWebhookAdmin(mux, reloader.notifier, auditLogger)
+
+		// Audit trail: /api/audit?user=&action=&resource_type=&resource_id=&result=ok|error&since=&until=&limit=
+		mux.HandleFunc("GET /api/audit", auditLogger.APIHandler())
+
+		mux.HandleFunc("GET /api/db/stats", func(w http.ResponseWriter, r *http.Request) {
+			stats, err := dbConn.Stats()
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to collect database stats")
+				http.Error(w, "failed to collect database stats", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(stats)
+		})
+
+		registerQueryAPI(mux, dbConn)
+		registerLogExport(mux, dbConn, piiMasker, *exportMaxRange)
+		registerEffectiveConfig(mux, reloader, proxyServer)
+
+		// Server-Sent Events: /api/events/stream?types=error,health
+		mux.Handle("GET /api/events/stream", eventBus)
+	}
 
 	addr := fmt.Sprintf(":%d", port)
 	server := &http.Server{
 		Addr:    addr,
-		Handler: mux,
+		Handler: cors.Wrap(auth.Wrap(mux)),
+		// Request contexts end with ctx so event streams close on shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
 
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		<-ctx.Done()
 		log.Info().Str("addr", addr).Msg("Shutting down health server")
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -514,8 +821,13 @@ func startHealthServer(ctx context.Context, port int, proxyServer *proxy.Server,
 	}()
 
 	log.Info().Str("addr", addr).Msg("Health check server starting")
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Error().Err(err).Msg("Health server error")
+	if err := server.ListenAndServe(); err != nil {
+		if err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("Health server error")
+			return
+		}
+		// ListenAndServe returns as soon as Shutdown starts; wait for it to finish
+		<-stopped
 	}
 }
 
@@ -540,31 +852,590 @@ func parsePeriod(s string) time.Duration {
 	return 24 * time.Hour
 }
 
-// initWebhookNotifier loads webhook configuration from the global YAML
-func initWebhookNotifier(globalConfigPath string) *webhook.Notifier {
+// accessLogPage is the response envelope of /api/logs/recent and /api/logs/errors
+type accessLogPage struct {
+	Entries    []database.AccessLogEntry `json:"entries"`
+	Total      int                       `json:"total"`
+	Limit      int                       `json:"limit"`
+	Offset     int                       `json:"offset"`
+	NextCursor string                    `json:"next_cursor,omitempty"`
+	Source     string                    `json:"source"` // "database" or "memory"
+	Cleared    bool                      `json:"cleared,omitempty"`
+}
+
+// serveAccessLog answers a paged, filtered access log query. Query params:
+// limit, offset, cursor, domain, status (404, 5xx, 400-499), method, since
+// (24h, 7d), request_id. Reads the database and falls back to the in-memory ring buffer.
+func serveAccessLog(w http.ResponseWriter, r *http.Request, accessLogger *accesslog.Logger, dbConn *database.DB, defaultLimit int, errorsOnly bool) {
+	q := r.URL.Query()
+	badRequest := func(err error) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	}
+
+	filter := database.AccessLogFilter{
+		Domain:    q.Get("domain"),
+		Method:    q.Get("method"),
+		RequestID: q.Get("request_id"),
+		Limit:     defaultLimit,
+	}
+	var err error
+	if filter.StatusMin, filter.StatusMax, err = database.ParseStatusFilter(q.Get("status")); err != nil {
+		badRequest(err)
+		return
+	}
+	if errorsOnly && filter.StatusMin < 400 {
+		filter.StatusMin = 400
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 {
+			badRequest(fmt.Errorf("invalid limit %q", v))
+			return
+		}
+		if filter.Limit > 1000 {
+			filter.Limit = 1000
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if filter.Offset, err = strconv.Atoi(v); err != nil || filter.Offset < 0 {
+			badRequest(fmt.Errorf("invalid offset %q", v))
+			return
+		}
+	}
+	if v := q.Get("cursor"); v != "" {
+		if filter.Cursor, err = strconv.ParseInt(v, 10, 64); err != nil || filter.Cursor <= 0 {
+			badRequest(fmt.Errorf("invalid cursor %q", v))
+			return
+		}
+	}
+	if v := q.Get("since"); v != "" {
+		d, err := database.ParseQueryDuration(v)
+		if err != nil {
+			badRequest(fmt.Errorf("since: %w", err))
+			return
+		}
+		// The proxy records access log timestamps in milliseconds
+		filter.Since = time.Now().Add(-d).UnixMilli()
+	}
+
+	page := accessLogPage{Limit: filter.Limit, Offset: filter.Offset, Source: "database"}
+	var next int64
+	if dbConn != nil {
+		page.Entries, page.Total, next, err = dbConn.QueryAccessLog(filter)
+		if err != nil {
+			log.Warn().Err(err).Msg("Access log query failed, using in-memory buffer")
+		}
+	}
+	if dbConn == nil || err != nil {
+		page.Source = "memory"
+		next = 0
+		page.Entries, page.Total = accessLogger.Query(filter)
+	}
+	if next > 0 {
+		page.NextCursor = strconv.FormatInt(next, 10)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// registerSiteAdmin adds the site config admin endpoints
+func registerSiteAdmin(mux *http.ServeMux, siteWatcher *watcher.SiteWatcher, auditLogger *audit.Logger) {
+	mux.HandleFunc("GET /api/admin/sites", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(siteWatcher.Sites())
+	})
+
+	siteName := func(r *http.Request) string { return r.PathValue("name") }
+	mux.HandleFunc("POST /api/admin/sites/{name}/reload", auditLogger.Handler(audit.ActionSiteReload, "site", siteName, func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		w.Header().Set("Content-Type", "application/json")
+
+		delta, err := siteWatcher.ReloadSite(name)
+		if err != nil {
+			status := http.StatusUnprocessableEntity
+			if errors.Is(err, watcher.ErrSiteNotFound) {
+				status = http.StatusNotFound
+			}
+			log.Warn().Err(err).Str("site", name).Msg("Site reload via admin API failed")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"site": name, "error": err.Error()})
+			return
+		}
+
+		log.Info().Str("site", name).Str("delta", delta.String()).Msg("Site reloaded via admin API")
+		json.NewEncoder(w).Encode(map[string]interface{}{"site": name, "delta": delta})
+	}))
+}
+
+// registerCircuitBreakerAdmin adds the endpoint forcing a route's circuit
+// breaker: POST /api/admin/circuit-breaker?route=domain/path&mode=open|close|auto
+func registerCircuitBreakerAdmin(mux *http.ServeMux, proxyServer *proxy.Server, auditLogger *audit.Logger) {
+	routeParam := func(r *http.Request) string { return r.URL.Query().Get("route") }
+	mux.HandleFunc("POST /api/admin/circuit-breaker", auditLogger.Handler(audit.ActionCircuitForce, "route", routeParam, func(w http.ResponseWriter, r *http.Request) {
+		route, mode := r.URL.Query().Get("route"), r.URL.Query().Get("mode")
+		domain, path, _ := strings.Cut(route, "/")
+		path = "/" + path
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := proxyServer.ForceCircuitBreaker([]string{domain}, path, mode); err != nil {
+			// A valid mode leaves the route as what was not found
+			status := http.StatusNotFound
+			if mode != proxy.CircuitForceOpen && mode != proxy.CircuitForceClose && mode != proxy.CircuitForceAuto {
+				status = http.StatusBadRequest
+			}
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"route": route, "error": err.Error()})
+			return
+		}
+
+		log.Warn().Str("route", route).Str("mode", mode).Msg("Circuit breaker forced via admin API")
+		result := map[string]interface{}{"route": route, "mode": mode}
+		if backend := proxyServer.GetBackendStatus(domain, path); backend != nil {
+			result["state"] = backend.CircuitState
+			result["forced"] = backend.CircuitForced
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+}
+
+// registerPauseAdmin adds the global pause switch: pause answers every
+// route with 503 until resume, leaving the routes configured
+func registerPauseAdmin(mux *http.ServeMux, proxyServer *proxy.Server, auditLogger *audit.Logger) {
+	mux.HandleFunc("GET /api/admin/pause", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(proxyServer.PauseStatus())
+	})
+
+	proxyResource := func(*http.Request) string { return "all" }
+	mux.HandleFunc("POST /api/admin/pause", auditLogger.Handler(audit.ActionProxyPause, "proxy", proxyResource, func(w http.ResponseWriter, r *http.Request) {
+		changed := proxyServer.Pause(r.URL.Query().Get("reason"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"changed": changed, "status": proxyServer.PauseStatus()})
+	}))
+	mux.HandleFunc("POST /api/admin/resume", auditLogger.Handler(audit.ActionProxyResume, "proxy", proxyResource, func(w http.ResponseWriter, r *http.Request) {
+		changed := proxyServer.Resume()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"changed": changed, "status": proxyServer.PauseStatus()})
+	}))
+}
+
+// registerMaintenanceAdmin adds maintenance across registry services, for
+// coordinated deploys:
+// POST /api/admin/maintenance?services=a,b|all&action=enter|exit[&url=&eta=&reason=]
+func registerMaintenanceAdmin(mux *http.ServeMux, regV2 *registry.RegistryV2, auditLogger *audit.Logger) {
+	servicesParam := func(r *http.Request) string { return r.URL.Query().Get("services") }
+	mux.HandleFunc("POST /api/admin/maintenance", auditLogger.Handler(audit.ActionMaintenanceBulk, "service", servicesParam, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+
+		action := q.Get("action")
+		var services []string
+		for _, name := range strings.Split(q.Get("services"), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				services = append(services, name)
+			}
+		}
+		if action != "enter" && action != "exit" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "action must be enter or exit"})
+			return
+		}
+		if len(services) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "services is required, a list of names or all"})
+			return
+		}
+
+		results := regV2.SetServicesMaintenance(services, action == "enter", q.Get("url"), q.Get("eta"), q.Get("reason"))
+		changed, registered := 0, 0
+		for _, result := range results {
+			changed += len(result.Routes)
+			if result.Error == "" {
+				registered++
+			}
+		}
+		log.Warn().Strs("services", services).Str("action", action).Int("routes", changed).Msg("Bulk maintenance via admin API")
+
+		// No service matched; the audit entry records it as a failure
+		if registered == 0 {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"action": action, "routes": changed, "services": results})
+	}))
+}
+
+// clearableSample serves ?clear=true requests with clear, which returns the
+// current samples and resets them, and all others with read. Clearing
+// discards data, so it needs the dashboard and is audited.
+func clearableSample(dashboardEnabled bool, auditLogger *audit.Logger, sample string, read, clear http.HandlerFunc) http.HandlerFunc {
+	sampleName := func(*http.Request) string { return sample }
+	audited := auditLogger.Handler(audit.ActionSamplesClear, "sample", sampleName, clear)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("clear") != "true" {
+			read(w, r)
+			return
+		}
+		if !dashboardEnabled {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "clear requires the dashboard to be enabled"})
+			return
+		}
+		audited(w, r)
+	}
+}
+
+// webhookDestination is a configured webhook with its last delivery
+type webhookDestination struct {
+	effectiveTarget
+	LastDelivery *webhook.Delivery `json:"last_delivery"`
+}
+
+// registerWebhookAdmin adds the webhook admin endpoints: the configured
+// destinations, and a test alert sent to one of them
+func registerWebhookAdmin(mux *http.ServeMux, notifier *webhook.Notifier, auditLogger *audit.Logger) {
+	mux.HandleFunc("GET /api/admin/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		hooks := notifier.Webhooks()
+		list := make([]webhookDestination, 0, len(hooks))
+		for _, hook := range hooks {
+			dest := webhookDestination{effectiveTarget: newEffectiveTarget(hook)}
+			if d, ok := notifier.LastDelivery(hook.Name); ok {
+				dest.LastDelivery = &d
+			}
+			list = append(list, dest)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"enabled": notifier.IsEnabled(), "webhooks": list})
+	})
+
+	webhookName := func(r *http.Request) string { return r.PathValue("name") }
+	mux.HandleFunc("POST /api/admin/webhooks/{name}/test", auditLogger.Handler(audit.ActionWebhookTest, "webhook", webhookName, func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		w.Header().Set("Content-Type", "application/json")
+
+		d, err := notifier.Test(name)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"webhook": name, "error": err.Error()})
+			return
+		}
+		if !d.OK() {
+			// The request was fine; the destination was not
+			log.Warn().Str("webhook", name).Str("error", d.Error).Msg("Webhook test delivery failed")
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"webhook": name, "ok": d.OK(), "delivery": d})
+	}))
+}
+
+// registerQueryAPI adds the allowlisted analytics query endpoints. Only
+// queries registered in the database package can run, never raw SQL.
+func registerQueryAPI(mux *http.ServeMux, dbConn *database.DB) {
+	mux.HandleFunc("GET /api/db/queries", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(database.NamedQueries())
+	})
+
+	mux.HandleFunc("GET /api/db/query", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		name := query.Get("name")
+		limit, _ := strconv.Atoi(query.Get("limit"))
+
+		params := map[string]string{}
+		for key := range query {
+			if key != "name" && key != "limit" {
+				params[key] = query.Get(key)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		result, err := dbConn.RunNamedQuery(r.Context(), name, params, limit)
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, database.ErrUnknownQuery):
+				status = http.StatusNotFound
+			case errors.Is(err, database.ErrInvalidParam):
+				status = http.StatusBadRequest
+			case errors.Is(err, context.DeadlineExceeded):
+				status = http.StatusGatewayTimeout
+			default:
+				log.Error().Err(err).Str("query", name).Msg("Named query failed")
+			}
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"query": name, "error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(result)
+	})
+}
+
+// accessLogExportHeader is the CSV header row of /api/logs/export
+var accessLogExportHeader = []string{
+	"timestamp", "domain", "method", "path", "query", "status", "response_time_ms",
+	"backend", "backend_ip", "client_ip", "user_agent", "referer",
+	"bytes_sent", "bytes_received", "protocol", "error", "request_id",
+	"upstream_connect_ms", "upstream_tls_ms", "upstream_ttfb_ms",
+}
+
+// formatMs formats a millisecond timing for CSV, empty when not recorded
+func formatMs(ms float64) string {
+	if ms == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(ms, 'f', 3, 64)
+}
+
+// registerLogExport adds the access log download:
+// /api/logs/export?since=&until=&domain=&format=csv|json
+// since and until are RFC 3339 times or durations before now ("24h", "7d");
+// they default to the last 24 hours. Entries stream from the database with
+// PII masking applied, so the range size does not affect memory use.
+func registerLogExport(mux *http.ServeMux, dbConn *database.DB, masker *pii.Masker, maxRange time.Duration) {
+	mux.HandleFunc("GET /api/logs/export", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		badRequest := func(err error) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		}
+		if dbConn == nil {
+			http.Error(w, "access log persistence is disabled", http.StatusServiceUnavailable)
+			return
+		}
+
+		now := time.Now()
+		until, err := parseExportTime(q.Get("until"), now, now)
+		if err != nil {
+			badRequest(fmt.Errorf("until: %w", err))
+			return
+		}
+		since, err := parseExportTime(q.Get("since"), now, until.Add(-24*time.Hour))
+		if err != nil {
+			badRequest(fmt.Errorf("since: %w", err))
+			return
+		}
+		if !since.Before(until) {
+			badRequest(fmt.Errorf("since must be before until"))
+			return
+		}
+		if maxRange > 0 && until.Sub(since) > maxRange {
+			badRequest(fmt.Errorf("range %v exceeds the maximum of %v", until.Sub(since), maxRange))
+			return
+		}
+
+		format := q.Get("format")
+		if format == "" {
+			format = "csv"
+		}
+		var contentType string
+		switch format {
+		case "csv":
+			contentType = "text/csv; charset=utf-8"
+		case "json":
+			contentType = "application/x-ndjson"
+		default:
+			badRequest(fmt.Errorf("format must be csv or json"))
+			return
+		}
+
+		filter := database.AccessLogFilter{
+			Domain: q.Get("domain"),
+			// The proxy records access log timestamps in milliseconds
+			Since: since.UnixMilli(),
+			Until: until.UnixMilli(),
+		}
+		ext := map[string]string{"csv": "csv", "json": "jsonl"}[format]
+		filename := fmt.Sprintf("access-log-%s-%s.%s", since.UTC().Format("20060102T150405Z"), until.UTC().Format("20060102T150405Z"), ext)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.Header().Set("Cache-Control", "no-store")
+
+		var write func(database.AccessLogEntry) error
+		var flush func() error
+		if format == "csv" {
+			cw := csv.NewWriter(w)
+			if err := cw.Write(accessLogExportHeader); err != nil {
+				return
+			}
+			write = func(e database.AccessLogEntry) error {
+				return cw.Write([]string{
+					time.UnixMilli(e.Timestamp).UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+					e.Domain, e.Method, e.Path, e.Query, strconv.Itoa(e.Status),
+					strconv.FormatInt(e.ResponseTimeMs, 10), e.Backend, e.BackendIP, e.ClientIP,
+					e.UserAgent, e.Referer, strconv.FormatUint(e.BytesSent, 10),
+					strconv.FormatUint(e.BytesReceived, 10), e.Protocol, e.Error, e.RequestID,
+					formatMs(e.UpstreamConnectMs), formatMs(e.UpstreamTLSMs), formatMs(e.UpstreamTTFBMs),
+				})
+			}
+			flush = func() error {
+				cw.Flush()
+				return cw.Error()
+			}
+		} else {
+			enc := json.NewEncoder(w)
+			write = func(e database.AccessLogEntry) error { return enc.Encode(e) }
+			flush = func() error { return nil }
+		}
+
+		rows := 0
+		err = dbConn.ExportAccessLog(r.Context(), filter, func(e database.AccessLogEntry) error {
+			rows++
+			return write(maskAccessLogEntry(masker, e))
+		})
+		if err == nil {
+			err = flush()
+		}
+		// Headers are already sent; a failed export shows as a truncated file
+		if err != nil && r.Context().Err() == nil {
+			log.Error().Err(err).Int("rows", rows).Msg("Access log export failed")
+			return
+		}
+		log.Info().Str("format", format).Str("domain", filter.Domain).Time("since", since).Time("until", until).
+			Int("rows", rows).Msg("Access log exported")
+	})
+}
+
+// certReportHeader lists the CSV columns of the certificate report
+var certReportHeader = []string{
+	"domains", "dns_names", "subject", "issuer", "serial_number",
+	"not_before", "not_after", "days_remaining", "warning_level", "expired",
+	"limited_by", "limited_by_subject",
+}
+
+// registerCertReport adds the certificate expiry report, every monitored
+// certificate sorted soonest expiry first: /api/certs/report?format=json|csv
+func registerCertReport(mux *http.ServeMux, certMonitor *certmonitor.Monitor) {
+	mux.HandleFunc("GET /api/certs/report", func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		report := certMonitor.Report(now)
+
+		format := r.URL.Query().Get("format")
+		switch format {
+		case "", "json":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"generated_at": now.UTC(),
+				"count":        len(report),
+				"certificates": report,
+			})
+		case "csv":
+			filename := fmt.Sprintf("cert-report-%s.csv", now.UTC().Format("20060102"))
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+			cw := csv.NewWriter(w)
+			cw.Write(certReportHeader)
+			for _, c := range report {
+				cw.Write([]string{
+					strings.Join(c.Domains, " "), strings.Join(c.DNSNames, " "), c.Subject, c.Issuer, c.SerialNumber,
+					c.NotBefore.UTC().Format(time.RFC3339), c.NotAfter.UTC().Format(time.RFC3339),
+					strconv.Itoa(c.DaysRemaining), c.WarningLevel, strconv.FormatBool(c.Expired),
+					c.LimitedBy, c.LimitedBySubject,
+				})
+			}
+			cw.Flush()
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "format must be json or csv"})
+		}
+	})
+}
+
+// parseExportTime parses an RFC 3339 time or a duration before now; empty
+// returns def
+func parseExportTime(v string, now, def time.Time) (time.Time, error) {
+	if v == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	d, err := database.ParseQueryDuration(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected an RFC 3339 time or a duration, got %q", v)
+	}
+	return now.Add(-d), nil
+}
+
+// maskAccessLogEntry applies the PII settings to the exported fields that
+// can identify a visitor
+func maskAccessLogEntry(masker *pii.Masker, e database.AccessLogEntry) database.AccessLogEntry {
+	if !masker.Enabled() {
+		return e
+	}
+	e.ClientIP = masker.MaskIP(e.ClientIP)
+	if e.Query != "" {
+		if values, err := url.ParseQuery(e.Query); err == nil {
+			e.Query = masker.MaskQueryParams(values).Encode()
+		}
+	}
+	if e.Referer != "" {
+		e.Referer = masker.MaskURL(e.Referer)
+	}
+	return e
+}
+
+// setupAccessLogOutput writes access log lines to the output in
+// global.yaml. The format is checked even without an output. The returned
+// closer is the output file, nil for none or a standard stream.
+func setupAccessLogOutput(accessLogger *accesslog.Logger, cfg config.AccessLogConfig) (io.Closer, error) {
+	format, err := accesslog.ParseFormat(cfg.Format)
+	if err != nil {
+		return nil, fmt.Errorf("access_log.format: %w", err)
+	}
+
+	var output io.Writer
+	var file *os.File
+	switch cfg.Output {
+	case "":
+		return nil, nil
+	case "stdout":
+		output = os.Stdout
+	case "stderr":
+		output = os.Stderr
+	default:
+		if file, err = os.OpenFile(cfg.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+			return nil, fmt.Errorf("access_log.output: %w", err)
+		}
+		output = file
+	}
+	accessLogger.SetOutput(output, format)
+	log.Info().Str("output", cfg.Output).Str("format", format.Name()).Msg("Writing access log lines")
+	if file == nil {
+		return nil, nil
+	}
+	return file, nil
+}
+
+// loadWebhookConfig loads webhook configuration from the global YAML
+func loadWebhookConfig(globalConfigPath string) webhook.Config {
 	// Minimal loader that looks for a top-level 'webhooks' and optional 'enabled'
 	type raw struct {
 		Webhooks []webhook.Webhook `yaml:"webhooks"`
 		Enabled  *bool             `yaml:"webhooks_enabled"`
 	}
-	data, err := os.ReadFile(globalConfigPath)
+	data, err := config.ReadGlobalYAML(globalConfigPath)
 	if err != nil {
 		// Fallback: disabled notifier
-		return webhook.New(webhook.Config{Enabled: false})
+		return webhook.Config{Enabled: false}
 	}
 	var r raw
 	if err := yaml.Unmarshal(data, &r); err != nil {
-		return webhook.New(webhook.Config{Enabled: false})
+		return webhook.Config{Enabled: false}
 	}
 	enabled := true
 	if r.Enabled != nil {
 		enabled = *r.Enabled
 	}
-	return webhook.New(webhook.Config{Enabled: enabled, Webhooks: r.Webhooks})
+	return webhook.Config{Enabled: enabled, Webhooks: r.Webhooks}
 }
 
-// monitorHealthAlerts sends alerts on service_down transitions
-func monitorHealthAlerts(ctx context.Context, checker *health.Checker, notifier *webhook.Notifier) {
+// monitorHealthAlerts sends alerts on service_down transitions and publishes
+// every status change to the event stream
+func monitorHealthAlerts(ctx context.Context, checker *health.Checker, notifier *webhook.Notifier, bus *events.Bus) {
 	prev := map[string]string{}
 	ticker := time.NewTicker(15 * time.Second)
 	defer ticker.Stop()
@@ -575,8 +1446,16 @@ func monitorHealthAlerts(ctx context.Context, checker *health.Checker, notifier
 		case <-ticker.C:
 			statuses := checker.GetAllStatuses()
 			for svc, st := range statuses {
+				if prev[svc] != "" && prev[svc] != st.Status && st.Status != string(health.StatusDown) {
+					bus.Publish(events.Event{
+						Type:     events.TypeHealth,
+						Severity: "info",
+						Message:  fmt.Sprintf("%s is %s (was %s)", svc, st.Status, prev[svc]),
+						Data:     map[string]interface{}{"service": svc, "from": prev[svc], "to": st.Status},
+					})
+				}
 				if prev[svc] != st.Status && st.Status == string(health.StatusDown) {
-					_ = notifier.Send(webhook.Alert{
+					sendAlert(notifier, bus, events.TypeHealth, webhook.Alert{
 						Event:       webhook.EventServiceDown,
 						Title:       "🚨 Service Down Alert",
 						Description: fmt.Sprintf("%s is not responding", svc),
@@ -595,93 +1474,167 @@ func monitorHealthAlerts(ctx context.Context, checker *health.Checker, notifier
 	}
 }
 
-// monitorCertAlerts sends alerts for certificates expiring soon (7/14/30 days)
-func monitorCertAlerts(ctx context.Context, cm *certmonitor.Monitor, notifier *webhook.Notifier) {
-	ticker := time.NewTicker(6 * time.Hour)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			// 7 days
-			for _, info := range cm.GetExpiringCertificates(certmonitor.LevelCritical) {
-				_ = notifier.Send(webhook.Alert{
-					Event:       webhook.EventCertExpiring7d,
-					Title:       "⚠️ Certificate Expiring <= 7d",
-					Description: fmt.Sprintf("%s expires in %d days", info.Domain, info.DaysRemaining),
-					Severity:    "warning",
-					Fields: map[string]string{
-						"Domain":         info.Domain,
-						"Days Remaining": fmt.Sprintf("%d", info.DaysRemaining),
-						"Expiry":         info.NotAfter.UTC().Format(time.RFC3339),
-					},
-					Timestamp: time.Now(),
-				})
-			}
-			// 14 days
-			for _, info := range cm.GetExpiringCertificates(certmonitor.LevelUrgent) {
-				_ = notifier.Send(webhook.Alert{
-					Event:       webhook.EventCertExpiring14d,
-					Title:       "⚠️ Certificate Expiring <= 14d",
-					Description: fmt.Sprintf("%s expires in %d days", info.Domain, info.DaysRemaining),
-					Severity:    "warning",
-					Fields: map[string]string{
-						"Domain":         info.Domain,
-						"Days Remaining": fmt.Sprintf("%d", info.DaysRemaining),
-						"Expiry":         info.NotAfter.UTC().Format(time.RFC3339),
-					},
-					Timestamp: time.Now(),
-				})
+// newJobScheduler registers the tasks jobs in global.yaml can schedule
+func newJobScheduler(db *database.DB, settings *runtimeSettings, cm *certmonitor.Monitor, mc *metrics.Collector, notifier *webhook.Notifier, bus *events.Bus) *scheduler.Scheduler {
+	s := scheduler.New()
+	s.Register("cleanup", func(ctx context.Context) error {
+		days := settings.RetentionDays()
+		log.Info().Int("retention_days", days).Msg("Running database cleanup")
+		if err := db.CleanupOldData(days); err != nil {
+			return fmt.Errorf("database cleanup: %w", err)
+		}
+		if auditDays := settings.AuditLogDays(); auditDays > 0 {
+			if err := db.CleanupAuditLogs(auditDays); err != nil {
+				return fmt.Errorf("audit log cleanup: %w", err)
 			}
-			// 30 days
-			for _, info := range cm.GetExpiringCertificates(certmonitor.LevelWarning) {
-				_ = notifier.Send(webhook.Alert{
-					Event:       webhook.EventCertExpiring30d,
-					Title:       "⚠️ Certificate Expiring <= 30d",
-					Description: fmt.Sprintf("%s expires in %d days", info.Domain, info.DaysRemaining),
-					Severity:    "info",
-					Fields: map[string]string{
-						"Domain":         info.Domain,
-						"Days Remaining": fmt.Sprintf("%d", info.DaysRemaining),
-						"Expiry":         info.NotAfter.UTC().Format(time.RFC3339),
-					},
-					Timestamp: time.Now(),
-				})
+		}
+		if vacuum, threshold := settings.Vacuum(); vacuum {
+			if _, err := db.Compact(threshold); err != nil {
+				return fmt.Errorf("database compaction: %w", err)
 			}
 		}
+		return nil
+	})
+	s.Register("vacuum", func(ctx context.Context) error {
+		_, threshold := settings.Vacuum()
+		if _, err := db.Compact(threshold); err != nil {
+			return fmt.Errorf("database compaction: %w", err)
+		}
+		return nil
+	})
+	s.Register("cert_check", func(ctx context.Context) error {
+		if cm.IsEnabled() {
+			cm.CheckAll()
+			checkRemoteCerts(ctx, cm, settings, notifier, bus)
+		}
+		sendCertAlerts(cm, notifier, bus)
+		return nil
+	})
+	s.Register("error_rate_check", newErrorRateCheck(mc, notifier, settings, bus))
+	return s
+}
+
+// sendCertAlerts sends alerts for certificates expiring soon (7/14/30 days)
+func sendCertAlerts(cm *certmonitor.Monitor, notifier *webhook.Notifier, bus *events.Bus) {
+	// 7 days
+	for _, info := range cm.GetExpiringCertificates(certmonitor.LevelCritical) {
+		sendAlert(notifier, bus, events.TypeCert, webhook.Alert{
+			Event:       webhook.EventCertExpiring7d,
+			Title:       "⚠️ Certificate Expiring <= 7d",
+			Description: certAlertDescription(info),
+			Severity:    "warning",
+			Fields:      certAlertFields(info),
+			Timestamp:   time.Now(),
+		})
+	}
+	// 14 days
+	for _, info := range cm.GetExpiringCertificates(certmonitor.LevelUrgent) {
+		sendAlert(notifier, bus, events.TypeCert, webhook.Alert{
+			Event:       webhook.EventCertExpiring14d,
+			Title:       "⚠️ Certificate Expiring <= 14d",
+			Description: certAlertDescription(info),
+			Severity:    "warning",
+			Fields:      certAlertFields(info),
+			Timestamp:   time.Now(),
+		})
+	}
+	// 30 days
+	for _, info := range cm.GetExpiringCertificates(certmonitor.LevelWarning) {
+		sendAlert(notifier, bus, events.TypeCert, webhook.Alert{
+			Event:       webhook.EventCertExpiring30d,
+			Title:       "⚠️ Certificate Expiring <= 30d",
+			Description: certAlertDescription(info),
+			Severity:    "info",
+			Fields:      certAlertFields(info),
+			Timestamp:   time.Now(),
+		})
+	}
+}
+
+// checkRemoteCerts refreshes the certificates of the remote targets and
+// alerts on targets that could not be checked
+func checkRemoteCerts(ctx context.Context, cm *certmonitor.Monitor, settings *runtimeSettings, notifier *webhook.Notifier, bus *events.Bus) {
+	targets, timeout := settings.RemoteCerts()
+	for address, err := range cm.CheckRemote(ctx, targets, timeout) {
+		sendAlert(notifier, bus, events.TypeCert, webhook.Alert{
+			Event:       webhook.EventCertCheckFailed,
+			Title:       "⚠️ Certificate Check Failed",
+			Description: fmt.Sprintf("Could not read the certificate of %s: %v", address, err),
+			Severity:    "warning",
+			Fields: map[string]string{
+				"Target": address,
+				"Error":  err.Error(),
+			},
+			Timestamp: time.Now(),
+		})
+	}
+}
+
+// certAlertDescription names the chain element that expires first when it
+// is not the leaf
+func certAlertDescription(info *certmonitor.CertInfo) string {
+	if info.LimitedBy == certmonitor.RoleIntermediate {
+		return fmt.Sprintf("%s: intermediate certificate %s expires in %d days", info.Domain, info.LimitedBySubject, info.DaysRemaining)
+	}
+	return fmt.Sprintf("%s expires in %d days", info.Domain, info.DaysRemaining)
+}
+
+func certAlertFields(info *certmonitor.CertInfo) map[string]string {
+	fields := map[string]string{
+		"Domain":         info.Domain,
+		"Days Remaining": fmt.Sprintf("%d", info.DaysRemaining),
+		"Expiry":         info.NotAfter.UTC().Format(time.RFC3339),
+		"Limited By":     info.LimitedBy,
+	}
+	if info.LimitedBy == certmonitor.RoleIntermediate {
+		fields["Intermediate"] = info.LimitedBySubject
+		fields["Leaf Expiry"] = info.LeafNotAfter.UTC().Format(time.RFC3339)
 	}
+	return fields
 }
 
-// monitorErrorRateAlerts sends alerts when error rate spikes above threshold
-func monitorErrorRateAlerts(ctx context.Context, mc *metrics.Collector, notifier *webhook.Notifier) {
-	const threshold = 5.0 // percent
+// newErrorRateCheck returns a task that alerts when the error rate rises
+// above the threshold, once per spike
+func newErrorRateCheck(mc *metrics.Collector, notifier *webhook.Notifier, settings *runtimeSettings, bus *events.Bus) scheduler.Task {
 	prevHigh := false
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			stats := mc.GetStats()
-			high := stats.ErrorRate > threshold
-			if high && !prevHigh {
-				_ = notifier.Send(webhook.Alert{
-					Event:       webhook.EventHighErrorRate,
-					Title:       "⚠️ High Error Rate",
-					Description: fmt.Sprintf("Error rate is %.2f%% (threshold %.2f%%)", stats.ErrorRate, threshold),
-					Severity:    "warning",
-					Fields: map[string]string{
-						"Total Requests": fmt.Sprintf("%d", stats.TotalRequests),
-						"Total Errors":   fmt.Sprintf("%d", stats.TotalErrors),
-					},
-					Timestamp: time.Now(),
-				})
-			}
-			prevHigh = high
+	return func(ctx context.Context) error {
+		stats := mc.GetStats()
+		threshold := settings.ErrorRateThreshold()
+		high := stats.ErrorRate > threshold
+		if high && !prevHigh {
+			sendAlert(notifier, bus, events.TypeAlert, webhook.Alert{
+				Event:       webhook.EventHighErrorRate,
+				Title:       "⚠️ High Error Rate",
+				Description: fmt.Sprintf("Error rate is %.2f%% (threshold %.2f%%)", stats.ErrorRate, threshold),
+				Severity:    "warning",
+				Fields: map[string]string{
+					"Total Requests": fmt.Sprintf("%d", stats.TotalRequests),
+					"Total Errors":   fmt.Sprintf("%d", stats.TotalErrors),
+				},
+				Timestamp: time.Now(),
+			})
 		}
+		prevHigh = high
+		return nil
+	}
+}
+
+// sendAlert sends a webhook alert and publishes it to the event stream
+func sendAlert(notifier *webhook.Notifier, bus *events.Bus, eventType string, alert webhook.Alert) {
+	_ = notifier.Send(alert)
+
+	data := make(map[string]interface{}, len(alert.Fields)+1)
+	for k, v := range alert.Fields {
+		data[k] = v
 	}
+	data["event"] = string(alert.Event)
+	bus.Publish(events.Event{
+		Type:     eventType,
+		Time:     alert.Timestamp,
+		Severity: alert.Severity,
+		Message:  alert.Description,
+		Data:     data,
+	})
 }
 
 // setupLogging configures zerolog based on environment
@@ -750,6 +1703,66 @@ func validateConfiguration() error {
 	return nil
 }
 
+// buildProxyProtocol returns the load balancers whose PROXY protocol header
+// is read, nil when server.proxy_protocol is off
+func buildProxyProtocol(cfg *config.GlobalConfig) (*proxy.TrustedProxies, error) {
+	if !cfg.Server.ProxyProtocol.Enabled {
+		return nil, nil
+	}
+	return proxy.ParseTrustedProxies(cfg.Server.ProxyProtocol.Trusted)
+}
+
+// buildPIIMasker converts defaults.options.pii from the global config
+func buildPIIMasker(cfg *config.GlobalConfig) *pii.Masker {
+	p := cfg.Defaults.Options.PII.GetPII()
+	return pii.NewMasker(pii.Config{
+		Enabled:           *p.Enabled,
+		MaskIPMethod:      p.MaskIPMethod,
+		MaskIPv6Method:    p.MaskIPv6Method,
+		StripHeaders:      p.StripHeaders,
+		MaskQueryParams:   p.MaskQueryParams,
+		PreserveLocalhost: *p.PreserveLocalhost,
+	})
+}
+
+// buildAuthConfig resolves dashboard credentials from the global config
+// buildAuthConfig converts dashboard.auth from the global config. With the
+// dashboard on, the control endpoints are served, so credentials are required
+// unless dashboard.auth.insecure opts out. Without it only read-only
+// endpoints exist and they stay open when no credentials are set.
+func buildAuthConfig(cfg *config.GlobalConfig, dashboardEnabled bool) (middleware.AuthConfig, error) {
+	username, password, token, err := cfg.Dashboard.Auth.Resolve()
+	if err != nil {
+		return middleware.AuthConfig{}, err
+	}
+	authCfg := middleware.AuthConfig{
+		Username:       username,
+		Password:       password,
+		Token:          token,
+		AllowAnonymous: !dashboardEnabled || cfg.Dashboard.Auth.Insecure,
+	}
+	if !authCfg.Enabled() && !authCfg.AllowAnonymous {
+		return middleware.AuthConfig{}, fmt.Errorf("the dashboard needs dashboard.auth credentials; set dashboard.auth.insecure: true to run it without them (local development only)")
+	}
+	return authCfg, nil
+}
+
+// buildCORSConfig converts dashboard.cors from the global config
+func buildCORSConfig(cfg *config.GlobalConfig) (middleware.CORSConfig, error) {
+	c := cfg.Dashboard.CORS
+	if err := c.Validate(); err != nil {
+		return middleware.CORSConfig{}, err
+	}
+	maxAge, _ := c.GetMaxAge()
+	return middleware.CORSConfig{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   c.AllowedHeaders,
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           maxAge,
+	}, nil
+}
+
 func buildSecurityHeaders(cfg *config.GlobalConfig) proxy.SecurityHeaders {
 	headers := proxy.SecurityHeaders{}
 
@@ -762,14 +1775,38 @@ func buildSecurityHeaders(cfg *config.GlobalConfig) proxy.SecurityHeaders {
 		headers.ReferrerPolicy = cfg.Defaults.Headers["Referrer-Policy"]
 		headers.PermissionsPolicy = cfg.Defaults.Headers["Permissions-Policy"]
 	}
+	headers.StripResponse = cfg.Defaults.ResponseHeaders.Strip
+	headers.HideServer = cfg.Defaults.ResponseHeaders.HideServer
+	for _, warning := range cfg.HeaderWarnings() {
+		log.Warn().Str("warning", warning).Msg("defaults.headers")
+	}
 
 	return headers
 }
 
+// buildAdaptiveCompression converts compression.adaptive, nil when disabled
+func buildAdaptiveCompression(cfg *config.GlobalConfig) (*proxy.AdaptiveCompression, error) {
+	c := cfg.Compression.Adaptive
+	if !c.Enabled {
+		return nil, nil
+	}
+	interval, err := c.GetInterval()
+	if err != nil {
+		return nil, err
+	}
+	return &proxy.AdaptiveCompression{
+		CPUHigh:        c.GetCPUPercent() / 100,
+		CPUCritical:    c.CriticalCPUPercent / 100,
+		GoroutinesHigh: c.Goroutines,
+		ReducedLevel:   c.GetReducedLevel(),
+		Interval:       interval,
+	}, nil
+}
+
 // loadCertificates loads TLS certificates from global config
 func loadCertificates(cfg *config.GlobalConfig) ([]proxy.CertMapping, error) {
 	if len(cfg.TLS.Certificates) == 0 {
-		return nil, fmt.Errorf("no certificates defined in global config")
+		return nil, fmt.Errorf("no certificates defined in global config (--dev-tls generates one for local development)")
 	}
 
 	certificates := make([]proxy.CertMapping, 0, len(cfg.TLS.Certificates))
@@ -835,6 +1872,15 @@ func getIntEnv(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultValue
+}
+
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -23,8 +24,24 @@ type Collector struct {
 	totalBytesSent     uint64
 	totalBytesReceived uint64
 
-	// Active connections
+	// Active connections (requests in flight)
 	activeConnections int64
+	inFlightByRoute   map[string]*int64
+
+	// Per-route series for /metrics, bounded by the route label allowlist
+	routeLabels   map[string]struct{}
+	labeledRoutes map[string]*RouteMetrics
+
+	// Per-label-value series for /metrics, bounded by the label key list
+	// and MaxLabelValues
+	labelKeys   map[string]struct{}
+	labelValues map[string]map[string]*labelCounts // key -> value -> counts
+
+	// Slowest recent requests
+	slowest *SlowSampler
+
+	// Upstream connect, TLS and time-to-first-byte breakdown
+	upstream *upstreamTimings
 
 	// WebSocket tracking
 	websocketActive         int64
@@ -33,6 +50,16 @@ type Collector struct {
 	websocketBytesToBackend uint64
 	websocketDurationSum    uint64 // nanoseconds
 
+	// QUIC (HTTP/3) connections
+	quicActive     int64
+	quicHandshakes uint64
+	quicRejected   uint64
+
+	// TCP client connections on the HTTP and HTTPS listeners
+	clientConnActive   int64
+	clientConnAccepted uint64
+	clientConnRejected uint64
+
 	// Retry tracking
 	retryAttempts  uint64
 	retrySuccesses uint64
@@ -48,13 +75,46 @@ type Collector struct {
 	// WAF
 	wafBlocks uint64
 
+	// Request mirroring
+	mirrorSent    uint64
+	mirrorFailed  uint64
+	mirrorSkipped uint64
+
+	// Requests refused by backend_rate_limit, by backend URL
+	backendRateLimited map[string]*uint64
+
+	// Adaptive compression
+	compressionPressure int64             // 0 normal, 1 reduced, 2 off
+	compressionLevels   map[string]*int64 // Algorithm -> level last used
+
+	// Other components' metrics, e.g. the service registry
+	sources []Source
+
 	// Start time
 	startTime time.Time
 
+	// Snapshots and resets, see snapshot.go
+	resetMu     sync.RWMutex // Held shared while a request is recorded, exclusively by Reset
+	snapshotSeq uint64
+	resets      uint64
+	resetAt     time.Time
+
 	// Mutex for maps
 	mu sync.RWMutex
 }
 
+// Source provides metrics in the Prometheus text format
+type Source interface {
+	PrometheusMetrics() string
+}
+
+// AddSource appends src's metrics to PrometheusMetrics
+func (c *Collector) AddSource(src Source) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sources = append(c.sources, src)
+}
+
 // RouteMetrics tracks metrics for a specific route
 type RouteMetrics struct {
 	Requests      uint64
@@ -76,19 +136,32 @@ type Histogram struct {
 // NewCollector creates a new metrics collector
 func NewCollector() *Collector {
 	c := &Collector{
-		requestsByStatus: make(map[int]*uint64),
-		requestsByRoute:  make(map[string]*RouteMetrics),
-		requestDurations: NewHistogram(),
-		startTime:        time.Now(),
+		requestsByStatus:   newStatusCounters(),
+		requestsByRoute:    make(map[string]*RouteMetrics),
+		requestDurations:   NewHistogram(),
+		inFlightByRoute:    make(map[string]*int64),
+		routeLabels:        make(map[string]struct{}),
+		labeledRoutes:      make(map[string]*RouteMetrics),
+		labelKeys:          make(map[string]struct{}),
+		labelValues:        make(map[string]map[string]*labelCounts),
+		compressionLevels:  make(map[string]*int64),
+		backendRateLimited: make(map[string]*uint64),
+		slowest:            NewSlowSampler(50, time.Hour),
+		upstream:           &upstreamTimings{},
+		startTime:          time.Now(),
 	}
 
-	// Initialize common status codes
+	return c
+}
+
+// newStatusCounters returns the per-status counters, with the common status
+// codes present at zero
+func newStatusCounters() map[int]*uint64 {
+	counters := make(map[int]*uint64)
 	for _, status := range []int{200, 201, 204, 301, 302, 304, 400, 401, 403, 404, 429, 500, 502, 503, 504} {
-		count := uint64(0)
-		c.requestsByStatus[status] = &count
+		counters[status] = new(uint64)
 	}
-
-	return c
+	return counters
 }
 
 // NewHistogram creates a new histogram
@@ -98,7 +171,7 @@ func NewHistogram() *Histogram {
 	}
 
 	// Initialize buckets (seconds)
-	for _, bucket := range []string{"0.1", "0.5", "1.0", "5.0", "10.0", "+Inf"} {
+	for _, bucket := range histogramBuckets {
 		count := uint64(0)
 		h.buckets[bucket] = &count
 	}
@@ -108,6 +181,9 @@ func NewHistogram() *Histogram {
 
 // RecordRequest records a completed request
 func (c *Collector) RecordRequest(route, method string, status int, duration time.Duration, bytesSent, bytesReceived uint64) {
+	c.resetMu.RLock()
+	defer c.resetMu.RUnlock()
+
 	// Total counters
 	atomic.AddUint64(&c.totalRequests, 1)
 	if status >= 400 {
@@ -204,6 +280,55 @@ func (c *Collector) DecrementActiveConnections() {
 	atomic.AddInt64(&c.activeConnections, -1)
 }
 
+// IncrementRouteInFlight marks a request to route as in flight. Pair each
+// call with DecrementRouteInFlight.
+func (c *Collector) IncrementRouteInFlight(route string) {
+	c.mu.RLock()
+	gauge, ok := c.inFlightByRoute[route]
+	c.mu.RUnlock()
+	if !ok {
+		c.mu.Lock()
+		if gauge, ok = c.inFlightByRoute[route]; !ok {
+			gauge = new(int64)
+			c.inFlightByRoute[route] = gauge
+		}
+		c.mu.Unlock()
+	}
+	atomic.AddInt64(gauge, 1)
+}
+
+// DecrementRouteInFlight marks a request to route as finished
+func (c *Collector) DecrementRouteInFlight(route string) {
+	c.mu.RLock()
+	gauge, ok := c.inFlightByRoute[route]
+	c.mu.RUnlock()
+	if ok {
+		atomic.AddInt64(gauge, -1)
+	}
+}
+
+// ObserveRequestDuration offers a completed request to the slowest-requests
+// sampler
+func (c *Collector) ObserveRequestDuration(sample SlowSample) {
+	c.slowest.Observe(sample)
+}
+
+// SlowestRequests returns up to limit of the slowest recent requests,
+// slowest first
+func (c *Collector) SlowestRequests(limit int) []SlowSample {
+	return c.slowest.Slowest(limit)
+}
+
+// TakeSlowestRequests returns all slowest-request samples and clears them
+func (c *Collector) TakeSlowestRequests() []SlowSample {
+	return c.slowest.Take()
+}
+
+// SlowestWindow returns how far back SlowestRequests looks
+func (c *Collector) SlowestWindow() time.Duration {
+	return c.slowest.Window()
+}
+
 // RecordRateLimitViolation records a rate limit violation
 func (c *Collector) RecordRateLimitViolation() {
 	atomic.AddUint64(&c.rateLimitViolations, 1)
@@ -220,6 +345,39 @@ func (c *Collector) DecrementWebSocketActive() {
 	atomic.AddInt64(&c.websocketActive, -1)
 }
 
+// IncrementQUICActive counts a new QUIC connection, before its handshake
+func (c *Collector) IncrementQUICActive() {
+	atomic.AddInt64(&c.quicActive, 1)
+	atomic.AddUint64(&c.quicHandshakes, 1)
+}
+
+// DecrementQUICActive decrements active QUIC connections
+func (c *Collector) DecrementQUICActive() {
+	atomic.AddInt64(&c.quicActive, -1)
+}
+
+// RecordQUICRejected counts a QUIC connection refused by the limit
+func (c *Collector) RecordQUICRejected() {
+	atomic.AddUint64(&c.quicRejected, 1)
+}
+
+// IncrementClientConnections counts a new connection on the HTTP or HTTPS
+// listeners
+func (c *Collector) IncrementClientConnections() {
+	atomic.AddInt64(&c.clientConnActive, 1)
+	atomic.AddUint64(&c.clientConnAccepted, 1)
+}
+
+// DecrementClientConnections decrements open client connections
+func (c *Collector) DecrementClientConnections() {
+	atomic.AddInt64(&c.clientConnActive, -1)
+}
+
+// RecordClientConnectionRejected counts a connection refused by the limit
+func (c *Collector) RecordClientConnectionRejected() {
+	atomic.AddUint64(&c.clientConnRejected, 1)
+}
+
 // RecordWebSocketTransfer records bytes and duration for a websocket session
 func (c *Collector) RecordWebSocketTransfer(bytesToClient, bytesToBackend uint64, duration time.Duration) {
 	atomic.AddUint64(&c.websocketBytesToClient, bytesToClient)
@@ -257,6 +415,56 @@ func (c *Collector) RecordWAFBlock() {
 	atomic.AddUint64(&c.wafBlocks, 1)
 }
 
+// RecordMirror counts a mirrored request by result: "sent", "failed" or "skipped"
+func (c *Collector) RecordMirror(result string) {
+	switch result {
+	case "sent":
+		atomic.AddUint64(&c.mirrorSent, 1)
+	case "failed":
+		atomic.AddUint64(&c.mirrorFailed, 1)
+	case "skipped":
+		atomic.AddUint64(&c.mirrorSkipped, 1)
+	}
+}
+
+// RecordBackendRateLimited counts a request refused because backend was over
+// its backend_rate_limit
+func (c *Collector) RecordBackendRateLimited(backend string) {
+	c.mu.RLock()
+	counter, ok := c.backendRateLimited[backend]
+	c.mu.RUnlock()
+	if !ok {
+		c.mu.Lock()
+		if counter, ok = c.backendRateLimited[backend]; !ok {
+			counter = new(uint64)
+			c.backendRateLimited[backend] = counter
+		}
+		c.mu.Unlock()
+	}
+	atomic.AddUint64(counter, 1)
+}
+
+// SetCompressionPressure records the adaptive compression state
+func (c *Collector) SetCompressionPressure(state int32) {
+	atomic.StoreInt64(&c.compressionPressure, int64(state))
+}
+
+// RecordCompressionLevel records the level a response was compressed with
+func (c *Collector) RecordCompressionLevel(algo string, level int) {
+	c.mu.RLock()
+	gauge, ok := c.compressionLevels[algo]
+	c.mu.RUnlock()
+	if !ok {
+		c.mu.Lock()
+		if gauge, ok = c.compressionLevels[algo]; !ok {
+			gauge = new(int64)
+			c.compressionLevels[algo] = gauge
+		}
+		c.mu.Unlock()
+	}
+	atomic.StoreInt64(gauge, int64(level))
+}
+
 // GetStats returns current statistics
 func (c *Collector) GetStats() Stats {
 	c.mu.RLock()
@@ -269,10 +477,17 @@ func (c *Collector) GetStats() Stats {
 		TotalBytesSent:          atomic.LoadUint64(&c.totalBytesSent),
 		TotalBytesReceived:      atomic.LoadUint64(&c.totalBytesReceived),
 		ActiveConnections:       atomic.LoadInt64(&c.activeConnections),
+		InFlightRequests:        atomic.LoadInt64(&c.activeConnections),
 		WebSocketActive:         atomic.LoadInt64(&c.websocketActive),
 		WebSocketConnections:    atomic.LoadUint64(&c.websocketConnections),
 		WebSocketBytesToClient:  atomic.LoadUint64(&c.websocketBytesToClient),
 		WebSocketBytesToBackend: atomic.LoadUint64(&c.websocketBytesToBackend),
+		QUICActive:              atomic.LoadInt64(&c.quicActive),
+		QUICHandshakes:          atomic.LoadUint64(&c.quicHandshakes),
+		QUICRejected:            atomic.LoadUint64(&c.quicRejected),
+		ClientConnections:       atomic.LoadInt64(&c.clientConnActive),
+		ClientConnAccepted:      atomic.LoadUint64(&c.clientConnAccepted),
+		ClientConnRejected:      atomic.LoadUint64(&c.clientConnRejected),
 		RateLimitViolations:     atomic.LoadUint64(&c.rateLimitViolations),
 		WAFBlocks:               atomic.LoadUint64(&c.wafBlocks),
 		RetryAttempts:           atomic.LoadUint64(&c.retryAttempts),
@@ -282,6 +497,11 @@ func (c *Collector) GetStats() Stats {
 		SlowCriticals:           atomic.LoadUint64(&c.slowCriticals),
 		RequestsByStatus:        make(map[int]uint64),
 		RouteMetrics:            make(map[string]RouteStats),
+		InFlightByRoute:         make(map[string]int64, len(c.inFlightByRoute)),
+	}
+
+	for route, gauge := range c.inFlightByRoute {
+		stats.InFlightByRoute[route] = atomic.LoadInt64(gauge)
 	}
 
 	wsDurSum := atomic.LoadUint64(&c.websocketDurationSum)
@@ -327,11 +547,19 @@ type Stats struct {
 	TotalBytesSent           uint64                `json:"total_bytes_sent"`
 	TotalBytesReceived       uint64                `json:"total_bytes_received"`
 	ActiveConnections        int64                 `json:"active_connections"`
+	InFlightRequests         int64                 `json:"in_flight_requests"`
+	InFlightByRoute          map[string]int64      `json:"in_flight_by_route"`
 	WebSocketActive          int64                 `json:"websocket_active"`
 	WebSocketConnections     uint64                `json:"websocket_connections"`
 	WebSocketBytesToClient   uint64                `json:"websocket_bytes_to_client"`
 	WebSocketBytesToBackend  uint64                `json:"websocket_bytes_to_backend"`
 	WebSocketAverageDuration float64               `json:"websocket_average_duration_seconds"`
+	QUICActive               int64                 `json:"quic_active"`
+	QUICHandshakes           uint64                `json:"quic_handshakes"`
+	QUICRejected             uint64                `json:"quic_rejected"`
+	ClientConnections        int64                 `json:"client_connections"`
+	ClientConnAccepted       uint64                `json:"client_connections_accepted"`
+	ClientConnRejected       uint64                `json:"client_connections_rejected"`
 	RateLimitViolations      uint64                `json:"rate_limit_violations"`
 	WAFBlocks                uint64                `json:"waf_blocks"`
 	RetryAttempts            uint64                `json:"retry_attempts"`
@@ -391,6 +619,10 @@ func (c *Collector) PrometheusMetrics() string {
 	out += "# TYPE proxy_active_connections gauge\n"
 	out += formatMetric("proxy_active_connections", stats.ActiveConnections)
 
+	out += "# HELP proxy_requests_in_flight Requests currently being served\n"
+	out += "# TYPE proxy_requests_in_flight gauge\n"
+	out += formatMetric("proxy_requests_in_flight", stats.InFlightRequests)
+
 	out += "# HELP proxy_websocket_active Current active WebSocket connections\n"
 	out += "# TYPE proxy_websocket_active gauge\n"
 	out += formatMetric("proxy_websocket_active", stats.WebSocketActive)
@@ -411,6 +643,30 @@ func (c *Collector) PrometheusMetrics() string {
 	out += "# TYPE proxy_websocket_average_duration_seconds gauge\n"
 	out += formatMetric("proxy_websocket_average_duration_seconds", stats.WebSocketAverageDuration)
 
+	out += "# HELP proxy_quic_active_connections Current open QUIC (HTTP/3) connections\n"
+	out += "# TYPE proxy_quic_active_connections gauge\n"
+	out += formatMetric("proxy_quic_active_connections", stats.QUICActive)
+
+	out += "# HELP proxy_quic_handshakes_total QUIC connections accepted for a handshake\n"
+	out += "# TYPE proxy_quic_handshakes_total counter\n"
+	out += formatMetric("proxy_quic_handshakes_total", stats.QUICHandshakes)
+
+	out += "# HELP proxy_quic_rejected_total QUIC connections refused by http3_max_connections\n"
+	out += "# TYPE proxy_quic_rejected_total counter\n"
+	out += formatMetric("proxy_quic_rejected_total", stats.QUICRejected)
+
+	out += "# HELP proxy_client_connections Current open TCP connections on the HTTP and HTTPS listeners\n"
+	out += "# TYPE proxy_client_connections gauge\n"
+	out += formatMetric("proxy_client_connections", stats.ClientConnections)
+
+	out += "# HELP proxy_client_connections_accepted_total TCP connections accepted on the HTTP and HTTPS listeners\n"
+	out += "# TYPE proxy_client_connections_accepted_total counter\n"
+	out += formatMetric("proxy_client_connections_accepted_total", stats.ClientConnAccepted)
+
+	out += "# HELP proxy_client_connections_rejected_total TCP connections refused by server.max_connections\n"
+	out += "# TYPE proxy_client_connections_rejected_total counter\n"
+	out += formatMetric("proxy_client_connections_rejected_total", stats.ClientConnRejected)
+
 	// rate limiting
 	out += "# HELP proxy_rate_limit_violations_total Total rate limit violations\n"
 	out += "# TYPE proxy_rate_limit_violations_total counter\n"
@@ -448,23 +704,62 @@ func (c *Collector) PrometheusMetrics() string {
 		out += formatMetricWithLabel("proxy_requests_by_status_total", count, "status", status)
 	}
 
-	// route metrics
-	out += "# HELP proxy_route_requests_total Total requests per route\n"
-	out += "# TYPE proxy_route_requests_total counter\n"
-	for route, rm := range stats.RouteMetrics {
-		out += formatMetricWithLabel("proxy_route_requests_total", rm.Requests, "route", route)
+	// request mirroring
+	out += "# HELP proxy_mirror_requests_total Requests copied to mirror backends by result\n"
+	out += "# TYPE proxy_mirror_requests_total counter\n"
+	out += formatMetricWithLabel("proxy_mirror_requests_total", atomic.LoadUint64(&c.mirrorSent), "result", "sent")
+	out += formatMetricWithLabel("proxy_mirror_requests_total", atomic.LoadUint64(&c.mirrorFailed), "result", "failed")
+	out += formatMetricWithLabel("proxy_mirror_requests_total", atomic.LoadUint64(&c.mirrorSkipped), "result", "skipped")
+
+	// backend rate limits
+	out += "# HELP proxy_backend_rate_limited_total Requests refused because the backend was over its backend_rate_limit\n"
+	out += "# TYPE proxy_backend_rate_limited_total counter\n"
+	c.mu.RLock()
+	limited := make([]string, 0, len(c.backendRateLimited))
+	for backend := range c.backendRateLimited {
+		limited = append(limited, backend)
+	}
+	sort.Strings(limited)
+	for _, backend := range limited {
+		out += formatMetricWithLabel("proxy_backend_rate_limited_total", atomic.LoadUint64(c.backendRateLimited[backend]), "backend", backend)
 	}
+	c.mu.RUnlock()
 
-	out += "# HELP proxy_route_errors_total Total errors per route\n"
-	out += "# TYPE proxy_route_errors_total counter\n"
-	for route, rm := range stats.RouteMetrics {
-		out += formatMetricWithLabel("proxy_route_errors_total", rm.Errors, "route", route)
+	// adaptive compression
+	pressure := atomic.LoadInt64(&c.compressionPressure)
+	out += "# HELP proxy_compression_pressure Adaptive compression state (0 normal, 1 reduced, 2 off)\n"
+	out += "# TYPE proxy_compression_pressure gauge\n"
+	out += formatMetric("proxy_compression_pressure", pressure)
+
+	out += "# HELP proxy_compression_effective_level Level of the latest compressed response per algorithm, -1 while compression is off\n"
+	out += "# TYPE proxy_compression_effective_level gauge\n"
+	c.mu.RLock()
+	algos := make([]string, 0, len(c.compressionLevels))
+	for algo := range c.compressionLevels {
+		algos = append(algos, algo)
+	}
+	sort.Strings(algos)
+	for _, algo := range algos {
+		level := atomic.LoadInt64(c.compressionLevels[algo])
+		if pressure >= 2 {
+			level = -1
+		}
+		out += formatMetricWithLabel("proxy_compression_effective_level", level, "algorithm", algo)
 	}
+	c.mu.RUnlock()
+
+	// upstream phases
+	out += c.upstreamPrometheusMetrics()
 
-	out += "# HELP proxy_route_duration_average_seconds Average request duration per route\n"
-	out += "# TYPE proxy_route_duration_average_seconds gauge\n"
-	for route, rm := range stats.RouteMetrics {
-		out += formatMetricWithLabel("proxy_route_duration_average_seconds", rm.AverageDuration, "route", route)
+	// route metrics, labeled per the route allowlist
+	out += c.routePrometheusMetrics()
+	out += c.labelPrometheusMetrics()
+
+	c.mu.RLock()
+	sources := c.sources
+	c.mu.RUnlock()
+	for _, src := range sources {
+		out += src.PrometheusMetrics()
 	}
 
 	return out
@@ -1,7 +1,9 @@
 package metrics
 
 import (
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -54,3 +56,265 @@ func TestPrometheusMetricsContainsKeys(t *testing.T) {
 		}
 	}
 }
+
+func TestSlowSamplerKeepsSlowest(t *testing.T) {
+	s := NewSlowSampler(3, time.Hour)
+	for i, ms := range []float64{5, 120, 40, 900, 15, 300} {
+		s.Observe(SlowSample{Path: "/p", DurationMs: ms, Status: 200 + i})
+	}
+	got := s.Slowest(0)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 samples, got %d", len(got))
+	}
+	for i, want := range []float64{900, 300, 120} {
+		if got[i].DurationMs != want {
+			t.Fatalf("expected slowest-first %v, got %+v", want, got)
+		}
+	}
+	if top := s.Slowest(1); len(top) != 1 || top[0].DurationMs != 900 {
+		t.Fatalf("expected limit to return the slowest sample, got %+v", top)
+	}
+
+	// Samples outside the window are dropped
+	s.Observe(SlowSample{DurationMs: 1, Time: time.Now().Add(2 * time.Hour)})
+	if got := s.Slowest(0); len(got) != 1 || got[0].DurationMs != 1 {
+		t.Fatalf("expected expired samples to be dropped, got %+v", got)
+	}
+}
+
+func TestSlowSamplerTake(t *testing.T) {
+	s := NewSlowSampler(1000, time.Hour)
+
+	// Every sample is returned by exactly one Take, even while observing
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Observe(SlowSample{DurationMs: float64(j)})
+			}
+		}()
+	}
+	taken := 0
+	for i := 0; i < 20; i++ {
+		taken += len(s.Take())
+	}
+	wg.Wait()
+	taken += len(s.Take())
+	if taken != 400 {
+		t.Fatalf("expected 400 samples taken, got %d", taken)
+	}
+	if got := s.Slowest(0); len(got) != 0 {
+		t.Fatalf("expected an empty sampler after Take, got %+v", got)
+	}
+
+	s.Observe(SlowSample{DurationMs: 10})
+	s.Observe(SlowSample{DurationMs: 30})
+	if got := s.Take(); len(got) != 2 || got[0].DurationMs != 30 {
+		t.Fatalf("expected slowest-first samples, got %+v", got)
+	}
+}
+
+func TestRouteInFlightGauge(t *testing.T) {
+	c := NewCollector()
+	c.SetRouteLabels([]string{"app.test/"})
+	c.IncrementActiveConnections()
+	c.IncrementRouteInFlight("app.test/")
+	c.IncrementRouteInFlight("app.test/")
+	c.DecrementRouteInFlight("app.test/")
+
+	stats := c.GetStats()
+	if stats.InFlightRequests != 1 || stats.InFlightByRoute["app.test/"] != 1 {
+		t.Fatalf("unexpected in-flight stats: %d %v", stats.InFlightRequests, stats.InFlightByRoute)
+	}
+	if out := c.PrometheusMetrics(); !strings.Contains(out, `proxy_route_requests_in_flight{route="app.test/"} 1`) {
+		t.Fatalf("expected per-route in-flight gauge in output")
+	}
+}
+
+func TestRouteLabelAllowlist(t *testing.T) {
+	c := NewCollector()
+	c.SetRouteLabels([]string{"top.test/", "top.test/api"})
+
+	c.RecordRouteRequest("top.test/api", 200, 50*time.Millisecond)
+	c.RecordRouteRequest("top.test/api", 502, 2*time.Second)
+	for i := 0; i < 100; i++ {
+		c.RecordRouteRequest(fmt.Sprintf("tenant%d.test/", i), 200, time.Millisecond)
+	}
+	c.IncrementRouteInFlight("tenant1.test/")
+	c.IncrementRouteInFlight("tenant2.test/")
+
+	if got := c.RouteLabel("tenant7.test/"); got != OtherRoute {
+		t.Fatalf("expected unlisted route to map to %q, got %q", OtherRoute, got)
+	}
+
+	out := c.PrometheusMetrics()
+	for _, want := range []string{
+		`proxy_route_requests_total{route="top.test/api"} 2`,
+		`proxy_route_errors_total{route="top.test/api"} 1`,
+		`proxy_route_duration_seconds_bucket{route="top.test/api",le="0.1"} 1`,
+		`proxy_route_duration_seconds_count{route="top.test/api"} 2`,
+		`proxy_route_requests_total{route="other"} 100`,
+		`proxy_route_requests_in_flight{route="other"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("prometheus output missing %s", want)
+		}
+	}
+	if n := strings.Count(out, "proxy_route_requests_total{"); n != 2 {
+		t.Fatalf("expected 2 route series, got %d", n)
+	}
+	if strings.Contains(out, "tenant") {
+		t.Fatalf("unlisted routes must not get their own label")
+	}
+
+	// Dropping a route from the list removes its series
+	c.SetRouteLabels(nil)
+	if strings.Contains(c.PrometheusMetrics(), `route="top.test/api"`) {
+		t.Fatalf("expected series for removed route to be dropped")
+	}
+}
+
+func TestRouteLabelValues(t *testing.T) {
+	c := NewCollector()
+	c.SetLabelKeys([]string{"team"})
+
+	c.RecordLabeledRequest(map[string]string{"team": "payments", "env": "prod"}, 200)
+	c.RecordLabeledRequest(map[string]string{"team": "payments"}, 503)
+	c.RecordLabeledRequest(nil, 200)
+	for i := 0; i < MaxLabelValues+10; i++ {
+		c.RecordLabeledRequest(map[string]string{"team": fmt.Sprintf("tenant%d", i)}, 200)
+	}
+
+	out := c.PrometheusMetrics()
+	for _, want := range []string{
+		`proxy_route_label_requests_total{label="team",value="payments"} 2`,
+		`proxy_route_label_errors_total{label="team",value="payments"} 1`,
+		`proxy_route_label_requests_total{label="team",value="other"} 11`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("prometheus output missing %s", want)
+		}
+	}
+	if strings.Contains(out, `label="env"`) {
+		t.Fatalf("keys outside label_keys must not be counted")
+	}
+	if n := strings.Count(out, "proxy_route_label_requests_total{"); n != MaxLabelValues+1 {
+		t.Fatalf("expected %d series, got %d", MaxLabelValues+1, n)
+	}
+
+	// Dropping a key removes its series
+	c.SetLabelKeys(nil)
+	if strings.Contains(c.PrometheusMetrics(), `label="team"`) {
+		t.Fatalf("expected series for removed key to be dropped")
+	}
+}
+
+type staticSource string
+
+func (s staticSource) PrometheusMetrics() string { return string(s) }
+
+func TestAddSource(t *testing.T) {
+	c := NewCollector()
+	c.AddSource(staticSource("registry_sessions_total 3\n"))
+	if out := c.PrometheusMetrics(); !strings.HasSuffix(out, "registry_sessions_total 3\n") {
+		t.Fatalf("expected source metrics at the end, got:\n%s", out)
+	}
+}
+
+func TestUpstreamBreakdown(t *testing.T) {
+	c := NewCollector()
+	c.RecordUpstreamTiming(UpstreamTiming{Connect: 2 * time.Millisecond, TLS: 8 * time.Millisecond, TTFB: 50 * time.Millisecond, Total: 80 * time.Millisecond})
+	c.RecordUpstreamTiming(UpstreamTiming{TTFB: 30 * time.Millisecond, Total: 40 * time.Millisecond, Reused: true})
+	c.RecordUpstreamTiming(UpstreamTiming{TTFB: 10 * time.Millisecond, Total: 10 * time.Millisecond, Reused: true})
+	c.RecordUpstreamTiming(UpstreamTiming{Total: 5 * time.Millisecond}) // Failed before a response
+
+	b := c.UpstreamBreakdown()
+	if b.SampleCount != 4 || b.ReusedPercent != 50 {
+		t.Fatalf("unexpected counts: %+v", b)
+	}
+	if b.Connect.Count != 1 || b.Connect.MeanMs != 2 || b.TLS.MaxMs != 8 {
+		t.Fatalf("expected connection setup from the new connection only, got %+v %+v", b.Connect, b.TLS)
+	}
+	if b.TTFB.Count != 3 || b.TTFB.MeanMs != 30 || b.TTFB.P50Ms != 30 || b.TTFB.MaxMs != 50 {
+		t.Fatalf("unexpected ttfb stats: %+v", b.TTFB)
+	}
+	if b.Transfer.Count != 3 || b.Transfer.MaxMs != 30 || b.Transfer.MeanMs != float64(40)/3 {
+		t.Fatalf("unexpected transfer stats: %+v", b.Transfer)
+	}
+
+	out := c.PrometheusMetrics()
+	for _, want := range []string{
+		"proxy_upstream_requests_total 4",
+		"proxy_upstream_reused_connections_total 2",
+		`proxy_upstream_phase_seconds_total{phase="ttfb"} 0.09`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in metrics output", want)
+		}
+	}
+}
+
+func TestCollectorResetAndSnapshot(t *testing.T) {
+	c := NewCollector()
+	c.RecordRequest("/api", "GET", 500, 2*time.Second, 256, 512)
+	c.RecordRouteRequest("example.com/api", 500, 2*time.Second)
+	c.RecordUpstreamTiming(UpstreamTiming{TTFB: time.Millisecond, Total: 2 * time.Millisecond})
+	c.RecordWAFBlock()
+	c.IncrementActiveConnections()
+	c.IncrementWebSocketActive()
+
+	first := c.Snapshot()
+	if first.ID != 1 || first.Resets != 0 || first.ResetAt != nil || first.Stats.TotalRequests != 1 {
+		t.Fatalf("unexpected first snapshot %+v", first)
+	}
+
+	before := c.Reset()
+	if before.ID != 2 || before.Stats.TotalErrors != 1 || before.Stats.WAFBlocks != 1 {
+		t.Fatalf("expected pre-reset snapshot, got %+v", before)
+	}
+	after := c.Snapshot()
+	if after.ID != 3 || after.Resets != 1 || after.ResetAt == nil {
+		t.Fatalf("unexpected post-reset snapshot %+v", after)
+	}
+	s := after.Stats
+	if s.TotalRequests != 0 || s.TotalErrors != 0 || s.TotalBytesSent != 0 || s.WAFBlocks != 0 ||
+		s.WebSocketConnections != 0 || len(s.RouteMetrics) != 0 || s.RequestsByStatus[500] != 0 {
+		t.Fatalf("expected counters zeroed, got %+v", s)
+	}
+	if s.ActiveConnections != 1 || s.WebSocketActive != 1 {
+		t.Fatalf("expected gauges kept, got active=%d websocket=%d", s.ActiveConnections, s.WebSocketActive)
+	}
+	if c.UpstreamBreakdown().SampleCount != 0 || strings.Contains(c.PrometheusMetrics(), `proxy_route_requests_total{route="other"}`) {
+		t.Fatal("expected upstream timings and route series cleared")
+	}
+
+	// A reset never splits a request: every request here is an error
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					c.RecordRequest("/api", "GET", 503, time.Millisecond, 1, 1)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		snap := c.Reset()
+		if snap.Stats.TotalRequests != snap.Stats.TotalErrors {
+			close(stop)
+			wg.Wait()
+			t.Fatalf("reset split a request: %d requests, %d errors", snap.Stats.TotalRequests, snap.Stats.TotalErrors)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,244 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// OtherRoute is the label shared by every route not in the allowlist
+const OtherRoute = "other"
+
+// histogramBuckets are the Histogram upper bounds in seconds, in order
+var histogramBuckets = []string{"0.1", "0.5", "1.0", "5.0", "10.0", "+Inf"}
+
+// SetRouteLabels sets the routes ("domain/path", as registered) that get
+// their own route label in /metrics. All others are counted as OtherRoute,
+// which keeps the series count at len(routes)+1. Series of routes dropped
+// from the list are removed.
+func (c *Collector) SetRouteLabels(routes []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.routeLabels = make(map[string]struct{}, len(routes))
+	for _, route := range routes {
+		if route = strings.TrimSpace(route); route != "" {
+			c.routeLabels[route] = struct{}{}
+		}
+	}
+	for label := range c.labeledRoutes {
+		if _, ok := c.routeLabels[label]; !ok && label != OtherRoute {
+			delete(c.labeledRoutes, label)
+		}
+	}
+}
+
+// RouteLabel returns the label used for route in /metrics
+func (c *Collector) RouteLabel(route string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.routeLabelLocked(route)
+}
+
+func (c *Collector) routeLabelLocked(route string) string {
+	if _, ok := c.routeLabels[route]; ok {
+		return route
+	}
+	return OtherRoute
+}
+
+// RecordRouteRequest counts a request against its route's label
+func (c *Collector) RecordRouteRequest(route string, status int, duration time.Duration) {
+	c.resetMu.RLock()
+	defer c.resetMu.RUnlock()
+
+	c.mu.RLock()
+	label := c.routeLabelLocked(route)
+	rm, ok := c.labeledRoutes[label]
+	c.mu.RUnlock()
+	if !ok {
+		c.mu.Lock()
+		if rm, ok = c.labeledRoutes[label]; !ok {
+			rm = &RouteMetrics{ResponseTimes: NewHistogram()}
+			c.labeledRoutes[label] = rm
+		}
+		c.mu.Unlock()
+	}
+
+	atomic.AddUint64(&rm.Requests, 1)
+	if status >= 400 {
+		atomic.AddUint64(&rm.Errors, 1)
+	}
+	atomic.AddUint64(&rm.TotalDuration, uint64(duration.Nanoseconds()))
+	rm.ResponseTimes.Observe(duration)
+}
+
+// MaxLabelValues caps the values counted per route label key. Further values
+// share OtherRoute, so a key adds at most MaxLabelValues+1 series.
+const MaxLabelValues = 50
+
+// labelCounts counts the requests of routes with one label value
+type labelCounts struct {
+	Requests uint64
+	Errors   uint64
+}
+
+// SetLabelKeys sets the route label keys (e.g. team) counted per value in
+// /metrics. Series of keys dropped from the list are removed.
+func (c *Collector) SetLabelKeys(keys []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.labelKeys = make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			c.labelKeys[key] = struct{}{}
+		}
+	}
+	for key := range c.labelValues {
+		if _, ok := c.labelKeys[key]; !ok {
+			delete(c.labelValues, key)
+		}
+	}
+}
+
+// RecordLabeledRequest counts a request against the values of its route's
+// labels whose key is in the label key list
+func (c *Collector) RecordLabeledRequest(labels map[string]string, status int) {
+	if len(labels) == 0 {
+		return
+	}
+	c.resetMu.RLock()
+	defer c.resetMu.RUnlock()
+
+	for key, value := range labels {
+		c.mu.RLock()
+		_, counted := c.labelKeys[key]
+		counts, ok := c.labelValues[key][value]
+		c.mu.RUnlock()
+		if !counted {
+			continue
+		}
+		if !ok {
+			c.mu.Lock()
+			values := c.labelValues[key]
+			if values == nil {
+				values = make(map[string]*labelCounts)
+				c.labelValues[key] = values
+			}
+			if counts, ok = values[value]; !ok {
+				if len(values) >= MaxLabelValues {
+					value = OtherRoute
+				}
+				if counts, ok = values[value]; !ok {
+					counts = &labelCounts{}
+					values[value] = counts
+				}
+			}
+			c.mu.Unlock()
+		}
+
+		atomic.AddUint64(&counts.Requests, 1)
+		if status >= 400 {
+			atomic.AddUint64(&counts.Errors, 1)
+		}
+	}
+}
+
+// labelPrometheusMetrics renders the per-label-value series
+func (c *Collector) labelPrometheusMetrics() string {
+	type series struct {
+		key, value string
+		counts     *labelCounts
+	}
+	c.mu.RLock()
+	var all []series
+	for key, values := range c.labelValues {
+		for value, counts := range values {
+			all = append(all, series{key, value, counts})
+		}
+	}
+	c.mu.RUnlock()
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].key != all[j].key {
+			return all[i].key < all[j].key
+		}
+		return all[i].value < all[j].value
+	})
+
+	format := func(name string, s series, value uint64) string {
+		return name + "{label=\"" + s.key + "\",value=\"" + s.value + "\"} " + toString(value) + "\n"
+	}
+	var out string
+	out += "# HELP proxy_route_label_requests_total Total requests per route label value\n"
+	out += "# TYPE proxy_route_label_requests_total counter\n"
+	for _, s := range all {
+		out += format("proxy_route_label_requests_total", s, atomic.LoadUint64(&s.counts.Requests))
+	}
+	out += "# HELP proxy_route_label_errors_total Total errors per route label value\n"
+	out += "# TYPE proxy_route_label_errors_total counter\n"
+	for _, s := range all {
+		out += format("proxy_route_label_errors_total", s, atomic.LoadUint64(&s.counts.Errors))
+	}
+	return out
+}
+
+// routePrometheusMetrics renders the per-route-label series
+func (c *Collector) routePrometheusMetrics() string {
+	c.mu.RLock()
+	labels := make([]string, 0, len(c.labeledRoutes))
+	routes := make(map[string]*RouteMetrics, len(c.labeledRoutes))
+	for label, rm := range c.labeledRoutes {
+		labels = append(labels, label)
+		routes[label] = rm
+	}
+	inFlight := make(map[string]int64)
+	for route, gauge := range c.inFlightByRoute {
+		inFlight[c.routeLabelLocked(route)] += atomic.LoadInt64(gauge)
+	}
+	c.mu.RUnlock()
+	sort.Strings(labels)
+
+	var out string
+	out += "# HELP proxy_route_requests_in_flight Requests currently being served per route\n"
+	out += "# TYPE proxy_route_requests_in_flight gauge\n"
+	inFlightLabels := make([]string, 0, len(inFlight))
+	for label := range inFlight {
+		inFlightLabels = append(inFlightLabels, label)
+	}
+	sort.Strings(inFlightLabels)
+	for _, label := range inFlightLabels {
+		out += formatMetricWithLabel("proxy_route_requests_in_flight", inFlight[label], "route", label)
+	}
+
+	out += "# HELP proxy_route_requests_total Total requests per route\n"
+	out += "# TYPE proxy_route_requests_total counter\n"
+	for _, label := range labels {
+		out += formatMetricWithLabel("proxy_route_requests_total", atomic.LoadUint64(&routes[label].Requests), "route", label)
+	}
+
+	out += "# HELP proxy_route_errors_total Total errors per route\n"
+	out += "# TYPE proxy_route_errors_total counter\n"
+	for _, label := range labels {
+		out += formatMetricWithLabel("proxy_route_errors_total", atomic.LoadUint64(&routes[label].Errors), "route", label)
+	}
+
+	out += "# HELP proxy_route_duration_seconds Request duration per route\n"
+	out += "# TYPE proxy_route_duration_seconds histogram\n"
+	for _, label := range labels {
+		h := routes[label].ResponseTimes
+		h.mu.RLock()
+		for _, bucket := range histogramBuckets {
+			out += "proxy_route_duration_seconds_bucket{route=\"" + label + "\",le=\"" + bucket + "\"} " +
+				toString(atomic.LoadUint64(h.buckets[bucket])) + "\n"
+		}
+		sum := float64(atomic.LoadUint64(&h.sum)) / 1e9
+		count := atomic.LoadUint64(&h.count)
+		h.mu.RUnlock()
+		out += formatMetricWithLabel("proxy_route_duration_seconds_sum", sum, "route", label)
+		out += formatMetricWithLabel("proxy_route_duration_seconds_count", count, "route", label)
+	}
+
+	return out
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SlowSample is one request kept by the SlowSampler
+type SlowSample struct {
+	Time       time.Time `json:"time"`
+	Host       string    `json:"host"`
+	Path       string    `json:"path"`
+	Method     string    `json:"method"`
+	Status     int       `json:"status"`
+	DurationMs float64   `json:"duration_ms"`
+	RequestID  string    `json:"request_id,omitempty"`
+}
+
+// SlowSampler keeps the N slowest requests seen within a time window. It
+// is a min-heap on duration, so a new request only has to beat the fastest
+// kept sample.
+type SlowSampler struct {
+	mu      sync.Mutex
+	size    int
+	window  time.Duration
+	samples sampleHeap
+}
+
+// NewSlowSampler keeps the size slowest requests of the last window
+func NewSlowSampler(size int, window time.Duration) *SlowSampler {
+	if size <= 0 {
+		size = 50
+	}
+	return &SlowSampler{size: size, window: window}
+}
+
+// Observe offers a completed request to the sampler
+func (s *SlowSampler) Observe(sample SlowSample) {
+	if sample.Time.IsZero() {
+		sample.Time = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(sample.Time)
+	if len(s.samples) < s.size {
+		heap.Push(&s.samples, sample)
+		return
+	}
+	if sample.DurationMs > s.samples[0].DurationMs {
+		s.samples[0] = sample
+		heap.Fix(&s.samples, 0)
+	}
+}
+
+// Slowest returns up to limit kept samples, slowest first (all when limit
+// is 0)
+func (s *SlowSampler) Slowest(limit int) []SlowSample {
+	s.mu.Lock()
+	s.expire(time.Now())
+	out := append([]SlowSample(nil), s.samples...)
+	s.mu.Unlock()
+
+	sortSlowest(out)
+	if limit > 0 && limit < len(out) {
+		out = out[:limit]
+	}
+	return out
+}
+
+// Take returns all kept samples, slowest first, and empties the sampler in
+// the same step, so no request is both returned and kept or lost in between
+func (s *SlowSampler) Take() []SlowSample {
+	s.mu.Lock()
+	s.expire(time.Now())
+	out := []SlowSample(s.samples)
+	s.samples = nil
+	s.mu.Unlock()
+
+	sortSlowest(out)
+	return out
+}
+
+// Window returns how long samples are kept
+func (s *SlowSampler) Window() time.Duration {
+	return s.window
+}
+
+// expire drops samples older than the window. Callers hold s.mu.
+func (s *SlowSampler) expire(now time.Time) {
+	if s.window <= 0 {
+		return
+	}
+	cutoff := now.Add(-s.window)
+	kept := s.samples[:0]
+	for _, sample := range s.samples {
+		if sample.Time.After(cutoff) {
+			kept = append(kept, sample)
+		}
+	}
+	if len(kept) != len(s.samples) {
+		s.samples = kept
+		heap.Init(&s.samples)
+	}
+}
+
+func sortSlowest(samples []SlowSample) {
+	sort.Slice(samples, func(i, j int) bool { return samples[i].DurationMs > samples[j].DurationMs })
+}
+
+// sampleHeap implements heap.Interface ordered by ascending duration
+type sampleHeap []SlowSample
+
+func (h sampleHeap) Len() int            { return len(h) }
+func (h sampleHeap) Less(i, j int) bool  { return h[i].DurationMs < h[j].DurationMs }
+func (h sampleHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *sampleHeap) Push(x interface{}) { *h = append(*h, x.(SlowSample)) }
+func (h *sampleHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
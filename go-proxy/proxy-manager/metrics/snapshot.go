@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Snapshot is the collector's stats at one moment, numbered so a load test
+// can pair a baseline with a later reading and take the difference
+type Snapshot struct {
+	ID        uint64     `json:"snapshot_id"` // Increases with every snapshot
+	Timestamp time.Time  `json:"timestamp"`
+	Resets    uint64     `json:"resets"`             // Resets since startup; a change between two snapshots voids their delta
+	ResetAt   *time.Time `json:"reset_at,omitempty"` // The latest reset, nil if never reset
+	Stats     Stats      `json:"stats"`
+}
+
+// Snapshot returns the current stats with the next snapshot ID
+func (c *Collector) Snapshot() Snapshot {
+	c.resetMu.RLock()
+	defer c.resetMu.RUnlock()
+	return c.snapshotLocked()
+}
+
+// snapshotLocked builds a snapshot; call with resetMu held
+func (c *Collector) snapshotLocked() Snapshot {
+	snap := Snapshot{
+		ID:        atomic.AddUint64(&c.snapshotSeq, 1),
+		Timestamp: time.Now(),
+		Resets:    c.resets,
+		Stats:     c.GetStats(),
+	}
+	if c.resets > 0 {
+		resetAt := c.resetAt
+		snap.ResetAt = &resetAt
+	}
+	return snap
+}
+
+// Reset zeroes the cumulative counters (requests, errors, bytes, status
+// codes, routes, route labels, durations, upstream timings, WebSocket,
+// connection, retry, backend rate limit and security counts) and returns a snapshot taken just before. Gauges such
+// as active connections and in-flight requests keep their values, and so do
+// the slowest-request samples. No request is recorded while the reset runs,
+// so a request is counted entirely before or entirely after it.
+//
+// Prometheus treats a counter that goes down as a restart; resetting a
+// scraped production proxy distorts rates and increases around the reset.
+func (c *Collector) Reset() Snapshot {
+	c.resetMu.Lock()
+	defer c.resetMu.Unlock()
+
+	before := c.snapshotLocked()
+
+	for _, counter := range []*uint64{
+		&c.totalRequests, &c.totalErrors, &c.totalBytesSent, &c.totalBytesReceived,
+		&c.websocketConnections, &c.websocketBytesToClient, &c.websocketBytesToBackend, &c.websocketDurationSum,
+		&c.quicHandshakes, &c.quicRejected, &c.clientConnAccepted, &c.clientConnRejected,
+		&c.retryAttempts, &c.retrySuccesses, &c.retryFailures, &c.slowWarnings, &c.slowCriticals,
+		&c.rateLimitViolations, &c.wafBlocks, &c.mirrorSent, &c.mirrorFailed, &c.mirrorSkipped,
+	} {
+		atomic.StoreUint64(counter, 0)
+	}
+	c.requestDurations.reset()
+
+	c.mu.Lock()
+	c.requestsByStatus = newStatusCounters()
+	c.requestsByRoute = make(map[string]*RouteMetrics)
+	c.labeledRoutes = make(map[string]*RouteMetrics)
+	c.labelValues = make(map[string]map[string]*labelCounts)
+	c.backendRateLimited = make(map[string]*uint64)
+	c.resets++
+	c.resetAt = before.Timestamp
+	c.mu.Unlock()
+
+	u := c.upstream
+	u.mu.Lock()
+	u.samples, u.next = nil, 0
+	u.requests, u.reused = 0, 0
+	u.connect, u.tls, u.ttfb, u.transfer = 0, 0, 0, 0
+	u.mu.Unlock()
+
+	return before
+}
+
+// reset zeroes the histogram
+func (h *Histogram) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, counter := range h.buckets {
+		atomic.StoreUint64(counter, 0)
+	}
+	atomic.StoreUint64(&h.sum, 0)
+	atomic.StoreUint64(&h.count, 0)
+}
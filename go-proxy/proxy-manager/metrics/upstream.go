@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// upstreamWindow is how many recent requests the upstream breakdown covers
+const upstreamWindow = 1000
+
+// UpstreamTiming is where one proxied request spent its time upstream
+type UpstreamTiming struct {
+	Connect time.Duration // TCP connect, zero on a reused connection
+	TLS     time.Duration // TLS handshake, zero on a reused or plain connection
+	TTFB    time.Duration // From getting a connection to the first response byte, including Connect and TLS
+	Total   time.Duration // Until the response body was copied to the client
+	Reused  bool          // The request went over an idle keep-alive connection
+}
+
+// Transfer is the time spent streaming the response body
+func (t UpstreamTiming) Transfer() time.Duration {
+	if t.TTFB <= 0 || t.Total < t.TTFB {
+		return 0
+	}
+	return t.Total - t.TTFB
+}
+
+// PhaseStats summarizes one phase over the recent requests it occurred in
+type PhaseStats struct {
+	Count  int     `json:"count"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+// UpstreamBreakdown splits the latency of recent proxied requests into
+// connection setup, waiting for the backend and streaming the body.
+// Connect and TLS only count requests that opened a new connection.
+type UpstreamBreakdown struct {
+	SampleCount   int        `json:"sample_count"`
+	ReusedPercent float64    `json:"reused_connections_percent"`
+	Connect       PhaseStats `json:"connect"`
+	TLS           PhaseStats `json:"tls"`
+	TTFB          PhaseStats `json:"ttfb"`
+	Transfer      PhaseStats `json:"transfer"`
+}
+
+// upstreamTimings keeps the timings of the last upstreamWindow requests and
+// running totals for Prometheus
+type upstreamTimings struct {
+	mu      sync.Mutex
+	samples []UpstreamTiming // Ring buffer
+	next    int
+
+	requests uint64
+	reused   uint64
+	connect  time.Duration
+	tls      time.Duration
+	ttfb     time.Duration
+	transfer time.Duration
+}
+
+// RecordUpstreamTiming records the upstream phases of a proxied request
+func (c *Collector) RecordUpstreamTiming(timing UpstreamTiming) {
+	u := c.upstream
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if len(u.samples) < upstreamWindow {
+		u.samples = append(u.samples, timing)
+	} else {
+		u.samples[u.next] = timing
+		u.next = (u.next + 1) % upstreamWindow
+	}
+
+	u.requests++
+	if timing.Reused {
+		u.reused++
+	}
+	u.connect += timing.Connect
+	u.tls += timing.TLS
+	u.ttfb += timing.TTFB
+	u.transfer += timing.Transfer()
+}
+
+// UpstreamBreakdown aggregates the upstream timings of recent requests
+func (c *Collector) UpstreamBreakdown() UpstreamBreakdown {
+	u := c.upstream
+	u.mu.Lock()
+	var connect, tls, ttfb, transfer []float64
+	reused := 0
+	for _, t := range u.samples {
+		if t.Reused {
+			reused++
+		}
+		if t.Connect > 0 {
+			connect = append(connect, durationMs(t.Connect))
+		}
+		if t.TLS > 0 {
+			tls = append(tls, durationMs(t.TLS))
+		}
+		if t.TTFB > 0 {
+			ttfb = append(ttfb, durationMs(t.TTFB))
+			transfer = append(transfer, durationMs(t.Transfer()))
+		}
+	}
+	breakdown := UpstreamBreakdown{SampleCount: len(u.samples)}
+	u.mu.Unlock()
+
+	if breakdown.SampleCount > 0 {
+		breakdown.ReusedPercent = float64(reused) / float64(breakdown.SampleCount) * 100
+	}
+	breakdown.Connect = phaseStats(connect)
+	breakdown.TLS = phaseStats(tls)
+	breakdown.TTFB = phaseStats(ttfb)
+	breakdown.Transfer = phaseStats(transfer)
+	return breakdown
+}
+
+// upstreamPrometheusMetrics returns the upstream phase counters
+func (c *Collector) upstreamPrometheusMetrics() string {
+	u := c.upstream
+	u.mu.Lock()
+	requests, reused := u.requests, u.reused
+	phases := []struct {
+		name  string
+		total time.Duration
+	}{
+		{"connect", u.connect},
+		{"tls", u.tls},
+		{"ttfb", u.ttfb},
+		{"transfer", u.transfer},
+	}
+	u.mu.Unlock()
+
+	var out string
+	out += "# HELP proxy_upstream_requests_total Requests proxied to a backend\n"
+	out += "# TYPE proxy_upstream_requests_total counter\n"
+	out += formatMetric("proxy_upstream_requests_total", requests)
+
+	out += "# HELP proxy_upstream_reused_connections_total Upstream requests sent over a reused connection\n"
+	out += "# TYPE proxy_upstream_reused_connections_total counter\n"
+	out += formatMetric("proxy_upstream_reused_connections_total", reused)
+
+	out += "# HELP proxy_upstream_phase_seconds_total Time spent upstream by phase (connect, tls, ttfb, transfer); ttfb includes connect and tls\n"
+	out += "# TYPE proxy_upstream_phase_seconds_total counter\n"
+	for _, phase := range phases {
+		out += formatMetricWithLabel("proxy_upstream_phase_seconds_total", phase.total.Seconds(), "phase", phase.name)
+	}
+	return out
+}
+
+// phaseStats summarizes samples in milliseconds
+func phaseStats(samples []float64) PhaseStats {
+	if len(samples) == 0 {
+		return PhaseStats{}
+	}
+	sort.Float64s(samples)
+	sum := 0.0
+	for _, v := range samples {
+		sum += v
+	}
+	percentile := func(p float64) float64 {
+		idx := int(math.Ceil(p*float64(len(samples)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return samples[idx]
+	}
+	return PhaseStats{
+		Count:  len(samples),
+		MeanMs: sum / float64(len(samples)),
+		P50Ms:  percentile(0.50),
+		P95Ms:  percentile(0.95),
+		P99Ms:  percentile(0.99),
+		MaxMs:  samples[len(samples)-1],
+	}
+}
+
+// durationMs converts d to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
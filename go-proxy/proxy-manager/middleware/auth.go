@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+// AuthConfig holds the credentials accepted by Authenticator. Basic Auth is
+// enabled when Username and Password are set, bearer tokens when Token is
+// set. With neither, requests pass through unauthenticated only when
+// AllowAnonymous is set and are rejected otherwise.
+type AuthConfig struct {
+	Username       string
+	Password       string
+	Token          string
+	Realm          string
+	AllowAnonymous bool
+}
+
+// Enabled reports whether any credentials are configured
+func (c AuthConfig) Enabled() bool {
+	return (c.Username != "" && c.Password != "") || c.Token != ""
+}
+
+// Authenticator protects handlers with Basic Auth and/or a bearer token.
+// Credentials can be swapped at runtime with Update.
+type Authenticator struct {
+	config atomic.Pointer[AuthConfig]
+	exempt map[string]bool
+}
+
+// NewAuthenticator creates an authenticator. Paths in exempt (exact match)
+// are always served without credentials, e.g. probe endpoints.
+func NewAuthenticator(cfg AuthConfig, exempt ...string) *Authenticator {
+	a := &Authenticator{exempt: make(map[string]bool, len(exempt))}
+	for _, path := range exempt {
+		a.exempt[path] = true
+	}
+	a.Update(cfg)
+	return a
+}
+
+// Update replaces the accepted credentials
+func (a *Authenticator) Update(cfg AuthConfig) {
+	if cfg.Realm == "" {
+		cfg.Realm = "proxy-manager"
+	}
+	a.config.Store(&cfg)
+}
+
+// Wrap returns next guarded by the authenticator
+func (a *Authenticator) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := a.config.Load()
+		if a.exempt[r.URL.Path] || (!cfg.Enabled() && cfg.AllowAnonymous) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !cfg.Enabled() {
+			http.Error(w, "403 Forbidden: no credentials configured", http.StatusForbidden)
+			return
+		}
+		if principal, ok := authorized(cfg, r); ok {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+			return
+		}
+
+		if cfg.Username != "" && cfg.Password != "" {
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", cfg.Realm))
+		}
+		if cfg.Token != "" {
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", cfg.Realm))
+		}
+		log.Debug().
+			Str("path", r.URL.Path).
+			Str("remote_addr", r.RemoteAddr).
+			Msg("Rejected unauthenticated admin request")
+		http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// principalKey is the context key of the authenticated principal
+type principalKey struct{}
+
+// Principal returns who authenticated the request: the Basic Auth user name,
+// "token" for the bearer token, or "anonymous" when authentication is off
+func Principal(r *http.Request) string {
+	if principal, ok := r.Context().Value(principalKey{}).(string); ok {
+		return principal
+	}
+	return "anonymous"
+}
+
+// authorized checks the credentials and returns the principal they belong to
+func authorized(cfg *AuthConfig, r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", false
+	}
+
+	if cfg.Token != "" {
+		if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+			return "token", secureEqual(token, cfg.Token)
+		}
+	}
+
+	if cfg.Username != "" && cfg.Password != "" {
+		if user, pass, ok := r.BasicAuth(); ok {
+			// Evaluate both so timing does not reveal which one was wrong
+			userOK := secureEqual(user, cfg.Username)
+			passOK := secureEqual(pass, cfg.Password)
+			return cfg.Username, userOK && passOK
+		}
+	}
+
+	return "", false
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// CORSConfig holds cross-origin settings. With no AllowedOrigins no CORS
+// headers are sent, so browsers only allow same-origin requests.
+type CORSConfig struct {
+	AllowedOrigins   []string // Exact origins ("https://admin.example.com") or "*"
+	AllowedMethods   []string // Default GET, POST, OPTIONS
+	AllowedHeaders   []string // Default Authorization, Content-Type
+	AllowCredentials bool
+	MaxAge           time.Duration // How long browsers may cache a preflight
+}
+
+// CORS applies CORSConfig to requests under a path prefix. Settings can be
+// swapped at runtime with Update.
+type CORS struct {
+	prefix string
+	config atomic.Pointer[corsPolicy]
+}
+
+type corsPolicy struct {
+	CORSConfig
+	origins map[string]bool
+	any     bool
+	methods string
+	headers string
+}
+
+// NewCORS creates CORS handling for paths starting with prefix
+func NewCORS(cfg CORSConfig, prefix string) *CORS {
+	c := &CORS{prefix: prefix}
+	c.Update(cfg)
+	return c
+}
+
+// Update replaces the CORS settings
+func (c *CORS) Update(cfg CORSConfig) {
+	if len(cfg.AllowedMethods) == 0 {
+		cfg.AllowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+	}
+	if len(cfg.AllowedHeaders) == 0 {
+		cfg.AllowedHeaders = []string{"Authorization", "Content-Type"}
+	}
+
+	p := &corsPolicy{
+		CORSConfig: cfg,
+		origins:    make(map[string]bool, len(cfg.AllowedOrigins)),
+		methods:    strings.Join(cfg.AllowedMethods, ", "),
+		headers:    strings.Join(cfg.AllowedHeaders, ", "),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			p.any = true
+		}
+		p.origins[strings.TrimSuffix(origin, "/")] = true
+	}
+	c.config.Store(p)
+}
+
+// Wrap returns next with CORS headers added and preflight requests answered.
+// Preflights are handled before next so they do not need credentials.
+func (c *CORS) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := c.config.Load()
+		origin := r.Header.Get("Origin")
+		if len(p.origins) == 0 || origin == "" || !strings.HasPrefix(r.URL.Path, c.prefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		allowed := p.any || p.origins[origin]
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if !allowed {
+			if preflight {
+				http.Error(w, "403 Forbidden", http.StatusForbidden)
+				return
+			}
+			// Served without CORS headers; the browser blocks the response
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if p.any && !p.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if p.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", p.methods)
+		w.Header().Set("Access-Control-Allow-Headers", p.headers)
+		if p.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
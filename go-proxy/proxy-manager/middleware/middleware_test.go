@@ -76,3 +76,113 @@ type body struct{ data []byte }
 func (b body) Read(p []byte) (int, error) { copy(p, b.data); return len(b.data), nil }
 func (b body) Close() error               { return nil }
 func NewBody(s string) body               { return body{data: []byte(s)} }
+
+func TestAuthenticator(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Principal", Principal(r))
+		w.WriteHeader(200)
+	})
+	auth := NewAuthenticator(AuthConfig{Username: "admin", Password: "secret", Token: "tok"}, "/health")
+	h := auth.Wrap(next)
+
+	do := func(path string, set func(r *http.Request)) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if set != nil {
+			set(req)
+		}
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("/api/admin/sites", nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %d", rr.Code)
+	}
+	if got := rr.Header().Values("WWW-Authenticate"); len(got) != 2 {
+		t.Fatalf("expected Basic and Bearer challenges, got %v", got)
+	}
+	if rr := do("/health", nil); rr.Code != 200 {
+		t.Fatalf("expected exempt path to pass, got %d", rr.Code)
+	}
+	if rr := do("/dashboard", func(r *http.Request) { r.SetBasicAuth("admin", "secret") }); rr.Code != 200 || rr.Header().Get("X-Principal") != "admin" {
+		t.Fatalf("expected basic auth to pass as admin, got %d %q", rr.Code, rr.Header().Get("X-Principal"))
+	}
+	if rr := do("/dashboard", func(r *http.Request) { r.SetBasicAuth("admin", "wrong") }); rr.Code != 401 {
+		t.Fatalf("expected wrong password to fail, got %d", rr.Code)
+	}
+	if rr := do("/metrics", func(r *http.Request) { r.Header.Set("Authorization", "Bearer tok") }); rr.Code != 200 || rr.Header().Get("X-Principal") != "token" {
+		t.Fatalf("expected bearer token to pass as token, got %d %q", rr.Code, rr.Header().Get("X-Principal"))
+	}
+
+	// Rotated credentials take effect immediately
+	auth.Update(AuthConfig{Token: "new"})
+	if rr := do("/metrics", func(r *http.Request) { r.Header.Set("Authorization", "Bearer tok") }); rr.Code != 401 {
+		t.Fatalf("expected old token to fail after update, got %d", rr.Code)
+	}
+
+	// No credentials fails closed unless anonymous access is allowed
+	auth.Update(AuthConfig{})
+	for _, path := range []string{"/dashboard", "/api/admin/pause", "/api/admin/metrics/reset"} {
+		if rr := do(path, nil); rr.Code != http.StatusForbidden {
+			t.Fatalf("expected %s to be refused without credentials configured, got %d", path, rr.Code)
+		}
+	}
+	if rr := do("/health", nil); rr.Code != 200 {
+		t.Fatalf("expected exempt path to stay open without credentials, got %d", rr.Code)
+	}
+	auth.Update(AuthConfig{AllowAnonymous: true})
+	if rr := do("/dashboard", nil); rr.Code != 200 || rr.Header().Get("X-Principal") != "anonymous" {
+		t.Fatalf("expected anonymous access when allowed, got %d %q", rr.Code, rr.Header().Get("X-Principal"))
+	}
+}
+
+func TestCORS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusUnauthorized) })
+	cors := NewCORS(CORSConfig{AllowedOrigins: []string{"https://admin.example.com"}, AllowCredentials: true, MaxAge: 10 * time.Minute}, "/api/")
+	h := cors.Wrap(next)
+
+	do := func(method, path, origin string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Preflight is answered before auth
+	rr := do(http.MethodOptions, "/api/admin/sites/x/reload", "https://admin.example.com")
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 preflight, got %d", rr.Code)
+	}
+	if rr.Header().Get("Access-Control-Allow-Origin") != "https://admin.example.com" ||
+		rr.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+		rr.Header().Get("Access-Control-Max-Age") != "600" ||
+		rr.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Fatalf("unexpected preflight headers: %v", rr.Header())
+	}
+
+	rr = do(http.MethodGet, "/api/logs/recent", "https://admin.example.com")
+	if rr.Code != http.StatusUnauthorized || rr.Header().Get("Access-Control-Allow-Origin") != "https://admin.example.com" {
+		t.Fatalf("expected request passed on with CORS headers, got %d %v", rr.Code, rr.Header())
+	}
+
+	if rr := do(http.MethodOptions, "/api/logs/recent", "https://evil.example.com"); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 preflight for unknown origin, got %d", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/api/logs/recent", "https://evil.example.com"); rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected no CORS headers for unknown origin")
+	}
+	if rr := do(http.MethodGet, "/dashboard", "https://admin.example.com"); rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected no CORS headers outside /api/")
+	}
+
+	// Default is same-origin only
+	cors.Update(CORSConfig{})
+	if rr := do(http.MethodOptions, "/api/logs/recent", "https://admin.example.com"); rr.Code != http.StatusUnauthorized || rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected no CORS handling by default, got %d %v", rr.Code, rr.Header())
+	}
+}
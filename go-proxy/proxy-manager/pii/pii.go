@@ -110,6 +110,11 @@ func NewMasker(config Config) *Masker {
 	return m
 }
 
+// Enabled reports whether masking is turned on
+func (m *Masker) Enabled() bool {
+	return m.config.Enabled
+}
+
 // MaskIP masks an IP address according to configuration
 func (m *Masker) MaskIP(ip string) string {
 	if !m.config.Enabled {
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"context"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/chilla55/proxy-manager/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// Compression pressure states, from normal to compression off
+const (
+	PressureNone int32 = iota
+	PressureReduced
+	PressureOff
+)
+
+// pressureRecoverRatio is the fraction of a threshold load must fall below
+// before the previous state is restored, so the level does not flap
+const pressureRecoverRatio = 0.9
+
+const defaultLoadInterval = 2 * time.Second
+
+// AdaptiveCompression lowers compression effort while the proxy is busy.
+// Above CPUHigh or GoroutinesHigh responses are compressed at ReducedLevel;
+// above CPUCritical they are sent uncompressed.
+type AdaptiveCompression struct {
+	CPUHigh        float64       // Process CPU use, 0-1 of the usable cores
+	CPUCritical    float64       // 0 never disables compression
+	GoroutinesHigh int           // 0 ignores the goroutine count
+	ReducedLevel   int           // Level used while reduced
+	Interval       time.Duration // Sampling interval, default 2s
+}
+
+var (
+	adaptiveCompression atomic.Pointer[AdaptiveCompression]
+	compressionPressure atomic.Int32
+)
+
+// SetAdaptiveCompression replaces the adaptive compression settings. nil
+// turns the feature off and restores normal compression at the next sample.
+func SetAdaptiveCompression(a *AdaptiveCompression) {
+	adaptiveCompression.Store(a)
+}
+
+// CompressionPressure returns the current pressure state
+func CompressionPressure() int32 {
+	return compressionPressure.Load()
+}
+
+// next returns the pressure state for the sampled load
+func (a *AdaptiveCompression) next(prev int32, cpu float64, goroutines int) int32 {
+	over := func(value, limit float64, active bool) bool {
+		if limit <= 0 {
+			return false
+		}
+		if active {
+			return value >= limit*pressureRecoverRatio
+		}
+		return value >= limit
+	}
+	switch {
+	case over(cpu, a.CPUCritical, prev == PressureOff):
+		return PressureOff
+	case over(cpu, a.CPUHigh, prev >= PressureReduced),
+		over(float64(goroutines), float64(a.GoroutinesHigh), prev >= PressureReduced):
+		return PressureReduced
+	}
+	return PressureNone
+}
+
+// capLevel limits level to ReducedLevel for algo
+func (a *AdaptiveCompression) capLevel(algo string, level int) int {
+	reduced := a.ReducedLevel
+	if algo == "gzip" {
+		if reduced < gzip.BestSpeed {
+			reduced = gzip.BestSpeed // gzip level 0 stores without compressing
+		}
+		if level == gzip.DefaultCompression {
+			return reduced
+		}
+	}
+	if level > reduced {
+		return reduced
+	}
+	return level
+}
+
+// cpuSampler measures the process CPU use between two samples
+type cpuSampler struct {
+	lastCPU  time.Duration
+	lastWall time.Time
+}
+
+// sample returns the CPU used since the previous call as a fraction of the
+// usable cores; the first call returns 0
+func (c *cpuSampler) sample() float64 {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	used := time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+	now := time.Now()
+
+	var util float64
+	if !c.lastWall.IsZero() {
+		if wall := now.Sub(c.lastWall); wall > 0 {
+			util = float64(used-c.lastCPU) / float64(wall) / float64(runtime.GOMAXPROCS(0))
+		}
+	}
+	c.lastCPU, c.lastWall = used, now
+	return util
+}
+
+// runLoadSampler updates the compression pressure until ctx is done
+func (s *Server) runLoadSampler(ctx context.Context) {
+	var cpu cpuSampler
+	for {
+		interval := defaultLoadInterval
+		if a := adaptiveCompression.Load(); a != nil && a.Interval > 0 {
+			interval = a.Interval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		s.samplePressure(cpu.sample(), runtime.NumGoroutine())
+	}
+}
+
+// samplePressure moves to the pressure state for the given load
+func (s *Server) samplePressure(cpu float64, goroutines int) {
+	prev := compressionPressure.Load()
+	next := PressureNone
+	if a := adaptiveCompression.Load(); a != nil {
+		next = a.next(prev, cpu, goroutines)
+	}
+	if next == prev {
+		return
+	}
+	compressionPressure.Store(next)
+
+	if mc, ok := s.metricsCollector.(*metrics.Collector); ok {
+		mc.SetCompressionPressure(next)
+	}
+	event := log.Info()
+	if next > prev {
+		event = log.Warn()
+	}
+	event.Float64("cpu", cpu).Int("goroutines", goroutines).
+		Str("from", pressureName(prev)).Str("to", pressureName(next)).
+		Msg("Compression pressure changed")
+}
+
+func pressureName(state int32) string {
+	switch state {
+	case PressureReduced:
+		return "reduced"
+	case PressureOff:
+		return "off"
+	}
+	return "normal"
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultBackendRateWindow is the backend_rate_window unless set
+const defaultBackendRateWindow = time.Second
+
+// backendRateLimiter caps the requests forwarded to one backend, whichever
+// client sends them. It is a token bucket holding a window's worth of
+// requests, refilled evenly over the window, so a burst up to the limit goes
+// through at once and the rate after it is spread out.
+type backendRateLimiter struct {
+	requests int
+	window   time.Duration
+
+	mu       sync.Mutex
+	tokens   float64
+	refilled time.Time
+}
+
+// newBackendRateLimiter builds the limiter from the backend_rate_limit and
+// backend_rate_window options, nil when there is no limit
+func newBackendRateLimiter(options map[string]interface{}) *backendRateLimiter {
+	requests, _ := options["backend_rate_limit"].(int)
+	if requests <= 0 {
+		return nil
+	}
+	window, _ := options["backend_rate_window"].(time.Duration)
+	if window <= 0 {
+		window = defaultBackendRateWindow
+	}
+	return &backendRateLimiter{requests: requests, window: window, tokens: float64(requests), refilled: time.Now()}
+}
+
+// take spends a token, or returns false and how long until one is available
+func (l *backendRateLimiter) take(now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	perToken := l.window / time.Duration(l.requests)
+	l.tokens += float64(now.Sub(l.refilled)) / float64(perToken)
+	if l.tokens > float64(l.requests) {
+		l.tokens = float64(l.requests)
+	}
+	l.refilled = now
+	if l.tokens < 1 {
+		return false, time.Duration((1 - l.tokens) * float64(perToken))
+	}
+	l.tokens--
+	return true, 0
+}
+
+// admitRate answers 503 with a Retry-After and returns false when the
+// backend is over its backend_rate_limit
+func (b *Backend) admitRate(w http.ResponseWriter) bool {
+	if b.rateLimit == nil {
+		return true
+	}
+	ok, wait := b.rateLimit.take(time.Now())
+	if ok {
+		return true
+	}
+	if b.metrics != nil {
+		b.metrics.RecordBackendRateLimited(redactURL(b.URL))
+	}
+	setRetryAfter(w.Header(), wait)
+	http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	return false
+}
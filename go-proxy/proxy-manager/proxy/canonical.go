@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Modes of the canonical_host option
+const (
+	CanonicalApex = "apex" // www.example.com redirects to example.com
+	CanonicalWWW  = "www"  // example.com redirects to www.example.com
+	CanonicalOff  = "off"  // Disables a global mode for one site
+)
+
+// ValidCanonicalHost checks a canonical_host value; "" means inherit
+func ValidCanonicalHost(mode string) error {
+	switch mode {
+	case "", CanonicalApex, CanonicalWWW, CanonicalOff:
+		return nil
+	}
+	return fmt.Errorf("canonical_host must be apex, www or off, got %q", mode)
+}
+
+// SetCanonicalHost sets the mode for routes without their own canonical_host
+func (s *Server) SetCanonicalHost(mode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.canonicalHost = mode
+}
+
+// canonicalForm returns the canonical form of host, "" when it already is
+func canonicalForm(mode, host string) string {
+	switch mode {
+	case CanonicalApex:
+		if strings.HasPrefix(host, "www.") {
+			return strings.TrimPrefix(host, "www.")
+		}
+	case CanonicalWWW:
+		if !strings.HasPrefix(host, "www.") {
+			return "www." + host
+		}
+	}
+	return ""
+}
+
+// canonicalMode returns the route's mode, falling back to the global one.
+// Caller must hold s.mu.
+func (s *Server) canonicalMode(route *Route) string {
+	if route != nil && route.CanonicalHost != "" {
+		return route.CanonicalHost
+	}
+	return s.canonicalHost
+}
+
+// canonicalHostFor returns the host a request for host and path on route
+// should be redirected to, or "". The canonical host must be routed here to
+// the same path and must not redirect back, and for secure redirects it
+// needs a certificate; otherwise the request is served as is.
+func (s *Server) canonicalHostFor(route *Route, host, path string, secure bool) string {
+	s.mu.RLock()
+	target := canonicalForm(s.canonicalMode(route), host)
+	if target == "" {
+		s.mu.RUnlock()
+		return ""
+	}
+	targetRoute := s.bestRoute(nil, target, path, true)
+	loops := targetRoute != nil && canonicalForm(s.canonicalMode(targetRoute), target) != ""
+	s.mu.RUnlock()
+
+	switch {
+	case targetRoute == nil:
+		return ""
+	case loops:
+		log.Warn().Str("host", host).Str("target", target).Msg("canonical_host modes of the two forms redirect to each other, not redirecting")
+		return ""
+	case secure && !s.hasCertificateForDomain(target):
+		log.Warn().Str("host", host).Str("target", target).Msg("No certificate for canonical host, not redirecting")
+		return ""
+	}
+	return target
+}
+
+// withPort adds the port of hostport, if any, to host
+func withPort(host, hostport string) string {
+	if _, port, err := net.SplitHostPort(hostport); err == nil && port != "" {
+		return net.JoinHostPort(host, port)
+	}
+	return host
+}
@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// TrustedProxies is the set of networks whose forwarding headers
+// (CF-Connecting-IP, X-Forwarded-For, X-Real-IP) are believed. Requests from
+// any other peer are attributed to the socket address.
+type TrustedProxies struct {
+	nets []*net.IPNet
+}
+
+// ParseTrustedProxies parses CIDRs ("173.245.48.0/20") and bare addresses
+// ("10.0.0.1", "2001:db8::1")
+func ParseTrustedProxies(entries []string) (*TrustedProxies, error) {
+	t := &TrustedProxies{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			t.nets = append(t.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		t.nets = append(t.nets, ipNet)
+	}
+	return t, nil
+}
+
+// Contains reports whether ip belongs to a trusted network
+func (t *TrustedProxies) Contains(ip net.IP) bool {
+	if t == nil || ip == nil {
+		return false
+	}
+	for _, n := range t.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of configured networks
+func (t *TrustedProxies) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.nets)
+}
+
+var trustedProxies atomic.Pointer[TrustedProxies]
+
+// SetTrustedProxies replaces the trusted proxy list used by ClientIP. nil
+// trusts no one.
+func SetTrustedProxies(t *TrustedProxies) {
+	trustedProxies.Store(t)
+}
+
+// ClientIP returns the address of the client that made r. Forwarding headers
+// are only honored when the direct peer is a trusted proxy; X-Forwarded-For
+// is walked from the right, skipping trusted hops, so entries a client
+// prepended itself are never used.
+func ClientIP(r *http.Request) string {
+	peer := stripPort(r.RemoteAddr)
+	trusted := trustedProxies.Load()
+	if !trusted.Contains(net.ParseIP(peer)) {
+		return peer
+	}
+
+	if ip := parseHeaderIP(r.Header.Get("CF-Connecting-IP")); ip != "" {
+		return ip
+	}
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			client = ip.String()
+			if !trusted.Contains(ip) {
+				break
+			}
+		}
+		return client
+	}
+	if ip := parseHeaderIP(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	return peer
+}
+
+// forwardingDirector wraps a ReverseProxy director to set X-Real-IP and the
+// X-Forwarded-* headers from the resolved client
+func forwardingDirector(originalDirector func(*http.Request)) func(*http.Request) {
+	return func(req *http.Request) {
+		// Save original host before director changes it
+		originalHost := req.Host
+
+		// Resolve the client before the director rewrites the request
+		clientIP := ClientIP(req)
+		priorXFF := priorForwardedFor(req)
+
+		// Call original director (this sets req.Host to backend host)
+		originalDirector(req)
+
+		if req.Header.Get("X-Forwarded-Host") == "" {
+			req.Header.Set("X-Forwarded-Host", originalHost)
+		}
+		if req.Header.Get("X-Forwarded-Proto") == "" {
+			req.Header.Set("X-Forwarded-Proto", "https")
+		}
+		// Always overwrite X-Real-IP so a client cannot choose its own
+		req.Header.Set("X-Real-IP", clientIP)
+		// Keep a chain only from a trusted proxy; ReverseProxy appends the
+		// direct peer after the director runs
+		if priorXFF != "" {
+			req.Header.Set("X-Forwarded-For", priorXFF)
+		} else {
+			req.Header.Del("X-Forwarded-For")
+		}
+	}
+}
+
+// forwardedFor returns the X-Forwarded-For chain to send upstream, ending
+// with the direct peer. A chain supplied by an untrusted peer is dropped.
+func forwardedFor(r *http.Request) string {
+	peer := stripPort(r.RemoteAddr)
+	if prior := priorForwardedFor(r); prior != "" {
+		return prior + ", " + peer
+	}
+	return peer
+}
+
+// priorForwardedFor returns the inbound X-Forwarded-For chain if the direct
+// peer is trusted to have set it
+func priorForwardedFor(r *http.Request) string {
+	xff := r.Header.Values("X-Forwarded-For")
+	if len(xff) == 0 || !trustedProxies.Load().Contains(net.ParseIP(stripPort(r.RemoteAddr))) {
+		return ""
+	}
+	return strings.Join(xff, ", ")
+}
+
+// parseHeaderIP returns the normalized address in a single-IP header, or ""
+// when it is missing or malformed
+func parseHeaderIP(value string) string {
+	ip := net.ParseIP(strings.TrimSpace(value))
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
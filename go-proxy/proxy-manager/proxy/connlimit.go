@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/chilla55/proxy-manager/metrics"
+)
+
+// connLimiter counts client connections across the HTTP and HTTPS listeners
+// and refuses new ones beyond max. Unlike netutil.LimitListener, which stops
+// accepting, a connection over the limit is accepted and closed at once, so
+// a flood fails fast instead of filling the kernel's backlog.
+type connLimiter struct {
+	max      int64 // 0 means unlimited
+	active   atomic.Int64
+	accepted atomic.Uint64
+	rejected atomic.Uint64
+	metrics  interface{} // Metrics collector (optional)
+}
+
+func newConnLimiter(max int, collector interface{}) *connLimiter {
+	return &connLimiter{max: int64(max), metrics: collector}
+}
+
+// wrap returns ln with its connections counted against the limit
+func (l *connLimiter) wrap(ln net.Listener) net.Listener {
+	return &limitListener{Listener: ln, limiter: l}
+}
+
+// admit counts a new connection, or refuses it when the limit is reached
+func (l *connLimiter) admit() bool {
+	if n := l.active.Add(1); l.max > 0 && n > l.max {
+		l.active.Add(-1)
+		l.rejected.Add(1)
+		if mc, ok := l.metrics.(*metrics.Collector); ok {
+			mc.RecordClientConnectionRejected()
+		}
+		return false
+	}
+	l.accepted.Add(1)
+	if mc, ok := l.metrics.(*metrics.Collector); ok {
+		mc.IncrementClientConnections()
+	}
+	return true
+}
+
+func (l *connLimiter) release() {
+	l.active.Add(-1)
+	if mc, ok := l.metrics.(*metrics.Collector); ok {
+		mc.DecrementClientConnections()
+	}
+}
+
+// limitListener admits accepted connections through a connLimiter
+type limitListener struct {
+	net.Listener
+	limiter *connLimiter
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.limiter.admit() {
+			return &limitConn{Conn: conn, limiter: l.limiter}, nil
+		}
+		conn.Close()
+	}
+}
+
+// limitConn frees its slot on the first Close, including after a hijack
+type limitConn struct {
+	net.Conn
+	limiter *connLimiter
+	once    sync.Once
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.limiter.release)
+	return err
+}
+
+// ClientConnections returns the open connections on the HTTP and HTTPS
+// listeners, and how many were accepted and refused by the limit
+func (s *Server) ClientConnections() (active int64, accepted, rejected uint64) {
+	return s.conns.active.Load(), s.conns.accepted.Load(), s.conns.rejected.Load()
+}
@@ -0,0 +1,271 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// EffectiveRoute is a route's configuration as requests see it, after site
+// YAML, registry options and global defaults were merged. Durations are
+// strings like "30s"; secrets are redacted.
+type EffectiveRoute struct {
+	Domains         []string          `json:"domains"`
+	Path            string            `json:"path"`
+	Source          RouteSource       `json:"source"`
+	Active          bool              `json:"active"` // false when shadowed by the other source
+	Enabled         bool              `json:"enabled"`
+	Backend         string            `json:"backend"`
+	ServiceName     string            `json:"service_name,omitempty"`
+	LimitKey        string            `json:"service_limit_key,omitempty"`
+	Match           RouteMatch        `json:"match"`
+	RedirectTo      string            `json:"redirect_to,omitempty"`
+	RedirectStatus  int               `json:"redirect_status,omitempty"`
+	CanonicalHost   string            `json:"canonical_host"`
+	HTTPSRedirect   bool              `json:"https_redirect"`
+	WebSocket       bool              `json:"websocket"`
+	ResponseHeaders map[string]string `json:"response_headers"`
+	StripHeaders    []string          `json:"strip_response_headers,omitempty"`
+	Timeout         string            `json:"timeout"`
+	RequestTimeout  string            `json:"request_timeout,omitempty"`
+	Streaming       bool              `json:"streaming,omitempty"`
+	HealthPath      string            `json:"health_check_path"`
+	RateLimit       struct {
+		Requests int    `json:"requests,omitempty"`
+		Window   string `json:"window,omitempty"`
+	} `json:"rate_limit"`
+	BackendRateLimit struct {
+		Requests int    `json:"requests,omitempty"`
+		Window   string `json:"window,omitempty"`
+	} `json:"backend_rate_limit"`
+	Maintenance struct {
+		Active     bool   `json:"active"`
+		Status     int    `json:"status"`
+		RetryAfter string `json:"retry_after"`
+		PageURL    string `json:"page_url,omitempty"`
+	} `json:"maintenance"`
+	Drain struct {
+		Status     int    `json:"status"`
+		RetryAfter string `json:"retry_after"`
+		Redirect   string `json:"redirect,omitempty"`
+	} `json:"drain"`
+	DisabledRetryAfter string `json:"disabled_retry_after"`
+	Retry              struct {
+		Enabled      bool     `json:"enabled"`
+		MaxAttempts  int      `json:"max_attempts,omitempty"`
+		Backoff      string   `json:"backoff,omitempty"`
+		InitialDelay string   `json:"initial_delay,omitempty"`
+		MaxDelay     string   `json:"max_delay,omitempty"`
+		RetryOn      []string `json:"retry_on,omitempty"`
+	} `json:"retry"`
+	Compression struct {
+		Enabled      bool     `json:"enabled"`
+		Level        int      `json:"level"`
+		MinSize      int64    `json:"min_size"`
+		Algorithms   []string `json:"algorithms"`
+		ContentTypes []string `json:"content_types"`
+	} `json:"compression"`
+	CircuitBreaker struct {
+		Enabled          bool   `json:"enabled"`
+		FailureThreshold int    `json:"failure_threshold"`
+		SuccessThreshold int    `json:"success_threshold"`
+		Timeout          string `json:"timeout"`
+		Window           string `json:"window"`
+	} `json:"circuit_breaker"`
+	WebSocketLimits struct {
+		MaxConnections int    `json:"max_connections,omitempty"`
+		MaxDuration    string `json:"max_duration"`
+		IdleTimeout    string `json:"idle_timeout"`
+		PingInterval   string `json:"ping_interval"`
+	} `json:"websocket_limits"`
+	Mirror struct {
+		Backend string  `json:"backend,omitempty"`
+		Percent float64 `json:"percent,omitempty"`
+	} `json:"mirror"`
+}
+
+// secretHeaderWords mark header names whose values are redacted
+var secretHeaderWords = []string{"authorization", "cookie", "token", "secret", "password", "api-key", "apikey"}
+
+// redactedValue replaces secrets in effective configuration
+const redactedValue = "[redacted]"
+
+// EffectiveRoutes returns the effective configuration of the routes for
+// domain and path, active ones first. Predicate variants and shadowed routes
+// of the other source are all listed.
+func (s *Server) EffectiveRoutes(domain, path string) []EffectiveRoute {
+	s.mu.RLock()
+	var routes []*Route
+	shadowed := make(map[*Route]bool, len(s.shadowed))
+	for _, r := range s.shadowed {
+		shadowed[r] = true
+	}
+	for _, r := range append(append([]*Route(nil), s.routes...), s.shadowed...) {
+		if s.routeMatches(r, []string{domain}, path) {
+			routes = append(routes, r)
+		}
+	}
+	s.mu.RUnlock()
+
+	result := make([]EffectiveRoute, 0, len(routes))
+	for _, r := range routes {
+		result = append(result, s.effectiveRoute(r, !shadowed[r]))
+	}
+	return result
+}
+
+func (s *Server) effectiveRoute(r *Route, active bool) EffectiveRoute {
+	e := EffectiveRoute{
+		Domains:       r.Domains,
+		Path:          r.Path,
+		Source:        r.Source,
+		Active:        active,
+		Enabled:       r.Enabled,
+		Match:         r.Match,
+		HTTPSRedirect: !r.AllowHTTP,
+		WebSocket:     r.WebSocket,
+	}
+
+	s.mu.RLock()
+	e.CanonicalHost = s.canonicalMode(r)
+	s.mu.RUnlock()
+	if e.CanonicalHost == "" {
+		e.CanonicalHost = CanonicalOff
+	}
+
+	if r.Redirect != nil {
+		e.RedirectTo = redactURL(r.Redirect.Target)
+		e.RedirectStatus = r.Redirect.Status
+	}
+	if r.RateLimitReqs > 0 {
+		e.RateLimit.Requests = r.RateLimitReqs
+		e.RateLimit.Window = r.RateLimitWindow.String()
+	}
+
+	// The headers a response gets, globals overridden by the route's
+	headers := make(http.Header)
+	s.applyHeaders(headerWriter(headers), r)
+	e.ResponseHeaders = make(map[string]string, len(headers))
+	for name := range headers {
+		e.ResponseHeaders[name] = redactHeader(name, headers.Get(name))
+	}
+
+	b := r.Backend
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	e.Backend = redactURL(b.URL)
+	if r.Redirect != nil {
+		e.Backend = ""
+	}
+	e.ServiceName = b.serviceName
+	e.LimitKey = b.limitKey
+	if b.globalStrip != nil {
+		e.StripHeaders = append(e.StripHeaders, b.globalStrip()...)
+	}
+	e.StripHeaders = append(e.StripHeaders, b.stripHeaders...)
+	e.Timeout = b.Timeout.String()
+	if b.requestTimeout > 0 {
+		e.RequestTimeout = b.requestTimeout.String()
+	}
+	e.Streaming = b.streaming
+	e.HealthPath = b.HealthPath
+	if b.rateLimit != nil {
+		e.BackendRateLimit.Requests = b.rateLimit.requests
+		e.BackendRateLimit.Window = b.rateLimit.window.String()
+	}
+
+	e.Maintenance.Active = b.InMaintenance
+	e.Maintenance.Status = b.maintenanceStatus
+	e.Maintenance.RetryAfter = b.maintenanceRetry.String()
+	if b.MaintenancePageURL != "" {
+		if u, err := url.Parse(b.MaintenancePageURL); err == nil {
+			e.Maintenance.PageURL = redactURL(u)
+		}
+	}
+	e.Drain.Status = b.drainStatus
+	e.Drain.RetryAfter = b.drainRetry.String()
+	e.Drain.Redirect = b.drainRedirect
+	e.DisabledRetryAfter = b.disabledRetry.String()
+
+	e.Retry.Enabled = b.retryEnabled
+	if b.retryEnabled {
+		e.Retry.MaxAttempts = b.retryMax
+		e.Retry.Backoff = b.retryBackoff
+		e.Retry.InitialDelay = b.retryInitial.String()
+		e.Retry.MaxDelay = b.retryMaxDelay.String()
+		for on := range b.retryOn {
+			e.Retry.RetryOn = append(e.Retry.RetryOn, on)
+		}
+		sort.Strings(e.Retry.RetryOn)
+	}
+
+	e.Compression.Enabled = b.compressionEnabled
+	e.Compression.Level = b.compressionLevel
+	e.Compression.MinSize = b.compressionMinSize
+	e.Compression.Algorithms = b.compressionAlgos
+	for ct := range b.compressionTypes {
+		e.Compression.ContentTypes = append(e.Compression.ContentTypes, ct)
+	}
+	sort.Strings(e.Compression.ContentTypes)
+
+	e.CircuitBreaker.Enabled = b.cbEnabled
+	e.CircuitBreaker.FailureThreshold = b.cbFailureThreshold
+	e.CircuitBreaker.SuccessThreshold = b.cbSuccessThreshold
+	e.CircuitBreaker.Timeout = b.cbTimeout.String()
+	e.CircuitBreaker.Window = b.cbWindow.String()
+
+	e.WebSocketLimits.MaxConnections = b.websocketMaxConn
+	e.WebSocketLimits.MaxDuration = b.websocketMaxDur.String()
+	e.WebSocketLimits.IdleTimeout = b.websocketIdle.String()
+	e.WebSocketLimits.PingInterval = b.websocketPing.String()
+
+	if b.mirror != nil {
+		e.Mirror.Backend = redactURL(b.mirror.target)
+		e.Mirror.Percent = b.mirror.percent
+	}
+	return e
+}
+
+// EffectiveGlobalHeaders returns the headers added to every response before
+// route overrides, credentials redacted
+func (s *Server) EffectiveGlobalHeaders() map[string]string {
+	headers := make(http.Header)
+	s.applyHeaders(headerWriter(headers), nil)
+	result := make(map[string]string, len(headers))
+	for name := range headers {
+		result[name] = redactHeader(name, headers.Get(name))
+	}
+	return result
+}
+
+// headerWriter collects the headers applyHeaders sets
+type headerWriter http.Header
+
+func (h headerWriter) Header() http.Header         { return http.Header(h) }
+func (h headerWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (h headerWriter) WriteHeader(int)             {}
+
+// redactHeader hides values of headers that look like credentials
+func redactHeader(name, value string) string {
+	lower := strings.ToLower(name)
+	for _, word := range secretHeaderWords {
+		if strings.Contains(lower, word) {
+			return redactedValue
+		}
+	}
+	return value
+}
+
+// redactURL hides a URL's password and query, which may carry tokens
+func redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	c := *u
+	if c.RawQuery != "" {
+		c.RawQuery = redactedValue
+	}
+	return c.Redacted()
+}
@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chilla55/proxy-manager/staticpages"
+	"github.com/chilla55/proxy-manager/tracing"
+	"github.com/rs/zerolog/log"
+)
+
+// MaintenancePageData holds the variables available to maintenance
+// templates, e.g. {{.Service}} or {{.ETA}}
+type MaintenancePageData struct {
+	Service   string // Service name, or the domain when unknown
+	Domain    string
+	Path      string
+	Reason    string // Empty unless given when entering maintenance
+	ETA       string // Expected end, free text
+	RequestID string
+}
+
+// loadMaintenanceTemplate parses a route's custom maintenance page
+func loadMaintenanceTemplate(path string) (*template.Template, error) {
+	tmpl, err := template.New(filepath.Base(path)).ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse maintenance template %s: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+// SetMaintenanceDetails sets the reason and expected end shown on the
+// proxy's own maintenance page for routes already in maintenance
+func (s *Server) SetMaintenanceDetails(domains []string, path, reason, eta string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := false
+	for _, route := range s.routes {
+		if s.routeMatches(route, domains, path) {
+			route.Backend.mu.Lock()
+			route.Backend.MaintenanceReason = reason
+			route.Backend.MaintenanceETA = eta
+			route.Backend.mu.Unlock()
+			found = true
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("route not found")
+	}
+	return nil
+}
+
+// serveMaintenancePage answers with the route's maintenance template, or the
+// built-in page when it has none or the template fails
+func (s *Server) serveMaintenancePage(w http.ResponseWriter, r *http.Request, b *Backend, host string) {
+	b.mu.RLock()
+	tmpl := b.maintenanceTemplate
+	status := b.maintenanceStatus
+	data := MaintenancePageData{
+		Service:   b.serviceName,
+		Domain:    host,
+		Path:      r.URL.Path,
+		Reason:    b.MaintenanceReason,
+		ETA:       b.MaintenanceETA,
+		RequestID: tracing.GetRequestIDFromRequest(r),
+	}
+	b.mu.RUnlock()
+	if data.Service == "" {
+		data.Service = host
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if tmpl != nil {
+		var buf bytes.Buffer
+		err := tmpl.Execute(&buf, data)
+		if err == nil {
+			w.WriteHeader(status)
+			_, _ = buf.WriteTo(w)
+			return
+		}
+		log.Error().Err(err).Str("domain", host).Msg("Maintenance template failed - using built-in page")
+	}
+
+	reason := data.Reason
+	if reason == "" {
+		reason = "Scheduled maintenance"
+	}
+	_, html := staticpages.GetPage(staticpages.PageMaintenanceDefault, staticpages.PageData{
+		Domain:       template.HTMLEscapeString(data.Service),
+		Reason:       template.HTMLEscapeString(reason),
+		ScheduledEnd: template.HTMLEscapeString(data.ETA),
+		RequestID:    data.RequestID,
+	})
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, html)
+}
+
+// maintenanceStatusOverride gives HTML pages from a maintenance server the
+// route's maintenance status, so clients and crawlers do not cache them as
+// the real content. Assets keep their status.
+func (b *Backend) maintenanceStatusOverride(res *http.Response) error {
+	if res.StatusCode < 300 && strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		res.StatusCode = b.maintenanceStatus
+		res.Status = fmt.Sprintf("%d %s", b.maintenanceStatus, http.StatusText(b.maintenanceStatus))
+		setRetryAfter(res.Header, b.maintenanceRetry)
+	}
+	return nil
+}
+
+// rejectDraining answers a request turned away by a drain, either with the
+// route's drain status or a redirect to drainRedirect
+func (b *Backend) rejectDraining(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Drain-Mode", "true")
+	setRetryAfter(w.Header(), b.drainRetry)
+	status := b.drainStatus
+	if status >= 300 && status < 400 {
+		if b.drainRedirect != "" {
+			http.Redirect(w, r, b.drainRedirect, status)
+			return
+		}
+		status = http.StatusServiceUnavailable // A redirect needs somewhere to go
+	}
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, "Service draining")
+}
+
+// serveDisabled answers a request to a disabled route with a 503 page and
+// the route's retry hint, rather than blackholing it like an unknown domain
+func (s *Server) serveDisabled(w http.ResponseWriter, r *http.Request, b *Backend, host string) {
+	b.mu.RLock()
+	service := b.serviceName
+	retry := b.disabledRetry
+	b.mu.RUnlock()
+	if service == "" {
+		service = host
+	}
+
+	_, html := staticpages.GetPage(staticpages.PageMaintenanceDefault, staticpages.PageData{
+		Domain:    template.HTMLEscapeString(service),
+		Reason:    "The service is temporarily unavailable and should be back shortly.",
+		RequestID: tracing.GetRequestIDFromRequest(r),
+	})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Route-Disabled", "true")
+	setRetryAfter(w.Header(), retry)
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = io.WriteString(w, html)
+}
+
+// setRetryAfter sets Retry-After in whole seconds; 0 leaves it unset
+func setRetryAfter(h http.Header, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	secs := int(d.Round(time.Second) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	h.Set("Retry-After", strconv.Itoa(secs))
+}
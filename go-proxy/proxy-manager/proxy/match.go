@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Match types for request predicates
+const (
+	MatchExact = "exact"
+	MatchRegex = "regex"
+)
+
+// ValueMatch is a route predicate on a named request value: a header, a
+// query parameter or a cookie. An exact match compares the whole value; a
+// regex matches anywhere unless anchored.
+type ValueMatch struct {
+	Name  string `json:"name"`
+	Type  string `json:"type,omitempty"` // "exact" (default) or "regex"
+	Value string `json:"value"`
+
+	re *regexp.Regexp
+}
+
+// RouteMatch holds a route's request predicates, passed to AddRoute as the
+// "match" option. All predicates must match. Of the routes for the same
+// host and path, the one with the most matching predicates is chosen; on a
+// tie header predicates rank above cookie predicates, which rank above query
+// predicates. A route without predicates is the fallback.
+type RouteMatch struct {
+	Headers []ValueMatch `json:"header_match,omitempty"`
+	Cookies []ValueMatch `json:"cookie_match,omitempty"`
+	Query   []ValueMatch `json:"query_match,omitempty"`
+}
+
+// IsZero reports whether m has no predicates
+func (m RouteMatch) IsZero() bool {
+	return m.Specificity() == 0
+}
+
+// Specificity is the number of predicates
+func (m RouteMatch) Specificity() int {
+	return len(m.Headers) + len(m.Cookies) + len(m.Query)
+}
+
+// moreSpecific reports whether m ranks above other for the same path
+func (m RouteMatch) moreSpecific(other RouteMatch) bool {
+	if a, b := m.Specificity(), other.Specificity(); a != b {
+		return a > b
+	}
+	if a, b := len(m.Headers), len(other.Headers); a != b {
+		return a > b
+	}
+	return len(m.Cookies) > len(other.Cookies)
+}
+
+// Key identifies the predicate set regardless of order; "" when empty
+func (m RouteMatch) Key() string {
+	if m.IsZero() {
+		return ""
+	}
+	parts := make([]string, 0, m.Specificity())
+	for _, h := range m.Headers {
+		parts = append(parts, "header:"+http.CanonicalHeaderKey(h.Name)+":"+h.matchType()+":"+h.Value)
+	}
+	for _, c := range m.Cookies {
+		parts = append(parts, "cookie:"+c.Name+":"+c.matchType()+":"+c.Value)
+	}
+	for _, q := range m.Query {
+		parts = append(parts, "query:"+q.Name+":"+q.matchType()+":"+q.Value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "\n")
+}
+
+// Validate checks names, types and regular expressions
+func (m RouteMatch) Validate() error {
+	_, err := m.compile()
+	return err
+}
+
+// compile returns a copy of m with its regular expressions compiled
+func (m RouteMatch) compile() (RouteMatch, error) {
+	var out RouteMatch
+	var err error
+	if out.Headers, err = compileValueMatches("header_match", m.Headers); err != nil {
+		return RouteMatch{}, err
+	}
+	if out.Cookies, err = compileValueMatches("cookie_match", m.Cookies); err != nil {
+		return RouteMatch{}, err
+	}
+	if out.Query, err = compileValueMatches("query_match", m.Query); err != nil {
+		return RouteMatch{}, err
+	}
+	return out, nil
+}
+
+func compileValueMatches(field string, matches []ValueMatch) ([]ValueMatch, error) {
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	out := make([]ValueMatch, len(matches))
+	for i, v := range matches {
+		if strings.TrimSpace(v.Name) == "" {
+			return nil, fmt.Errorf("%s %d: name is required", field, i)
+		}
+		switch v.matchType() {
+		case MatchExact:
+		case MatchRegex:
+			re, err := regexp.Compile(v.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", field, v.Name, err)
+			}
+			v.re = re
+		default:
+			return nil, fmt.Errorf("%s %s: unknown type %q", field, v.Name, v.Type)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// matches reports whether r satisfies every predicate
+func (m RouteMatch) matches(r *http.Request) bool {
+	for _, h := range m.Headers {
+		if !h.matchesAny(r.Header.Values(h.Name)) {
+			return false
+		}
+	}
+	if len(m.Cookies) > 0 {
+		cookies := r.Cookies()
+		for _, c := range m.Cookies {
+			var values []string
+			for _, cookie := range cookies {
+				if cookie.Name == c.Name {
+					values = append(values, cookie.Value)
+				}
+			}
+			if !c.matchesAny(values) {
+				return false
+			}
+		}
+	}
+	if len(m.Query) > 0 {
+		query := r.URL.Query()
+		for _, q := range m.Query {
+			if !q.matchesAny(query[q.Name]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (v ValueMatch) matchType() string {
+	if v.Type == "" {
+		return MatchExact
+	}
+	return strings.ToLower(v.Type)
+}
+
+// matchesAny reports whether any of values matches; false when there are none
+func (v ValueMatch) matchesAny(values []string) bool {
+	for _, value := range values {
+		if v.re != nil {
+			if v.re.MatchString(value) {
+				return true
+			}
+		} else if value == v.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// routeMatchOption reads the "match" option
+func routeMatchOption(options map[string]interface{}) (RouteMatch, error) {
+	m, _ := options["match"].(RouteMatch)
+	return m.compile()
+}
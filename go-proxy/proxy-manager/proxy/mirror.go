@@ -0,0 +1,197 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chilla55/proxy-manager/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// MirrorHeader is set on the copies sent to a mirror backend
+const MirrorHeader = "X-Mirrored-Request"
+
+// Results counted in proxy_mirror_requests_total
+const (
+	mirrorSent    = "sent"    // The mirror answered, whatever the status
+	mirrorFailed  = "failed"  // Transport error or timeout
+	mirrorSkipped = "skipped" // Over the rate, in-flight or body size limit
+)
+
+const (
+	defaultMirrorMaxBody  = 1 << 20 // 1MB
+	defaultMirrorTimeout  = 10 * time.Second
+	mirrorMaxInFlight     = 100 // Copies in progress per route before new ones are skipped
+	mirrorMaxResponseRead = 1 << 20
+)
+
+// hopHeaders are connection specific and not copied to mirror requests
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// mirror copies a route's requests to a shadow backend. Copies are sent in
+// the background with their own timeout; responses are discarded and
+// failures never affect the client's response.
+type mirror struct {
+	target  *url.URL
+	client  *http.Client
+	percent float64 // Share of requests copied, 0-100
+	maxBody int64   // Requests with larger bodies are not copied
+	rate    float64 // Copies per second, 0 unlimited
+	metrics *metrics.Collector
+
+	mu         sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+	inFlight   atomic.Int32
+}
+
+// newMirror builds the mirror for backendURL from the route's mirror_*
+// options: mirror_percent, mirror_rate, mirror_max_body and mirror_timeout
+func newMirror(backendURL string, options map[string]interface{}) (*mirror, error) {
+	target, err := url.Parse(backendURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid mirror_backend %q", backendURL)
+	}
+
+	m := &mirror{target: target, percent: 100, maxBody: defaultMirrorMaxBody, lastRefill: time.Now()}
+	switch v := options["mirror_percent"].(type) {
+	case float64:
+		m.percent = v
+	case int:
+		m.percent = float64(v)
+	}
+	if m.percent <= 0 || m.percent > 100 {
+		return nil, fmt.Errorf("mirror_percent must be between 0 and 100, got %v", m.percent)
+	}
+	if v, ok := options["mirror_rate"].(int); ok && v > 0 {
+		m.rate = float64(v)
+		m.tokens = m.rate
+	}
+	switch v := options["mirror_max_body"].(type) {
+	case int64:
+		m.maxBody = v
+	case int:
+		m.maxBody = int64(v)
+	}
+	timeout := defaultMirrorTimeout
+	if v, ok := options["mirror_timeout"].(time.Duration); ok && v > 0 {
+		timeout = v
+	}
+
+	m.client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         (&net.Dialer{Timeout: 5 * time.Second}).DialContext,
+			MaxIdleConnsPerHost: 16,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		// Report redirects to the caller instead of following them
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return m, nil
+}
+
+// send copies r to the mirror without waiting for it. A body is buffered up
+// to maxBody and put back on r, so the primary request still reads all of it.
+func (m *mirror) send(r *http.Request) {
+	if m.percent < 100 && rand.Float64()*100 >= m.percent {
+		return
+	}
+	if r.ContentLength > m.maxBody || !m.allow() {
+		m.record(mirrorSkipped)
+		return
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		buf, err := io.ReadAll(io.LimitReader(r.Body, m.maxBody+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		if err != nil || int64(len(buf)) > m.maxBody {
+			m.inFlight.Add(-1)
+			m.record(mirrorSkipped)
+			return
+		}
+		body = buf
+	}
+
+	target := *m.target
+	target.Path = strings.TrimSuffix(m.target.Path, "/") + r.URL.Path
+	target.RawPath = ""
+	target.RawQuery = r.URL.RawQuery
+
+	req, err := http.NewRequestWithContext(context.Background(), r.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		m.inFlight.Add(-1)
+		m.record(mirrorFailed)
+		return
+	}
+	req.Header = r.Header.Clone()
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+	req.Header.Set("X-Forwarded-For", ClientIP(r))
+	req.Header.Set(MirrorHeader, "true")
+	req.Host = r.Host
+	req.ContentLength = int64(len(body))
+
+	go func() {
+		defer m.inFlight.Add(-1)
+		res, err := m.client.Do(req)
+		if err != nil {
+			log.Debug().Err(err).Str("mirror", m.target.Host).Str("path", r.URL.Path).Msg("Mirror request failed")
+			m.record(mirrorFailed)
+			return
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, mirrorMaxResponseRead))
+		res.Body.Close()
+		m.record(mirrorSent)
+	}()
+}
+
+// allow takes a rate token and an in-flight slot
+func (m *mirror) allow() bool {
+	if m.rate > 0 {
+		m.mu.Lock()
+		now := time.Now()
+		m.tokens += now.Sub(m.lastRefill).Seconds() * m.rate
+		if m.tokens > m.rate {
+			m.tokens = m.rate
+		}
+		m.lastRefill = now
+		if m.tokens < 1 {
+			m.mu.Unlock()
+			return false
+		}
+		m.tokens--
+		m.mu.Unlock()
+	}
+	if m.inFlight.Add(1) > mirrorMaxInFlight {
+		m.inFlight.Add(-1)
+		return false
+	}
+	return true
+}
+
+func (m *mirror) record(result string) {
+	if m.metrics != nil {
+		m.metrics.RecordMirror(result)
+	}
+}
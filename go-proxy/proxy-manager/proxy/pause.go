@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chilla55/proxy-manager/staticpages"
+	"github.com/chilla55/proxy-manager/webhook"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultPauseRetryAfter is the Retry-After sent while paused unless
+// configured
+const defaultPauseRetryAfter = 60 * time.Second
+
+// PauseStatus describes the global pause switch
+type PauseStatus struct {
+	Paused      bool      `json:"paused"`
+	Since       time.Time `json:"since,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Rejected    int64     `json:"rejected"` // Requests answered 503 since the pause started
+	ExemptPaths []string  `json:"exempt_paths"`
+}
+
+// pauseState is the global pause switch. paused is read on every request;
+// the rest only changes on Pause, Resume and reload.
+type pauseState struct {
+	paused     atomic.Bool
+	rejected   atomic.Int64
+	since      time.Time
+	reason     string
+	exempt     []string
+	retryAfter time.Duration
+}
+
+// Pause makes every route answer 503 without touching its configuration,
+// except requests for an exempt path. It reports false when already paused.
+func (s *Server) Pause(reason string) bool {
+	s.mu.Lock()
+	if s.pause.paused.Load() {
+		s.mu.Unlock()
+		return false
+	}
+	s.pause.since = time.Now()
+	s.pause.reason = reason
+	s.pause.rejected.Store(0)
+	s.pause.paused.Store(true)
+	s.mu.Unlock()
+
+	log.Warn().Str("reason", reason).Msg("Proxy paused, all routes answer 503")
+	s.sendPauseAlert(webhook.Alert{
+		Event:       webhook.EventProxyPaused,
+		Title:       "Proxy paused",
+		Description: "All proxied traffic is answered with 503 until resumed",
+		Severity:    "critical",
+		Fields:      map[string]string{"reason": reason},
+	})
+	return true
+}
+
+// Resume ends a pause. It reports false when the proxy was not paused.
+func (s *Server) Resume() bool {
+	s.mu.Lock()
+	if !s.pause.paused.Load() {
+		s.mu.Unlock()
+		return false
+	}
+	s.pause.paused.Store(false)
+	duration := time.Since(s.pause.since).Round(time.Second)
+	rejected := s.pause.rejected.Load()
+	s.mu.Unlock()
+
+	log.Info().Dur("paused_for", duration).Int64("rejected", rejected).Msg("Proxy resumed")
+	s.sendPauseAlert(webhook.Alert{
+		Event:       webhook.EventProxyResumed,
+		Title:       "Proxy resumed",
+		Description: fmt.Sprintf("Traffic is proxied again after %s", duration),
+		Severity:    "info",
+		Fields: map[string]string{
+			"paused_for": duration.String(),
+			"rejected":   fmt.Sprint(rejected),
+		},
+	})
+	return true
+}
+
+// PauseStatus returns whether the proxy is paused, since when and why
+func (s *Server) PauseStatus() PauseStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	status := PauseStatus{
+		Paused:      s.pause.paused.Load(),
+		ExemptPaths: append([]string{}, s.pause.exempt...),
+	}
+	if status.Paused {
+		status.Since = s.pause.since
+		status.Reason = s.pause.reason
+		status.Rejected = s.pause.rejected.Load()
+	}
+	return status
+}
+
+// SetPauseOptions replaces the path prefixes still proxied while paused
+// and the Retry-After sent with the 503, 0 for the default
+func (s *Server) SetPauseOptions(exempt []string, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		retryAfter = defaultPauseRetryAfter
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pause.exempt = exempt
+	s.pause.retryAfter = retryAfter
+}
+
+// servePaused answers r with 503 and reports true when the proxy is paused
+// and r is not for an exempt path
+func (s *Server) servePaused(w http.ResponseWriter, r *http.Request) bool {
+	if !s.pause.paused.Load() {
+		return false
+	}
+	s.mu.RLock()
+	exempt, retryAfter := s.pause.exempt, s.pause.retryAfter
+	s.mu.RUnlock()
+	for _, prefix := range exempt {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	}
+
+	s.pause.rejected.Add(1)
+	status, html := staticpages.GetPage(staticpages.PageServiceUnavailable, staticpages.PageData{Domain: r.Host})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("X-Proxy-Paused", "true")
+	setRetryAfter(w.Header(), retryAfter)
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, html)
+	return true
+}
+
+func (s *Server) sendPauseAlert(alert webhook.Alert) {
+	notifier, ok := s.notifier.(*webhook.Notifier)
+	if !ok || notifier == nil {
+		return
+	}
+	alert.Timestamp = time.Now()
+	// Delivery can take seconds; the admin request should not wait for it
+	go func() {
+		if err := notifier.Send(alert); err != nil {
+			log.Warn().Err(err).Str("event", string(alert.Event)).Msg("Failed to send pause alert")
+		}
+	}()
+}
@@ -5,12 +5,17 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -18,6 +23,7 @@ import (
 
 	"github.com/andybalholm/brotli"
 	"github.com/chilla55/proxy-manager/database"
+	"github.com/chilla55/proxy-manager/events"
 	"github.com/chilla55/proxy-manager/metrics"
 	"github.com/chilla55/proxy-manager/staticpages"
 	"github.com/chilla55/proxy-manager/tracing"
@@ -35,6 +41,32 @@ type SecurityHeaders struct {
 	CSP               string
 	ReferrerPolicy    string
 	PermissionsPolicy string
+
+	// Upstream response headers removed before reaching the client
+	StripResponse []string
+	HideServer    bool // Also strip Server and X-Powered-By
+}
+
+// hopByHopHeaders are connection specific and never forwarded (RFC 9110 7.6.1)
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// stripList returns the global response headers to strip
+func (h SecurityHeaders) stripList() []string {
+	list := append([]string(nil), h.StripResponse...)
+	if h.HideServer {
+		list = append(list, "Server", "X-Powered-By")
+	}
+	return list
 }
 
 // Backend represents a proxy target
@@ -52,6 +84,8 @@ type Backend struct {
 	InMaintenance      bool
 	MaintenancePageURL string // Custom maintenance page URL (optional)
 	MaintenanceHits    int64  // Count of requests during maintenance
+	MaintenanceReason  string // Shown on the proxy's maintenance page
+	MaintenanceETA     string // Expected end shown on the proxy's maintenance page
 	Draining           bool
 	DrainStart         time.Time
 	DrainDuration      time.Duration
@@ -60,6 +94,8 @@ type Backend struct {
 	slowEnabled        bool
 	slowWarning        time.Duration
 	slowCritical       time.Duration
+	slowMultiplier     float64         // Adaptive mode: multiple of p95/p99
+	latency            *latencyTracker // Adaptive mode only
 	slowTimeout        time.Duration
 	alertWebhook       bool
 	retryEnabled       bool
@@ -81,22 +117,45 @@ type Backend struct {
 	websocketActive    int64
 	metrics            *metrics.Collector
 	// Circuit breaker (Phase 6)
-	cbEnabled          bool
-	cbFailureThreshold int
-	cbSuccessThreshold int
-	cbTimeout          time.Duration
-	cbWindow           time.Duration
-	cbState            string // "closed", "open", "half-open"
-	cbFailures         int
-	cbSuccesses        int
-	cbOpenedAt         time.Time
-	cbLastFailure      time.Time
+	cbEnabled           bool
+	cbFailureThreshold  int
+	cbSuccessThreshold  int
+	cbTimeout           time.Duration
+	cbWindow            time.Duration
+	cbState             string // "closed", "open", "half-open"
+	cbFailures          int
+	cbSuccesses         int
+	cbOpenedAt          time.Time
+	cbLastFailure       time.Time
+	cbForced            string // CircuitForceOpen or CircuitForceClose, "" for automatic
+	events              *events.Bus
+	requestIDHeader     string
+	stripHeaders        []string               // Route specific response headers to strip
+	globalStrip         func() []string        // Global response headers to strip
+	serviceName         string                 // Shown on the maintenance page
+	maintenanceTemplate *template.Template     // Custom maintenance page, nil for the built-in one
+	maintenanceStatus   int                    // Status of maintenance responses, default 503
+	maintenanceRetry    time.Duration          // Retry-After on maintenance responses
+	drainStatus         int                    // Status of requests rejected while draining, default 503
+	drainRetry          time.Duration          // Retry-After on drain rejections
+	drainRedirect       string                 // Location when drainStatus is a redirect
+	disabledRetry       time.Duration          // Retry-After while the route is disabled
+	limitKey            string                 // Service whose limits apply, see SetServiceLimits
+	maxResponseBody     int64                  // Upstream response size limit, 0 unlimited
+	requestTimeout      time.Duration          // Deadline for the whole upstream exchange, 0 none
+	streaming           bool                   // Long-lived responses, exempt from requestTimeout
+	validator           *responseValidator     // Checks 2xx responses, nil when off
+	mirror              *mirror                // Receives copies of requests, nil when not mirrored
+	rateLimit           *backendRateLimiter    // backend_rate_limit across all clients, nil for none
+	options             map[string]interface{} // Copy of the options the backend was built from
 }
 
 // responseWriter wraps http.ResponseWriter to capture status code
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	written    uint64          // Body bytes written
+	limit      *serviceLimiter // Charged for bytes written, nil when unlimited
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -104,6 +163,28 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(p)
+	rw.written += uint64(n)
+	if rw.limit != nil {
+		rw.limit.charge(n)
+	}
+	return n, err
+}
+
+// Flush implements http.Flusher so streamed responses such as server-sent
+// events reach the client as the upstream writes them
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // Hijack implements http.Hijacker for WebSocket support
 func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	if hijacker, ok := rw.ResponseWriter.(http.Hijacker); ok {
@@ -123,12 +204,28 @@ type Route struct {
 	Priority        int  // For sorting (longer paths = higher priority)
 	RateLimitReqs   int
 	RateLimitWindow time.Duration
+	Source          RouteSource       // Who registered the route (static YAML or registry)
+	AllowOverride   bool              // Static only: registry routes for the same domain+path take precedence
+	Match           RouteMatch        // Request predicates; zero for a plain domain+path route
+	Redirect        *Redirect         // Answers with a redirect instead of proxying
+	CanonicalHost   string            // apex, www or off; empty uses the global mode
+	AllowHTTP       bool              // Served on the plain HTTP listener instead of redirected to HTTPS
+	Labels          map[string]string // Organizational tags, e.g. team or environment
 }
 
+// RouteSource identifies where a route was registered from
+type RouteSource string
+
+const (
+	SourceStatic   RouteSource = "static"   // Site YAML under sites-path
+	SourceRegistry RouteSource = "registry" // Dynamic registration via the service registry
+)
+
 // BackendStatus represents runtime backend health status
 type BackendStatus struct {
 	Healthy            bool
 	CircuitState       string
+	CircuitForced      bool // Set by ForceCircuitBreaker, automatic transitions are off
 	Failures           int
 	Successes          int
 	OpenedAt           time.Time
@@ -140,13 +237,19 @@ type BackendStatus struct {
 	DrainStart         time.Time
 	DrainRemaining     time.Duration
 	DrainRejected      int64
+	ValidationFailures uint64        // 2xx responses failing response_validation
+	Timeout            time.Duration // Upstream connect and response header timeout
 }
 
 // RouteSummary provides a read-only snapshot of a route for dashboards
 type RouteSummary struct {
 	Domains            []string
 	Path               string
+	Match              RouteMatch // Request predicates, zero for a plain route
+	Labels             map[string]string
 	BackendURL         string
+	Source             RouteSource
+	Shadowed           bool
 	Enabled            bool
 	Healthy            bool
 	InMaintenance      bool
@@ -182,14 +285,19 @@ type CertMapping struct {
 // Server is the main reverse proxy server
 type Server struct {
 	mu              sync.RWMutex
-	routes          []*Route
-	routeMap        map[string]*Backend // domain+path -> backend
+	routes          []*Route            // Active routes
+	shadowed        []*Route            // Routes hidden by a higher precedence route for the same domain+path
+	routeMap        map[string]*Backend // domain+path -> backend, plain routes only
+	matchRoutes     int                 // Active routes with request predicates
 	globalHeaders   SecurityHeaders
+	stripHeaders    []string // Derived from globalHeaders
+	canonicalHost   string   // Global canonical_host mode
+	httpExempt      []string // Path prefixes served over plain HTTP
 	blackholeMetric int64
 
 	httpServer   *http.Server
-	httpsServer  *http.Server
-	http3Server  *http3.Server
+	httpsServers []*http.Server
+	http3Servers []*http3.Server
 	certificates []CertMapping // Loaded TLS certificates
 
 	db               interface{} // Database connection (interface to avoid import cycle)
@@ -198,7 +306,27 @@ type Server struct {
 	certMonitor      interface{} // Certificate monitor (interface to avoid import cycle)
 	healthChecker    interface{} // Health checker (interface to avoid import cycle)
 	notifier         interface{} // Webhook notifier (optional)
+	events           *events.Bus // Live event stream (optional)
+	requestIDHeader  string      // Header carrying the request ID
+	http2            bool        // Offer h2 via ALPN on the TLS listener
+	http3            bool        // Start the QUIC listener
+	http3Addr        string      // UDP listen address, empty means the HTTPS address
+	altSvc           string      // Alt-Svc value advertising HTTP/3, empty when off
+	altSvcMaxAge     time.Duration
+	altSvcLocalPort  bool            // HTTP/3 runs on each HTTPS port; advertise the one a request came in on
+	proxyProtocol    *TrustedProxies // Peers whose PROXY protocol header is read, nil disables
+	timeouts         ServerTimeouts  // Client connection timeouts of the TCP listeners
+	quic             *quicLimiter    // Shared by the HTTP/3 servers
+	conns            *connLimiter    // Shared by the HTTP and HTTPS listeners
+	pause            pauseState      // Global 503 switch; options guarded by mu
 	debug            bool
+
+	limitsMu      sync.RWMutex
+	serviceLimits map[string]*serviceLimiter // Per-service limits, by service_limit_key
+
+	draining   atomic.Bool           // Set once Shutdown starts; new WebSockets are refused
+	wsMu       sync.Mutex            // Guards websockets
+	websockets map[net.Conn]struct{} // Hijacked client connections, not tracked by http.Server
 }
 
 // Config holds server configuration
@@ -215,14 +343,65 @@ type Config struct {
 	CertMonitor      interface{} // Certificate monitor
 	HealthChecker    interface{} // Health checker
 	Notifier         interface{} // Webhook notifier
+	Events           *events.Bus // Live event stream
+	RequestIDHeader  string      // Default X-Request-ID
+	DisableHTTP2     bool        // Serve HTTPS as HTTP/1.1 only
+	DisableHTTP3     bool        // Do not start the HTTP/3 (UDP) listener
+	HTTP3Addr        string      // UDP listen address for HTTP/3, default HTTPSAddr
+	DisableAltSvc    bool        // Do not advertise HTTP/3 with Alt-Svc
+	AltSvcMaxAge     time.Duration
+	CanonicalHost    string // apex or www redirects the other form, empty disables
+	// HTTPRedirectExempt lists path prefixes served on the HTTP listener
+	// instead of redirected to HTTPS, e.g. /.well-known/acme-challenge/
+	HTTPRedirectExempt []string
+	// ProxyProtocol lists the load balancers whose PROXY protocol header is
+	// read on the TCP listeners; nil disables it
+	ProxyProtocol *TrustedProxies
+	// HTTP3MaxConnections caps concurrent QUIC connections across the
+	// HTTP/3 listeners; 0 is unlimited
+	HTTP3MaxConnections int
+	// Timeouts bound slow clients on the HTTP and HTTPS listeners
+	Timeouts ServerTimeouts
+	// MaxConnections caps concurrent TCP connections across the HTTP and
+	// HTTPS listeners; 0 is unlimited
+	MaxConnections int
+	// PauseExemptPaths lists path prefixes still proxied while paused,
+	// e.g. a load balancer's health check
+	PauseExemptPaths []string
+	// PauseRetryAfter is the Retry-After sent while paused, default 60s
+	PauseRetryAfter time.Duration
+}
+
+// ServerTimeouts are the http.Server timeouts of the HTTP and HTTPS
+// listeners; zero disables one. WebSockets and streaming routes are exempt
+// from Read and Write once their request has been read.
+type ServerTimeouts struct {
+	ReadHeader time.Duration // Reading the request headers
+	Read       time.Duration // Reading the whole request, body included
+	Write      time.Duration // From the end of the request headers to the end of the response
+	Idle       time.Duration // Waiting for the next request on a keep-alive connection
+}
+
+// apply sets the timeouts on srv
+func (t ServerTimeouts) apply(srv *http.Server) {
+	srv.ReadHeaderTimeout = t.ReadHeader
+	srv.ReadTimeout = t.Read
+	srv.WriteTimeout = t.Write
+	srv.IdleTimeout = t.Idle
 }
 
 // NewServer creates a new proxy server
 func NewServer(cfg Config) *Server {
+	if cfg.RequestIDHeader == "" {
+		cfg.RequestIDHeader = tracing.DefaultRequestIDHeader
+	}
 	s := &Server{
 		routes:           make([]*Route, 0),
 		routeMap:         make(map[string]*Backend),
 		globalHeaders:    cfg.GlobalHeaders,
+		stripHeaders:     cfg.GlobalHeaders.stripList(),
+		canonicalHost:    cfg.CanonicalHost,
+		httpExempt:       cfg.HTTPRedirectExempt,
 		certificates:     cfg.Certificates,
 		db:               cfg.DB,
 		metricsCollector: cfg.MetricsCollector,
@@ -230,62 +409,161 @@ func NewServer(cfg Config) *Server {
 		certMonitor:      cfg.CertMonitor,
 		healthChecker:    cfg.HealthChecker,
 		notifier:         cfg.Notifier,
+		events:           cfg.Events,
+		requestIDHeader:  http.CanonicalHeaderKey(cfg.RequestIDHeader),
+		http2:            !cfg.DisableHTTP2,
+		http3:            !cfg.DisableHTTP3,
+		http3Addr:        cfg.HTTP3Addr,
+		proxyProtocol:    cfg.ProxyProtocol,
+		timeouts:         cfg.Timeouts,
+		quic:             newQUICLimiter(cfg.HTTP3MaxConnections, cfg.MetricsCollector),
+		conns:            newConnLimiter(cfg.MaxConnections, cfg.MetricsCollector),
 		debug:            cfg.Debug,
+		websockets:       make(map[net.Conn]struct{}),
+		serviceLimits:    make(map[string]*serviceLimiter),
+	}
+	s.pause.exempt = cfg.PauseExemptPaths
+	s.pause.retryAfter = cfg.PauseRetryAfter
+	if s.pause.retryAfter <= 0 {
+		s.pause.retryAfter = defaultPauseRetryAfter
+	}
+	if s.http3 && !cfg.DisableAltSvc {
+		addr := cfg.HTTP3Addr
+		if addr == "" {
+			addr = cfg.HTTPSAddr
+		}
+		s.altSvc = altSvcValue(listenPort(addr), cfg.AltSvcMaxAge)
+		s.altSvcMaxAge = cfg.AltSvcMaxAge
+		s.altSvcLocalPort = cfg.HTTP3Addr == ""
 	}
 
 	return s
 }
 
-// Start starts all HTTP servers (HTTP, HTTPS, HTTP/3)
-func (s *Server) Start(ctx context.Context, httpAddr, httpsAddr string) error {
-	// HTTP server (redirects to HTTPS)
-	s.httpServer = &http.Server{
+// Start starts all HTTP servers (HTTP, HTTPS, HTTP/3). Each HTTPS address
+// gets its own listener sharing the handler and TLS config; unless
+// HTTP3Addr is set each also gets an HTTP/3 listener on the same port.
+// Returns an error if an HTTPS address cannot be bound.
+func (s *Server) Start(ctx context.Context, httpAddr string, httpsAddrs ...string) error {
+	// Bind all HTTPS listeners first so a taken port fails the start
+	// instead of leaving a partial set running
+	listeners := make([]net.Listener, 0, len(httpsAddrs))
+	for _, addr := range httpsAddrs {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return fmt.Errorf("HTTPS listener %s: %w", addr, err)
+		}
+		listeners = append(listeners, ln)
+	}
+
+	// HTTP server (redirects to HTTPS apart from exempt paths and routes)
+	httpServer := &http.Server{
 		Addr:    httpAddr,
-		Handler: http.HandlerFunc(s.redirectToHTTPS),
+		Handler: http.HandlerFunc(s.serveHTTP),
 	}
+	s.timeouts.apply(httpServer)
 
-	// HTTPS server (HTTP/1.1 and HTTP/2)
-	s.httpsServer = &http.Server{
-		Addr:      httpsAddr,
-		Handler:   s,
-		TLSConfig: s.tlsConfig(),
+	// HTTPS servers (HTTP/1.1 and, unless disabled, HTTP/2)
+	httpsServers := make([]*http.Server, 0, len(listeners))
+	for _, ln := range listeners {
+		srv := &http.Server{
+			Addr:      ln.Addr().String(),
+			Handler:   s,
+			TLSConfig: s.tlsConfig(),
+		}
+		s.timeouts.apply(srv)
+		if !s.http2 {
+			// A non-nil empty map stops net/http from configuring h2
+			srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		}
+		httpsServers = append(httpsServers, srv)
 	}
 
-	// HTTP/3 server
-	s.http3Server = &http3.Server{
-		Addr:      httpsAddr,
-		Handler:   s,
-		TLSConfig: s.tlsConfig(),
+	// HTTP/3 servers, one on HTTP3Addr or one per HTTPS address
+	var http3Servers []*http3.Server
+	if s.http3 {
+		addrs := []string{s.http3Addr}
+		if s.http3Addr == "" {
+			addrs = addrs[:0]
+			for _, ln := range listeners {
+				addrs = append(addrs, ln.Addr().String())
+			}
+		}
+		for _, addr := range addrs {
+			http3Servers = append(http3Servers, &http3.Server{
+				Addr:       addr,
+				Port:       listenPort(addr), // Advertise the port we actually listen on
+				Handler:    s,
+				TLSConfig:  s.tlsConfig(),
+				QuicConfig: s.quic.config,
+			})
+		}
 	}
 
+	s.mu.Lock()
+	s.httpServer = httpServer
+	s.httpsServers = httpsServers
+	s.http3Servers = http3Servers
+	s.mu.Unlock()
+
 	// Start HTTP server
 	go func() {
 		log.Info().Str("addr", httpAddr).Msg("Starting HTTP server")
-		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		ln, err := net.Listen("tcp", httpAddr)
+		if err == nil {
+			err = httpServer.Serve(wrapProxyProtocol(s.conns.wrap(ln), s.proxyProtocol))
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Error().Err(err).Msg("HTTP server error")
 		}
 	}()
 
-	// Start HTTPS server
-	go func() {
-		log.Info().Str("addr", httpsAddr).Msg("Starting HTTPS server (HTTP/2 enabled)")
-		if err := s.httpsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
-			log.Error().Err(err).Msg("HTTPS server error")
-		}
-	}()
+	// Start HTTPS servers
+	for i, srv := range httpsServers {
+		go func(srv *http.Server, ln net.Listener) {
+			log.Info().Str("addr", srv.Addr).Bool("http2", s.http2).Msg("Starting HTTPS server")
+			if err := srv.ServeTLS(wrapProxyProtocol(s.conns.wrap(ln), s.proxyProtocol), "", ""); err != nil && err != http.ErrServerClosed {
+				log.Error().Err(err).Str("addr", srv.Addr).Msg("HTTPS server error")
+			}
+		}(srv, listeners[i])
+	}
 
-	// Start HTTP/3 server
-	go func() {
-		log.Info().Str("addr", httpsAddr).Msg("Starting HTTP/3 server")
-		if err := s.http3Server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
-			log.Error().Err(err).Msg("HTTP/3 server error")
-		}
-	}()
+	// Start HTTP/3 servers
+	for _, srv := range http3Servers {
+		go func(srv *http3.Server) {
+			log.Info().Str("addr", srv.Addr).Msg("Starting HTTP/3 server")
+			// ListenAndServeTLS would load a fixed key pair from files;
+			// ListenAndServe uses TLSConfig and so getCertificate
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error().Err(err).Str("addr", srv.Addr).Msg("HTTP/3 server error")
+			}
+		}(srv)
+	}
+	if !s.http3 {
+		log.Info().Msg("HTTP/3 disabled")
+	}
+
+	go s.runLoadSampler(ctx)
 
 	<-ctx.Done()
 	return s.Shutdown(context.Background())
 }
 
+// HTTPSAddrs returns the addresses the HTTPS listeners are bound to, empty
+// before Start
+func (s *Server) HTTPSAddrs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	addrs := make([]string, 0, len(s.httpsServers))
+	for _, srv := range s.httpsServers {
+		addrs = append(addrs, srv.Addr)
+	}
+	return addrs
+}
+
 // ServeHTTP implements http.Handler
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Record request metrics
@@ -298,11 +576,27 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Wrap response writer to capture status code
 	rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
-	// Get client IP
-	clientIP := r.RemoteAddr
-	if idx := strings.LastIndex(clientIP, ":"); idx > 0 {
-		clientIP = clientIP[:idx]
+	// Let clients discover the HTTP/3 listener
+	if altSvc := s.altSvcFor(r); altSvc != "" {
+		rw.Header().Set("Alt-Svc", altSvc)
+	}
+
+	// Get client IP, honoring forwarding headers only from trusted proxies
+	clientIP := ClientIP(r)
+
+	// Reuse a valid inbound request ID or start a new one, then pass it to
+	// the backend, the client and the access log
+	requestID := r.Header.Get(s.requestIDHeader)
+	if !tracing.ValidRequestID(requestID) {
+		requestID = tracing.GenerateRequestID()
 	}
+	r.Header.Set(s.requestIDHeader, requestID)
+	r = r.WithContext(tracing.SetRequestID(r.Context(), requestID))
+	rw.Header().Set(s.requestIDHeader, requestID)
+
+	var routeKey string                 // host+route path once a route matches
+	var routeLabels map[string]string   // Labels of the matched route
+	var upstream metrics.UpstreamTiming // Set once the request was proxied
 
 	defer func() {
 		duration := time.Since(startTime)
@@ -313,31 +607,48 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			host = host[:idx]
 		}
 
-		// Record metrics
+		// Record metrics under the matched route, never the raw path, so
+		// clients cannot grow the route stats without bound
 		if mc, ok := s.metricsCollector.(*metrics.Collector); ok {
-			route := host + r.URL.Path
-			mc.RecordRequest(route, r.Method, rw.statusCode, duration, 0, 0)
-		}
-
-		// Log to database
-		if s.db != nil {
-			if db, ok := s.db.(*database.DB); ok {
-				entry := database.AccessLogEntry{
-					Timestamp:      time.Now().UnixMilli(),
-					Domain:         host,
-					Method:         r.Method,
-					Path:           r.URL.Path,
-					Query:          r.URL.RawQuery,
-					Status:         rw.statusCode,
-					ResponseTimeMs: duration.Milliseconds(),
-					ClientIP:       clientIP,
-					UserAgent:      r.UserAgent(),
-					Referer:        r.Referer(),
-					Protocol:       r.Proto,
-				}
-				if err := db.LogAccessRequest(entry); err != nil {
-					log.Error().Err(err).Msg("Failed to log access request")
-				}
+			route := metrics.OtherRoute
+			if routeKey != "" {
+				route = routeKey
+			}
+			mc.RecordRequest(route, r.Method, rw.statusCode, duration, rw.written, 0)
+			if routeKey != "" {
+				mc.RecordRouteRequest(routeKey, rw.statusCode, duration)
+			}
+			mc.RecordLabeledRequest(routeLabels, rw.statusCode)
+		}
+
+		entry := database.AccessLogEntry{
+			Timestamp:      time.Now().UnixMilli(),
+			Domain:         host,
+			Method:         r.Method,
+			Path:           r.URL.Path,
+			Query:          r.URL.RawQuery,
+			Status:         rw.statusCode,
+			ResponseTimeMs: duration.Milliseconds(),
+			ClientIP:       clientIP,
+			UserAgent:      r.UserAgent(),
+			Referer:        r.Referer(),
+			BytesSent:      rw.written,
+			Protocol:       r.Proto,
+			RequestID:      requestID,
+		}
+		if upstream.TTFB > 0 {
+			entry.UpstreamConnectMs = float64(upstream.Connect.Microseconds()) / 1000
+			entry.UpstreamTLSMs = float64(upstream.TLS.Microseconds()) / 1000
+			entry.UpstreamTTFBMs = float64(upstream.TTFB.Microseconds()) / 1000
+		}
+
+		// Hand off to the access logger, which batches database writes in the
+		// background. Fall back to a direct insert when none is configured.
+		if al, ok := s.accessLogger.(interface{ LogRequest(database.AccessLogEntry) }); ok {
+			al.LogRequest(entry)
+		} else if db, ok := s.db.(*database.DB); ok {
+			if err := db.LogAccessRequest(entry); err != nil {
+				log.Error().Err(err).Msg("Failed to log access request")
 			}
 		}
 	}()
@@ -348,7 +659,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if idx := strings.LastIndex(host, ":"); idx > 0 {
 		host = host[:idx]
 	}
-	backend := s.findBackend(host, r.URL.Path)
+	backend := s.findBackendFor(r, host, r.URL.Path)
 
 	if backend == nil {
 		// No route found - check if we have a certificate for this domain
@@ -362,6 +673,49 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// While paused every route answers 503 but stays configured
+	if s.servePaused(rw, r) {
+		return
+	}
+
+	// Get route for headers and the per-route in-flight gauge
+	route := s.findRouteFor(r, host, r.URL.Path)
+	routeKey = host
+	if route != nil {
+		routeKey = host + route.Path
+		routeLabels = route.Labels
+	}
+	if mc, ok := s.metricsCollector.(*metrics.Collector); ok {
+		mc.IncrementRouteInFlight(routeKey)
+		defer mc.DecrementRouteInFlight(routeKey)
+	}
+
+	// A disabled route, e.g. of a registry service within its reconnect
+	// grace period, answers itself instead of reaching its backend or
+	// falling through to a shorter route
+	if disabled := s.disabledRouteFor(r, host, r.URL.Path); disabled != nil {
+		s.serveDisabled(rw, r, disabled.Backend, host)
+		return
+	}
+
+	// Send www/apex variants to the canonical host
+	if route != nil {
+		if target := s.canonicalHostFor(route, host, r.URL.Path, r.TLS != nil); target != "" {
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+			http.Redirect(rw, r, scheme+"://"+withPort(target, r.Host)+r.URL.RequestURI(), http.StatusMovedPermanently)
+			return
+		}
+	}
+
+	// Redirect routes answer directly without an upstream
+	if route != nil && route.Redirect != nil {
+		s.serveRedirect(rw, r, route)
+		return
+	}
+
 	// Check maintenance mode
 	backend.mu.Lock()
 	if backend.InMaintenance {
@@ -370,7 +724,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		backend.mu.Unlock()
 
 		rw.Header().Set("X-Maintenance-Mode", "true")
-		rw.Header().Set("Retry-After", "300")
+		setRetryAfter(rw.Header(), backend.maintenanceRetry)
 
 		// Method 1: If custom maintenance page URL is provided, proxy to it
 		if maintenanceURL != "" {
@@ -378,14 +732,10 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			if err == nil {
 				// Create a temporary backend for maintenance page
 				maintProxy := httputil.NewSingleHostReverseProxy(maintURL)
+				maintProxy.ModifyResponse = backend.maintenanceStatusOverride
 				maintProxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
 					log.Error().Err(err).Str("url", maintenanceURL).Msg("Maintenance page proxy error - falling back to static page")
-					// Fallback to static maintenance page on proxy error
-					pageData := staticpages.PageData{}
-					status, html := staticpages.GetPage(staticpages.PageMaintenanceFallback, pageData)
-					w.WriteHeader(status)
-					w.Header().Set("Content-Type", "text/html; charset=utf-8")
-					_, _ = io.WriteString(w, html)
+					s.serveMaintenancePage(w, r, backend, host)
 				}
 				// Proxy the request to the maintenance page
 				log.Debug().Str("url", maintenanceURL).Str("path", r.URL.Path).Msg("Proxying to maintenance page")
@@ -396,40 +746,21 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		// Method 2: Default static maintenance page (no URL provided or parse error)
-		// Method 2: Default static maintenance page (no URL provided or parse error)
-		pageData := staticpages.PageData{}
-		status, html := staticpages.GetPage(staticpages.PageMaintenanceFallback, pageData)
-		rw.WriteHeader(status)
-		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
-		_, _ = io.WriteString(rw, html)
+		// Method 2: The route's template or the built-in page (no URL provided or parse error)
+		s.serveMaintenancePage(rw, r, backend, host)
 		return
 	}
 
 	// Check drain mode - reject some requests
 	if backend.Draining && backend.DrainDuration > 0 {
 		elapsed := time.Since(backend.DrainStart)
-		if elapsed < backend.DrainDuration {
-			// Calculate reject probability based on progress
-			progress := float64(elapsed) / float64(backend.DrainDuration)
-			// After 50% of drain time, start rejecting requests
-			if progress > 0.5 && (progress*100) > float64(time.Now().UnixNano()%100) {
-				atomic.AddInt64(&backend.DrainRejected, 1)
-				backend.mu.Unlock()
-				rw.WriteHeader(http.StatusServiceUnavailable)
-				rw.Header().Set("Retry-After", "60")
-				rw.Header().Set("X-Drain-Mode", "true")
-				_, _ = io.WriteString(rw, "Service draining")
-				return
-			}
-		} else {
-			// Drain period expired, reject all new requests
+		// After 50% of drain time, start rejecting requests with rising
+		// probability; once the period expires reject all new requests
+		progress := float64(elapsed) / float64(backend.DrainDuration)
+		if elapsed >= backend.DrainDuration || (progress > 0.5 && (progress*100) > float64(time.Now().UnixNano()%100)) {
 			atomic.AddInt64(&backend.DrainRejected, 1)
 			backend.mu.Unlock()
-			rw.WriteHeader(http.StatusServiceUnavailable)
-			rw.Header().Set("Retry-After", "60")
-			rw.Header().Set("X-Drain-Mode", "true")
-			_, _ = io.WriteString(rw, "Service draining")
+			backend.rejectDraining(rw, r)
 			return
 		}
 	}
@@ -437,11 +768,15 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Check if backend is healthy or circuit open
 	healthy := backend.Healthy
 	cbOpen := false
-	if backend.cbEnabled {
+	switch {
+	case backend.cbForced == CircuitForceOpen:
+		cbOpen = true
+	case backend.cbForced == CircuitForceClose:
+	case backend.cbEnabled:
 		switch backend.cbState {
 		case "open":
 			if backend.cbTimeout > 0 && time.Since(backend.cbOpenedAt) >= backend.cbTimeout {
-				backend.cbState = "half-open"
+				backend.cbSetState("half-open")
 				backend.cbSuccesses = 0
 			} else {
 				cbOpen = true
@@ -455,8 +790,19 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get route for headers
-	route := s.findRoute(host, r.URL.Path)
+	// Cap the load on the backend from all clients together
+	if !backend.admitRate(rw) {
+		return
+	}
+
+	// Enforce the owning service's connection and bandwidth limits
+	if limiter := s.serviceLimiter(backend.limitKey); limiter != nil {
+		if !limiter.admit(rw) {
+			return
+		}
+		defer limiter.release()
+		rw.limit = limiter
+	}
 
 	// Handle WebSocket upgrade separately
 	if isWebSocketRequest(r) {
@@ -468,95 +814,388 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Copy the request to the route's mirror before the body is consumed
+	if backend.mirror != nil {
+		backend.mirror.send(r)
+	}
+
 	// Apply security headers
 	s.applyHeaders(rw, route)
 
-	// Proxy request with slow-request tracking
+	// The route's deadline covers the response body too, which
+	// ResponseHeaderTimeout does not; cancelling it aborts the upstream call
+	ctx := r.Context()
+	if backend.requestTimeout > 0 && !backend.streaming {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, backend.requestTimeout)
+		defer cancel()
+	}
+	if backend.streaming && s.timeouts.Write > 0 {
+		// Long-lived responses would be cut at the listener's write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	}
+
+	// Proxy request with slow-request tracking and the upstream breakdown
+	ctx, timer := withUpstreamTimer(ctx)
 	start := time.Now()
-	backend.Proxy.ServeHTTP(rw, r)
+	backend.Proxy.ServeHTTP(rw, r.WithContext(ctx))
 	elapsed := time.Since(start)
+	upstream = timer.finish(elapsed)
+	if mc, ok := s.metricsCollector.(*metrics.Collector); ok {
+		mc.RecordUpstreamTiming(upstream)
+		mc.ObserveRequestDuration(metrics.SlowSample{
+			Host:       host,
+			Path:       r.URL.Path,
+			Method:     r.Method,
+			Status:     rw.statusCode,
+			DurationMs: float64(elapsed.Microseconds()) / 1000,
+			RequestID:  requestID,
+		})
+	}
 	if backend.slowEnabled {
-		if backend.slowCritical > 0 && elapsed >= backend.slowCritical {
-			log.Error().Dur("duration", elapsed).Str("host", r.Host).Str("path", r.URL.Path).Msg("Critical slow request")
+		// Thresholds come from the requests before this one
+		warning, critical, adaptive := backend.slowThresholds()
+		if backend.latency != nil {
+			backend.latency.observe(elapsed)
+		}
+		if critical > 0 && elapsed >= critical {
+			log.Error().Dur("duration", elapsed).Dur("threshold", critical).Bool("adaptive", adaptive).Dur("connect", upstream.Connect).Dur("tls", upstream.TLS).Dur("ttfb", upstream.TTFB).Str("host", r.Host).Str("path", r.URL.Path).Str("request_id", requestID).Msg("Critical slow request")
 			s.recordSlowMetric("critical")
 			if backend.alertWebhook {
-				s.sendSlowAlert(route, r, elapsed, "critical")
+				s.sendSlowAlert(route, r, elapsed, "critical", critical, adaptive)
 			}
-		} else if backend.slowWarning > 0 && elapsed >= backend.slowWarning {
-			log.Warn().Dur("duration", elapsed).Str("host", r.Host).Str("path", r.URL.Path).Msg("Slow request warning")
+		} else if warning > 0 && elapsed >= warning {
+			log.Warn().Dur("duration", elapsed).Dur("threshold", warning).Bool("adaptive", adaptive).Dur("connect", upstream.Connect).Dur("tls", upstream.TLS).Dur("ttfb", upstream.TTFB).Str("host", r.Host).Str("path", r.URL.Path).Str("request_id", requestID).Msg("Slow request warning")
 			s.recordSlowMetric("warning")
 			if backend.alertWebhook {
-				s.sendSlowAlert(route, r, elapsed, "warning")
+				s.sendSlowAlert(route, r, elapsed, "warning", warning, adaptive)
 			}
 		}
 	}
 }
 
-// AddRoute adds or updates a route
+// AddRoute adds a dynamic (registry) route
 func (s *Server) AddRoute(domains []string, path, backendURL string, headers map[string]string, websocket bool, options map[string]interface{}) error {
+	return s.addRoute(SourceRegistry, domains, path, backendURL, headers, websocket, options)
+}
+
+// RemoveRoute removes registry routes for given domains and path. A static
+// route for the same domain+path takes over again if one is configured.
+func (s *Server) RemoveRoute(domains []string, path string) {
+	s.removeRoute(SourceRegistry, domains, path)
+}
+
+// RemoveRouteMatch removes only the registry route for domains+path with
+// exactly the given predicates; a zero match removes the plain route
+func (s *Server) RemoveRouteMatch(domains []string, path string, match RouteMatch) {
+	s.removeRouteMatch(SourceRegistry, domains, path, match)
+}
+
+// StaticRoutes manages routes loaded from site YAML files. It has the same
+// AddRoute/RemoveRoute signatures as Server so the site watcher can use it.
+type StaticRoutes struct {
+	s *Server
+}
+
+// Static returns the view used to register static site routes
+func (s *Server) Static() *StaticRoutes {
+	return &StaticRoutes{s: s}
+}
+
+// AddRoute adds a static route
+func (v *StaticRoutes) AddRoute(domains []string, path, backendURL string, headers map[string]string, websocket bool, options map[string]interface{}) error {
+	return v.s.addRoute(SourceStatic, domains, path, backendURL, headers, websocket, options)
+}
+
+// RemoveRoute removes static routes for given domains and path
+func (v *StaticRoutes) RemoveRoute(domains []string, path string) {
+	v.s.removeRoute(SourceStatic, domains, path)
+}
+
+// RemoveRouteMatch removes the static route for domains+path with exactly
+// the given predicates
+func (v *StaticRoutes) RemoveRouteMatch(domains []string, path string, match RouteMatch) {
+	v.s.removeRouteMatch(SourceStatic, domains, path, match)
+}
+
+// ReplaceRoute atomically swaps the registry route for domains+path, so
+// requests never see the route missing while its backend changes
+func (s *Server) ReplaceRoute(domains []string, path, backendURL string, headers map[string]string, websocket bool, options map[string]interface{}) error {
+	return s.replaceRoute(SourceRegistry, domains, path, backendURL, headers, websocket, options)
+}
+
+// ReplaceRoute atomically swaps the static route for domains+path
+func (v *StaticRoutes) ReplaceRoute(domains []string, path, backendURL string, headers map[string]string, websocket bool, options map[string]interface{}) error {
+	return v.s.replaceRoute(SourceStatic, domains, path, backendURL, headers, websocket, options)
+}
+
+func (s *Server) addRoute(source RouteSource, domains []string, path, backendURL string, headers map[string]string, websocket bool, options map[string]interface{}) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Parse backend URL
-	target, err := url.Parse(backendURL)
+	route, err := s.newRoute(source, domains, path, backendURL, headers, websocket, options, nil)
 	if err != nil {
-		return fmt.Errorf("invalid backend URL: %w", err)
+		return err
 	}
 
-	// Create or find backend
-	backend := s.getOrCreateBackend(target, options)
+	// Add route and resolve conflicts with the other source
+	s.routes = append(s.routes, route)
+	s.applyPrecedence()
 
-	// Create route
-	route := &Route{
-		Domains:   domains,
-		Path:      path,
-		Backend:   backend,
-		Headers:   headers,
-		WebSocket: websocket,
-		Enabled:   true,      // Routes are enabled by default
-		Priority:  len(path), // Longer paths = higher priority
+	if s.debug {
+		log.Debug().Strs("domains", domains).Str("path", path).Str("backend", backendURL).Str("source", string(source)).Msg("Added route")
 	}
 
-	// Add route
-	s.routes = append(s.routes, route)
-	s.sortRoutes()
+	return nil
+}
+
+func (s *Server) replaceRoute(source RouteSource, domains []string, path, backendURL string, headers map[string]string, websocket bool, options map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// Update route map for all domains
-	for _, domain := range domains {
-		key := s.routeKey(domain, path)
-		s.routeMap[key] = backend
+	replaced := func(r *Route) bool { return r.Source == source && s.routeMatches(r, domains, path) }
+	route, err := s.newRoute(source, domains, path, backendURL, headers, websocket, options, replaced)
+	if err != nil {
+		return err
 	}
 
+	s.carryBackendState(source, route)
+	s.dropRoutes(source, func(r *Route) bool { return s.sameRoute(r, route) })
+	s.routes = append(s.routes, route)
+	s.applyPrecedence()
+
 	if s.debug {
-		log.Debug().Strs("domains", domains).Str("path", path).Str("backend", backendURL).Msg("Added route")
+		log.Debug().Strs("domains", domains).Str("path", path).Str("backend", backendURL).Str("source", string(source)).Msg("Replaced route")
 	}
 
 	return nil
 }
 
-// RemoveRoute removes routes for given domains and path
-func (s *Server) RemoveRoute(domains []string, path string) {
+func (s *Server) removeRoute(source RouteSource, domains []string, path string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Remove from route map
-	for _, domain := range domains {
-		key := s.routeKey(domain, path)
-		delete(s.routeMap, key)
+	s.dropRoutes(source, func(r *Route) bool { return s.routeMatches(r, domains, path) })
+	s.applyPrecedence()
+
+	if s.debug {
+		log.Debug().Strs("domains", domains).Str("path", path).Str("source", string(source)).Msg("Removed route")
 	}
+}
+
+func (s *Server) removeRouteMatch(source RouteSource, domains []string, path string, match RouteMatch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// Remove from routes slice
-	filtered := make([]*Route, 0, len(s.routes))
+	key := match.Key()
+	s.dropRoutes(source, func(r *Route) bool { return s.routeMatches(r, domains, path) && r.Match.Key() == key })
+	s.applyPrecedence()
+
+	if s.debug {
+		log.Debug().Strs("domains", domains).Str("path", path).Str("source", string(source)).Msg("Removed route")
+	}
+}
+
+// newRoute builds a route, reusing an existing backend for the same URL.
+// replaced, when set, selects the routes the new one replaces; their backend
+// is only reused if it was built from the same options. Caller must hold s.mu.
+func (s *Server) newRoute(source RouteSource, domains []string, path, backendURL string, headers map[string]string, websocket bool, options map[string]interface{}, replaced func(*Route) bool) (*Route, error) {
+	// Parse backend URL
+	target, err := url.Parse(backendURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backend URL: %w", err)
+	}
+
+	match, err := routeMatchOption(options)
+	if err != nil {
+		return nil, err
+	}
+
+	redirect, err := redirectOption(backendURL, options)
+	if err != nil {
+		return nil, err
+	}
+	canonicalHost, _ := options["canonical_host"].(string)
+	if err := ValidCanonicalHost(canonicalHost); err != nil {
+		return nil, err
+	}
+	if redirect != nil {
+		// Placeholder backend for status and maintenance, never dialed
+		target = redirect.backendURL()
+	}
+	if target.Scheme == UnixScheme {
+		if err := checkUnixSocket(target.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create or find backend
+	backend := s.getOrCreateBackend(target, options, replaced)
+
+	return &Route{
+		Domains:       domains,
+		Path:          path,
+		Backend:       backend,
+		Headers:       headers,
+		WebSocket:     websocket,
+		Enabled:       true,      // Routes are enabled by default
+		Priority:      len(path), // Longer paths = higher priority
+		Source:        source,
+		AllowOverride: source == SourceStatic && allowDynamicOverride(options),
+		Match:         match,
+		Redirect:      redirect,
+		CanonicalHost: canonicalHost,
+		AllowHTTP:     options["https_redirect"] == false,
+		Labels:        labelsOption(options),
+	}, nil
+}
+
+// sameOptions reports whether two backends built from a and b would be
+// configured the same
+func sameOptions(a, b map[string]interface{}) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// copyOptions copies options and the option maps nested in it, so later
+// changes to the caller's map do not look like the backend's own options
+func copyOptions(options map[string]interface{}) map[string]interface{} {
+	if options == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(options))
+	for k, v := range options {
+		if m, ok := v.(map[string]interface{}); ok {
+			v = copyOptions(m)
+		}
+		copied[k] = v
+	}
+	return copied
+}
+
+// carryBackendState moves maintenance and drain state to route's backend
+// when route replaces a route of source whose backend had to be rebuilt.
+// Caller must hold s.mu.
+func (s *Server) carryBackendState(source RouteSource, route *Route) {
+	for _, old := range append(append([]*Route(nil), s.routes...), s.shadowed...) {
+		if old.Source != source || old.Backend == route.Backend || !s.sameRoute(old, route) {
+			continue
+		}
+		old.Backend.mu.RLock()
+		route.Backend.mu.Lock()
+		route.Backend.InMaintenance = old.Backend.InMaintenance
+		route.Backend.MaintenancePageURL = old.Backend.MaintenancePageURL
+		route.Backend.MaintenanceReason = old.Backend.MaintenanceReason
+		route.Backend.MaintenanceETA = old.Backend.MaintenanceETA
+		route.Backend.Draining = old.Backend.Draining
+		route.Backend.DrainStart = old.Backend.DrainStart
+		route.Backend.DrainDuration = old.Backend.DrainDuration
+		route.Backend.mu.Unlock()
+		old.Backend.mu.RUnlock()
+		return
+	}
+}
+
+// labelsOption copies the route labels from options, nil without any
+func labelsOption(options map[string]interface{}) map[string]string {
+	labels, _ := options["labels"].(map[string]string)
+	if len(labels) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	return copied
+}
+
+// dropRoutes removes the source's routes selected by drop from both the
+// active and shadowed lists. Caller must hold s.mu and call applyPrecedence.
+func (s *Server) dropRoutes(source RouteSource, drop func(*Route) bool) {
+	keep := func(routes []*Route) []*Route {
+		filtered := make([]*Route, 0, len(routes))
+		for _, r := range routes {
+			if r.Source != source || !drop(r) {
+				filtered = append(filtered, r)
+			}
+		}
+		return filtered
+	}
+	s.routes = keep(s.routes)
+	s.shadowed = keep(s.shadowed)
+}
+
+// applyPrecedence splits registered routes into active and shadowed ones and
+// rebuilds the route map. A registry route hides a static route for the same
+// domain+path, unless the static site set allow_dynamic_override: false, in
+// which case the static route hides the registry route.
+func (s *Server) applyPrecedence() {
+	wasShadowed := make(map[*Route]bool, len(s.shadowed))
+	for _, r := range s.shadowed {
+		wasShadowed[r] = true
+	}
+
+	all := append(append(make([]*Route, 0, len(s.routes)+len(s.shadowed)), s.routes...), s.shadowed...)
+	active := make([]*Route, 0, len(all))
+	var shadowed []*Route
+	for _, r := range all {
+		by := s.shadowedBy(r, all)
+		if by == nil {
+			if wasShadowed[r] {
+				log.Info().Strs("domains", r.Domains).Str("path", r.Path).Str("source", string(r.Source)).Msg("Route restored")
+			}
+			active = append(active, r)
+			continue
+		}
+		if !wasShadowed[r] {
+			log.Info().Strs("domains", r.Domains).Str("path", r.Path).Str("source", string(r.Source)).
+				Str("shadowed_by", string(by.Source)).Msg("Route shadowed by higher precedence route")
+		}
+		shadowed = append(shadowed, r)
+	}
+
+	s.routes = active
+	s.shadowed = shadowed
+	s.sortRoutes()
+
+	s.routeMap = make(map[string]*Backend, len(s.routes))
+	s.matchRoutes = 0
 	for _, r := range s.routes {
-		if !s.routeMatches(r, domains, path) {
-			filtered = append(filtered, r)
+		if !r.Match.IsZero() {
+			s.matchRoutes++
+			continue
+		}
+		for _, domain := range r.Domains {
+			s.routeMap[s.routeKey(domain, r.Path)] = r.Backend
 		}
 	}
-	s.routes = filtered
+}
 
-	if s.debug {
-		log.Debug().Strs("domains", domains).Str("path", path).Msg("Removed route")
+// shadowedBy returns the route from the other source that takes precedence
+// over r, or nil if r should be active
+func (s *Server) shadowedBy(r *Route, all []*Route) *Route {
+	for _, other := range all {
+		if other.Source == r.Source || !s.sameRoute(other, r) {
+			continue
+		}
+		if r.Source == SourceStatic && r.AllowOverride {
+			return other
+		}
+		if r.Source == SourceRegistry && !other.AllowOverride {
+			return other
+		}
 	}
+	return nil
+}
+
+// allowDynamicOverride reads the allow_dynamic_override option (default true)
+func allowDynamicOverride(options map[string]interface{}) bool {
+	if v, ok := options["allow_dynamic_override"].(bool); ok {
+		return v
+	}
+	return true
 }
 
 // SetRouteEnabled enables or disables routes without removing them
@@ -602,8 +1241,12 @@ func (s *Server) RouteSummaries() []RouteSummary {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	summaries := make([]RouteSummary, 0, len(s.routes))
+	summaries := make([]RouteSummary, 0, len(s.routes)+len(s.shadowed))
 	now := time.Now()
+	shadowed := make(map[*Route]bool, len(s.shadowed))
+	for _, r := range s.shadowed {
+		shadowed[r] = true
+	}
 
 	// Snapshot metrics once to reuse
 	var routeStats map[string]metrics.RouteStats
@@ -612,7 +1255,7 @@ func (s *Server) RouteSummaries() []RouteSummary {
 		routeStats = stats.RouteMetrics
 	}
 
-	for _, route := range s.routes {
+	for _, route := range append(append([]*Route(nil), s.routes...), s.shadowed...) {
 		backend := route.Backend
 		backend.mu.RLock()
 
@@ -658,7 +1301,11 @@ func (s *Server) RouteSummaries() []RouteSummary {
 		summaries = append(summaries, RouteSummary{
 			Domains:            append([]string(nil), route.Domains...),
 			Path:               route.Path,
+			Match:              route.Match,
+			Labels:             route.Labels,
 			BackendURL:         backend.URL.String(),
+			Source:             route.Source,
+			Shadowed:           shadowed[route],
 			Enabled:            route.Enabled,
 			Healthy:            backend.Healthy,
 			InMaintenance:      backend.InMaintenance,
@@ -682,7 +1329,23 @@ func (s *Server) RouteSummaries() []RouteSummary {
 	return summaries
 }
 
-// UpdateCertificates hot-reloads certificates without restarting the server
+// RouteCount returns the number of active routes
+func (s *Server) RouteCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.routes)
+}
+
+// CertificateCount returns the number of loaded TLS certificates
+func (s *Server) CertificateCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.certificates)
+}
+
+// UpdateCertificates hot-reloads certificates without restarting the server.
+// New handshakes on every listener, HTTP/3 included, use them; established
+// connections keep the certificate they negotiated.
 func (s *Server) UpdateCertificates(certificates []CertMapping) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -691,55 +1354,99 @@ func (s *Server) UpdateCertificates(certificates []CertMapping) {
 	log.Info().Int("count", len(certificates)).Msg("Certificates updated")
 }
 
-// findBackend finds the best matching backend for a request
-func (s *Server) findBackend(host, path string) *Backend {
+// SetGlobalHeaders replaces the security headers applied to every response
+func (s *Server) SetGlobalHeaders(headers SecurityHeaders) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.globalHeaders = headers
+	s.stripHeaders = headers.stripList()
+	log.Info().Msg("Global security headers updated")
+}
+
+// responseStripList returns the global response headers to strip
+func (s *Server) responseStripList() []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.stripHeaders
+}
 
-	// Try exact match first
-	key := s.routeKey(host, path)
-	if backend, ok := s.routeMap[key]; ok {
-		return backend
-	}
+// findBackend finds the best matching backend for host and path, ignoring
+// routes with request predicates
+func (s *Server) findBackend(host, path string) *Backend {
+	return s.findBackendFor(nil, host, path)
+}
 
-	// Try longest prefix match
-	var bestMatch *Backend
-	longestMatch := 0
+// findBackendFor finds the best matching backend for a request, including
+// routes whose predicates r satisfies
+func (s *Server) findBackendFor(r *http.Request, host, path string) *Backend {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	for _, route := range s.routes {
-		for _, domain := range route.Domains {
-			if domain == host && len(route.Path) <= len(path) {
-				if path[:len(route.Path)] == route.Path {
-					if len(route.Path) > longestMatch {
-						longestMatch = len(route.Path)
-						bestMatch = route.Backend
-					}
-				}
-			}
+	// Try exact match first; predicates can only win when routes have them
+	if r == nil || s.matchRoutes == 0 {
+		key := s.routeKey(host, path)
+		if backend, ok := s.routeMap[key]; ok {
+			return backend
 		}
 	}
 
-	return bestMatch
+	if route := s.bestRoute(r, host, path, false); route != nil {
+		return route.Backend
+	}
+	return nil
 }
 
 // findRoute finds the route for header application
 func (s *Server) findRoute(host, path string) *Route {
+	return s.findRouteFor(nil, host, path)
+}
+
+// disabledRouteFor returns the route that would serve the request if it is
+// disabled, nil otherwise
+func (s *Server) disabledRouteFor(r *http.Request, host, path string) *Route {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if route := s.bestRoute(r, host, path, false); route != nil && !route.Enabled {
+		return route
+	}
+	return nil
+}
+
+// findRouteFor finds the enabled route for a request
+func (s *Server) findRouteFor(r *http.Request, host, path string) *Route {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.bestRoute(r, host, path, true)
+}
 
+// bestRoute returns the route with the longest path prefix and, among those,
+// the most specific predicates matching r (see RouteMatch). Routes with
+// predicates are skipped when r is nil. Caller must hold s.mu.
+func (s *Server) bestRoute(r *http.Request, host, path string, enabledOnly bool) *Route {
 	var bestMatch *Route
 	longestMatch := 0
 
 	for _, route := range s.routes {
+		if enabledOnly && !route.Enabled {
+			continue
+		}
+		if len(route.Path) > len(path) || path[:len(route.Path)] != route.Path {
+			continue
+		}
+		if !route.Match.IsZero() && (r == nil || !route.Match.matches(r)) {
+			continue
+		}
 		for _, domain := range route.Domains {
-			if route.Enabled && domain == host && len(route.Path) <= len(path) {
-				if path[:len(route.Path)] == route.Path {
-					if len(route.Path) > longestMatch {
-						longestMatch = len(route.Path)
-						bestMatch = route
-					}
-				}
+			if domain != host {
+				continue
+			}
+			if bestMatch == nil || len(route.Path) > longestMatch ||
+				(len(route.Path) == longestMatch && route.Match.moreSpecific(bestMatch.Match)) {
+				longestMatch = len(route.Path)
+				bestMatch = route
 			}
+			break
 		}
 	}
 
@@ -747,81 +1454,54 @@ func (s *Server) findRoute(host, path string) *Route {
 }
 
 // getOrCreateBackend gets or creates a backend
-func (s *Server) getOrCreateBackend(target *url.URL, options map[string]interface{}) *Backend {
+func (s *Server) getOrCreateBackend(target *url.URL, options map[string]interface{}, replaced func(*Route) bool) *Backend {
+	routes := append(append([]*Route(nil), s.routes...), s.shadowed...)
+
+	// Options are applied once, when the backend is created, so a replaced
+	// route whose options changed must not get its old backend back
+	stale := make(map[*Backend]bool)
+	if replaced != nil {
+		for _, route := range routes {
+			if replaced(route) && !sameOptions(route.Backend.options, options) {
+				stale[route.Backend] = true
+			}
+		}
+	}
+
 	// Check if backend already exists
-	for _, route := range s.routes {
-		if route.Backend.URL.String() == target.String() {
+	for _, route := range routes {
+		if route.Backend.URL.String() == target.String() && !stale[route.Backend] {
 			return route.Backend
 		}
 	}
 
-	// Create new backend
-	proxy := httputil.NewSingleHostReverseProxy(target)
-
 	// Customize transport
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
 	transport := &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout:   5 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+		DialContext:           dialer.DialContext,
 		MaxIdleConns:          100,
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 	}
 
+	// Create new backend; a Unix socket backend is addressed as
+	// http://localhost and the transport dials the socket instead
+	proxyTarget := target
+	if socket := unixSocketPath(target); socket != "" {
+		proxyTarget = &url.URL{Scheme: "http", Host: unixSocketHost}
+		transport.DialContext = unixDialContext(dialer, socket)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(proxyTarget)
 	proxy.Transport = transport
+	// roundTripper is transport with connection recycling, what retries wrap
+	var roundTripper http.RoundTripper = transport
 
 	// Customize director
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		// Save original host before director changes it
-		originalHost := req.Host
-
-		// Extract real client IP (handling Cloudflare proxy)
-		realClientIP := ""
-		// 1. Try CF-Connecting-IP (Cloudflare's real client IP header)
-		if cfIP := req.Header.Get("CF-Connecting-IP"); cfIP != "" {
-			realClientIP = cfIP
-		}
-		// 2. Try first IP in X-Forwarded-For (standard proxy chain)
-		if realClientIP == "" {
-			if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
-				if idx := strings.Index(xff, ","); idx > 0 {
-					realClientIP = strings.TrimSpace(xff[:idx])
-				} else {
-					realClientIP = strings.TrimSpace(xff)
-				}
-			}
-		}
-		// 3. Fallback to immediate connection IP
-		if realClientIP == "" {
-			realClientIP = stripPort(req.RemoteAddr)
-		}
-
-		// Get proxy IP (immediate connection, likely Cloudflare)
-		proxyIP := stripPort(req.RemoteAddr)
-
-		// Call original director (this sets req.Host to backend host)
-		originalDirector(req)
-
-		// Add/preserve X-Forwarded headers (handling Cloudflare proxy)
-		if req.Header.Get("X-Forwarded-Host") == "" {
-			req.Header.Set("X-Forwarded-Host", originalHost)
-		}
-		if req.Header.Get("X-Forwarded-Proto") == "" {
-			req.Header.Set("X-Forwarded-Proto", "https")
-		}
-		if req.Header.Get("X-Real-IP") == "" {
-			req.Header.Set("X-Real-IP", realClientIP)
-		}
-		// Append proxy IP to X-Forwarded-For chain (preserves Cloudflare chain + adds our proxy)
-		if existing := req.Header.Get("X-Forwarded-For"); existing != "" {
-			req.Header.Set("X-Forwarded-For", existing+", "+proxyIP)
-		} else {
-			req.Header.Set("X-Forwarded-For", realClientIP)
-		}
-	}
+	proxy.Director = forwardingDirector(proxy.Director)
 
 	backend := &Backend{
 		URL:                target,
@@ -841,6 +1521,11 @@ func (s *Server) getOrCreateBackend(target *url.URL, options map[string]interfac
 			"application/json":       {},
 			"image/svg+xml":          {},
 		},
+		maintenanceStatus:  http.StatusServiceUnavailable,
+		maintenanceRetry:   5 * time.Minute,
+		drainStatus:        http.StatusServiceUnavailable,
+		drainRetry:         time.Minute,
+		disabledRetry:      30 * time.Second,
 		websocketMaxDur:    24 * time.Hour,
 		websocketIdle:      5 * time.Minute,
 		websocketPing:      30 * time.Second,
@@ -850,6 +1535,10 @@ func (s *Server) getOrCreateBackend(target *url.URL, options map[string]interfac
 		cbTimeout:          30 * time.Second,
 		cbWindow:           60 * time.Second,
 		cbState:            "closed",
+		events:             s.events,
+		requestIDHeader:    s.requestIDHeader,
+		globalStrip:        s.responseStripList,
+		options:            copyOptions(options),
 	}
 
 	if mc, ok := s.metricsCollector.(*metrics.Collector); ok {
@@ -861,10 +1550,67 @@ func (s *Server) getOrCreateBackend(target *url.URL, options map[string]interfac
 		if v, ok := options["health_check_path"].(string); ok {
 			backend.HealthPath = v
 		}
+		if v, ok := options["strip_response_headers"].([]string); ok {
+			backend.stripHeaders = v
+		}
+		if v, ok := options["service_limit_key"].(string); ok {
+			backend.limitKey = v
+		}
+		if v, ok := options["service_name"].(string); ok {
+			backend.serviceName = v
+		}
+		if v, ok := options["max_response_body"].(int64); ok && v > 0 {
+			backend.maxResponseBody = v
+		}
+		if vm, ok := options["response_validation"].(map[string]interface{}); ok {
+			backend.validator = newResponseValidator(vm)
+		}
+		backend.rateLimit = newBackendRateLimiter(options)
+		if v, ok := options["mirror_backend"].(string); ok && v != "" {
+			m, err := newMirror(v, options)
+			if err != nil {
+				log.Error().Err(err).Str("backend", target.String()).Msg("Request mirroring disabled")
+			} else {
+				m.metrics = backend.metrics
+				backend.mirror = m
+			}
+		}
+		if v, ok := options["maintenance_status"].(int); ok && v > 0 {
+			backend.maintenanceStatus = v
+		}
+		if v, ok := options["maintenance_retry_after"].(time.Duration); ok && v > 0 {
+			backend.maintenanceRetry = v
+		}
+		if v, ok := options["drain_status"].(int); ok && v > 0 {
+			backend.drainStatus = v
+		}
+		if v, ok := options["drain_retry_after"].(time.Duration); ok && v > 0 {
+			backend.drainRetry = v
+		}
+		if v, ok := options["disabled_retry_after"].(time.Duration); ok && v > 0 {
+			backend.disabledRetry = v
+		}
+		if v, ok := options["drain_redirect"].(string); ok {
+			backend.drainRedirect = v
+		}
+		if v, ok := options["maintenance_template"].(string); ok && v != "" {
+			tmpl, err := loadMaintenanceTemplate(v)
+			if err != nil {
+				log.Error().Err(err).Str("backend", target.String()).Msg("Using built-in maintenance page")
+			} else {
+				backend.maintenanceTemplate = tmpl
+			}
+		}
 		if v, ok := options["timeout"].(time.Duration); ok {
 			backend.Timeout = v
 			transport.ResponseHeaderTimeout = v
 		}
+		if v, ok := options["request_timeout"].(time.Duration); ok && v > 0 {
+			backend.requestTimeout = v
+		}
+		if v, ok := options["streaming"].(bool); ok {
+			backend.streaming = v
+		}
 		// Connection pool settings
 		if pm, ok := options["pool"].(map[string]interface{}); ok {
 			if v, ok := pm["max_idle_conns"].(int); ok && v > 0 {
@@ -879,6 +1625,22 @@ func (s *Server) getOrCreateBackend(target *url.URL, options map[string]interfac
 			if v, ok := pm["idle_timeout"].(time.Duration); ok && v > 0 {
 				transport.IdleConnTimeout = v
 			}
+			// A negative keep-alive turns TCP keep-alive probes off
+			if v, ok := pm["keep_alive"].(time.Duration); ok && v != 0 {
+				dialer.KeepAlive = v
+			}
+			noDelay := true
+			if v, ok := pm["tcp_no_delay"].(bool); ok {
+				noDelay = v
+			}
+			maxAge, _ := pm["max_conn_age"].(time.Duration)
+			if !noDelay || maxAge > 0 {
+				transport.DialContext = tuneUpstreamDial(transport.DialContext, noDelay, maxAge)
+			}
+			if maxAge > 0 {
+				roundTripper = newMaxAgeTransport(transport, maxAge)
+				proxy.Transport = roundTripper
+			}
 		}
 		// Slow request detection
 		if sm, ok := options["slow_request"].(map[string]interface{}); ok {
@@ -894,6 +1656,13 @@ func (s *Server) getOrCreateBackend(target *url.URL, options map[string]interfac
 			if v, ok := sm["timeout"].(time.Duration); ok {
 				backend.slowTimeout = v
 			}
+			if v, ok := sm["mode"].(string); ok && v == SlowModeAdaptive {
+				backend.slowMultiplier = 2
+				if m, ok := sm["multiplier"].(float64); ok && m > 0 {
+					backend.slowMultiplier = m
+				}
+				backend.latency = &latencyTracker{}
+			}
 			if v, ok := sm["alert_webhook"].(bool); ok {
 				backend.alertWebhook = v
 			}
@@ -925,7 +1694,7 @@ func (s *Server) getOrCreateBackend(target *url.URL, options map[string]interfac
 				}
 			}
 			if backend.retryEnabled && backend.retryMax > 0 {
-				proxy.Transport = newRetryTransport(transport, backend)
+				proxy.Transport = newRetryTransport(roundTripper, backend)
 			}
 		}
 		// Compression
@@ -992,9 +1761,22 @@ func (s *Server) getOrCreateBackend(target *url.URL, options map[string]interfac
 
 	// Attach response modifiers and error handler
 	proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
+		if errors.Is(err, errResponseTooLarge) {
+			logResponseTooLarge(req, err)
+			rw.WriteHeader(http.StatusBadGateway)
+			_, _ = io.WriteString(rw, "Bad Gateway: upstream response too large")
+			return
+		}
+		if errors.Is(err, context.DeadlineExceeded) && backend.requestTimeout > 0 {
+			backend.cbRecordFailure()
+			log.Warn().Dur("request_timeout", backend.requestTimeout).Str("host", req.Host).Str("path", req.URL.Path).Str("request_id", tracing.GetRequestIDFromRequest(req)).Msg("Upstream request timed out")
+			rw.WriteHeader(http.StatusGatewayTimeout)
+			_, _ = io.WriteString(rw, "Gateway Timeout")
+			return
+		}
 		// Record circuit breaker failure on transport errors
 		backend.cbRecordFailure()
-		log.Error().Err(err).Str("host", req.Host).Str("path", req.URL.Path).Msg("Upstream transport error")
+		log.Error().Err(err).Str("host", req.Host).Str("path", req.URL.Path).Str("request_id", tracing.GetRequestIDFromRequest(req)).Msg("Upstream transport error")
 		rw.WriteHeader(http.StatusBadGateway)
 		_, _ = io.WriteString(rw, "Bad Gateway")
 	}
@@ -1003,14 +1785,40 @@ func (s *Server) getOrCreateBackend(target *url.URL, options map[string]interfac
 	return backend
 }
 
-// buildModifyResponse composes response modifiers (compression + circuit breaker updates)
+// buildModifyResponse composes response modifiers (header stripping, circuit breaker updates, compression)
 func (b *Backend) buildModifyResponse() func(*http.Response) error {
 	compress := b.compressionHandler()
 	return func(res *http.Response) error {
+		// ServeHTTP already set the request ID on the client response; drop
+		// the backend's echo so the header is not sent twice
+		if res != nil && b.requestIDHeader != "" {
+			res.Header.Del(b.requestIDHeader)
+		}
+		if res != nil {
+			b.stripResponseHeaders(res)
+		}
+		if res != nil {
+			if err := b.limitResponseBody(res); err != nil {
+				return err
+			}
+		}
+		// A 2xx that is not what the route expects counts as a failure
+		invalid := false
+		if res != nil && b.validator != nil {
+			if reason := b.validator.check(res); reason != "" {
+				invalid = true
+				b.validator.failures.Add(1)
+				event := log.Warn().Str("backend", b.URL.String()).Str("reason", reason)
+				if res.Request != nil {
+					event = event.Str("path", res.Request.URL.Path).Str("request_id", tracing.GetRequestIDFromRequest(res.Request))
+				}
+				event.Msg("Upstream response failed validation")
+			}
+		}
 		// Update circuit breaker state based on status
 		if res != nil {
 			code := res.StatusCode
-			if code >= 500 {
+			if code >= 500 || invalid {
 				b.cbRecordFailure()
 			} else if code >= 200 {
 				b.cbRecordSuccess()
@@ -1021,6 +1829,32 @@ func (b *Backend) buildModifyResponse() func(*http.Response) error {
 	}
 }
 
+// stripResponseHeaders removes hop-by-hop headers and the global and route
+// strip lists from an upstream response
+func (b *Backend) stripResponseHeaders(res *http.Response) {
+	// A protocol switch needs Connection and Upgrade
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		for _, v := range res.Header.Values("Connection") {
+			for _, name := range strings.Split(v, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					res.Header.Del(name)
+				}
+			}
+		}
+		for _, name := range hopByHopHeaders {
+			res.Header.Del(name)
+		}
+	}
+	if b.globalStrip != nil {
+		for _, name := range b.globalStrip() {
+			res.Header.Del(name)
+		}
+	}
+	for _, name := range b.stripHeaders {
+		res.Header.Del(name)
+	}
+}
+
 // cbRecordFailure records a failure and possibly opens the breaker
 func (b *Backend) cbRecordFailure() {
 	if !b.cbEnabled {
@@ -1028,6 +1862,9 @@ func (b *Backend) cbRecordFailure() {
 	}
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	if b.cbForced != "" {
+		return
+	}
 	now := time.Now()
 	if b.cbWindow > 0 && !b.cbLastFailure.IsZero() && now.Sub(b.cbLastFailure) > b.cbWindow {
 		b.cbFailures = 0
@@ -1051,10 +1888,13 @@ func (b *Backend) cbRecordSuccess() {
 	}
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	if b.cbForced != "" {
+		return
+	}
 	if b.cbState == "half-open" {
 		b.cbSuccesses++
 		if b.cbSuccesses >= b.cbSuccessThreshold {
-			b.cbState = "closed"
+			b.cbSetState("closed")
 			b.cbFailures = 0
 			b.cbSuccesses = 0
 			b.cbLastFailure = time.Time{}
@@ -1068,11 +1908,37 @@ func (b *Backend) cbRecordSuccess() {
 }
 
 func (b *Backend) cbOpenNow(now time.Time) {
-	b.cbState = "open"
+	b.cbSetState("open")
 	b.cbOpenedAt = now
 	b.cbSuccesses = 0
 }
 
+// cbSetState changes the breaker state and publishes the transition.
+// Caller must hold b.mu.
+func (b *Backend) cbSetState(state string) {
+	if b.cbState == state {
+		return
+	}
+	prev := b.cbState
+	b.cbState = state
+
+	severity := "info"
+	if state == "open" {
+		severity = "error"
+	}
+	b.events.Publish(events.Event{
+		Type:     events.TypeCircuitBreaker,
+		Severity: severity,
+		Message:  fmt.Sprintf("Circuit breaker for %s: %s -> %s", b.URL, prev, state),
+		Data: map[string]interface{}{
+			"backend":  b.URL.String(),
+			"from":     prev,
+			"to":       state,
+			"failures": b.cbFailures,
+		},
+	})
+}
+
 // retryTransport wraps a base RoundTripper with retry logic
 type retryTransport struct {
 	base    http.RoundTripper
@@ -1129,8 +1995,9 @@ func (rt *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 			}
 		}
 
-		// Stop if no retry or max attempts reached
-		if !should || !rt.backend.retryEnabled || attempts >= rt.backend.retryMax-1 {
+		// Stop if no retry, the request was cancelled or timed out, or max
+		// attempts reached
+		if !should || req.Context().Err() != nil || !rt.backend.retryEnabled || attempts >= rt.backend.retryMax-1 {
 			if rt.backend.metrics != nil {
 				if err == nil {
 					rt.backend.metrics.RecordRetrySuccess()
@@ -1177,6 +2044,9 @@ func (b *Backend) shouldCompress(res *http.Response) (string, bool) {
 	if !b.compressionEnabled || res == nil || res.Request == nil {
 		return "", false
 	}
+	if compressionPressure.Load() == PressureOff {
+		return "", false
+	}
 
 	// Skip on WebSocket or already encoded responses
 	if isWebSocketRequest(res.Request) {
@@ -1223,12 +2093,14 @@ func (b *Backend) applyCompression(res *http.Response, algo string) error {
 	go func() {
 		defer originalBody.Close()
 		var writer io.WriteCloser
+		level := b.compressionLevelFor(algo)
+		if b.metrics != nil {
+			b.metrics.RecordCompressionLevel(algo, level)
+		}
 		switch algo {
 		case "br":
-			level := b.compressionLevelFor(algo)
 			writer = brotli.NewWriterLevel(pw, level)
 		case "gzip":
-			level := b.compressionLevelFor(algo)
 			gz, err := gzip.NewWriterLevel(pw, level)
 			if err != nil {
 				pw.CloseWithError(err)
@@ -1252,7 +2124,19 @@ func (b *Backend) applyCompression(res *http.Response, algo string) error {
 	return nil
 }
 
+// compressionLevelFor returns the level for algo, capped while adaptive
+// compression reports pressure
 func (b *Backend) compressionLevelFor(algo string) int {
+	level := b.configuredLevelFor(algo)
+	if compressionPressure.Load() == PressureReduced {
+		if a := adaptiveCompression.Load(); a != nil {
+			return a.capLevel(algo, level)
+		}
+	}
+	return level
+}
+
+func (b *Backend) configuredLevelFor(algo string) int {
 	level := b.compressionLevel
 	switch algo {
 	case "gzip":
@@ -1339,6 +2223,11 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request, route *
 		routePath = route.Path
 	}
 
+	if s.draining.Load() {
+		http.Error(w, "Server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
 	if backend.websocketMaxConn > 0 && atomic.LoadInt64(&backend.websocketActive) >= int64(backend.websocketMaxConn) {
 		http.Error(w, "WebSocket capacity reached", http.StatusServiceUnavailable)
 		return
@@ -1363,8 +2252,11 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request, route *
 		backendConn.Close()
 		return
 	}
+	// Hijack may leave the listener's read and write deadlines set, which
+	// would cut the WebSocket at the server timeouts
+	clientConn.SetDeadline(time.Time{})
 
-	requestID := r.Header.Get("X-Request-ID")
+	requestID := tracing.GetRequestIDFromRequest(r)
 	if requestID == "" {
 		requestID = tracing.GenerateRequestID()
 	}
@@ -1372,12 +2264,16 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request, route *
 	outbound := r.Clone(r.Context())
 	outbound.URL.Scheme = backend.URL.Scheme
 	outbound.URL.Host = backend.URL.Host
-	outbound.Host = backend.URL.Host
+	if unixSocketPath(backend.URL) != "" {
+		outbound.URL.Scheme, outbound.URL.Host = "http", unixSocketHost
+	}
+	outbound.Host = outbound.URL.Host
 	outbound.RequestURI = r.URL.RequestURI()
 	outbound.Header.Set("Connection", "Upgrade")
 	outbound.Header.Set("Upgrade", "websocket")
-	outbound.Header.Set("X-Request-ID", requestID)
-	outbound.Header.Set("X-Forwarded-For", r.RemoteAddr)
+	outbound.Header.Set(s.requestIDHeader, requestID)
+	outbound.Header.Set("X-Forwarded-For", forwardedFor(r))
+	outbound.Header.Set("X-Real-IP", ClientIP(r))
 	// Preserve WebSocket handshake headers
 	if key := r.Header.Get("Sec-WebSocket-Key"); key != "" {
 		outbound.Header.Set("Sec-WebSocket-Key", key)
@@ -1417,12 +2313,21 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request, route *
 
 	resp.Header.Del("Content-Length")
 	resp.Header.Del("Transfer-Encoding")
+	resp.Header.Set(s.requestIDHeader, requestID)
 	if err := resp.Write(clientConn); err != nil {
 		clientConn.Close()
 		backendConn.Close()
 		return
 	}
 
+	if !s.trackWebSocket(clientConn) {
+		// Shutdown started during the handshake
+		clientConn.Close()
+		backendConn.Close()
+		return
+	}
+	defer s.untrackWebSocket(clientConn)
+
 	if s.debug {
 		log.Debug().Str("host", r.Host).Str("path", routePath).Msg("WebSocket upgrade established")
 	}
@@ -1443,7 +2348,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request, route *
 	if db, ok := s.db.(*database.DB); ok {
 		dbConnID, _ = db.InsertWebSocketConnection(&database.WebSocketConnection{
 			RequestID:   requestID,
-			ClientIP:    r.RemoteAddr,
+			ClientIP:    ClientIP(r),
 			ConnectedAt: start.Unix(),
 		})
 	}
@@ -1461,7 +2366,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request, route *
 	}()
 	go func() {
 		defer wg.Done()
-		io.Copy(&countingWriter{w: clientConn, counter: &toClient, activity: &lastActivity}, backendConn)
+		io.Copy(&countingWriter{w: clientConn, counter: &toClient, activity: &lastActivity, limit: s.serviceLimiter(backend.limitKey)}, backendConn)
 	}()
 
 	if backend.websocketIdle > 0 {
@@ -1506,6 +2411,7 @@ type countingWriter struct {
 	w        io.Writer
 	counter  *uint64
 	activity *int64
+	limit    *serviceLimiter // Charged for bytes written, optional
 }
 
 func (cw *countingWriter) Write(p []byte) (int, error) {
@@ -1517,6 +2423,9 @@ func (cw *countingWriter) Write(p []byte) (int, error) {
 		if cw.activity != nil {
 			atomic.StoreInt64(cw.activity, time.Now().UnixNano())
 		}
+		if cw.limit != nil {
+			cw.limit.charge(n)
+		}
 	}
 	return n, err
 }
@@ -1526,6 +2435,9 @@ func (s *Server) dialBackend(backend *Backend) (net.Conn, error) {
 		Timeout:   backend.Timeout,
 		KeepAlive: 30 * time.Second,
 	}
+	if socket := unixSocketPath(backend.URL); socket != "" {
+		return dialer.Dial("unix", socket)
+	}
 	if backend.URL.Scheme == "https" {
 		return tls.DialWithDialer(dialer, "tcp", backend.URL.Host, &tls.Config{ServerName: backend.URL.Hostname()})
 	}
@@ -1538,7 +2450,7 @@ func (s *Server) recordSlowMetric(level string) {
 	}
 }
 
-func (s *Server) sendSlowAlert(route *Route, r *http.Request, duration time.Duration, severity string) {
+func (s *Server) sendSlowAlert(route *Route, r *http.Request, duration time.Duration, severity string, threshold time.Duration, adaptive bool) {
 	notifier, ok := s.notifier.(*webhook.Notifier)
 	if !ok || notifier == nil {
 		return
@@ -1549,6 +2461,12 @@ func (s *Server) sendSlowAlert(route *Route, r *http.Request, duration time.Dura
 		"path":     r.URL.Path,
 		"method":   r.Method,
 		"duration": duration.String(),
+		// What the request was held against, fixed or from recent latency
+		"threshold": threshold.String(),
+		"mode":      SlowModeFixed,
+	}
+	if adaptive {
+		fields["mode"] = SlowModeAdaptive
 	}
 	if route != nil {
 		fields["route"] = route.Path
@@ -1572,32 +2490,41 @@ func (s *Server) sendSlowAlert(route *Route, r *http.Request, duration time.Dura
 func (s *Server) applyHeaders(w http.ResponseWriter, route *Route) {
 	headers := w.Header()
 
+	s.mu.RLock()
+	global := s.globalHeaders
+	s.mu.RUnlock()
+
 	// Apply global headers first
-	if s.globalHeaders.HSTS != "" {
-		headers.Set("Strict-Transport-Security", s.globalHeaders.HSTS)
+	if global.HSTS != "" {
+		headers.Set("Strict-Transport-Security", global.HSTS)
 	}
-	if s.globalHeaders.XFrameOptions != "" {
-		headers.Set("X-Frame-Options", s.globalHeaders.XFrameOptions)
+	if global.XFrameOptions != "" {
+		headers.Set("X-Frame-Options", global.XFrameOptions)
 	}
-	if s.globalHeaders.XContentType != "" {
-		headers.Set("X-Content-Type-Options", s.globalHeaders.XContentType)
+	if global.XContentType != "" {
+		headers.Set("X-Content-Type-Options", global.XContentType)
 	}
-	if s.globalHeaders.XSSProtection != "" {
-		headers.Set("X-XSS-Protection", s.globalHeaders.XSSProtection)
+	if global.XSSProtection != "" {
+		headers.Set("X-XSS-Protection", global.XSSProtection)
 	}
-	if s.globalHeaders.CSP != "" {
-		headers.Set("Content-Security-Policy", s.globalHeaders.CSP)
+	if global.CSP != "" {
+		headers.Set("Content-Security-Policy", global.CSP)
 	}
-	if s.globalHeaders.ReferrerPolicy != "" {
-		headers.Set("Referrer-Policy", s.globalHeaders.ReferrerPolicy)
+	if global.ReferrerPolicy != "" {
+		headers.Set("Referrer-Policy", global.ReferrerPolicy)
 	}
-	if s.globalHeaders.PermissionsPolicy != "" {
-		headers.Set("Permissions-Policy", s.globalHeaders.PermissionsPolicy)
+	if global.PermissionsPolicy != "" {
+		headers.Set("Permissions-Policy", global.PermissionsPolicy)
 	}
 
-	// Apply route-specific headers (override globals)
+	// Apply route-specific headers (override globals); an empty value
+	// removes the header, e.g. HSTS on an apex with plain HTTP subdomains
 	if route != nil && route.Headers != nil {
 		for k, v := range route.Headers {
+			if v == "" {
+				headers.Del(k)
+				continue
+			}
 			headers.Set(k, v)
 		}
 	}
@@ -1665,21 +2592,117 @@ func (s *Server) blackhole(w http.ResponseWriter, r *http.Request) {
 	// We intentionally don't send any response to avoid information disclosure to scanners.
 }
 
+// SetHTTPRedirectExempt replaces the path prefixes served over plain HTTP
+func (s *Server) SetHTTPRedirectExempt(prefixes []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.httpExempt = prefixes
+}
+
+// serveHTTP handles the plain HTTP listener. Requests for an exempt path or
+// a route with https_redirect off are served, the rest go to HTTPS.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.servedOverHTTP(r) {
+		s.ServeHTTP(w, r)
+		return
+	}
+	s.redirectToHTTPS(w, r)
+}
+
+// servedOverHTTP reports whether r may be answered without TLS
+func (s *Server) servedOverHTTP(r *http.Request) bool {
+	s.mu.RLock()
+	exempt := s.httpExempt
+	s.mu.RUnlock()
+	for _, prefix := range exempt {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+
+	host := r.Host
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	route := s.findRouteFor(r, host, r.URL.Path)
+	return route != nil && route.AllowHTTP
+}
+
 // redirectToHTTPS redirects HTTP to HTTPS
 func (s *Server) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
-	target := "https://" + r.Host + r.URL.RequestURI()
+	// Go to the canonical host in the same hop
+	host := r.Host
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	if canonical := s.canonicalHostFor(s.findRouteFor(r, host, r.URL.Path), host, r.URL.Path, true); canonical != "" {
+		host = canonical
+	} else {
+		host = r.Host
+	}
+	target := "https://" + host + r.URL.RequestURI()
 	http.Redirect(w, r, target, http.StatusMovedPermanently)
 }
 
-// tlsConfig returns TLS configuration
+// tlsConfig returns TLS configuration, advertising only the enabled
+// protocols. Certificates come only from getCertificate, which reads
+// s.certificates on every handshake, so UpdateCertificates reaches new
+// HTTPS and HTTP/3 connections alike without restarting a listener; the
+// http3 server clones this config per connection and keeps the callback.
 func (s *Server) tlsConfig() *tls.Config {
 	return &tls.Config{
 		GetCertificate: s.getCertificate,
-		NextProtos:     []string{"h3", "h2", "http/1.1"}, // HTTP/3, HTTP/2, HTTP/1.1
+		NextProtos:     s.nextProtos(),
 		MinVersion:     tls.VersionTLS12,
 	}
 }
 
+// listenPort returns the port of a listen address such as ":443", 443 when
+// it has none
+func listenPort(addr string) int {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 443
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n <= 0 {
+		return 443
+	}
+	return n
+}
+
+// altSvcValue builds the Alt-Svc header advertising HTTP/3 on port
+func altSvcValue(port int, maxAge time.Duration) string {
+	if maxAge <= 0 {
+		maxAge = 24 * time.Hour
+	}
+	return fmt.Sprintf(`h3=":%d"; ma=%d`, port, int(maxAge.Seconds()))
+}
+
+// altSvcFor returns the Alt-Svc value for r. Without http3_addr each HTTPS
+// port has its own HTTP/3 listener, so the port r arrived on is advertised.
+func (s *Server) altSvcFor(r *http.Request) string {
+	if s.altSvc == "" || !s.altSvcLocalPort {
+		return s.altSvc
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return altSvcValue(listenPort(addr.String()), s.altSvcMaxAge)
+	}
+	return s.altSvc
+}
+
+// nextProtos returns the ALPN protocols in preference order
+func (s *Server) nextProtos() []string {
+	var protos []string
+	if s.http3 {
+		protos = append(protos, "h3")
+	}
+	if s.http2 {
+		protos = append(protos, "h2")
+	}
+	return append(protos, "http/1.1")
+}
+
 // getCertificate returns the appropriate certificate for a domain (supports wildcards)
 func (s *Server) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
 	domain := strings.ToLower(hello.ServerName)
@@ -1767,16 +2790,12 @@ func (s *Server) hostPolicy(ctx context.Context, host string) error {
 	return fmt.Errorf("domain not allowed: %s", host)
 }
 
-// sortRoutes sorts routes by priority (longer paths first)
+// sortRoutes sorts routes by priority (longer paths first), keeping
+// registration order for equal priorities
 func (s *Server) sortRoutes() {
-	// Simple bubble sort (routes list is small)
-	for i := 0; i < len(s.routes); i++ {
-		for j := i + 1; j < len(s.routes); j++ {
-			if s.routes[j].Priority > s.routes[i].Priority {
-				s.routes[i], s.routes[j] = s.routes[j], s.routes[i]
-			}
-		}
-	}
+	sort.SliceStable(s.routes, func(i, j int) bool {
+		return s.routes[i].Priority > s.routes[j].Priority
+	})
 }
 
 // routeKey generates a key for route map
@@ -1784,6 +2803,12 @@ func (s *Server) routeKey(domain, path string) string {
 	return domain + path
 }
 
+// sameRoute reports whether a and b share a domain, the path and the
+// request predicates, so that only one of them can be active
+func (s *Server) sameRoute(a, b *Route) bool {
+	return s.routeMatches(a, b.Domains, b.Path) && a.Match.Key() == b.Match.Key()
+}
+
 // routeMatches checks if route matches domains and path
 func (s *Server) routeMatches(route *Route, domains []string, path string) bool {
 	if route.Path != path {
@@ -1816,10 +2841,15 @@ func (s *Server) GetBackendStatus(domain, path string) *BackendStatus {
 			drainRemaining = backend.DrainDuration - elapsed
 		}
 	}
+	var validationFailures uint64
+	if backend.validator != nil {
+		validationFailures = backend.validator.failures.Load()
+	}
 
 	return &BackendStatus{
 		Healthy:            backend.Healthy,
 		CircuitState:       backend.cbState,
+		CircuitForced:      backend.cbForced != "",
 		Failures:           backend.cbFailures,
 		Successes:          backend.cbSuccesses,
 		OpenedAt:           backend.cbOpenedAt,
@@ -1831,6 +2861,8 @@ func (s *Server) GetBackendStatus(domain, path string) *BackendStatus {
 		DrainStart:         backend.DrainStart,
 		DrainRemaining:     drainRemaining,
 		DrainRejected:      atomic.LoadInt64(&backend.DrainRejected),
+		ValidationFailures: validationFailures,
+		Timeout:            backend.Timeout,
 	}
 }
 
@@ -1849,6 +2881,8 @@ func (s *Server) SetMaintenance(domains []string, path string, enabled bool, mai
 				atomic.StoreInt64(&route.Backend.MaintenanceHits, 0) // Reset counter
 			} else {
 				route.Backend.MaintenancePageURL = ""
+				route.Backend.MaintenanceReason = ""
+				route.Backend.MaintenanceETA = ""
 			}
 			route.Backend.mu.Unlock()
 			found = true
@@ -1920,30 +2954,151 @@ func (s *Server) CancelDrain(domains []string, path string) error {
 	return nil
 }
 
-// Shutdown gracefully shuts down all servers
+// Circuit breaker overrides for ForceCircuitBreaker
+const (
+	CircuitForceOpen  = "open"  // Refuse every request with 503
+	CircuitForceClose = "close" // Pass every request, whatever fails
+	CircuitForceAuto  = "auto"  // Back to the automatic breaker
+)
+
+// ForceCircuitBreaker overrides the circuit breaker of the routes' backend,
+// e.g. to take it out during an incident. A forced state ignores failures
+// and successes until mode CircuitForceAuto hands control back; the breaker
+// then starts from the forced state. Backends without a breaker can be
+// forced too.
+func (s *Server) ForceCircuitBreaker(domains []string, path, mode string) error {
+	if mode != CircuitForceOpen && mode != CircuitForceClose && mode != CircuitForceAuto {
+		return fmt.Errorf("invalid circuit breaker mode %q: must be open, close or auto", mode)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := false
+	for _, route := range s.routes {
+		if !s.routeMatches(route, domains, path) {
+			continue
+		}
+		b := route.Backend
+		b.mu.Lock()
+		switch mode {
+		case CircuitForceOpen:
+			b.cbForced = mode
+			b.cbOpenNow(time.Now())
+		case CircuitForceClose:
+			b.cbForced = mode
+			b.cbSetState("closed")
+			b.cbFailures, b.cbSuccesses = 0, 0
+		case CircuitForceAuto:
+			b.cbForced = ""
+			if !b.cbEnabled {
+				b.cbSetState("closed")
+			}
+		}
+		b.mu.Unlock()
+		found = true
+		log.Info().
+			Strs("domains", domains).
+			Str("path", path).
+			Str("mode", mode).
+			Msg("Circuit breaker forced")
+	}
+
+	if !found {
+		return fmt.Errorf("route not found")
+	}
+	return nil
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests and
+// WebSocket sessions to finish. When ctx expires first, remaining WebSockets
+// are closed and ctx's error is returned. Only the first call does the work.
 func (s *Server) Shutdown(ctx context.Context) error {
+	if s.draining.Swap(true) {
+		return nil
+	}
 	log.Info().Msg("Shutting down servers...")
 
+	s.mu.RLock()
+	httpServer, httpsServers, http3Servers := s.httpServer, s.httpsServers, s.http3Servers
+	s.mu.RUnlock()
+
 	var err error
-	if s.httpServer != nil {
-		if e := s.httpServer.Shutdown(ctx); e != nil {
+	if httpServer != nil {
+		if e := httpServer.Shutdown(ctx); e != nil {
 			err = e
 		}
 	}
-	if s.httpsServer != nil {
-		if e := s.httpsServer.Shutdown(ctx); e != nil {
+	for _, srv := range httpsServers {
+		if e := srv.Shutdown(ctx); e != nil {
 			err = e
 		}
 	}
-	if s.http3Server != nil {
-		if e := s.http3Server.Close(); e != nil {
+	for _, srv := range http3Servers {
+		if e := srv.Close(); e != nil {
 			err = e
 		}
 	}
+	if e := s.waitWebSockets(ctx); e != nil {
+		err = e
+	}
 
 	return err
 }
 
+// Draining reports whether Shutdown has started
+func (s *Server) Draining() bool {
+	return s.draining.Load()
+}
+
+// trackWebSocket registers a hijacked client connection so Shutdown can wait
+// for it. Returns false when the server is already draining.
+func (s *Server) trackWebSocket(conn net.Conn) bool {
+	s.wsMu.Lock()
+	defer s.wsMu.Unlock()
+	if s.draining.Load() {
+		return false
+	}
+	s.websockets[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) untrackWebSocket(conn net.Conn) {
+	s.wsMu.Lock()
+	delete(s.websockets, conn)
+	s.wsMu.Unlock()
+}
+
+func (s *Server) activeWebSockets() int {
+	s.wsMu.Lock()
+	defer s.wsMu.Unlock()
+	return len(s.websockets)
+}
+
+// waitWebSockets waits for tracked WebSockets to close, closing whatever is
+// left when ctx expires
+func (s *Server) waitWebSockets(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		n := s.activeWebSockets()
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			s.wsMu.Lock()
+			for conn := range s.websockets {
+				conn.Close()
+			}
+			s.wsMu.Unlock()
+			log.Warn().Int("websockets", n).Msg("Shutdown timeout reached, closing remaining WebSocket connections")
+			return ctx.Err()
+		}
+	}
+}
+
 // stripPort removes the port from an address, handling both IPv4 and IPv6
 func stripPort(addr string) string {
 	// Handle IPv6 with port: [2001:db8::1]:8080 -> 2001:db8::1
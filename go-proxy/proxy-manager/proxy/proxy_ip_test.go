@@ -1,6 +1,9 @@
 package proxy
 
 import (
+	"bufio"
+	"encoding/binary"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/http/httputil"
@@ -12,6 +15,8 @@ import (
 // TestRealClientIPExtraction tests that we correctly extract the real client IP
 // from Cloudflare headers and X-Forwarded-For chains
 func TestRealClientIPExtraction(t *testing.T) {
+	trustProxies(t, "172.68.0.0/16")
+
 	tests := []struct {
 		name           string
 		remoteAddr     string
@@ -34,18 +39,18 @@ func TestRealClientIPExtraction(t *testing.T) {
 			expectedRealIP: "198.51.100.23",
 		},
 		{
-			name:           "X-Forwarded-For with chain",
+			name:           "X-Forwarded-For with chain uses rightmost untrusted hop",
 			remoteAddr:     "172.68.1.1:54321",
 			cfConnectingIP: "",
 			xForwardedFor:  "198.51.100.23, 203.0.113.1",
-			expectedRealIP: "198.51.100.23",
+			expectedRealIP: "203.0.113.1",
 		},
 		{
 			name:           "X-Forwarded-For with spaces",
 			remoteAddr:     "172.68.1.1:54321",
 			cfConnectingIP: "",
 			xForwardedFor:  "  198.51.100.23  ,  203.0.113.1  ",
-			expectedRealIP: "198.51.100.23",
+			expectedRealIP: "203.0.113.1",
 		},
 		{
 			name:           "No headers - fallback to RemoteAddr",
@@ -170,6 +175,8 @@ func TestIPv6AddressHandling(t *testing.T) {
 // TestXForwardedForChainPreservation tests that existing X-Forwarded-For chains
 // are preserved and our proxy IP is appended correctly
 func TestXForwardedForChainPreservation(t *testing.T) {
+	trustProxies(t, "172.68.0.0/16", "10.0.0.0/8")
+
 	tests := []struct {
 		name           string
 		remoteAddr     string
@@ -247,59 +254,190 @@ func TestXForwardedForChainPreservation(t *testing.T) {
 	}
 }
 
-// Helper function to create a test proxy with our IP extraction logic
+// Helper function to create a test proxy with the production director
 func createTestProxy(target *url.URL) *httputil.ReverseProxy {
 	proxy := httputil.NewSingleHostReverseProxy(target)
-	originalDirector := proxy.Director
+	proxy.Director = forwardingDirector(proxy.Director)
+	return proxy
+}
 
-	proxy.Director = func(req *http.Request) {
-		// Save original host before director changes it
-		originalHost := req.Host
+// trustProxies sets the trusted proxy list for the duration of a test
+func trustProxies(t *testing.T, entries ...string) {
+	t.Helper()
+	trusted, err := ParseTrustedProxies(entries)
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+	SetTrustedProxies(trusted)
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+}
 
-		// Extract real client IP (handling Cloudflare proxy)
-		realClientIP := ""
-		// 1. Try CF-Connecting-IP (Cloudflare's real client IP header)
-		if cfIP := req.Header.Get("CF-Connecting-IP"); cfIP != "" {
-			realClientIP = cfIP
-		}
-		// 2. Try first IP in X-Forwarded-For (standard proxy chain)
-		if realClientIP == "" {
-			if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
-				if idx := strings.Index(xff, ","); idx > 0 {
-					realClientIP = strings.TrimSpace(xff[:idx])
-				} else {
-					realClientIP = strings.TrimSpace(xff)
-				}
-			}
-		}
-		// 3. Fallback to immediate connection IP
-		if realClientIP == "" {
-			realClientIP = stripPort(req.RemoteAddr)
-		}
+// TestClientIPSpoofing checks that forwarding headers are ignored from an
+// untrusted peer and honored from a trusted one
+func TestClientIPSpoofing(t *testing.T) {
+	trustProxies(t, "172.68.0.0/16", "10.0.0.1")
 
-		// Get proxy IP (immediate connection, likely Cloudflare)
-		proxyIP := stripPort(req.RemoteAddr)
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"untrusted peer spoofs XFF", "198.51.100.7:5000", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "198.51.100.7"},
+		{"untrusted peer spoofs X-Real-IP", "198.51.100.7:5000", map[string]string{"X-Real-IP": "1.2.3.4"}, "198.51.100.7"},
+		{"untrusted peer spoofs CF-Connecting-IP", "198.51.100.7:5000", map[string]string{"CF-Connecting-IP": "1.2.3.4"}, "198.51.100.7"},
+		{"trusted peer XFF honored", "172.68.1.1:5000", map[string]string{"X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+		{"trusted peer X-Real-IP honored", "10.0.0.1:5000", map[string]string{"X-Real-IP": "203.0.113.9"}, "203.0.113.9"},
+		{"client-prepended hop ignored", "172.68.1.1:5000", map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.9"}, "203.0.113.9"},
+		{"trusted hops skipped", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "203.0.113.9, 172.68.2.2"}, "203.0.113.9"},
+		{"malformed hop stops walk", "172.68.1.1:5000", map[string]string{"X-Forwarded-For": "203.0.113.9, bogus"}, "172.68.1.1"},
+		{"IPv6 untrusted peer", "[2001:db8::1]:5000", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "2001:db8::1"},
+	}
 
-		// Call original director (this sets req.Host to backend host)
-		originalDirector(req)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := ClientIP(req); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
 
-		// Add/preserve X-Forwarded headers (handling Cloudflare proxy)
-		if req.Header.Get("X-Forwarded-Host") == "" {
-			req.Header.Set("X-Forwarded-Host", originalHost)
-		}
-		if req.Header.Get("X-Forwarded-Proto") == "" {
-			req.Header.Set("X-Forwarded-Proto", "https")
+	// The spoofed chain from an untrusted peer must not reach the backend
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "198.51.100.7" {
+			t.Errorf("X-Forwarded-For = %q, want only the peer", xff)
 		}
-		if req.Header.Get("X-Real-IP") == "" {
-			req.Header.Set("X-Real-IP", realClientIP)
+		if ip := r.Header.Get("X-Real-IP"); ip != "198.51.100.7" {
+			t.Errorf("X-Real-IP = %q, want the peer", ip)
 		}
-		// Append proxy IP to X-Forwarded-For chain (preserves Cloudflare chain + adds our proxy)
-		if existing := req.Header.Get("X-Forwarded-For"); existing != "" {
-			req.Header.Set("X-Forwarded-For", existing+", "+proxyIP)
-		} else {
-			req.Header.Set("X-Forwarded-For", realClientIP)
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.RemoteAddr = "198.51.100.7:5000"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	req.Header.Set("X-Real-IP", "1.2.3.4")
+	createTestProxy(backendURL).ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestParseTrustedProxiesRejectsInvalid(t *testing.T) {
+	for _, entry := range []string{"not-an-ip", "10.0.0.0/33", "1.2.3"} {
+		if _, err := ParseTrustedProxies([]string{entry}); err == nil {
+			t.Errorf("expected error for %q", entry)
 		}
 	}
+}
 
-	return proxy
+// serveClientIP serves ClientIP(r) on a loopback listener reading PROXY
+// headers from trusted
+func serveClientIP(t *testing.T, trusted ...string) string {
+	t.Helper()
+	lbs, err := ParseTrustedProxies(trusted)
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ClientIP(r)))
+	})}
+	go srv.Serve(wrapProxyProtocol(ln, lbs))
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+// requestWithHeader sends header followed by a GET and returns the status
+// and body, or an error if the connection was dropped
+func requestWithHeader(addr string, header []byte) (int, string, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return 0, "", err
+	}
+	defer conn.Close()
+	conn.Write(append(header, "GET / HTTP/1.1\r\nHost: app.test\r\nConnection: close\r\n\r\n"...))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	var body strings.Builder
+	_, err = bufio.NewReader(resp.Body).WriteTo(&body)
+	return resp.StatusCode, body.String(), err
+}
+
+// proxyV2Header builds a binary v2 header for command and the given
+// addresses (both IPv4 or both IPv6)
+func proxyV2Header(command byte, src, dst net.IP, srcPort, dstPort uint16) []byte {
+	family, size := byte(0x11), net.IPv4len
+	if src.To4() == nil {
+		family, size = 0x21, net.IPv6len
+	}
+	body := make([]byte, 0, 2*size+4)
+	if size == net.IPv4len {
+		body = append(append(body, src.To4()...), dst.To4()...)
+	} else {
+		body = append(append(body, src.To16()...), dst.To16()...)
+	}
+	body = binary.BigEndian.AppendUint16(body, srcPort)
+	body = binary.BigEndian.AppendUint16(body, dstPort)
+	// A TLV the parser must skip
+	body = append(body, 0x04, 0x00, 0x01, 0xff)
+
+	header := append([]byte("\r\n\r\n\x00\r\nQUIT\n"), 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(body)))
+	return append(header, body...)
+}
+
+func TestProxyProtocolHeaders(t *testing.T) {
+	addr := serveClientIP(t, "127.0.0.1")
+
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"v1 TCP4", []byte("PROXY TCP4 203.0.113.45 10.0.0.1 54321 443\r\n"), "203.0.113.45"},
+		{"v1 TCP6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 54321 443\r\n"), "2001:db8::1"},
+		{"v1 UNKNOWN keeps the peer", []byte("PROXY UNKNOWN\r\n"), "127.0.0.1"},
+		{"v2 IPv4", proxyV2Header(0x1, net.ParseIP("198.51.100.23"), net.ParseIP("10.0.0.1"), 40000, 443), "198.51.100.23"},
+		{"v2 IPv6", proxyV2Header(0x1, net.ParseIP("2001:db8::7"), net.ParseIP("2001:db8::2"), 40000, 443), "2001:db8::7"},
+		{"v2 LOCAL keeps the peer", proxyV2Header(0x0, net.ParseIP("198.51.100.23"), net.ParseIP("10.0.0.1"), 40000, 443), "127.0.0.1"},
+		{"no header keeps the peer", nil, "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body, err := requestWithHeader(addr, tt.header)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			if status != http.StatusOK || body != tt.want {
+				t.Fatalf("expected client %s, got %d %q", tt.want, status, body)
+			}
+		})
+	}
+
+	// A malformed header from a trusted balancer drops the connection
+	if _, _, err := requestWithHeader(addr, []byte("PROXY TCP4 not-an-ip 10.0.0.1 1 2\r\n")); err == nil {
+		t.Fatalf("expected malformed header to close the connection")
+	}
+}
+
+func TestProxyProtocolIgnoredFromUntrustedPeer(t *testing.T) {
+	addr := serveClientIP(t, "10.0.0.0/8")
+
+	// The header stays in the stream, so a client cannot claim an address
+	status, body, _ := requestWithHeader(addr, []byte("PROXY TCP4 203.0.113.45 10.0.0.1 54321 443\r\n"))
+	if status == http.StatusOK || strings.Contains(body, "203.0.113.45") {
+		t.Fatalf("expected spoofed header to be rejected, got %d %q", status, body)
+	}
+	if status, body, err := requestWithHeader(addr, nil); err != nil || body != "127.0.0.1" {
+		t.Fatalf("expected plain request from the peer, got %d %q %v", status, body, err)
+	}
 }
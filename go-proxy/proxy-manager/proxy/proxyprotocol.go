@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyHeaderTimeout bounds reading the PROXY protocol header of a new
+// connection
+const proxyHeaderTimeout = 5 * time.Second
+
+var (
+	proxyV1Prefix    = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// proxyProtocolListener reads the PROXY protocol header (v1 or v2) that an
+// L4 load balancer prepends, so RemoteAddr is the client's address instead
+// of the balancer's. Only peers in trusted are read; from anyone else a
+// header is left in the stream and fails the request, so it cannot be
+// spoofed. A trusted peer may also connect without a header, e.g. for
+// health checks.
+type proxyProtocolListener struct {
+	net.Listener
+	trusted *TrustedProxies
+}
+
+// wrapProxyProtocol returns ln reading PROXY headers from trusted peers, ln
+// itself when trusted is nil
+func wrapProxyProtocol(ln net.Listener, trusted *TrustedProxies) net.Listener {
+	if trusted == nil {
+		return ln
+	}
+	return &proxyProtocolListener{Listener: ln, trusted: trusted}
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || !l.trusted.Contains(tcpAddr.IP) {
+		return conn, nil
+	}
+	// The header is read on first use, in the connection's own goroutine,
+	// so a slow peer does not hold up Accept
+	return &proxyProtocolConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// proxyProtocolConn is a connection from a trusted peer whose header is
+// parsed on the first Read or address lookup
+type proxyProtocolConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	once       sync.Once
+	err        error
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+func (c *proxyProtocolConn) init() {
+	c.once.Do(func() {
+		c.remoteAddr, c.localAddr = c.Conn.RemoteAddr(), c.Conn.LocalAddr()
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		src, dst, err := readProxyHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			// Nothing is answered to a peer that broke the protocol
+			c.err = fmt.Errorf("PROXY protocol header from %s: %w", c.remoteAddr, err)
+			c.Conn.Close()
+			return
+		}
+		if src != nil {
+			c.remoteAddr, c.localAddr = src, dst
+		}
+	})
+}
+
+func (c *proxyProtocolConn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+// RemoteAddr returns the client address from the header, the peer's when
+// there was none
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.init()
+	return c.remoteAddr
+}
+
+// LocalAddr returns the address the client connected to
+func (c *proxyProtocolConn) LocalAddr() net.Addr {
+	c.init()
+	return c.localAddr
+}
+
+// readProxyHeader consumes a PROXY header from r. It returns nil addresses
+// when the stream does not start with one, or the header carries none
+// (v1 UNKNOWN, v2 LOCAL).
+func readProxyHeader(r *bufio.Reader) (src, dst net.Addr, err error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch first[0] {
+	case proxyV1Prefix[0]:
+		if prefix, err := r.Peek(len(proxyV1Prefix)); err != nil || !bytes.Equal(prefix, proxyV1Prefix) {
+			return nil, nil, nil
+		}
+		return readProxyV1(r)
+	case proxyV2Signature[0]:
+		if sig, err := r.Peek(len(proxyV2Signature)); err != nil || !bytes.Equal(sig, proxyV2Signature) {
+			return nil, nil, nil
+		}
+		return readProxyV2(r)
+	}
+	return nil, nil, nil
+}
+
+// readProxyV1 parses "PROXY TCP4 src dst sport dport\r\n"
+func readProxyV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	const maxLen = 107 // Longest v1 header, CRLF included
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= maxLen {
+			return nil, nil, fmt.Errorf("v1 header longer than %d bytes", maxLen)
+		}
+	}
+	text, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, nil, fmt.Errorf("v1 header not terminated by CRLF")
+	}
+	fields := strings.Split(text, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("invalid v1 header %q", text)
+	}
+	src, err := proxyV1Addr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := proxyV1Addr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func proxyV1Addr(host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid v1 address %q", host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid v1 port %q", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// readProxyV2 parses the binary v2 header: signature, version and command,
+// address family, length, addresses and TLVs, which are skipped
+func readProxyV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, nil, fmt.Errorf("unsupported v2 version %d", header[12]>>4)
+	}
+	command, family := header[12]&0x0f, header[13]>>4
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, nil, err
+	}
+
+	switch command {
+	case 0x0: // LOCAL: the balancer's own connection, e.g. a health check
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, fmt.Errorf("unsupported v2 command %d", command)
+	}
+
+	var size int
+	switch family {
+	case 0x1: // AF_INET
+		size = net.IPv4len
+	case 0x2: // AF_INET6
+		size = net.IPv6len
+	default: // AF_UNSPEC or AF_UNIX, nothing usable
+		return nil, nil, nil
+	}
+	if len(body) < 2*size+4 {
+		return nil, nil, fmt.Errorf("v2 address block too short")
+	}
+	src := &net.TCPAddr{
+		IP:   net.IP(append([]byte(nil), body[:size]...)),
+		Port: int(binary.BigEndian.Uint16(body[2*size:])),
+	}
+	dst := &net.TCPAddr{
+		IP:   net.IP(append([]byte(nil), body[size:2*size]...)),
+		Port: int(binary.BigEndian.Uint16(body[2*size+2:])),
+	}
+	return src, dst, nil
+}
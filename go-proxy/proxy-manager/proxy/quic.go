@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/chilla55/proxy-manager/metrics"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+)
+
+// errQUICLimit refuses a QUIC connection over the configured maximum
+var errQUICLimit = errors.New("too many QUIC connections")
+
+// quicLimiter counts QUIC connections through quic-go's tracer and refuses
+// new ones beyond max before any handshake work is done
+type quicLimiter struct {
+	max      int64 // 0 means unlimited
+	active   atomic.Int64
+	rejected atomic.Uint64
+	metrics  interface{} // Metrics collector (optional)
+	config   *quic.Config
+}
+
+func newQUICLimiter(max int, collector interface{}) *quicLimiter {
+	l := &quicLimiter{max: int64(max), metrics: collector}
+	l.config = &quic.Config{
+		Allow0RTT:          true, // http3's default without a QuicConfig
+		GetConfigForClient: l.admit,
+		Tracer:             l.tracer,
+	}
+	return l
+}
+
+// admit is called for every connection attempt; the config it returns
+// replaces the server's, so it hands back its own
+func (l *quicLimiter) admit(*quic.ClientHelloInfo) (*quic.Config, error) {
+	if l.max > 0 && l.active.Load() >= l.max {
+		l.rejected.Add(1)
+		if mc, ok := l.metrics.(*metrics.Collector); ok {
+			mc.RecordQUICRejected()
+		}
+		return nil, errQUICLimit
+	}
+	return l.config, nil
+}
+
+// tracer is called once per accepted connection, before its handshake
+func (l *quicLimiter) tracer(context.Context, logging.Perspective, quic.ConnectionID) *logging.ConnectionTracer {
+	l.active.Add(1)
+	if mc, ok := l.metrics.(*metrics.Collector); ok {
+		mc.IncrementQUICActive()
+	}
+	return &logging.ConnectionTracer{
+		ClosedConnection: func(error) {
+			l.active.Add(-1)
+			if mc, ok := l.metrics.(*metrics.Collector); ok {
+				mc.DecrementQUICActive()
+			}
+		},
+	}
+}
+
+// QUICConnections returns the open HTTP/3 connections and how many were
+// refused by the limit
+func (s *Server) QUICConnections() (active int64, rejected uint64) {
+	return s.quic.active.Load(), s.quic.rejected.Load()
+}
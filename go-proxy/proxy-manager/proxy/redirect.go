@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RedirectScheme marks a backend URL as a redirect target, e.g.
+// redirect://https://new.example.com. Such routes never dial an upstream.
+const RedirectScheme = "redirect://"
+
+// Redirect answers a route's requests with a redirect to Target
+type Redirect struct {
+	Target       *url.URL
+	Status       int  // 301 (default), 302, 307 or 308
+	PreservePath bool // Append the request path and query to Target, default true
+	StripPrefix  bool // Drop the route path before appending the request path
+}
+
+// redirectOption builds the route's redirect from a redirect:// backend URL
+// or the "redirect" option, with the redirect_status, redirect_preserve_path
+// and redirect_strip_prefix options. It returns nil for a proxied route.
+func redirectOption(backendURL string, options map[string]interface{}) (*Redirect, error) {
+	raw, _ := options["redirect"].(string)
+	if strings.HasPrefix(backendURL, RedirectScheme) {
+		raw = strings.TrimPrefix(backendURL, RedirectScheme)
+	}
+	if raw == "" {
+		return nil, nil
+	}
+	target, err := url.Parse(raw)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid redirect target %q", raw)
+	}
+
+	rd := &Redirect{Target: target, Status: http.StatusMovedPermanently, PreservePath: true}
+	if v, ok := options["redirect_status"].(int); ok && v != 0 {
+		switch v {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+			rd.Status = v
+		default:
+			return nil, fmt.Errorf("redirect_status must be 301, 302, 307 or 308, got %d", v)
+		}
+	}
+	if v, ok := options["redirect_preserve_path"].(bool); ok {
+		rd.PreservePath = v
+	}
+	if v, ok := options["redirect_strip_prefix"].(bool); ok {
+		rd.StripPrefix = v
+	}
+	return rd, nil
+}
+
+// backendURL is the pseudo URL shown for the route's backend
+func (rd *Redirect) backendURL() *url.URL {
+	return &url.URL{Scheme: "redirect", Opaque: "//" + rd.Target.String()}
+}
+
+// location returns the redirect URL for r on a route with routePath
+func (rd *Redirect) location(r *http.Request, routePath string) string {
+	u := *rd.Target
+	if !rd.PreservePath {
+		return u.String()
+	}
+	path := r.URL.Path
+	if rd.StripPrefix && routePath != "/" {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(routePath, "/"))
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+	u.Path = strings.TrimSuffix(rd.Target.Path, "/") + path
+	u.RawPath = ""
+	if r.URL.RawQuery != "" {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += r.URL.RawQuery
+	}
+	return u.String()
+}
+
+// serveRedirect answers r with the route's redirect
+func (s *Server) serveRedirect(w http.ResponseWriter, r *http.Request, route *Route) {
+	http.Redirect(w, r, route.Redirect.location(r, route.Path), route.Redirect.Status)
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/chilla55/proxy-manager/tracing"
+	"github.com/rs/zerolog/log"
+)
+
+// errResponseTooLarge aborts an upstream response over max_response_body
+var errResponseTooLarge = errors.New("upstream response exceeds max_response_body")
+
+// limitResponseBody enforces the backend's max_response_body. A response
+// announcing a larger Content-Length is refused before anything is sent, so
+// the client gets a 502. Without a length the body streams until it passes
+// the limit and the response is then cut off, as its headers are already
+// out. A limit of 0 leaves responses alone.
+func (b *Backend) limitResponseBody(res *http.Response) error {
+	if b.maxResponseBody <= 0 || res.StatusCode == http.StatusSwitchingProtocols {
+		return nil
+	}
+	if res.ContentLength > b.maxResponseBody {
+		return fmt.Errorf("%w: %d bytes, limit %d", errResponseTooLarge, res.ContentLength, b.maxResponseBody)
+	}
+	if res.ContentLength < 0 {
+		res.Body = &limitedResponseBody{ReadCloser: res.Body, req: res.Request, remaining: b.maxResponseBody}
+	}
+	return nil
+}
+
+// limitedResponseBody fails reads once more than its limit has been read
+type limitedResponseBody struct {
+	io.ReadCloser
+	req       *http.Request
+	remaining int64
+}
+
+func (l *limitedResponseBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, errResponseTooLarge
+	}
+	// Read one byte past the limit to tell "exactly at" from "over"
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		logResponseTooLarge(l.req, errResponseTooLarge)
+		return n + int(l.remaining), errResponseTooLarge
+	}
+	return n, err
+}
+
+func logResponseTooLarge(req *http.Request, err error) {
+	event := log.Warn().Err(err)
+	if req != nil {
+		event = event.Str("host", req.Host).Str("path", req.URL.Path).Str("request_id", tracing.GetRequestIDFromRequest(req))
+	}
+	event.Msg("Upstream response too large")
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultValidationMaxBody bounds the body buffered for a JSON check
+const defaultValidationMaxBody = 1 << 20
+
+// responseValidator checks successful upstream responses against what the
+// route expects, so a backend answering 200 with an HTML error page counts
+// as failing. The Content-Type is checked on every response; the JSON check
+// buffers the body and is sampled.
+type responseValidator struct {
+	contentType string  // Required Content-Type prefix, "" for any
+	validJSON   bool    // The body must parse as JSON
+	percent     float64 // Share of responses whose JSON is checked
+	maxBody     int64   // Larger bodies are not checked
+	failures    atomic.Uint64
+}
+
+// newResponseValidator reads the response_validation option: content_type,
+// valid_json, sample_percent (default 10) and max_body. It returns nil when
+// nothing is to be checked.
+func newResponseValidator(opts map[string]interface{}) *responseValidator {
+	v := &responseValidator{percent: 10, maxBody: defaultValidationMaxBody}
+	v.contentType, _ = opts["content_type"].(string)
+	v.validJSON, _ = opts["valid_json"].(bool)
+	if p, ok := opts["sample_percent"].(float64); ok && p > 0 && p <= 100 {
+		v.percent = p
+	}
+	if n, ok := opts["max_body"].(int64); ok && n > 0 {
+		v.maxBody = n
+	}
+	if v.contentType == "" && !v.validJSON {
+		return nil
+	}
+	return v
+}
+
+// check returns why res fails validation, "" when it passes or was not
+// checked. Only 2xx responses with a body are checked; errors are already a
+// failure signal. A body read for the JSON check is put back for the client.
+func (v *responseValidator) check(res *http.Response) string {
+	if res.StatusCode < 200 || res.StatusCode >= 300 || res.StatusCode == http.StatusNoContent ||
+		(res.Request != nil && res.Request.Method == http.MethodHead) {
+		return ""
+	}
+	if v.contentType != "" {
+		ct := res.Header.Get("Content-Type")
+		if !strings.HasPrefix(strings.ToLower(ct), strings.ToLower(v.contentType)) {
+			return fmt.Sprintf("content type %q, expected %s", ct, v.contentType)
+		}
+	}
+
+	if !v.validJSON || res.ContentLength > v.maxBody || (v.percent < 100 && rand.Float64()*100 >= v.percent) {
+		return ""
+	}
+	// A compressed body would need decoding first
+	if enc := res.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return ""
+	}
+	buf, err := io.ReadAll(io.LimitReader(res.Body, v.maxBody+1))
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), res.Body), res.Body}
+	if err != nil || int64(len(buf)) > v.maxBody {
+		return ""
+	}
+	if !json.Valid(buf) {
+		return "body is not valid JSON"
+	}
+	return ""
+}
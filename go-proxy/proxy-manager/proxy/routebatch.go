@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RouteRef names a registry route to remove by its domains, path and
+// request predicates, as RemoveRouteMatch does
+type RouteRef struct {
+	Domains []string
+	Path    string
+	Match   RouteMatch
+}
+
+// RouteSpec is a registry route to add, with the arguments of AddRoute
+type RouteSpec struct {
+	Domains    []string
+	Path       string
+	BackendURL string
+	Headers    map[string]string
+	WebSocket  bool
+	Options    map[string]interface{}
+}
+
+// RouteBatchError reports the route of a batch that could not be built
+type RouteBatchError struct {
+	Index int // Position in the added routes
+	Err   error
+}
+
+func (e *RouteBatchError) Error() string {
+	return fmt.Sprintf("route %d: %s", e.Index, e.Err)
+}
+
+func (e *RouteBatchError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyRoutes removes and then adds registry routes under one write lock,
+// resolving precedence once for the whole batch rather than per route, so a
+// large apply stalls request handling only once. Every added route is built
+// before anything changes: if one is invalid, a *RouteBatchError names it
+// and no route is removed or added.
+func (s *Server) ApplyRoutes(remove []RouteRef, add []RouteSpec) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The removed routes' backends are only shared with the added ones when
+	// their options are unchanged, as in ReplaceRoute
+	removed := func(r *Route) bool {
+		if r.Source != SourceRegistry {
+			return false
+		}
+		for _, ref := range remove {
+			if s.routeMatches(r, ref.Domains, ref.Path) && r.Match.Key() == ref.Match.Key() {
+				return true
+			}
+		}
+		return false
+	}
+
+	routes := make([]*Route, 0, len(add))
+	for i, spec := range add {
+		route, err := s.newRoute(SourceRegistry, spec.Domains, spec.Path, spec.BackendURL, spec.Headers, spec.WebSocket, spec.Options, removed)
+		if err != nil {
+			return &RouteBatchError{Index: i, Err: err}
+		}
+		routes = append(routes, route)
+	}
+
+	for _, route := range routes {
+		s.carryBackendState(SourceRegistry, route)
+	}
+	for _, ref := range remove {
+		key := ref.Match.Key()
+		s.dropRoutes(SourceRegistry, func(r *Route) bool { return s.routeMatches(r, ref.Domains, ref.Path) && r.Match.Key() == key })
+	}
+	s.routes = append(s.routes, routes...)
+	s.applyPrecedence()
+
+	if s.debug {
+		log.Debug().Int("removed", len(remove)).Int("added", len(add)).Msg("Applied route batch")
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ServiceLimits caps one registered service across all of its routes.
+// Zero values mean unlimited.
+type ServiceLimits struct {
+	MaxConnections int   `json:"max_connections"`
+	BytesPerSecond int64 `json:"bytes_per_second"` // Response bandwidth
+}
+
+// ServiceUsage reports a service's limits and how much of them it uses
+type ServiceUsage struct {
+	ServiceLimits
+	ActiveConnections   int64  `json:"active_connections"`
+	BytesSent           uint64 `json:"bytes_sent"`
+	RejectedConnections uint64 `json:"rejected_connections"` // Answered 503
+	RejectedBandwidth   uint64 `json:"rejected_bandwidth"`   // Answered 429
+}
+
+// serviceLimiter enforces ServiceLimits. Bandwidth is a token bucket holding
+// one second of traffic; responses are charged as they are written, so a
+// large response may overdraw it and later requests get 429 until it refills.
+type serviceLimiter struct {
+	mu         sync.Mutex
+	limits     ServiceLimits
+	tokens     float64
+	lastRefill time.Time
+
+	active              atomic.Int64
+	bytesSent           atomic.Uint64
+	rejectedConnections atomic.Uint64
+	rejectedBandwidth   atomic.Uint64
+}
+
+// SetServiceLimits sets the limits for the routes whose service_limit_key
+// option is key. Counters survive updates; zero limits remove the entry.
+func (s *Server) SetServiceLimits(key string, limits ServiceLimits) {
+	s.limitsMu.Lock()
+	defer s.limitsMu.Unlock()
+
+	if limits.MaxConnections <= 0 && limits.BytesPerSecond <= 0 {
+		delete(s.serviceLimits, key)
+		return
+	}
+	l, ok := s.serviceLimits[key]
+	if !ok {
+		l = &serviceLimiter{tokens: float64(limits.BytesPerSecond), lastRefill: time.Now()}
+		s.serviceLimits[key] = l
+	}
+	l.mu.Lock()
+	l.limits = limits
+	if l.tokens > float64(limits.BytesPerSecond) {
+		l.tokens = float64(limits.BytesPerSecond)
+	}
+	l.mu.Unlock()
+}
+
+// ServiceUsage returns the usage for key, false when it has no limits
+func (s *Server) ServiceUsage(key string) (ServiceUsage, bool) {
+	l := s.serviceLimiter(key)
+	if l == nil {
+		return ServiceUsage{}, false
+	}
+	l.mu.Lock()
+	limits := l.limits
+	l.mu.Unlock()
+	return ServiceUsage{
+		ServiceLimits:       limits,
+		ActiveConnections:   l.active.Load(),
+		BytesSent:           l.bytesSent.Load(),
+		RejectedConnections: l.rejectedConnections.Load(),
+		RejectedBandwidth:   l.rejectedBandwidth.Load(),
+	}, true
+}
+
+func (s *Server) serviceLimiter(key string) *serviceLimiter {
+	if key == "" {
+		return nil
+	}
+	s.limitsMu.RLock()
+	defer s.limitsMu.RUnlock()
+	return s.serviceLimits[key]
+}
+
+// admit takes a connection slot, or answers 503 or 429 and returns false.
+// The caller must call release after an admitted request.
+func (l *serviceLimiter) admit(w http.ResponseWriter) bool {
+	l.mu.Lock()
+	limits := l.limits
+	l.refillLocked(time.Now())
+	overBandwidth := limits.BytesPerSecond > 0 && l.tokens <= 0
+	l.mu.Unlock()
+
+	if overBandwidth {
+		l.rejectedBandwidth.Add(1)
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return false
+	}
+	if n := l.active.Add(1); limits.MaxConnections > 0 && n > int64(limits.MaxConnections) {
+		l.active.Add(-1)
+		l.rejectedConnections.Add(1)
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+func (l *serviceLimiter) release() {
+	l.active.Add(-1)
+}
+
+// charge counts n bytes sent against the bandwidth limit
+func (l *serviceLimiter) charge(n int) {
+	if n <= 0 {
+		return
+	}
+	l.bytesSent.Add(uint64(n))
+	l.mu.Lock()
+	if l.limits.BytesPerSecond > 0 {
+		l.refillLocked(time.Now())
+		l.tokens -= float64(n)
+	}
+	l.mu.Unlock()
+}
+
+func (l *serviceLimiter) refillLocked(now time.Time) {
+	rate := float64(l.limits.BytesPerSecond)
+	l.tokens += now.Sub(l.lastRefill).Seconds() * rate
+	if l.tokens > rate {
+		l.tokens = rate
+	}
+	l.lastRefill = now
+}
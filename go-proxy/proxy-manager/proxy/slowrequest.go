@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Slow request threshold modes
+const (
+	SlowModeFixed    = "fixed"    // warning and critical are set durations
+	SlowModeAdaptive = "adaptive" // multiples of the backend's recent p95 and p99
+)
+
+const (
+	latencyWindow     = 512 // Recent durations kept per backend
+	latencyMinSamples = 50  // Fewer than this and the fixed thresholds apply
+	latencyRecompute  = 32  // Requests between percentile updates
+)
+
+// latencyTracker keeps a backend's recent request durations and their p95
+// and p99. The percentiles are refreshed every latencyRecompute requests
+// rather than on each one.
+type latencyTracker struct {
+	mu       sync.Mutex
+	samples  [latencyWindow]time.Duration
+	next     int
+	count    int
+	pending  int
+	p95, p99 time.Duration
+	ready    bool
+}
+
+func (t *latencyTracker) observe(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples[t.next] = d
+	t.next = (t.next + 1) % latencyWindow
+	if t.count < latencyWindow {
+		t.count++
+	}
+	t.pending++
+	if t.count < latencyMinSamples || t.pending < latencyRecompute {
+		return
+	}
+	t.pending = 0
+	sorted := make([]time.Duration, t.count)
+	copy(sorted, t.samples[:t.count])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	t.p95 = sorted[(t.count-1)*95/100]
+	t.p99 = sorted[(t.count-1)*99/100]
+	t.ready = true
+}
+
+// percentiles returns p95 and p99, ok false until enough requests were seen
+func (t *latencyTracker) percentiles() (p95, p99 time.Duration, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.p95, t.p99, t.ready
+}
+
+// slowThresholds returns the warning and critical durations a request is
+// held against. In adaptive mode they are the backend's p95 and p99 times
+// slowMultiplier, with the fixed ones as fallback while it warms up.
+func (b *Backend) slowThresholds() (warning, critical time.Duration, adaptive bool) {
+	if b.latency != nil {
+		if p95, p99, ok := b.latency.percentiles(); ok {
+			scale := func(d time.Duration) time.Duration {
+				return time.Duration(float64(d) * b.slowMultiplier)
+			}
+			return scale(p95), scale(p99), true
+		}
+	}
+	return b.slowWarning, b.slowCritical, false
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+)
+
+// UnixScheme marks a backend reached over a Unix domain socket, e.g.
+// unix:///run/app.sock. Requests are plain HTTP over the socket.
+const UnixScheme = "unix"
+
+// unixSocketHost is the host requests to a Unix socket backend are
+// addressed to; the socket has no host of its own
+const unixSocketHost = "localhost"
+
+// unixSocketPath returns the socket of a unix:// backend URL, "" for any
+// other URL
+func unixSocketPath(u *url.URL) string {
+	if u == nil || u.Scheme != UnixScheme {
+		return ""
+	}
+	return u.Path
+}
+
+// checkUnixSocket reports a socket path that does not exist or is not a
+// socket
+func checkUnixSocket(path string) error {
+	if path == "" {
+		return fmt.Errorf("unix backend URL has no socket path")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("unix socket: %w", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("unix socket: %s is not a socket", path)
+	}
+	return nil
+}
+
+// unixDialContext dials the socket at path whatever address the transport
+// asks for
+func unixDialContext(dialer *net.Dialer, path string) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", path)
+	}
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// dialFunc is the signature of http.Transport.DialContext
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// agedConn is an upstream connection that knows when it was dialed
+type agedConn struct {
+	net.Conn
+	dialed time.Time
+}
+
+// tuneUpstreamDial wraps dial to apply the TCP_NODELAY setting and, with a
+// max age, to record when each connection was dialed
+func tuneUpstreamDial(dial dialFunc, noDelay bool, maxAge time.Duration) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		// Go enables TCP_NODELAY on every TCP connection, so only turning
+		// it off needs doing
+		if tc, ok := conn.(*net.TCPConn); ok && !noDelay {
+			tc.SetNoDelay(false)
+		}
+		if maxAge > 0 {
+			conn = &agedConn{Conn: conn, dialed: time.Now()}
+		}
+		return conn, nil
+	}
+}
+
+// maxAgeTransport retires upstream connections older than maxAge, so they
+// are replaced before a load balancer in front of the backend drops them.
+// http.Transport has no lifetime limit; an expired connection is closed
+// once the response using it is done, never in the middle of one.
+type maxAgeTransport struct {
+	base   http.RoundTripper
+	maxAge time.Duration
+}
+
+func newMaxAgeTransport(base http.RoundTripper, maxAge time.Duration) http.RoundTripper {
+	return &maxAgeTransport{base: base, maxAge: maxAge}
+}
+
+func (t *maxAgeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var conn *agedConn
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			c := info.Conn
+			if tc, ok := c.(*tls.Conn); ok {
+				c = tc.NetConn()
+			}
+			conn, _ = c.(*agedConn)
+		},
+	}
+	resp, err := t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	// An upgraded connection belongs to the caller from here on
+	if err != nil || conn == nil || resp.StatusCode == http.StatusSwitchingProtocols ||
+		time.Since(conn.dialed) < t.maxAge {
+		return resp, err
+	}
+	resp.Body = &retiringBody{ReadCloser: resp.Body, conn: conn}
+	return resp, nil
+}
+
+// retiringBody closes its expired connection with the response body
+type retiringBody struct {
+	io.ReadCloser
+	conn net.Conn
+}
+
+func (b *retiringBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.conn.Close()
+	return err
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/chilla55/proxy-manager/metrics"
+)
+
+// upstreamTimer measures the connect, TLS handshake and time to first byte
+// of a proxied request. With retries every attempt starts over, so the
+// timing is that of the attempt that produced the response.
+type upstreamTimer struct {
+	mu           sync.Mutex
+	start        time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	timing       metrics.UpstreamTiming
+}
+
+// withUpstreamTimer returns ctx with a trace that feeds a new upstreamTimer.
+// It composes with traces added further down, such as maxAgeTransport's.
+func withUpstreamTimer(ctx context.Context) (context.Context, *upstreamTimer) {
+	t := &upstreamTimer{}
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.start = time.Now()
+			t.connectStart, t.tlsStart = time.Time{}, time.Time{}
+			t.timing = metrics.UpstreamTiming{}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timing.Reused = info.Reused
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			// Dual-stack dialing may start several connects; time from the first
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if err == nil && !t.connectStart.IsZero() {
+				t.timing.Connect = time.Since(t.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if err == nil && !t.tlsStart.IsZero() {
+				t.timing.TLS = time.Since(t.tlsStart)
+			}
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if !t.start.IsZero() {
+				t.timing.TTFB = time.Since(t.start)
+			}
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), t
+}
+
+// finish returns the recorded timing with total, the time until the
+// response was copied to the client
+func (t *upstreamTimer) finish(total time.Duration) metrics.UpstreamTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timing := t.timing
+	timing.Total = total
+	return timing
+}
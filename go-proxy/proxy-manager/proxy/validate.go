@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RouteValidation is the result of ValidateRoute
+type RouteValidation struct {
+	Valid      bool     `json:"valid"`
+	Errors     []string `json:"errors,omitempty"`
+	Probed     bool     `json:"probed"`
+	Reachable  bool     `json:"reachable"`
+	Status     int      `json:"status,omitempty"`
+	LatencyMs  int64    `json:"latency_ms,omitempty"`
+	ProbeError string   `json:"probe_error,omitempty"`
+}
+
+// Error joins the problems found, "" for a valid route
+func (v RouteValidation) Error() string {
+	problems := append([]string(nil), v.Errors...)
+	if v.Probed && !v.Reachable {
+		problems = append(problems, "backend unreachable: "+v.ProbeError)
+	}
+	return strings.Join(problems, "; ")
+}
+
+// durationOptions are the options read as time.Duration; nested ones are
+// given as "map.key"
+var durationOptions = []string{
+	"timeout", "request_timeout", "maintenance_retry_after", "drain_retry_after", "disabled_retry_after", "mirror_timeout",
+	"backend_rate_window",
+	"pool.idle_timeout", "pool.keep_alive", "pool.max_conn_age",
+	"slow_request.warning", "slow_request.critical", "slow_request.timeout",
+	"retry.initial_delay", "retry.max_delay",
+	"websocket.max_duration", "websocket.idle_timeout", "websocket.ping_interval",
+	"circuit_breaker.timeout", "circuit_breaker.window",
+}
+
+// defaultProbeTimeout bounds the reachability probe unless timeout is set
+const defaultProbeTimeout = 5 * time.Second
+
+// ValidateRoute checks a route the way AddRoute would build it, without
+// registering it. Option values of the wrong type, which AddRoute ignores,
+// are reported. With probe set the backend's health path is requested once;
+// any HTTP response counts as reachable.
+func (s *Server) ValidateRoute(domains []string, path, backendURL string, options map[string]interface{}, probe bool) RouteValidation {
+	var result RouteValidation
+	fail := func(format string, args ...interface{}) {
+		result.Errors = append(result.Errors, fmt.Sprintf(format, args...))
+	}
+
+	if len(domains) == 0 {
+		fail("no domains specified")
+	}
+	if !strings.HasPrefix(path, "/") {
+		fail("path must start with /")
+	}
+
+	redirectTo, _ := options["redirect"].(string)
+	isRedirect := redirectTo != "" || strings.HasPrefix(backendURL, RedirectScheme)
+	if _, err := redirectOption(backendURL, options); err != nil {
+		fail("%s", err)
+	}
+	var target *url.URL
+	if !isRedirect {
+		var err error
+		target, err = url.Parse(backendURL)
+		switch {
+		case err == nil && target.Scheme == UnixScheme:
+			if err := checkUnixSocket(target.Path); err != nil {
+				fail("%s", err)
+				target = nil
+			}
+		case err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "":
+			fail("invalid backend URL %q", backendURL)
+			target = nil
+		}
+	}
+
+	if _, err := routeMatchOption(options); err != nil {
+		fail("%s", err)
+	}
+	canonicalHost, _ := options["canonical_host"].(string)
+	if err := ValidCanonicalHost(canonicalHost); err != nil {
+		fail("%s", err)
+	}
+	if v, ok := options["mirror_backend"].(string); ok && v != "" {
+		if _, err := newMirror(v, options); err != nil {
+			fail("%s", err)
+		}
+	}
+	if v, ok := options["maintenance_template"].(string); ok && v != "" {
+		if _, err := loadMaintenanceTemplate(v); err != nil {
+			fail("%s", err)
+		}
+	}
+	for _, name := range durationOptions {
+		if err := checkDurationOption(options, name); err != nil {
+			fail("%s", err)
+		}
+	}
+
+	if probe && target != nil {
+		result.Probed = true
+		probeBackend(&result, target, options)
+	}
+
+	result.Valid = len(result.Errors) == 0 && (!result.Probed || result.Reachable)
+	return result
+}
+
+// checkDurationOption reports a present option that is not a time.Duration
+func checkDurationOption(options map[string]interface{}, name string) error {
+	key := name
+	values := options
+	if group, field, nested := strings.Cut(name, "."); nested {
+		// e.g. websocket is a plain bool when set through the registry
+		values, _ = options[group].(map[string]interface{})
+		key = field
+	}
+	v, found := values[key]
+	if !found || v == nil {
+		return nil
+	}
+	switch d := v.(type) {
+	case time.Duration:
+		return nil
+	case string:
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("%s: invalid duration %q", name, d)
+		}
+		return fmt.Errorf("%s: expected a duration, got the string %q", name, d)
+	default:
+		return fmt.Errorf("%s: expected a duration, got %T", name, v)
+	}
+}
+
+// probeBackend requests the backend's health path once
+func probeBackend(result *RouteValidation, target *url.URL, options map[string]interface{}) {
+	timeout := defaultProbeTimeout
+	if v, ok := options["timeout"].(time.Duration); ok && v > 0 && v < timeout {
+		timeout = v
+	}
+	healthPath, _ := options["health_check_path"].(string)
+	if healthPath == "" {
+		healthPath = "/"
+	}
+	client := &http.Client{
+		// A redirect still proves the backend answers
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	base := strings.TrimSuffix(target.String(), "/")
+	if socket := unixSocketPath(target); socket != "" {
+		base = "http://" + unixSocketHost
+		client.Transport = &http.Transport{DialContext: unixDialContext(&net.Dialer{}, socket)}
+	}
+	probeURL := base + "/" + strings.TrimPrefix(healthPath, "/")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+	if err != nil {
+		result.ProbeError = err.Error()
+		return
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.ProbeError = err.Error()
+		return
+	}
+	resp.Body.Close()
+	result.Reachable = true
+	result.Status = resp.StatusCode
+}
@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
+
+	"github.com/chilla55/proxy-manager/proxy"
 )
 
 // Config holds rate limiting configuration
@@ -97,7 +99,7 @@ func (l *Limiter) Middleware(route string) func(http.Handler) http.Handler {
 				return
 			}
 
-			ip := extractIP(r)
+			ip := proxy.ClientIP(r)
 
 			// Check whitelist
 			if l.isWhitelisted(ip) {
@@ -316,24 +318,3 @@ func filterExpired(timestamps []time.Time, cutoff time.Time) []time.Time {
 	}
 	return result
 }
-
-// extractIP extracts the client IP from the request
-func extractIP(r *http.Request) string {
-	// Check X-Real-IP first (from our proxy)
-	if ip := r.Header.Get("X-Real-IP"); ip != "" {
-		return ip
-	}
-
-	// Check X-Forwarded-For
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// Take the first IP in the chain
-		parts := strings.Split(xff, ",")
-		if len(parts) > 0 {
-			return strings.TrimSpace(parts[0])
-		}
-	}
-
-	// Fall back to RemoteAddr
-	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-	return ip
-}
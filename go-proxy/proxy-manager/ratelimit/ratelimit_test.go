@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/chilla55/proxy-manager/proxy"
 )
 
 type mockDB struct{}
@@ -50,6 +52,14 @@ func TestAllowHourlyLimit(t *testing.T) {
 }
 
 func TestMiddlewareWithXFF(t *testing.T) {
+	// httptest requests come from 192.0.2.1; trust it so XFF is honored
+	trusted, err := proxy.ParseTrustedProxies([]string{"192.0.2.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy.SetTrustedProxies(trusted)
+	defer proxy.SetTrustedProxies(nil)
+
 	cfg := Config{Enabled: true, RequestsPerMin: 2, RequestsPerHour: 100}
 	l := NewLimiter(cfg, &mockDB{})
 
@@ -93,7 +103,7 @@ func TestWhitelistCIDR(t *testing.T) {
 	mw := l.Middleware("/wl")(next)
 
 	req := httptest.NewRequest("GET", "/wl", nil)
-	req.Header.Set("X-Forwarded-For", "203.0.113.42")
+	req.RemoteAddr = "203.0.113.42:40000"
 	for i := 0; i < 5; i++ {
 		rec := httptest.NewRecorder()
 		mw.ServeHTTP(rec, req)
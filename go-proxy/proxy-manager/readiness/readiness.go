@@ -0,0 +1,89 @@
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds a single readiness evaluation
+const checkTimeout = 2 * time.Second
+
+// Check reports whether a subsystem is ready; a nil error means ready
+type Check func(ctx context.Context) error
+
+// State is the readiness of one subsystem
+type State struct {
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the readiness of every registered subsystem
+type Report struct {
+	Ready      bool             `json:"ready"`
+	Subsystems map[string]State `json:"subsystems"`
+}
+
+// Checker evaluates the registered subsystem checks. Checks run on every
+// request, so a subsystem that fails later (e.g. the DB going away) takes
+// the instance out of rotation again.
+type Checker struct {
+	mu     sync.RWMutex
+	names  []string
+	checks map[string]Check
+}
+
+// New creates an empty readiness checker
+func New() *Checker {
+	return &Checker{checks: make(map[string]Check)}
+}
+
+// Add registers a critical subsystem check, replacing any with the same name
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Check runs every registered check. With no checks registered the
+// instance is not ready, so a miswired startup never reports ready.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.RLock()
+	names := append([]string(nil), c.names...)
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.RUnlock()
+
+	report := Report{Ready: len(names) > 0, Subsystems: make(map[string]State, len(names))}
+	for _, name := range names {
+		state := State{Ready: true}
+		if err := checks[name](ctx); err != nil {
+			state = State{Error: err.Error()}
+			report.Ready = false
+		}
+		report.Subsystems[name] = state
+	}
+	return report
+}
+
+// ServeHTTP answers 200 when every subsystem is ready and 503 otherwise,
+// with the per-subsystem states as JSON
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+	report := c.Check(ctx)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !report.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
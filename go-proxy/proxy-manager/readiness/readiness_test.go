@@ -0,0 +1,51 @@
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckerReportsEachSubsystem(t *testing.T) {
+	c := New()
+
+	rr := httptest.NewRecorder()
+	c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 with no checks registered, got %d", rr.Code)
+	}
+
+	dbErr := errors.New("database is locked")
+	c.Add("certificates", func(context.Context) error { return nil })
+	c.Add("database", func(context.Context) error { return dbErr })
+
+	rr = httptest.NewRecorder()
+	c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while database is failing, got %d", rr.Code)
+	}
+	var report Report
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON body: %v", err)
+	}
+	if report.Ready || !report.Subsystems["certificates"].Ready {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if s := report.Subsystems["database"]; s.Ready || s.Error != dbErr.Error() {
+		t.Fatalf("expected database error in report, got %+v", s)
+	}
+
+	dbErr = nil
+	c.Add("database", func(context.Context) error { return dbErr })
+	rr = httptest.NewRecorder()
+	c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 once all subsystems are ready, got %d", rr.Code)
+	}
+	if report := c.Check(context.Background()); !report.Ready || len(report.Subsystems) != 2 {
+		t.Fatalf("expected 2 ready subsystems, got %+v", report)
+	}
+}
@@ -0,0 +1,79 @@
+package registry
+
+import (
+	"time"
+)
+
+// DefaultApplyBurst is how many CONFIG_APPLYs a session may send back to back
+const DefaultApplyBurst = 10
+
+// DefaultApplyRate is how many CONFIG_APPLYs per second a session may send
+// once its burst is used up
+const DefaultApplyRate = 2.0
+
+// DefaultApplyQueue bounds the applies running or waiting across all
+// sessions. Applies run one at a time; beyond this they are refused.
+const DefaultApplyQueue = 32
+
+// applyBucket is a session's token bucket for config applies
+type applyBucket struct {
+	tokens   float64
+	refilled time.Time
+}
+
+// SetApplyLimit sets the per-session apply rate and burst and the number of
+// applies that may queue across sessions. Values <= 0 keep the defaults.
+// Call before StartV2.
+func (r *RegistryV2) SetApplyLimit(rate float64, burst, queue int) {
+	if rate <= 0 {
+		rate = DefaultApplyRate
+	}
+	if burst <= 0 {
+		burst = DefaultApplyBurst
+	}
+	if queue <= 0 {
+		queue = DefaultApplyQueue
+	}
+	r.applyRate = rate
+	r.applyBurst = burst
+	r.applyQueue = make(chan struct{}, queue)
+}
+
+// admitApply lets an apply of svc proceed once it is the only one running.
+// It is refused with RATE_LIMITED when the session applies faster than the
+// apply rate allows or the apply queue is full. The returned func ends the
+// apply; call it after the proxy is updated. Do not hold svc.mu.
+func (r *RegistryV2) admitApply(svc *ServiceV2) (func(), *ProtocolError) {
+	now := time.Now()
+	svc.mu.Lock()
+	bucket := &svc.applyBucket
+	if bucket.refilled.IsZero() {
+		bucket.tokens = float64(r.applyBurst)
+	} else {
+		bucket.tokens += now.Sub(bucket.refilled).Seconds() * r.applyRate
+		if bucket.tokens > float64(r.applyBurst) {
+			bucket.tokens = float64(r.applyBurst)
+		}
+	}
+	bucket.refilled = now
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / r.applyRate * float64(time.Second))
+		svc.mu.Unlock()
+		r.metrics.applyLimited.Add(1)
+		return nil, &ProtocolError{Code: ErrCodeRateLimited, Message: "applying too often, retry in " + wait.Round(time.Millisecond).String()}
+	}
+	bucket.tokens--
+	svc.mu.Unlock()
+
+	select {
+	case r.applyQueue <- struct{}{}:
+	default:
+		r.metrics.applyLimited.Add(1)
+		return nil, &ProtocolError{Code: ErrCodeRateLimited, Message: "too many config applies queued, retry"}
+	}
+	r.applyMu.Lock()
+	return func() {
+		r.applyMu.Unlock()
+		<-r.applyQueue
+	}, nil
+}
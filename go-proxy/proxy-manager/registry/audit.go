@@ -0,0 +1,73 @@
+package registry
+
+import (
+	"net"
+	"strings"
+
+	"github.com/chilla55/proxy-manager/audit"
+)
+
+// auditSpec describes how a control command is recorded: the kind of
+// resource its first argument names ("" for the session itself) and the
+// names of its arguments after the session ID
+type auditSpec struct {
+	resourceType string
+	args         []string
+}
+
+// auditedCommands are the control commands recorded in the audit log. Route
+// registration is the normal service lifecycle and is not audited.
+var auditedCommands = map[string]auditSpec{
+	"CIRCUIT_BREAKER_SET":   {"route", []string{"route_id", "threshold", "timeout", "half_open_requests"}},
+	"CIRCUIT_BREAKER_RESET": {"route", []string{"route_id"}},
+	"CIRCUIT_BREAKER_FORCE": {"route", []string{"route_id", "mode"}},
+	"CONFIG_APPLY":          {"", nil},
+	"CONFIG_APPLY_PARTIAL":  {"", []string{"scope"}},
+	"CONFIG_ROLLBACK":       {"", nil},
+	"DRAIN_START":           {"", []string{"duration"}},
+	"DRAIN_CANCEL":          {"", nil},
+	"MAINT_ENTER":           {"maintenance", []string{"target", "maintenance_page_url", "eta", "reason"}},
+	"MAINT_EXIT":            {"maintenance", []string{"target"}},
+	"MAINT_SCHEDULE":        {"maintenance", []string{"target", "start", "end", "maintenance_page_url"}},
+	"MAINT_SCHEDULE_CANCEL": {"maintenance", []string{"schedule_id"}},
+}
+
+// auditCommand records a control command. The principal is the session's
+// service; the session ID is left out as it works as a credential.
+// errorCode is the ERROR code replied, "" when the command was accepted.
+func (r *RegistryV2) auditCommand(svc *ServiceV2, conn net.Conn, parts []string, spec auditSpec, errorCode string) {
+	if r.audit == nil {
+		return
+	}
+	entry := audit.AuditEntry{
+		User:         "service",
+		Action:       strings.ToLower(parts[0]),
+		ResourceType: spec.resourceType,
+		Result:       audit.ResultOK,
+	}
+	if svc != nil {
+		entry.User = "service:" + svc.ServiceName + "/" + svc.InstanceName
+	}
+	if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		entry.IPAddress = host
+	}
+	if errorCode != "" {
+		entry.Result = "error: " + errorCode
+	}
+
+	params := make(map[string]string)
+	for i, name := range spec.args {
+		if i+2 < len(parts) {
+			params[name] = parts[i+2]
+		}
+	}
+	if spec.resourceType == "" {
+		entry.ResourceType = "session"
+		entry.ResourceID = entry.User
+	} else {
+		entry.ResourceID = params[spec.args[0]]
+		delete(params, spec.args[0])
+	}
+	entry.Metadata = audit.Params(params)
+	r.audit.Record(entry)
+}
@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Error codes of ERROR|code|message replies. The code tells a client what to
+// do about it; the message is for humans and may change.
+const (
+	ErrCodeInvalidFormat   = "INVALID_FORMAT"    // Malformed command, JSON or frame; fix the client
+	ErrCodeUnknownCommand  = "UNKNOWN_COMMAND"   // Not a command of this server
+	ErrCodeUnsupported     = "UNSUPPORTED"       // Protocol version or option the server doesn't support
+	ErrCodePayloadTooLarge = "PAYLOAD_TOO_LARGE" // Line or frame over the size limit
+	ErrCodeSessionNotFound = "SESSION_NOT_FOUND" // Session expired or unknown; register again
+	ErrCodeRouteNotFound   = "ROUTE_NOT_FOUND"   // No route with that ID
+	ErrCodeNotFound        = "NOT_FOUND"         // Other missing state, e.g. no drain in progress
+	ErrCodeRouteConflict   = "ROUTE_CONFLICT"    // The same route given twice
+	ErrCodeInvalidValue    = "INVALID_VALUE"     // A value failed validation
+	ErrCodeApplyFailed     = "APPLY_FAILED"      // The proxy rejected a validated change
+	ErrCodeUnavailable     = "UNAVAILABLE"       // Temporarily unavailable; retry
+	ErrCodeTimeout         = "TIMEOUT"           // Gave up waiting; retry
+	ErrCodeRateLimited     = "RATE_LIMITED"      // Sent too often or the server is busy; retry later
+	ErrCodeUnknown         = "UNKNOWN"           // ERROR|message reply of an older server
+)
+
+// writeError sends ERROR|code|message
+func writeError(conn net.Conn, code, format string, args ...interface{}) {
+	conn.Write([]byte("ERROR|" + code + "|" + fmt.Sprintf(format, args...) + "\n"))
+}
+
+// ProtocolError is an ERROR reply
+type ProtocolError struct {
+	Code    string
+	Message string
+}
+
+func (e *ProtocolError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// ParseError reads an ERROR reply line, nil if line is not one. A reply
+// without a code, as sent before codes were added, gets ErrCodeUnknown.
+// Only this module uses it: registry-client v2.2.0 still hands the whole
+// ERROR line back inside a plain error string.
+func ParseError(line string) *ProtocolError {
+	rest, ok := strings.CutPrefix(strings.TrimRight(line, "\r\n"), "ERROR|")
+	if !ok {
+		return nil
+	}
+	if code, message, found := strings.Cut(rest, "|"); found && isErrorCode(code) {
+		return &ProtocolError{Code: code, Message: message}
+	}
+	return &ProtocolError{Code: ErrCodeUnknown, Message: rest}
+}
+
+// isErrorCode reports whether s looks like a code, e.g. SESSION_NOT_FOUND,
+// rather than the start of a message
+func isErrorCode(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if (c < 'A' || c > 'Z') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
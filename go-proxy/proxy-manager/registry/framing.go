@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// FeatureFraming is the HELLO feature that switches a connection to
+// length-prefixed JSON frames after HELLO_OK
+const FeatureFraming = "framing"
+
+// ErrFrameTooLarge is returned by DecodeFrame for frames over the size
+// limit. The frame is consumed, so the stream stays in sync.
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// ErrInvalidFrame is returned by DecodeFrame for frames that are not a JSON
+// Frame object
+var ErrInvalidFrame = errors.New("invalid frame")
+
+// Frame is one message in framed mode: a 4 byte big-endian length followed
+// by this object as JSON. Clients send Command and Args, which are the
+// fields of the text protocol line without the "|" separators. The server
+// answers with the reply's fields the same way, e.g. Command "ERROR" and
+// Args [code, message], and with Line, the reply as it would be in text mode.
+type Frame struct {
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Line    string   `json:"line,omitempty"`
+}
+
+// Parts returns the command and arguments as the text protocol would split them
+func (f Frame) Parts() []string {
+	return append([]string{f.Command}, f.Args...)
+}
+
+// replyFields is the number of fields of the replies with more than one
+// argument. Every other reply is a keyword with at most one value, often
+// JSON, so a "|" inside the last field stays part of it.
+var replyFields = map[string]int{
+	"ERROR":    3, // ERROR|code|message
+	"HELLO_OK": 3, // HELLO_OK|version|features
+}
+
+// replyFrame splits a reply line into its fields
+func replyFrame(line string) Frame {
+	n, ok := replyFields[line[:strings.IndexByte(line+"|", '|')]]
+	if !ok {
+		n = 2
+	}
+	parts := strings.SplitN(line, "|", n)
+	return Frame{Command: parts[0], Args: parts[1:], Line: line}
+}
+
+// EncodeFrame writes f to w with its length prefix
+func EncodeFrame(w io.Writer, f Frame) error {
+	payload, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	copy(buf[4:], payload)
+	_, err = w.Write(buf)
+	return err
+}
+
+// DecodeFrame reads one frame of at most max bytes from r
+func DecodeFrame(r io.Reader, max int) (Frame, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Frame{}, err
+	}
+	n := int64(binary.BigEndian.Uint32(header[:]))
+	if n > int64(max) {
+		if _, err := io.CopyN(io.Discard, r, n); err != nil {
+			return Frame{}, err
+		}
+		return Frame{}, ErrFrameTooLarge
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Frame{}, err
+	}
+	var f Frame
+	if err := json.Unmarshal(payload, &f); err != nil {
+		return Frame{}, fmt.Errorf("%w: %v", ErrInvalidFrame, err)
+	}
+	return f, nil
+}
+
+// framedConn sends each line the handlers write as a reply frame
+type framedConn struct {
+	net.Conn
+	mu      sync.Mutex
+	pending []byte
+}
+
+func (c *framedConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending = append(c.pending, p...)
+	for {
+		i := bytes.IndexByte(c.pending, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(c.pending[:i])
+		c.pending = c.pending[i+1:]
+		if err := EncodeFrame(c.Conn, replyFrame(line)); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,157 @@
+package registry
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// knownCommands bounds the cmd label; anything else is counted as "unknown"
+var knownCommands = map[string]bool{
+	"HELLO": true, "REGISTER": true, "RECONNECT": true, "PING": true, "SESSION_INFO": true,
+	"ROUTE_ADD": true, "ROUTE_ADD_BULK": true, "ROUTES_REPLACE": true, "ROUTE_UPDATE": true, "ROUTE_REMOVE": true, "ROUTE_LIST": true,
+	"HEADERS_SET": true, "HEADERS_REMOVE": true, "OPTIONS_SET": true, "OPTIONS_REMOVE": true,
+	"HEALTH_SET": true, "RATELIMIT_SET": true,
+	"CIRCUIT_BREAKER_SET": true, "CIRCUIT_BREAKER_STATUS": true, "CIRCUIT_BREAKER_RESET": true, "CIRCUIT_BREAKER_FORCE": true,
+	"CONFIG_VALIDATE": true, "CONFIG_APPLY": true, "CONFIG_ROLLBACK": true, "CONFIG_DIFF": true, "CONFIG_APPLY_PARTIAL": true,
+	"STATS_GET": true, "BACKEND_TEST": true, "BACKEND_TEST_BULK": true,
+	"DRAIN_START": true, "DRAIN_STATUS": true, "DRAIN_CANCEL": true,
+	"SUBSCRIBE": true, "UNSUBSCRIBE": true,
+	"MAINT_ENTER": true, "MAINT_EXIT": true, "MAINT_STATUS": true, "CLIENT_SHUTDOWN": true,
+}
+
+// registryMetrics counts protocol activity for /metrics
+type registryMetrics struct {
+	mu       sync.Mutex
+	commands map[string]uint64 // By command
+	errors   map[string]uint64 // ERROR replies by command
+
+	sessions      atomic.Uint64 // Successful REGISTERs
+	reconnects    atomic.Uint64 // Successful RECONNECTs
+	stagedExpired atomic.Uint64 // Staged configs dropped after stagedConfigTTL
+	idleClosed    atomic.Uint64 // Connections closed by the idle timeout
+	applyLimited  atomic.Uint64 // Config applies refused with RATE_LIMITED
+}
+
+func newRegistryMetrics() *registryMetrics {
+	return &registryMetrics{commands: make(map[string]uint64), errors: make(map[string]uint64)}
+}
+
+func commandLabel(command string) string {
+	if knownCommands[command] {
+		return command
+	}
+	return "unknown"
+}
+
+func (m *registryMetrics) recordCommand(cmd string) {
+	m.mu.Lock()
+	m.commands[cmd]++
+	m.mu.Unlock()
+}
+
+func (m *registryMetrics) recordError(cmd string) {
+	m.mu.Lock()
+	m.errors[cmd]++
+	m.mu.Unlock()
+}
+
+// replyCounter counts the ERROR replies written for the current command
+type replyCounter struct {
+	net.Conn
+	metrics   *registryMetrics
+	command   atomic.Value // string
+	errorCode atomic.Value // string, the current command's last ERROR code
+}
+
+func (c *replyCounter) Write(p []byte) (int, error) {
+	if rest, ok := bytes.CutPrefix(p, []byte("ERROR|")); ok {
+		cmd, _ := c.command.Load().(string)
+		if cmd == "" {
+			cmd = "unknown"
+		}
+		c.metrics.recordError(cmd)
+		code, _, _ := bytes.Cut(rest, []byte("|"))
+		c.errorCode.Store(string(code))
+	}
+	return c.Conn.Write(p)
+}
+
+// startCommand resets the per-command state for the next command
+func (c *replyCounter) startCommand(label string) {
+	c.command.Store(label)
+	c.errorCode.Store("")
+}
+
+// lastError returns the ERROR code replied to the current command, "" if none
+func (c *replyCounter) lastError() string {
+	code, _ := c.errorCode.Load().(string)
+	return code
+}
+
+// PrometheusMetrics returns the registry metrics in the Prometheus text
+// format, for metrics.Collector.AddSource
+func (r *RegistryV2) PrometheusMetrics() string {
+	var b strings.Builder
+	m := r.metrics
+
+	counter := func(name, help string, value uint64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+	labeled := func(name, help, kind, label string, values map[string]uint64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s{%s=%q} %d\n", name, label, k, values[k])
+		}
+	}
+
+	counter("registry_sessions_total", "Sessions registered", m.sessions.Load())
+	counter("registry_reconnects_total", "Sessions resumed with RECONNECT", m.reconnects.Load())
+	counter("registry_staged_expirations_total", "Staged configs dropped before CONFIG_APPLY", m.stagedExpired.Load())
+	counter("registry_idle_disconnects_total", "Connections closed after the idle timeout", m.idleClosed.Load())
+	counter("registry_apply_rate_limited_total", "Config applies refused with RATE_LIMITED", m.applyLimited.Load())
+
+	m.mu.Lock()
+	commands := make(map[string]uint64, len(m.commands))
+	for k, v := range m.commands {
+		commands[k] = v
+	}
+	errs := make(map[string]uint64, len(m.errors))
+	for k, v := range m.errors {
+		errs[k] = v
+	}
+	m.mu.Unlock()
+	labeled("registry_commands_total", "Commands received by command", "counter", "cmd", commands)
+	labeled("registry_errors_total", "ERROR replies by command", "counter", "cmd", errs)
+
+	var connected, disconnected uint64
+	routes := make(map[string]uint64)
+	r.mu.RLock()
+	for _, svc := range r.services {
+		svc.mu.RLock()
+		if svc.Connection != nil && svc.DisconnectedAt == nil {
+			connected++
+		} else {
+			disconnected++
+		}
+		routes[svc.ServiceName] += uint64(len(svc.activeRoutes))
+		svc.mu.RUnlock()
+	}
+	r.mu.RUnlock()
+	labeled("registry_sessions", "Sessions by state", "gauge", "state", map[string]uint64{
+		"connected":    connected,
+		"disconnected": disconnected,
+	})
+	labeled("registry_routes", "Active routes by service", "gauge", "service", routes)
+
+	return b.String()
+}
@@ -2,16 +2,24 @@ package registry
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/chilla55/proxy-manager/audit"
+	"github.com/chilla55/proxy-manager/config"
 	"github.com/chilla55/proxy-manager/proxy"
 )
 
@@ -21,11 +29,18 @@ import (
 type ProxyServer interface {
 	AddRoute(domains []string, path, backendURL string, headers map[string]string, websocket bool, options map[string]interface{}) error
 	RemoveRoute(domains []string, path string)
+	RemoveRouteMatch(domains []string, path string, match proxy.RouteMatch)
+	ApplyRoutes(remove []proxy.RouteRef, add []proxy.RouteSpec) error
 	SetRouteEnabled(domains []string, path string, enabled bool)
 	GetBackendStatus(domain, path string) *proxy.BackendStatus
 	SetMaintenance(domains []string, path string, enabled bool, maintenancePageURL string) error
+	SetMaintenanceDetails(domains []string, path, reason, eta string) error
 	StartDrain(domains []string, path string, duration time.Duration) error
 	CancelDrain(domains []string, path string) error
+	ForceCircuitBreaker(domains []string, path, mode string) error
+	SetServiceLimits(key string, limits proxy.ServiceLimits)
+	ServiceUsage(key string) (proxy.ServiceUsage, bool)
+	ValidateRoute(domains []string, path, backendURL string, options map[string]interface{}, probe bool) proxy.RouteValidation
 }
 
 // HealthChecker interface for backend health monitoring
@@ -78,6 +93,10 @@ type ServiceV2 struct {
 	drainDuration     time.Duration
 	subscriptions     map[string]bool
 	stagedTimeout     time.Time
+	limits            proxy.ServiceLimits // From REGISTER metadata; options override
+	protocolVersion   int                 // Negotiated with HELLO, BaselineProtocolVersion without
+	clientFeatures    []string            // Features the client announced in HELLO
+	applyBucket       applyBucket         // CONFIG_APPLY throttling
 }
 
 // RouteV2 represents a route in v2 protocol
@@ -87,6 +106,8 @@ type RouteV2 struct {
 	Path         string
 	BackendURL   string
 	Priority     int
+	Match        proxy.RouteMatch  // Request predicates, e.g. header_match
+	Labels       map[string]string // Organizational tags, e.g. team
 	CreatedAt    time.Time
 	LastModified time.Time
 }
@@ -145,11 +166,31 @@ type RegistryV2 struct {
 	stagedConfigTTL  time.Duration
 	upstreamTimeout  time.Duration
 	reconnectTimeout time.Duration // How long to keep routes after disconnect
+	maxLineSize      int           // Longest accepted protocol line in bytes
+	idleTimeout      time.Duration // Silence after which a connection is closed
+	metrics          *registryMetrics
+
+	// Config applies run one at a time and are throttled per session
+	applyMu    sync.Mutex
+	applyQueue chan struct{} // Holds a slot per apply running or waiting
+	applyRate  float64       // Applies per second a session may sustain
+	applyBurst int           // Applies a session may send back to back
 
 	// Maintenance verification tasks
 	maintTasks    chan *maintenanceTask
 	maintCancel   map[SessionID]context.CancelFunc
 	maintCancelMu sync.Mutex
+
+	// Scheduled maintenance windows, by schedule ID
+	schedulesMu      sync.Mutex
+	schedules        map[string]*maintenanceSchedule
+	scheduleStore    ScheduleStore // Persists schedules, nil to keep them in memory
+	scheduleInterval time.Duration
+
+	listener  net.Listener
+	listening atomic.Bool // Set while the listener accepts connections
+
+	audit *audit.Logger // Records control commands, nil for none
 }
 
 // maintenanceTask represents a task to verify maintenance URL or backend health
@@ -163,6 +204,86 @@ type maintenanceTask struct {
 	cancel    context.CancelFunc
 }
 
+// Protocol versions. Clients that skip HELLO are assumed to speak
+// BaselineProtocolVersion.
+const (
+	BaselineProtocolVersion = 2
+	ProtocolVersion         = 3
+)
+
+// ProtocolFeatures are the optional capabilities announced in HELLO_OK
+var ProtocolFeatures = []string{
+	"events",               // SUBSCRIBE / UNSUBSCRIBE
+	"bulk",                 // ROUTE_ADD_BULK, BACKEND_TEST_BULK
+	"routes_replace",       // ROUTES_REPLACE
+	"backend_test_path",    // BACKEND_TEST path, expected status and redirects
+	"maintenance_details",  // MAINT_ENTER eta and reason
+	"maintenance_schedule", // MAINT_SCHEDULE / MAINT_SCHEDULE_CANCEL
+	"service_limits",       // max_connections and max_bandwidth
+	"large_lines",          // Lines up to the configured maximum size
+	FeatureFraming,         // Length-prefixed JSON frames, if the client asks for them
+}
+
+// helloInfo is what a connection negotiated with HELLO
+type helloInfo struct {
+	version  int
+	features []string // Announced by the client
+}
+
+// wants reports whether the client announced feature
+func (h helloInfo) wants(feature string) bool {
+	for _, f := range h.features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// commandFields is the most fields each text command takes, including the
+// command itself
+var commandFields = map[string]int{
+	"HELLO":                  3,
+	"REGISTER":               5,
+	"ROUTE_ADD":              7,
+	"ROUTE_ADD_BULK":         3,
+	"ROUTES_REPLACE":         3,
+	"ROUTE_UPDATE":           5,
+	"ROUTE_REMOVE":           3,
+	"HEADERS_SET":            5,
+	"HEADERS_REMOVE":         4,
+	"OPTIONS_SET":            5,
+	"OPTIONS_REMOVE":         4,
+	"HEALTH_SET":             6,
+	"RATELIMIT_SET":          5,
+	"CIRCUIT_BREAKER_SET":    6,
+	"CIRCUIT_BREAKER_STATUS": 3,
+	"CIRCUIT_BREAKER_RESET":  3,
+	"CIRCUIT_BREAKER_FORCE":  4,
+	"CONFIG_VALIDATE":        3,
+	"CONFIG_APPLY_PARTIAL":   3,
+	"BACKEND_TEST":           6,
+	"BACKEND_TEST_BULK":      6,
+	"DRAIN_START":            3,
+	"SUBSCRIBE":              3,
+	"UNSUBSCRIBE":            3,
+	"MAINT_ENTER":            6,
+	"MAINT_EXIT":             3,
+	"MAINT_SCHEDULE":         6,
+	"MAINT_SCHEDULE_CANCEL":  3,
+}
+
+// DefaultMaxLineSize is the longest protocol line accepted by default, large
+// enough for ROUTE_ADD_BULK payloads with many routes
+const DefaultMaxLineSize = 1 << 20
+
+// DefaultIdleTimeout is how long a registered connection may stay silent
+// before it is closed. Clients ping every 30s, so this allows two misses.
+const DefaultIdleTimeout = 90 * time.Second
+
+// errLineTooLong is returned by readLine for lines over the size limit
+var errLineTooLong = errors.New("line too long")
+
 // NewRegistryV2 creates a new v2 registry
 func NewRegistryV2(port int, proxyServer ProxyServer, debug bool, upstreamTimeout time.Duration, healthChecker HealthChecker) *RegistryV2 {
 	r := &RegistryV2{
@@ -174,11 +295,19 @@ func NewRegistryV2(port int, proxyServer ProxyServer, debug bool, upstreamTimeou
 		debug:            debug,
 		nextRouteID:      1,
 		stats:            make(map[RouteID]*StatsV2),
+		metrics:          newRegistryMetrics(),
 		stagedConfigTTL:  30 * time.Minute,
 		upstreamTimeout:  upstreamTimeout,
 		reconnectTimeout: 5 * time.Minute, // Grace period for reconnection (matches client retry strategy)
+		maxLineSize:      DefaultMaxLineSize,
+		idleTimeout:      DefaultIdleTimeout,
+		applyQueue:       make(chan struct{}, DefaultApplyQueue),
+		applyRate:        DefaultApplyRate,
+		applyBurst:       DefaultApplyBurst,
 		maintTasks:       make(chan *maintenanceTask, 100),
 		maintCancel:      make(map[SessionID]context.CancelFunc),
+		schedules:        make(map[string]*maintenanceSchedule),
+		scheduleInterval: DefaultScheduleInterval,
 	}
 
 	// Start maintenance verification workers
@@ -193,37 +322,144 @@ func NewRegistryV2(port int, proxyServer ProxyServer, debug bool, upstreamTimeou
 func (r *RegistryV2) StartV2(ctx context.Context) {
 	go r.cleanupExpiredStagedConfigs(ctx)
 	go r.cleanupDisconnectedSessions(ctx)
+	go r.reapIdleSessions(ctx)
+	go r.runMaintenanceSchedules(ctx)
 
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", r.port))
 	if err != nil {
 		log.Fatalf("[registry-v2] Failed to start listener: %s", err)
 	}
-	defer listener.Close()
+	r.mu.Lock()
+	r.listener = listener
+	r.mu.Unlock()
+	r.listening.Store(true)
+	defer r.StopAccepting()
+
+	// Closing the listener unblocks Accept
+	go func() {
+		<-ctx.Done()
+		r.StopAccepting()
+	}()
 
 	log.Printf("[registry-v2] Service registry v2 listening on port %d", r.port)
 
 	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			conn, err := listener.Accept()
-			if err != nil {
-				if r.debug {
-					log.Printf("[registry-v2] Accept error: %s", err)
-				}
-				continue
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if r.debug {
+				log.Printf("[registry-v2] Accept error: %s", err)
 			}
+			continue
+		}
+
+		// Enable TCP keepalive
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			_ = tcpConn.SetKeepAlive(true)
+			_ = tcpConn.SetKeepAlivePeriod(30 * time.Second)
+		}
+
+		go r.handleConnectionV2(ctx, conn)
+	}
+}
+
+// StopAccepting closes the registry listener. Connected services keep their
+// sessions and routes until the context passed to StartV2 is cancelled.
+func (r *RegistryV2) StopAccepting() {
+	r.mu.Lock()
+	listener := r.listener
+	r.listener = nil
+	r.mu.Unlock()
+	if listener == nil {
+		return
+	}
+	r.listening.Store(false)
+	_ = listener.Close()
+	log.Printf("[registry-v2] Stopped accepting new connections")
+}
 
-			// Enable TCP keepalive
-			if tcpConn, ok := conn.(*net.TCPConn); ok {
-				_ = tcpConn.SetKeepAlive(true)
-				_ = tcpConn.SetKeepAlivePeriod(30 * time.Second)
+// Listening reports whether the registry listener is bound and accepting
+func (r *RegistryV2) Listening() bool {
+	return r.listening.Load()
+}
+
+// SetMaxLineSize sets the longest accepted protocol line; n <= 0 restores
+// DefaultMaxLineSize. Call before StartV2.
+func (r *RegistryV2) SetMaxLineSize(n int) {
+	if n <= 0 {
+		n = DefaultMaxLineSize
+	}
+	r.maxLineSize = n
+}
+
+// SetAuditLogger records control commands (circuit breaker, config apply,
+// drain and maintenance) in the audit log. Call before StartV2.
+func (r *RegistryV2) SetAuditLogger(l *audit.Logger) {
+	r.audit = l
+}
+
+// SetIdleTimeout sets how long a registered connection may go without a
+// command before it is closed and its grace period starts. It should be well
+// above the client ping interval; d <= 0 disables the check. Call before StartV2.
+func (r *RegistryV2) SetIdleTimeout(d time.Duration) {
+	r.idleTimeout = d
+}
+
+// readLine reads one line without its line ending. A line longer than max
+// is consumed up to its newline and reported as errLineTooLong, so the
+// connection stays usable.
+func readLine(reader *bufio.Reader, max int) (string, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(chunk) > max+2 { // Allow for "\r\n"
+				tooLong = true
+				line = nil
+			} else {
+				line = append(line, chunk...)
 			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && (len(line) == 0 || tooLong) {
+			return "", err
+		}
+		break
+	}
+	if tooLong {
+		return "", errLineTooLong
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if len(line) > max {
+		return "", errLineTooLong
+	}
+	return string(line), nil
+}
 
-			go r.handleConnectionV2(ctx, conn)
+// readCommand reads the next command as text protocol fields, from a line
+// or, once framing is negotiated, from a frame
+func (r *RegistryV2) readCommand(reader *bufio.Reader, framed bool) ([]string, error) {
+	if framed {
+		frame, err := DecodeFrame(reader, r.maxLineSize)
+		if err == ErrFrameTooLarge {
+			return nil, errLineTooLong
+		}
+		if err != nil {
+			return nil, err
 		}
+		return frame.Parts(), nil
 	}
+	line, err := readLine(reader, r.maxLineSize)
+	if err != nil || line == "" {
+		return nil, err
+	}
+	return strings.Split(line, "|"), nil
 }
 
 func (r *RegistryV2) handleConnectionV2(ctx context.Context, conn net.Conn) {
@@ -232,8 +468,12 @@ func (r *RegistryV2) handleConnectionV2(ctx context.Context, conn net.Conn) {
 		<-ctx.Done()
 		_ = conn.Close()
 	}()
+	// Replies go through out, which counts errors and frames them once negotiated
+	replies := &replyCounter{Conn: conn, metrics: r.metrics}
+	out := net.Conn(replies)
 	defer func() {
 		r.mu.Lock()
+		delete(r.sessionsByConn, out) // Added by RECONNECT
 		if sid, ok := r.sessionsByConn[conn]; ok {
 			delete(r.sessionsByConn, conn)
 			r.mu.Unlock()
@@ -268,37 +508,72 @@ func (r *RegistryV2) handleConnectionV2(ctx context.Context, conn net.Conn) {
 		conn.Close()
 	}()
 
-	scanner := bufio.NewScanner(conn)
+	reader := bufio.NewReader(conn)
+	framed := false
 	var sessionID SessionID
+	hello := helloInfo{version: BaselineProtocolVersion}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
+	for {
+		replies.startCommand("") // Errors before a command is parsed count as unknown
+		parts, err := r.readCommand(reader, framed)
+		if err == errLineTooLong {
+			log.Printf("[registry-v2] Rejected message over %d bytes from %s", r.maxLineSize, conn.RemoteAddr())
+			writeError(out, ErrCodePayloadTooLarge, "payload too large")
 			continue
 		}
-
-		parts := strings.Split(line, "|")
-		if len(parts) == 0 {
+		if errors.Is(err, ErrInvalidFrame) {
+			writeError(out, ErrCodeInvalidFormat, "invalid frame")
+			continue
+		}
+		if err != nil {
+			break
+		}
+		if len(parts) == 0 || parts[0] == "" {
 			continue
 		}
 
 		command := parts[0]
+		label := commandLabel(command)
+		r.metrics.recordCommand(label)
+		replies.startCommand(label)
+
+		// A "|" inside a value shows up as extra fields; refuse rather than
+		// act on a truncated value
+		if !framed {
+			if max, ok := commandFields[command]; ok && len(parts) > max {
+				writeError(out, ErrCodeInvalidFormat, "too many fields for %s: values must not contain '|' (use framing)", command)
+				continue
+			}
+		}
 
 		// Commands that don't require session
+		if command == "HELLO" {
+			if negotiated, ok := r.handleHelloV2(out, parts); ok {
+				hello = negotiated
+				r.setProtocol(sessionID, hello)
+				if !framed && hello.wants(FeatureFraming) {
+					framed = true
+					replies.Conn = &framedConn{Conn: conn}
+				}
+			}
+			continue
+		}
 		if command == "REGISTER" {
-			sid, err := r.handleRegisterV2(conn, parts)
+			sid, err := r.handleRegisterV2(out, parts)
 			if err == nil {
+				r.metrics.sessions.Add(1)
 				sessionID = sid
 				r.mu.Lock()
 				r.sessionsByConn[conn] = sessionID
 				r.mu.Unlock()
+				r.setProtocol(sessionID, hello)
 			}
 			continue
 		}
 
 		// All other commands require session
 		if sessionID == "" {
-			conn.Write([]byte("ERROR|no session\n"))
+			writeError(out, ErrCodeSessionNotFound, "no session")
 			continue
 		}
 
@@ -315,83 +590,146 @@ func (r *RegistryV2) handleConnectionV2(ctx context.Context, conn net.Conn) {
 		// Session-scoped commands
 		switch command {
 		case "RECONNECT":
-			r.handleReconnectV2(conn, sessionID, parts)
+			r.handleReconnectV2(out, sessionID, parts)
 		case "PING":
-			conn.Write([]byte("PONG\n"))
+			out.Write([]byte("PONG\n"))
 		case "SESSION_INFO":
-			r.handleSessionInfoV2(conn, sessionID)
+			r.handleSessionInfoV2(out, sessionID)
 		case "ROUTE_ADD":
-			r.handleRouteAddV2(conn, sessionID, parts)
+			r.handleRouteAddV2(out, sessionID, parts)
 		case "ROUTE_ADD_BULK":
-			r.handleRouteAddBulkV2(conn, sessionID, parts)
+			r.handleRouteAddBulkV2(out, sessionID, parts)
+		case "ROUTES_REPLACE":
+			r.handleRoutesReplaceV2(out, sessionID, parts)
 		case "ROUTE_UPDATE":
-			r.handleRouteUpdateV2(conn, sessionID, parts)
+			r.handleRouteUpdateV2(out, sessionID, parts)
 		case "ROUTE_REMOVE":
-			r.handleRouteRemoveV2(conn, sessionID, parts)
+			r.handleRouteRemoveV2(out, sessionID, parts)
 		case "ROUTE_LIST":
-			r.handleRouteListV2(conn, sessionID, parts)
+			r.handleRouteListV2(out, sessionID, parts)
 		case "HEADERS_SET":
-			r.handleHeadersSetV2(conn, sessionID, parts)
+			r.handleHeadersSetV2(out, sessionID, parts)
 		case "HEADERS_REMOVE":
-			r.handleHeadersRemoveV2(conn, sessionID, parts)
+			r.handleHeadersRemoveV2(out, sessionID, parts)
 		case "OPTIONS_SET":
-			r.handleOptionsSetV2(conn, sessionID, parts)
+			r.handleOptionsSetV2(out, sessionID, parts)
 		case "OPTIONS_REMOVE":
-			r.handleOptionsRemoveV2(conn, sessionID, parts)
+			r.handleOptionsRemoveV2(out, sessionID, parts)
 		case "HEALTH_SET":
-			r.handleHealthSetV2(conn, sessionID, parts)
+			r.handleHealthSetV2(out, sessionID, parts)
 		case "RATELIMIT_SET":
-			r.handleRateLimitSetV2(conn, sessionID, parts)
+			r.handleRateLimitSetV2(out, sessionID, parts)
 		case "CIRCUIT_BREAKER_SET":
-			r.handleCircuitBreakerSetV2(conn, sessionID, parts)
+			r.handleCircuitBreakerSetV2(out, sessionID, parts)
 		case "CIRCUIT_BREAKER_STATUS":
-			r.handleCircuitBreakerStatusV2(conn, sessionID, parts)
+			r.handleCircuitBreakerStatusV2(out, sessionID, parts)
 		case "CIRCUIT_BREAKER_RESET":
-			r.handleCircuitBreakerResetV2(conn, sessionID, parts)
+			r.handleCircuitBreakerResetV2(out, sessionID, parts)
+		case "CIRCUIT_BREAKER_FORCE":
+			r.handleCircuitBreakerForceV2(out, sessionID, parts)
 		case "CONFIG_VALIDATE":
-			r.handleConfigValidateV2(conn, sessionID)
+			r.handleConfigValidateV2(out, sessionID, parts)
 		case "CONFIG_APPLY":
-			r.handleConfigApplyV2(conn, sessionID)
+			r.handleConfigApplyV2(out, sessionID)
 		case "CONFIG_ROLLBACK":
-			r.handleConfigRollbackV2(conn, sessionID)
+			r.handleConfigRollbackV2(out, sessionID)
 		case "CONFIG_DIFF":
-			r.handleConfigDiffV2(conn, sessionID)
+			r.handleConfigDiffV2(out, sessionID)
 		case "CONFIG_APPLY_PARTIAL":
-			r.handleConfigApplyPartialV2(conn, sessionID, parts)
+			r.handleConfigApplyPartialV2(out, sessionID, parts)
 		case "STATS_GET":
-			r.handleStatsGetV2(conn, sessionID, parts)
+			r.handleStatsGetV2(out, sessionID, parts)
 		case "BACKEND_TEST":
-			r.handleBackendTestV2(conn, sessionID, parts)
+			r.handleBackendTestV2(out, sessionID, parts)
+		case "BACKEND_TEST_BULK":
+			r.handleBackendTestBulkV2(out, sessionID, parts)
 		case "DRAIN_START":
-			r.handleDrainStartV2(conn, sessionID, parts)
+			r.handleDrainStartV2(out, sessionID, parts)
 		case "DRAIN_STATUS":
-			r.handleDrainStatusV2(conn, sessionID)
+			r.handleDrainStatusV2(out, sessionID)
 		case "DRAIN_CANCEL":
-			r.handleDrainCancelV2(conn, sessionID)
+			r.handleDrainCancelV2(out, sessionID)
 		case "SUBSCRIBE":
-			r.handleSubscribeV2(conn, sessionID, parts)
+			r.handleSubscribeV2(out, sessionID, parts)
 		case "UNSUBSCRIBE":
-			r.handleUnsubscribeV2(conn, sessionID, parts)
+			r.handleUnsubscribeV2(out, sessionID, parts)
 		case "MAINT_ENTER":
-			r.handleMaintenanceEnterV2(conn, sessionID, parts)
+			r.handleMaintenanceEnterV2(out, sessionID, parts)
 		case "MAINT_EXIT":
-			r.handleMaintenanceExitV2(conn, sessionID, parts)
+			r.handleMaintenanceExitV2(out, sessionID, parts)
 		case "MAINT_STATUS":
-			r.handleMaintenanceStatusV2(conn, sessionID)
+			r.handleMaintenanceStatusV2(out, sessionID)
+		case "MAINT_SCHEDULE":
+			r.handleMaintenanceScheduleV2(out, sessionID, parts)
+		case "MAINT_SCHEDULE_CANCEL":
+			r.handleMaintenanceScheduleCancelV2(out, sessionID, parts)
 		case "CLIENT_SHUTDOWN":
-			r.handleClientShutdownV2(conn, sessionID)
+			r.handleClientShutdownV2(out, sessionID)
 		default:
-			conn.Write([]byte(fmt.Sprintf("ERROR|unknown command: %s\n", command)))
+			writeError(out, ErrCodeUnknownCommand, "unknown command: %s", command)
+		}
+
+		if spec, ok := auditedCommands[command]; ok {
+			r.auditCommand(svc, conn, parts, spec, replies.lastError())
 		}
 	}
 }
 
 // Handler implementations
 
+func (r *RegistryV2) handleHelloV2(conn net.Conn, parts []string) (helloInfo, bool) {
+	// HELLO|protocol_version[|features]
+	if len(parts) < 2 {
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
+		return helloInfo{}, false
+	}
+	version, err := strconv.Atoi(parts[1])
+	if err != nil {
+		writeError(conn, ErrCodeInvalidFormat, "invalid protocol version")
+		return helloInfo{}, false
+	}
+	if version < BaselineProtocolVersion {
+		writeError(conn, ErrCodeUnsupported, "unsupported protocol version %d (minimum %d)", version, BaselineProtocolVersion)
+		return helloInfo{}, false
+	}
+
+	hello := helloInfo{version: version}
+	if hello.version > ProtocolVersion {
+		hello.version = ProtocolVersion
+	}
+	if len(parts) > 2 {
+		for _, feature := range strings.Split(parts[2], ",") {
+			if feature = strings.TrimSpace(feature); feature != "" {
+				hello.features = append(hello.features, feature)
+			}
+		}
+	}
+
+	conn.Write([]byte(fmt.Sprintf("HELLO_OK|%d|%s\n", hello.version, strings.Join(ProtocolFeatures, ","))))
+	return hello, true
+}
+
+// setProtocol records a connection's negotiated protocol on its session
+func (r *RegistryV2) setProtocol(sessionID SessionID, hello helloInfo) {
+	if sessionID == "" {
+		return
+	}
+	r.mu.RLock()
+	svc, exists := r.services[sessionID]
+	r.mu.RUnlock()
+	if !exists {
+		return
+	}
+	svc.mu.Lock()
+	svc.protocolVersion = hello.version
+	svc.clientFeatures = hello.features
+	svc.mu.Unlock()
+}
+
 func (r *RegistryV2) handleRegisterV2(conn net.Conn, parts []string) (SessionID, error) {
 	// REGISTER|service_name|instance_name|maintenance_port|metadata
 	if len(parts) < 4 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return "", fmt.Errorf("invalid format")
 	}
 
@@ -403,10 +741,15 @@ func (r *RegistryV2) handleRegisterV2(conn net.Conn, parts []string) (SessionID,
 	metadata := make(map[string]interface{})
 	if len(parts) > 4 && parts[4] != "" && parts[4] != "{}" {
 		if err := json.Unmarshal([]byte(parts[4]), &metadata); err != nil {
-			conn.Write([]byte("ERROR|invalid metadata json\n"))
+			writeError(conn, ErrCodeInvalidFormat, "invalid metadata json")
 			return "", err
 		}
 	}
+	limits, err := serviceLimitsFrom(metadata, proxy.ServiceLimits{})
+	if err != nil {
+		writeError(conn, ErrCodeInvalidValue, "%s", err)
+		return "", err
+	}
 
 	// Cleanup old sessions for the same service/instance (handles fast restarts)
 	r.mu.Lock()
@@ -430,13 +773,14 @@ func (r *RegistryV2) handleRegisterV2(conn net.Conn, parts []string) (SessionID,
 			// Remove all active routes from proxy (only if not already deactivated)
 			if !oldSvc.routesDeactivated {
 				for routeID, route := range oldSvc.activeRoutes {
-					r.proxyServer.RemoveRoute(route.Domains, route.Path)
+					r.proxyServer.RemoveRouteMatch(route.Domains, route.Path, route.Match)
 					log.Printf("[registry-v2] Removed old route %s: %v%s", routeID, route.Domains, route.Path)
 				}
 			} else {
 				log.Printf("[registry-v2] Old session routes already deactivated, skipping removal")
 			}
 			oldSvc.mu.Unlock()
+			r.proxyServer.SetServiceLimits(string(oldSID), proxy.ServiceLimits{})
 
 			// Remove old session
 			r.mu.Lock()
@@ -478,11 +822,13 @@ func (r *RegistryV2) handleRegisterV2(conn net.Conn, parts []string) (SessionID,
 		maintenanceRoutes: make(map[RouteID]bool),
 		subscriptions:     make(map[string]bool),
 		stagedTimeout:     time.Now().Add(r.stagedConfigTTL),
+		limits:            limits,
 	}
 
 	r.mu.Lock()
 	r.services[sessionID] = service
 	r.mu.Unlock()
+	r.proxyServer.SetServiceLimits(string(sessionID), limits)
 
 	if len(oldSessions) > 0 {
 		log.Printf("[registry-v2] Service re-registered (cleaned up %d old session(s)): %s/%s (new session: %s)", len(oldSessions), serviceName, instanceName, sessionID)
@@ -525,6 +871,7 @@ func (r *RegistryV2) handleReconnectV2(conn net.Conn, sessionID SessionID, parts
 	r.sessionsByConn[conn] = sessionID
 	r.mu.Unlock()
 
+	r.metrics.reconnects.Add(1)
 	log.Printf("[registry-v2] Session %s (%s) reconnected successfully", sessionID, svc.ServiceName)
 	conn.Write([]byte("OK\n"))
 }
@@ -535,32 +882,39 @@ func (r *RegistryV2) handleSessionInfoV2(conn net.Conn, sessionID SessionID) {
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
 	svc.mu.RLock()
 	info := map[string]interface{}{
-		"session_id":     string(sessionID),
-		"service_name":   svc.ServiceName,
-		"instance_name":  svc.InstanceName,
-		"connected_at":   svc.ConnectedAt.Format(time.RFC3339),
-		"uptime_seconds": int(time.Since(svc.ConnectedAt).Seconds()),
-		"routes_active":  len(svc.activeRoutes),
-		"routes_staged":  len(svc.stagedRoutes),
-		"last_activity":  svc.LastActivity.Format(time.RFC3339),
-		"metadata":       svc.Metadata,
+		"session_id":       string(sessionID),
+		"service_name":     svc.ServiceName,
+		"instance_name":    svc.InstanceName,
+		"connected_at":     svc.ConnectedAt.Format(time.RFC3339),
+		"uptime_seconds":   int(time.Since(svc.ConnectedAt).Seconds()),
+		"routes_active":    len(svc.activeRoutes),
+		"routes_staged":    len(svc.stagedRoutes),
+		"last_activity":    svc.LastActivity.Format(time.RFC3339),
+		"metadata":         svc.Metadata,
+		"protocol_version": svc.protocolVersion,
+	}
+	if len(svc.clientFeatures) > 0 {
+		info["client_features"] = svc.clientFeatures
 	}
 	svc.mu.RUnlock()
+	if usage, ok := r.proxyServer.ServiceUsage(string(sessionID)); ok {
+		info["limits"] = usage
+	}
 
 	data, _ := json.Marshal(info)
 	conn.Write([]byte(fmt.Sprintf("SESSION_OK|%s\n", string(data))))
 }
 
 func (r *RegistryV2) handleRouteAddV2(conn net.Conn, sessionID SessionID, parts []string) {
-	// ROUTE_ADD|session_id|domains|path|backend_url|priority
+	// ROUTE_ADD|session_id|domains|path|backend_url|priority[|labels]
 	if len(parts) < 6 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -574,16 +928,24 @@ func (r *RegistryV2) handleRouteAddV2(conn net.Conn, sessionID SessionID, parts
 	fmt.Sscanf(parts[5], "%d", &priority)
 
 	if err := validateRoute(domains, path, backendURL); err != nil {
-		conn.Write([]byte(fmt.Sprintf("ERROR|%s\n", err)))
+		writeError(conn, ErrCodeInvalidValue, "%s", err)
 		return
 	}
+	var labels map[string]string
+	if len(parts) > 6 {
+		var err error
+		if labels, err = parseRouteLabels(parts[6]); err != nil {
+			writeError(conn, ErrCodeInvalidValue, "%s", err)
+			return
+		}
+	}
 
 	r.mu.RLock()
 	svc, exists := r.services[sessionID]
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -596,6 +958,7 @@ func (r *RegistryV2) handleRouteAddV2(conn net.Conn, sessionID SessionID, parts
 		Path:         path,
 		BackendURL:   backendURL,
 		Priority:     priority,
+		Labels:       labels,
 		CreatedAt:    time.Now(),
 		LastModified: time.Now(),
 	}
@@ -608,13 +971,13 @@ func (r *RegistryV2) handleRouteAddV2(conn net.Conn, sessionID SessionID, parts
 func (r *RegistryV2) handleRouteAddBulkV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// ROUTE_ADD_BULK|session_id|json_array
 	if len(parts) < 3 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
 	var routes []map[string]interface{}
 	if err := json.Unmarshal([]byte(parts[2]), &routes); err != nil {
-		conn.Write([]byte("ERROR|invalid json\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid json")
 		return
 	}
 
@@ -623,35 +986,23 @@ func (r *RegistryV2) handleRouteAddBulkV2(conn net.Conn, sessionID SessionID, pa
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
+		return
+	}
+
+	parsed, err := parseRouteEntries(routes)
+	if err != nil {
+		writeError(conn, ErrCodeInvalidValue, "%s", err)
 		return
 	}
 
 	svc.mu.Lock()
 	results := make([]map[string]string, 0)
 
-	for _, route := range routes {
-		domains := parseStringArray(route["domains"])
-		path, _ := route["path"].(string)
-		backendURL, _ := route["backend_url"].(string)
-		priority := int(getFloat64(route["priority"]))
-
-		if err := validateRoute(domains, path, backendURL); err != nil {
-			svc.mu.Unlock()
-			conn.Write([]byte(fmt.Sprintf("ERROR|%s\n", err)))
-			return
-		}
-
+	for _, route := range parsed {
 		routeID := r.generateRouteID()
-		svc.stagedRoutes[routeID] = &RouteV2{
-			RouteID:      routeID,
-			Domains:      domains,
-			Path:         path,
-			BackendURL:   backendURL,
-			Priority:     priority,
-			CreatedAt:    time.Now(),
-			LastModified: time.Now(),
-		}
+		route.RouteID = routeID
+		svc.stagedRoutes[routeID] = route
 
 		results = append(results, map[string]string{
 			"route_id": string(routeID),
@@ -666,10 +1017,98 @@ func (r *RegistryV2) handleRouteAddBulkV2(conn net.Conn, sessionID SessionID, pa
 	conn.Write([]byte(fmt.Sprintf("ROUTE_BULK_OK|%s\n", string(data))))
 }
 
+func (r *RegistryV2) handleRoutesReplaceV2(conn net.Conn, sessionID SessionID, parts []string) {
+	// ROUTES_REPLACE|session_id|json_array
+	if len(parts) < 3 {
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
+		return
+	}
+
+	var routes []map[string]interface{}
+	if err := json.Unmarshal([]byte(parts[2]), &routes); err != nil {
+		writeError(conn, ErrCodeInvalidFormat, "invalid json")
+		return
+	}
+
+	r.mu.RLock()
+	svc, exists := r.services[sessionID]
+	r.mu.RUnlock()
+
+	if !exists {
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
+		return
+	}
+
+	parsed, err := parseRouteEntries(routes)
+	if err != nil {
+		writeError(conn, ErrCodeInvalidValue, "%s", err)
+		return
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	// Active routes keep their ID when the same domains, path and
+	// predicates are still wanted, so health checks and stats carry over
+	active := make(map[string]RouteID, len(svc.activeRoutes))
+	for routeID, route := range svc.activeRoutes {
+		active[routeKey(route)] = routeID
+	}
+
+	staged := make(map[RouteID]*RouteV2, len(parsed))
+	seen := make(map[string]bool, len(parsed))
+	kept := make(map[RouteID]bool)
+	results := make([]map[string]string, 0, len(parsed))
+
+	for _, route := range parsed {
+		key := routeKey(route)
+		if seen[key] {
+			writeError(conn, ErrCodeRouteConflict, "duplicate route %s%s", strings.Join(route.Domains, ","), route.Path)
+			return
+		}
+		seen[key] = true
+
+		status := "added"
+		if routeID, found := active[key]; found {
+			route.RouteID = routeID
+			route.CreatedAt = svc.activeRoutes[routeID].CreatedAt
+			kept[routeID] = true
+			status = "updated"
+		} else {
+			route.RouteID = r.generateRouteID()
+		}
+		staged[route.RouteID] = route
+
+		results = append(results, map[string]string{
+			"route_id": string(route.RouteID),
+			"status":   status,
+		})
+	}
+
+	removals := make(map[RouteID]bool)
+	for routeID := range svc.activeRoutes {
+		if !kept[routeID] {
+			removals[routeID] = true
+			results = append(results, map[string]string{
+				"route_id": string(routeID),
+				"status":   "removed",
+			})
+		}
+	}
+
+	// The set replaces whatever was staged before
+	svc.stagedRoutes = staged
+	svc.stagedRemovals = removals
+	svc.stagedTimeout = time.Now().Add(r.stagedConfigTTL)
+
+	data, _ := json.Marshal(results)
+	conn.Write([]byte(fmt.Sprintf("ROUTES_REPLACE_OK|%s\n", string(data))))
+}
+
 func (r *RegistryV2) handleRouteUpdateV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// ROUTE_UPDATE|session_id|route_id|field|value
 	if len(parts) < 5 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -682,7 +1121,7 @@ func (r *RegistryV2) handleRouteUpdateV2(conn net.Conn, sessionID SessionID, par
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -692,7 +1131,7 @@ func (r *RegistryV2) handleRouteUpdateV2(conn net.Conn, sessionID SessionID, par
 		route, found = svc.activeRoutes[routeID]
 		if !found {
 			svc.mu.Unlock()
-			conn.Write([]byte("ERROR|route not found\n"))
+			writeError(conn, ErrCodeRouteNotFound, "route not found")
 			return
 		}
 		// Copy active to staged for modification
@@ -705,7 +1144,7 @@ func (r *RegistryV2) handleRouteUpdateV2(conn net.Conn, sessionID SessionID, par
 	case "backend_url":
 		if !strings.Contains(value, "://") {
 			svc.mu.Unlock()
-			conn.Write([]byte("ERROR|invalid backend url\n"))
+			writeError(conn, ErrCodeInvalidValue, "invalid backend url")
 			return
 		}
 		route.BackendURL = value
@@ -721,7 +1160,7 @@ func (r *RegistryV2) handleRouteUpdateV2(conn net.Conn, sessionID SessionID, par
 		route.Path = value
 	default:
 		svc.mu.Unlock()
-		conn.Write([]byte("ERROR|unknown field\n"))
+		writeError(conn, ErrCodeInvalidValue, "unknown field")
 		return
 	}
 
@@ -735,7 +1174,7 @@ func (r *RegistryV2) handleRouteUpdateV2(conn net.Conn, sessionID SessionID, par
 func (r *RegistryV2) handleRouteRemoveV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// ROUTE_REMOVE|session_id|route_id
 	if len(parts) < 3 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -746,7 +1185,7 @@ func (r *RegistryV2) handleRouteRemoveV2(conn net.Conn, sessionID SessionID, par
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -756,7 +1195,7 @@ func (r *RegistryV2) handleRouteRemoveV2(conn net.Conn, sessionID SessionID, par
 
 	if !stagFound && !activeFound {
 		svc.mu.Unlock()
-		conn.Write([]byte("ERROR|route not found\n"))
+		writeError(conn, ErrCodeRouteNotFound, "route not found")
 		return
 	}
 
@@ -775,7 +1214,7 @@ func (r *RegistryV2) handleRouteListV2(conn net.Conn, sessionID SessionID, parts
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -783,25 +1222,35 @@ func (r *RegistryV2) handleRouteListV2(conn net.Conn, sessionID SessionID, parts
 	result := make([]map[string]interface{}, 0)
 
 	for rid, route := range svc.activeRoutes {
-		result = append(result, map[string]interface{}{
+		entry := map[string]interface{}{
 			"route_id": string(rid),
 			"domains":  route.Domains,
 			"path":     route.Path,
 			"backend":  route.BackendURL,
 			"priority": route.Priority,
 			"status":   "active",
-		})
+		}
+		addMatchFields(entry, route.Match)
+		if len(route.Labels) > 0 {
+			entry["labels"] = route.Labels
+		}
+		result = append(result, entry)
 	}
 
 	for rid, route := range svc.stagedRoutes {
-		result = append(result, map[string]interface{}{
+		entry := map[string]interface{}{
 			"route_id": string(rid),
 			"domains":  route.Domains,
 			"path":     route.Path,
 			"backend":  route.BackendURL,
 			"priority": route.Priority,
 			"status":   "staged",
-		})
+		}
+		addMatchFields(entry, route.Match)
+		if len(route.Labels) > 0 {
+			entry["labels"] = route.Labels
+		}
+		result = append(result, entry)
 	}
 
 	svc.mu.RUnlock()
@@ -813,20 +1262,34 @@ func (r *RegistryV2) handleRouteListV2(conn net.Conn, sessionID SessionID, parts
 func (r *RegistryV2) handleHeadersSetV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// HEADERS_SET|session_id|target|header_name|header_value
 	if len(parts) < 5 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
 	target := parts[2]
 	name := parts[3]
 	value := parts[4]
+	if strings.ContainsAny(name, "\r\n: ") || strings.ContainsAny(value, "\r\n") {
+		writeError(conn, ErrCodeInvalidValue, "header name or value contains invalid characters")
+		return
+	}
+	if strings.EqualFold(name, "Strict-Transport-Security") {
+		warnings, err := config.CheckHSTS(value)
+		if err != nil {
+			writeError(conn, ErrCodeInvalidValue, "%s", err)
+			return
+		}
+		for _, warning := range warnings {
+			log.Printf("[registry-v2] Session %s: %s", sessionID, warning)
+		}
+	}
 
 	r.mu.RLock()
 	svc, exists := r.services[sessionID]
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -836,7 +1299,7 @@ func (r *RegistryV2) handleHeadersSetV2(conn net.Conn, sessionID SessionID, part
 	} else {
 		// Route-specific headers would go here (future enhancement)
 		svc.mu.Unlock()
-		conn.Write([]byte("ERROR|route-specific headers not yet supported\n"))
+		writeError(conn, ErrCodeUnsupported, "route-specific headers not yet supported")
 		return
 	}
 	svc.stagedTimeout = time.Now().Add(r.stagedConfigTTL)
@@ -848,7 +1311,7 @@ func (r *RegistryV2) handleHeadersSetV2(conn net.Conn, sessionID SessionID, part
 func (r *RegistryV2) handleHeadersRemoveV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// HEADERS_REMOVE|session_id|target|header_name
 	if len(parts) < 4 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -860,7 +1323,7 @@ func (r *RegistryV2) handleHeadersRemoveV2(conn net.Conn, sessionID SessionID, p
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -872,14 +1335,14 @@ func (r *RegistryV2) handleHeadersRemoveV2(conn net.Conn, sessionID SessionID, p
 		conn.Write([]byte("HEADERS_OK\n"))
 	} else {
 		svc.mu.Unlock()
-		conn.Write([]byte("ERROR|route-specific headers not yet supported\n"))
+		writeError(conn, ErrCodeUnsupported, "route-specific headers not yet supported")
 	}
 }
 
 func (r *RegistryV2) handleOptionsSetV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// OPTIONS_SET|session_id|target|key|value
 	if len(parts) < 5 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -892,7 +1355,7 @@ func (r *RegistryV2) handleOptionsSetV2(conn net.Conn, sessionID SessionID, part
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -901,10 +1364,86 @@ func (r *RegistryV2) handleOptionsSetV2(conn net.Conn, sessionID SessionID, part
 		// Parse value based on key
 		var parsed interface{} = value
 		switch key {
-		case "timeout", "health_check_interval", "health_check_timeout":
-			parsed = parseDuration(value)
-		case "websocket", "compression", "http2", "http3":
+		case "timeout", "request_timeout", "health_check_interval", "health_check_timeout",
+			"maintenance_retry_after", "drain_retry_after", "disabled_retry_after", "mirror_timeout":
+			// Kept as given when invalid, CONFIG_VALIDATE and CONFIG_APPLY report it
+			if d, err := time.ParseDuration(value); err == nil {
+				parsed = d
+			}
+		case "maintenance_status", "drain_status":
+			code, err := strconv.Atoi(value)
+			if err != nil || code < 200 || code > 599 {
+				svc.mu.Unlock()
+				writeError(conn, ErrCodeInvalidValue, "invalid status for %s", key)
+				return
+			}
+			parsed = code
+		case "canonical_host":
+			if err := proxy.ValidCanonicalHost(value); err != nil {
+				svc.mu.Unlock()
+				writeError(conn, ErrCodeInvalidValue, "%s", err)
+				return
+			}
+		case "redirect_status":
+			code, err := strconv.Atoi(value)
+			if err != nil || (code != 301 && code != 302 && code != 307 && code != 308) {
+				svc.mu.Unlock()
+				writeError(conn, ErrCodeInvalidValue, "invalid redirect_status")
+				return
+			}
+			parsed = code
+		case "max_connections", "max_bandwidth":
+			limit, err := parseLimit(key, value)
+			if err != nil {
+				svc.mu.Unlock()
+				writeError(conn, ErrCodeInvalidValue, "%s", err)
+				return
+			}
+			parsed = limit
+		case "mirror_percent":
+			percent, err := strconv.ParseFloat(value, 64)
+			if err != nil || percent <= 0 || percent > 100 {
+				svc.mu.Unlock()
+				writeError(conn, ErrCodeInvalidValue, "invalid mirror_percent")
+				return
+			}
+			parsed = percent
+		case "mirror_rate":
+			rate, err := strconv.Atoi(value)
+			if err != nil || rate < 0 {
+				svc.mu.Unlock()
+				writeError(conn, ErrCodeInvalidValue, "invalid mirror_rate")
+				return
+			}
+			parsed = rate
+		case "backend_rate_limit":
+			requests, window, err := config.ParseBackendRateLimit(value)
+			if err != nil {
+				svc.mu.Unlock()
+				writeError(conn, ErrCodeInvalidValue, "backend_rate_limit: %s", err)
+				return
+			}
+			parsed = requests
+			svc.stagedOptions["backend_rate_window"] = window
+		case "mirror_max_body", "max_response_body":
+			size, err := parseLimit(key, value)
+			if err != nil {
+				svc.mu.Unlock()
+				writeError(conn, ErrCodeInvalidValue, "%s", err)
+				return
+			}
+			parsed = size
+		case "websocket", "compression", "http2", "http3", "redirect_preserve_path", "redirect_strip_prefix",
+			"https_redirect", "streaming":
 			parsed = value == "true"
+		case "strip_response_headers":
+			var names []string
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+			parsed = names
 		}
 		svc.stagedOptions[key] = parsed
 		svc.stagedTimeout = time.Now().Add(r.stagedConfigTTL)
@@ -912,14 +1451,14 @@ func (r *RegistryV2) handleOptionsSetV2(conn net.Conn, sessionID SessionID, part
 		conn.Write([]byte("OPTIONS_OK\n"))
 	} else {
 		svc.mu.Unlock()
-		conn.Write([]byte("ERROR|route-specific options not yet supported\n"))
+		writeError(conn, ErrCodeUnsupported, "route-specific options not yet supported")
 	}
 }
 
 func (r *RegistryV2) handleOptionsRemoveV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// OPTIONS_REMOVE|session_id|target|key
 	if len(parts) < 4 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -931,7 +1470,7 @@ func (r *RegistryV2) handleOptionsRemoveV2(conn net.Conn, sessionID SessionID, p
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -943,14 +1482,14 @@ func (r *RegistryV2) handleOptionsRemoveV2(conn net.Conn, sessionID SessionID, p
 		conn.Write([]byte("OPTIONS_OK\n"))
 	} else {
 		svc.mu.Unlock()
-		conn.Write([]byte("ERROR|route-specific options not yet supported\n"))
+		writeError(conn, ErrCodeUnsupported, "route-specific options not yet supported")
 	}
 }
 
 func (r *RegistryV2) handleHealthSetV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// HEALTH_SET|session_id|route_id|path|interval|timeout
 	if len(parts) < 6 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -964,7 +1503,7 @@ func (r *RegistryV2) handleHealthSetV2(conn net.Conn, sessionID SessionID, parts
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -984,7 +1523,7 @@ func (r *RegistryV2) handleHealthSetV2(conn net.Conn, sessionID SessionID, parts
 func (r *RegistryV2) handleRateLimitSetV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// RATELIMIT_SET|session_id|route_id|requests|window
 	if len(parts) < 5 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -998,7 +1537,7 @@ func (r *RegistryV2) handleRateLimitSetV2(conn net.Conn, sessionID SessionID, pa
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -1017,7 +1556,7 @@ func (r *RegistryV2) handleRateLimitSetV2(conn net.Conn, sessionID SessionID, pa
 func (r *RegistryV2) handleCircuitBreakerSetV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// CIRCUIT_BREAKER_SET|session_id|route_id|threshold|timeout|half_open_requests
 	if len(parts) < 6 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -1032,7 +1571,7 @@ func (r *RegistryV2) handleCircuitBreakerSetV2(conn net.Conn, sessionID SessionI
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -1053,7 +1592,7 @@ func (r *RegistryV2) handleCircuitBreakerSetV2(conn net.Conn, sessionID SessionI
 func (r *RegistryV2) handleCircuitBreakerStatusV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// CIRCUIT_BREAKER_STATUS|session_id|route_id
 	if len(parts) < 3 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -1064,7 +1603,7 @@ func (r *RegistryV2) handleCircuitBreakerStatusV2(conn net.Conn, sessionID Sessi
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -1073,25 +1612,27 @@ func (r *RegistryV2) handleCircuitBreakerStatusV2(conn net.Conn, sessionID Sessi
 	svc.mu.RUnlock()
 
 	if !found {
-		conn.Write([]byte("ERROR|route not found\n"))
+		writeError(conn, ErrCodeRouteNotFound, "route not found")
 		return
 	}
 
 	// Query actual backend status from proxy
 	backendStatus := r.proxyServer.GetBackendStatus(route.Domains[0], route.Path)
 	if backendStatus == nil {
-		conn.Write([]byte("ERROR|backend status unavailable\n"))
+		writeError(conn, ErrCodeUnavailable, "backend status unavailable")
 		return
 	}
 
 	status := map[string]interface{}{
-		"state":          backendStatus.CircuitState,
-		"failures":       backendStatus.Failures,
-		"successes":      backendStatus.Successes,
-		"last_failure":   backendStatus.LastFailure.Format(time.RFC3339),
-		"healthy":        backendStatus.Healthy,
-		"in_maintenance": backendStatus.InMaintenance,
-		"draining":       backendStatus.Draining,
+		"state":               backendStatus.CircuitState,
+		"forced":              backendStatus.CircuitForced,
+		"failures":            backendStatus.Failures,
+		"successes":           backendStatus.Successes,
+		"last_failure":        backendStatus.LastFailure.Format(time.RFC3339),
+		"healthy":             backendStatus.Healthy,
+		"in_maintenance":      backendStatus.InMaintenance,
+		"draining":            backendStatus.Draining,
+		"validation_failures": backendStatus.ValidationFailures,
 	}
 
 	data, _ := json.Marshal(status)
@@ -1101,7 +1642,7 @@ func (r *RegistryV2) handleCircuitBreakerStatusV2(conn net.Conn, sessionID Sessi
 func (r *RegistryV2) handleCircuitBreakerResetV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// CIRCUIT_BREAKER_RESET|session_id|route_id
 	if len(parts) < 3 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -1112,7 +1653,7 @@ func (r *RegistryV2) handleCircuitBreakerResetV2(conn net.Conn, sessionID Sessio
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -1124,27 +1665,70 @@ func (r *RegistryV2) handleCircuitBreakerResetV2(conn net.Conn, sessionID Sessio
 		conn.Write([]byte("CIRCUIT_OK\n"))
 	} else {
 		svc.mu.Unlock()
-		conn.Write([]byte("ERROR|circuit breaker not found\n"))
+		writeError(conn, ErrCodeNotFound, "circuit breaker not found")
+	}
+}
+
+func (r *RegistryV2) handleCircuitBreakerForceV2(conn net.Conn, sessionID SessionID, parts []string) {
+	// CIRCUIT_BREAKER_FORCE|session_id|route_id|open|close|auto
+	if len(parts) < 4 {
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
+		return
+	}
+
+	routeID := RouteID(parts[2])
+	mode := parts[3]
+	if mode != proxy.CircuitForceOpen && mode != proxy.CircuitForceClose && mode != proxy.CircuitForceAuto {
+		writeError(conn, ErrCodeInvalidValue, "invalid mode %q: must be open, close or auto", mode)
+		return
+	}
+
+	r.mu.RLock()
+	svc, exists := r.services[sessionID]
+	r.mu.RUnlock()
+
+	if !exists {
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
+		return
+	}
+
+	svc.mu.RLock()
+	route, found := svc.activeRoutes[routeID]
+	svc.mu.RUnlock()
+
+	if !found {
+		writeError(conn, ErrCodeRouteNotFound, "route not found")
+		return
+	}
+
+	if err := r.proxyServer.ForceCircuitBreaker(route.Domains, route.Path, mode); err != nil {
+		writeError(conn, ErrCodeApplyFailed, "%s", err)
+		return
 	}
+	log.Printf("[registry-v2] Circuit breaker of route %s forced %s by %s", routeID, mode, svc.ServiceName)
+	conn.Write([]byte("CIRCUIT_OK\n"))
 }
 
-func (r *RegistryV2) handleConfigValidateV2(conn net.Conn, sessionID SessionID) {
+func (r *RegistryV2) handleConfigValidateV2(conn net.Conn, sessionID SessionID, parts []string) {
+	// CONFIG_VALIDATE|session_id[|probe]
+	probe := len(parts) > 2 && parts[2] == "probe"
+
 	r.mu.RLock()
 	svc, exists := r.services[sessionID]
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
 	svc.mu.RLock()
 	defer svc.mu.RUnlock()
 
-	// Validate all staged routes
-	for routeID, route := range svc.stagedRoutes {
-		if err := validateRoute(route.Domains, route.Path, route.BackendURL); err != nil {
-			conn.Write([]byte(fmt.Sprintf("ERROR|route %s: %s\n", routeID, err)))
+	// Validate all staged routes, as the proxy would build them
+	for _, routeID := range sortedRouteIDs(svc.stagedRoutes) {
+		if perr := r.checkStagedRoute(svc, routeID, probe); perr != nil {
+			writeError(conn, perr.Code, "route %s: %s", routeID, perr.Message)
 			return
 		}
 	}
@@ -1152,43 +1736,124 @@ func (r *RegistryV2) handleConfigValidateV2(conn net.Conn, sessionID SessionID)
 	conn.Write([]byte("OK\n"))
 }
 
+// checkStagedRoute validates a staged route and its options without adding
+// it; nil if it is fine. Caller must hold svc.mu.
+func (r *RegistryV2) checkStagedRoute(svc *ServiceV2, routeID RouteID, probe bool) *ProtocolError {
+	route := svc.stagedRoutes[routeID]
+	if err := validateRoute(route.Domains, route.Path, route.BackendURL); err != nil {
+		return &ProtocolError{Code: ErrCodeInvalidValue, Message: err.Error()}
+	}
+	result := r.proxyServer.ValidateRoute(route.Domains, route.Path, route.BackendURL, svc.routeOptions(routeID, route), probe)
+	if result.Valid {
+		return nil
+	}
+	if len(result.Errors) == 0 {
+		// Only the probe failed, worth retrying
+		return &ProtocolError{Code: ErrCodeUnavailable, Message: result.Error()}
+	}
+	return &ProtocolError{Code: ErrCodeInvalidValue, Message: result.Error()}
+}
+
+// replacedRouteRefs returns the active versions of the staged routes that
+// keep an active route's ID, as ROUTES_REPLACE and ROUTE_UPDATE stage them,
+// so applying swaps them instead of adding a second route next to the old
+// one. Routes staged for removal are left to the removals. Caller must hold
+// svc.mu.
+func (svc *ServiceV2) replacedRouteRefs(routeIDs []RouteID) []proxy.RouteRef {
+	var refs []proxy.RouteRef
+	for _, routeID := range routeIDs {
+		active, found := svc.activeRoutes[routeID]
+		if !found || svc.stagedRemovals[routeID] {
+			continue
+		}
+		refs = append(refs, proxy.RouteRef{Domains: active.Domains, Path: active.Path, Match: active.Match})
+	}
+	return refs
+}
+
+// routeOptions builds the proxy options of a staged route. Copied per
+// route, the match and health check entries differ. Caller must hold svc.mu.
+func (svc *ServiceV2) routeOptions(routeID RouteID, route *RouteV2) map[string]interface{} {
+	opts := make(map[string]interface{}, len(svc.stagedOptions)+4)
+	for k, v := range svc.stagedOptions {
+		opts[k] = v
+	}
+
+	opts["service_name"] = svc.ServiceName
+	opts["service_limit_key"] = string(svc.SessionID)
+	opts["match"] = route.Match
+	if len(route.Labels) > 0 {
+		opts["labels"] = route.Labels
+	}
+
+	// Include health check and rate limit in options
+	if hc, found := svc.stagedHealth[routeID]; found {
+		opts["health_check_path"] = hc.Path
+		opts["health_check_interval"] = hc.Interval.String()
+	}
+	if rl, found := svc.stagedRateLimit[routeID]; found {
+		opts["rate_limit_requests"] = rl.Requests
+		opts["rate_limit_window"] = rl.Window.String()
+	}
+	return opts
+}
+
+// sortedRouteIDs returns the IDs of routes in order, for stable replies
+func sortedRouteIDs(routes map[RouteID]*RouteV2) []RouteID {
+	ids := make([]RouteID, 0, len(routes))
+	for id := range routes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
 func (r *RegistryV2) handleConfigApplyV2(conn net.Conn, sessionID SessionID) {
 	r.mu.RLock()
 	svc, exists := r.services[sessionID]
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
+	release, perr := r.admitApply(svc)
+	if perr != nil {
+		writeError(conn, perr.Code, "%s", perr.Message)
+		return
+	}
+	defer release()
+
 	svc.mu.Lock()
 
-	// Validate first
-	for routeID, route := range svc.stagedRoutes {
-		if err := validateRoute(route.Domains, route.Path, route.BackendURL); err != nil {
+	// Validate first, nothing is applied if a route or its options are bad
+	for _, routeID := range sortedRouteIDs(svc.stagedRoutes) {
+		if perr := r.checkStagedRoute(svc, routeID, false); perr != nil {
 			svc.mu.Unlock()
-			conn.Write([]byte(fmt.Sprintf("ERROR|route %s: %s\n", routeID, err)))
+			writeError(conn, perr.Code, "route %s: %s", routeID, perr.Message)
 			return
 		}
 	}
 
-	// Apply routes
-	for routeID, route := range svc.stagedRoutes {
-		opts := svc.stagedOptions
-		if opts == nil {
-			opts = make(map[string]interface{})
-		}
-
-		// Include health check and rate limit in options
-		if hc, found := svc.stagedHealth[routeID]; found {
-			opts["health_check_path"] = hc.Path
-			opts["health_check_interval"] = hc.Interval.String()
-		}
-		if rl, found := svc.stagedRateLimit[routeID]; found {
-			opts["rate_limit_requests"] = rl.Requests
-			opts["rate_limit_window"] = rl.Window.String()
+	// Swap the routes in one batch, removals first since a replacement may
+	// serve a removed route's domains. Nothing changes if a route is rejected.
+	var (
+		removeIDs []RouteID
+		remove    []proxy.RouteRef
+		add       []proxy.RouteSpec
+	)
+	for routeID := range svc.stagedRemovals {
+		if route, found := svc.activeRoutes[routeID]; found {
+			removeIDs = append(removeIDs, routeID)
+			remove = append(remove, proxy.RouteRef{Domains: route.Domains, Path: route.Path, Match: route.Match})
 		}
+	}
+	addIDs := sortedRouteIDs(svc.stagedRoutes)
+	remove = append(remove, svc.replacedRouteRefs(addIDs)...)
+	for _, routeID := range addIDs {
+		route := svc.stagedRoutes[routeID]
+		opts := svc.routeOptions(routeID, route)
 
 		// Extract websocket flag from options
 		websocketEnabled := false
@@ -1197,13 +1862,37 @@ func (r *RegistryV2) handleConfigApplyV2(conn net.Conn, sessionID SessionID) {
 				websocketEnabled = wsBool
 			}
 		}
+		add = append(add, proxy.RouteSpec{
+			Domains:    route.Domains,
+			Path:       route.Path,
+			BackendURL: route.BackendURL,
+			Headers:    svc.stagedHeaders,
+			WebSocket:  websocketEnabled,
+			Options:    opts,
+		})
+	}
+	if err := r.proxyServer.ApplyRoutes(remove, add); err != nil {
+		svc.mu.Unlock()
+		var batchErr *proxy.RouteBatchError
+		if errors.As(err, &batchErr) {
+			writeError(conn, ErrCodeApplyFailed, "failed to add route %s: %s", addIDs[batchErr.Index], batchErr.Err)
+		} else {
+			writeError(conn, ErrCodeApplyFailed, "failed to apply routes: %s", err)
+		}
+		return
+	}
 
-		if err := r.proxyServer.AddRoute(route.Domains, route.Path, route.BackendURL, svc.stagedHeaders, websocketEnabled, opts); err != nil {
-			svc.mu.Unlock()
-			conn.Write([]byte(fmt.Sprintf("ERROR|failed to add route %s: %s\n", routeID, err)))
-			return
+	for _, routeID := range removeIDs {
+		delete(svc.activeRoutes, routeID)
+		// Remove health check
+		if r.healthChecker != nil {
+			r.healthChecker.RemoveService(string(routeID))
+			log.Printf("[registry-v2] Health check removed for %s", routeID)
 		}
+	}
 
+	for _, routeID := range addIDs {
+		route := svc.stagedRoutes[routeID]
 		svc.activeRoutes[routeID] = route
 
 		// Register health check if configured
@@ -1222,19 +1911,6 @@ func (r *RegistryV2) handleConfigApplyV2(conn net.Conn, sessionID SessionID) {
 		}
 	}
 
-	// Apply removals
-	for routeID := range svc.stagedRemovals {
-		if route, found := svc.activeRoutes[routeID]; found {
-			r.proxyServer.RemoveRoute(route.Domains, route.Path)
-			delete(svc.activeRoutes, routeID)
-			// Remove health check
-			if r.healthChecker != nil {
-				r.healthChecker.RemoveService(string(routeID))
-				log.Printf("[registry-v2] Health check removed for %s", routeID)
-			}
-		}
-	}
-
 	// Apply headers and options
 	if len(svc.stagedHeaders) > 0 {
 		svc.activeHeaders = make(map[string]string)
@@ -1248,6 +1924,9 @@ func (r *RegistryV2) handleConfigApplyV2(conn net.Conn, sessionID SessionID) {
 		for k, v := range svc.stagedOptions {
 			svc.activeOptions[k] = v
 		}
+		// Options were validated by OPTIONS_SET
+		limits, _ := serviceLimitsFrom(svc.activeOptions, svc.limits)
+		r.proxyServer.SetServiceLimits(string(sessionID), limits)
 	}
 
 	// Apply health checks, rate limits, circuit breakers
@@ -1282,7 +1961,7 @@ func (r *RegistryV2) handleConfigRollbackV2(conn net.Conn, sessionID SessionID)
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -1305,7 +1984,7 @@ func (r *RegistryV2) handleConfigDiffV2(conn net.Conn, sessionID SessionID) {
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -1327,7 +2006,7 @@ func (r *RegistryV2) handleConfigDiffV2(conn net.Conn, sessionID SessionID) {
 func (r *RegistryV2) handleConfigApplyPartialV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// CONFIG_APPLY_PARTIAL|session_id|scope
 	if len(parts) < 3 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -1338,9 +2017,16 @@ func (r *RegistryV2) handleConfigApplyPartialV2(conn net.Conn, sessionID Session
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
+		return
+	}
+
+	release, perr := r.admitApply(svc)
+	if perr != nil {
+		writeError(conn, perr.Code, "%s", perr.Message)
 		return
 	}
+	defer release()
 
 	svc.mu.Lock()
 
@@ -1349,9 +2035,19 @@ func (r *RegistryV2) handleConfigApplyPartialV2(conn net.Conn, sessionID Session
 		s = strings.TrimSpace(s)
 		switch s {
 		case "routes":
-			for routeID, route := range svc.stagedRoutes {
-				r.proxyServer.AddRoute(route.Domains, route.Path, route.BackendURL, nil, false, nil)
-				svc.activeRoutes[routeID] = route
+			routeIDs := sortedRouteIDs(svc.stagedRoutes)
+			add := make([]proxy.RouteSpec, 0, len(routeIDs))
+			for _, routeID := range routeIDs {
+				route := svc.stagedRoutes[routeID]
+				add = append(add, proxy.RouteSpec{Domains: route.Domains, Path: route.Path, BackendURL: route.BackendURL})
+			}
+			if err := r.proxyServer.ApplyRoutes(svc.replacedRouteRefs(routeIDs), add); err != nil {
+				svc.mu.Unlock()
+				writeError(conn, ErrCodeApplyFailed, "failed to apply routes: %s", err)
+				return
+			}
+			for _, routeID := range routeIDs {
+				svc.activeRoutes[routeID] = svc.stagedRoutes[routeID]
 			}
 			svc.stagedRoutes = make(map[RouteID]*RouteV2)
 		case "headers":
@@ -1388,7 +2084,7 @@ func (r *RegistryV2) handleStatsGetV2(conn net.Conn, sessionID SessionID, parts
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -1414,52 +2110,167 @@ func (r *RegistryV2) handleStatsGetV2(conn net.Conn, sessionID SessionID, parts
 	conn.Write([]byte(fmt.Sprintf("STATS_OK|%s\n", string(data))))
 }
 
-func (r *RegistryV2) handleBackendTestV2(conn net.Conn, sessionID SessionID, parts []string) {
-	_ = sessionID
-	// BACKEND_TEST|session_id|backend_url
-	if len(parts) < 3 {
-		conn.Write([]byte("ERROR|invalid format\n"))
-		return
-	}
+// backendTestMaxBody caps how much of a BACKEND_TEST response is read
+const backendTestMaxBody = 10 << 20
 
-	backendURL := parts[2]
+// backendTestParallel bounds concurrent probes in BACKEND_TEST_BULK
+const backendTestParallel = 8
 
-	// Make HTTP GET request to backend
+// backendProbe is one backend check requested by BACKEND_TEST
+type backendProbe struct {
+	Path            string // Default "/"
+	ExpectedStatus  int    // 0 accepts any status
+	FollowRedirects bool
+}
+
+// parseBackendProbe reads the optional path|expected_status|follow_redirects
+// fields shared by BACKEND_TEST and BACKEND_TEST_BULK
+func parseBackendProbe(fields []string) (backendProbe, error) {
+	probe := backendProbe{Path: "/", FollowRedirects: true}
+	if len(fields) > 0 && fields[0] != "" {
+		probe.Path = fields[0]
+		if !strings.HasPrefix(probe.Path, "/") {
+			probe.Path = "/" + probe.Path
+		}
+	}
+	if len(fields) > 1 && fields[1] != "" {
+		code, err := strconv.Atoi(fields[1])
+		if err != nil || code < 100 || code > 599 {
+			return probe, fmt.Errorf("invalid expected status")
+		}
+		probe.ExpectedStatus = code
+	}
+	if len(fields) > 2 && fields[2] != "" {
+		follow, err := strconv.ParseBool(fields[2])
+		if err != nil {
+			return probe, fmt.Errorf("invalid follow_redirects")
+		}
+		probe.FollowRedirects = follow
+	}
+	return probe, nil
+}
+
+// testBackend runs probe against backendURL and reports whether it passed
+func (r *RegistryV2) testBackend(backendURL string, probe backendProbe) (map[string]interface{}, bool) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	req, _ := http.NewRequestWithContext(ctx, "GET", backendURL+"/", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(backendURL, "/")+probe.Path, nil)
+	if err != nil {
+		return map[string]interface{}{
+			"reachable": false,
+			"error":     "invalid backend url",
+		}, false
+	}
 	timeout := r.upstreamTimeout
 	if timeout <= 0 {
 		timeout = 5 * time.Second
 	}
 	client := &http.Client{Timeout: timeout}
+	if !probe.FollowRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	start := time.Now()
 	resp, err := client.Do(req)
-
 	if err != nil {
-		result := map[string]interface{}{
+		return map[string]interface{}{
 			"reachable": false,
 			"error":     err.Error(),
-		}
-		data, _ := json.Marshal(result)
-		conn.Write([]byte(fmt.Sprintf("BACKEND_FAIL|%s\n", string(data))))
-		return
+		}, false
 	}
 	defer resp.Body.Close()
 
+	// Size is capped so a large page cannot stall the registry
+	size, _ := io.Copy(io.Discard, io.LimitReader(resp.Body, backendTestMaxBody))
+
 	result := map[string]interface{}{
-		"reachable":   true,
-		"status_code": resp.StatusCode,
-		"tls_valid":   resp.TLS != nil,
+		"reachable":        true,
+		"status_code":      resp.StatusCode,
+		"tls_valid":        resp.TLS != nil,
+		"response_time_ms": time.Since(start).Milliseconds(),
+		"response_bytes":   size,
+		"url":              resp.Request.URL.String(),
+	}
+	if location := resp.Header.Get("Location"); location != "" && !probe.FollowRedirects {
+		result["location"] = location
+	}
+	if probe.ExpectedStatus != 0 && resp.StatusCode != probe.ExpectedStatus {
+		result["error"] = fmt.Sprintf("expected status %d, got %d", probe.ExpectedStatus, resp.StatusCode)
+		return result, false
+	}
+	return result, true
+}
+
+func (r *RegistryV2) handleBackendTestV2(conn net.Conn, sessionID SessionID, parts []string) {
+	_ = sessionID
+	// BACKEND_TEST|session_id|backend_url[|path[|expected_status[|follow_redirects]]]
+	if len(parts) < 3 {
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
+		return
+	}
+
+	probe, err := parseBackendProbe(parts[3:])
+	if err != nil {
+		writeError(conn, ErrCodeInvalidValue, "%s", err)
+		return
 	}
+
+	result, ok := r.testBackend(parts[2], probe)
 	data, _ := json.Marshal(result)
+	if !ok {
+		conn.Write([]byte(fmt.Sprintf("BACKEND_FAIL|%s\n", string(data))))
+		return
+	}
 	conn.Write([]byte(fmt.Sprintf("BACKEND_OK|%s\n", string(data))))
 }
 
+func (r *RegistryV2) handleBackendTestBulkV2(conn net.Conn, sessionID SessionID, parts []string) {
+	_ = sessionID
+	// BACKEND_TEST_BULK|session_id|json_array_of_urls[|path[|expected_status[|follow_redirects]]]
+	if len(parts) < 3 {
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
+		return
+	}
+
+	var urls []string
+	if err := json.Unmarshal([]byte(parts[2]), &urls); err != nil || len(urls) == 0 {
+		writeError(conn, ErrCodeInvalidFormat, "invalid json")
+		return
+	}
+	probe, err := parseBackendProbe(parts[3:])
+	if err != nil {
+		writeError(conn, ErrCodeInvalidValue, "%s", err)
+		return
+	}
+
+	results := make([]map[string]interface{}, len(urls))
+	sem := make(chan struct{}, backendTestParallel)
+	var wg sync.WaitGroup
+	for i, backendURL := range urls {
+		wg.Add(1)
+		go func(i int, backendURL string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result, ok := r.testBackend(backendURL, probe)
+			result["backend_url"] = backendURL
+			result["ok"] = ok
+			results[i] = result
+		}(i, backendURL)
+	}
+	wg.Wait()
+
+	data, _ := json.Marshal(results)
+	conn.Write([]byte(fmt.Sprintf("BACKEND_BULK_OK|%s\n", string(data))))
+}
+
 func (r *RegistryV2) handleDrainStartV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// DRAIN_START|session_id|duration
 	if len(parts) < 3 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -1470,7 +2281,7 @@ func (r *RegistryV2) handleDrainStartV2(conn net.Conn, sessionID SessionID, part
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -1497,14 +2308,14 @@ func (r *RegistryV2) handleDrainStatusV2(conn net.Conn, sessionID SessionID) {
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
 	svc.mu.RLock()
 	if !svc.draining {
 		svc.mu.RUnlock()
-		conn.Write([]byte("ERROR|no drain in progress\n"))
+		writeError(conn, ErrCodeNotFound, "no drain in progress")
 		return
 	}
 
@@ -1539,14 +2350,14 @@ func (r *RegistryV2) handleDrainCancelV2(conn net.Conn, sessionID SessionID) {
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
 	svc.mu.Lock()
 	if !svc.draining {
 		svc.mu.Unlock()
-		conn.Write([]byte("ERROR|no drain in progress\n"))
+		writeError(conn, ErrCodeNotFound, "no drain in progress")
 		return
 	}
 
@@ -1566,7 +2377,7 @@ func (r *RegistryV2) handleDrainCancelV2(conn net.Conn, sessionID SessionID) {
 func (r *RegistryV2) handleSubscribeV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// SUBSCRIBE|session_id|event_type
 	if len(parts) < 3 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -1577,7 +2388,7 @@ func (r *RegistryV2) handleSubscribeV2(conn net.Conn, sessionID SessionID, parts
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -1591,7 +2402,7 @@ func (r *RegistryV2) handleSubscribeV2(conn net.Conn, sessionID SessionID, parts
 func (r *RegistryV2) handleUnsubscribeV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// UNSUBSCRIBE|session_id|event_type
 	if len(parts) < 3 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -1602,7 +2413,7 @@ func (r *RegistryV2) handleUnsubscribeV2(conn net.Conn, sessionID SessionID, par
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -1657,8 +2468,8 @@ func (r *RegistryV2) processMaintenanceTask(task *maintenanceTask) {
 
 	// Failed to verify after all retries
 	log.Printf("[registry-v2] Maintenance verification timeout for %s: %s", task.sessionID, task.url)
-	task.conn.Write([]byte(fmt.Sprintf("ERROR|timeout waiting for %s to become reachable\n",
-		map[bool]string{true: "maintenance page", false: "backend"}[task.isEnter])))
+	writeError(task.conn, ErrCodeTimeout, "timeout waiting for %s to become reachable",
+		map[bool]string{true: "maintenance page", false: "backend"}[task.isEnter])
 
 	// Clean up
 	r.maintCancelMu.Lock()
@@ -1691,21 +2502,28 @@ func (r *RegistryV2) verifyMaintenanceURL(maintenanceURL string) error {
 }
 
 func (r *RegistryV2) handleMaintenanceEnterV2(conn net.Conn, sessionID SessionID, parts []string) {
-	// MAINT_ENTER|session_id|target|maintenance_page_url
+	// MAINT_ENTER|session_id|target|maintenance_page_url[|eta[|reason]]
 	if len(parts) < 4 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
 	target := parts[2]
 	maintenancePageURL := parts[3] // Custom maintenance page URL (can be empty for default)
-
+	// Optional details for the proxy's own maintenance page
+	var eta, reason string
+	if len(parts) > 4 {
+		eta = strings.TrimSpace(parts[4])
+	}
+	if len(parts) > 5 {
+		reason = strings.TrimSpace(parts[5])
+	}
 	r.mu.RLock()
 	svc, exists := r.services[sessionID]
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -1716,9 +2534,7 @@ func (r *RegistryV2) handleMaintenanceEnterV2(conn net.Conn, sessionID SessionID
 		for routeID, route := range svc.activeRoutes {
 			svc.maintenanceRoutes[routeID] = true
 			// Set maintenance in proxy with custom page URL
-			if err := r.proxyServer.SetMaintenance(route.Domains, route.Path, true, maintenancePageURL); err != nil {
-				log.Printf("[registry-v2] Warning: failed to set maintenance for %s: %s", routeID, err)
-			}
+			r.setRouteMaintenance(routeID, route, maintenancePageURL, eta, reason)
 		}
 	} else {
 		// Specific routes
@@ -1727,9 +2543,7 @@ func (r *RegistryV2) handleMaintenanceEnterV2(conn net.Conn, sessionID SessionID
 			routeID := RouteID(strings.TrimSpace(t))
 			svc.maintenanceRoutes[routeID] = true
 			if route, found := svc.activeRoutes[routeID]; found {
-				if err := r.proxyServer.SetMaintenance(route.Domains, route.Path, true, maintenancePageURL); err != nil {
-					log.Printf("[registry-v2] Warning: failed to set maintenance for %s: %s", routeID, err)
-				}
+				r.setRouteMaintenance(routeID, route, maintenancePageURL, eta, reason)
 			}
 		}
 	}
@@ -1769,7 +2583,7 @@ func (r *RegistryV2) handleMaintenanceEnterV2(conn net.Conn, sessionID SessionID
 func (r *RegistryV2) handleMaintenanceExitV2(conn net.Conn, sessionID SessionID, parts []string) {
 	// MAINT_EXIT|session_id|target
 	if len(parts) < 3 {
-		conn.Write([]byte("ERROR|invalid format\n"))
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
 		return
 	}
 
@@ -1780,7 +2594,7 @@ func (r *RegistryV2) handleMaintenanceExitV2(conn net.Conn, sessionID SessionID,
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -1816,9 +2630,7 @@ func (r *RegistryV2) handleMaintenanceExitV2(conn net.Conn, sessionID SessionID,
 		// Exit all from maintenance
 		for routeID, route := range svc.activeRoutes {
 			if svc.maintenanceRoutes[routeID] {
-				if err := r.proxyServer.SetMaintenance(route.Domains, route.Path, false, ""); err != nil {
-					log.Printf("[registry-v2] Warning: failed to exit maintenance for %s: %s", routeID, err)
-				}
+				r.clearRouteMaintenance(routeID, route)
 			}
 		}
 		svc.maintenanceRoutes = make(map[RouteID]bool)
@@ -1827,9 +2639,7 @@ func (r *RegistryV2) handleMaintenanceExitV2(conn net.Conn, sessionID SessionID,
 		for _, t := range targets {
 			routeID := RouteID(strings.TrimSpace(t))
 			if route, found := svc.activeRoutes[routeID]; found {
-				if err := r.proxyServer.SetMaintenance(route.Domains, route.Path, false, ""); err != nil {
-					log.Printf("[registry-v2] Warning: failed to exit maintenance for %s: %s", routeID, err)
-				}
+				r.clearRouteMaintenance(routeID, route)
 			}
 			delete(svc.maintenanceRoutes, routeID)
 		}
@@ -1862,13 +2672,107 @@ func (r *RegistryV2) handleMaintenanceExitV2(conn net.Conn, sessionID SessionID,
 	}
 }
 
+// setRouteMaintenance puts a route into maintenance in the proxy, with the
+// details shown on the proxy's own maintenance page. A failure is logged and
+// returned; missing details are only logged.
+func (r *RegistryV2) setRouteMaintenance(routeID RouteID, route *RouteV2, pageURL, eta, reason string) error {
+	if err := r.proxyServer.SetMaintenance(route.Domains, route.Path, true, pageURL); err != nil {
+		log.Printf("[registry-v2] Warning: failed to set maintenance for %s: %s", routeID, err)
+		return err
+	}
+	if eta != "" || reason != "" {
+		if err := r.proxyServer.SetMaintenanceDetails(route.Domains, route.Path, reason, eta); err != nil {
+			log.Printf("[registry-v2] Warning: failed to set maintenance details for %s: %s", routeID, err)
+		}
+	}
+	return nil
+}
+
+// clearRouteMaintenance takes a route out of maintenance in the proxy
+func (r *RegistryV2) clearRouteMaintenance(routeID RouteID, route *RouteV2) error {
+	if err := r.proxyServer.SetMaintenance(route.Domains, route.Path, false, ""); err != nil {
+		log.Printf("[registry-v2] Warning: failed to exit maintenance for %s: %s", routeID, err)
+		return err
+	}
+	return nil
+}
+
+// ServiceMaintenanceResult is what SetServicesMaintenance did for one service
+type ServiceMaintenanceResult struct {
+	Service string   `json:"service"`
+	Routes  []string `json:"routes"`           // domains/path of each route changed
+	Failed  []string `json:"failed,omitempty"` // Routes the proxy refused, with the error
+	Error   string   `json:"error,omitempty"`  // Set when the service is not registered
+}
+
+// SetServicesMaintenance enters or exits maintenance for every route of the
+// named services, across all their sessions and instances, as MAINT_ENTER
+// and MAINT_EXIT with target ALL would. "all" selects every registered
+// service. Results are in the order given, or by name for "all".
+func (r *RegistryV2) SetServicesMaintenance(services []string, enabled bool, pageURL, eta, reason string) []ServiceMaintenanceResult {
+	bySvc := make(map[string][]*ServiceV2)
+	r.mu.RLock()
+	for _, svc := range r.services {
+		bySvc[svc.ServiceName] = append(bySvc[svc.ServiceName], svc)
+	}
+	r.mu.RUnlock()
+
+	if len(services) == 1 && services[0] == "all" {
+		services = make([]string, 0, len(bySvc))
+		for name := range bySvc {
+			services = append(services, name)
+		}
+		sort.Strings(services)
+	}
+
+	results := make([]ServiceMaintenanceResult, 0, len(services))
+	for _, name := range services {
+		result := ServiceMaintenanceResult{Service: name, Routes: []string{}}
+		sessions, found := bySvc[name]
+		if !found {
+			result.Error = "service not registered"
+			results = append(results, result)
+			continue
+		}
+		for _, svc := range sessions {
+			svc.mu.Lock()
+			for routeID, route := range svc.activeRoutes {
+				var err error
+				switch {
+				case enabled:
+					err = r.setRouteMaintenance(routeID, route, pageURL, eta, reason)
+				case svc.maintenanceRoutes[routeID]:
+					err = r.clearRouteMaintenance(routeID, route)
+				default:
+					continue
+				}
+				label := strings.Join(route.Domains, ",") + route.Path
+				if err != nil {
+					result.Failed = append(result.Failed, label+": "+err.Error())
+					continue
+				}
+				if enabled {
+					svc.maintenanceRoutes[routeID] = true
+				} else {
+					delete(svc.maintenanceRoutes, routeID)
+				}
+				result.Routes = append(result.Routes, label)
+			}
+			svc.mu.Unlock()
+		}
+		sort.Strings(result.Routes)
+		results = append(results, result)
+	}
+	return results
+}
+
 func (r *RegistryV2) handleMaintenanceStatusV2(conn net.Conn, sessionID SessionID) {
 	r.mu.RLock()
 	svc, exists := r.services[sessionID]
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
@@ -1878,10 +2782,12 @@ func (r *RegistryV2) handleMaintenanceStatusV2(conn net.Conn, sessionID SessionI
 		inMaint = append(inMaint, string(routeID))
 	}
 
+	svc.mu.RUnlock()
+
 	status := map[string]interface{}{
 		"in_maintenance": inMaint,
+		"schedules":      r.maintenanceSchedulesOf(svc.ServiceName, svc.InstanceName),
 	}
-	svc.mu.RUnlock()
 
 	data, _ := json.Marshal(status)
 	conn.Write([]byte(fmt.Sprintf("MAINT_STATUS_OK|%s\n", string(data))))
@@ -1893,17 +2799,18 @@ func (r *RegistryV2) handleClientShutdownV2(conn net.Conn, sessionID SessionID)
 	r.mu.RUnlock()
 
 	if !exists {
-		conn.Write([]byte("ERROR|session not found\n"))
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
 		return
 	}
 
 	svc.mu.Lock()
 	// Remove all active routes
 	for routeID, route := range svc.activeRoutes {
-		r.proxyServer.RemoveRoute(route.Domains, route.Path)
+		r.proxyServer.RemoveRouteMatch(route.Domains, route.Path, route.Match)
 		delete(svc.activeRoutes, routeID)
 	}
 	svc.mu.Unlock()
+	r.proxyServer.SetServiceLimits(string(sessionID), proxy.ServiceLimits{})
 
 	r.mu.Lock()
 	delete(r.services, sessionID)
@@ -1938,6 +2845,7 @@ func (r *RegistryV2) cleanupExpiredStagedConfigs(ctx context.Context) {
 				svc.mu.Lock()
 				if time.Now().After(svc.stagedTimeout) && len(svc.stagedRoutes) > 0 {
 					log.Printf("[registry-v2] Expiring staged config for session %s", svc.SessionID)
+					r.metrics.stagedExpired.Add(1)
 					svc.stagedRoutes = make(map[RouteID]*RouteV2)
 					svc.stagedHeaders = make(map[string]string)
 					svc.stagedOptions = make(map[string]interface{})
@@ -1949,6 +2857,48 @@ func (r *RegistryV2) cleanupExpiredStagedConfigs(ctx context.Context) {
 	}
 }
 
+// reapIdleSessions closes connections that have been silent for longer than
+// idleTimeout. TCP keepalive misses a peer that is up but hung; closing the
+// connection lets handleConnectionV2 disable its routes and start the grace
+// period as for any other dropped connection.
+func (r *RegistryV2) reapIdleSessions(ctx context.Context) {
+	if r.idleTimeout <= 0 {
+		return
+	}
+	interval := r.idleTimeout / 4
+	if interval > 5*time.Second {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			var idle []net.Conn
+			r.mu.RLock()
+			for sid, svc := range r.services {
+				svc.mu.RLock()
+				if svc.Connection != nil && svc.DisconnectedAt == nil && now.Sub(svc.LastActivity) > r.idleTimeout {
+					idle = append(idle, svc.Connection)
+					log.Printf("[registry-v2] Session %s (%s) idle for %v - closing connection",
+						sid, svc.ServiceName, now.Sub(svc.LastActivity).Round(time.Second))
+				}
+				svc.mu.RUnlock()
+			}
+			r.mu.RUnlock()
+
+			for _, conn := range idle {
+				r.metrics.idleClosed.Add(1)
+				_ = conn.Close()
+			}
+		}
+	}
+}
+
 func (r *RegistryV2) cleanupDisconnectedSessions(ctx context.Context) {
 	ticker := time.NewTicker(5 * time.Second) // Check frequently for expired sessions
 	defer ticker.Stop()
@@ -1982,7 +2932,7 @@ func (r *RegistryV2) cleanupDisconnectedSessions(ctx context.Context) {
 					svc.mu.Lock()
 					// Remove all routes from proxy (they were disabled, now fully remove them)
 					for routeID, route := range svc.activeRoutes {
-						r.proxyServer.RemoveRoute(route.Domains, route.Path)
+						r.proxyServer.RemoveRouteMatch(route.Domains, route.Path, route.Match)
 						log.Printf("[registry-v2] Removed route %s: %v%s (grace period expired)", routeID, route.Domains, route.Path)
 					}
 
@@ -1991,6 +2941,7 @@ func (r *RegistryV2) cleanupDisconnectedSessions(ctx context.Context) {
 						r.healthChecker.RemoveService(string(routeID))
 					}
 					svc.mu.Unlock()
+					r.proxyServer.SetServiceLimits(string(sid), proxy.ServiceLimits{})
 
 					// Remove service from registry
 					r.mu.Lock()
@@ -2002,6 +2953,182 @@ func (r *RegistryV2) cleanupDisconnectedSessions(ctx context.Context) {
 	}
 }
 
+// serviceLimitsFrom overrides base with max_connections and max_bandwidth
+// from REGISTER metadata or session options. Values may be numbers or strings;
+// bandwidth takes K, M and G suffixes (bytes per second).
+func serviceLimitsFrom(values map[string]interface{}, base proxy.ServiceLimits) (proxy.ServiceLimits, error) {
+	limits := base
+	for _, key := range []string{"max_connections", "max_bandwidth"} {
+		v, ok := values[key]
+		if !ok {
+			continue
+		}
+		var limit int64
+		switch val := v.(type) {
+		case int64:
+			limit = val
+		case float64:
+			limit = int64(val)
+		case string:
+			parsed, err := parseLimit(key, val)
+			if err != nil {
+				return base, err
+			}
+			limit = parsed
+		default:
+			return base, fmt.Errorf("invalid %s", key)
+		}
+		if limit < 0 {
+			return base, fmt.Errorf("invalid %s", key)
+		}
+		if key == "max_connections" {
+			limits.MaxConnections = int(limit)
+		} else {
+			limits.BytesPerSecond = limit
+		}
+	}
+	return limits, nil
+}
+
+// parseLimit parses a max_connections count, or a max_bandwidth rate or
+// mirror_max_body or max_response_body size such as "10M"
+func parseLimit(key, value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	multiplier := int64(1)
+	if (key == "max_bandwidth" || key == "mirror_max_body" || key == "max_response_body") && value != "" {
+		switch value[len(value)-1] {
+		case 'K', 'k':
+			multiplier = 1 << 10
+		case 'M', 'm':
+			multiplier = 1 << 20
+		case 'G', 'g':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			value = value[:len(value)-1]
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s", key)
+	}
+	return n * multiplier, nil
+}
+
+// parseRouteEntries validates the route objects of ROUTE_ADD_BULK and
+// ROUTES_REPLACE; the returned routes have no ID yet
+func parseRouteEntries(routes []map[string]interface{}) ([]*RouteV2, error) {
+	parsed := make([]*RouteV2, 0, len(routes))
+	for _, route := range routes {
+		domains := parseStringArray(route["domains"])
+		path, _ := route["path"].(string)
+		backendURL, _ := route["backend_url"].(string)
+		priority := int(getFloat64(route["priority"]))
+
+		if err := validateRoute(domains, path, backendURL); err != nil {
+			return nil, err
+		}
+		match, err := routeMatchFrom(route)
+		if err != nil {
+			return nil, err
+		}
+		labels, err := routeLabelsFrom(route)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed = append(parsed, &RouteV2{
+			Domains:      domains,
+			Path:         path,
+			BackendURL:   backendURL,
+			Priority:     priority,
+			Match:        match,
+			Labels:       labels,
+			CreatedAt:    time.Now(),
+			LastModified: time.Now(),
+		})
+	}
+	return parsed, nil
+}
+
+// routeKey identifies what a route serves: its domains, path and predicates
+func routeKey(route *RouteV2) string {
+	domains := append([]string(nil), route.Domains...)
+	sort.Strings(domains)
+	return strings.Join(domains, ",") + "|" + route.Path + "|" + route.Match.Key()
+}
+
+// routeMatchFrom reads the header_match, cookie_match and query_match
+// predicates of a ROUTE_ADD_BULK entry
+func routeMatchFrom(route map[string]interface{}) (proxy.RouteMatch, error) {
+	var match proxy.RouteMatch
+	fields := []struct {
+		name string
+		dst  *[]proxy.ValueMatch
+	}{
+		{"header_match", &match.Headers},
+		{"cookie_match", &match.Cookies},
+		{"query_match", &match.Query},
+	}
+	for _, f := range fields {
+		raw, ok := route[f.name]
+		if !ok || raw == nil {
+			continue
+		}
+		data, _ := json.Marshal(raw)
+		if err := json.Unmarshal(data, f.dst); err != nil {
+			return match, fmt.Errorf("invalid %s", f.name)
+		}
+	}
+	return match, match.Validate()
+}
+
+// routeLabelsFrom reads the labels object of a ROUTE_ADD_BULK entry
+func routeLabelsFrom(route map[string]interface{}) (map[string]string, error) {
+	raw, ok := route["labels"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	var labels map[string]string
+	data, _ := json.Marshal(raw)
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return nil, fmt.Errorf("invalid labels")
+	}
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	return labels, config.ValidateRouteLabels(labels)
+}
+
+// parseRouteLabels reads the key=value[,key=value] labels of ROUTE_ADD
+func parseRouteLabels(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q: expected key=value", pair)
+		}
+		labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return labels, config.ValidateRouteLabels(labels)
+}
+
+// addMatchFields adds a route's predicates to a ROUTE_LIST entry
+func addMatchFields(entry map[string]interface{}, match proxy.RouteMatch) {
+	if len(match.Headers) > 0 {
+		entry["header_match"] = match.Headers
+	}
+	if len(match.Cookies) > 0 {
+		entry["cookie_match"] = match.Cookies
+	}
+	if len(match.Query) > 0 {
+		entry["query_match"] = match.Query
+	}
+}
+
 func validateRoute(domains []string, path string, backendURL string) error {
 	if len(domains) == 0 {
 		return fmt.Errorf("no domains specified")
@@ -2,14 +2,20 @@ package registry
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/chilla55/proxy-manager/audit"
+	"github.com/chilla55/proxy-manager/database"
 	"github.com/chilla55/proxy-manager/proxy"
 )
 
@@ -42,7 +48,9 @@ type mockProxy struct {
 		path     string
 		duration time.Duration
 	}
+	forceCalls    []string // Circuit breaker modes
 	backendStatus *proxy.BackendStatus
+	limits        map[string]proxy.ServiceLimits
 }
 
 func (m *mockProxy) AddRoute(domains []string, path, backendURL string, headers map[string]string, websocket bool, options map[string]interface{}) error {
@@ -71,6 +79,20 @@ func (m *mockProxy) RemoveRoute(domains []string, path string) {
 	}{domains: domains, path: path})
 }
 
+func (m *mockProxy) RemoveRouteMatch(domains []string, path string, match proxy.RouteMatch) {
+	m.RemoveRoute(domains, path)
+}
+
+func (m *mockProxy) ApplyRoutes(remove []proxy.RouteRef, add []proxy.RouteSpec) error {
+	for _, ref := range remove {
+		m.RemoveRouteMatch(ref.Domains, ref.Path, ref.Match)
+	}
+	for _, spec := range add {
+		m.AddRoute(spec.Domains, spec.Path, spec.BackendURL, spec.Headers, spec.WebSocket, spec.Options)
+	}
+	return nil
+}
+
 func (m *mockProxy) SetRouteEnabled(domains []string, path string, enabled bool) {
 	m.enableCalls = append(m.enableCalls, struct {
 		domains []string
@@ -90,6 +112,10 @@ func (m *mockProxy) GetBackendStatus(domain, path string) *proxy.BackendStatus {
 	}
 }
 
+func (m *mockProxy) SetMaintenanceDetails(domains []string, path, reason, eta string) error {
+	return nil
+}
+
 func (m *mockProxy) SetMaintenance(domains []string, path string, enabled bool, maintenancePageURL string) error {
 	m.maintenanceCalls = append(m.maintenanceCalls, struct {
 		domains []string
@@ -117,6 +143,32 @@ func (m *mockProxy) CancelDrain(domains []string, path string) error {
 	return nil
 }
 
+func (m *mockProxy) ForceCircuitBreaker(domains []string, path, mode string) error {
+	m.forceCalls = append(m.forceCalls, mode)
+	return nil
+}
+
+func (m *mockProxy) SetServiceLimits(key string, limits proxy.ServiceLimits) {
+	if m.limits == nil {
+		m.limits = make(map[string]proxy.ServiceLimits)
+	}
+	if limits == (proxy.ServiceLimits{}) {
+		delete(m.limits, key)
+		return
+	}
+	m.limits[key] = limits
+}
+
+func (m *mockProxy) ServiceUsage(key string) (proxy.ServiceUsage, bool) {
+	limits, ok := m.limits[key]
+	return proxy.ServiceUsage{ServiceLimits: limits}, ok
+}
+
+// ValidateRoute uses the real checks, they don't depend on server state
+func (m *mockProxy) ValidateRoute(domains []string, path, backendURL string, options map[string]interface{}, probe bool) proxy.RouteValidation {
+	return new(proxy.Server).ValidateRoute(domains, path, backendURL, options, probe)
+}
+
 // mockHealthChecker implements HealthChecker for testing
 type mockHealthChecker struct {
 	addCalls []struct {
@@ -422,6 +474,338 @@ func TestRegistryV2_RouteBulkApply(t *testing.T) {
 	}
 }
 
+func TestRegistryV2_HeaderMatchRoutes(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	reg := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go reg.handleConnectionV2(ctx, server)
+
+	resp, err := send(client, "REGISTER|svc|inst1|9000|{}")
+	if err != nil {
+		t.Fatalf("register error: %v", err)
+	}
+	sessionID := strings.TrimPrefix(resp, "ACK|")
+
+	resp, _ = send(client, "ROUTE_ADD_BULK|"+sessionID+`|[{"domains":["api.example.com"],"path":"/","backend_url":"http://v2:8080","header_match":[{"name":"X-Api-Version","type":"regex","value":"("}]}]`)
+	if !strings.HasPrefix(resp, "ERROR|") {
+		t.Fatalf("expected invalid regex to be rejected, got %q", resp)
+	}
+
+	payload := `[{"domains":["api.example.com"],"path":"/","backend_url":"http://v1:8080"},` +
+		`{"domains":["api.example.com"],"path":"/","backend_url":"http://v2:8080","header_match":[{"name":"X-Api-Version","value":"2"}],` +
+		`"cookie_match":[{"name":"flag","type":"regex","value":"^canary"}],"query_match":[{"name":"beta","value":"1"}]}]`
+	resp, err = send(client, "ROUTE_ADD_BULK|"+sessionID+"|"+payload)
+	if err != nil || !strings.HasPrefix(resp, "ROUTE_BULK_OK|") {
+		t.Fatalf("bulk add err=%v resp=%q", err, resp)
+	}
+	resp, err = send(client, "CONFIG_APPLY|"+sessionID)
+	if err != nil || resp != "OK" {
+		t.Fatalf("apply err=%v resp=%q", err, resp)
+	}
+
+	if len(mp.addCalls) != 2 {
+		t.Fatalf("expected 2 AddRoute calls, got %d", len(mp.addCalls))
+	}
+	matches := map[string]string{}
+	for _, call := range mp.addCalls {
+		m, ok := call.options["match"].(proxy.RouteMatch)
+		if !ok {
+			t.Fatalf("expected match option for %s", call.backend)
+		}
+		matches[call.backend] = m.Key()
+	}
+	if matches["http://v1:8080"] != "" {
+		t.Fatalf("expected plain route without predicates, got %q", matches["http://v1:8080"])
+	}
+	if want := "cookie:flag:regex:^canary\nheader:X-Api-Version:exact:2\nquery:beta:exact:1"; matches["http://v2:8080"] != want {
+		t.Fatalf("expected %q, got %q", want, matches["http://v2:8080"])
+	}
+
+	resp, _ = send(client, "ROUTE_LIST|"+sessionID)
+	for _, field := range []string{`"header_match"`, `"cookie_match"`, `"query_match"`} {
+		if !strings.Contains(resp, field) {
+			t.Fatalf("expected %s in route list, got %q", field, resp)
+		}
+	}
+}
+
+func TestRegistryV2_RouteLabels(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	reg := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go reg.handleConnectionV2(ctx, server)
+
+	resp, err := send(client, "REGISTER|svc|inst1|9000|{}")
+	if err != nil {
+		t.Fatalf("register error: %v", err)
+	}
+	sessionID := strings.TrimPrefix(resp, "ACK|")
+
+	for _, bad := range []string{
+		"ROUTE_ADD|" + sessionID + "|a.example.com|/|http://a:8080|0|team",
+		"ROUTE_ADD|" + sessionID + "|a.example.com|/|http://a:8080|0|9team=x",
+		"ROUTE_ADD_BULK|" + sessionID + `|[{"domains":["b.example.com"],"path":"/","backend_url":"http://b:8080","labels":{"team":1}}]`,
+	} {
+		if resp, _ := send(client, bad); !strings.HasPrefix(resp, "ERROR|") {
+			t.Fatalf("expected %q to be rejected, got %q", bad, resp)
+		}
+	}
+
+	resp, _ = send(client, "ROUTE_ADD|"+sessionID+"|a.example.com|/|http://a:8080|0|team=payments, env=prod")
+	if !strings.HasPrefix(resp, "ROUTE_OK|") {
+		t.Fatalf("route add: %q", resp)
+	}
+	resp, _ = send(client, "ROUTE_ADD_BULK|"+sessionID+`|[{"domains":["b.example.com"],"path":"/","backend_url":"http://b:8080","labels":{"team":"search"}},`+
+		`{"domains":["c.example.com"],"path":"/","backend_url":"http://c:8080"}]`)
+	if !strings.HasPrefix(resp, "ROUTE_BULK_OK|") {
+		t.Fatalf("bulk add: %q", resp)
+	}
+	if resp, err := send(client, "CONFIG_APPLY|"+sessionID); err != nil || resp != "OK" {
+		t.Fatalf("apply err=%v resp=%q", err, resp)
+	}
+
+	labels := map[string]map[string]string{}
+	for _, call := range mp.addCalls {
+		l, _ := call.options["labels"].(map[string]string)
+		labels[call.backend] = l
+	}
+	if got := labels["http://a:8080"]; got["team"] != "payments" || got["env"] != "prod" {
+		t.Fatalf("expected ROUTE_ADD labels on the route, got %v", got)
+	}
+	if got := labels["http://b:8080"]; len(got) != 1 || got["team"] != "search" {
+		t.Fatalf("expected bulk labels on the route, got %v", got)
+	}
+	if got := labels["http://c:8080"]; got != nil {
+		t.Fatalf("expected no labels, got %v", got)
+	}
+
+	resp, _ = send(client, "ROUTE_LIST|"+sessionID)
+	var list []map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(resp, "ROUTE_LIST_OK|")), &list); err != nil {
+		t.Fatalf("route list: %v (%q)", err, resp)
+	}
+	withLabels := 0
+	for _, entry := range list {
+		if _, ok := entry["labels"]; ok {
+			withLabels++
+		}
+	}
+	if withLabels != 2 {
+		t.Fatalf("expected labels on 2 listed routes, got %d: %q", withLabels, resp)
+	}
+}
+
+func TestRegistryV2_RoutesReplace(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// A real proxy, so the test sees the routes requests would be served by
+	ps := proxy.NewServer(proxy.Config{})
+	reg := NewRegistryV2(0, ps, false, 100*time.Millisecond, &mockHealthChecker{})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go reg.handleConnectionV2(ctx, server)
+
+	resp, _ := send(client, "REGISTER|svc|inst1|9000|{}")
+	sessionID := strings.TrimPrefix(resp, "ACK|")
+
+	resp, _ = send(client, "ROUTE_ADD_BULK|"+sessionID+`|[{"domains":["a.example.com"],"path":"/","backend_url":"http://a:8080"},{"domains":["b.example.com"],"path":"/","backend_url":"http://b:8080"},{"domains":["c.example.com"],"path":"/","backend_url":"http://c:8080"}]`)
+	if !strings.HasPrefix(resp, "ROUTE_BULK_OK|") {
+		t.Fatalf("expected ROUTE_BULK_OK, got %q", resp)
+	}
+	if resp, _ = send(client, "CONFIG_APPLY|"+sessionID); resp != "OK" {
+		t.Fatalf("expected OK, got %q", resp)
+	}
+
+	activeRoutes := func() map[string]string {
+		resp, _ := send(client, "ROUTE_LIST|"+sessionID)
+		var list []map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(resp, "ROUTE_LIST_OK|")), &list); err != nil {
+			t.Fatalf("route list: %v (%q)", err, resp)
+		}
+		routes := map[string]string{}
+		for _, entry := range list {
+			if entry["status"] != "active" {
+				continue
+			}
+			routes[entry["backend"].(string)] = entry["route_id"].(string)
+		}
+		return routes
+	}
+	before := activeRoutes()
+
+	// Duplicates are rejected without touching the staged state
+	resp, _ = send(client, "ROUTES_REPLACE|"+sessionID+`|[{"domains":["d.example.com"],"path":"/","backend_url":"http://d:8080"},{"domains":["d.example.com"],"path":"/","backend_url":"http://d2:8080"}]`)
+	if !strings.HasPrefix(resp, "ERROR|ROUTE_CONFLICT|duplicate route") {
+		t.Fatalf("expected duplicate route error, got %q", resp)
+	}
+
+	resp, _ = send(client, "ROUTES_REPLACE|"+sessionID+`|[{"domains":["b.example.com"],"path":"/","backend_url":"http://b2:8080"},{"domains":["a.example.com","d.example.com"],"path":"/","backend_url":"http://d:8080"}]`)
+	if !strings.HasPrefix(resp, "ROUTES_REPLACE_OK|") {
+		t.Fatalf("expected ROUTES_REPLACE_OK, got %q", resp)
+	}
+	var results []map[string]string
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(resp, "ROUTES_REPLACE_OK|")), &results); err != nil {
+		t.Fatalf("replace response: %v", err)
+	}
+	statuses := map[string]int{}
+	for _, result := range results {
+		statuses[result["status"]]++
+	}
+	if statuses["updated"] != 1 || statuses["added"] != 1 || statuses["removed"] != 2 {
+		t.Fatalf("expected 1 updated, 1 added, 2 removed, got %v", results)
+	}
+
+	// Nothing changes until the apply
+	if len(activeRoutes()) != 3 {
+		t.Fatalf("expected replace to be staged only")
+	}
+	if resp, _ = send(client, "CONFIG_APPLY|"+sessionID); resp != "OK" {
+		t.Fatalf("expected OK, got %q", resp)
+	}
+
+	after := activeRoutes()
+	if len(after) != 2 || after["http://b2:8080"] == "" || after["http://d:8080"] == "" {
+		t.Fatalf("expected exactly the replaced set, got %v", after)
+	}
+	if after["http://b2:8080"] != before["http://b:8080"] {
+		t.Fatalf("expected b.example.com to keep route ID %s, got %s", before["http://b:8080"], after["http://b2:8080"])
+	}
+
+	// The proxy holds exactly the replaced set: the updated route was
+	// swapped, not added next to its old version
+	summaries := ps.RouteSummaries()
+	served := map[string]string{}
+	for _, summary := range summaries {
+		served[strings.Join(summary.Domains, ",")] = summary.BackendURL
+	}
+	want := map[string]string{"b.example.com": "http://b2:8080", "a.example.com,d.example.com": "http://d:8080"}
+	if len(summaries) != len(want) {
+		t.Fatalf("expected %d routes, got %d: %+v", len(want), len(summaries), summaries)
+	}
+	for domains, backend := range want {
+		if served[domains] != backend {
+			t.Fatalf("expected %s served by %s, got %v", domains, backend, served)
+		}
+	}
+}
+
+func TestRegistryV2_RoutesReplaceAppliesChangedOptions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	ps := proxy.NewServer(proxy.Config{})
+	reg := NewRegistryV2(0, ps, false, 100*time.Millisecond, &mockHealthChecker{})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go reg.handleConnectionV2(ctx, server)
+
+	resp, _ := send(client, "REGISTER|svc|inst1|9000|{}")
+	sessionID := strings.TrimPrefix(resp, "ACK|")
+
+	routes := `[{"domains":["a.example.com"],"path":"/","backend_url":"http://a:8080"}]`
+	for _, timeout := range []string{"5s", "50ms"} {
+		if resp, _ = send(client, "OPTIONS_SET|"+sessionID+"|ALL|timeout|"+timeout); resp != "OPTIONS_OK" {
+			t.Fatalf("expected OPTIONS_OK, got %q", resp)
+		}
+		// The same route to the same backend, only the options differ
+		if resp, _ = send(client, "ROUTES_REPLACE|"+sessionID+"|"+routes); !strings.HasPrefix(resp, "ROUTES_REPLACE_OK|") {
+			t.Fatalf("expected ROUTES_REPLACE_OK, got %q", resp)
+		}
+		if resp, _ = send(client, "CONFIG_APPLY|"+sessionID); resp != "OK" {
+			t.Fatalf("expected OK, got %q", resp)
+		}
+
+		want, _ := time.ParseDuration(timeout)
+		status := ps.GetBackendStatus("a.example.com", "/")
+		if status == nil || status.Timeout != want {
+			t.Fatalf("expected the served backend to use timeout %s, got %+v", timeout, status)
+		}
+	}
+	if n := len(ps.RouteSummaries()); n != 1 {
+		t.Fatalf("expected 1 route, got %d", n)
+	}
+}
+
+func TestRegistryV2_ConfigValidateOptions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	reg := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go reg.handleConnectionV2(ctx, server)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	resp, _ := send(client, "REGISTER|svc|inst1|9000|{}")
+	sessionID := strings.TrimPrefix(resp, "ACK|")
+
+	resp, _ = send(client, "ROUTE_ADD|"+sessionID+"|example.com|/|"+backend.URL+"|0")
+	if !strings.HasPrefix(resp, "ROUTE_OK|") {
+		t.Fatalf("expected ROUTE_OK, got %q", resp)
+	}
+	routeID := strings.TrimPrefix(resp, "ROUTE_OK|")
+
+	// A bad duration used to be dropped silently; now validate and apply report it
+	if resp, _ = send(client, "OPTIONS_SET|"+sessionID+"|ALL|timeout|ten"); resp != "OPTIONS_OK" {
+		t.Fatalf("expected OPTIONS_OK, got %q", resp)
+	}
+	want := "ERROR|INVALID_VALUE|route " + routeID + `: timeout: invalid duration "ten"`
+	if resp, _ = send(client, "CONFIG_VALIDATE|"+sessionID); resp != want {
+		t.Fatalf("expected %q, got %q", want, resp)
+	}
+	if resp, _ = send(client, "CONFIG_APPLY|"+sessionID); resp != want {
+		t.Fatalf("expected %q, got %q", want, resp)
+	}
+	if len(mp.addCalls) != 0 {
+		t.Fatalf("expected nothing applied, got %d AddRoute calls", len(mp.addCalls))
+	}
+
+	if resp, _ = send(client, "OPTIONS_SET|"+sessionID+"|ALL|timeout|10s"); resp != "OPTIONS_OK" {
+		t.Fatalf("expected OPTIONS_OK, got %q", resp)
+	}
+	if resp, _ = send(client, "CONFIG_VALIDATE|"+sessionID+"|probe"); resp != "OK" {
+		t.Fatalf("expected reachable backend to validate, got %q", resp)
+	}
+
+	backend.Close()
+	resp, _ = send(client, "CONFIG_VALIDATE|"+sessionID+"|probe")
+	if !strings.HasPrefix(resp, "ERROR|UNAVAILABLE|route "+routeID+": backend unreachable: ") {
+		t.Fatalf("expected unreachable backend, got %q", resp)
+	}
+	if resp, _ = send(client, "CONFIG_VALIDATE|"+sessionID); resp != "OK" {
+		t.Fatalf("expected validate without probe to pass, got %q", resp)
+	}
+}
+
 func TestRegistryV2_MaintenanceFlow(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -541,6 +925,8 @@ func TestRegistryV2_CircuitBreakerFlow(t *testing.T) {
 
 	mp := &mockProxy{}
 	reg := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+	auditLog := &auditStore{}
+	reg.SetAuditLogger(audit.NewLogger(auditLog, true))
 
 	server, client := net.Pipe()
 	defer server.Close()
@@ -594,6 +980,62 @@ func TestRegistryV2_CircuitBreakerFlow(t *testing.T) {
 	if resp != "CIRCUIT_OK" {
 		t.Fatalf("expected CIRCUIT_OK, got %q", resp)
 	}
+
+	// Force open, then back to automatic
+	for _, mode := range []string{"open", "auto"} {
+		resp, err = send(client, "CIRCUIT_BREAKER_FORCE|"+sessionID+"|"+routeID+"|"+mode)
+		if err != nil || resp != "CIRCUIT_OK" {
+			t.Fatalf("force %s err=%v resp=%q", mode, err, resp)
+		}
+	}
+	if len(mp.forceCalls) != 2 || mp.forceCalls[0] != "open" || mp.forceCalls[1] != "auto" {
+		t.Fatalf("expected open then auto forwarded to the proxy, got %v", mp.forceCalls)
+	}
+	resp, err = send(client, "CIRCUIT_BREAKER_FORCE|"+sessionID+"|"+routeID+"|half-open")
+	if err != nil || !strings.HasPrefix(resp, "ERROR|INVALID_VALUE|") {
+		t.Fatalf("expected INVALID_VALUE for an unknown mode, err=%v resp=%q", err, resp)
+	}
+
+	// Status reports a forced breaker
+	mp.backendStatus = &proxy.BackendStatus{Healthy: true, CircuitState: "open", CircuitForced: true}
+	resp, err = send(client, "CIRCUIT_BREAKER_STATUS|"+sessionID+"|"+routeID)
+	if err != nil || !strings.Contains(resp, `"forced":true`) {
+		t.Fatalf("expected forced flag in status, err=%v resp=%q", err, resp)
+	}
+
+	// Control commands are audited, status queries are not
+	var actions []string
+	for _, e := range auditLog.entries {
+		actions = append(actions, e.Action)
+	}
+	want := "circuit_breaker_set config_apply circuit_breaker_reset circuit_breaker_force circuit_breaker_force circuit_breaker_force"
+	if strings.Join(actions, " ") != want {
+		t.Fatalf("audited actions = %v, want %s", actions, want)
+	}
+	forced := auditLog.entries[3]
+	if forced.User != "service:svc/inst1" || forced.ResourceID != routeID || forced.Metadata != `{"mode":"open"}` || forced.Result != audit.ResultOK {
+		t.Fatalf("unexpected audit entry %+v", forced)
+	}
+	if got := auditLog.entries[5].Result; got != "error: INVALID_VALUE" {
+		t.Fatalf("expected the rejected mode audited as failed, got %q", got)
+	}
+	if strings.Contains(auditLog.entries[1].Metadata+auditLog.entries[1].ResourceID, sessionID) {
+		t.Fatalf("session ID leaked into the audit log: %+v", auditLog.entries[1])
+	}
+}
+
+// auditStore keeps audit entries in memory
+type auditStore struct {
+	entries []database.AuditEntry
+}
+
+func (s *auditStore) LogAudit(entry database.AuditEntry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *auditStore) GetAuditLogs(filter database.AuditFilter) ([]database.AuditEntry, error) {
+	return s.entries, nil
 }
 
 func TestRegistryV2_BackendTestOK(t *testing.T) {
@@ -945,3 +1387,947 @@ func TestRegistryV2_ConfigDiffFlow(t *testing.T) {
 		t.Fatalf("expected diff to contain routes, got %q", resp)
 	}
 }
+
+func TestRegistryV2_BackendTestPath(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	reg := NewRegistryV2(0, mp, false, time.Second, &mockHealthChecker{})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go reg.handleConnectionV2(ctx, server)
+
+	resp, err := send(client, "REGISTER|svc|inst1|9000|{}")
+	if err != nil {
+		t.Fatalf("register error: %v", err)
+	}
+	sessionID := strings.TrimPrefix(resp, "ACK|")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			w.Write([]byte("healthy"))
+		case "/old":
+			http.Redirect(w, r, "/healthz", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		cmd    string
+		prefix string
+		status float64
+	}{
+		{"|healthz|200", "BACKEND_OK|", 200},
+		{"|/missing|200", "BACKEND_FAIL|", 404},
+		{"|/old|200|true", "BACKEND_OK|", 200},
+		{"|/old|302|false", "BACKEND_OK|", 302},
+	}
+	for _, tt := range tests {
+		resp, err := send(client, "BACKEND_TEST|"+sessionID+"|"+ts.URL+tt.cmd)
+		if err != nil {
+			t.Fatalf("backend test error: %v", err)
+		}
+		if !strings.HasPrefix(resp, tt.prefix) {
+			t.Fatalf("%s: expected %s, got %q", tt.cmd, tt.prefix, resp)
+		}
+		var result map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(resp, tt.prefix)), &result); err != nil {
+			t.Fatalf("%s: invalid json: %v", tt.cmd, err)
+		}
+		if result["status_code"] != tt.status {
+			t.Fatalf("%s: expected status %v, got %v", tt.cmd, tt.status, result["status_code"])
+		}
+		if _, ok := result["response_time_ms"]; !ok {
+			t.Fatalf("%s: expected response_time_ms in %v", tt.cmd, result)
+		}
+	}
+
+	resp, _ = send(client, "BACKEND_TEST|"+sessionID+"|"+ts.URL+"|/healthz|abc")
+	if resp != "ERROR|INVALID_VALUE|invalid expected status" {
+		t.Fatalf("expected invalid status error, got %q", resp)
+	}
+}
+
+func TestRegistryV2_BackendTestBulk(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	reg := NewRegistryV2(0, mp, false, time.Second, &mockHealthChecker{})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go reg.handleConnectionV2(ctx, server)
+
+	resp, err := send(client, "REGISTER|svc|inst1|9000|{}")
+	if err != nil {
+		t.Fatalf("register error: %v", err)
+	}
+	sessionID := strings.TrimPrefix(resp, "ACK|")
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer healthy.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := down.URL
+	down.Close()
+
+	urls, _ := json.Marshal([]string{healthy.URL, failing.URL, downURL})
+	resp, err = send(client, "BACKEND_TEST_BULK|"+sessionID+"|"+string(urls)+"|/health|200")
+	if err != nil {
+		t.Fatalf("bulk test error: %v", err)
+	}
+	if !strings.HasPrefix(resp, "BACKEND_BULK_OK|") {
+		t.Fatalf("expected BACKEND_BULK_OK|, got %q", resp)
+	}
+	var results []map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(resp, "BACKEND_BULK_OK|")), &results); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	wantOK := []bool{true, false, false}
+	wantReachable := []bool{true, true, false}
+	for i, result := range results {
+		if result["backend_url"] != []string{healthy.URL, failing.URL, downURL}[i] {
+			t.Fatalf("result %d out of order: %v", i, result["backend_url"])
+		}
+		if result["ok"] != wantOK[i] || result["reachable"] != wantReachable[i] {
+			t.Fatalf("result %d: unexpected %v", i, result)
+		}
+	}
+
+	resp, _ = send(client, "BACKEND_TEST_BULK|"+sessionID+"|not-json")
+	if resp != "ERROR|INVALID_FORMAT|invalid json" {
+		t.Fatalf("expected invalid json error, got %q", resp)
+	}
+}
+
+func TestRegistryV2_ServiceLimits(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	reg := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go reg.handleConnectionV2(ctx, server)
+
+	resp, err := send(client, `REGISTER|svc|inst1|9000|{"max_connections":50}`)
+	if err != nil {
+		t.Fatalf("register error: %v", err)
+	}
+	sessionID := strings.TrimPrefix(resp, "ACK|")
+	if got := mp.limits[sessionID]; got.MaxConnections != 50 {
+		t.Fatalf("expected registration limits applied, got %+v", got)
+	}
+
+	if resp, _ = send(client, "OPTIONS_SET|"+sessionID+"|ALL|max_bandwidth|lots"); resp != "ERROR|INVALID_VALUE|invalid max_bandwidth" {
+		t.Fatalf("expected invalid bandwidth error, got %q", resp)
+	}
+	send(client, "ROUTE_ADD|"+sessionID+"|example.com|/|http://localhost:8085|5")
+	send(client, "OPTIONS_SET|"+sessionID+"|ALL|max_bandwidth|2M")
+	if resp, _ = send(client, "CONFIG_APPLY|"+sessionID); resp != "OK" {
+		t.Fatalf("expected OK, got %q", resp)
+	}
+	if len(mp.addCalls) != 1 || mp.addCalls[0].options["service_limit_key"] != sessionID {
+		t.Fatalf("expected route tagged with session limits key")
+	}
+
+	resp, err = send(client, "SESSION_INFO|"+sessionID)
+	if err != nil {
+		t.Fatalf("session info error: %v", err)
+	}
+	var info struct {
+		Limits proxy.ServiceUsage `json:"limits"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(resp, "SESSION_OK|")), &info); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if info.Limits.MaxConnections != 50 || info.Limits.BytesPerSecond != 2<<20 {
+		t.Fatalf("unexpected limits in SESSION_INFO: %+v", info.Limits)
+	}
+
+	send(client, "CLIENT_SHUTDOWN|"+sessionID)
+	if _, ok := mp.limits[sessionID]; ok {
+		t.Fatalf("expected limits removed on shutdown")
+	}
+}
+
+func TestRegistryV2_LargeBulkPayload(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	reg := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go reg.handleConnectionV2(ctx, server)
+
+	resp, err := send(client, "REGISTER|svc|inst1|9000|{}")
+	if err != nil {
+		t.Fatalf("register error: %v", err)
+	}
+	sessionID := strings.TrimPrefix(resp, "ACK|")
+
+	// Well over the 64KB default of bufio.Scanner
+	routes := make([]map[string]interface{}, 0, 800)
+	for i := 0; i < 800; i++ {
+		routes = append(routes, map[string]interface{}{
+			"domains":     []string{fmt.Sprintf("service-%03d.example.com", i)},
+			"path":        "/",
+			"backend_url": fmt.Sprintf("http://backend-%03d.internal:8080", i),
+			"priority":    i,
+		})
+	}
+	payload, _ := json.Marshal(routes)
+	if len(payload) <= 64*1024 {
+		t.Fatalf("payload too small for the test: %d bytes", len(payload))
+	}
+	resp, err = send(client, "ROUTE_ADD_BULK|"+sessionID+"|"+string(payload))
+	if err != nil {
+		t.Fatalf("bulk add error: %v", err)
+	}
+	if !strings.HasPrefix(resp, "ROUTE_BULK_OK|") {
+		t.Fatalf("expected ROUTE_BULK_OK|, got %.80q", resp)
+	}
+
+	// Over the configured limit the line is rejected and the session kept
+	small := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+	small.SetMaxLineSize(32 * 1024)
+	server2, client2 := net.Pipe()
+	defer server2.Close()
+	defer client2.Close()
+	go small.handleConnectionV2(ctx, server2)
+
+	resp, _ = send(client2, "REGISTER|svc|inst2|9000|{}")
+	sessionID = strings.TrimPrefix(resp, "ACK|")
+	client = client2
+	resp, err = send(client, "ROUTE_ADD_BULK|"+sessionID+"|"+string(payload))
+	if err != nil {
+		t.Fatalf("bulk add error: %v", err)
+	}
+	if resp != "ERROR|PAYLOAD_TOO_LARGE|payload too large" {
+		t.Fatalf("expected payload too large, got %.80q", resp)
+	}
+	if resp, _ = send(client, "PING|"+sessionID); resp != "PONG" {
+		t.Fatalf("expected connection to stay usable, got %q", resp)
+	}
+}
+
+func TestRegistryV2_HelloNegotiation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	reg := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+
+	sessionProtocol := func(client net.Conn, sessionID string) float64 {
+		resp, err := send(client, "SESSION_INFO|"+sessionID)
+		if err != nil {
+			t.Fatalf("session info error: %v", err)
+		}
+		var info map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(resp, "SESSION_OK|")), &info); err != nil {
+			t.Fatalf("invalid json: %v", err)
+		}
+		v, _ := info["protocol_version"].(float64)
+		return v
+	}
+
+	// A newer client is answered with the server's version and features
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go reg.handleConnectionV2(ctx, server)
+
+	resp, err := send(client, "HELLO|99|events,resume")
+	if err != nil {
+		t.Fatalf("hello error: %v", err)
+	}
+	fields := strings.Split(resp, "|")
+	if len(fields) != 3 || fields[0] != "HELLO_OK" || fields[1] != fmt.Sprint(ProtocolVersion) || !strings.Contains(fields[2], "events") {
+		t.Fatalf("unexpected HELLO response %q", resp)
+	}
+	resp, _ = send(client, "REGISTER|svc|inst1|9000|{}")
+	if v := sessionProtocol(client, strings.TrimPrefix(resp, "ACK|")); v != ProtocolVersion {
+		t.Fatalf("expected negotiated version %d, got %v", ProtocolVersion, v)
+	}
+
+	// Clients that skip HELLO get the baseline
+	server2, client2 := net.Pipe()
+	defer server2.Close()
+	defer client2.Close()
+	go reg.handleConnectionV2(ctx, server2)
+
+	if resp, _ = send(client2, "HELLO|1"); !strings.HasPrefix(resp, "ERROR|UNSUPPORTED|unsupported protocol version") {
+		t.Fatalf("expected old version rejected, got %q", resp)
+	}
+	resp, _ = send(client2, "REGISTER|svc|inst2|9000|{}")
+	if v := sessionProtocol(client2, strings.TrimPrefix(resp, "ACK|")); v != BaselineProtocolVersion {
+		t.Fatalf("expected baseline version %d, got %v", BaselineProtocolVersion, v)
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	in := Frame{Command: "HEADERS_SET", Args: []string{"sess", "ALL", "X-Note", "a|b\nc; d"}}
+	if err := EncodeFrame(&buf, in); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	if err := EncodeFrame(&buf, Frame{Line: "ERROR|bad\tvalue"}); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+
+	out, err := DecodeFrame(&buf, 1024)
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if strings.Join(out.Parts(), "\x00") != strings.Join(in.Parts(), "\x00") {
+		t.Fatalf("round trip mismatch: %#v", out)
+	}
+	if out, _ = DecodeFrame(&buf, 1024); out.Line != "ERROR|bad\tvalue" {
+		t.Fatalf("unexpected reply frame %#v", out)
+	}
+
+	EncodeFrame(&buf, in)
+	EncodeFrame(&buf, Frame{Line: "next"})
+	if _, err := DecodeFrame(&buf, 10); err != ErrFrameTooLarge {
+		t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+	}
+	if out, err = DecodeFrame(&buf, 1024); err != nil || out.Line != "next" {
+		t.Fatalf("expected stream in sync after oversized frame, got %#v, %v", out, err)
+	}
+}
+
+func TestRegistryV2_FramedConnection(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	reg := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go reg.handleConnectionV2(ctx, server)
+
+	// HELLO is answered in text, everything after it in frames
+	resp, err := send(client, "HELLO|3|"+FeatureFraming)
+	if err != nil || !strings.HasPrefix(resp, "HELLO_OK|") {
+		t.Fatalf("unexpected HELLO response %q: %v", resp, err)
+	}
+	call := func(parts ...string) string {
+		if err := EncodeFrame(client, Frame{Command: parts[0], Args: parts[1:]}); err != nil {
+			t.Fatalf("encode error: %v", err)
+		}
+		reply, err := DecodeFrame(client, 1<<20)
+		if err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		return reply.Line
+	}
+
+	sessionID := strings.TrimPrefix(call("REGISTER", "svc", "inst1", "9000", `{"note":"a|b"}`), "ACK|")
+	csp := "default-src 'self'; img-src https://a.example|https://b.example"
+	if resp := call("HEADERS_SET", sessionID, "ALL", "Content-Security-Policy", csp); resp != "HEADERS_OK" {
+		t.Fatalf("expected HEADERS_OK, got %q", resp)
+	}
+	reg.mu.RLock()
+	svc := reg.services[SessionID(sessionID)]
+	reg.mu.RUnlock()
+	svc.mu.RLock()
+	got := svc.stagedHeaders["Content-Security-Policy"]
+	svc.mu.RUnlock()
+	if got != csp {
+		t.Fatalf("header value corrupted: %q", got)
+	}
+
+	// Replies come split into fields too; a "|" inside a value stays in it
+	if resp := call("ROUTE_ADD", sessionID, "a.example.com", "/a|b", "http://a:8080", "0"); !strings.HasPrefix(resp, "ROUTE_OK|") {
+		t.Fatalf("expected ROUTE_OK, got %q", resp)
+	}
+	EncodeFrame(client, Frame{Command: "ROUTE_LIST", Args: []string{sessionID}})
+	reply, err := DecodeFrame(client, 1<<20)
+	if err != nil || reply.Command != "ROUTE_LIST_OK" || len(reply.Args) != 1 {
+		t.Fatalf("expected ROUTE_LIST_OK with one argument, got %#v, %v", reply, err)
+	}
+	var routes []map[string]interface{}
+	if err := json.Unmarshal([]byte(reply.Args[0]), &routes); err != nil || len(routes) != 1 || routes[0]["path"] != "/a|b" {
+		t.Fatalf("expected the route list as one JSON argument, got %q: %v", reply.Args[0], err)
+	}
+
+	client.Write([]byte{0, 0, 0, 3, 'b', 'a', 'd'})
+	reply, _ = DecodeFrame(client, 1024)
+	if reply.Line != "ERROR|INVALID_FORMAT|invalid frame" {
+		t.Fatalf("expected invalid frame error, got %q", reply.Line)
+	}
+	if strings.Join(reply.Parts(), ",") != "ERROR,INVALID_FORMAT,invalid frame" {
+		t.Fatalf("expected the error code and message as arguments, got %#v", reply)
+	}
+	if resp := call("PING", sessionID); resp != "PONG" {
+		t.Fatalf("expected PONG, got %q", resp)
+	}
+}
+
+func TestRegistryV2_RejectsPipeInTextValue(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	reg := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go reg.handleConnectionV2(ctx, server)
+
+	resp, err := send(client, "REGISTER|svc|inst1|9000|{}")
+	if err != nil {
+		t.Fatalf("register error: %v", err)
+	}
+	sessionID := strings.TrimPrefix(resp, "ACK|")
+
+	resp, _ = send(client, "HEADERS_SET|"+sessionID+"|ALL|Content-Security-Policy|img-src a|b")
+	if !strings.HasPrefix(resp, "ERROR|INVALID_FORMAT|too many fields for HEADERS_SET") {
+		t.Fatalf("expected pipe in value rejected, got %q", resp)
+	}
+	reg.mu.RLock()
+	svc := reg.services[SessionID(sessionID)]
+	reg.mu.RUnlock()
+	svc.mu.RLock()
+	_, staged := svc.stagedHeaders["Content-Security-Policy"]
+	svc.mu.RUnlock()
+	if staged {
+		t.Fatalf("expected truncated header not to be staged")
+	}
+
+	resp, _ = send(client, "HEADERS_SET|"+sessionID+"|ALL|X-Bad Name|v")
+	if resp != "ERROR|INVALID_VALUE|header name or value contains invalid characters" {
+		t.Fatalf("expected invalid header name rejected, got %q", resp)
+	}
+	if resp, _ = send(client, "HEADERS_SET|"+sessionID+"|ALL|X-Ok|a; b"); resp != "HEADERS_OK" {
+		t.Fatalf("expected HEADERS_OK, got %q", resp)
+	}
+}
+
+func TestRegistryV2_IdleSessionReaped(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reg := NewRegistryV2(0, &mockProxy{}, false, 100*time.Millisecond, &mockHealthChecker{})
+	reg.SetIdleTimeout(200 * time.Millisecond)
+	go reg.reapIdleSessions(ctx)
+
+	silentServer, silent := net.Pipe()
+	defer silent.Close()
+	go reg.handleConnectionV2(ctx, silentServer)
+	resp, _ := send(silent, "REGISTER|svc|silent|9000|{}")
+	silentID := SessionID(strings.TrimPrefix(resp, "ACK|"))
+
+	activeServer, active := net.Pipe()
+	defer active.Close()
+	go reg.handleConnectionV2(ctx, activeServer)
+	resp, _ = send(active, "REGISTER|svc|active|9000|{}")
+	activeID := strings.TrimPrefix(resp, "ACK|")
+
+	// The active session pings well inside the timeout
+	for i := 0; i < 8; i++ {
+		time.Sleep(75 * time.Millisecond)
+		if resp, err := send(active, "PING|"+activeID); err != nil || resp != "PONG" {
+			t.Fatalf("active session lost: %q, %v", resp, err)
+		}
+	}
+
+	_ = silent.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := bufio.NewReader(silent).ReadString('\n'); err == nil {
+		t.Fatal("expected silent connection to be closed")
+	}
+
+	reg.mu.RLock()
+	svc, ok := reg.services[silentID]
+	reg.mu.RUnlock()
+	if !ok {
+		t.Fatal("expected silent session to be kept for its grace period")
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		svc.mu.RLock()
+		disconnected := svc.DisconnectedAt != nil
+		svc.mu.RUnlock()
+		if disconnected {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected silent session to be marked disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRegistryV2_Metrics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	reg := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go reg.handleConnectionV2(ctx, server)
+
+	resp, err := send(client, "REGISTER|svc|inst1|9000|{}")
+	if err != nil {
+		t.Fatalf("register error: %v", err)
+	}
+	sessionID := strings.TrimPrefix(resp, "ACK|")
+
+	for _, line := range []string{
+		"PING|" + sessionID,
+		"PING|" + sessionID,
+		"ROUTE_ADD|" + sessionID + "|example.com|/|http://localhost:8080|0",
+		"CONFIG_APPLY|" + sessionID,
+		"ROUTE_REMOVE|" + sessionID + "|missing",
+		"BOGUS|" + sessionID,
+	} {
+		if _, err := send(client, line); err != nil {
+			t.Fatalf("%s error: %v", line, err)
+		}
+	}
+
+	out := reg.PrometheusMetrics()
+	for _, want := range []string{
+		"registry_sessions_total 1\n",
+		`registry_commands_total{cmd="REGISTER"} 1`,
+		`registry_commands_total{cmd="PING"} 2`,
+		`registry_commands_total{cmd="ROUTE_ADD"} 1`,
+		`registry_commands_total{cmd="CONFIG_APPLY"} 1`,
+		`registry_commands_total{cmd="unknown"} 1`,
+		`registry_errors_total{cmd="ROUTE_REMOVE"} 1`,
+		`registry_errors_total{cmd="unknown"} 1`,
+		`registry_sessions{state="connected"} 1`,
+		`registry_routes{service="svc"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in metrics:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `registry_errors_total{cmd="PING"}`) {
+		t.Errorf("unexpected PING errors:\n%s", out)
+	}
+}
+
+func TestRegistryV2_ErrorCodes(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	reg := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go reg.handleConnectionV2(ctx, server)
+
+	expectCode := func(line, code string) {
+		t.Helper()
+		resp, err := send(client, line)
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		perr := ParseError(resp)
+		if perr == nil || perr.Code != code || perr.Message == "" {
+			t.Fatalf("%s: expected %s error, got %q", line, code, resp)
+		}
+	}
+
+	expectCode("ROUTE_LIST|nope", ErrCodeSessionNotFound)
+
+	resp, _ := send(client, "REGISTER|svc|inst1|9000|{}")
+	sessionID := strings.TrimPrefix(resp, "ACK|")
+
+	expectCode("ROUTE_REMOVE|"+sessionID+"|r404", ErrCodeRouteNotFound)
+	expectCode("ROUTE_ADD|"+sessionID+"|example.com|/|localhost|0", ErrCodeInvalidValue)
+	expectCode("ROUTE_ADD_BULK|"+sessionID+"|{", ErrCodeInvalidFormat)
+	expectCode("DRAIN_STATUS|"+sessionID, ErrCodeNotFound)
+	expectCode("FROBNICATE|"+sessionID, ErrCodeUnknownCommand)
+}
+
+func TestParseError(t *testing.T) {
+	cases := []struct {
+		line    string
+		code    string
+		message string
+	}{
+		{"ERROR|SESSION_NOT_FOUND|session not found\n", ErrCodeSessionNotFound, "session not found"},
+		{"ERROR|INVALID_VALUE|route r1: timeout: invalid duration \"ten\"", ErrCodeInvalidValue, "route r1: timeout: invalid duration \"ten\""},
+		// Older servers send no code; a message with a | is not a code either
+		{"ERROR|session not found", ErrCodeUnknown, "session not found"},
+		{"ERROR|too many fields for HEADERS_SET: values must not contain '|'", ErrCodeUnknown, "too many fields for HEADERS_SET: values must not contain '|'"},
+	}
+	for _, tc := range cases {
+		perr := ParseError(tc.line)
+		if perr == nil || perr.Code != tc.code || perr.Message != tc.message {
+			t.Errorf("ParseError(%q) = %+v, want %s %q", tc.line, perr, tc.code, tc.message)
+		}
+	}
+	if perr := ParseError("ROUTE_OK|r1"); perr != nil {
+		t.Errorf("expected nil for a non-error reply, got %+v", perr)
+	}
+}
+
+// scheduleStore keeps maintenance schedules in memory
+type scheduleStore struct {
+	schedules map[string]database.MaintenanceSchedule
+}
+
+func (s *scheduleStore) GetMaintenanceSchedules() ([]database.MaintenanceSchedule, error) {
+	var list []database.MaintenanceSchedule
+	for _, sched := range s.schedules {
+		list = append(list, sched)
+	}
+	return list, nil
+}
+
+func (s *scheduleStore) SaveMaintenanceSchedule(sched database.MaintenanceSchedule) error {
+	s.schedules[sched.ID] = sched
+	return nil
+}
+
+func (s *scheduleStore) DeleteMaintenanceSchedule(id string) error {
+	delete(s.schedules, id)
+	return nil
+}
+
+// registerWithRoute registers svc/inst on a new connection and applies one
+// route, returning the client end, session ID and route ID
+func registerWithRoute(t *testing.T, ctx context.Context, reg *RegistryV2, path string) (net.Conn, string, string) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close(); server.Close() })
+	go reg.handleConnectionV2(ctx, server)
+
+	resp, _ := send(client, "REGISTER|svc|inst1|9000|{}")
+	sessionID := strings.TrimPrefix(resp, "ACK|")
+	resp, _ = send(client, "ROUTE_ADD|"+sessionID+"|example.com|"+path+"|http://10.0.0.1:8080|0")
+	if !strings.HasPrefix(resp, "ROUTE_OK|") {
+		t.Fatalf("expected ROUTE_OK, got %q", resp)
+	}
+	routeID := strings.TrimPrefix(resp, "ROUTE_OK|")
+	if resp, _ = send(client, "CONFIG_APPLY|"+sessionID); resp != "OK" {
+		t.Fatalf("expected OK, got %q", resp)
+	}
+	return client, sessionID, routeID
+}
+
+func TestRegistryV2_MaintenanceSchedule(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	store := &scheduleStore{schedules: make(map[string]database.MaintenanceSchedule)}
+	reg := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+	if err := reg.SetScheduleStore(store); err != nil {
+		t.Fatalf("set store: %v", err)
+	}
+	client, sessionID, routeID := registerWithRoute(t, ctx, reg, "/app")
+
+	start := time.Now().Add(time.Hour).Truncate(time.Second)
+	end := start.Add(30 * time.Minute)
+	window := "|" + start.Format(time.RFC3339) + "|" + end.Format(time.RFC3339)
+
+	for cmd, want := range map[string]string{
+		"MAINT_SCHEDULE|" + sessionID + "|" + routeID + "|" + end.Format(time.RFC3339) + "|" + start.Format(time.RFC3339): "ERROR|INVALID_VALUE|end must be after start",
+		"MAINT_SCHEDULE|" + sessionID + "|" + routeID + "|soon" + "|" + end.Format(time.RFC3339):                          `ERROR|INVALID_VALUE|invalid start time "soon"`,
+		"MAINT_SCHEDULE|" + sessionID + "|route-999" + window:                                                             "ERROR|ROUTE_NOT_FOUND|route not found: route-999",
+		"MAINT_SCHEDULE|" + sessionID + "|" + routeID + window + "|ftp://example.com/":                                    `ERROR|INVALID_VALUE|invalid maintenance page url "ftp://example.com/"`,
+		"MAINT_SCHEDULE_CANCEL|" + sessionID + "|sched-unknown":                                                           "ERROR|NOT_FOUND|maintenance schedule not found: sched-unknown",
+	} {
+		if resp, _ := send(client, cmd); resp != want {
+			t.Fatalf("%s: expected %q, got %q", cmd, want, resp)
+		}
+	}
+
+	resp, _ := send(client, "MAINT_SCHEDULE|"+sessionID+"|"+routeID+window)
+	if !strings.HasPrefix(resp, "MAINT_SCHEDULE_OK|") {
+		t.Fatalf("expected MAINT_SCHEDULE_OK, got %q", resp)
+	}
+	scheduleID := strings.TrimPrefix(resp, "MAINT_SCHEDULE_OK|")
+	if _, ok := store.schedules[scheduleID]; !ok {
+		t.Fatalf("expected schedule %s to be stored", scheduleID)
+	}
+
+	// Nothing happens before the window; entering happens once
+	reg.enactMaintenanceSchedules(start.Add(-time.Second))
+	if len(mp.maintenanceCalls) != 0 {
+		t.Fatalf("expected no maintenance before start, got %d calls", len(mp.maintenanceCalls))
+	}
+	reg.enactMaintenanceSchedules(start)
+	reg.enactMaintenanceSchedules(start.Add(time.Minute))
+	if len(mp.maintenanceCalls) != 1 || !mp.maintenanceCalls[0].enabled || mp.maintenanceCalls[0].path != "/app" {
+		t.Fatalf("expected one enter at start, got %+v", mp.maintenanceCalls)
+	}
+
+	resp, _ = send(client, "MAINT_STATUS|"+sessionID)
+	var status struct {
+		InMaintenance []string                       `json:"in_maintenance"`
+		Schedules     []database.MaintenanceSchedule `json:"schedules"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(resp, "MAINT_STATUS_OK|")), &status); err != nil {
+		t.Fatalf("decode status %q: %v", resp, err)
+	}
+	if len(status.InMaintenance) != 1 || len(status.Schedules) != 1 || status.Schedules[0].ID != scheduleID {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// The window ends: the route exits and the schedule is gone
+	reg.enactMaintenanceSchedules(end)
+	if len(mp.maintenanceCalls) != 2 || mp.maintenanceCalls[1].enabled {
+		t.Fatalf("expected exit at end, got %+v", mp.maintenanceCalls)
+	}
+	if len(store.schedules) != 0 || len(reg.maintenanceSchedulesOf("svc", "inst1")) != 0 {
+		t.Fatalf("expected schedule removed after end")
+	}
+
+	// A window already open is entered at once; cancelling ends it
+	resp, _ = send(client, "MAINT_SCHEDULE|"+sessionID+"|ALL|"+strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)+"|"+end.Format(time.RFC3339))
+	if !strings.HasPrefix(resp, "MAINT_SCHEDULE_OK|") {
+		t.Fatalf("expected MAINT_SCHEDULE_OK, got %q", resp)
+	}
+	scheduleID = strings.TrimPrefix(resp, "MAINT_SCHEDULE_OK|")
+	if len(mp.maintenanceCalls) != 3 || !mp.maintenanceCalls[2].enabled {
+		t.Fatalf("expected immediate enter, got %+v", mp.maintenanceCalls)
+	}
+	if resp, _ = send(client, "MAINT_SCHEDULE_CANCEL|"+sessionID+"|"+scheduleID); resp != "MAINT_SCHEDULE_CANCEL_OK|"+scheduleID {
+		t.Fatalf("expected MAINT_SCHEDULE_CANCEL_OK, got %q", resp)
+	}
+	if len(mp.maintenanceCalls) != 4 || mp.maintenanceCalls[3].enabled {
+		t.Fatalf("expected exit on cancel, got %+v", mp.maintenanceCalls)
+	}
+	if len(store.schedules) != 0 {
+		t.Fatalf("expected cancelled schedule removed from store")
+	}
+	reg.enactMaintenanceSchedules(end.Add(-time.Minute))
+	if len(mp.maintenanceCalls) != 4 {
+		t.Fatalf("expected cancelled schedule not to enact, got %+v", mp.maintenanceCalls)
+	}
+}
+
+func TestRegistryV2_MaintenanceScheduleSurvivesRestart(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	store := &scheduleStore{schedules: make(map[string]database.MaintenanceSchedule)}
+	start := time.Now().Add(time.Hour).Truncate(time.Second)
+	end := start.Add(time.Hour)
+
+	reg := NewRegistryV2(0, &mockProxy{}, false, 100*time.Millisecond, &mockHealthChecker{})
+	if err := reg.SetScheduleStore(store); err != nil {
+		t.Fatalf("set store: %v", err)
+	}
+	client, sessionID, routeID := registerWithRoute(t, ctx, reg, "/app")
+	resp, _ := send(client, "MAINT_SCHEDULE|"+sessionID+"|"+routeID+"|"+start.Format(time.RFC3339)+"|"+end.Format(time.RFC3339))
+	if !strings.HasPrefix(resp, "MAINT_SCHEDULE_OK|") {
+		t.Fatalf("expected MAINT_SCHEDULE_OK, got %q", resp)
+	}
+
+	// After a restart the service registers again with new IDs; the
+	// schedule still matches its route by domains and path
+	mp := &mockProxy{}
+	reg = NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+	if err := reg.SetScheduleStore(store); err != nil {
+		t.Fatalf("set store: %v", err)
+	}
+	registerWithRoute(t, ctx, reg, "/other")
+	registerWithRoute(t, ctx, reg, "/app")
+
+	reg.enactMaintenanceSchedules(start.Add(time.Minute))
+	if len(mp.maintenanceCalls) != 1 || mp.maintenanceCalls[0].path != "/app" || !mp.maintenanceCalls[0].enabled {
+		t.Fatalf("expected /app entered after restart, got %+v", mp.maintenanceCalls)
+	}
+	reg.enactMaintenanceSchedules(end)
+	if len(mp.maintenanceCalls) != 2 || mp.maintenanceCalls[1].enabled {
+		t.Fatalf("expected /app exited at end, got %+v", mp.maintenanceCalls)
+	}
+}
+
+func TestRegistryV2_SetServicesMaintenance(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	reg := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+
+	// Two instances of api and one of web, registered on one connection so
+	// the mock is only used from one goroutine
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go reg.handleConnectionV2(ctx, server)
+	for _, svc := range []struct{ service, instance, path string }{
+		{"api", "api-1", "/api"},
+		{"api", "api-2", "/api/v2"},
+		{"web", "web-1", "/"},
+	} {
+		resp, _ := send(client, "REGISTER|"+svc.service+"|"+svc.instance+"|9000|{}")
+		sessionID := strings.TrimPrefix(resp, "ACK|")
+		send(client, "ROUTE_ADD|"+sessionID+"|example.com|"+svc.path+"|http://10.0.0.1:8080|0")
+		if resp, _ = send(client, "CONFIG_APPLY|"+sessionID); resp != "OK" {
+			t.Fatalf("expected OK, got %q", resp)
+		}
+	}
+
+	results := reg.SetServicesMaintenance([]string{"api", "db"}, true, "", "15:00 UTC", "Deploy")
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+	if results[0].Service != "api" || strings.Join(results[0].Routes, " ") != "example.com/api example.com/api/v2" {
+		t.Fatalf("expected both api routes entered, got %+v", results[0])
+	}
+	if results[1].Service != "db" || results[1].Error != "service not registered" {
+		t.Fatalf("expected db not registered, got %+v", results[1])
+	}
+	if len(mp.maintenanceCalls) != 2 {
+		t.Fatalf("expected 2 maintenance calls, got %+v", mp.maintenanceCalls)
+	}
+
+	// Exit on all only touches routes in maintenance
+	results = reg.SetServicesMaintenance([]string{"all"}, false, "", "", "")
+	if len(results) != 2 || results[0].Service != "api" || len(results[0].Routes) != 2 || results[1].Service != "web" || len(results[1].Routes) != 0 {
+		t.Fatalf("unexpected exit results %+v", results)
+	}
+	if len(mp.maintenanceCalls) != 4 || mp.maintenanceCalls[2].enabled || mp.maintenanceCalls[3].enabled {
+		t.Fatalf("expected 2 exits, got %+v", mp.maintenanceCalls)
+	}
+}
+
+func TestRegistryV2_ConfigApplyThrottled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	reg := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+	reg.SetApplyLimit(1, 3, 2)
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go reg.handleConnectionV2(ctx, server)
+
+	resp, _ := send(client, "REGISTER|svc|inst1|9000|{}")
+	sessionID := strings.TrimPrefix(resp, "ACK|")
+	send(client, "ROUTE_ADD|"+sessionID+"|example.com|/|http://10.0.0.1:8080|0")
+
+	// The burst goes through, then the session is throttled
+	var replies []string
+	for i := 0; i < 5; i++ {
+		resp, _ := send(client, "CONFIG_APPLY|"+sessionID)
+		replies = append(replies, resp)
+	}
+	for i, resp := range replies {
+		if i < 3 && resp != "OK" {
+			t.Fatalf("apply %d: expected OK, got %q", i, resp)
+		}
+		if i >= 3 && !strings.HasPrefix(resp, "ERROR|RATE_LIMITED|applying too often") {
+			t.Fatalf("apply %d: expected RATE_LIMITED, got %q", i, resp)
+		}
+	}
+	if len(mp.addCalls) != 1 {
+		t.Fatalf("expected the route added once, got %d", len(mp.addCalls))
+	}
+
+	// Applies from other sessions queue behind a running one; past the
+	// queue they are refused rather than piling up
+	reg.applyMu.Lock()
+	results := make(chan string, 6)
+	for i := 0; i < 6; i++ {
+		server, client := net.Pipe()
+		defer server.Close()
+		defer client.Close()
+		go reg.handleConnectionV2(ctx, server)
+		resp, _ := send(client, fmt.Sprintf("REGISTER|svc|inst%d|9000|{}", i+2))
+		sessionID := strings.TrimPrefix(resp, "ACK|")
+		go func() {
+			resp, _ := send(client, "CONFIG_APPLY|"+sessionID)
+			results <- resp
+		}()
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 6; i++ {
+		if i == 4 {
+			reg.applyMu.Unlock() // Only the queued applies are left
+		}
+		select {
+		case resp := <-results:
+			counts[resp]++
+		case <-ctx.Done():
+			t.Fatalf("applies stuck, got %v", counts)
+		}
+	}
+	if counts["OK"] != 2 || counts["ERROR|RATE_LIMITED|too many config applies queued, retry"] != 4 {
+		t.Fatalf("expected 2 applied and 4 refused, got %v", counts)
+	}
+	if got := reg.metrics.applyLimited.Load(); got != 6 {
+		t.Fatalf("expected 6 throttled applies counted, got %d", got)
+	}
+}
+
+func TestRegistryV2_BackendRateLimitOption(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	mp := &mockProxy{}
+	reg := NewRegistryV2(0, mp, false, 100*time.Millisecond, &mockHealthChecker{})
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go reg.handleConnectionV2(ctx, server)
+
+	resp, _ := send(client, "REGISTER|svc|inst1|9000|{}")
+	sessionID := strings.TrimPrefix(resp, "ACK|")
+	send(client, "ROUTE_ADD|"+sessionID+"|example.com|/|http://10.0.0.1:8080|0")
+
+	want := `ERROR|INVALID_VALUE|backend_rate_limit: invalid window in "100/soon"`
+	if resp, _ = send(client, "OPTIONS_SET|"+sessionID+"|ALL|backend_rate_limit|100/soon"); resp != want {
+		t.Fatalf("expected %q, got %q", want, resp)
+	}
+	if resp, _ = send(client, "OPTIONS_SET|"+sessionID+"|ALL|backend_rate_limit|600/m"); resp != "OPTIONS_OK" {
+		t.Fatalf("expected OPTIONS_OK, got %q", resp)
+	}
+	if resp, _ = send(client, "CONFIG_APPLY|"+sessionID); resp != "OK" {
+		t.Fatalf("expected OK, got %q", resp)
+	}
+	if len(mp.addCalls) != 1 {
+		t.Fatalf("expected one route added, got %d", len(mp.addCalls))
+	}
+	opts := mp.addCalls[0].options
+	if opts["backend_rate_limit"] != 600 || opts["backend_rate_window"] != time.Minute {
+		t.Fatalf("expected 600 per minute, got %v per %v", opts["backend_rate_limit"], opts["backend_rate_window"])
+	}
+}
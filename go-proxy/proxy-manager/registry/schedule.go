@@ -0,0 +1,360 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chilla55/proxy-manager/database"
+)
+
+// DefaultScheduleInterval is how often maintenance schedules are checked,
+// and so how late a window may start or end
+const DefaultScheduleInterval = time.Second
+
+// scheduledMaintenanceReason is shown on the proxy's maintenance page during
+// a scheduled window; the window's end is shown as the ETA
+const scheduledMaintenanceReason = "Scheduled maintenance"
+
+// ScheduleStore persists maintenance schedules so they survive a restart
+type ScheduleStore interface {
+	GetMaintenanceSchedules() ([]database.MaintenanceSchedule, error)
+	SaveMaintenanceSchedule(s database.MaintenanceSchedule) error
+	DeleteMaintenanceSchedule(id string) error
+}
+
+// maintenanceSchedule is a stored schedule and what it has enacted since
+// startup. entered maps session/route keys to true for routes the schedule
+// put into maintenance and false for routes that already were, which it
+// leaves alone when the window ends.
+type maintenanceSchedule struct {
+	database.MaintenanceSchedule
+	entered map[string]bool
+}
+
+// SetScheduleStore persists maintenance schedules in store and loads the
+// ones saved before a restart. Call before StartV2.
+func (r *RegistryV2) SetScheduleStore(store ScheduleStore) error {
+	saved, err := store.GetMaintenanceSchedules()
+	if err != nil {
+		return err
+	}
+	r.schedulesMu.Lock()
+	defer r.schedulesMu.Unlock()
+	r.scheduleStore = store
+	for _, s := range saved {
+		r.schedules[s.ID] = &maintenanceSchedule{MaintenanceSchedule: s, entered: make(map[string]bool)}
+	}
+	if len(saved) > 0 {
+		log.Printf("[registry-v2] Loaded %d maintenance schedule(s)", len(saved))
+	}
+	return nil
+}
+
+// SetScheduleInterval sets how often maintenance schedules are checked;
+// d <= 0 restores DefaultScheduleInterval. Call before StartV2.
+func (r *RegistryV2) SetScheduleInterval(d time.Duration) {
+	if d <= 0 {
+		d = DefaultScheduleInterval
+	}
+	r.scheduleInterval = d
+}
+
+// runMaintenanceSchedules enacts maintenance schedules until ctx is done
+func (r *RegistryV2) runMaintenanceSchedules(ctx context.Context) {
+	ticker := time.NewTicker(r.scheduleInterval)
+	defer ticker.Stop()
+
+	r.enactMaintenanceSchedules(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.enactMaintenanceSchedules(now)
+		}
+	}
+}
+
+// enactMaintenanceSchedules enters the routes of every window open at now and
+// exits those of every window that has ended. Entering is repeated on each
+// call, so routes registered after the window opened, e.g. by a service
+// restarted with the proxy, are entered too.
+func (r *RegistryV2) enactMaintenanceSchedules(now time.Time) {
+	r.schedulesMu.Lock()
+	defer r.schedulesMu.Unlock()
+
+	for id, sched := range r.schedules {
+		switch {
+		case now.Before(sched.Start):
+		case now.Before(sched.End):
+			r.enterSchedule(sched)
+		default:
+			r.exitSchedule(sched)
+			delete(r.schedules, id)
+			r.deleteStoredSchedule(id)
+			log.Printf("[registry-v2] Maintenance schedule %s for %s/%s ended", id, sched.Service, sched.Instance)
+		}
+	}
+}
+
+// enterSchedule puts the schedule's routes into maintenance, once per route.
+// Call with schedulesMu held.
+func (r *RegistryV2) enterSchedule(sched *maintenanceSchedule) {
+	eta := sched.End.UTC().Format(time.RFC3339)
+	for _, svc := range r.servicesNamed(sched.Service, sched.Instance) {
+		svc.mu.Lock()
+		if !svc.routesDeactivated {
+			for routeID, route := range svc.activeRoutes {
+				key := string(svc.SessionID) + "/" + string(routeID)
+				if _, seen := sched.entered[key]; seen || !sched.covers(route) {
+					continue
+				}
+				if svc.maintenanceRoutes[routeID] {
+					sched.entered[key] = false
+					continue
+				}
+				sched.entered[key] = true
+				svc.maintenanceRoutes[routeID] = true
+				r.setRouteMaintenance(routeID, route, sched.PageURL, eta, scheduledMaintenanceReason)
+				log.Printf("[registry-v2] Maintenance schedule %s entered %s: %v%s", sched.ID, routeID, route.Domains, route.Path)
+			}
+		}
+		svc.mu.Unlock()
+	}
+}
+
+// exitSchedule takes the routes the schedule entered out of maintenance,
+// unless they were exited already. Call with schedulesMu held.
+func (r *RegistryV2) exitSchedule(sched *maintenanceSchedule) {
+	for _, svc := range r.servicesNamed(sched.Service, sched.Instance) {
+		svc.mu.Lock()
+		for routeID, route := range svc.activeRoutes {
+			key := string(svc.SessionID) + "/" + string(routeID)
+			if !sched.entered[key] || !svc.maintenanceRoutes[routeID] {
+				continue
+			}
+			delete(svc.maintenanceRoutes, routeID)
+			r.clearRouteMaintenance(routeID, route)
+			log.Printf("[registry-v2] Maintenance schedule %s exited %s: %v%s", sched.ID, routeID, route.Domains, route.Path)
+		}
+		svc.mu.Unlock()
+	}
+}
+
+// covers reports whether route is one of the schedule's targets
+func (s *maintenanceSchedule) covers(route *RouteV2) bool {
+	if s.Target == "ALL" {
+		return true
+	}
+	for _, target := range s.Routes {
+		if target.Path == route.Path && sameDomains(target.Domains, route.Domains) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameDomains reports whether a and b hold the same domains in any order
+func sameDomains(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string{}, a...), append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// servicesNamed returns the sessions of a service instance, normally one
+// but more while a restarted container's old session is in its grace period
+func (r *RegistryV2) servicesNamed(service, instance string) []*ServiceV2 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var found []*ServiceV2
+	for _, svc := range r.services {
+		if svc.ServiceName == service && svc.InstanceName == instance {
+			found = append(found, svc)
+		}
+	}
+	return found
+}
+
+// deleteStoredSchedule removes a schedule from the store, if any
+func (r *RegistryV2) deleteStoredSchedule(id string) {
+	if r.scheduleStore == nil {
+		return
+	}
+	if err := r.scheduleStore.DeleteMaintenanceSchedule(id); err != nil {
+		log.Printf("[registry-v2] Warning: failed to delete maintenance schedule %s: %s", id, err)
+	}
+}
+
+// maintenanceSchedulesOf returns a service instance's schedules, the
+// earliest start first
+func (r *RegistryV2) maintenanceSchedulesOf(service, instance string) []database.MaintenanceSchedule {
+	r.schedulesMu.Lock()
+	defer r.schedulesMu.Unlock()
+	list := make([]database.MaintenanceSchedule, 0)
+	for _, sched := range r.schedules {
+		if sched.Service == service && sched.Instance == instance {
+			list = append(list, sched.MaintenanceSchedule)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Start.Equal(list[j].Start) {
+			return list[i].Start.Before(list[j].Start)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// parseScheduleTime accepts RFC 3339 or Unix seconds
+func parseScheduleTime(value string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (r *RegistryV2) handleMaintenanceScheduleV2(conn net.Conn, sessionID SessionID, parts []string) {
+	// MAINT_SCHEDULE|session_id|target|start|end[|maintenance_page_url]
+	if len(parts) < 5 {
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
+		return
+	}
+
+	target := strings.TrimSpace(parts[2])
+	start, err := parseScheduleTime(strings.TrimSpace(parts[3]))
+	if err != nil {
+		writeError(conn, ErrCodeInvalidValue, "invalid start time %q", parts[3])
+		return
+	}
+	end, err := parseScheduleTime(strings.TrimSpace(parts[4]))
+	if err != nil {
+		writeError(conn, ErrCodeInvalidValue, "invalid end time %q", parts[4])
+		return
+	}
+	if !end.After(start) {
+		writeError(conn, ErrCodeInvalidValue, "end must be after start")
+		return
+	}
+	if !end.After(time.Now()) {
+		writeError(conn, ErrCodeInvalidValue, "end is in the past")
+		return
+	}
+	var pageURL string
+	if len(parts) > 5 {
+		pageURL = strings.TrimSpace(parts[5])
+	}
+	if pageURL != "" {
+		if u, err := url.Parse(pageURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			writeError(conn, ErrCodeInvalidValue, "invalid maintenance page url %q", pageURL)
+			return
+		}
+	}
+
+	r.mu.RLock()
+	svc, exists := r.services[sessionID]
+	r.mu.RUnlock()
+
+	if !exists {
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
+		return
+	}
+
+	sched := database.MaintenanceSchedule{
+		ID:       fmt.Sprintf("sched-%s", strconv.FormatInt(time.Now().UnixNano(), 36)),
+		Service:  svc.ServiceName,
+		Instance: svc.InstanceName,
+		Target:   target,
+		Start:    start,
+		End:      end,
+		PageURL:  pageURL,
+		Created:  time.Now(),
+	}
+	// Route IDs change when the service registers again, so keep what
+	// identifies the routes
+	if target != "ALL" {
+		svc.mu.RLock()
+		for _, t := range strings.Split(target, ",") {
+			routeID := RouteID(strings.TrimSpace(t))
+			route, found := svc.activeRoutes[routeID]
+			if !found {
+				svc.mu.RUnlock()
+				writeError(conn, ErrCodeRouteNotFound, "route not found: %s", routeID)
+				return
+			}
+			sched.Routes = append(sched.Routes, database.ScheduledRoute{
+				Domains: append([]string{}, route.Domains...),
+				Path:    route.Path,
+			})
+		}
+		svc.mu.RUnlock()
+	}
+
+	r.schedulesMu.Lock()
+	if r.scheduleStore != nil {
+		if err := r.scheduleStore.SaveMaintenanceSchedule(sched); err != nil {
+			r.schedulesMu.Unlock()
+			log.Printf("[registry-v2] Failed to save maintenance schedule: %s", err)
+			writeError(conn, ErrCodeUnavailable, "failed to save schedule")
+			return
+		}
+	}
+	r.schedules[sched.ID] = &maintenanceSchedule{MaintenanceSchedule: sched, entered: make(map[string]bool)}
+	r.schedulesMu.Unlock()
+
+	log.Printf("[registry-v2] Maintenance schedule %s for %s/%s: %s from %s to %s",
+		sched.ID, sched.Service, sched.Instance, target, start.Format(time.RFC3339), end.Format(time.RFC3339))
+	// A window that has already opened starts now, not at the next tick
+	r.enactMaintenanceSchedules(time.Now())
+	conn.Write([]byte(fmt.Sprintf("MAINT_SCHEDULE_OK|%s\n", sched.ID)))
+}
+
+func (r *RegistryV2) handleMaintenanceScheduleCancelV2(conn net.Conn, sessionID SessionID, parts []string) {
+	// MAINT_SCHEDULE_CANCEL|session_id|schedule_id
+	if len(parts) < 3 {
+		writeError(conn, ErrCodeInvalidFormat, "invalid format")
+		return
+	}
+	id := strings.TrimSpace(parts[2])
+
+	r.mu.RLock()
+	svc, exists := r.services[sessionID]
+	r.mu.RUnlock()
+
+	if !exists {
+		writeError(conn, ErrCodeSessionNotFound, "session not found")
+		return
+	}
+
+	r.schedulesMu.Lock()
+	sched, found := r.schedules[id]
+	// Another service's schedule is reported as missing
+	if !found || sched.Service != svc.ServiceName || sched.Instance != svc.InstanceName {
+		r.schedulesMu.Unlock()
+		writeError(conn, ErrCodeNotFound, "maintenance schedule not found: %s", id)
+		return
+	}
+	// Cancelling an open window ends it now
+	r.exitSchedule(sched)
+	delete(r.schedules, id)
+	r.deleteStoredSchedule(id)
+	r.schedulesMu.Unlock()
+
+	log.Printf("[registry-v2] Maintenance schedule %s for %s/%s cancelled", id, sched.Service, sched.Instance)
+	conn.Write([]byte(fmt.Sprintf("MAINT_SCHEDULE_CANCEL_OK|%s\n", id)))
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chilla55/proxy-manager/certmonitor"
+	"github.com/chilla55/proxy-manager/config"
+	"github.com/chilla55/proxy-manager/metrics"
+	"github.com/chilla55/proxy-manager/middleware"
+	"github.com/chilla55/proxy-manager/proxy"
+	"github.com/chilla55/proxy-manager/webhook"
+)
+
+// runtimeSettings holds global.yaml values read by background jobs that can
+// change on SIGHUP
+type runtimeSettings struct {
+	mu                 sync.RWMutex
+	errorRateThreshold float64
+	retentionDays      int
+	auditLogDays       int
+	vacuum             bool
+	vacuumThreshold    int64
+	remoteCerts        []certmonitor.RemoteTarget
+	remoteCertTimeout  time.Duration
+}
+
+func newRuntimeSettings(cfg *config.GlobalConfig) *runtimeSettings {
+	s := &runtimeSettings{}
+	s.update(cfg)
+	return s
+}
+
+func (s *runtimeSettings) update(cfg *config.GlobalConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errorRateThreshold = cfg.GetErrorRateThreshold()
+	s.retentionDays = cfg.GetRetentionDays()
+	s.auditLogDays = cfg.GetAuditLogDays()
+	s.vacuum = cfg.Retention.Vacuum
+	s.vacuumThreshold = cfg.GetVacuumThreshold()
+	s.remoteCerts = s.remoteCerts[:0:0]
+	for _, t := range cfg.CertMonitor.RemoteTargets {
+		s.remoteCerts = append(s.remoteCerts, certmonitor.RemoteTarget{Address: t.Address, ServerName: t.ServerName})
+	}
+	s.remoteCertTimeout, _ = cfg.GetCertMonitorTimeout() // Checked by Validate
+}
+
+// ErrorRateThreshold returns the high error rate alert threshold in percent
+func (s *runtimeSettings) ErrorRateThreshold() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.errorRateThreshold
+}
+
+// RetentionDays returns the daily cleanup retention in days
+func (s *runtimeSettings) RetentionDays() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.retentionDays
+}
+
+// AuditLogDays returns how long audit entries are kept, 0 for forever
+func (s *runtimeSettings) AuditLogDays() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.auditLogDays
+}
+
+// RemoteCerts returns the remote certificate targets and the per-target timeout
+func (s *runtimeSettings) RemoteCerts() ([]certmonitor.RemoteTarget, time.Duration) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.remoteCerts, s.remoteCertTimeout
+}
+
+// Vacuum reports whether to compact the database after cleanup and the
+// reclaimable bytes needed before a VACUUM runs
+func (s *runtimeSettings) Vacuum() (bool, int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.vacuum, s.vacuumThreshold
+}
+
+// globalReloader re-reads global.yaml on SIGHUP and applies it to the running
+// components without restarting listeners
+type globalReloader struct {
+	path        string
+	proxy       *proxy.Server
+	notifier    *webhook.Notifier
+	certMonitor *certmonitor.Monitor
+	metrics     *metrics.Collector
+	settings    *runtimeSettings
+	auth        *middleware.Authenticator
+	cors        *middleware.CORS
+	dashboard   bool // -dashboard, which requires dashboard.auth
+
+	mu        sync.Mutex
+	current   *config.GlobalConfig
+	webhooks  webhook.Config
+	monitored map[string]bool // Certificate monitor entries from global.yaml
+}
+
+// Reload loads and validates global.yaml and applies it. On any error the
+// running configuration is left untouched. Returns the list of changes.
+func (r *globalReloader) Reload() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := config.LoadGlobalConfig(r.path)
+	if err != nil {
+		return nil, err
+	}
+	if err := next.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid global config: %w", err)
+	}
+
+	// Load certificates before touching anything so a bad key pair rejects
+	// the whole reload
+	certificates, err := loadServingCertificates(next)
+	if err != nil {
+		return nil, err
+	}
+
+	authCfg, err := buildAuthConfig(next, r.dashboard)
+	if err != nil {
+		return nil, err
+	}
+	corsCfg, err := buildCORSConfig(next)
+	if err != nil {
+		return nil, err
+	}
+
+	trusted, err := proxy.ParseTrustedProxies(next.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	adaptive, err := buildAdaptiveCompression(next)
+	if err != nil {
+		return nil, err
+	}
+
+	hooks := loadWebhookConfig(r.path)
+	if err := hooks.Validate(); err != nil {
+		return nil, err
+	}
+	changes := diffGlobalConfig(r.current, next)
+	if hooks.Enabled != r.webhooks.Enabled || !reflect.DeepEqual(hooks.Webhooks, r.webhooks.Webhooks) {
+		changes = append(changes, fmt.Sprintf("webhooks: enabled=%t (%d) -> enabled=%t (%d)",
+			r.webhooks.Enabled, len(r.webhooks.Webhooks), hooks.Enabled, len(hooks.Webhooks)))
+	}
+
+	r.proxy.SetGlobalHeaders(buildSecurityHeaders(next))
+	r.proxy.SetCanonicalHost(next.Defaults.Options.CanonicalHost)
+	r.proxy.SetHTTPRedirectExempt(next.GetHTTPRedirectExempt())
+	pauseRetryAfter, _ := next.GetPauseRetryAfter()
+	r.proxy.SetPauseOptions(next.Pause.ExemptPaths, pauseRetryAfter)
+	proxy.SetTrustedProxies(trusted)
+	proxy.SetAdaptiveCompression(adaptive)
+	r.proxy.UpdateCertificates(certificates)
+	for i, certMapping := range certificates {
+		for _, domain := range certMapping.Domains {
+			if err := r.certMonitor.AddCertificateFromTLS(domain, &certificates[i].Cert); err != nil {
+				log.Warn().Err(err).Str("domain", domain).Msg("Failed to add certificate to monitor")
+			}
+		}
+	}
+	// Stop monitoring certificates and remote targets no longer configured
+	monitored := monitoredCerts(next, certificates)
+	for name := range r.monitored {
+		if !monitored[name] {
+			r.certMonitor.RemoveCertificate(name)
+		}
+	}
+	r.notifier.Reconfigure(hooks)
+	r.auth.Update(authCfg)
+	r.cors.Update(corsCfg)
+	r.metrics.SetRouteLabels(next.Metrics.RouteLabels)
+	r.metrics.SetLabelKeys(next.Metrics.LabelKeys)
+	r.settings.update(next)
+
+	r.current = next
+	r.webhooks = hooks
+	r.monitored = monitored
+
+	if len(changes) == 0 {
+		log.Info().Msg("Global config reloaded, no changes")
+	}
+	for _, change := range changes {
+		log.Info().Str("change", change).Msg("Global config change applied")
+	}
+	return changes, nil
+}
+
+// monitoredCerts returns the certificate monitor entries global.yaml accounts
+// for: the domains of the served certificates and the remote targets
+func monitoredCerts(cfg *config.GlobalConfig, certificates []proxy.CertMapping) map[string]bool {
+	names := make(map[string]bool)
+	for _, mapping := range certificates {
+		for _, domain := range mapping.Domains {
+			names[domain] = true
+		}
+	}
+	for _, target := range cfg.CertMonitor.RemoteTargets {
+		names[target.Address] = true
+	}
+	return names
+}
+
+// Snapshot returns the global configuration and webhooks in use
+func (r *globalReloader) Snapshot() (*config.GlobalConfig, webhook.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current, r.webhooks
+}
+
+// diffGlobalConfig describes the differences between two global configs as
+// human readable "field: old -> new" lines
+func diffGlobalConfig(old, next *config.GlobalConfig) []string {
+	var changes []string
+
+	keys := map[string]bool{}
+	for k := range old.Defaults.Headers {
+		keys[k] = true
+	}
+	for k := range next.Defaults.Headers {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		before, hadBefore := old.Defaults.Headers[k]
+		after, hasAfter := next.Defaults.Headers[k]
+		switch {
+		case !hadBefore:
+			changes = append(changes, fmt.Sprintf("headers.%s: added %q", k, after))
+		case !hasAfter:
+			changes = append(changes, fmt.Sprintf("headers.%s: removed", k))
+		case before != after:
+			changes = append(changes, fmt.Sprintf("headers.%s: %q -> %q", k, before, after))
+		}
+	}
+
+	if !reflect.DeepEqual(old.Defaults.ResponseHeaders, next.Defaults.ResponseHeaders) {
+		changes = append(changes, "defaults.response_headers: changed")
+	}
+	if !reflect.DeepEqual(old.Defaults.Options, next.Defaults.Options) {
+		changes = append(changes, "defaults.options: changed")
+	}
+
+	if before, after := old.GetHTTPRedirectExempt(), next.GetHTTPRedirectExempt(); !reflect.DeepEqual(before, after) {
+		changes = append(changes, fmt.Sprintf("server.http_redirect_exempt: [%s] -> [%s]",
+			strings.Join(before, ", "), strings.Join(after, ", ")))
+	}
+
+	if !reflect.DeepEqual(old.Pause, next.Pause) {
+		changes = append(changes, fmt.Sprintf("pause: exempt_paths [%s], retry_after %q",
+			strings.Join(next.Pause.ExemptPaths, ", "), next.Pause.RetryAfter))
+	}
+
+	if !reflect.DeepEqual(old.TrustedProxies, next.TrustedProxies) {
+		changes = append(changes, fmt.Sprintf("trusted_proxies: [%s] -> [%s]",
+			strings.Join(old.TrustedProxies, ", "), strings.Join(next.TrustedProxies, ", ")))
+	}
+
+	if !reflect.DeepEqual(old.Compression.Adaptive, next.Compression.Adaptive) {
+		changes = append(changes, fmt.Sprintf("compression.adaptive: enabled=%t -> enabled=%t",
+			old.Compression.Adaptive.Enabled, next.Compression.Adaptive.Enabled))
+	}
+
+	if !reflect.DeepEqual(old.Metrics.RouteLabels, next.Metrics.RouteLabels) {
+		changes = append(changes, fmt.Sprintf("metrics.route_labels: %d -> %d routes", len(old.Metrics.RouteLabels), len(next.Metrics.RouteLabels)))
+	}
+	if !reflect.DeepEqual(old.Metrics.LabelKeys, next.Metrics.LabelKeys) {
+		changes = append(changes, fmt.Sprintf("metrics.label_keys: [%s] -> [%s]",
+			strings.Join(old.Metrics.LabelKeys, ", "), strings.Join(next.Metrics.LabelKeys, ", ")))
+	}
+
+	// Listeners are not restarted on reload
+	if old.HTTP2Enabled() != next.HTTP2Enabled() {
+		changes = append(changes, fmt.Sprintf("server.http2: %t -> %t (restart required)", old.HTTP2Enabled(), next.HTTP2Enabled()))
+	}
+	if old.HTTP3Enabled() != next.HTTP3Enabled() {
+		changes = append(changes, fmt.Sprintf("server.http3: %t -> %t (restart required)", old.HTTP3Enabled(), next.HTTP3Enabled()))
+	}
+	if old.Server.MaxConnections != next.Server.MaxConnections {
+		changes = append(changes, fmt.Sprintf("server.max_connections: %d -> %d (restart required)", old.Server.MaxConnections, next.Server.MaxConnections))
+	}
+	if old.Server.HTTP3MaxConnections != next.Server.HTTP3MaxConnections {
+		changes = append(changes, fmt.Sprintf("server.http3_max_connections: %d -> %d (restart required)", old.Server.HTTP3MaxConnections, next.Server.HTTP3MaxConnections))
+	}
+	if old.Server.HTTP3Addr != next.Server.HTTP3Addr || old.AltSvcEnabled() != next.AltSvcEnabled() || old.Server.AltSvcMaxAge != next.Server.AltSvcMaxAge {
+		changes = append(changes, "server: HTTP/3 address or Alt-Svc changed (restart required)")
+	}
+	if !reflect.DeepEqual(old.Server.ProxyProtocol, next.Server.ProxyProtocol) {
+		changes = append(changes, "server.proxy_protocol: changed (restart required)")
+	}
+	oldTimeouts, _ := old.GetServerTimeouts()
+	if nextTimeouts, _ := next.GetServerTimeouts(); oldTimeouts != nextTimeouts {
+		changes = append(changes, fmt.Sprintf("server timeouts: %+v -> %+v (restart required)", oldTimeouts, nextTimeouts))
+	}
+	if !reflect.DeepEqual(old.Server.HTTPSListeners, next.Server.HTTPSListeners) {
+		changes = append(changes, fmt.Sprintf("server.https_listeners: [%s] -> [%s] (restart required)",
+			strings.Join(old.Server.HTTPSListeners, ", "), strings.Join(next.Server.HTTPSListeners, ", ")))
+	}
+
+	// The proxy always drops unknown domains; these flags are reported so the
+	// change is visible in the log
+	if old.Blackhole.UnknownDomains != next.Blackhole.UnknownDomains {
+		changes = append(changes, fmt.Sprintf("blackhole.unknown_domains: %t -> %t", old.Blackhole.UnknownDomains, next.Blackhole.UnknownDomains))
+	}
+	if old.Blackhole.MetricsOnly != next.Blackhole.MetricsOnly {
+		changes = append(changes, fmt.Sprintf("blackhole.metrics_only: %t -> %t", old.Blackhole.MetricsOnly, next.Blackhole.MetricsOnly))
+	}
+
+	if !reflect.DeepEqual(old.TLS.Certificates, next.TLS.Certificates) {
+		changes = append(changes, fmt.Sprintf("tls.certificates: [%s] -> [%s]", certDomains(old), certDomains(next)))
+	}
+
+	if old.GetErrorRateThreshold() != next.GetErrorRateThreshold() {
+		changes = append(changes, fmt.Sprintf("alerts.error_rate_threshold: %.2f -> %.2f", old.GetErrorRateThreshold(), next.GetErrorRateThreshold()))
+	}
+	if old.GetRetentionDays() != next.GetRetentionDays() {
+		changes = append(changes, fmt.Sprintf("cleanup.retention_days: %d -> %d", old.GetRetentionDays(), next.GetRetentionDays()))
+	}
+	if old.GetAuditLogDays() != next.GetAuditLogDays() {
+		changes = append(changes, fmt.Sprintf("defaults.options.retention.audit_log_days: %d -> %d", old.GetAuditLogDays(), next.GetAuditLogDays()))
+	}
+	if old.Retention.Vacuum != next.Retention.Vacuum {
+		changes = append(changes, fmt.Sprintf("retention.vacuum: %t -> %t", old.Retention.Vacuum, next.Retention.Vacuum))
+	}
+	if old.GetVacuumThreshold() != next.GetVacuumThreshold() {
+		changes = append(changes, fmt.Sprintf("retention.vacuum_threshold_mb: %d -> %d", old.GetVacuumThreshold()>>20, next.GetVacuumThreshold()>>20))
+	}
+
+	if !reflect.DeepEqual(old.GetJobs(), next.GetJobs()) {
+		changes = append(changes, "jobs: changed (restart required)")
+	}
+	if old.AccessLog != next.AccessLog {
+		changes = append(changes, "access_log: changed (restart required)")
+	}
+
+	// Secrets are never logged, only that they changed
+	if !reflect.DeepEqual(old.Dashboard.Auth, next.Dashboard.Auth) {
+		changes = append(changes, "dashboard.auth: changed")
+	}
+	if !reflect.DeepEqual(old.Dashboard.CORS, next.Dashboard.CORS) {
+		changes = append(changes, fmt.Sprintf("dashboard.cors.allowed_origins: [%s] -> [%s]",
+			strings.Join(old.Dashboard.CORS.AllowedOrigins, " "), strings.Join(next.Dashboard.CORS.AllowedOrigins, " ")))
+	}
+
+	return changes
+}
+
+func certDomains(cfg *config.GlobalConfig) string {
+	parts := make([]string, 0, len(cfg.TLS.Certificates))
+	for _, cert := range cfg.TLS.Certificates {
+		parts = append(parts, strings.Join(cert.Domains, ","))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,140 @@
+// Package scheduler runs named maintenance tasks on cron schedules.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Task is a unit of scheduled work. It should return promptly once ctx is
+// cancelled.
+type Task func(ctx context.Context) error
+
+// Job binds a schedule to a registered task
+type Job struct {
+	Spec     string
+	Task     string
+	schedule *Schedule
+	running  atomic.Bool
+}
+
+// Scheduler dispatches registered tasks on their cron schedules. A job is
+// never run twice at once: a tick that arrives while the previous run is
+// still going is skipped.
+type Scheduler struct {
+	mu    sync.Mutex
+	tasks map[string]Task
+	jobs  []*Job
+	wg    sync.WaitGroup
+	now   func() time.Time
+}
+
+// New creates an empty scheduler
+func New() *Scheduler {
+	return &Scheduler{tasks: make(map[string]Task), now: time.Now}
+}
+
+// Register makes a task available to jobs under name
+func (s *Scheduler) Register(name string, task Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[name] = task
+}
+
+// Tasks returns the registered task names, sorted
+func (s *Scheduler) Tasks() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.tasks))
+	for name := range s.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Add schedules the registered task on the cron expression spec
+func (s *Scheduler) Add(spec, task string) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tasks[task]; !ok {
+		return fmt.Errorf("unknown task %q", task)
+	}
+	s.jobs = append(s.jobs, &Job{Spec: spec, Task: task, schedule: schedule})
+	return nil
+}
+
+// Run dispatches jobs until ctx is cancelled, then waits for running tasks,
+// whose context is cancelled as well, to return
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	jobs := append([]*Job(nil), s.jobs...)
+	s.mu.Unlock()
+
+	var loops sync.WaitGroup
+	for _, job := range jobs {
+		log.Info().Str("task", job.Task).Str("schedule", job.Spec).
+			Time("next", job.schedule.Next(s.now())).Msg("Scheduled job")
+		loops.Add(1)
+		go func(job *Job) {
+			defer loops.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+	loops.Wait()
+	s.wg.Wait()
+}
+
+// loop sleeps until each of the job's scheduled times and fires it
+func (s *Scheduler) loop(ctx context.Context, job *Job) {
+	for {
+		next := job.schedule.Next(s.now())
+		if next.IsZero() {
+			log.Warn().Str("task", job.Task).Str("schedule", job.Spec).Msg("Job schedule never matches, not running it")
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.fire(ctx, job)
+		}
+	}
+}
+
+// fire starts the job's task unless it is still running from a previous
+// tick. It returns false when the run was skipped.
+func (s *Scheduler) fire(ctx context.Context, job *Job) bool {
+	if !job.running.CompareAndSwap(false, true) {
+		log.Warn().Str("task", job.Task).Msg("Previous run still in progress, skipping scheduled run")
+		return false
+	}
+	s.mu.Lock()
+	task := s.tasks[job.Task]
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer job.running.Store(false)
+		start := s.now()
+		if err := task(ctx); err != nil {
+			log.Error().Err(err).Str("task", job.Task).Dur("duration", time.Since(start)).Msg("Scheduled task failed")
+			return
+		}
+		log.Debug().Str("task", job.Task).Dur("duration", time.Since(start)).Msg("Scheduled task finished")
+	}()
+	return true
+}
@@ -0,0 +1,90 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseAndNext(t *testing.T) {
+	base := time.Date(2024, time.January, 31, 10, 17, 30, 0, time.UTC) // a Wednesday
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, 2, 1, 3, 0, 0, 0, time.UTC)},
+		{"0 */6 * * *", time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * 3", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}, // day of month or weekday
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"5,45 10 * * *", time.Date(2024, 1, 31, 10, 45, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		s, err := Parse(tc.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.spec, err)
+		}
+		if got := s.Next(base); !got.Equal(tc.want) {
+			t.Errorf("Next(%q) = %v, want %v", tc.spec, got, tc.want)
+		}
+	}
+
+	never, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := never.Next(base); !got.IsZero() {
+		t.Errorf("expected no match for February 30, got %v", got)
+	}
+
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@often"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("expected Parse(%q) to fail", bad)
+		}
+	}
+}
+
+func TestSchedulerSkipsOverlapAndCancels(t *testing.T) {
+	s := New()
+	started := make(chan struct{}, 2)
+	s.Register("slow", func(ctx context.Context) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := s.Add("* * * * *", "missing"); err == nil {
+		t.Fatalf("expected unknown task to be rejected")
+	}
+	if err := s.Add("* * * * *", "slow"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := s.jobs[0]
+	if !s.fire(ctx, job) {
+		t.Fatalf("expected first run to start")
+	}
+	<-started
+	if s.fire(ctx, job) {
+		t.Fatalf("expected overlapping run to be skipped")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Run did not return after cancel")
+	}
+	if job.running.Load() {
+		t.Fatalf("task still marked running after shutdown")
+	}
+}
@@ -3,6 +3,7 @@ package tracing
 import (
 	"context"
 	"net/http"
+	"strings"
 
 	"github.com/google/uuid"
 )
@@ -13,6 +14,12 @@ type ContextKey string
 const (
 	// RequestIDKey is the context key for request IDs
 	RequestIDKey ContextKey = "request_id"
+
+	// DefaultRequestIDHeader is the header carrying the request ID
+	DefaultRequestIDHeader = "X-Request-ID"
+
+	// maxRequestIDLength caps inbound IDs so clients cannot bloat logs
+	maxRequestIDLength = 128
 )
 
 // GetRequestID retrieves the request ID from context
@@ -41,6 +48,23 @@ func GenerateRequestID() string {
 	return uuid.New().String()
 }
 
+// ValidRequestID reports whether an inbound request ID can be reused: non
+// empty, at most 128 characters, and only letters, digits and "-_.:/+="
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("-_.:/+=", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // InjectRequestID adds request ID to HTTP request and response
 func InjectRequestID(w http.ResponseWriter, r *http.Request) (string, *http.Request) {
 	// Check if request already has an ID (from upstream proxy)
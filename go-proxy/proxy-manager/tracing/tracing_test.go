@@ -3,6 +3,7 @@ package tracing
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -46,3 +47,18 @@ func TestExtractAndAddRequestIDToHeader(t *testing.T) {
 		t.Error("Header should contain added request ID")
 	}
 }
+
+func TestValidRequestID(t *testing.T) {
+	valid := []string{"abc123", GenerateRequestID(), "req-1_2.3:4/5+6="}
+	for _, id := range valid {
+		if !ValidRequestID(id) {
+			t.Errorf("expected %q to be valid", id)
+		}
+	}
+	invalid := []string{"", "has space", "new\nline", "<script>", strings.Repeat("a", 129)}
+	for _, id := range invalid {
+		if ValidRequestID(id) {
+			t.Errorf("expected %q to be invalid", id)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/chilla55/proxy-manager/config"
+)
+
+// validateConfigs checks global.yaml and every site YAML under sitesPath
+// the same way the proxy does at runtime and writes a per-file report to w.
+// Disabled sites are skipped by the watcher, so only their parsing and
+// options are checked. Returns the number of files that failed.
+func validateConfigs(globalPath, sitesPath string, w io.Writer) int {
+	failed := 0
+	checked := 1
+
+	warn := func(file string, warnings []string) {
+		for _, warning := range warnings {
+			fmt.Fprintf(w, "WARN %s: %s\n", file, warning)
+		}
+	}
+	report := func(file, status string, err error) {
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL %s: %s\n", file, err)
+			return
+		}
+		fmt.Fprintf(w, "OK   %s%s\n", file, status)
+	}
+
+	globalCfg, err := config.LoadGlobalConfig(globalPath)
+	if err == nil {
+		err = globalCfg.Validate()
+		warn(globalPath, globalCfg.HeaderWarnings())
+	}
+	report(globalPath, "", err)
+
+	files, err := filepath.Glob(filepath.Join(sitesPath, "*.yaml"))
+	if err != nil {
+		fmt.Fprintf(w, "FAIL %s: %s\n", sitesPath, err)
+		return failed + 1
+	}
+	ymlFiles, _ := filepath.Glob(filepath.Join(sitesPath, "*.yml"))
+	files = append(files, ymlFiles...)
+	sort.Strings(files)
+
+	for _, file := range files {
+		checked++
+		cfg, err := config.LoadSiteConfig(file)
+		if err != nil {
+			report(file, "", err)
+			continue
+		}
+		status := ""
+		if cfg.Enabled {
+			err = cfg.Validate()
+			warn(file, cfg.HeaderWarnings())
+		} else {
+			status = " (disabled, routes not checked)"
+		}
+		if err == nil {
+			_, err = cfg.GetOptions()
+		}
+		report(file, status, err)
+	}
+
+	fmt.Fprintf(w, "%d file(s) checked, %d failed\n", checked, failed)
+	return failed
+}
@@ -9,6 +9,8 @@ import (
 	"strings"
 
 	"github.com/rs/zerolog/log"
+
+	"github.com/chilla55/proxy-manager/proxy"
 )
 
 // Config holds WAF configuration
@@ -210,7 +212,7 @@ func (w *WAF) Middleware(route string) func(http.Handler) http.Handler {
 				return
 			}
 
-			ip := extractIP(r)
+			ip := proxy.ClientIP(r)
 
 			// Check whitelist
 			if w.whitelist[ip] {
@@ -383,24 +385,6 @@ func isSafeHeader(header string) bool {
 	return safeHeaders[strings.ToLower(header)]
 }
 
-// extractIP extracts the client IP from the request
-func extractIP(r *http.Request) string {
-	if ip := r.Header.Get("X-Real-IP"); ip != "" {
-		return ip
-	}
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		parts := strings.Split(xff, ",")
-		if len(parts) > 0 {
-			return strings.TrimSpace(parts[0])
-		}
-	}
-	ip := r.RemoteAddr
-	if idx := strings.LastIndex(ip, ":"); idx != -1 {
-		ip = ip[:idx]
-	}
-	return ip
-}
-
 // truncate truncates a string to maxLen
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
@@ -0,0 +1,121 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chilla55/proxy-manager/config"
+)
+
+// BackendCheck is what loading a site does about routes whose backend does
+// not respond
+type BackendCheck string
+
+const (
+	BackendCheckOff  BackendCheck = "off"  // Backends are not probed
+	BackendCheckWarn BackendCheck = "warn" // Unreachable backends are logged, the site loads
+	BackendCheckFail BackendCheck = "fail" // A site with an unreachable backend is rejected
+)
+
+// defaultBackendCheckTimeout bounds each probe unless configured
+const defaultBackendCheckTimeout = 5 * time.Second
+
+// ParseBackendCheck parses off, warn or fail; empty means off
+func ParseBackendCheck(s string) (BackendCheck, error) {
+	switch mode := BackendCheck(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "":
+		return BackendCheckOff, nil
+	case BackendCheckOff, BackendCheckWarn, BackendCheckFail:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid backend check %q (off, warn or fail)", s)
+	}
+}
+
+// SetBackendCheck makes site loading probe the backend of each new or
+// changed route, all at once with the given timeout (0 for the default).
+// Off by default, since backends often start after the proxy.
+func (w *SiteWatcher) SetBackendCheck(mode BackendCheck, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultBackendCheckTimeout
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.backendCheck = mode
+	w.backendCheckTimeout = timeout
+}
+
+// checkBackends probes the backends of the routes in cfg that oldCfg, the
+// loaded version of the site if any, does not already route to the same
+// backend. It returns one message per unreachable backend, sorted.
+func (w *SiteWatcher) checkBackends(oldCfg, cfg *config.SiteConfig) []string {
+	if w.backendCheck == "" || w.backendCheck == BackendCheckOff {
+		return nil
+	}
+
+	known := make(map[string]string)
+	if oldCfg != nil {
+		for _, route := range oldCfg.Routes {
+			known[routeID(route)] = route.Backend
+		}
+	}
+	routes := make(map[string][]string) // backend -> route IDs
+	for _, route := range cfg.Routes {
+		id := routeID(route)
+		if route.Backend == "" || known[id] == route.Backend {
+			continue
+		}
+		routes[route.Backend] = append(routes[route.Backend], id)
+	}
+	if len(routes) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.backendCheckTimeout)
+	defer cancel()
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		failures []string
+	)
+	for backend, ids := range routes {
+		wg.Add(1)
+		go func(backend string, ids []string) {
+			defer wg.Done()
+			if err := probeBackend(ctx, client, backend); err != nil {
+				mu.Lock()
+				failures = append(failures, fmt.Sprintf("%s -> %s: %s", strings.Join(ids, ", "), backend, err))
+				mu.Unlock()
+			}
+		}(backend, ids)
+	}
+	wg.Wait()
+	sort.Strings(failures)
+	return failures
+}
+
+// probeBackend sends a GET to backend. Any HTTP response counts as reachable,
+// since the root of a backend may well answer 404 or redirect.
+func probeBackend(ctx context.Context, client *http.Client, backend string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, backend, nil)
+	if err != nil {
+		return fmt.Errorf("invalid backend url")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,84 @@
+package watcher
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// GeoIPDatabase is a GeoIP database that can be reopened from its file
+type GeoIPDatabase interface {
+	Path() string
+	Reload() error
+}
+
+// GeoIPWatcher reloads the GeoIP database when an updater replaces the file
+type GeoIPWatcher struct {
+	db       GeoIPDatabase
+	debug    bool
+	debounce time.Duration
+}
+
+// NewGeoIPWatcher creates a watcher for db's file
+func NewGeoIPWatcher(db GeoIPDatabase, debug bool) *GeoIPWatcher {
+	return &GeoIPWatcher{
+		db:       db,
+		debug:    debug,
+		debounce: 2 * time.Second, // Let the updater finish writing
+	}
+}
+
+// Start watches the database's directory until ctx is done. The directory is
+// watched rather than the file because updaters replace it by renaming.
+func (w *GeoIPWatcher) Start(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	path := filepath.Clean(w.db.Path())
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		return err
+	}
+	log.Printf("[geoip-watcher] Watching %s", path)
+
+	// Writes come in bursts; reload once they stop
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[geoip-watcher] Stopping GeoIP watcher")
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) != path || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			if w.debug {
+				log.Printf("[geoip-watcher] Database file changed: %s", event)
+			}
+			timer.Reset(w.debounce)
+
+		case <-timer.C:
+			// Reload logs the outcome; a failed one keeps the old database
+			// and the next change retries
+			w.db.Reload()
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("[geoip-watcher] Error: %s", err)
+		}
+	}
+}
@@ -2,24 +2,39 @@ package watcher
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/chilla55/proxy-manager/config"
+	"github.com/chilla55/proxy-manager/proxy"
 	"github.com/fsnotify/fsnotify"
 )
 
 type ProxyServer interface {
 	AddRoute(domains []string, path, backendURL string, headers map[string]string, websocket bool, options map[string]interface{}) error
+	ReplaceRoute(domains []string, path, backendURL string, headers map[string]string, websocket bool, options map[string]interface{}) error
 	RemoveRoute(domains []string, path string)
+	RemoveRouteMatch(domains []string, path string, match proxy.RouteMatch)
 }
 
 type SiteWatcher struct {
 	sitesPath   string
 	proxyServer ProxyServer
 	debug       bool
+	mu          sync.Mutex                    // guards loadedSites and route changes
 	loadedSites map[string]*config.SiteConfig // filename -> config
+	initialLoad sync.Once
+
+	backendCheck        BackendCheck // Probe new backends when loading, off by default
+	backendCheckTimeout time.Duration
 }
 
 func NewSiteWatcher(sitesPath string, proxyServer ProxyServer, debug bool) *SiteWatcher {
@@ -31,9 +46,16 @@ func NewSiteWatcher(sitesPath string, proxyServer ProxyServer, debug bool) *Site
 	}
 }
 
+// InitialLoad applies every enabled site config in sitesPath to the proxy.
+// Call it before the proxy starts serving so static sites are routable from
+// the first request; Start runs it too if it has not happened yet.
+func (w *SiteWatcher) InitialLoad() {
+	w.initialLoad.Do(w.loadAllSites)
+}
+
 func (w *SiteWatcher) Start(ctx context.Context) {
 	// Initial load of all site configs
-	w.loadAllSites()
+	w.InitialLoad()
 
 	// Watch for changes
 	watcher, err := fsnotify.NewWatcher()
@@ -62,7 +84,7 @@ func (w *SiteWatcher) Start(ctx context.Context) {
 				if filepath.Ext(event.Name) == ".yaml" || filepath.Ext(event.Name) == ".yml" {
 					w.reloadSite(event.Name)
 				}
-			} else if event.Op&fsnotify.Remove != 0 {
+			} else if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
 				if filepath.Ext(event.Name) == ".yaml" || filepath.Ext(event.Name) == ".yml" {
 					w.removeSite(event.Name)
 				}
@@ -77,27 +99,53 @@ func (w *SiteWatcher) Start(ctx context.Context) {
 }
 
 func (w *SiteWatcher) loadAllSites() {
-	files, err := filepath.Glob(filepath.Join(w.sitesPath, "*.yaml"))
+	files, err := w.siteFiles()
 	if err != nil {
 		log.Printf("[watcher] Failed to list YAML files: %s", err)
 		return
 	}
 
+	for _, file := range files {
+		w.loadSite(file)
+	}
+
+	w.mu.Lock()
+	loaded := len(w.loadedSites)
+	w.mu.Unlock()
+	log.Printf("[watcher] Loaded %d of %d site config(s) from %s", loaded, len(files), w.sitesPath)
+}
+
+// siteFiles lists the *.yaml and *.yml files in sitesPath
+func (w *SiteWatcher) siteFiles() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(w.sitesPath, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
 	ymlFiles, err := filepath.Glob(filepath.Join(w.sitesPath, "*.yml"))
 	if err == nil {
 		files = append(files, ymlFiles...)
 	}
+	return files, nil
+}
 
-	for _, file := range files {
-		w.loadSite(file)
+func (w *SiteWatcher) loadSite(filename string) {
+	if _, err := w.applySite(filename); err != nil {
+		log.Printf("[watcher] %s", err)
 	}
 }
 
-func (w *SiteWatcher) loadSite(filename string) {
+// applySite loads filename and brings the proxy in line with it. A file that
+// fails to load or validate leaves the site's current routes in place.
+func (w *SiteWatcher) applySite(filename string) (RouteDelta, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var delta RouteDelta
+
 	cfg, err := config.LoadSiteConfig(filename)
 	if err != nil {
-		log.Printf("[watcher] Failed to load %s: %s", filename, err)
-		return
+		return delta, fmt.Errorf("failed to load %s: %w", filename, err)
 	}
 
 	// Check if enabled
@@ -109,52 +157,52 @@ func (w *SiteWatcher) loadSite(filename string) {
 		if oldCfg, exists := w.loadedSites[filename]; exists {
 			w.removeSiteRoutes(oldCfg)
 			delete(w.loadedSites, filename)
+			for _, route := range oldCfg.Routes {
+				delta.Removed = append(delta.Removed, routeID(route))
+			}
+			log.Printf("[watcher] Disabled site config: %s (%d routes removed)", filepath.Base(filename), len(oldCfg.Routes))
 		}
-		return
+		return delta, nil
 	}
 
 	// Validate config
 	if err := cfg.Validate(); err != nil {
-		log.Printf("[watcher] Invalid config in %s: %s", filename, err)
-		return
+		return delta, fmt.Errorf("invalid config in %s: %w", filename, err)
+	}
+	for _, warning := range cfg.HeaderWarnings() {
+		log.Printf("[watcher] %s: %s", filepath.Base(filename), warning)
 	}
 
 	// Get parsed options
 	options, err := cfg.GetOptions()
 	if err != nil {
-		log.Printf("[watcher] Invalid options in %s: %s", filename, err)
-		return
+		return delta, fmt.Errorf("invalid options in %s: %w", filename, err)
+	}
+
+	if failures := w.checkBackends(w.loadedSites[filename], cfg); len(failures) > 0 {
+		if w.backendCheck == BackendCheckFail {
+			return delta, fmt.Errorf("unreachable backends in %s: %s", filename, strings.Join(failures, "; "))
+		}
+		for _, failure := range failures {
+			log.Printf("[watcher] %s: unreachable backend %s", filepath.Base(filename), failure)
+		}
 	}
 
-	// Remove old routes if this site was previously loaded
+	// Apply only what changed if this site was previously loaded
 	if oldCfg, exists := w.loadedSites[filename]; exists {
-		w.removeSiteRoutes(oldCfg)
+		delta = w.reconcileSite(oldCfg, cfg, options)
+		w.loadedSites[filename] = cfg
+		log.Printf("[watcher] Reloaded site config: %s (%s)", filepath.Base(filename), delta)
+		return delta, nil
 	}
 
 	// Add all routes
 	for _, route := range cfg.Routes {
-		// Merge global headers with route-specific headers
-		headers := make(map[string]string)
-		for k, v := range cfg.Headers {
-			headers[k] = v
-		}
-		for k, v := range route.Headers {
-			headers[k] = v
-		}
-
-		err := w.proxyServer.AddRoute(
-			route.Domains,
-			route.Path,
-			route.Backend,
-			headers,
-			route.WebSocket,
-			options,
-		)
-
-		if err != nil {
+		if err := w.addRoute(cfg, route, options); err != nil {
 			log.Printf("[watcher] Failed to add route for %s: %s", filename, err)
 			continue
 		}
+		delta.Added = append(delta.Added, routeID(route))
 
 		if w.debug {
 			log.Printf("[watcher] Loaded route: %v%s -> %s from %s",
@@ -165,6 +213,152 @@ func (w *SiteWatcher) loadSite(filename string) {
 	// Store loaded config
 	w.loadedSites[filename] = cfg
 	log.Printf("[watcher] Loaded site config: %s (%d routes)", filepath.Base(filename), len(cfg.Routes))
+	return delta, nil
+}
+
+// RouteDelta records which routes a reload added, removed or changed.
+// Routes are identified as "domain[,domain...]/path", followed by their
+// request predicates in brackets when they have any.
+type RouteDelta struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+func (d RouteDelta) String() string {
+	if len(d.Added)+len(d.Removed)+len(d.Changed) == 0 {
+		return "no route changes"
+	}
+	var parts []string
+	if len(d.Added) > 0 {
+		parts = append(parts, "added "+strings.Join(d.Added, ", "))
+	}
+	if len(d.Removed) > 0 {
+		parts = append(parts, "removed "+strings.Join(d.Removed, ", "))
+	}
+	if len(d.Changed) > 0 {
+		parts = append(parts, "changed "+strings.Join(d.Changed, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// reconcileSite applies the difference between two versions of a site to the
+// proxy. Unchanged routes are left alone and changed routes are swapped in
+// place so traffic is never without a route.
+func (w *SiteWatcher) reconcileSite(oldCfg, cfg *config.SiteConfig, options map[string]interface{}) RouteDelta {
+	var delta RouteDelta
+
+	oldRoutes := make(map[string]config.RouteConfig, len(oldCfg.Routes))
+	for _, route := range oldCfg.Routes {
+		oldRoutes[routeID(route)] = route
+	}
+	newRoutes := make(map[string]bool, len(cfg.Routes))
+	for _, route := range cfg.Routes {
+		newRoutes[routeID(route)] = true
+	}
+
+	// Remove first so re-added routes do not collide with stale ones
+	for _, route := range oldCfg.Routes {
+		if !newRoutes[routeID(route)] {
+			w.proxyServer.RemoveRouteMatch(route.Domains, route.Path, routeMatch(route))
+			delta.Removed = append(delta.Removed, routeID(route))
+		}
+	}
+
+	optionsChanged := !reflect.DeepEqual(oldCfg.Options, cfg.Options)
+	for _, route := range cfg.Routes {
+		id := routeID(route)
+		old, existed := oldRoutes[id]
+		switch {
+		case !existed:
+			if err := w.addRoute(cfg, route, options); err != nil {
+				log.Printf("[watcher] Failed to add route %s: %s", id, err)
+				continue
+			}
+			delta.Added = append(delta.Added, id)
+		case optionsChanged || old.Backend != route.Backend || old.WebSocket != route.WebSocket ||
+			!reflect.DeepEqual(mergeHeaders(oldCfg, old), mergeHeaders(cfg, route)) ||
+			!reflect.DeepEqual(old.Labels, route.Labels):
+			if err := w.proxyServer.ReplaceRoute(route.Domains, route.Path, route.Backend, mergeHeaders(cfg, route), route.WebSocket, routeOptions(options, route)); err != nil {
+				log.Printf("[watcher] Failed to update route %s: %s", id, err)
+				continue
+			}
+			delta.Changed = append(delta.Changed, id)
+		}
+	}
+
+	return delta
+}
+
+func (w *SiteWatcher) addRoute(cfg *config.SiteConfig, route config.RouteConfig, options map[string]interface{}) error {
+	return w.proxyServer.AddRoute(
+		route.Domains,
+		route.Path,
+		route.Backend,
+		mergeHeaders(cfg, route),
+		route.WebSocket,
+		routeOptions(options, route),
+	)
+}
+
+// routeOptions adds the route's request predicates and labels to the site
+// options
+func routeOptions(options map[string]interface{}, route config.RouteConfig) map[string]interface{} {
+	match := routeMatch(route)
+	if match.IsZero() && len(route.Labels) == 0 {
+		return options
+	}
+	opts := make(map[string]interface{}, len(options)+2)
+	for k, v := range options {
+		opts[k] = v
+	}
+	if !match.IsZero() {
+		opts["match"] = match
+	}
+	if len(route.Labels) > 0 {
+		opts["labels"] = route.Labels
+	}
+	return opts
+}
+
+// routeMatch converts the route's predicates for the proxy
+func routeMatch(route config.RouteConfig) proxy.RouteMatch {
+	convert := func(matches []config.MatchConfig) []proxy.ValueMatch {
+		var out []proxy.ValueMatch
+		for _, m := range matches {
+			out = append(out, proxy.ValueMatch{Name: m.Name, Type: m.Type, Value: m.Value})
+		}
+		return out
+	}
+	return proxy.RouteMatch{
+		Headers: convert(route.HeaderMatch),
+		Cookies: convert(route.CookieMatch),
+		Query:   convert(route.QueryMatch),
+	}
+}
+
+// mergeHeaders merges site-wide headers with route-specific headers
+func mergeHeaders(cfg *config.SiteConfig, route config.RouteConfig) map[string]string {
+	headers := make(map[string]string)
+	for k, v := range cfg.Headers {
+		headers[k] = v
+	}
+	for k, v := range route.Headers {
+		headers[k] = v
+	}
+	return headers
+}
+
+// routeID identifies a route within a site by its domains, path and
+// request predicates
+func routeID(route config.RouteConfig) string {
+	domains := append([]string(nil), route.Domains...)
+	sort.Strings(domains)
+	id := strings.Join(domains, ",") + route.Path
+	if key := routeMatch(route).Key(); key != "" {
+		id += " [" + strings.ReplaceAll(key, "\n", " ") + "]"
+	}
+	return id
 }
 
 func (w *SiteWatcher) reloadSite(filename string) {
@@ -178,24 +372,141 @@ func (w *SiteWatcher) reloadSite(filename string) {
 	w.loadSite(filename)
 }
 
-func (w *SiteWatcher) removeSite(filename string) {
+func (w *SiteWatcher) removeSite(filename string) RouteDelta {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var delta RouteDelta
 	cfg, exists := w.loadedSites[filename]
 	if !exists {
-		return
+		return delta
 	}
 
 	w.removeSiteRoutes(cfg)
 	delete(w.loadedSites, filename)
+	for _, route := range cfg.Routes {
+		delta.Removed = append(delta.Removed, routeID(route))
+	}
 
-	log.Printf("[watcher] Removed site config: %s", filepath.Base(filename))
+	log.Printf("[watcher] Removed site config: %s (%d routes removed)", filepath.Base(filename), len(cfg.Routes))
+	return delta
 }
 
 func (w *SiteWatcher) removeSiteRoutes(cfg *config.SiteConfig) {
 	for _, route := range cfg.Routes {
-		w.proxyServer.RemoveRoute(route.Domains, route.Path)
+		w.proxyServer.RemoveRouteMatch(route.Domains, route.Path, routeMatch(route))
 
 		if w.debug {
 			log.Printf("[watcher] Removed route: %v%s", route.Domains, route.Path)
 		}
 	}
 }
+
+// ErrSiteNotFound is returned by ReloadSite when the site is neither on disk
+// nor loaded
+var ErrSiteNotFound = errors.New("site not found")
+
+// SiteInfo describes a site config file for the admin API
+type SiteInfo struct {
+	Name    string `json:"name"`
+	File    string `json:"file"`
+	Service string `json:"service,omitempty"`
+	Enabled bool   `json:"enabled"`
+	Loaded  bool   `json:"loaded"`
+	Routes  int    `json:"routes"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Sites lists every site file in sitesPath plus loaded sites whose file is
+// gone, sorted by name
+func (w *SiteWatcher) Sites() []SiteInfo {
+	files, err := w.siteFiles()
+	if err != nil {
+		log.Printf("[watcher] Failed to list YAML files: %s", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	seen := make(map[string]bool, len(files))
+	sites := make([]SiteInfo, 0, len(files))
+	for _, file := range files {
+		seen[file] = true
+		info := SiteInfo{Name: siteName(file), File: filepath.Base(file)}
+
+		if loaded, ok := w.loadedSites[file]; ok {
+			info.Loaded = true
+			info.Enabled = loaded.Enabled
+			info.Service = loaded.Service.Name
+			info.Routes = len(loaded.Routes)
+		}
+
+		// Report what is on disk so pending edits and errors are visible
+		cfg, err := config.LoadSiteConfig(file)
+		if err != nil {
+			info.Error = err.Error()
+		} else {
+			info.Enabled = cfg.Enabled
+			info.Service = cfg.Service.Name
+			if !info.Loaded {
+				info.Routes = len(cfg.Routes)
+			}
+			if cfg.Enabled {
+				if err := cfg.Validate(); err != nil {
+					info.Error = err.Error()
+				} else if _, err := cfg.GetOptions(); err != nil {
+					info.Error = err.Error()
+				}
+			}
+		}
+		sites = append(sites, info)
+	}
+
+	for file, loaded := range w.loadedSites {
+		if !seen[file] {
+			sites = append(sites, SiteInfo{
+				Name:    siteName(file),
+				File:    filepath.Base(file),
+				Service: loaded.Service.Name,
+				Enabled: loaded.Enabled,
+				Loaded:  true,
+				Routes:  len(loaded.Routes),
+				Error:   "file no longer exists",
+			})
+		}
+	}
+
+	sort.Slice(sites, func(i, j int) bool { return sites[i].Name < sites[j].Name })
+	return sites
+}
+
+// ReloadSite re-reads the YAML file for the named site (file name without
+// extension), validates it and applies the route delta. Validation errors
+// are returned and leave the loaded routes untouched. If the file was
+// deleted, the site's routes are removed.
+func (w *SiteWatcher) ReloadSite(name string) (RouteDelta, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return RouteDelta{}, fmt.Errorf("%w: %q", ErrSiteNotFound, name)
+	}
+
+	for _, ext := range []string{".yaml", ".yml"} {
+		filename := filepath.Join(w.sitesPath, name+ext)
+		if _, err := os.Stat(filename); err == nil {
+			return w.applySite(filename)
+		}
+
+		w.mu.Lock()
+		_, loaded := w.loadedSites[filename]
+		w.mu.Unlock()
+		if loaded {
+			return w.removeSite(filename), nil
+		}
+	}
+
+	return RouteDelta{}, fmt.Errorf("%w: %q", ErrSiteNotFound, name)
+}
+
+func siteName(filename string) string {
+	base := filepath.Base(filename)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
@@ -2,19 +2,33 @@ package watcher
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/chilla55/proxy-manager/proxy"
 )
 
-type dummyProxy struct{ added, removed int }
+type dummyProxy struct{ added, removed, replaced int }
 
 func (d *dummyProxy) AddRoute(domains []string, path, backendURL string, headers map[string]string, websocket bool, options map[string]interface{}) error {
 	d.added++
 	return nil
 }
+func (d *dummyProxy) ReplaceRoute(domains []string, path, backendURL string, headers map[string]string, websocket bool, options map[string]interface{}) error {
+	d.replaced++
+	return nil
+}
 func (d *dummyProxy) RemoveRoute(domains []string, path string) { d.removed++ }
+func (d *dummyProxy) RemoveRouteMatch(domains []string, path string, match proxy.RouteMatch) {
+	d.removed++
+}
 
 func TestLoadSite(t *testing.T) {
 	dir := t.TempDir()
@@ -107,15 +121,23 @@ routes:
 
 	initialAdded := dp.added
 
-	// Now reload
+	// Reloading an unchanged file leaves routes alone
 	w.reloadSite(fname)
+	if dp.removed != 0 || dp.added != initialAdded || dp.replaced != 0 {
+		t.Errorf("expected no route changes on unchanged reload")
+	}
 
-	// Should have removed old routes and added new ones
-	if dp.removed < 1 {
-		t.Errorf("expected routes to be removed on reload")
+	// A changed backend is swapped in place instead of remove + add
+	changed := strings.Replace(yml, "localhost:8080", "localhost:9090", 1)
+	if err := os.WriteFile(fname, []byte(changed), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	w.reloadSite(fname)
+	if dp.replaced != 1 {
+		t.Errorf("expected changed route to be replaced on reload")
 	}
-	if dp.added <= initialAdded {
-		t.Errorf("expected additional routes to be added on reload")
+	if dp.removed != 0 {
+		t.Errorf("expected no removal for a changed route")
 	}
 }
 
@@ -328,3 +350,366 @@ func TestReloadNonExistentSite(t *testing.T) {
 		t.Error("nonexistent file should not add routes")
 	}
 }
+
+func TestStaticSiteServedWithoutRegistry(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", "static")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	enabled := `enabled: true
+service:
+  name: static-svc
+routes:
+  - domains: ["static.example.com"]
+    path: "/"
+    backend: "` + backend.URL + `"
+`
+	disabled := `enabled: false
+service:
+  name: off-svc
+routes:
+  - domains: ["off.example.com"]
+    path: "/"
+    backend: "` + backend.URL + `"
+`
+	if err := os.WriteFile(filepath.Join(dir, "static.yaml"), []byte(enabled), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "off.yaml"), []byte(disabled), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+
+	srv := proxy.NewServer(proxy.Config{})
+	w := NewSiteWatcher(dir, srv.Static(), false)
+	w.InitialLoad()
+
+	req := httptest.NewRequest(http.MethodGet, "http://static.example.com/", nil)
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Backend") != "static" {
+		t.Fatalf("expected static route to be served, got %d", rr.Code)
+	}
+
+	if b := srv.GetBackendStatus("off.example.com", "/"); b != nil {
+		t.Fatalf("disabled site should not be routed")
+	}
+
+	// Disabling the site on disk removes its routes
+	if err := os.WriteFile(filepath.Join(dir, "static.yaml"), []byte(strings.Replace(enabled, "enabled: true", "enabled: false", 1)), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	w.loadSite(filepath.Join(dir, "static.yaml"))
+	if b := srv.GetBackendStatus("static.example.com", "/"); b != nil {
+		t.Fatalf("route should be removed after enabled: false")
+	}
+}
+
+func TestReloadSiteAppliesDelta(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "site.yaml")
+	v1 := `enabled: true
+service:
+  name: delta-svc
+routes:
+  - domains: ["a.example.com"]
+    path: "/"
+    backend: "http://a:8080"
+  - domains: ["b.example.com"]
+    path: "/"
+    backend: "http://b:8080"
+  - domains: ["c.example.com"]
+    path: "/"
+    backend: "http://c:8080"
+`
+	// a unchanged, b backend changed, c removed, d added
+	v2 := `enabled: true
+service:
+  name: delta-svc
+routes:
+  - domains: ["a.example.com"]
+    path: "/"
+    backend: "http://a:8080"
+  - domains: ["b.example.com"]
+    path: "/"
+    backend: "http://b2:8080"
+  - domains: ["d.example.com"]
+    path: "/"
+    backend: "http://d:8080"
+`
+	if err := os.WriteFile(fname, []byte(v1), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+
+	dp := &dummyProxy{}
+	w := NewSiteWatcher(dir, dp, false)
+	w.loadSite(fname)
+	if dp.added != 3 {
+		t.Fatalf("expected 3 routes added, got %d", dp.added)
+	}
+
+	if err := os.WriteFile(fname, []byte(v2), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	w.loadSite(fname)
+	if dp.added != 4 || dp.removed != 1 || dp.replaced != 1 {
+		t.Fatalf("expected +1 -1 ~1, got added=%d removed=%d replaced=%d", dp.added-3, dp.removed, dp.replaced)
+	}
+
+	// Reloading an identical file touches nothing
+	w.loadSite(fname)
+	if dp.added != 4 || dp.removed != 1 || dp.replaced != 1 {
+		t.Fatalf("expected no changes on identical reload")
+	}
+
+	// Deleting the file removes every route of the site
+	w.removeSite(fname)
+	if dp.removed != 4 {
+		t.Fatalf("expected all 3 remaining routes removed, got %d", dp.removed-1)
+	}
+}
+
+func TestLoadSiteBackendCheck(t *testing.T) {
+	up := httptest.NewServer(http.NotFoundHandler())
+	defer up.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := down.URL
+	down.Close()
+
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "site.yaml")
+	site := func(backends ...string) string {
+		yml := "enabled: true\nservice:\n  name: check-svc\nroutes:\n"
+		for i, backend := range backends {
+			yml += fmt.Sprintf("  - domains: [\"%d.example.com\"]\n    path: /\n    backend: %s\n", i, backend)
+		}
+		return yml
+	}
+	write := func(content string) {
+		if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+			t.Fatalf("write yaml: %v", err)
+		}
+	}
+
+	if _, err := ParseBackendCheck("sometimes"); err == nil {
+		t.Fatalf("expected an invalid mode to be rejected")
+	}
+
+	// warn loads the site anyway
+	write(site(up.URL, downURL))
+	dp := &dummyProxy{}
+	w := NewSiteWatcher(dir, dp, false)
+	w.SetBackendCheck(BackendCheckWarn, time.Second)
+	if _, err := w.applySite(fname); err != nil {
+		t.Fatalf("warn mode should load the site: %v", err)
+	}
+	if dp.added != 2 {
+		t.Fatalf("expected 2 routes added, got %d", dp.added)
+	}
+
+	// fail rejects it and names the unreachable route
+	dp = &dummyProxy{}
+	w = NewSiteWatcher(dir, dp, false)
+	w.SetBackendCheck(BackendCheckFail, time.Second)
+	_, err := w.applySite(fname)
+	if err == nil || !strings.Contains(err.Error(), "1.example.com/ -> "+downURL) {
+		t.Fatalf("expected the unreachable route in the error, got %v", err)
+	}
+	if strings.Contains(err.Error(), up.URL) {
+		t.Fatalf("reachable backend reported: %v", err)
+	}
+	if dp.added != 0 {
+		t.Fatalf("expected no routes added, got %d", dp.added)
+	}
+
+	// Only new or changed backends are probed on reload
+	write(site(up.URL))
+	if _, err := w.applySite(fname); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	up.Close()
+	write(site(up.URL) + "headers:\n  X-Edit: \"1\"\n")
+	if _, err := w.applySite(fname); err != nil {
+		t.Fatalf("unchanged backend should not be probed again: %v", err)
+	}
+	write(site(downURL))
+	if _, err := w.applySite(fname); err == nil {
+		t.Fatalf("expected a changed, unreachable backend to be rejected")
+	}
+}
+
+func TestReloadSiteSwapsBackendWithoutGap(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "site.yaml")
+	site := `enabled: true
+service:
+  name: swap-svc
+routes:
+  - domains: ["swap.example.com"]
+    path: "/"
+    backend: "%s"
+`
+	if err := os.WriteFile(fname, []byte(strings.Replace(site, "%s", "http://old:8080", 1)), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+
+	srv := proxy.NewServer(proxy.Config{})
+	w := NewSiteWatcher(dir, srv.Static(), false)
+	w.loadSite(fname)
+
+	if err := os.WriteFile(fname, []byte(strings.Replace(site, "%s", "http://new:8080", 1)), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	w.loadSite(fname)
+
+	summaries := srv.RouteSummaries()
+	if len(summaries) != 1 || summaries[0].BackendURL != "http://new:8080" {
+		t.Fatalf("expected single route to new backend, got %+v", summaries)
+	}
+}
+
+func TestReloadSiteAppliesChangedOptions(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "site.yaml")
+	site := `enabled: true
+service:
+  name: options-svc
+routes:
+  - domains: ["options.example.com"]
+    path: "/"
+    backend: "http://options:8080"
+options:
+  timeout: %s
+`
+	if err := os.WriteFile(fname, []byte(strings.Replace(site, "%s", "5s", 1)), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+
+	srv := proxy.NewServer(proxy.Config{})
+	w := NewSiteWatcher(dir, srv.Static(), false)
+	w.loadSite(fname)
+	if b := srv.GetBackendStatus("options.example.com", "/"); b == nil || b.Timeout != 5*time.Second {
+		t.Fatalf("expected backend with 5s timeout, got %+v", b)
+	}
+
+	// Only the timeout changes; the backend URL stays the same
+	if err := os.WriteFile(fname, []byte(strings.Replace(site, "%s", "50ms", 1)), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	delta, err := w.applySite(fname)
+	if err != nil || len(delta.Changed) != 1 {
+		t.Fatalf("expected the route to be reported as changed, got %s (%v)", delta, err)
+	}
+	if b := srv.GetBackendStatus("options.example.com", "/"); b == nil || b.Timeout != 50*time.Millisecond {
+		t.Fatalf("expected the served backend to use the new 50ms timeout, got %+v", b)
+	}
+	if summaries := srv.RouteSummaries(); len(summaries) != 1 {
+		t.Fatalf("expected a single route after the reload, got %+v", summaries)
+	}
+}
+
+func TestReloadSiteByName(t *testing.T) {
+	dir := t.TempDir()
+	site := `enabled: true
+service:
+  name: named-svc
+routes:
+  - domains: ["named.example.com"]
+    path: "/"
+    backend: "http://named:8080"
+`
+	fname := filepath.Join(dir, "named.yaml")
+	if err := os.WriteFile(fname, []byte(site), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+
+	dp := &dummyProxy{}
+	w := NewSiteWatcher(dir, dp, false)
+
+	delta, err := w.ReloadSite("named")
+	if err != nil {
+		t.Fatalf("ReloadSite error: %v", err)
+	}
+	if len(delta.Added) != 1 || delta.Added[0] != "named.example.com/" {
+		t.Fatalf("expected one added route, got %+v", delta)
+	}
+
+	sites := w.Sites()
+	if len(sites) != 1 || !sites[0].Loaded || sites[0].Routes != 1 || sites[0].Name != "named" {
+		t.Fatalf("unexpected site list: %+v", sites)
+	}
+
+	// Invalid edits are reported and keep the loaded routes
+	if err := os.WriteFile(fname, []byte("enabled: true\nservice:\n  name: named-svc\n"), 0644); err != nil {
+		t.Fatalf("write yaml: %v", err)
+	}
+	if _, err := w.ReloadSite("named"); err == nil {
+		t.Fatalf("expected validation error")
+	}
+	if dp.removed != 0 {
+		t.Fatalf("invalid reload should not remove routes")
+	}
+	if sites := w.Sites(); sites[0].Error == "" || sites[0].Routes != 1 {
+		t.Fatalf("expected error and loaded route count in listing, got %+v", sites[0])
+	}
+
+	// Deleting the file and reloading removes the site
+	if err := os.Remove(fname); err != nil {
+		t.Fatalf("remove yaml: %v", err)
+	}
+	delta, err = w.ReloadSite("named")
+	if err != nil || len(delta.Removed) != 1 {
+		t.Fatalf("expected site removal, got %+v, %v", delta, err)
+	}
+
+	for _, name := range []string{"missing", "../named", ""} {
+		if _, err := w.ReloadSite(name); !errors.Is(err, ErrSiteNotFound) {
+			t.Fatalf("ReloadSite(%q): expected ErrSiteNotFound, got %v", name, err)
+		}
+	}
+}
+
+type stubGeoIP struct {
+	path    string
+	reloads chan struct{}
+}
+
+func (s *stubGeoIP) Path() string { return s.path }
+func (s *stubGeoIP) Reload() error {
+	s.reloads <- struct{}{}
+	return nil
+}
+
+func TestGeoIPWatcherReloadsOnReplace(t *testing.T) {
+	dir := t.TempDir()
+	db := &stubGeoIP{path: filepath.Join(dir, "GeoLite2-City.mmdb"), reloads: make(chan struct{}, 4)}
+	w := NewGeoIPWatcher(db, true)
+	w.debounce = 50 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Start(ctx)
+	time.Sleep(100 * time.Millisecond)
+
+	// Other files in the directory are ignored
+	os.WriteFile(filepath.Join(dir, "GeoLite2-ASN.mmdb"), []byte("x"), 0644)
+	// A burst of writes and the final rename reload once
+	tmp := db.path + ".tmp"
+	for i := 0; i < 3; i++ {
+		os.WriteFile(tmp, []byte(strings.Repeat("x", i+1)), 0644)
+	}
+	os.Rename(tmp, db.path)
+
+	select {
+	case <-db.reloads:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a reload after the database was replaced")
+	}
+	select {
+	case <-db.reloads:
+		t.Fatal("expected a single reload for one replacement")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
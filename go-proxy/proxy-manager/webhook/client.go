@@ -0,0 +1,118 @@
+package webhook
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// DefaultTimeout bounds a delivery when a webhook sets no timeout
+const DefaultTimeout = 10 * time.Second
+
+// Validate checks the delivery settings of every webhook
+func (c Config) Validate() error {
+	for i, hook := range c.Webhooks {
+		if err := hook.prepare(); err != nil {
+			name := hook.Name
+			if name == "" {
+				name = fmt.Sprintf("webhooks[%d]", i)
+			}
+			return fmt.Errorf("webhook %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// prepare builds the webhook's delivery client, or its mailer for the smtp
+// type, from its settings
+func (w *Webhook) prepare() error {
+	var err error
+	if w.Type == TypeSMTP {
+		w.mailer, err = w.newMailer()
+	} else {
+		w.client, err = w.newClient()
+	}
+	return err
+}
+
+// deliveryTimeout returns the configured timeout or DefaultTimeout
+func (w Webhook) deliveryTimeout() (time.Duration, error) {
+	if w.Timeout == "" {
+		return DefaultTimeout, nil
+	}
+	d, err := time.ParseDuration(w.Timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q", w.Timeout)
+	}
+	return d, nil
+}
+
+// tlsConfig returns the TLS settings from ca_file and insecure_skip_verify,
+// nil when neither is set
+func (w Webhook) tlsConfig() (*tls.Config, error) {
+	if w.CAFile == "" && !w.InsecureSkipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: w.InsecureSkipVerify}
+	if w.CAFile != "" {
+		pem, err := os.ReadFile(w.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ca_file: %w", err)
+		}
+		// The system roots stay trusted; the file adds internal CAs
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file %s: no PEM certificates found", w.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// newClient builds the delivery client from the webhook's timeout, proxy
+// and TLS settings. Without a proxy_url the environment's HTTPS_PROXY and
+// HTTP_PROXY apply, as for any Go client.
+func (w Webhook) newClient() (*http.Client, error) {
+	timeout, err := w.deliveryTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if w.ProxyURL != "" {
+		proxyURL, err := url.Parse(w.ProxyURL)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy_url %q", w.ProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, err := w.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// withClients returns a copy of hooks with their delivery clients built. A
+// webhook whose settings are invalid keeps the error, and its deliveries
+// fail with it.
+func withClients(hooks []Webhook) []Webhook {
+	prepared := make([]Webhook, len(hooks))
+	for i, hook := range hooks {
+		hook.clientErr = hook.prepare()
+		prepared[i] = hook
+	}
+	return prepared
+}
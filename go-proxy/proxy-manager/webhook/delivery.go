@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrWebhookNotFound is returned by Test for a name no webhook has
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// Delivery is the outcome of one attempt to deliver an alert to a webhook
+type Delivery struct {
+	Event      EventType `json:"event"`
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"status_code,omitempty"` // 0 when no response arrived
+	LatencyMs  int64     `json:"latency_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// OK reports whether the webhook accepted the delivery
+func (d Delivery) OK() bool { return d.Error == "" }
+
+// deliver sends alert to webhook and records the outcome as its last delivery
+func (n *Notifier) deliver(webhook Webhook, alert Alert) (Delivery, error) {
+	start := time.Now()
+	status, err := n.sendToWebhook(webhook, alert)
+	d := Delivery{
+		Event:      alert.Event,
+		Time:       start,
+		StatusCode: status,
+		LatencyMs:  time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		d.Error = err.Error()
+	}
+
+	n.statsMutex.Lock()
+	if n.deliveries == nil {
+		n.deliveries = make(map[string]Delivery)
+	}
+	n.deliveries[webhook.Name] = d
+	n.statsMutex.Unlock()
+	return d, err
+}
+
+// Test sends a synthetic EventTest alert to the named webhook, whatever
+// events it subscribes to and regardless of throttling, and returns the
+// outcome. The payload is formatted and signed as for a real alert.
+func (n *Notifier) Test(name string) (Delivery, error) {
+	n.configMutex.RLock()
+	webhooks := n.webhooks
+	n.configMutex.RUnlock()
+
+	for _, webhook := range webhooks {
+		if webhook.Name != name {
+			continue
+		}
+		d, _ := n.deliver(webhook, Alert{
+			Event:       EventTest,
+			Title:       "Test alert",
+			Description: "Test delivery requested from the proxy admin API. No action is needed.",
+			Severity:    "info",
+			Fields:      map[string]string{"webhook": name},
+			Timestamp:   time.Now(),
+		})
+		return d, nil
+	}
+	return Delivery{}, ErrWebhookNotFound
+}
+
+// Webhooks returns the configured webhooks
+func (n *Notifier) Webhooks() []Webhook {
+	n.configMutex.RLock()
+	defer n.configMutex.RUnlock()
+	return append([]Webhook(nil), n.webhooks...)
+}
+
+// LastDelivery returns the most recent delivery to the named webhook
+func (n *Notifier) LastDelivery(name string) (Delivery, bool) {
+	n.statsMutex.RLock()
+	defer n.statsMutex.RUnlock()
+	d, ok := n.deliveries[name]
+	return d, ok
+}
@@ -0,0 +1,243 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TypeSMTP is the webhook type that delivers alerts by email
+const TypeSMTP = "smtp"
+
+// SMTP TLS modes
+const (
+	SMTPStartTLS = "starttls" // Plain connection upgraded with STARTTLS (default)
+	SMTPTLS      = "tls"      // Implicit TLS, usually port 465
+	SMTPNoTLS    = "none"     // No encryption, for a local relay only
+)
+
+// Default email templates, executed with the Alert
+const (
+	DefaultSubjectTemplate = `[{{.Severity}}] {{.Title}}`
+	DefaultBodyTemplate    = `{{.Description}}
+{{if .Fields}}
+{{range $name, $value := .Fields}}{{$name}}: {{$value}}
+{{end}}{{end}}
+Event: {{.Event}}
+Time:  {{.Timestamp.Format "2006-01-02 15:04:05 MST"}}
+`
+)
+
+// SMTPConfig configures an smtp destination
+type SMTPConfig struct {
+	Host         string   `yaml:"host"`
+	Port         int      `yaml:"port"` // Default 587, or 465 with tls: tls
+	Username     string   `yaml:"username,omitempty"`
+	Password     string   `yaml:"password,omitempty"`
+	PasswordFile string   `yaml:"password_file,omitempty"`
+	From         string   `yaml:"from"`
+	To           []string `yaml:"to"`
+	TLS          string   `yaml:"tls,omitempty"`     // starttls, tls or none
+	Subject      string   `yaml:"subject,omitempty"` // text/template over the Alert
+	Body         string   `yaml:"body,omitempty"`    // text/template over the Alert
+}
+
+// mailer sends alerts for one smtp destination
+type mailer struct {
+	addr      string
+	host      string
+	mode      string
+	auth      smtp.Auth
+	from      string
+	to        []string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+	subject   *template.Template
+	body      *template.Template
+}
+
+// newMailer checks the smtp settings and parses the templates
+func (w Webhook) newMailer() (*mailer, error) {
+	c := w.SMTP
+	if c == nil || c.Host == "" {
+		return nil, errors.New("smtp.host is required")
+	}
+	timeout, err := w.deliveryTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mailer{host: c.Host, mode: c.TLS, timeout: timeout}
+	if m.mode == "" {
+		m.mode = SMTPStartTLS
+	}
+	port := c.Port
+	switch m.mode {
+	case SMTPTLS:
+		if port == 0 {
+			port = 465
+		}
+	case SMTPStartTLS, SMTPNoTLS:
+		if port == 0 {
+			port = 587
+		}
+	default:
+		return nil, fmt.Errorf("invalid smtp.tls %q (starttls, tls or none)", c.TLS)
+	}
+	m.addr = net.JoinHostPort(c.Host, strconv.Itoa(port))
+
+	from, err := mail.ParseAddress(c.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp.from %q: %w", c.From, err)
+	}
+	m.from = from.Address
+	if len(c.To) == 0 {
+		return nil, errors.New("smtp.to needs at least one recipient")
+	}
+	for _, to := range c.To {
+		addr, err := mail.ParseAddress(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid smtp.to %q: %w", to, err)
+		}
+		m.to = append(m.to, addr.Address)
+	}
+
+	if c.Password != "" && c.PasswordFile != "" {
+		return nil, errors.New("smtp.password and smtp.password_file are mutually exclusive")
+	}
+	password := c.Password
+	if c.PasswordFile != "" {
+		data, err := os.ReadFile(c.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("smtp.password_file: %w", err)
+		}
+		password = strings.TrimSpace(string(data))
+	}
+	if c.Username != "" {
+		// PlainAuth refuses to send the password unencrypted except to localhost
+		m.auth = smtp.PlainAuth("", c.Username, password, c.Host)
+	}
+
+	if m.tlsConfig, err = w.tlsConfig(); err != nil {
+		return nil, err
+	}
+	if m.tlsConfig == nil {
+		m.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	m.tlsConfig.ServerName = c.Host
+
+	subject, body := c.Subject, c.Body
+	if subject == "" {
+		subject = DefaultSubjectTemplate
+	}
+	if body == "" {
+		body = DefaultBodyTemplate
+	}
+	if m.subject, err = template.New("subject").Parse(subject); err != nil {
+		return nil, fmt.Errorf("smtp.subject: %w", err)
+	}
+	if m.body, err = template.New("body").Parse(body); err != nil {
+		return nil, fmt.Errorf("smtp.body: %w", err)
+	}
+	return m, nil
+}
+
+// compose renders alert into an RFC 5322 message
+func (m *mailer) compose(alert Alert) ([]byte, error) {
+	var subject, body bytes.Buffer
+	if err := m.subject.Execute(&subject, alert); err != nil {
+		return nil, fmt.Errorf("subject template: %w", err)
+	}
+	if err := m.body.Execute(&body, alert); err != nil {
+		return nil, fmt.Errorf("body template: %w", err)
+	}
+
+	var msg bytes.Buffer
+	header := func(name, value string) { fmt.Fprintf(&msg, "%s: %s\r\n", name, value) }
+	header("From", m.from)
+	header("To", strings.Join(m.to, ", "))
+	// Subjects are single-line; a template that adds line breaks must not add headers
+	header("Subject", mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(subject.String()), " ")))
+	header("Date", alert.Timestamp.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	header("Content-Transfer-Encoding", "quoted-printable")
+	header("X-Proxy-Event", string(alert.Event))
+	msg.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&msg)
+	qp.Write(bytes.ReplaceAll(body.Bytes(), []byte("\n"), []byte("\r\n")))
+	qp.Close()
+	return msg.Bytes(), nil
+}
+
+// send delivers alert to every recipient in one SMTP transaction
+func (m *mailer) send(alert Alert) error {
+	msg, err := m.compose(alert)
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: m.timeout}
+	var conn net.Conn
+	if m.mode == SMTPTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", m.addr, m.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", m.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", m.addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(m.timeout))
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer client.Close()
+
+	if m.mode == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not offer STARTTLS", m.addr)
+		}
+		if err := client.StartTLS(m.tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if m.auth != nil {
+		if err := client.Auth(m.auth); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := client.Mail(m.from); err != nil {
+		return fmt.Errorf("smtp MAIL FROM: %w", err)
+	}
+	for _, to := range m.to {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s: %w", to, err)
+		}
+	}
+	data, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if _, err := data.Write(msg); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if err := data.Close(); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	return client.Quit()
+}
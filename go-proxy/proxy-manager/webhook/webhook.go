@@ -2,9 +2,15 @@ package webhook
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,11 +19,13 @@ import (
 
 // Notifier handles webhook notifications to external services
 type Notifier struct {
+	configMutex   sync.RWMutex // guards webhooks and enabled
 	webhooks      []Webhook
 	throttle      map[string]time.Time // event -> last alert time
 	throttleMutex sync.RWMutex
 	stats         Stats
 	statsMutex    sync.RWMutex
+	deliveries    map[string]Delivery // webhook name -> last delivery, guarded by statsMutex
 	enabled       bool
 }
 
@@ -27,7 +35,22 @@ type Webhook struct {
 	URL      string   `yaml:"url"`
 	Events   []string `yaml:"events"`   // Which events to send
 	Throttle int      `yaml:"throttle"` // Seconds between alerts for same event
-	Type     string   `yaml:"type"`     // discord, slack, generic
+	Type     string   `yaml:"type"`     // discord, slack, smtp, generic
+	// Secret signs each delivery with HMAC-SHA256 in X-Proxy-Signature
+	Secret string `yaml:"secret,omitempty"`
+
+	// Delivery client settings
+	Timeout            string `yaml:"timeout,omitempty"`              // e.g. 5s, default 10s
+	ProxyURL           string `yaml:"proxy_url,omitempty"`            // Egress proxy, default from the environment
+	CAFile             string `yaml:"ca_file,omitempty"`              // PEM CA trusted in addition to the system roots
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"` // Skip certificate verification (testing only)
+
+	// SMTP configures the smtp type, which emails alerts instead of posting to URL
+	SMTP *SMTPConfig `yaml:"smtp,omitempty"`
+
+	client    *http.Client // Built from the settings above by New and Reconfigure
+	mailer    *mailer      // Built instead of client for the smtp type
+	clientErr error
 }
 
 // EventType represents different alert event types
@@ -38,12 +61,16 @@ const (
 	EventCertExpiring7d    EventType = "cert_expiring_7d"
 	EventCertExpiring14d   EventType = "cert_expiring_14d"
 	EventCertExpiring30d   EventType = "cert_expiring_30d"
+	EventCertCheckFailed   EventType = "cert_check_failed" // A remote certificate target could not be checked
 	EventHighErrorRate     EventType = "high_error_rate"
 	EventFailedLoginSpike  EventType = "failed_login_spike"
 	EventWAFBlockSpike     EventType = "waf_block_spike"
 	EventUnusualCountry    EventType = "unusual_country"
 	EventRateLimitExceeded EventType = "rate_limit_exceeded"
 	EventSlowRequest       EventType = "slow_request"
+	EventProxyPaused       EventType = "proxy_paused"
+	EventProxyResumed      EventType = "proxy_resumed"
+	EventTest              EventType = "test" // Sent on demand by Notifier.Test
 )
 
 // Alert represents an alert to be sent
@@ -100,7 +127,7 @@ func New(config Config) *Notifier {
 	}
 
 	notifier := &Notifier{
-		webhooks: config.Webhooks,
+		webhooks: withClients(config.Webhooks),
 		throttle: make(map[string]time.Time),
 		enabled:  true,
 		stats: Stats{
@@ -118,7 +145,11 @@ func New(config Config) *Notifier {
 
 // Send sends an alert to all configured webhooks
 func (n *Notifier) Send(alert Alert) error {
-	if !n.enabled {
+	n.configMutex.RLock()
+	enabled, webhooks := n.enabled, n.webhooks
+	n.configMutex.RUnlock()
+
+	if !enabled {
 		return nil
 	}
 
@@ -131,7 +162,7 @@ func (n *Notifier) Send(alert Alert) error {
 	var errors []error
 	sent := false
 
-	for _, webhook := range n.webhooks {
+	for _, webhook := range webhooks {
 		// Check if this webhook handles this event
 		if !n.webhookHandlesEvent(webhook, alert.Event) {
 			continue
@@ -150,7 +181,7 @@ func (n *Notifier) Send(alert Alert) error {
 		}
 
 		// Send alert
-		if err := n.sendToWebhook(webhook, alert); err != nil {
+		if _, err := n.deliver(webhook, alert); err != nil {
 			errors = append(errors, fmt.Errorf("%s: %w", webhook.Name, err))
 			n.statsMutex.Lock()
 			n.stats.AlertsFailed++
@@ -189,8 +220,13 @@ func (n *Notifier) webhookHandlesEvent(webhook Webhook, event EventType) bool {
 	return false
 }
 
-// sendToWebhook sends an alert to a specific webhook
-func (n *Notifier) sendToWebhook(webhook Webhook, alert Alert) error {
+// sendToWebhook sends an alert to a specific webhook and returns the HTTP
+// status it answered with, 0 when no response arrived
+func (n *Notifier) sendToWebhook(webhook Webhook, alert Alert) (int, error) {
+	if webhook.Type == TypeSMTP {
+		return 0, n.sendEmail(webhook, alert)
+	}
+
 	var payload interface{}
 
 	switch webhook.Type {
@@ -202,27 +238,37 @@ func (n *Notifier) sendToWebhook(webhook Webhook, alert Alert) error {
 		payload = alert // Generic JSON
 	}
 
+	client := webhook.client
+	if client == nil {
+		if webhook.clientErr != nil {
+			return 0, webhook.clientErr
+		}
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		return 0, fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
 	req, err := http.NewRequest("POST", webhook.URL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	if webhook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(webhook.Secret, time.Now(), jsonData))
+	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send webhook: %w", err)
+		return 0, fmt.Errorf("failed to send webhook: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
 	}
 
 	log.Info().
@@ -231,6 +277,77 @@ func (n *Notifier) sendToWebhook(webhook Webhook, alert Alert) error {
 		Str("title", alert.Title).
 		Msg("Alert sent")
 
+	return resp.StatusCode, nil
+}
+
+// sendEmail sends an alert to an smtp destination
+func (n *Notifier) sendEmail(webhook Webhook, alert Alert) error {
+	if webhook.mailer == nil {
+		if webhook.clientErr != nil {
+			return webhook.clientErr
+		}
+		return fmt.Errorf("smtp destination %s is not configured", webhook.Name)
+	}
+	if err := webhook.mailer.send(alert); err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("webhook", webhook.Name).
+		Str("event", string(alert.Event)).
+		Str("title", alert.Title).
+		Int("recipients", len(webhook.mailer.to)).
+		Msg("Alert emailed")
+
+	return nil
+}
+
+// SignatureHeader carries the signature of a delivery to a webhook with a
+// secret
+const SignatureHeader = "X-Proxy-Signature"
+
+// Sign returns the signature header value for body sent at ts:
+//
+//	t=<unix seconds>,v1=<hex HMAC-SHA256(secret, "<unix seconds>.<body>")>
+//
+// body is the exact request body. Covering the timestamp lets receivers
+// reject replayed deliveries.
+func Sign(secret string, ts time.Time, body []byte) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+	return "t=" + t + ",v1=" + signature(secret, t, body)
+}
+
+func signature(secret, t string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header against body. Deliveries signed more
+// than tolerance away from now are rejected as replays; 0 skips the check.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var t, v1 string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			v1 = value
+		}
+	}
+	ts, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || v1 == "" {
+		return errors.New("malformed signature header")
+	}
+	if !hmac.Equal([]byte(v1), []byte(signature(secret, t, body))) {
+		return errors.New("signature mismatch")
+	}
+	if age := now.Sub(time.Unix(ts, 0)); tolerance > 0 && (age > tolerance || age < -tolerance) {
+		return fmt.Errorf("signature timestamp outside tolerance (%v)", age.Round(time.Second))
+	}
 	return nil
 }
 
@@ -320,7 +437,7 @@ func (n *Notifier) getSeverityColorHex(severity string) string {
 
 // GetStats returns current webhook statistics
 func (n *Notifier) GetStats() Stats {
-	if !n.enabled {
+	if !n.IsEnabled() {
 		return Stats{
 			ByEvent:   make(map[string]int64),
 			ByWebhook: make(map[string]int64),
@@ -350,12 +467,43 @@ func (n *Notifier) GetStats() Stats {
 
 // IsEnabled returns whether webhook notifications are enabled
 func (n *Notifier) IsEnabled() bool {
+	n.configMutex.RLock()
+	defer n.configMutex.RUnlock()
 	return n.enabled
 }
 
+// Reconfigure swaps the webhook list and enabled flag in place so components
+// holding this notifier pick up the change. Stats and throttle state are kept.
+func (n *Notifier) Reconfigure(config Config) {
+	n.throttleMutex.Lock()
+	if n.throttle == nil {
+		n.throttle = make(map[string]time.Time)
+	}
+	n.throttleMutex.Unlock()
+
+	n.statsMutex.Lock()
+	if n.stats.ByEvent == nil {
+		n.stats.ByEvent = make(map[string]int64)
+	}
+	if n.stats.ByWebhook == nil {
+		n.stats.ByWebhook = make(map[string]int64)
+	}
+	n.statsMutex.Unlock()
+
+	n.configMutex.Lock()
+	n.enabled = config.Enabled
+	n.webhooks = withClients(config.Webhooks)
+	n.configMutex.Unlock()
+
+	log.Info().
+		Bool("enabled", config.Enabled).
+		Int("webhooks", len(config.Webhooks)).
+		Msg("Webhook notifier reconfigured")
+}
+
 // ClearThrottle clears throttle state for a specific event
 func (n *Notifier) ClearThrottle(event EventType) {
-	if !n.enabled {
+	if !n.IsEnabled() {
 		return
 	}
 
@@ -368,7 +516,7 @@ func (n *Notifier) ClearThrottle(event EventType) {
 
 // ClearAllThrottles clears all throttle state
 func (n *Notifier) ClearAllThrottles() {
-	if !n.enabled {
+	if !n.IsEnabled() {
 		return
 	}
 
@@ -2,8 +2,16 @@ package webhook
 
 import (
 	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -485,3 +493,357 @@ func TestIsEnabled(t *testing.T) {
 		})
 	}
 }
+
+func TestReconfigure_EnablesDisabledNotifier(t *testing.T) {
+	received := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	notifier := New(Config{Enabled: false})
+	notifier.Reconfigure(Config{
+		Enabled: true,
+		Webhooks: []Webhook{
+			{Name: "reloaded", URL: server.URL, Events: []string{string(EventHighErrorRate)}, Type: "generic"},
+		},
+	})
+
+	if !notifier.IsEnabled() {
+		t.Fatal("Notifier should be enabled after Reconfigure")
+	}
+	if err := notifier.Send(Alert{Event: EventHighErrorRate, Title: "Test"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if received != 1 {
+		t.Errorf("Expected 1 delivery, got %d", received)
+	}
+
+	notifier.Reconfigure(Config{Enabled: false})
+	if notifier.IsEnabled() {
+		t.Error("Notifier should be disabled after Reconfigure")
+	}
+	if stats := notifier.GetStats(); stats.AlertsSent != 0 {
+		t.Error("Disabled notifier should report zero stats")
+	}
+}
+
+func TestSignKnownPayload(t *testing.T) {
+	body := []byte(`{"event":"service_down"}`)
+	ts := time.Unix(1700000000, 0)
+	want := "t=1700000000,v1=3ba8d22bd3af0dd8d459417560617ed1e914fe9adbb3ff337115d360e734189a"
+	if got := Sign("whsec_test", ts, body); got != want {
+		t.Fatalf("Sign = %s, want %s", got, want)
+	}
+
+	if err := Verify("whsec_test", want, body, 5*time.Minute, ts.Add(time.Minute)); err != nil {
+		t.Fatalf("expected valid signature: %v", err)
+	}
+	if err := Verify("other", want, body, 5*time.Minute, ts); err == nil {
+		t.Fatal("expected wrong secret to fail")
+	}
+	if err := Verify("whsec_test", want, []byte(`{"event":"service_up"}`), 5*time.Minute, ts); err == nil {
+		t.Fatal("expected modified body to fail")
+	}
+	if err := Verify("whsec_test", want, body, 5*time.Minute, ts.Add(time.Hour)); err == nil {
+		t.Fatal("expected replayed delivery to fail")
+	}
+	if err := Verify("whsec_test", "v1=abc", body, 0, ts); err == nil {
+		t.Fatal("expected header without timestamp to fail")
+	}
+}
+
+func TestSend_SignsWithSecret(t *testing.T) {
+	headers := make(chan http.Header, 2)
+	bodies := make(chan []byte, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		headers <- r.Header
+		bodies <- body
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	notifier := New(Config{
+		Enabled: true,
+		Webhooks: []Webhook{
+			{Name: "signed", URL: server.URL, Events: []string{string(EventServiceDown)}, Secret: "s3cret"},
+			{Name: "plain", URL: server.URL, Events: []string{string(EventServiceDown)}},
+		},
+	})
+	if err := notifier.Send(Alert{Event: EventServiceDown, Title: "down", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	if len(headers) != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", len(headers))
+	}
+	signed := 0
+	for i := 0; i < 2; i++ {
+		header, body := <-headers, <-bodies
+		sig := header.Get(SignatureHeader)
+		if sig == "" {
+			continue
+		}
+		signed++
+		if err := Verify("s3cret", sig, body, time.Minute, time.Now()); err != nil {
+			t.Fatalf("delivered signature does not verify: %v", err)
+		}
+	}
+	if signed != 1 {
+		t.Fatalf("expected only the webhook with a secret to be signed, got %d", signed)
+	}
+}
+
+func TestDeliveryClient_CustomCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatalf("write CA: %v", err)
+	}
+
+	send := func(hook Webhook) error {
+		hook.Name = "internal"
+		hook.URL = server.URL
+		hook.Events = []string{string(EventServiceDown)}
+		return New(Config{Enabled: true, Webhooks: []Webhook{hook}}).Send(Alert{Event: EventServiceDown, Timestamp: time.Now()})
+	}
+	if err := send(Webhook{}); err == nil {
+		t.Fatal("expected delivery to an unknown CA to fail")
+	}
+	if err := send(Webhook{CAFile: caFile, Timeout: "2s"}); err != nil {
+		t.Fatalf("expected delivery trusting the CA file to succeed: %v", err)
+	}
+	if err := send(Webhook{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("expected insecure_skip_verify delivery to succeed: %v", err)
+	}
+}
+
+func TestDeliveryClient_ProxyAndValidation(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String() // A forward proxy sees the absolute URL
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	hook := Webhook{Name: "egress", URL: "http://hooks.internal.test/alert", Events: []string{string(EventServiceDown)}, ProxyURL: proxy.URL}
+	if err := New(Config{Enabled: true, Webhooks: []Webhook{hook}}).Send(Alert{Event: EventServiceDown, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Send through proxy failed: %v", err)
+	}
+	if proxied != "http://hooks.internal.test/alert" {
+		t.Fatalf("expected the request to go through the proxy, got %q", proxied)
+	}
+
+	for _, bad := range []Webhook{{Timeout: "soon"}, {Timeout: "-1s"}, {ProxyURL: "::"}, {CAFile: "/nonexistent/ca.pem"}} {
+		if err := (Config{Webhooks: []Webhook{bad}}).Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+	if err := (Config{Webhooks: []Webhook{{Timeout: "3s", ProxyURL: "http://proxy:3128"}}}).Validate(); err != nil {
+		t.Errorf("expected valid settings to pass: %v", err)
+	}
+}
+
+func TestTest_SendsToOneWebhookAndRecordsDelivery(t *testing.T) {
+	var got Alert
+	var signed bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		signed = r.Header.Get(SignatureHeader) != ""
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer failing.Close()
+
+	// Neither webhook subscribes to the test event
+	n := New(Config{Enabled: true, Webhooks: []Webhook{
+		{Name: "ops", URL: server.URL, Events: []string{string(EventServiceDown)}, Secret: "s"},
+		{Name: "broken", URL: failing.URL, Events: []string{string(EventServiceDown)}},
+	}})
+
+	if _, ok := n.LastDelivery("ops"); ok {
+		t.Fatal("expected no delivery before the first send")
+	}
+	d, err := n.Test("ops")
+	if err != nil {
+		t.Fatalf("Test: %v", err)
+	}
+	if !d.OK() || d.StatusCode != http.StatusNoContent || d.Event != EventTest {
+		t.Fatalf("unexpected delivery %+v", d)
+	}
+	if got.Event != EventTest || !signed {
+		t.Fatalf("expected a signed test alert, got %+v (signed=%v)", got, signed)
+	}
+	if last, ok := n.LastDelivery("ops"); !ok || last != d {
+		t.Fatalf("expected last delivery %+v, got %+v", d, last)
+	}
+
+	d, err = n.Test("broken")
+	if err != nil || d.OK() || d.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected a failed delivery with status 403, got %+v, %v", d, err)
+	}
+	if _, err := n.Test("missing"); err != ErrWebhookNotFound {
+		t.Fatalf("expected ErrWebhookNotFound, got %v", err)
+	}
+	if stats := n.GetStats(); stats.AlertsSent != 0 || stats.AlertsFailed != 0 {
+		t.Fatalf("test deliveries should not count as alerts: %+v", stats)
+	}
+}
+
+// mockSMTP is a minimal SMTP server recording one transaction per connection
+type mockSMTP struct {
+	ln   net.Listener
+	auth string
+	from string
+	rcpt []string
+	data string
+	done chan struct{}
+}
+
+func newMockSMTP(t *testing.T) *mockSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	m := &mockSMTP{ln: ln, done: make(chan struct{}, 8)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			m.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return m
+}
+
+func (m *mockSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 mock ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			tp.PrintfLine("250-mock")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			m.auth = arg
+			tp.PrintfLine("235 ok")
+		case "MAIL":
+			m.from = arg
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			m.rcpt = append(m.rcpt, arg)
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, _ := tp.ReadDotBytes()
+			m.data = string(data)
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			m.done <- struct{}{}
+			return
+		default:
+			tp.PrintfLine("502 unknown")
+		}
+	}
+}
+
+func TestSMTPDestination(t *testing.T) {
+	server := newMockSMTP(t)
+	host, port, _ := net.SplitHostPort(server.ln.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+
+	n := New(Config{Enabled: true, Webhooks: []Webhook{{
+		Name:   "certs-mail",
+		Type:   TypeSMTP,
+		Events: []string{string(EventCertExpiring7d)},
+		SMTP: &SMTPConfig{
+			Host: host, Port: portNum, TLS: SMTPNoTLS,
+			Username: "alerts", Password: "pw",
+			From: "Proxy <proxy@example.com>",
+			To:   []string{"ops@example.com", "Web Team <web@example.com>"},
+		},
+	}}})
+
+	// Not routed to this destination
+	if err := n.Send(Alert{Event: EventServiceDown, Title: "down", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	alert := Alert{
+		Event:       EventCertExpiring7d,
+		Title:       "Certificate expires in 5 days",
+		Description: "Renew example.com",
+		Severity:    "warning",
+		Fields:      map[string]string{"domain": "example.com"},
+		Timestamp:   time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	if err := n.Send(alert); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case <-server.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail delivered")
+	}
+
+	if server.auth == "" || server.from != "FROM:<proxy@example.com>" {
+		t.Fatalf("unexpected auth %q / from %q", server.auth, server.from)
+	}
+	if len(server.rcpt) != 2 || server.rcpt[0] != "TO:<ops@example.com>" || server.rcpt[1] != "TO:<web@example.com>" {
+		t.Fatalf("unexpected recipients %v", server.rcpt)
+	}
+	for _, want := range []string{
+		// ReadDotBytes turns CRLF into LF
+		"Subject: [warning] Certificate expires in 5 days\n",
+		"To: ops@example.com, web@example.com\n",
+		"X-Proxy-Event: cert_expiring_7d\n",
+		"\nRenew example.com\n\ndomain: example.com\n",
+	} {
+		if !strings.Contains(server.data, want) {
+			t.Errorf("message missing %q:\n%s", want, server.data)
+		}
+	}
+	if stats := n.GetStats(); stats.AlertsSent != 1 {
+		t.Fatalf("expected 1 alert sent, got %d", stats.AlertsSent)
+	}
+}
+
+func TestSMTPDestination_Validation(t *testing.T) {
+	valid := SMTPConfig{Host: "mail.example.com", From: "proxy@example.com", To: []string{"ops@example.com"}}
+	if err := (Config{Webhooks: []Webhook{{Type: TypeSMTP, SMTP: &valid}}}).Validate(); err != nil {
+		t.Fatalf("expected valid smtp config: %v", err)
+	}
+	for _, mutate := range []func(c *SMTPConfig){
+		func(c *SMTPConfig) { c.Host = "" },
+		func(c *SMTPConfig) { c.To = nil },
+		func(c *SMTPConfig) { c.From = "not an address" },
+		func(c *SMTPConfig) { c.TLS = "ssl" },
+		func(c *SMTPConfig) { c.Subject = "{{.Title" },
+		func(c *SMTPConfig) { c.Password, c.PasswordFile = "a", "/run/secrets/b" },
+	} {
+		c := valid
+		mutate(&c)
+		if err := (Config{Webhooks: []Webhook{{Type: TypeSMTP, SMTP: &c}}}).Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", c)
+		}
+	}
+}
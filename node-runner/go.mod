@@ -2,4 +2,10 @@ module node-runner
 
 go 1.21
 
-require github.com/chilla55/registry-client/v2 v2.2.0
+require (
+	github.com/chilla55/registry-client/v2 v2.2.0
+	restartpolicy v0.0.0
+)
+
+// Shared with orbat; the image is built from the repository root
+replace restartpolicy => ../restartpolicy
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -15,8 +16,12 @@ import (
 	"time"
 
 	registryclient "github.com/chilla55/registry-client/v2"
+	"restartpolicy"
 )
 
+// healthPollInterval is how often waitForHealthy retries the health endpoint.
+var healthPollInterval = 2 * time.Second
+
 type config struct {
 	AppDir              string
 	EntryCommand        string
@@ -27,12 +32,18 @@ type config struct {
 	ServiceName         string
 	RegistryHost        string
 	RegistryPort        string
+	RegistryIface       string
+	WebNetCIDRs         []string
+	RegistryIPFamily    string
 	Domains             []string
 	RoutePath           string
 	HealthPath          string
 	EnableRegistry      bool
 	WaitForPort         bool
 	PortWaitTime        time.Duration
+	WaitForHealthy      bool
+	HealthWaitTime      time.Duration
+	UnhealthyAction     string
 	ZipPath             string
 	ZipStrip            int
 	ZipClean            bool
@@ -86,16 +97,10 @@ func main() {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
-	select {
-	case err := <-procDone:
-		if err != nil {
-			log("process exited with error: %v", err)
-			os.Exit(1)
-		}
-		log("process exited cleanly")
-	case sig := <-sigCh:
-		log("received signal %v, stopping child...", sig)
-		stopProcess(cmd)
+	if err := supervise(cfg, restartpolicy.Load(), cmd, procDone, regClient, sigCh); err != nil {
+		log("process exited with error: %v", err)
+		shutdownRegistry(regClient)
+		os.Exit(1)
 	}
 
 	if regRoute != "" {
@@ -114,12 +119,18 @@ func loadConfig() config {
 		ServiceName:         getEnv("SERVICE_NAME", "nodeapp"),
 		RegistryHost:        getEnv("REGISTRY_HOST", "proxy"),
 		RegistryPort:        getEnv("REGISTRY_PORT", "81"),
+		RegistryIface:       getEnv("REGISTRY_IFACE", ""),
+		WebNetCIDRs:         splitAndTrim(getEnv("WEB_NET_CIDR", "")),
+		RegistryIPFamily:    strings.ToLower(getEnv("REGISTRY_IP_FAMILY", "ipv4")),
 		Domains:             splitAndTrim(getEnv("DOMAINS", "example.com")),
 		RoutePath:           getEnv("ROUTE_PATH", "/"),
 		HealthPath:          getEnv("HEALTH_PATH", "/"),
 		EnableRegistry:      getBool("ENABLE_REGISTRY", true),
 		WaitForPort:         getBool("WAIT_FOR_PORT", true),
 		PortWaitTime:        getDuration("PORT_WAIT_TIMEOUT", 30*time.Second),
+		WaitForHealthy:      getBool("WAIT_FOR_HEALTHY", false),
+		HealthWaitTime:      getDuration("HEALTH_WAIT_TIMEOUT", 60*time.Second),
+		UnhealthyAction:     strings.ToLower(getEnv("UNHEALTHY_ACTION", "maintenance")),
 		ZipPath:             getEnv("ZIP_PATH", ""),
 		ZipStrip:            getInt("ZIP_STRIP_COMPONENTS", 1),
 		ZipClean:            getBool("ZIP_CLEAN", true),
@@ -152,6 +163,90 @@ func startProcess(cfg config) (*exec.Cmd, <-chan error) {
 	return cmd, done
 }
 
+// supervise waits for the child and restarts it according to policy. It
+// returns nil on a clean exit or signal, and the child's error when restarts
+// are disabled (RESTART_MAX=0). When the child crash-loops the route is put
+// into maintenance and kept there until the child stays up for a full window.
+func supervise(cfg config, policy *restartpolicy.Policy, cmd *exec.Cmd, procDone <-chan error, client *registryclient.RegistryClientV2, sigCh <-chan os.Signal) error {
+	crashLooping := false
+	var stable <-chan time.Time
+
+	for {
+		select {
+		case err := <-procDone:
+			if err == nil {
+				log("process exited cleanly")
+				return nil
+			}
+			if policy.Max <= 0 {
+				return err
+			}
+
+			delay, loop := policy.RecordCrash(time.Now())
+			log("process exited with error: %v", err)
+			if loop && !crashLooping {
+				crashLooping = true
+				enterCrashLoop(client, policy)
+			}
+
+			log("restarting process in %s", delay)
+			select {
+			case <-time.After(delay):
+			case sig := <-sigCh:
+				log("received signal %v during restart backoff, exiting", sig)
+				return nil
+			}
+
+			cmd, procDone = startProcess(cfg)
+			stable = time.After(policy.Window)
+
+		case <-stable:
+			stable = nil
+			policy.Reset()
+			if crashLooping {
+				crashLooping = false
+				exitCrashLoop(client, policy)
+			}
+
+		case sig := <-sigCh:
+			log("received signal %v, stopping child...", sig)
+			stopProcess(cmd)
+			return nil
+		}
+	}
+}
+
+// enterCrashLoop puts the route into maintenance so users see the
+// maintenance page instead of a flapping backend.
+func enterCrashLoop(client *registryclient.RegistryClientV2, policy *restartpolicy.Policy) {
+	log("ALERT: %s", policy.CrashLoopReason())
+	if client == nil {
+		return
+	}
+	// Crash-loop handling takes over maintenance from a pending health gate.
+	// registry-client v2.2.0 cannot send a reason, so the alert is the log
+	// line above.
+	err := routeMaintenance.enter(ownerCrashLoop, client.MaintenanceEnterAll)
+	if err != nil {
+		log("warning: failed to enter maintenance for crash loop: %v", err)
+		return
+	}
+	log("route placed in maintenance until the process is stable")
+}
+
+func exitCrashLoop(client *registryclient.RegistryClientV2, policy *restartpolicy.Policy) {
+	log("process stable for %s, leaving crash loop state", policy.Window)
+	if client == nil {
+		return
+	}
+	exited, err := routeMaintenance.exit(ownerCrashLoop, client.MaintenanceExitAll)
+	if !exited {
+		log("route maintenance is no longer held by crash-loop handling, leaving it as is")
+	} else if err != nil {
+		log("warning: failed to exit maintenance after crash loop: %v", err)
+	}
+}
+
 func stopProcess(cmd *exec.Cmd) {
 	if cmd == nil || cmd.Process == nil {
 		return
@@ -201,13 +296,48 @@ func startRegistry(cfg config) (*registryclient.RegistryClientV2, string) {
 		}
 	}
 
+	healthURL := fmt.Sprintf("http://127.0.0.1:%s%s", cfg.AppPort, cfg.HealthPath)
+	healthy := true
+	if cfg.WaitForHealthy {
+		log("waiting for %s to report healthy", healthURL)
+		if err := waitForHealthy(healthURL, cfg.HealthWaitTime); err != nil {
+			healthy = false
+			log("ALERT: app did not become healthy before registration: %v", err)
+			if cfg.UnhealthyAction == "skip" {
+				log("UNHEALTHY_ACTION=skip; not registering with the proxy")
+				return nil, ""
+			}
+			log("registering route in maintenance until the app is healthy")
+		}
+	}
+
 	addr := fmt.Sprintf("%s:%s", cfg.RegistryHost, cfg.RegistryPort)
 	metadata := map[string]interface{}{
 		"service":       "node-runner",
 		"entry_command": cfg.EntryCommand,
 	}
 
-	client := registryclient.NewRegistryClient(addr, cfg.ServiceName, "", 0, metadata, false)
+	localIP := ""
+	if cfg.RegistryIface != "" || len(cfg.WebNetCIDRs) > 0 || cfg.RegistryIPFamily != "ipv4" {
+		ip, err := detectContainerIP(cfg.RegistryIface, cfg.WebNetCIDRs, cfg.RegistryIPFamily)
+		if err != nil {
+			log("warning: %v; falling back to registry client IP detection", err)
+		} else {
+			localIP = ip
+			log("using container IP %s", localIP)
+		}
+	}
+	if !hasIPv4() {
+		// IPv6-only networks are not supported: the registry client (v2.2.0)
+		// detects its own address during Init and gives up without a
+		// non-loopback IPv4 one, whatever we pass
+		log("IPv6-only networks are not supported: the registry client needs an IPv4 address; skipping registration")
+		return nil, ""
+	}
+
+	// The registry client names the instance after its detected IP when
+	// instanceName is empty; pass ours so both agree.
+	client := registryclient.NewRegistryClient(addr, cfg.ServiceName, localIP, 0, metadata, false)
 
 	client.On(registryclient.EventLog, func(event registryclient.Event) {
 		level := strings.ToUpper(fmt.Sprintf("%v", event.Data["level"]))
@@ -226,6 +356,14 @@ func startRegistry(cfg config) (*registryclient.RegistryClientV2, string) {
 	}
 
 	backendURL := client.BuildBackendURL(cfg.AppPort)
+	if localIP != "" {
+		u, err := buildBackendURL(localIP, cfg.AppPort)
+		if err != nil {
+			log("failed to build backend URL: %v", err)
+			return client, ""
+		}
+		backendURL = u
+	}
 	routeID, err := client.AddRoute(cfg.Domains, cfg.RoutePath, backendURL, 10)
 	if err != nil {
 		log("failed to add registry route: %v", err)
@@ -270,6 +408,14 @@ func startRegistry(cfg config) (*registryclient.RegistryClientV2, string) {
 
 	log("registered route %s -> %s (%v)", routeID, backendURL, strings.Join(cfg.Domains, ","))
 
+	if !healthy {
+		if err := routeMaintenance.enter(ownerHealthGate, client.MaintenanceEnterAll); err != nil {
+			log("warning: failed to enter maintenance: %v", err)
+		} else {
+			go exitMaintenanceWhenHealthy(client, healthURL)
+		}
+	}
+
 	go client.StartKeepalive()
 	return client, routeID
 }
@@ -296,6 +442,50 @@ func waitForPort(host, port string, timeout time.Duration) error {
 	return fmt.Errorf("port %s not reachable within %s", target, timeout)
 }
 
+// waitForHealthy polls url until it answers with a 2xx status.
+func waitForHealthy(url string, timeout time.Duration) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for time.Now().Before(deadline) {
+		resp, err := client.Get(url)
+		if err == nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return nil
+			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		lastErr = err
+		time.Sleep(healthPollInterval)
+	}
+	return fmt.Errorf("%s not healthy within %s (last error: %v)", url, timeout, lastErr)
+}
+
+// exitMaintenanceWhenHealthy keeps polling after a failed health gate and
+// takes the route out of maintenance once the app finally responds. It stops
+// when crash-loop handling takes over maintenance, which then decides when
+// the route comes back.
+func exitMaintenanceWhenHealthy(client *registryclient.RegistryClientV2, url string) {
+	for routeMaintenance.owns(ownerHealthGate) {
+		if err := waitForHealthy(url, time.Minute); err != nil {
+			continue
+		}
+		exited, err := routeMaintenance.exit(ownerHealthGate, client.MaintenanceExitAll)
+		if !exited {
+			break
+		}
+		if err != nil {
+			log("warning: failed to exit maintenance: %v", err)
+		} else {
+			log("app is healthy, leaving maintenance")
+		}
+		return
+	}
+	log("crash-loop handling owns maintenance now; health gate stopped polling")
+}
+
 func runCmd(dir, name string, args ...string) error {
 	cmd := exec.Command(name, args...)
 	cmd.Dir = dir
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitForHealthy(t *testing.T) {
+	healthPollInterval = 10 * time.Millisecond
+
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	if err := waitForHealthy(srv.URL, time.Second); err != nil {
+		t.Fatalf("expected healthy, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("expected 3 polls, got %d", got)
+	}
+}
+
+func TestWaitForHealthyTimeout(t *testing.T) {
+	healthPollInterval = 10 * time.Millisecond
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	if err := waitForHealthy(srv.URL, 50*time.Millisecond); err == nil {
+		t.Fatal("expected timeout error for unhealthy endpoint")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import "sync"
+
+// Parts of node-runner that put the route into maintenance.
+const (
+	ownerHealthGate = "health-gate"
+	ownerCrashLoop  = "crash-loop"
+)
+
+// routeMaintenance is shared by the health gate and crash-loop handling so
+// that neither takes the route out of maintenance the other put it in.
+var routeMaintenance = &maintenanceOwner{}
+
+// maintenanceOwner records who currently holds the route in maintenance.
+// The last one to enter owns it, and only the owner may leave it.
+type maintenanceOwner struct {
+	mu    sync.Mutex
+	owner string
+}
+
+// enter runs enterFn and, if it succeeds, makes who the owner.
+func (m *maintenanceOwner) enter(who string, enterFn func() error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := enterFn(); err != nil {
+		return err
+	}
+	m.owner = who
+	return nil
+}
+
+// exit runs exitFn and clears the owner if who still owns maintenance. It
+// reports false without calling exitFn when someone else has taken over.
+func (m *maintenanceOwner) exit(who string, exitFn func() error) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.owner != who {
+		return false, nil
+	}
+	m.owner = ""
+	return true, exitFn()
+}
+
+// owns reports whether who currently holds maintenance.
+func (m *maintenanceOwner) owns(who string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.owner == who
+}
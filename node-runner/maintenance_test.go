@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMaintenanceOwnerCrashLoopTakesOver(t *testing.T) {
+	m := &maintenanceOwner{}
+	noop := func() error { return nil }
+	exits := 0
+	exit := func() error { exits++; return nil }
+
+	if err := m.enter(ownerHealthGate, noop); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.enter(ownerCrashLoop, noop); err != nil {
+		t.Fatal(err)
+	}
+	if m.owns(ownerHealthGate) {
+		t.Error("health gate still owns maintenance after crash loop entered")
+	}
+
+	// A late health gate must not take the crash-looping route out
+	if exited, _ := m.exit(ownerHealthGate, exit); exited || exits != 0 {
+		t.Errorf("health gate exited maintenance owned by crash loop (exited=%v, calls=%d)", exited, exits)
+	}
+	if exited, _ := m.exit(ownerCrashLoop, exit); !exited || exits != 1 {
+		t.Errorf("crash loop exit = %v with %d calls, want true with 1", exited, exits)
+	}
+	if m.owns(ownerCrashLoop) {
+		t.Error("owner not cleared after exit")
+	}
+}
+
+func TestMaintenanceOwnerFailedEnterKeepsOwner(t *testing.T) {
+	m := &maintenanceOwner{}
+	_ = m.enter(ownerHealthGate, func() error { return nil })
+
+	if err := m.enter(ownerCrashLoop, func() error { return errors.New("no proxy") }); err == nil {
+		t.Fatal("expected enter error")
+	}
+	if !m.owns(ownerHealthGate) {
+		t.Error("failed enter changed the owner")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// interfaceAddrs returns the addresses of the named interface, or of all
+// interfaces when name is empty. Replaced in tests.
+var interfaceAddrs = func(name string) ([]net.Addr, error) {
+	if name == "" {
+		return net.InterfaceAddrs()
+	}
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return iface.Addrs()
+}
+
+// detectContainerIP picks the address to register with the proxy. The
+// registry client only looks for 10.2.2.0/24 over IPv4, so deployments on
+// other networks set REGISTRY_IFACE, WEB_NET_CIDR and/or REGISTRY_IP_FAMILY
+// to steer the choice.
+func detectContainerIP(iface string, cidrs []string, family string) (string, error) {
+	if family != "ipv4" && family != "ipv6" {
+		return "", fmt.Errorf("invalid REGISTRY_IP_FAMILY %q (want ipv4 or ipv6)", family)
+	}
+
+	var subnets []*net.IPNet
+	for _, c := range cidrs {
+		_, subnet, err := net.ParseCIDR(c)
+		if err != nil {
+			return "", fmt.Errorf("invalid WEB_NET_CIDR entry %q: %w", c, err)
+		}
+		subnets = append(subnets, subnet)
+	}
+
+	addrs, err := interfaceAddrs(iface)
+	if err != nil {
+		return "", fmt.Errorf("list addresses for interface %q: %w", iface, err)
+	}
+
+	ip := selectIP(addrs, subnets, family)
+	if ip == "" {
+		return "", fmt.Errorf("no %s address on interface %q matches %s", family, iface, strings.Join(cidrs, ","))
+	}
+	return ip, nil
+}
+
+// selectIP returns the first usable address of the given family inside one
+// of subnets, checked in order. With no subnets any usable address matches.
+// Loopback and IPv6 link-local addresses are never chosen since the proxy
+// cannot reach them.
+func selectIP(addrs []net.Addr, subnets []*net.IPNet, family string) string {
+	var candidates []net.IP
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if isV4 := ipnet.IP.To4() != nil; isV4 != (family == "ipv4") {
+			continue
+		}
+		candidates = append(candidates, ipnet.IP)
+	}
+
+	if len(subnets) == 0 {
+		if len(candidates) > 0 {
+			return candidates[0].String()
+		}
+		return ""
+	}
+
+	for _, subnet := range subnets {
+		for _, ip := range candidates {
+			if subnet.Contains(ip) {
+				return ip.String()
+			}
+		}
+	}
+	return ""
+}
+
+// hasIPv4 reports whether the container has a non-loopback IPv4 address,
+// which the registry client requires to connect
+func hasIPv4() bool {
+	addrs, err := interfaceAddrs("")
+	if err != nil {
+		return true // Let the client report the problem
+	}
+	return selectIP(addrs, nil, "ipv4") != ""
+}
+
+// buildBackendURL builds the URL the proxy uses to reach ip:port, bracketing
+// IPv6 hosts (http://[fd00::5]:3000).
+func buildBackendURL(ip, port string) (string, error) {
+	raw := "http://" + net.JoinHostPort(ip, port)
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid backend URL %q: %w", raw, err)
+	}
+	if u.Hostname() != ip || u.Port() != port {
+		return "", fmt.Errorf("invalid backend URL %q", raw)
+	}
+	return raw, nil
+}
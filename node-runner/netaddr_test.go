@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func mustCIDR(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	ip, subnet, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatalf("parse %q: %v", s, err)
+	}
+	subnet.IP = ip
+	return subnet
+}
+
+func mockAddrs(t *testing.T, byIface map[string][]string) {
+	t.Helper()
+	orig := interfaceAddrs
+	t.Cleanup(func() { interfaceAddrs = orig })
+
+	interfaceAddrs = func(name string) ([]net.Addr, error) {
+		var out []net.Addr
+		for iface, cidrs := range byIface {
+			if name != "" && iface != name {
+				continue
+			}
+			for _, c := range cidrs {
+				out = append(out, mustCIDR(t, c))
+			}
+		}
+		if name != "" && out == nil {
+			return nil, &net.OpError{Op: "route", Err: net.UnknownNetworkError(name)}
+		}
+		return out, nil
+	}
+}
+
+func TestDetectContainerIPBySubnet(t *testing.T) {
+	mockAddrs(t, map[string][]string{
+		"lo":   {"127.0.0.1/8"},
+		"eth0": {"172.18.0.5/16"},
+		"eth1": {"10.20.0.7/24"},
+	})
+
+	ip, err := detectContainerIP("", []string{"192.168.0.0/16", "10.20.0.0/24"}, "ipv4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ip != "10.20.0.7" {
+		t.Errorf("expected 10.20.0.7, got %s", ip)
+	}
+}
+
+func TestDetectContainerIPByInterface(t *testing.T) {
+	mockAddrs(t, map[string][]string{
+		"eth0": {"172.18.0.5/16"},
+		"eth1": {"10.20.0.7/24"},
+	})
+
+	ip, err := detectContainerIP("eth0", nil, "ipv4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ip != "172.18.0.5" {
+		t.Errorf("expected 172.18.0.5, got %s", ip)
+	}
+
+	if _, err := detectContainerIP("eth0", []string{"10.20.0.0/24"}, "ipv4"); err == nil {
+		t.Error("expected error when interface has no address in the subnet")
+	}
+	if _, err := detectContainerIP("eth9", nil, "ipv4"); err == nil {
+		t.Error("expected error for unknown interface")
+	}
+}
+
+func TestDetectContainerIPInvalidCIDR(t *testing.T) {
+	mockAddrs(t, map[string][]string{"eth0": {"10.2.2.3/24"}})
+
+	if _, err := detectContainerIP("", []string{"10.2.2.0"}, "ipv4"); err == nil {
+		t.Error("expected error for invalid CIDR")
+	}
+}
+
+func TestSelectIPSubnetOrder(t *testing.T) {
+	addrs := []net.Addr{
+		mustCIDR(t, "10.2.2.4/24"),
+		mustCIDR(t, "10.9.0.4/24"),
+	}
+	subnets := []*net.IPNet{mustCIDR(t, "10.9.0.0/24"), mustCIDR(t, "10.2.2.0/24")}
+
+	if got := selectIP(addrs, subnets, "ipv4"); got != "10.9.0.4" {
+		t.Errorf("first configured subnet should win, got %s", got)
+	}
+}
+
+func TestDetectContainerIPv6(t *testing.T) {
+	mockAddrs(t, map[string][]string{
+		"lo":   {"127.0.0.1/8", "::1/128"},
+		"eth0": {"10.2.2.5/24", "fe80::1/64", "fd00:2::5/64"},
+	})
+
+	ip, err := detectContainerIP("", nil, "ipv6")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ip != "fd00:2::5" {
+		t.Errorf("expected fd00:2::5 (link-local skipped), got %s", ip)
+	}
+
+	if _, err := detectContainerIP("", []string{"fd00:3::/64"}, "ipv6"); err == nil {
+		t.Error("expected error when no IPv6 address matches the subnet")
+	}
+	if _, err := detectContainerIP("", nil, "ipx"); err == nil {
+		t.Error("expected error for unknown family")
+	}
+}
+
+func TestHasIPv4(t *testing.T) {
+	mockAddrs(t, map[string][]string{
+		"lo":   {"127.0.0.1/8", "::1/128"},
+		"eth0": {"fe80::1/64", "fd00:2::5/64"},
+	})
+	if hasIPv4() {
+		t.Error("expected an IPv6-only container to have no usable IPv4 address")
+	}
+
+	mockAddrs(t, map[string][]string{"eth0": {"10.2.2.5/24", "fd00:2::5/64"}})
+	if !hasIPv4() {
+		t.Error("expected a dual-stack container to have an IPv4 address")
+	}
+}
+
+func TestBuildBackendURL(t *testing.T) {
+	tests := []struct {
+		ip, port, want string
+	}{
+		{"10.2.2.5", "3000", "http://10.2.2.5:3000"},
+		{"fd00:2::5", "3000", "http://[fd00:2::5]:3000"},
+		{"::1", "8080", "http://[::1]:8080"},
+	}
+	for _, tt := range tests {
+		got, err := buildBackendURL(tt.ip, tt.port)
+		if err != nil {
+			t.Errorf("buildBackendURL(%q, %q) error: %v", tt.ip, tt.port, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("buildBackendURL(%q, %q) = %q, want %q", tt.ip, tt.port, got, tt.want)
+		}
+	}
+
+	if _, err := buildBackendURL("10.2.2.5", "30 00"); err == nil {
+		t.Error("expected error for invalid port")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// buildStep is a single command in the build pipeline
+type buildStep struct {
+	Name    string   // Human readable label used in logs and the status page
+	Status  string   // Status key written to the status file
+	Command string   // Shell command executed in appDir
+	Env     []string // Extra environment for this step only
+}
+
+// defaultBuildSteps is the Next.js + Prisma pipeline used when BUILD_STEPS is unset
+var defaultBuildSteps = []buildStep{
+	{Name: "Installing dependencies", Status: "dependencies", Command: "npm ci --production=false"},
+	{Name: "Generating Prisma client", Status: "prisma-generate", Command: "npx prisma generate"},
+	{Name: "Running database migrations", Status: "migrations", Command: "npx prisma migrate deploy"},
+	{
+		Name:    "Building Next.js application",
+		Status:  "building",
+		Command: "npm run build",
+		// Prevent build-time database checks and static optimization
+		Env: []string{
+			"SKIP_ENV_VALIDATION=1",
+			"SKIP_STATIC_GENERATION=1",
+			"NEXT_PRIVATE_SKIP_STATIC_OPTIMIZATION=1",
+		},
+	},
+}
+
+// parseBuildSteps turns BUILD_STEPS (one command per line) into a plan. Each
+// line runs as a single shell command, so ";" and "&&" keep their shell
+// meaning. An empty value selects the default pipeline.
+func parseBuildSteps(s string) []buildStep {
+	var steps []buildStep
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		steps = append(steps, buildStep{Name: "Running " + line, Status: "building", Command: line})
+	}
+	if len(steps) == 0 {
+		return defaultBuildSteps
+	}
+	return steps
+}
+
+// buildPlan returns the resolved build steps, including the database check
+func buildPlan() []buildStep {
+	var plan []buildStep
+	if databaseCheck {
+		plan = append(plan, buildStep{Name: "Checking database connectivity", Status: "database-check"})
+	}
+	return append(plan, parseBuildSteps(buildStepsEnv)...)
+}
+
+// stepCounter numbers log lines as "[<prefix> n/total]"
+type stepCounter struct {
+	prefix string
+	n      int
+	total  int
+}
+
+func (c *stepCounter) next(format string, args ...interface{}) {
+	c.n++
+	log("[%s %d/%d] %s", c.prefix, c.n, c.total, fmt.Sprintf(format, args...))
+}
+
+// printBuildPlan writes the resolved plan for BUILD_DRY_RUN / -dry-run
+func printBuildPlan(plan []buildStep) {
+	total := len(plan) + updateFixedSteps
+	fmt.Printf("Resolved update plan (%d steps):\n", total)
+	lines := []string{"Entering maintenance mode", "Stopping Next.js", "Pulling latest code"}
+	for _, step := range plan {
+		line := step.Name
+		if step.Command != "" && !strings.Contains(step.Name, step.Command) {
+			line = fmt.Sprintf("%s: %s", step.Name, step.Command)
+		}
+		if len(step.Env) > 0 {
+			line += fmt.Sprintf(" (env: %s)", strings.Join(step.Env, " "))
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "Starting Next.js", "Waiting for Next.js to be healthy", "Exiting maintenance mode")
+	for i, line := range lines {
+		fmt.Printf("  %2d. %s\n", i+1, line)
+	}
+}
+
+func runBuildStep(step buildStep) error {
+	cmd := exec.Command("sh", "-c", step.Command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Dir = appDir
+	cmd.Env = append(os.Environ(), step.Env...)
+	return cmd.Run()
+}
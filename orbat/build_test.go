@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestParseBuildStepsDefault(t *testing.T) {
+	steps := parseBuildSteps("  ")
+	if len(steps) != len(defaultBuildSteps) {
+		t.Fatalf("expected default pipeline, got %d steps", len(steps))
+	}
+}
+
+func TestParseBuildStepsCustom(t *testing.T) {
+	steps := parseBuildSteps("npm ci\n\n sh -c 'npm run lint; npm run build' \r\nnpm test\n")
+	want := []string{"npm ci", "sh -c 'npm run lint; npm run build'", "npm test"}
+	if len(steps) != len(want) {
+		t.Fatalf("expected %d steps, got %d", len(want), len(steps))
+	}
+	for i, cmd := range want {
+		if steps[i].Command != cmd {
+			t.Errorf("step %d command = %q, want %q", i, steps[i].Command, cmd)
+		}
+		if len(steps[i].Env) != 0 {
+			t.Errorf("custom step %d should not inherit build env", i)
+		}
+	}
+}
+
+func TestBuildPlanDatabaseCheck(t *testing.T) {
+	oldCheck, oldSteps := databaseCheck, buildStepsEnv
+	defer func() { databaseCheck, buildStepsEnv = oldCheck, oldSteps }()
+
+	buildStepsEnv = "make"
+	databaseCheck = true
+	if plan := buildPlan(); len(plan) != 2 || plan[0].Command != "" {
+		t.Errorf("expected database check followed by 1 step, got %+v", plan)
+	}
+
+	databaseCheck = false
+	if plan := buildPlan(); len(plan) != 1 || plan[0].Command != "make" {
+		t.Errorf("expected a single step without database check, got %+v", plan)
+	}
+}
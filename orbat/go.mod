@@ -2,4 +2,10 @@ module orbat/entrypoint
 
 go 1.21
 
-require github.com/chilla55/registry-client/v2 v2.2.0
+require (
+	github.com/chilla55/registry-client/v2 v2.2.0
+	restartpolicy v0.0.0
+)
+
+// Shared with node-runner; the image is built from the repository root
+replace restartpolicy => ../restartpolicy
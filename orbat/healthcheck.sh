@@ -8,6 +8,6 @@ if [ -f "/tmp/maintenance_active" ]; then
 fi
 
 # Check if the Next.js app is responding
-curl -f http://localhost:3000/api/health 2>/dev/null || curl -f http://localhost:3000/ > /dev/null 2>&1
+wget -q -O /dev/null http://localhost:3000/api/health 2>/dev/null || wget -q -O /dev/null http://localhost:3000/ 2>/dev/null
 
 exit $?
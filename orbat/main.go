@@ -1,17 +1,23 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	registryclient "github.com/chilla55/registry-client/v2"
+	"restartpolicy"
 )
 
 var (
@@ -27,16 +33,26 @@ var (
 	maintenancePort    = getEnv("MAINTENANCE_PORT", "3001")
 	serviceName        = getEnv("SERVICE_NAME", "orbat")
 	updateCheckIntvl   = getEnv("UPDATE_CHECK_INTERVAL", "300")
+	updateQuietHours   = getEnv("UPDATE_QUIET_HOURS", "") // e.g. "22:00-06:00", no auto-updates inside
+	updateMode         = getEnv("UPDATE_MODE", "auto")    // "auto" applies updates, "check" only reports them
+	buildStepsEnv      = getEnv("BUILD_STEPS", "")        // Build commands, one per line
+	databaseCheck      = getEnv("DATABASE_CHECK", "true") != "false"
 	maintenancePageURL string // Will be set in main() if not provided via env
 
 	registryClientV2 *registryclient.RegistryClientV2
 	routeID          string
 	maintenancePID   int
 	updateChkPID     int
-	npmStartPID      int
-	updating         bool // Flag to prevent auto-restart during updates
+	npmStartPID      atomic.Int64 // Shared by the Next.js supervisor, updates and crash-loop recovery
+	updating         bool         // Flag to prevent auto-restart during updates
+	crashLooping     atomic.Bool  // Set while Next.js is crash-looping and maintenance is held
+	restartPol       = restartpolicy.Load()
 
-	done = make(chan os.Signal, 1)
+	latestRemoteHash string // origin/main hash seen by the last update check
+	notifiedHash     string // last hash reported in check-only mode
+
+	done          = make(chan os.Signal, 1)
+	updateTrigger = make(chan os.Signal, 1) // SIGUSR1 forces an immediate update
 )
 
 func getEnv(key, defaultVal string) string {
@@ -154,8 +170,8 @@ func cleanup() {
 	if updateChkPID > 0 {
 		syscall.Kill(updateChkPID, syscall.SIGTERM)
 	}
-	if npmStartPID > 0 {
-		syscall.Kill(npmStartPID, syscall.SIGTERM)
+	if pid := int(npmStartPID.Load()); pid > 0 {
+		syscall.Kill(pid, syscall.SIGTERM)
 	}
 }
 
@@ -245,7 +261,8 @@ func registerWithProxy() error {
 
 	log("Using container IP: %s", registryClientV2.GetLocalIP())
 
-	// Build backend URL using the detected IP and configured port
+	// Build backend URL using the detected IP and configured port. The
+	// client only detects IPv4 addresses; IPv6-only networks are unsupported
 	backendURL := registryClientV2.BuildBackendURL(port)
 	domains := strings.Split(strings.ReplaceAll(domainsStr, " ", ""), ",")
 	var err error
@@ -365,6 +382,7 @@ func checkForUpdates() (bool, error) {
 	localHash := strings.TrimSpace(string(local))
 	remoteHash := strings.TrimSpace(string(remote))
 
+	latestRemoteHash = remoteHash
 	if localHash != remoteHash {
 		log("Updates detected: %s -> %s", localHash[:7], remoteHash[:7])
 		return true, nil
@@ -383,8 +401,11 @@ func performUpdate() error {
 	updating = true
 	defer func() { updating = false }()
 
-	// Step 1: Enter maintenance mode
-	log("[Update 1/8] Entering maintenance mode...")
+	plan := buildPlan()
+	steps := &stepCounter{prefix: "Update", total: len(plan) + updateFixedSteps}
+
+	// Enter maintenance mode
+	steps.next("Entering maintenance mode...")
 	updateStatus("entering-maintenance", "Entering maintenance mode", 5, "Starting update process")
 	if !isMaintenanceServerRunning() {
 		log("[Update] Starting maintenance server...")
@@ -402,41 +423,42 @@ func performUpdate() error {
 	}
 	log("[Update] ✓ Maintenance mode active, proxy confirmed")
 
-	// Step 2: Stop Next.js
-	log("[Update 2/8] Stopping Next.js...")
+	// Stop Next.js
+	steps.next("Stopping Next.js...")
 	updateStatus("stopping-app", "Stopping application", 10, "Gracefully shutting down Next.js")
-	if npmStartPID > 0 {
-		log("[Update] Sending SIGTERM to Next.js (PID: %d)...", npmStartPID)
-		if err := syscall.Kill(npmStartPID, syscall.SIGTERM); err != nil {
+	if pid := int(npmStartPID.Load()); pid > 0 {
+		log("[Update] Sending SIGTERM to Next.js (PID: %d)...", pid)
+		if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
 			log("Warning: failed to send SIGTERM to Next.js: %v", err)
 		}
 
 		// Wait for process to actually exit (up to 10 seconds)
+		exited := false
 		for i := 0; i < 20; i++ {
 			// Check if process still exists
-			if err := syscall.Kill(npmStartPID, 0); err != nil {
+			if err := syscall.Kill(pid, 0); err != nil {
 				// Process is gone (err means signal delivery failed because process doesn't exist)
 				log("[Update] Next.js process exited successfully")
-				npmStartPID = 0
+				exited = true
 				break
 			}
 			time.Sleep(500 * time.Millisecond)
 		}
 
 		// Force kill if still running
-		if npmStartPID > 0 {
+		if !exited {
 			log("[Update] Process still running after 10s, forcing SIGKILL...")
-			if err := syscall.Kill(npmStartPID, syscall.SIGKILL); err != nil {
+			if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
 				log("Warning: failed to SIGKILL: %v", err)
 			}
 			time.Sleep(1 * time.Second)
-			npmStartPID = 0
 		}
+		npmStartPID.Store(0)
 	}
 	log("[Update] ✓ Next.js stopped")
 
-	// Step 3: Pull code
-	log("[Update 3/8] Pulling latest code...")
+	// Pull code
+	steps.next("Pulling latest code...")
 	updateStatus("pulling", "Pulling latest changes", 15, "Downloading updated code from repository")
 
 	// Reset any local changes before pulling
@@ -453,28 +475,28 @@ func performUpdate() error {
 	}
 	log("[Update] ✓ Code updated")
 
-	// Step 4-8: Build
-	if err := buildApp(); err != nil {
+	// Build
+	if err := buildApp(plan, steps); err != nil {
 		return fmt.Errorf("build failed: %w", err)
 	}
 
-	// Step 9: Start Next.js (if not already running)
-	log("[Update 9/10] Starting Next.js...")
+	// Start Next.js (if not already running)
+	steps.next("Starting Next.js...")
 	updateStatus("starting-app", "Starting application", 90, "Launching Next.js server")
-	if npmStartPID <= 0 {
+	if npmStartPID.Load() <= 0 {
 		startNPMServer()
 	}
 
-	// Step 10: Wait for Next.js to be healthy
-	log("[Update 10/10] Waiting for Next.js to be healthy...")
+	// Wait for Next.js to be healthy
+	steps.next("Waiting for Next.js to be healthy...")
 	updateStatus("waiting-healthy", "Waiting for app to start", 95, "Verifying service is responding")
 	if err := waitForNextJSHealthy(60 * time.Second); err != nil {
 		return fmt.Errorf("Next.js not healthy after update: %w", err)
 	}
 	log("[Update] ✓ Next.js is healthy")
 
-	// Step 11: Exit maintenance mode
-	log("[Update 11/11] Exiting maintenance mode...")
+	// Exit maintenance mode
+	steps.next("Exiting maintenance mode...")
 	updateStatus("exiting-maintenance", "Exiting maintenance mode", 98, "Switching back to main service")
 	if err := exitProxyMaintenance(); err != nil {
 		log("Warning: failed to exit maintenance: %v", err)
@@ -488,45 +510,32 @@ func performUpdate() error {
 	return nil
 }
 
-func buildApp() error {
-	// First, ensure database is accessible
-	log("[Update 4/9] Checking database connectivity...")
-	updateStatus("database-check", "Verifying database connection", 20, "Ensuring database is accessible")
-	if err := waitForDatabase(30 * time.Second); err != nil {
-		return fmt.Errorf("database check failed: %w", err)
-	}
-
-	log("[Update 5/9] Installing dependencies...")
-	updateStatus("dependencies", "Installing dependencies", 30, "Running npm ci to install packages")
-	if err := runCommand("npm", "ci", "--production=false"); err != nil {
-		return fmt.Errorf("npm ci failed: %w", err)
-	}
-	log("[Update] ✓ Dependencies installed")
-
-	log("[Update 6/9] Generating Prisma client...")
-	updateStatus("prisma-generate", "Generating Prisma client", 50, "Creating database client from schema")
-	if err := runCommand("npx", "prisma", "generate"); err != nil {
-		return fmt.Errorf("prisma generate failed: %w", err)
-	}
-	log("[Update] ✓ Prisma client generated")
-
-	log("[Update 7/9] Running database migrations...")
-	updateStatus("migrations", "Running database migrations", 65, "Applying schema changes to database")
-	if err := runCommand("npx", "prisma", "migrate", "deploy"); err != nil {
-		return fmt.Errorf("prisma migrate deploy failed: %w", err)
-	}
-	log("[Update] ✓ Migrations applied")
+// updateFixedSteps counts the update steps around the build plan: enter
+// maintenance, stop, pull, start, wait for health and exit maintenance
+const updateFixedSteps = 6
+
+// buildApp runs the build plan, numbering each step with the given counter
+func buildApp(plan []buildStep, steps *stepCounter) error {
+	for i, step := range plan {
+		steps.next("%s...", step.Name)
+		// Build steps share the 20-85% range of the progress bar
+		progress := 20 + i*65/len(plan)
+
+		if step.Command == "" {
+			// Database connectivity check
+			updateStatus(step.Status, "Verifying database connection", progress, "Ensuring database is accessible")
+			if err := waitForDatabase(30 * time.Second); err != nil {
+				return fmt.Errorf("database check failed: %w", err)
+			}
+			continue
+		}
 
-	log("[Update 8/9] Building Next.js application...")
-	updateStatus("building", "Building Next.js application", 80, "Compiling TypeScript and optimizing assets")
-	// Set environment variables to prevent build-time database checks and static optimization
-	os.Setenv("SKIP_ENV_VALIDATION", "1")
-	os.Setenv("SKIP_STATIC_GENERATION", "1")
-	os.Setenv("NEXT_PRIVATE_SKIP_STATIC_OPTIMIZATION", "1")
-	if err := runCommand("npm", "run", "build"); err != nil {
-		return fmt.Errorf("npm run build failed: %w", err)
+		updateStatus(step.Status, step.Name, progress, step.Command)
+		if err := runBuildStep(step); err != nil {
+			return fmt.Errorf("%s failed: %w", step.Command, err)
+		}
+		log("[%s] ✓ %s", steps.prefix, step.Name)
 	}
-	log("[Update] ✓ Next.js built")
 
 	return nil
 }
@@ -543,33 +552,58 @@ func isMaintenanceServerRunning() bool {
 func waitForNextJSHealthy(timeout time.Duration) error {
 	// Check localhost since we're checking from within the same container
 	healthURL := fmt.Sprintf("http://localhost:%s/", port)
-	deadline := time.Now().Add(timeout)
-
-	for time.Now().Before(deadline) {
-		cmd := exec.Command("curl", "-sf", "-o", "/dev/null", healthURL)
-		if err := cmd.Run(); err == nil {
-			return nil
-		}
-		time.Sleep(1 * time.Second)
+	if err := waitForHTTP(healthURL, timeout, 1*time.Second); err != nil {
+		return fmt.Errorf("Next.js did not become healthy within %v: %w", timeout, err)
 	}
-
-	return fmt.Errorf("Next.js did not become healthy within %v", timeout)
+	return nil
 }
 
 func waitForMaintenanceServerHealthy(timeout time.Duration) error {
 	maintenanceURL := fmt.Sprintf("http://localhost:%s/", maintenancePort)
+	if err := waitForHTTP(maintenanceURL, timeout, 500*time.Millisecond); err != nil {
+		return fmt.Errorf("maintenance server did not become healthy within %v: %w", timeout, err)
+	}
+	log("Maintenance server is healthy and accepting connections")
+	return nil
+}
+
+// waitForHTTP polls url until it returns a 2xx status or timeout expires.
+// The last failure is returned so logs show e.g. connection refused vs. 500.
+func waitForHTTP(url string, timeout, interval time.Duration) error {
 	deadline := time.Now().Add(timeout)
+	err := fmt.Errorf("no attempt made")
 
 	for time.Now().Before(deadline) {
-		cmd := exec.Command("curl", "-sf", "-o", "/dev/null", maintenanceURL)
-		if err := cmd.Run(); err == nil {
-			log("Maintenance server is healthy and accepting connections")
+		if err = checkHTTP(url, 5*time.Second); err == nil {
 			return nil
 		}
-		time.Sleep(500 * time.Millisecond)
+		time.Sleep(interval)
 	}
 
-	return fmt.Errorf("maintenance server did not become healthy within %v", timeout)
+	return err
+}
+
+// checkHTTP performs a single GET and reports non-2xx responses with a
+// snippet of the body
+func checkHTTP(url string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
 }
 
 func startMaintenanceServer() error {
@@ -635,30 +669,111 @@ func stopMaintenanceServer() {
 
 func startUpdateChecker() {
 	go func() {
-		log("Starting background update checker (interval: %ss)...", updateCheckIntvl)
-		for {
-			time.Sleep(time.Duration(parseDuration(updateCheckIntvl)) * time.Second)
-			log("[Update Check] Checking for updates...")
+		var tick <-chan time.Time
+		if interval := parseDuration(updateCheckIntvl); interval > 0 {
+			log("Starting background update checker (interval: %ss, mode: %s)...", updateCheckIntvl, updateMode)
+			ticker := time.NewTicker(time.Duration(interval) * time.Second)
+			defer ticker.Stop()
+			tick = ticker.C
+		} else {
+			log("Periodic update checks disabled, waiting for SIGUSR1 to update")
+		}
+		if updateQuietHours != "" {
+			log("Automatic updates paused during quiet window %s", updateQuietHours)
+		}
 
-			updateAvailable, err := checkForUpdates()
-			if err != nil {
-				log("[Update Check] Error: %v", err)
-				continue
+		for {
+			select {
+			case <-tick:
+				runUpdateCheck(false)
+			case <-updateTrigger:
+				log("[Update Check] Manual update triggered (SIGUSR1)")
+				runUpdateCheck(true)
 			}
+		}
+	}()
+}
 
-			if !updateAvailable {
-				log("[Update Check] No updates available")
-				continue
-			}
+// runUpdateCheck checks for upstream changes and applies them. Manual
+// triggers bypass the quiet window and check-only mode.
+func runUpdateCheck(manual bool) {
+	if updating {
+		log("[Update Check] Update already in progress, skipping")
+		return
+	}
 
-			log("[Update Check] Update available, starting zero-downtime update...")
-			if err := performUpdate(); err != nil {
-				log("[Update Check] Update failed: %v", err)
-				continue
-			}
-			log("[Update Check] Update completed successfully")
+	if !manual {
+		if start, end, ok := parseQuietWindow(updateQuietHours); ok && inQuietWindow(time.Now(), start, end) {
+			log("[Update Check] Inside quiet window (%s), skipping", updateQuietHours)
+			return
 		}
-	}()
+	}
+
+	log("[Update Check] Checking for updates...")
+	updateAvailable, err := checkForUpdates()
+	if err != nil {
+		log("[Update Check] Error: %v", err)
+		return
+	}
+
+	if !updateAvailable {
+		log("[Update Check] No updates available")
+		return
+	}
+
+	if !manual && updateMode == "check" {
+		if latestRemoteHash != notifiedHash {
+			notifiedHash = latestRemoteHash
+			log("ALERT: Update available (%s), UPDATE_MODE=check - send SIGUSR1 to apply", latestRemoteHash)
+		}
+		return
+	}
+
+	log("[Update Check] Update available, starting zero-downtime update...")
+	if err := performUpdate(); err != nil {
+		log("[Update Check] Update failed: %v", err)
+		return
+	}
+	log("[Update Check] Update completed successfully")
+}
+
+// parseQuietWindow parses "HH:MM-HH:MM" (or "HH-HH") into minutes after midnight
+func parseQuietWindow(s string) (int, int, bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	start, ok1 := parseClock(parts[0])
+	end, ok2 := parseClock(parts[1])
+	if !ok1 || !ok2 || start == end {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+func parseClock(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+	var h, m int
+	if strings.Contains(s, ":") {
+		if n, _ := fmt.Sscanf(s, "%d:%d", &h, &m); n != 2 {
+			return 0, false
+		}
+	} else if n, _ := fmt.Sscanf(s, "%d", &h); n != 1 {
+		return 0, false
+	}
+	if h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, false
+	}
+	return h*60 + m, true
+}
+
+// inQuietWindow reports whether t falls inside [start, end), wrapping past midnight
+func inQuietWindow(t time.Time, start, end int) bool {
+	now := t.Hour()*60 + t.Minute()
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
 }
 
 func parseDuration(s string) int {
@@ -683,22 +798,102 @@ func startNPMServer() {
 			cmd.Dir = appDir
 
 			if err := cmd.Start(); err != nil {
-				log("Failed to start Next.js: %v (retrying in 5s)", err)
-				time.Sleep(5 * time.Second)
+				delay := recordNPMCrash()
+				log("Failed to start Next.js: %v (retrying in %v)", err, delay)
+				time.Sleep(delay)
+				continue
+			}
+
+			pid := cmd.Process.Pid
+			npmStartPID.Store(int64(pid))
+			if crashLooping.Load() {
+				go recoverFromCrashLoop(pid)
+			}
+
+			started := time.Now()
+			err := cmd.Wait()
+			if updating {
+				// Stopped on purpose by performUpdate
 				continue
 			}
 
-			npmStartPID = cmd.Process.Pid
-			if err := cmd.Wait(); err != nil {
-				log("Next.js exited (code: %v), restarting in 5s...", err)
+			// A run that outlived the window is not part of a crash loop
+			if time.Since(started) >= restartPol.Window {
+				restartPol.Reset()
 			}
-			time.Sleep(5 * time.Second)
+			delay := recordNPMCrash()
+			log("Next.js exited (code: %v), restarting in %v...", err, delay)
+			time.Sleep(delay)
 		}
 	}()
 }
 
+// recordNPMCrash feeds a crash into the restart policy, enters crash-loop
+// maintenance when the limit is exceeded, and returns the restart delay
+func recordNPMCrash() time.Duration {
+	delay, loop := restartPol.RecordCrash(time.Now())
+	if loop && restartPol.Max > 0 && crashLooping.CompareAndSwap(false, true) {
+		enterCrashLoop()
+	}
+	return delay
+}
+
+func enterCrashLoop() {
+	log("ALERT: Next.js %s, holding maintenance mode", restartPol.CrashLoopReason())
+	updateStatus("crash-loop", "Application is restarting repeatedly", 0, "Next.js keeps crashing, retrying with backoff")
+
+	if !isMaintenanceServerRunning() {
+		if err := startMaintenanceServer(); err != nil {
+			log("Warning: failed to start maintenance server: %v", err)
+		}
+	}
+	if err := enterProxyMaintenance(); err != nil {
+		log("Warning: failed to enter maintenance for crash loop: %v", err)
+	}
+}
+
+// crashLoopRecheck is how long recoverFromCrashLoop waits between health
+// checks while a stable Next.js process is still not answering
+const crashLoopRecheck = 30 * time.Second
+
+// recoverFromCrashLoop leaves maintenance once the given Next.js process has
+// stayed up for a full restart window and answers health checks. It keeps
+// checking until then; if the process exits or is replaced, the supervisor
+// starts a new recovery for its successor.
+func recoverFromCrashLoop(pid int) {
+	time.Sleep(restartPol.Window)
+	for {
+		if int(npmStartPID.Load()) != pid || syscall.Kill(pid, 0) != nil {
+			return
+		}
+		err := waitForNextJSHealthy(10 * time.Second)
+		if err == nil {
+			break
+		}
+		log("Next.js still unhealthy after crash loop, checking again in %v: %v", crashLoopRecheck, err)
+		time.Sleep(crashLoopRecheck)
+	}
+	if !crashLooping.CompareAndSwap(true, false) {
+		return
+	}
+
+	log("Next.js stable for %v, leaving crash-loop maintenance", restartPol.Window)
+	restartPol.Reset()
+	if err := exitProxyMaintenance(); err != nil {
+		log("Warning: failed to exit maintenance after crash loop: %v", err)
+	}
+}
+
 func main() {
+	dryRun := flag.Bool("dry-run", false, "print the resolved build/update plan and exit")
+	flag.Parse()
+	if *dryRun || getEnv("BUILD_DRY_RUN", "false") == "true" {
+		printBuildPlan(buildPlan())
+		return
+	}
+
 	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(updateTrigger, syscall.SIGUSR1)
 	defer cleanup()
 
 	log("Starting entrypoint...")
@@ -810,7 +1005,8 @@ func main() {
 		}
 
 		// Build app
-		if err := buildApp(); err != nil {
+		plan := buildPlan()
+		if err := buildApp(plan, &stepCounter{prefix: "Build", total: len(plan)}); err != nil {
 			log("ERROR: Build failed: %v", err)
 			return
 		}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseQuietWindow(t *testing.T) {
+	tests := []struct {
+		in         string
+		start, end int
+		ok         bool
+	}{
+		{"22:00-06:00", 22 * 60, 6 * 60, true},
+		{"22-6", 22 * 60, 6 * 60, true},
+		{" 01:30 - 03:45 ", 90, 225, true},
+		{"", 0, 0, false},
+		{"22:00", 0, 0, false},
+		{"25:00-06:00", 0, 0, false},
+		{"10:00-10:00", 0, 0, false},
+		{"ab-cd", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		start, end, ok := parseQuietWindow(tt.in)
+		if ok != tt.ok || start != tt.start || end != tt.end {
+			t.Errorf("parseQuietWindow(%q) = %d, %d, %v; want %d, %d, %v", tt.in, start, end, ok, tt.start, tt.end, tt.ok)
+		}
+	}
+}
+
+func TestInQuietWindow(t *testing.T) {
+	at := func(h, m int) time.Time {
+		return time.Date(2024, 1, 1, h, m, 0, 0, time.UTC)
+	}
+
+	// Same-day window
+	if !inQuietWindow(at(10, 0), 9*60, 17*60) {
+		t.Error("10:00 should be inside 09:00-17:00")
+	}
+	if inQuietWindow(at(17, 0), 9*60, 17*60) {
+		t.Error("17:00 should be outside 09:00-17:00")
+	}
+
+	// Window wrapping past midnight
+	if !inQuietWindow(at(23, 30), 22*60, 6*60) {
+		t.Error("23:30 should be inside 22:00-06:00")
+	}
+	if !inQuietWindow(at(5, 59), 22*60, 6*60) {
+		t.Error("05:59 should be inside 22:00-06:00")
+	}
+	if inQuietWindow(at(12, 0), 22*60, 6*60) {
+		t.Error("12:00 should be outside 22:00-06:00")
+	}
+}
+
+func TestWaitForHTTP(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			http.Error(w, "warming up", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	if err := waitForHTTP(srv.URL, time.Second, 10*time.Millisecond); err != nil {
+		t.Fatalf("expected healthy, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("expected 3 requests, got %d", got)
+	}
+}
+
+func TestWaitForHTTPReportsLastFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database unavailable", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	err := waitForHTTP(srv.URL, 50*time.Millisecond, 10*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected error from unhealthy server")
+	}
+	if !strings.Contains(err.Error(), "status 500") || !strings.Contains(err.Error(), "database unavailable") {
+		t.Errorf("error should include status and body, got %q", err)
+	}
+}
+
+func TestCheckHTTPConnectionRefused(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	if err := checkHTTP(url, time.Second); err == nil {
+		t.Fatal("expected connection error for closed server")
+	}
+}
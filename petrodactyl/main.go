@@ -50,22 +50,30 @@ func main() {
 
 	log("INFO", "Starting Pterodactyl Panel service: %s", serviceType)
 
-	// Run migrations (only for php-fpm)
+	// Run migrations (only for php-fpm). Several replicas may start at
+	// once, so they take turns under a database lock.
 	if serviceType == "php-fpm" || strings.Contains(serviceType, "php-fpm") {
-		if os.Getenv("RUN_MIGRATIONS_ON_START") == "true" {
-			runMigrations()
-		}
-
-		if os.Getenv("RUN_SEED_ON_START") == "true" {
-			runSeed()
+		runMigrate := os.Getenv("RUN_MIGRATIONS_ON_START") == "true"
+		runSeeds := os.Getenv("RUN_SEED_ON_START") == "true"
+
+		if runMigrate || runSeeds {
+			if err := runDatabaseSetup(runMigrate, runSeeds); err != nil {
+				log("ERROR", "!!! Database setup FAILED: %v", err)
+				if getEnv("MIGRATION_FAIL_FATAL", "false") == "true" {
+					log("ERROR", "MIGRATION_FAIL_FATAL=true, aborting startup")
+					os.Exit(1)
+				}
+				log("WARN", "Continuing startup with a possibly outdated schema (set MIGRATION_FAIL_FATAL=true to abort)")
+			}
 		}
 	}
 
 	// Set proper permissions
 	setPermissions()
 
-	// For Caddy service, register with go-proxy before starting
-	if serviceType == "caddy" {
+	// For Caddy service, register with go-proxy before starting. Horizon
+	// only registers when its dashboard is served from this container.
+	if serviceType == "caddy" || (serviceType == "horizon" && getEnv("HORIZON_REGISTER_PROXY", "false") == "true") {
 		registerWithProxy()
 	}
 
@@ -76,7 +84,9 @@ func main() {
 	case "caddy":
 		startCaddy()
 	case "queue":
-		startQueue()
+		startQueue(sigChan)
+	case "horizon":
+		startHorizon(sigChan)
 	case "cron":
 		startCron(sigChan)
 	default:
@@ -127,7 +137,7 @@ func loadSecret(varName string) {
 	log("INFO", "Loaded %s from secret", varName)
 }
 
-func runMigrations() {
+func runMigrations() error {
 	log("INFO", "Running database migrations...")
 
 	cmd := exec.Command("php", "artisan", "migrate", "--force", "--isolated")
@@ -136,25 +146,75 @@ func runMigrations() {
 	// Capture output
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		log("WARN", "Migrations failed or partially completed: %v", err)
 		fmt.Println(string(output))
-		return
+		return fmt.Errorf("migrations failed or partially completed: %w", err)
 	}
 
 	log("INFO", "Migrations completed successfully")
+	return nil
 }
 
-func runSeed() {
+func runSeed() error {
 	log("INFO", "Seeding database...")
 
+	// db:seed has no --isolated flag; runDatabaseSetup holds the setup
+	// lock and skips the seed once it has been recorded as done
 	cmd := exec.Command("php", "artisan", "db:seed", "--force")
 	cmd.Dir = appDir
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
 	if err := cmd.Run(); err != nil {
-		log("WARN", "Seeding failed: %v", err)
+		return fmt.Errorf("seeding failed: %w", err)
+	}
+	return nil
+}
+
+// seedStep is the entrypoint_setup marker recorded after a successful seed.
+// Panel releases ship egg and nest updates through db:seed, so the marker is
+// per panel version; "" when the version is unknown, and the seed always runs.
+func seedStep() string {
+	if version := os.Getenv("PANEL_VERSION"); version != "" {
+		return "db_seed:" + version
+	}
+	return ""
+}
+
+// runDatabaseSetup migrates and seeds while holding the database setup lock,
+// so replicas on any node take turns instead of racing. Migrations run on
+// every start (migrate only applies what is pending); seeds run until one
+// replica records a successful seed for the running panel version, so a
+// failed attempt is retried by the next replica to take the lock and an
+// upgraded image seeds again.
+func runDatabaseSetup(runMigrate, runSeeds bool) error {
+	timeout := parseSeconds(getEnv("MIGRATION_LOCK_TIMEOUT", "600"), 600)
+	log("INFO", "Acquiring database setup lock (waiting up to %ds)...", timeout)
+	lock, err := acquireSetupLock(timeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	if runMigrate {
+		if err := runMigrations(); err != nil {
+			return err
+		}
+	}
+	if !runSeeds {
+		return nil
+	}
+	step := seedStep()
+	if step != "" && lock.Done(step) {
+		log("INFO", "Database was already seeded for %s, skipping seed", os.Getenv("PANEL_VERSION"))
+		return nil
+	}
+	if err := runSeed(); err != nil {
+		return err
 	}
+	if step == "" {
+		return nil
+	}
+	return lock.MarkDone(step)
 }
 
 func setPermissions() {
@@ -224,28 +284,120 @@ func startCaddy() {
 	}
 }
 
-func startQueue() {
+func startQueue(sigChan chan os.Signal) {
 	log("INFO", "Starting Laravel queue worker...")
 
+	args := []string{"artisan", "queue:work"}
+	if conn := os.Getenv("QUEUE_WORKER_CONNECTION"); conn != "" {
+		args = append(args, conn)
+	}
+	args = append(args,
+		"--queue="+getEnv("QUEUE_NAMES", "high,standard,low"),
+		"--sleep="+getEnv("QUEUE_SLEEP", "3"),
+		"--tries="+getEnv("QUEUE_TRIES", "3"),
+		"--max-time="+getEnv("QUEUE_MAX_TIME", "3600"))
+	if timeout := os.Getenv("QUEUE_TIMEOUT"); timeout != "" {
+		args = append(args, "--timeout="+timeout)
+	}
+	if extra := os.Getenv("QUEUE_EXTRA_ARGS"); extra != "" {
+		args = append(args, strings.Fields(extra)...)
+	}
+
+	superviseWorker("Queue worker", args, func(cmd *exec.Cmd) {
+		// queue:restart asks every worker to exit after its current job,
+		// SIGTERM makes this one stop waiting for new jobs
+		runArtisan("queue:restart")
+		cmd.Process.Signal(syscall.SIGTERM)
+	}, sigChan)
+}
+
+func startHorizon(sigChan chan os.Signal) {
+	log("INFO", "Starting Laravel Horizon...")
+
+	superviseWorker("Horizon", []string{"artisan", "horizon"}, func(cmd *exec.Cmd) {
+		// horizon:terminate lets the supervisors finish their current jobs
+		runArtisan("horizon:terminate")
+	}, sigChan)
+}
+
+// superviseWorker runs "php <args>" and restarts it with exponential backoff
+// until a signal arrives. On a signal, stop is called to drain the worker
+// gracefully; it is killed if it does not exit within WORKER_STOP_TIMEOUT.
+func superviseWorker(name string, args []string, stop func(cmd *exec.Cmd), sigChan chan os.Signal) {
+	stopTimeout := parseSeconds(getEnv("WORKER_STOP_TIMEOUT", "25"), 25)
+	backoff := time.Second
+	const maxBackoff = 60 * time.Second
+
 	for {
-		cmd := exec.Command("php", "artisan", "queue:work",
-			"--queue=high,standard,low",
-			"--sleep=3",
-			"--tries=3",
-			"--max-time=3600")
+		cmd := exec.Command("php", args...)
 		cmd.Dir = appDir
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 
-		if err := cmd.Run(); err != nil {
-			log("WARN", "Queue worker exited: %v, restarting in 5s...", err)
-			time.Sleep(5 * time.Second)
-			continue
+		if err := cmd.Start(); err != nil {
+			log("ERROR", "%s failed to start: %v", name, err)
+		} else {
+			started := time.Now()
+			exited := make(chan error, 1)
+			go func() { exited <- cmd.Wait() }()
+
+			select {
+			case err := <-exited:
+				if err != nil {
+					log("WARN", "%s exited: %v", name, err)
+				} else {
+					log("INFO", "%s exited cleanly", name)
+				}
+				// A worker that ran for a while was not crash-looping
+				if time.Since(started) > maxBackoff {
+					backoff = time.Second
+				}
+			case sig := <-sigChan:
+				log("INFO", "Received signal %v, stopping %s...", sig, strings.ToLower(name))
+				stop(cmd)
+				select {
+				case <-exited:
+					log("INFO", "%s stopped gracefully", name)
+				case <-time.After(time.Duration(stopTimeout) * time.Second):
+					log("WARN", "%s did not stop within %ds, killing", name, stopTimeout)
+					cmd.Process.Kill()
+					<-exited
+				}
+				return
+			}
+		}
+
+		log("INFO", "Restarting %s in %v...", strings.ToLower(name), backoff)
+		select {
+		case <-time.After(backoff):
+		case sig := <-sigChan:
+			log("INFO", "Received signal %v, not restarting %s", sig, strings.ToLower(name))
+			return
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
 		}
+	}
+}
+
+// runArtisan runs a short artisan command, logging failures
+func runArtisan(args ...string) {
+	cmd := exec.Command("php", append([]string{"artisan"}, args...)...)
+	cmd.Dir = appDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		log("WARN", "php artisan %s failed: %v", strings.Join(args, " "), err)
+	}
+}
 
-		log("INFO", "Queue worker exited cleanly, restarting in 5s...")
-		time.Sleep(5 * time.Second)
+func parseSeconds(s string, def int) int {
+	var n int
+	if _, err := fmt.Sscanf(s, "%d", &n); err != nil || n < 0 {
+		return def
 	}
+	return n
 }
 
 func startCron(sigChan chan os.Signal) {
@@ -348,7 +500,8 @@ func registerWithProxy() {
 
 	log("INFO", "Using container IP: %s", registryClientV2.GetLocalIP())
 
-	// Build backend URL using the detected IP and configured port
+	// Build backend URL using the detected IP and configured port. The
+	// client only detects IPv4 addresses; IPv6-only networks are unsupported
 	backendURL := registryClientV2.BuildBackendURL(port)
 	domainList := strings.Split(strings.ReplaceAll(domains, " ", ""), ",")
 
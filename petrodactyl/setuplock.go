@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// setupLockScript holds a MySQL named lock for as long as its stdin stays
+// open. After taking the lock it prints one "DONE <step>" line per step
+// recorded in entrypoint_setup, then "LOCKED". Every step name written to
+// stdin is recorded and acknowledged with "OK". Closing stdin ends the
+// script, and the lock is released with the connection.
+//
+// The panel image has no Go MySQL driver but ships php83-pdo_mysql, so the
+// lock is held by a PHP child rather than in-process.
+const setupLockScript = `
+$dsn = sprintf('mysql:host=%s;port=%s;dbname=%s',
+    getenv('DB_HOST') ?: 'mariadb', getenv('DB_PORT') ?: '3306', getenv('DB_DATABASE') ?: 'panel');
+try {
+    $db = new PDO($dsn, getenv('DB_USERNAME') ?: 'pterodactyl', getenv('DB_PASSWORD') ?: '',
+        [PDO::ATTR_ERRMODE => PDO::ERRMODE_EXCEPTION]);
+    $got = $db->query("SELECT GET_LOCK('pterodactyl_entrypoint_setup', " . (int) getenv('SETUP_LOCK_TIMEOUT') . ")")->fetchColumn();
+    if ($got != 1) {
+        echo "TIMEOUT\n";
+        exit(2);
+    }
+    $db->exec('CREATE TABLE IF NOT EXISTS entrypoint_setup (step VARCHAR(64) NOT NULL PRIMARY KEY, completed_at DATETIME NOT NULL)');
+    foreach ($db->query('SELECT step FROM entrypoint_setup') as $row) {
+        echo "DONE {$row[0]}\n";
+    }
+    echo "LOCKED\n";
+    $mark = $db->prepare('INSERT INTO entrypoint_setup (step, completed_at) VALUES (?, NOW()) ON DUPLICATE KEY UPDATE completed_at = NOW()');
+    while (($line = fgets(STDIN)) !== false) {
+        if (($step = trim($line)) !== '') {
+            $mark->execute([$step]);
+            echo "OK\n";
+        }
+    }
+} catch (Throwable $e) {
+    echo 'ERROR ' . str_replace("\n", ' ', $e->getMessage()) . "\n";
+    exit(1);
+}
+`
+
+// setupLock is the database-wide lock that serializes migrations and seeds
+// across every replica, on any node, that shares the panel database.
+type setupLock struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	out   *bufio.Reader
+	done  map[string]bool
+}
+
+// acquireSetupLock blocks until this replica holds the setup lock or
+// timeout seconds have passed.
+func acquireSetupLock(timeout int) (*setupLock, error) {
+	cmd := exec.Command("php", "-r", setupLockScript)
+	cmd.Dir = appDir
+	cmd.Env = append(os.Environ(), fmt.Sprintf("SETUP_LOCK_TIMEOUT=%d", timeout))
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start setup lock helper: %w", err)
+	}
+
+	l := &setupLock{cmd: cmd, stdin: stdin, out: bufio.NewReader(stdout), done: make(map[string]bool)}
+	for {
+		line, err := l.readLine()
+		switch {
+		case err != nil:
+			l.Release()
+			return nil, fmt.Errorf("setup lock helper exited: %w", err)
+		case line == "LOCKED":
+			return l, nil
+		case line == "TIMEOUT":
+			l.Release()
+			return nil, fmt.Errorf("timed out after %ds waiting for another replica's database setup", timeout)
+		case strings.HasPrefix(line, "DONE "):
+			l.done[strings.TrimPrefix(line, "DONE ")] = true
+		case strings.HasPrefix(line, "ERROR "):
+			l.Release()
+			return nil, fmt.Errorf("setup lock: %s", strings.TrimPrefix(line, "ERROR "))
+		}
+	}
+}
+
+// Done reports whether step was recorded as completed by any replica.
+func (l *setupLock) Done(step string) bool {
+	return l.done[step]
+}
+
+// MarkDone records step as completed so later starts skip it.
+func (l *setupLock) MarkDone(step string) error {
+	if _, err := fmt.Fprintln(l.stdin, step); err != nil {
+		return fmt.Errorf("record %s: %w", step, err)
+	}
+	line, err := l.readLine()
+	if err != nil {
+		return fmt.Errorf("record %s: %w", step, err)
+	}
+	if line != "OK" {
+		return fmt.Errorf("record %s: %s", step, strings.TrimPrefix(line, "ERROR "))
+	}
+	l.done[step] = true
+	return nil
+}
+
+// Release drops the lock by ending the helper's database session.
+func (l *setupLock) Release() {
+	l.stdin.Close()
+	l.cmd.Wait()
+}
+
+func (l *setupLock) readLine() (string, error) {
+	line, err := l.out.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
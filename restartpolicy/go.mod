@@ -0,0 +1,3 @@
+module restartpolicy
+
+go 1.21
@@ -0,0 +1,95 @@
+// Package restartpolicy is the restart backoff and crash-loop detection
+// shared by the node-runner and orbat supervisors.
+package restartpolicy
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MaxBackoff caps the exponential restart delay.
+const MaxBackoff = 5 * time.Minute
+
+// Policy decides how long to wait before restarting a crashed child
+// and whether the child is crash-looping. More than Max crashes inside
+// Window is treated as a crash loop.
+type Policy struct {
+	Max     int
+	Window  time.Duration
+	Backoff time.Duration
+
+	mu      sync.Mutex
+	crashes []time.Time
+}
+
+// Load reads RESTART_MAX, RESTART_WINDOW and RESTART_BACKOFF,
+// keeping the defaults for unset or invalid values.
+func Load() *Policy {
+	p := &Policy{
+		Max:     5,
+		Window:  5 * time.Minute,
+		Backoff: 5 * time.Second,
+	}
+	if v, err := strconv.Atoi(os.Getenv("RESTART_MAX")); err == nil {
+		p.Max = v
+	}
+	if d, err := time.ParseDuration(os.Getenv("RESTART_WINDOW")); err == nil {
+		p.Window = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("RESTART_BACKOFF")); err == nil {
+		p.Backoff = d
+	}
+	return p
+}
+
+// Delay returns the delay before the given restart attempt (1-based),
+// doubling the base delay for every attempt and capping at MaxBackoff.
+func (p *Policy) Delay(attempt int) time.Duration {
+	if p.Backoff <= 0 {
+		return 0
+	}
+	d := p.Backoff
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= MaxBackoff {
+			return MaxBackoff
+		}
+	}
+	if d > MaxBackoff {
+		return MaxBackoff
+	}
+	return d
+}
+
+// RecordCrash registers a crash at now and returns the delay before the next
+// restart and whether the crash count inside the window exceeds Max.
+func (p *Policy) RecordCrash(now time.Time) (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cutoff := now.Add(-p.Window)
+	kept := p.crashes[:0]
+	for _, t := range p.crashes {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	p.crashes = append(kept, now)
+
+	n := len(p.crashes)
+	return p.Delay(n), n > p.Max
+}
+
+// Reset forgets previous crashes once the child has been stable for a window.
+func (p *Policy) Reset() {
+	p.mu.Lock()
+	p.crashes = nil
+	p.mu.Unlock()
+}
+
+// CrashLoopReason is the alert logged when the child starts crash-looping.
+func (p *Policy) CrashLoopReason() string {
+	return "crash loop: more than " + strconv.Itoa(p.Max) + " restarts within " + p.Window.String()
+}
@@ -0,0 +1,89 @@
+package restartpolicy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	p := &Policy{Backoff: 2 * time.Second}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 2 * time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{5, 32 * time.Second},
+		{8, 256 * time.Second},
+		{9, MaxBackoff},
+		{100, MaxBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := p.Delay(tt.attempt); got != tt.want {
+			t.Errorf("Delay(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestDelayDisabled(t *testing.T) {
+	p := &Policy{}
+	if got := p.Delay(4); got != 0 {
+		t.Errorf("Delay with zero base = %s, want 0", got)
+	}
+}
+
+func TestRecordCrashDetectsLoop(t *testing.T) {
+	p := &Policy{Max: 3, Window: time.Minute, Backoff: time.Second}
+	now := time.Now()
+
+	for i := 1; i <= 3; i++ {
+		delay, loop := p.RecordCrash(now.Add(time.Duration(i) * time.Second))
+		if loop {
+			t.Fatalf("crash %d flagged as crash loop", i)
+		}
+		if want := p.Delay(i); delay != want {
+			t.Errorf("crash %d delay = %s, want %s", i, delay, want)
+		}
+	}
+
+	if _, loop := p.RecordCrash(now.Add(4 * time.Second)); !loop {
+		t.Error("expected crash loop after exceeding Max within window")
+	}
+}
+
+func TestRecordCrashPrunesOldCrashes(t *testing.T) {
+	p := &Policy{Max: 2, Window: time.Minute, Backoff: time.Second}
+	now := time.Now()
+
+	p.RecordCrash(now)
+	p.RecordCrash(now.Add(10 * time.Second))
+
+	// Both earlier crashes are outside the window, so this counts as the first.
+	delay, loop := p.RecordCrash(now.Add(2 * time.Minute))
+	if loop {
+		t.Error("crashes outside the window should not count towards a loop")
+	}
+	if delay != time.Second {
+		t.Errorf("delay = %s, want %s", delay, time.Second)
+	}
+
+	p.Reset()
+	if delay, _ := p.RecordCrash(now.Add(3 * time.Minute)); delay != time.Second {
+		t.Errorf("delay after reset = %s, want %s", delay, time.Second)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("RESTART_MAX", "3")
+	t.Setenv("RESTART_WINDOW", "bogus")
+	t.Setenv("RESTART_BACKOFF", "1s")
+
+	p := Load()
+	if p.Max != 3 || p.Window != 5*time.Minute || p.Backoff != time.Second {
+		t.Errorf("Load() = max %d window %s backoff %s", p.Max, p.Window, p.Backoff)
+	}
+}
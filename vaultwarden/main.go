@@ -214,7 +214,8 @@ func registerWithProxy() error {
 
 	log("INFO", "Using container IP: %s", registryClientV2.GetLocalIP())
 
-	// Build backend URL using the detected IP and configured port
+	// Build backend URL using the detected IP and configured port. The
+	// client only detects IPv4 addresses; IPv6-only networks are unsupported
 	backendURL := registryClientV2.BuildBackendURL(port)
 	domainList := strings.Split(strings.ReplaceAll(domains, " ", ""), ",")
 